@@ -1,56 +1,369 @@
 package config
 
 import (
+	"log"
+	"math"
 	"os"
 	"strconv"
 	"strings"
-
-	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port               string
-	AptosNodeURL       string
-	AptosIndexerURL    string // Aptos Indexer API URL
-	AptosIndexerAPIKey string // Aptos Indexer API Key
-	UseIndexer         bool   // Toggle to enable/disable indexer usage
-	DataXModuleAddr    string
-	NetworkModuleAddr  string
-	ChainID            uint8
-	SupabaseS3URL      string
-	SupabaseKey        string
-	SupabaseBucket     string
-	SupabaseAccessKey  string // S3 access key (if using S3 SDK)
-	SupabaseSecretKey  string // S3 secret key (if using S3 SDK)
-	ShelbyRPCURL       string
-	ShelbyAccountKey   string
+	Port                 string
+	Profile              string // DATAX_PROFILE: named node, indexer, chain ID and module addresses (see profiles.go)
+	AptosNodeURL         string
+	AptosIndexerURL      string // Aptos Indexer API URL
+	AptosIndexerAPIKey   string // Aptos Indexer API Key
+	UseIndexer           bool   // Toggle to enable/disable indexer usage
+	DataXModuleAddr      string
+	NetworkModuleAddr    string
+	EscrowModuleAddr     string // Address the Escrow module is published at (default NETWORK_MODULE_ADDR)
+	ChainID              uint8
+	SupabaseS3URL        string
+	SupabaseKey          string
+	SupabaseBucket       string
+	SupabaseAccessKey    string // S3 access key (if using S3 SDK)
+	SupabaseSecretKey    string // S3 secret key (if using S3 SDK)
+	ShelbyRPCURL         string
+	ShelbyAccountKey     string
+	StorageBackend       string // Storage backend: supabase, shelby, local or ipfs
+	LocalStorageDir      string // Root directory of the local storage backend
+	StorageStrictStartup bool   // Refuse to start when the storage backend can't be reached
+
+	// IPFS storage
+	IPFSAPIURL         string // Kubo-compatible HTTP RPC API of the node or pinning service
+	IPFSAuth           string // "user:password" for basic auth or a bearer token; empty sends no credentials
+	IPFSUploadTimeout  int    // Seconds an add (upload) may take, so large blobs aren't cut off by the request timeout
+	IPFSRequestTimeout int    // Seconds for every other IPFS API call
+	IPFSMFSRoot        string // MFS directory holding per-owner blob links, sidecars and manifests
+
+	// Mock chain (frontend development)
+	MockChain          bool   // Serve an in-memory chain instead of talking to Aptos
+	MockChainStateFile string // JSON file the mock chain persists to; empty keeps it in memory
+
+	// Local devnet bootstrap (aptos node run-local-testnet)
+	DevnetBootstrap   bool   // Fund a deployer and publish the Move package on a local node at startup; a no-op on any other chain
+	DevnetFaucetURL   string // Faucet of the local node
+	DevnetPackagePath string // Move package directory to publish as the deployer; empty only funds the deployer
+	DevnetAptosCLI    string // Aptos CLI that compiles the package
+	DevnetDeployerKey string // Ed25519 key of the deployer; empty generates one per start
+	DevnetFundOctas   int    // Octas the faucet funds the deployer with
+
+	// Server
+	Environment         string   // "production" disables permissive defaults
+	ShutdownGracePeriod int      // Seconds to let in-flight requests finish on SIGINT/SIGTERM
+	CORSAllowedOrigins  []string // Origins allowed to call the API (exact or *.domain)
+	CORSMaxAge          int      // Seconds browsers may cache preflight responses
+	APIKeys             []APIKey // Accepted API bearer tokens; empty disables API key auth
+	AdminAPIKeys        []APIKey // Keys accepted in X-Admin-Key on /api/v1/admin; empty disables the admin routes
+	AuthChallengeTTL    int      // Seconds a wallet signature nonce stays valid
+	AccessTokenSecret   string   // HMAC key for data access tokens; random per process when empty
+	AccessTokenTTL      int      // Seconds a data access token stands in for a wallet signature and access check
+	TrustedProxies      []string // Proxy IPs/CIDRs whose X-Forwarded-For is honored
+	IdempotencyTTL      int      // Seconds a write's response is replayed to retries with the same Idempotency-Key
+
+	// Uploads
+	MaxUploadBytes         int64 // Largest accepted CSV upload request body
+	MaxCSVRows             int   // Data rows allowed in an uploaded CSV
+	MaxCSVColumns          int   // Columns allowed in an uploaded CSV
+	RejectDataHashMismatch bool  // Refuse uploads whose data_hash differs from the server-computed hash; false only warns
+
+	// Schema inference
+	SchemaSampleBytes int // Bytes of a CSV read by /data/infer-schema
+	SchemaSampleRows  int // Data rows sampled when inferring a schema
+
+	// Column statistics
+	StatsMaxDistinct int // Distinct values tracked per column before the count is capped
+
+	// PII scanning, advisory only: findings are reported, the data is never changed
+	PIIScanEnabled bool     // Scan uploaded CSVs and store the report with their statistics
+	PIISampleRows  int      // Data rows scanned per upload or /data/scan-pii request
+	PIIFlagPercent int      // Match rate, in percent of a column's non-null values, that flags it
+	PIIDetectors   []string // Built-in detectors to run; empty runs them all
+	PIIPatterns    []string // Extra "name=regex" detectors, separated by semicolons
+
+	// Dataset preview
+	PreviewMaxBytes int // Most bytes of a blob read to build a preview
+	SampleMaxRows   int // Most rows /data/sample returns, whatever a dataset's sample_rows asks for
+
+	// Aggregate queries
+	AggregateMinGroupSize int // Groups with fewer rows are left out of /data/aggregate results
+	AggregateMaxGroups    int // Distinct groups a query may build before it is refused
+	AggregateTimeout      int // Seconds a query may spend aggregating rows
+
+	// Storage uploads
+	StorageMultipartThreshold int64 // Payloads larger than this are stored with a multipart upload
+	StoragePartSize           int64 // Multipart part size (at least 5 MB)
+	StorageMultipartMaxAge    int   // Seconds after which an incomplete multipart upload is aborted
+
+	// Storage retries (transient S3 errors)
+	StorageRetryAttempts int // Tries per storage call, including the first
+	StorageRetryBudget   int // Seconds a storage call may spend retrying
+
+	// Storage listings
+	StorageListMaxKeys int // Most keys read, page by page, from one listing of a bucket prefix
+
+	// Presigned storage URLs
+	PresignDownloadTTL int // Seconds a presigned download URL stays valid when the client doesn't ask
+	PresignMaxTTL      int // Longest validity, in seconds, a client may request for a presigned URL
+
+	// Encryption at rest
+	EncryptionMasterKey    string   // 32-byte key (hex or base64) wrapping per-dataset data keys; empty stores uploads as plain CSV
+	EncryptionAlgorithm    string   // AES-256-GCM or XChaCha20-Poly1305, for data encrypted from now on
+	EncryptionPreviousKeys []string // Retired master keys still accepted to unwrap data keys until blobs are migrated
+
+	// Master key provider (encryption at rest)
+	KeyProvider       string // static (ENCRYPTION_MASTER_KEY), kms (AWS KMS) or vault (HashiCorp Vault transit)
+	KeyCacheTTL       int    // Seconds an unwrapped data key from KMS or Vault is reused before asking again; 0 disables
+	KMSKeyID          string // Key ID, ARN or alias of the AWS KMS key wrapping data keys
+	KMSRegion         string // AWS region of the KMS key; credentials come from the default AWS chain
+	KMSEndpoint       string // Overrides https://kms.{region}.amazonaws.com, e.g. for LocalStack
+	VaultAddr         string // Vault server, e.g. https://vault.internal:8200
+	VaultToken        string // Token allowed to encrypt and decrypt with the transit key
+	VaultTransitMount string // Mount path of the transit secrets engine
+	VaultTransitKey   string // Name of the transit key wrapping data keys
+
+	// Data integrity
+	IntegrityWarnOnly bool // Log on-chain data hash mismatches instead of refusing to serve the data
+
+	// Rate limits, marketplace and cache settings can change at runtime, see Tunables
+
+	// Access
+	AccessExpirySkew int // Seconds a grant is still honored after its expires_at, allowing for ledger timestamp lag
+
+	// Payments
+	PaymentEscrowAddress string // Account payments may go to instead of the owner (empty = owner only)
+	PaymentTimeTolerance int    // Seconds a payment may predate its access request, allowing for clock skew
+
+	// Sponsored transactions
+	SponsorPrivateKey string // Ed25519 key of the account paying gas for transactions the backend sponsors; empty disables sponsoring
+
+	// Contribution rewards
+	RewardsEnabled     bool     // Mint tokens to the submitter of every dataset the local event index sees (needs SOURCE=local)
+	RewardMinterKey    string   // Private key of the DataX module account, which holds the mint capability
+	RewardAmount       int      // Token base units minted per submitted dataset
+	RewardDailyCap     int      // Most base units one address is rewarded per UTC day; 0 turns the cap off
+	RewardAllowlist    []string // When set, only these addresses are rewarded
+	RewardDenylist     []string // Addresses never rewarded
+	RewardPollInterval int      // Seconds between looks for new submissions
+
+	// Indexer discovery paging
+	IndexerPageSize int // Rows requested per GraphQL page
+	IndexerMaxPages int // Safety limit on pages fetched per discovery run
+
+	// Transaction scanner (user discovery fallback)
+	TxScanBatchSize    int // Transactions requested per REST call
+	TxScanMaxLag       int // Versions the scanner may fall behind the tip before it skips ahead (0 = never skip)
+	TxScanTimeBudget   int // Seconds a single scan may run
+	TxScanStartVersion int // Version to start from when no checkpoint exists (0 = recent window only)
+
+	// Webhooks
+	WebhookMaxAttempts  int  // Deliveries tried per event before giving up
+	WebhookTimeout      int  // Seconds a webhook endpoint has to answer
+	WebhookWorkers      int  // Deliveries in flight at once
+	WebhookAllowPrivate bool // Allow endpoints on loopback, link-local and private addresses (local development)
+
+	// Local event index
+	ReadSource        string // remote (fullnode and public indexer) or local (SQLite event index, remote while it lags)
+	IndexDBPath       string // SQLite file the event indexer writes
+	IndexPollInterval int    // Seconds between polls once the index has caught up
+	IndexBatchSize    int    // Transactions per REST call (the fullnode serves at most 100)
+	IndexMaxLag       int    // Versions the index may trail the ledger and still answer reads
+	IndexStartVersion int    // Version to start from without a checkpoint (0 = the modules' first transaction)
+
+	// Database
+	DatabaseURL string // postgres://... or sqlite://path for state, access requests, idempotency keys and the audit log; empty keeps them in the storage backend
+
+	profileDefined bool // Profile is built in or has {PROFILE}_ variables
+}
+
+// APIKey is an accepted API bearer token with a label identifying the client
+type APIKey struct {
+	Label string
+	Key   string
 }
 
+// AppConfig holds the settings read at startup. The runtime-tunable ones are in Tunable()
 var AppConfig *Config
 
 func LoadConfig() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
 	// Load .env file if it exists
-	_ = godotenv.Load()
-
-	AppConfig = &Config{
-		Port:               getEnv("PORT", "8080"),
-		AptosNodeURL:       getEnv("APTOS_NODE_URL", "https://fullnode.testnet.aptoslabs.com"),
-		AptosIndexerURL:    getEnv("APTOS_INDEXER_URL", "https://api.testnet.aptoslabs.com/v1/graphql"),
-		AptosIndexerAPIKey: getEnv("APTOS_INDEXER_API_KEY", "aptoslabs_gFwzfgw2qNK_PoVDshwNdcPq8gKAn9MMwjc3nydopPU5k"),
-		UseIndexer:         getEnvAsBool("USE_INDEXER", "true"), // Enable indexer by default
-		DataXModuleAddr:    getEnv("DATAX_MODULE_ADDR", "0x0b133cba97a77b2dee290919e27c72c7d49d8bf5a3294efbd8c40cc38a009eab"),
-		NetworkModuleAddr:  getEnv("NETWORK_MODULE_ADDR", "0x0b133cba97a77b2dee290919e27c72c7d49d8bf5a3294efbd8c40cc38a009eab"),
-		ChainID:            uint8(getEnvAsInt("CHAIN_ID", "2")), // 2 for testnet
-		SupabaseS3URL:      getEnv("SUPABASE_S3_URL", ""),
-		SupabaseKey:        getEnv("SUPABASE_KEY", ""),
-		SupabaseBucket:     getEnv("SUPABASE_BUCKET", "csv-data"), // Supabase storage bucket name
-		SupabaseAccessKey:  getEnv("SUPABASE_ACCESS_KEY", ""),     // S3 access key (if using S3 SDK)
-		SupabaseSecretKey:  getEnv("SUPABASE_SECRET_KEY", ""),     // S3 secret key (if using S3 SDK)
-		ShelbyRPCURL:       getEnv("SHELBY_RPC_URL", ""),
-		ShelbyAccountKey:   getEnv("SHELBY_ACCOUNT_KEY", ""),
+	if err := loadDotenv(); err != nil {
+		return err
 	}
 
-	return nil
+	AppConfig = readConfig()
+	tunables.Store(loadTunables())
+
+	log.Printf("Using configuration profile %q: node %s, chain ID %d, DataX module %s", AppConfig.Profile, AppConfig.AptosNodeURL, AppConfig.ChainID, AppConfig.DataXModuleAddr)
+	return AppConfig.Validate()
+}
+
+// readConfig builds the startup settings from the environment
+func readConfig() *Config {
+	// The node, indexer, chain ID and module addresses come as a unit from DATAX_PROFILE
+	profileName := strings.ToLower(getEnv("DATAX_PROFILE", defaultProfile))
+	chain, profileDefined := resolveProfile(profileName)
+
+	// A chain ID that isn't a number or doesn't fit in a byte is zeroed, for Validate to report
+	chainID, err := strconv.Atoi(chain["CHAIN_ID"])
+	if err != nil || chainID < 1 || chainID > math.MaxUint8 {
+		chainID = 0
+	}
+
+	// The indexer needs an API key, so it is only on by default when one is set
+	indexerAPIKey := strings.TrimSpace(getEnv("APTOS_INDEXER_API_KEY", ""))
+
+	c := &Config{
+		Port:                 getEnv("PORT", "8080"),
+		Profile:              profileName,
+		AptosNodeURL:         chain["APTOS_NODE_URL"],
+		AptosIndexerURL:      chain["APTOS_INDEXER_URL"],
+		AptosIndexerAPIKey:   indexerAPIKey,
+		UseIndexer:           getEnvAsBool("USE_INDEXER", strconv.FormatBool(indexerAPIKey != "")),
+		DataXModuleAddr:      chain["DATAX_MODULE_ADDR"],
+		NetworkModuleAddr:    chain["NETWORK_MODULE_ADDR"],
+		EscrowModuleAddr:     chain["ESCROW_MODULE_ADDR"],
+		ChainID:              uint8(chainID),
+		SupabaseS3URL:        getEnv("SUPABASE_S3_URL", ""),
+		SupabaseKey:          getEnv("SUPABASE_KEY", ""),
+		SupabaseBucket:       getEnv("SUPABASE_BUCKET", "csv-data"), // Supabase storage bucket name
+		SupabaseAccessKey:    getEnv("SUPABASE_ACCESS_KEY", ""),     // S3 access key (if using S3 SDK)
+		SupabaseSecretKey:    getEnv("SUPABASE_SECRET_KEY", ""),     // S3 secret key (if using S3 SDK)
+		ShelbyRPCURL:         getEnv("SHELBY_RPC_URL", ""),
+		ShelbyAccountKey:     getEnv("SHELBY_ACCOUNT_KEY", ""),
+		StorageBackend:       getEnv("STORAGE_BACKEND", "supabase"),
+		LocalStorageDir:      getEnv("LOCAL_STORAGE_DIR", "./data/storage"),
+		StorageStrictStartup: getEnvAsBool("STORAGE_STRICT_STARTUP", "true"),
+
+		IPFSAPIURL:         getEnv("IPFS_API_URL", "http://127.0.0.1:5001"),
+		IPFSAuth:           getEnv("IPFS_AUTH", ""),
+		IPFSUploadTimeout:  getEnvAsInt("IPFS_UPLOAD_TIMEOUT", "600"),
+		IPFSRequestTimeout: getEnvAsInt("IPFS_REQUEST_TIMEOUT", "30"),
+		IPFSMFSRoot:        getEnv("IPFS_MFS_ROOT", "/datax"),
+
+		MockChain:          getEnvAsBool("MOCK_CHAIN", "false"),
+		MockChainStateFile: getEnv("MOCK_CHAIN_STATE_FILE", ""),
+
+		DevnetBootstrap:   getEnvAsBool("DEVNET_BOOTSTRAP", "false"),
+		DevnetFaucetURL:   getEnv("DEVNET_FAUCET_URL", "http://127.0.0.1:8081"),
+		DevnetPackagePath: getEnv("DEVNET_PACKAGE_PATH", ""),
+		DevnetAptosCLI:    getEnv("DEVNET_APTOS_CLI", "aptos"),
+		DevnetDeployerKey: getEnv("DEVNET_DEPLOYER_PRIVATE_KEY", ""),
+		DevnetFundOctas:   getEnvAsInt("DEVNET_FUND_OCTAS", "10000000000"), // 100 APT
+
+		Environment:         getEnv("ENVIRONMENT", "development"),
+		ShutdownGracePeriod: getEnvAsInt("SHUTDOWN_GRACE_PERIOD", "30"),
+		CORSAllowedOrigins:  getEnvAsList("CORS_ALLOWED_ORIGINS"),
+		CORSMaxAge:          getEnvAsInt("CORS_MAX_AGE", "600"),
+		APIKeys:             parseAPIKeys(os.Getenv("API_KEYS")),
+		AdminAPIKeys:        parseAPIKeys(os.Getenv("ADMIN_API_KEYS")),
+		AuthChallengeTTL:    getEnvAsInt("AUTH_CHALLENGE_TTL", "300"),
+		AccessTokenSecret:   getEnv("ACCESS_TOKEN_SECRET", ""),
+		AccessTokenTTL:      getEnvAsInt("ACCESS_TOKEN_TTL", "300"),
+		TrustedProxies:      getEnvAsList("TRUSTED_PROXIES"),
+		IdempotencyTTL:      getEnvAsInt("IDEMPOTENCY_TTL", "86400"), // 1 day
+
+		MaxUploadBytes: int64(getEnvAsInt("MAX_UPLOAD_BYTES", "104857600")), // 100 MB
+		MaxCSVRows:     getEnvAsInt("MAX_CSV_ROWS", "1000000"),
+		MaxCSVColumns:  getEnvAsInt("MAX_CSV_COLUMNS", "500"),
+
+		RejectDataHashMismatch: getEnvAsBool("REJECT_DATA_HASH_MISMATCH", "true"),
+
+		SchemaSampleBytes: getEnvAsInt("SCHEMA_SAMPLE_BYTES", "65536"),
+		SchemaSampleRows:  getEnvAsInt("SCHEMA_SAMPLE_ROWS", "1000"),
+
+		StatsMaxDistinct: getEnvAsInt("STATS_MAX_DISTINCT", "1000"),
+
+		PIIScanEnabled: getEnvAsBool("PII_SCAN_ENABLED", "true"),
+		PIISampleRows:  getEnvAsInt("PII_SAMPLE_ROWS", "1000"),
+		PIIFlagPercent: getEnvAsInt("PII_FLAG_PERCENT", "10"),
+		PIIDetectors:   getEnvAsList("PII_DETECTORS"),
+		// Regexes may contain commas
+		PIIPatterns: getEnvAsSeparatedList("PII_PATTERNS", ";"),
+
+		PreviewMaxBytes: getEnvAsInt("PREVIEW_MAX_BYTES", "4194304"), // 4 MB
+		SampleMaxRows:   getEnvAsInt("SAMPLE_MAX_ROWS", "25"),
+
+		AggregateMinGroupSize: getEnvAsInt("AGGREGATE_MIN_GROUP_SIZE", "10"),
+		AggregateMaxGroups:    getEnvAsInt("AGGREGATE_MAX_GROUPS", "10000"),
+		AggregateTimeout:      getEnvAsInt("AGGREGATE_TIMEOUT", "30"),
+
+		StorageMultipartThreshold: int64(getEnvAsInt("STORAGE_MULTIPART_THRESHOLD", "16777216")), // 16 MB
+		StoragePartSize:           int64(getEnvAsInt("STORAGE_PART_SIZE", "8388608")),            // 8 MB
+		StorageMultipartMaxAge:    getEnvAsInt("STORAGE_MULTIPART_MAX_AGE", "86400"),             // 1 day
+
+		StorageRetryAttempts: getEnvAsInt("STORAGE_RETRY_ATTEMPTS", "4"),
+		StorageRetryBudget:   getEnvAsInt("STORAGE_RETRY_BUDGET", "30"),
+
+		StorageListMaxKeys: getEnvAsInt("STORAGE_LIST_MAX_KEYS", "10000"),
+
+		PresignDownloadTTL: getEnvAsInt("PRESIGN_DOWNLOAD_TTL", "600"), // 10 minutes
+		PresignMaxTTL:      getEnvAsInt("PRESIGN_MAX_TTL", "3600"),
+
+		EncryptionMasterKey:    getEnv("ENCRYPTION_MASTER_KEY", ""),
+		EncryptionAlgorithm:    getEnv("ENCRYPTION_ALGORITHM", "AES-256-GCM"),
+		EncryptionPreviousKeys: getEnvAsList("ENCRYPTION_PREVIOUS_KEYS"),
+
+		KeyProvider:       getEnv("KEY_PROVIDER", "static"),
+		KeyCacheTTL:       getEnvAsInt("KEY_CACHE_TTL", "300"),
+		KMSKeyID:          getEnv("KMS_KEY_ID", ""),
+		KMSRegion:         getEnv("KMS_REGION", getEnv("AWS_REGION", "us-east-1")),
+		KMSEndpoint:       getEnv("KMS_ENDPOINT", ""),
+		VaultAddr:         getEnv("VAULT_ADDR", ""),
+		VaultToken:        getEnv("VAULT_TOKEN", ""),
+		VaultTransitMount: getEnv("VAULT_TRANSIT_MOUNT", "transit"),
+		VaultTransitKey:   getEnv("VAULT_TRANSIT_KEY", ""),
+
+		IntegrityWarnOnly: getEnvAsBool("INTEGRITY_WARN_ONLY", "false"),
+
+		AccessExpirySkew: getEnvAsInt("ACCESS_EXPIRY_SKEW", "5"),
+
+		PaymentEscrowAddress: getEnv("PAYMENT_ESCROW_ADDRESS", ""),
+		PaymentTimeTolerance: getEnvAsInt("PAYMENT_TIME_TOLERANCE", "300"),
+
+		SponsorPrivateKey: getEnv("SPONSOR_PRIVATE_KEY", ""),
+
+		RewardsEnabled:     getEnvAsBool("REWARDS_ENABLED", "false"),
+		RewardMinterKey:    getEnv("REWARD_MINTER_PRIVATE_KEY", ""),
+		RewardAmount:       getEnvAsInt("REWARD_AMOUNT", "1000000"),
+		RewardDailyCap:     getEnvAsInt("REWARD_DAILY_CAP", "5000000"),
+		RewardAllowlist:    getEnvAsList("REWARD_ALLOWLIST"),
+		RewardDenylist:     getEnvAsList("REWARD_DENYLIST"),
+		RewardPollInterval: getEnvAsInt("REWARD_POLL_INTERVAL", "10"),
+
+		IndexerPageSize: getEnvAsInt("INDEXER_PAGE_SIZE", "1000"),
+		IndexerMaxPages: getEnvAsInt("INDEXER_MAX_PAGES", "50"),
+
+		TxScanBatchSize:    getEnvAsInt("TX_SCAN_BATCH_SIZE", "100"),
+		TxScanMaxLag:       getEnvAsInt("TX_SCAN_MAX_LAG", "2000"),
+		TxScanTimeBudget:   getEnvAsInt("TX_SCAN_TIME_BUDGET", "10"),
+		TxScanStartVersion: getEnvAsInt("TX_SCAN_START_VERSION", "0"),
+
+		WebhookMaxAttempts:  getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", "5"),
+		WebhookTimeout:      getEnvAsInt("WEBHOOK_TIMEOUT", "10"),
+		WebhookWorkers:      getEnvAsInt("WEBHOOK_WORKERS", "4"),
+		WebhookAllowPrivate: getEnvAsBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", "false"),
+
+		ReadSource:        strings.ToLower(getEnv("SOURCE", "remote")),
+		IndexDBPath:       getEnv("INDEX_DB_PATH", "./data/index.db"),
+		IndexPollInterval: getEnvAsInt("INDEX_POLL_INTERVAL", "5"),
+		IndexBatchSize:    getEnvAsInt("INDEX_BATCH_SIZE", "100"),
+		IndexMaxLag:       getEnvAsInt("INDEX_MAX_LAG", "2000"),
+		IndexStartVersion: getEnvAsInt("INDEX_START_VERSION", "0"),
+
+		DatabaseURL: getEnv("DATABASE_URL", ""),
+
+		profileDefined: profileDefined,
+	}
+	// Settings a devnet bootstrap wrote stay in place, so a reload doesn't report them as changed
+	if devnetOverrides != nil {
+		devnetOverrides.apply(c)
+	}
+	return c
 }
 
 func getEnv(key, defaultValue string) string {
@@ -85,3 +398,46 @@ func getEnvAsBool(key string, defaultValue string) bool {
 	}
 	return false
 }
+
+// getEnvAsList reads a comma-separated list, dropping empty entries
+func getEnvAsList(key string) []string {
+	return getEnvAsSeparatedList(key, ",")
+}
+
+// getEnvAsSeparatedList reads a list split on sep, dropping empty entries
+func getEnvAsSeparatedList(key string, sep string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), sep) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// IsProduction reports whether the backend runs in the production environment
+func (c *Config) IsProduction() bool {
+	return strings.EqualFold(c.Environment, "production")
+}
+
+// parseAPIKeys reads API_KEYS (or ADMIN_API_KEYS) as a comma-separated list of "label:key" entries
+// Entries without a label are named key1, key2, ... by position
+func parseAPIKeys(value string) []APIKey {
+	var keys []APIKey
+	for i, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		label, key, found := strings.Cut(entry, ":")
+		if !found {
+			label, key = "key"+strconv.Itoa(i+1), entry
+		}
+		label, key = strings.TrimSpace(label), strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		keys = append(keys, APIKey{Label: label, Key: key})
+	}
+	return keys
+}
@@ -0,0 +1,11 @@
+package config
+
+import "testing"
+
+func TestRewardsAreCappedByDefault(t *testing.T) {
+	t.Setenv("REWARD_DAILY_CAP", "")
+	cfg := readConfig()
+	if cfg.RewardDailyCap <= 0 || cfg.RewardDailyCap < cfg.RewardAmount {
+		t.Errorf("default REWARD_DAILY_CAP = %d, want a cap of at least one reward (%d)", cfg.RewardDailyCap, cfg.RewardAmount)
+	}
+}
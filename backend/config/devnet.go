@@ -0,0 +1,31 @@
+package config
+
+// DevnetOverrides are the settings a local devnet bootstrap produced at startup
+type DevnetOverrides struct {
+	ModuleAddr        string // Account the Move package was published to; empty when nothing was published
+	SponsorPrivateKey string // Funded deployer key, used for sponsoring when SPONSOR_PRIVATE_KEY is empty
+}
+
+// devnetOverrides is set once by ApplyDevnetBootstrap, under reloadMu
+var devnetOverrides *DevnetOverrides
+
+// ApplyDevnetBootstrap writes what the devnet bootstrap produced into AppConfig. Call it before
+// the services reading the module addresses are created; they aren't told of later changes
+func ApplyDevnetBootstrap(overrides DevnetOverrides) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	devnetOverrides = &overrides
+	overrides.apply(AppConfig)
+}
+
+func (o *DevnetOverrides) apply(c *Config) {
+	if o.ModuleAddr != "" {
+		c.DataXModuleAddr = o.ModuleAddr
+		c.NetworkModuleAddr = o.ModuleAddr
+		c.EscrowModuleAddr = o.ModuleAddr
+	}
+	if c.SponsorPrivateKey == "" {
+		c.SponsorPrivateKey = o.SponsorPrivateKey
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// profile is a named set of chain settings that only work together: a node, its indexer, the
+// chain ID it serves and the modules published there
+type profile struct {
+	AptosNodeURL      string
+	AptosIndexerURL   string
+	ChainID           string
+	DataXModuleAddr   string
+	NetworkModuleAddr string
+	EscrowModuleAddr  string // Empty falls back to NetworkModuleAddr
+}
+
+// profileKeys are the settings a profile resolves, as env var names
+var profileKeys = []string{"APTOS_NODE_URL", "APTOS_INDEXER_URL", "CHAIN_ID", "DATAX_MODULE_ADDR", "NETWORK_MODULE_ADDR", "ESCROW_MODULE_ADDR"}
+
+// defaultProfile is used when DATAX_PROFILE is not set
+const defaultProfile = "testnet"
+
+// builtinProfiles can be selected with DATAX_PROFILE without defining anything. Mainnet has
+// no DataX deployment yet, so its module addresses have to be given. Local is the node
+// `aptos node run-local-testnet` starts, whose modules DEVNET_BOOTSTRAP can publish
+var builtinProfiles = map[string]profile{
+	"testnet": {
+		AptosNodeURL:      "https://fullnode.testnet.aptoslabs.com",
+		AptosIndexerURL:   "https://api.testnet.aptoslabs.com/v1/graphql",
+		ChainID:           "2",
+		DataXModuleAddr:   "0x0b133cba97a77b2dee290919e27c72c7d49d8bf5a3294efbd8c40cc38a009eab",
+		NetworkModuleAddr: "0x0b133cba97a77b2dee290919e27c72c7d49d8bf5a3294efbd8c40cc38a009eab",
+	},
+	"mainnet": {
+		AptosNodeURL:    "https://fullnode.mainnet.aptoslabs.com",
+		AptosIndexerURL: "https://api.mainnet.aptoslabs.com/v1/graphql",
+		ChainID:         "1",
+	},
+	"local": {
+		AptosNodeURL:    "http://127.0.0.1:8080",
+		AptosIndexerURL: "http://127.0.0.1:8090/v1/graphql",
+		ChainID:         "4",
+	},
+}
+
+// resolveProfile returns the settings of the named profile. A built-in profile is the base;
+// {NAME}_{KEY} variables (TESTNET_DATAX_MODULE_ADDR, STAGING_APTOS_NODE_URL, ...) replace its
+// fields or define a profile of their own, and plain variables (DATAX_MODULE_ADDR, ...)
+// override single fields on top. defined is false for a name that is neither built in nor has
+// any {NAME}_ variable
+func resolveProfile(name string) (settings map[string]string, defined bool) {
+	base, defined := builtinProfiles[name]
+	settings = map[string]string{
+		"APTOS_NODE_URL":      base.AptosNodeURL,
+		"APTOS_INDEXER_URL":   base.AptosIndexerURL,
+		"CHAIN_ID":            base.ChainID,
+		"DATAX_MODULE_ADDR":   base.DataXModuleAddr,
+		"NETWORK_MODULE_ADDR": base.NetworkModuleAddr,
+		"ESCROW_MODULE_ADDR":  base.EscrowModuleAddr,
+	}
+
+	prefix := strings.ToUpper(name) + "_"
+	for _, key := range profileKeys {
+		if value := os.Getenv(prefix + key); value != "" {
+			settings[key] = value
+			defined = true
+		}
+	}
+	for _, key := range profileKeys {
+		if value := os.Getenv(key); value != "" {
+			settings[key] = value
+		}
+	}
+
+	if settings["ESCROW_MODULE_ADDR"] == "" {
+		settings["ESCROW_MODULE_ADDR"] = settings["NETWORK_MODULE_ADDR"]
+	}
+	return settings, defined
+}
+
+// builtinProfileNames lists the built-in profiles for error messages
+func builtinProfileNames() []string {
+	names := make([]string, 0, len(builtinProfiles))
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/joho/godotenv"
+)
+
+// LogLevels are the accepted LOG_LEVEL values, from most to least verbose
+var LogLevels = []string{"debug", "info", "warning", "error"}
+
+// Tunables are the settings that can change while the server runs. SIGHUP and
+// POST /api/v1/admin/config/reload re-read them and swap the whole set at once, so read them
+// per use through Tunable() rather than keeping a copy
+type Tunables struct {
+	LogLevel string // Least severe DEBUG:/WARNING:/ERROR: output printed: debug, info, warning or error
+
+	// Rate limiting (per client IP)
+	RateLimitPerMinute          int // Default tier sustained rate
+	RateLimitBurst              int // Default tier burst
+	RateLimitExpensivePerMinute int // Expensive tier (marketplace, CSV upload/download) sustained rate
+	RateLimitExpensiveBurst     int // Expensive tier burst
+
+	// Marketplace
+	MarketplaceCacheTTL    int // Seconds to reuse an assembled marketplace snapshot
+	MarketplaceConcurrency int // Owners whose DataStore is read from chain at once
+	MarketplaceTimeout     int // Seconds a listing may spend reading the chain before it returns what it has
+
+	// Caches
+	AnalyticsCacheTTL  int // Seconds to reuse an owner's per-dataset read counters
+	AccessibleCacheTTL int // Seconds to reuse a requester's verified list of accessible datasets
+}
+
+var tunables atomic.Pointer[Tunables]
+
+// Tunable returns the current runtime-tunable settings
+func Tunable() *Tunables {
+	return tunables.Load()
+}
+
+func loadTunables() *Tunables {
+	return &Tunables{
+		LogLevel: strings.ToLower(getEnv("LOG_LEVEL", "debug")),
+
+		RateLimitPerMinute:          getEnvAsInt("RATE_LIMIT_PER_MINUTE", "120"),
+		RateLimitBurst:              getEnvAsInt("RATE_LIMIT_BURST", "30"),
+		RateLimitExpensivePerMinute: getEnvAsInt("RATE_LIMIT_EXPENSIVE_PER_MINUTE", "20"),
+		RateLimitExpensiveBurst:     getEnvAsInt("RATE_LIMIT_EXPENSIVE_BURST", "5"),
+
+		MarketplaceCacheTTL:    getEnvAsInt("MARKETPLACE_CACHE_TTL", "60"),
+		MarketplaceConcurrency: getEnvAsInt("MARKETPLACE_CONCURRENCY", "3"),
+		MarketplaceTimeout:     getEnvAsInt("MARKETPLACE_TIMEOUT", "20"),
+
+		AnalyticsCacheTTL:  getEnvAsInt("ANALYTICS_CACHE_TTL", "300"),
+		AccessibleCacheTTL: getEnvAsInt("ACCESSIBLE_CACHE_TTL", "30"),
+	}
+}
+
+// problems lists the tunables a reload must not swap in
+func (t *Tunables) problems() []string {
+	var problems []string
+	valid := false
+	for _, level := range LogLevels {
+		valid = valid || t.LogLevel == level
+	}
+	if !valid {
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL must be one of %s, got %q", strings.Join(LogLevels, ", "), t.LogLevel))
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"RATE_LIMIT_PER_MINUTE", t.RateLimitPerMinute},
+		{"RATE_LIMIT_BURST", t.RateLimitBurst},
+		{"RATE_LIMIT_EXPENSIVE_PER_MINUTE", t.RateLimitExpensivePerMinute},
+		{"RATE_LIMIT_EXPENSIVE_BURST", t.RateLimitExpensiveBurst},
+		{"MARKETPLACE_CACHE_TTL", t.MarketplaceCacheTTL},
+		{"ANALYTICS_CACHE_TTL", t.AnalyticsCacheTTL},
+		{"ACCESSIBLE_CACHE_TTL", t.AccessibleCacheTTL},
+	} {
+		if setting.value < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative", setting.name))
+		}
+	}
+	if t.MarketplaceConcurrency < 1 || t.MarketplaceTimeout < 1 {
+		problems = append(problems, "MARKETPLACE_CONCURRENCY and MARKETPLACE_TIMEOUT must be at least 1")
+	}
+	return problems
+}
+
+var (
+	reloadMu   sync.Mutex
+	processEnv map[string]bool // Variables set before .env was read, which .env never overrides
+	dotenvKeys []string        // Variables the last read of .env set
+)
+
+// loadDotenv reads .env into the environment without overriding variables the process was
+// started with. On a reload, variables an earlier read set but .env no longer has are unset
+func loadDotenv() error {
+	if processEnv == nil {
+		processEnv = make(map[string]bool)
+		for _, entry := range os.Environ() {
+			key, _, _ := strings.Cut(entry, "=")
+			processEnv[key] = true
+		}
+	}
+
+	values, err := godotenv.Read()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read .env: %w", err)
+	}
+	for _, key := range dotenvKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+		}
+	}
+	dotenvKeys = dotenvKeys[:0]
+	for key, value := range values {
+		if processEnv[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		dotenvKeys = append(dotenvKeys, key)
+	}
+	return nil
+}
+
+// Reload re-reads the environment and .env and swaps in the new tunables. Nothing is swapped
+// when a tunable is invalid. Other settings are only read at startup, so changes to them are
+// ignored with a warning. changed and ignored name the Config and Tunables fields that differ
+func Reload() (changed []string, ignored []string, err error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if err := loadDotenv(); err != nil {
+		return nil, nil, err
+	}
+
+	next := loadTunables()
+	if problems := next.problems(); len(problems) > 0 {
+		return nil, nil, errors.New("invalid configuration, nothing reloaded:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	changed = changedFields(*Tunable(), *next)
+	ignored = changedFields(*AppConfig, *readConfig())
+	tunables.Store(next)
+
+	if len(changed) > 0 {
+		log.Printf("Reloaded configuration: %s", strings.Join(changed, ", "))
+	} else {
+		log.Printf("Reloaded configuration: no runtime-tunable setting changed")
+	}
+	if len(ignored) > 0 {
+		log.Printf("WARNING: Ignoring changes to settings that need a restart: %s", strings.Join(ignored, ", "))
+	}
+	return changed, ignored, nil
+}
+
+// changedFields names the exported fields whose values differ between two structs of one type
+func changedFields(current, next interface{}) []string {
+	currentValue, nextValue := reflect.ValueOf(current), reflect.ValueOf(next)
+	fields := []string{}
+	for i := 0; i < currentValue.NumField(); i++ {
+		field := currentValue.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
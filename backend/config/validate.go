@@ -0,0 +1,262 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Validate checks the settings that would otherwise only fail deep inside a request: the
+// profile, endpoint URLs, module addresses, the chain ID, the indexer key, the tunables, the storage backend, the PII scan and the devnet bootstrap. Every problem
+// is reported at once, one per line, so a broken .env can be fixed in one go
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !c.profileDefined {
+		add("DATAX_PROFILE=%s is not a built-in profile (%s) and no %s_* variables define it", c.Profile, strings.Join(builtinProfileNames(), ", "), strings.ToUpper(c.Profile))
+	}
+
+	if err := checkURL(c.AptosNodeURL); err != nil {
+		add("APTOS_NODE_URL %v", err)
+	}
+	if c.AptosIndexerURL != "" {
+		if err := checkURL(c.AptosIndexerURL); err != nil {
+			add("APTOS_INDEXER_URL %v", err)
+		}
+	}
+	if c.UseIndexer && c.AptosIndexerAPIKey == "" {
+		add("USE_INDEXER=true requires APTOS_INDEXER_API_KEY")
+	}
+
+	// A devnet bootstrap publishing the package fills in the module addresses it leaves empty
+	publishing := c.DevnetBootstrap && c.DevnetPackagePath != ""
+	for _, module := range []struct{ name, value string }{
+		{"DATAX_MODULE_ADDR", c.DataXModuleAddr},
+		{"NETWORK_MODULE_ADDR", c.NetworkModuleAddr},
+		{"ESCROW_MODULE_ADDR", c.EscrowModuleAddr},
+	} {
+		if publishing && module.value == "" {
+			continue
+		}
+		if err := checkAddress(module.value); err != nil {
+			add("%s %v", module.name, err)
+		}
+	}
+
+	// LoadConfig zeroes a CHAIN_ID that isn't a number or doesn't fit in a byte
+	if c.ChainID == 0 {
+		add("CHAIN_ID must be between 1 and 255")
+	}
+
+	if c.SampleMaxRows < 1 {
+		add("SAMPLE_MAX_ROWS must be at least 1")
+	}
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"AGGREGATE_MIN_GROUP_SIZE", c.AggregateMinGroupSize},
+		{"AGGREGATE_MAX_GROUPS", c.AggregateMaxGroups},
+		{"AGGREGATE_TIMEOUT", c.AggregateTimeout},
+	} {
+		if limit.value < 1 {
+			add("%s must be at least 1", limit.name)
+		}
+	}
+
+	if t := Tunable(); t != nil {
+		problems = append(problems, t.problems()...)
+	}
+
+	for _, problem := range c.storageProblems() {
+		add("%s", problem)
+	}
+	for _, problem := range c.rewardProblems() {
+		add("%s", problem)
+	}
+	for _, problem := range c.piiProblems() {
+		add("%s", problem)
+	}
+	for _, problem := range c.devnetProblems() {
+		add("%s", problem)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+}
+
+// rewardProblems checks the contribution reward settings when rewards are on
+func (c *Config) rewardProblems() []string {
+	if !c.RewardsEnabled {
+		return nil
+	}
+	var problems []string
+	if c.ReadSource != "local" {
+		problems = append(problems, "REWARDS_ENABLED=true requires SOURCE=local, rewards are paid from the local event index")
+	}
+	if c.RewardMinterKey == "" {
+		problems = append(problems, "REWARDS_ENABLED=true requires REWARD_MINTER_PRIVATE_KEY")
+	}
+	if c.RewardAmount < 1 {
+		problems = append(problems, "REWARD_AMOUNT must be at least 1")
+	}
+	if c.RewardDailyCap < 0 {
+		problems = append(problems, "REWARD_DAILY_CAP must not be negative")
+	}
+	if c.RewardPollInterval < 1 {
+		problems = append(problems, "REWARD_POLL_INTERVAL must be at least 1")
+	}
+	for _, list := range []struct {
+		name      string
+		addresses []string
+	}{
+		{"REWARD_ALLOWLIST", c.RewardAllowlist},
+		{"REWARD_DENYLIST", c.RewardDenylist},
+	} {
+		for _, address := range list.addresses {
+			if err := checkAddress(address); err != nil {
+				problems = append(problems, fmt.Sprintf("%s entry %q %v", list.name, address, err))
+			}
+		}
+	}
+	return problems
+}
+
+// builtinPIIDetectors mirrors the detectors the schema package has built in
+var builtinPIIDetectors = []string{"credit_card", "email", "phone", "ssn"}
+
+// piiProblems checks the PII scan settings when scanning is on
+func (c *Config) piiProblems() []string {
+	if !c.PIIScanEnabled {
+		return nil
+	}
+	var problems []string
+	if c.PIISampleRows < 1 {
+		problems = append(problems, "PII_SAMPLE_ROWS must be at least 1")
+	}
+	if c.PIIFlagPercent < 1 || c.PIIFlagPercent > 100 {
+		problems = append(problems, "PII_FLAG_PERCENT must be between 1 and 100")
+	}
+	for _, name := range c.PIIDetectors {
+		if !slices.Contains(builtinPIIDetectors, name) {
+			problems = append(problems, fmt.Sprintf("PII_DETECTORS entry %q is not a built-in detector (%s)", name, strings.Join(builtinPIIDetectors, ", ")))
+		}
+	}
+	for _, pattern := range c.PIIPatterns {
+		name, expr, ok := strings.Cut(pattern, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			problems = append(problems, fmt.Sprintf("PII_PATTERNS entry %q must be name=regex", pattern))
+			continue
+		}
+		if _, err := regexp.Compile(expr); err != nil {
+			problems = append(problems, fmt.Sprintf("PII_PATTERNS entry %s: %v", strings.TrimSpace(name), err))
+		}
+	}
+	return problems
+}
+
+// devnetProblems checks the local devnet bootstrap settings when it is on
+func (c *Config) devnetProblems() []string {
+	if !c.DevnetBootstrap {
+		return nil
+	}
+	var problems []string
+	if err := checkURL(c.DevnetFaucetURL); err != nil {
+		problems = append(problems, fmt.Sprintf("DEVNET_FAUCET_URL %v", err))
+	}
+	if c.DevnetFundOctas < 1 {
+		problems = append(problems, "DEVNET_FUND_OCTAS must be at least 1")
+	}
+	if c.DevnetPackagePath != "" && c.DevnetAptosCLI == "" {
+		problems = append(problems, "DEVNET_PACKAGE_PATH requires DEVNET_APTOS_CLI to compile it")
+	}
+	return problems
+}
+
+// storageProblems checks that STORAGE_BACKEND names a backend and that its settings are complete
+func (c *Config) storageProblems() []string {
+	switch strings.ToLower(strings.TrimSpace(c.StorageBackend)) {
+	case "supabase":
+		var problems []string
+		if c.SupabaseS3URL == "" {
+			problems = append(problems, "STORAGE_BACKEND=supabase requires SUPABASE_S3_URL")
+		} else if err := checkURL(c.SupabaseS3URL); err != nil {
+			problems = append(problems, fmt.Sprintf("SUPABASE_S3_URL %v", err))
+		}
+		if (c.SupabaseAccessKey == "") != (c.SupabaseSecretKey == "") {
+			problems = append(problems, "STORAGE_BACKEND=supabase requires both SUPABASE_ACCESS_KEY and SUPABASE_SECRET_KEY (only one is set)")
+		} else if c.SupabaseAccessKey == "" && c.SupabaseKey == "" {
+			problems = append(problems, "STORAGE_BACKEND=supabase requires SUPABASE_ACCESS_KEY + SUPABASE_SECRET_KEY or SUPABASE_KEY")
+		}
+		if c.SupabaseBucket == "" {
+			problems = append(problems, "STORAGE_BACKEND=supabase requires SUPABASE_BUCKET")
+		}
+		return problems
+
+	case "shelby":
+		if c.ShelbyAccountKey == "" {
+			return []string{"STORAGE_BACKEND=shelby requires SHELBY_ACCOUNT_KEY"}
+		}
+		return nil
+
+	case "local":
+		if c.LocalStorageDir == "" {
+			return []string{"STORAGE_BACKEND=local requires LOCAL_STORAGE_DIR"}
+		}
+		return nil
+
+	case "ipfs":
+		var problems []string
+		if c.IPFSAPIURL == "" {
+			problems = append(problems, "STORAGE_BACKEND=ipfs requires IPFS_API_URL")
+		} else if err := checkURL(c.IPFSAPIURL); err != nil {
+			problems = append(problems, fmt.Sprintf("IPFS_API_URL %v", err))
+		}
+		if c.IPFSUploadTimeout <= 0 || c.IPFSRequestTimeout <= 0 {
+			problems = append(problems, "STORAGE_BACKEND=ipfs requires positive IPFS_UPLOAD_TIMEOUT and IPFS_REQUEST_TIMEOUT")
+		}
+		return problems
+	}
+	return []string{fmt.Sprintf("unknown STORAGE_BACKEND %q (expected supabase, shelby, local or ipfs)", c.StorageBackend)}
+}
+
+// checkURL accepts absolute http(s) URLs
+func checkURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("is not a URL: %v", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("must be an http(s) URL, got %q", value)
+	}
+	return nil
+}
+
+// checkAddress accepts what services.parseAddress does: up to 64 hex digits, 0x optional,
+// leading zeros may be trimmed. The services package imports config, so the rule is repeated
+// here rather than shared
+func checkAddress(value string) error {
+	digits := strings.TrimSpace(value)
+	if prefix := digits[:min(len(digits), 2)]; prefix == "0x" || prefix == "0X" {
+		digits = digits[2:]
+	}
+	if digits == "" {
+		return fmt.Errorf("is empty")
+	}
+	if len(digits) > 64 {
+		return fmt.Errorf("must be at most 64 hex digits, got %d", len(digits))
+	}
+	if _, err := hex.DecodeString(strings.Repeat("0", 64-len(digits)) + digits); err != nil {
+		return fmt.Errorf("is not hex: %q", value)
+	}
+	return nil
+}
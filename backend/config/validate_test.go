@@ -0,0 +1,19 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckAddressFollowsParseAddress(t *testing.T) {
+	for _, value := range []string{"0x1", "0X1", "1", "0xA550C18", " 0xcafe ", "0x" + strings.Repeat("ab", 32)} {
+		if err := checkAddress(value); err != nil {
+			t.Errorf("checkAddress(%q) = %v, want ok", value, err)
+		}
+	}
+	for _, value := range []string{"", "0x", "0x" + strings.Repeat("1", 65), "0xg1", "0x 1"} {
+		if err := checkAddress(value); err == nil {
+			t.Errorf("checkAddress(%q) = nil, want an error", value)
+		}
+	}
+}
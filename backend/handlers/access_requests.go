@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAccessPriceAPT is what an access request is priced at, as in the frontend escrow flow
+const defaultAccessPriceAPT = 0.1
+
+// GetSentAccessRequests returns the requests a requester made, newest first
+func (h *Handler) GetSentAccessRequests(c *gin.Context) {
+	var req models.SentAccessRequestsRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	requester, err := services.NormalizeAddress(req.Requester)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("invalid requester address: %v", err),
+		})
+		return
+	}
+
+	requests, err := h.accessRequests.ListByRequester(requester)
+	if err != nil {
+		respondAccessRequestError(c, err)
+		return
+	}
+	if req.Status != "" {
+		filtered := make([]models.AccessRequest, 0, len(requests))
+		for _, r := range requests {
+			if r.Status == req.Status {
+				filtered = append(filtered, r)
+			}
+		}
+		requests = filtered
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    requests,
+	})
+}
+
+// ApproveAccessRequest lets the owner accept a pending request, after which the requester pays
+func (h *Handler) ApproveAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, services.AccessRequestApproved, "Access request approved")
+}
+
+// DenyAccessRequest lets the owner turn down a pending request
+func (h *Handler) DenyAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, services.AccessRequestDenied, "Access request denied")
+}
+
+func (h *Handler) decideAccessRequest(c *gin.Context, status string, message string) {
+	var req models.ApproveAccessRequestInput
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	owner, requester, ok := bindAccessRequestParties(c, req.OwnerAddress, req.RequesterAddress)
+	if !ok {
+		return
+	}
+	if !h.verifyWalletSignature(c, owner, req.WalletSignature) {
+		return
+	}
+
+	request, err := h.accessRequests.Transition(owner, requester, *req.DatasetID, services.AccessRequestPending, status, nil)
+	if err != nil {
+		respondAccessRequestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: message,
+		Data:    request,
+	})
+}
+
+// ConfirmAccessPayment lets the requester record the payment transaction for an approved
+// request. The transaction is read from chain and must be a successful APT transfer from
+// the requester to the owner (or the escrow account) of at least the dataset's price, made
+// no earlier than PAYMENT_TIME_TOLERANCE seconds before the request. Each transaction pays
+// for one request only. The owner then grants access on chain
+func (h *Handler) ConfirmAccessPayment(c *gin.Context) {
+	var req models.ConfirmPaymentInput
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	owner, requester, ok := bindAccessRequestParties(c, req.OwnerAddress, req.RequesterAddress)
+	if !ok {
+		return
+	}
+	if !h.verifyWalletSignature(c, requester, req.WalletSignature) {
+		return
+	}
+
+	request, err := h.accessRequests.Get(owner, requester, *req.DatasetID)
+	if err != nil {
+		respondAccessRequestError(c, err)
+		return
+	}
+	if request.Status != services.AccessRequestApproved {
+		respondAccessRequestError(c, services.ErrAccessRequestStatus)
+		return
+	}
+
+	payment, err := h.aptosService.VerifyPayment(req.TxHash, h.expectedPayment(request))
+	if err != nil {
+		respondPaymentError(c, req.TxHash, err)
+		return
+	}
+
+	request, err = h.accessRequests.Transition(owner, requester, *req.DatasetID, services.AccessRequestApproved, services.AccessRequestPaid, payment)
+	if err != nil {
+		respondAccessRequestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "Payment confirmed",
+		Data:    request,
+	})
+}
+
+// expectedPayment is what the payment for an approved request must show: the dataset's
+// price_apt, or the price the request was made at when the metadata has none
+func (h *Handler) expectedPayment(request models.AccessRequest) models.ExpectedPayment {
+	price := request.PriceAPT
+	if meta, _ := h.datasetMetadata(request.OwnerAddress, request.DatasetID); meta.PriceAPT != nil {
+		price = *meta.PriceAPT
+	}
+	recipients := []string{request.OwnerAddress}
+	if escrow, err := services.NormalizeAddress(config.AppConfig.PaymentEscrowAddress); err == nil {
+		recipients = append(recipients, escrow)
+	}
+	var notBefore uint64
+	if createdAt, err := time.Parse(time.RFC3339, request.CreatedAt); err == nil {
+		notBefore = uint64(max(createdAt.Unix()-int64(config.AppConfig.PaymentTimeTolerance), 0))
+	}
+	return models.ExpectedPayment{
+		Sender:     request.RequesterAddress,
+		Recipients: recipients,
+		MinOctas:   uint64(math.Round(price * 1e8)),
+		NotBefore:  notBefore,
+	}
+}
+
+// respondPaymentError reports a payment transaction that couldn't be verified
+func respondPaymentError(c *gin.Context, txHash string, err error) {
+	switch {
+	case errors.Is(err, services.ErrTransactionNotFound):
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ErrCodeTransactionNotFound,
+		})
+	case errors.Is(err, services.ErrTransactionPending):
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ErrCodeTransactionPending,
+		})
+	case errors.Is(err, services.ErrPaymentInvalid):
+		c.JSON(http.StatusUnprocessableEntity, models.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ErrCodePaymentInvalid,
+		})
+	default:
+		fmt.Printf("ERROR: Failed to verify payment %s: %v\n", txHash, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+}
+
+// bindAccessRequestParties normalizes the owner and requester addresses of a request
+func bindAccessRequestParties(c *gin.Context, owner string, requester string) (string, string, bool) {
+	owner, errOwner := services.NormalizeAddress(owner)
+	requester, errRequester := services.NormalizeAddress(requester)
+	if errOwner != nil || errRequester != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "owner_address and requester_address must be valid account addresses",
+		})
+		return "", "", false
+	}
+	return owner, requester, true
+}
+
+// mergeAccessRequests combines the requests stored through the API with those read from
+// chain events. A stored request keeps its escrow status, except that a pending one the
+// owner has already granted on chain is reported as approved
+func mergeAccessRequests(stored []models.AccessRequest, onChain []models.AccessRequest) []models.AccessRequest {
+	type requestKey struct {
+		requester string
+		datasetID uint64
+	}
+	// Event data may carry the short address form
+	for i, r := range onChain {
+		if requester, err := services.NormalizeAddress(r.RequesterAddress); err == nil {
+			onChain[i].RequesterAddress = requester
+		}
+	}
+	granted := make(map[requestKey]bool, len(onChain))
+	for _, r := range onChain {
+		if r.Status == services.AccessRequestApproved {
+			granted[requestKey{r.RequesterAddress, r.DatasetID}] = true
+		}
+	}
+
+	merged := make([]models.AccessRequest, 0, len(stored)+len(onChain))
+	seen := make(map[requestKey]bool, len(stored))
+	for _, r := range stored {
+		key := requestKey{r.RequesterAddress, r.DatasetID}
+		if r.Status == services.AccessRequestPending && granted[key] {
+			r.Status = services.AccessRequestApproved
+		}
+		seen[key] = true
+		merged = append(merged, r)
+	}
+	for _, r := range onChain {
+		key := requestKey{r.RequesterAddress, r.DatasetID}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func respondAccessRequestError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	code := ""
+	switch {
+	case errors.Is(err, services.ErrAccessRequestNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrAccessRequestStatus):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrPaymentAlreadyUsed):
+		status = http.StatusConflict
+		code = models.ErrCodePaymentAlreadyUsed
+	default:
+		fmt.Printf("ERROR: Access request operation failed: %v\n", err)
+	}
+	c.JSON(status, models.Response{
+		Success: false,
+		Error:   err.Error(),
+		Code:    code,
+	})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	dataschema "github.com/datax/backend/schema"
+	"github.com/gin-gonic/gin"
+)
+
+// aggregateColumns returns the columns a query reads, as named in the request
+func aggregateColumns(req models.AggregateRequest) []string {
+	var columns []string
+	for _, name := range []string{req.GroupBy, req.Column} {
+		if strings.TrimSpace(name) != "" {
+			columns = append(columns, name)
+		}
+	}
+	if req.Filter != nil {
+		columns = append(columns, req.Filter.Column)
+	}
+	return columns
+}
+
+// filterColumns returns the columns that are (inside true) or aren't named in names,
+// compared case-insensitively
+func filterColumns(columns []string, names []string, inside bool) []string {
+	var matched []string
+	for _, name := range columns {
+		named := slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(strings.TrimSpace(n), strings.TrimSpace(name)) })
+		if named == inside {
+			matched = append(matched, name)
+		}
+	}
+	return matched
+}
+
+// AggregateDataset handles POST /api/v1/data/aggregate, answering a count, sum, avg, min or
+// max, optionally grouped by a column and filtered on one, with the aggregate table alone.
+// Requesters with access prove it as for GetCSVData; without a proof the owner must have set
+// aggregates_enabled, and columns a PII scan flags can't be queried. Groups under
+// AGGREGATE_MIN_GROUP_SIZE rows are left out, and queries building more than
+// AGGREGATE_MAX_GROUPS groups or running past AGGREGATE_TIMEOUT are refused. Rows are read
+// through openDatasetRows, streamed from storage where the blob allows
+func (h *Handler) AggregateDataset(c *gin.Context) {
+	var req models.AggregateRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	datasetMap, meta, ok := h.activeDataset(c, req.Owner, *req.DatasetID)
+	if !ok {
+		return
+	}
+	columns := aggregateColumns(req)
+
+	withAccess := req.DataAccessProof != nil
+	if withAccess {
+		if req.Requester == "" {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   "requester is required with an access proof",
+			})
+			return
+		}
+		if !h.authorizeDataAccess(c, req.Owner, *req.DatasetID, req.Requester, *req.DataAccessProof) {
+			return
+		}
+		allowed, ok := h.allowedColumns(c, req.Owner, *req.DatasetID, req.Requester)
+		if !ok {
+			return
+		}
+		if outside := filterColumns(columns, allowed, false); allowed != nil && len(outside) > 0 {
+			c.JSON(http.StatusForbidden, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("Your grant doesn't cover %s", strings.Join(outside, ", ")),
+				Code:    models.ErrCodeColumnsRestricted,
+			})
+			return
+		}
+	} else if !meta.AggregatesEnabled {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Aggregating this dataset needs access to it; its owner hasn't allowed aggregates without",
+			Code:    models.ErrCodeAggregatesDisabled,
+		})
+		return
+	}
+
+	// The deadline covers reading the dataset too: checking a blob's hash, the PII scan and
+	// the aggregation each read it through
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(config.AppConfig.AggregateTimeout)*time.Second)
+	defer cancel()
+
+	// Always the on-chain hash: a caller-supplied blob name could point the query at any blob
+	dataHash, _ := datasetMap["data_hash"].(string)
+	rows, ok := h.openDatasetRows(c, ctx, req.Owner, *req.DatasetID, dataHash)
+	if !ok {
+		if ctx.Err() != nil {
+			respondAggregateTimeout(c)
+		}
+		return
+	}
+	defer rows.Close()
+
+	if !withAccess {
+		flagged, ok := h.flaggedPIIColumns(c, req.Owner, rows)
+		if !ok {
+			if ctx.Err() != nil {
+				respondAggregateTimeout(c)
+			}
+			return
+		}
+		if personal := filterColumns(columns, flagged, true); len(personal) > 0 {
+			c.JSON(http.StatusForbidden, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("Columns flagged as likely personal data can only be aggregated with access: %s", strings.Join(personal, ", ")),
+				Code:    models.ErrCodePIIColumn,
+			})
+			return
+		}
+	}
+
+	query := dataschema.AggregateQuery{GroupBy: req.GroupBy, Column: req.Column, Function: req.Function}
+	if req.Filter != nil {
+		query.FilterColumn, query.FilterValue = req.Filter.Column, strings.TrimSpace(req.Filter.Value)
+	}
+	aggregator, missing := dataschema.NewAggregator(query, rows.Header, config.AppConfig.AggregateMaxGroups)
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Unknown columns: %s", strings.Join(missing, ", ")),
+			Data:    map[string]interface{}{"unknown_columns": missing},
+		})
+		return
+	}
+
+	var err error
+	for err == nil {
+		var record []string
+		if record, err = rows.Read(); err == nil {
+			err = aggregator.Observe(record)
+		}
+	}
+	switch {
+	case errors.Is(err, dataschema.ErrTooManyGroups):
+		c.JSON(http.StatusUnprocessableEntity, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("%s has more than %d distinct values; group by a coarser column or add a filter", req.GroupBy, config.AppConfig.AggregateMaxGroups),
+			Code:    models.ErrCodeAggregateLimit,
+		})
+		return
+	case ctx.Err() != nil:
+		respondAggregateTimeout(c)
+		return
+	case err != io.EOF:
+		fmt.Printf("ERROR: Failed to aggregate %s: %v\n", rows.BlobName, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to read the dataset: %v", err),
+		})
+		return
+	}
+
+	result := aggregator.Result(config.AppConfig.AggregateMinGroupSize)
+	message := ""
+	if result.SuppressedGroups > 0 {
+		message = fmt.Sprintf("%d groups with fewer than %d rows were left out", result.SuppressedGroups, result.MinGroupSize)
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+	if withAccess {
+		// Aggregates return no rows
+		h.recordAudit(c, req.Owner, *req.DatasetID, req.Requester, 0)
+	}
+}
+
+// respondAggregateTimeout writes the 422 for a query that ran past AGGREGATE_TIMEOUT
+func respondAggregateTimeout(c *gin.Context) {
+	c.JSON(http.StatusUnprocessableEntity, models.Response{
+		Success: false,
+		Error:   fmt.Sprintf("The aggregate ran past %d seconds; add a filter to read fewer rows", config.AppConfig.AggregateTimeout),
+		Code:    models.ErrCodeAggregateLimit,
+	})
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// aggregateRequest averages score grouped by active over the owner's dataset 0, proving
+// access as the owner when withAccess
+func (h *testHandler) aggregateRequest(t *testing.T, withAccess bool) *http.Request {
+	t.Helper()
+	owner := addressOf(t, testOwnerKey)
+	datasetID := uint64(0)
+	req := models.AggregateRequest{Owner: owner, DatasetID: &datasetID, GroupBy: "active", Column: "score", Function: "avg"}
+	if withAccess {
+		proof := h.signProof(t, owner, testOwnerKey)
+		req.Requester, req.DataAccessProof = owner, &proof
+	}
+	return jsonRequest(t, http.MethodPost, "/data/aggregate", req)
+}
+
+// aggregateResult decodes the aggregate table out of a response body
+func aggregateResult(t *testing.T, body []byte) (models.Response, models.AggregateResult) {
+	t.Helper()
+	var response models.Response
+	var result models.AggregateResult
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("response %s is not JSON: %v", body, err)
+	}
+	data, _ := json.Marshal(response.Data)
+	json.Unmarshal(data, &result)
+	return response, result
+}
+
+// heapSamplingStorage is local storage whose blob streams sample the live heap each time
+// another sampleEvery bytes are read, on the goroutine reading them
+type heapSamplingStorage struct {
+	*services.LocalStorageService
+	sampleEvery int
+	peakHeap    uint64
+}
+
+func (s *heapSamplingStorage) OpenBlob(accountAddress string, blobName string) (io.ReadCloser, error) {
+	body, err := s.LocalStorageService.OpenBlob(accountAddress, blobName)
+	if err != nil {
+		return nil, err
+	}
+	return &heapSamplingReader{ReadCloser: body, storage: s}, nil
+}
+
+// heapSamplingReader is a blob stream of heapSamplingStorage
+type heapSamplingReader struct {
+	io.ReadCloser
+	storage   *heapSamplingStorage
+	unsampled int
+}
+
+func (r *heapSamplingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if r.unsampled += n; r.unsampled >= r.storage.sampleEvery {
+		r.unsampled = 0
+		r.storage.peakHeap = max(r.storage.peakHeap, liveHeap())
+	}
+	return n, err
+}
+
+func TestAggregateStreamsLargeDatasetsInFlatMemory(t *testing.T) {
+	const size = 8 << 20
+	cases := []struct {
+		name       string
+		withAccess bool
+		encrypted  bool
+	}{
+		{"with access", true, false},
+		{"with access, encrypted", true, true},
+		// Without access the rows are also scanned for PII first
+		{"aggregates enabled", false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.encrypted {
+				masterKey := config.AppConfig.EncryptionMasterKey
+				config.AppConfig.EncryptionMasterKey = strings.Repeat("ab", 32)
+				t.Cleanup(func() { config.AppConfig.EncryptionMasterKey = masterKey })
+			}
+			h := newTestHandler(t)
+			var rows int
+			if tc.withAccess {
+				_, rows = h.storeLargeDataset(t, size, tc.encrypted)
+			} else {
+				csvText, count := largeTestCSV(size)
+				sum := sha256.Sum256([]byte(csvText))
+				dataHash := "0x" + hex.EncodeToString(sum[:])
+				if _, err := h.storage.StoreCSVStream(addressOf(t, testOwnerKey), dataHash, strings.NewReader(csvText)); err != nil {
+					t.Fatalf("StoreCSVStream: %v", err)
+				}
+				h.submitTestDatasetMetadata(t, testOwnerKey, dataHash, `{"name":"large","aggregates_enabled":true}`)
+				rows = count
+			}
+			request := h.aggregateRequest(t, tc.withAccess)
+			router := gin.New()
+			router.POST("/data/aggregate", h.AggregateDataset)
+
+			// The response is a small table, so the heap is sampled as the rows are read
+			storage := &heapSamplingStorage{LocalStorageService: h.storage.(*services.LocalStorageService), sampleEvery: 256 << 10}
+			h.storageService = storage
+			baseline := liveHeap()
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("aggregate = %d %s", recorder.Code, recorder.Body.String())
+			}
+			_, result := aggregateResult(t, recorder.Body.Bytes())
+			if result.RowsScanned != rows || len(result.Groups) != 2 || result.Groups[0].Rows+result.Groups[1].Rows != rows {
+				t.Errorf("aggregated %d rows into %+v, want %d rows in two groups", result.RowsScanned, result.Groups, rows)
+			}
+			// Holding the parsed rows would take several times the dataset's size
+			if storage.peakHeap == 0 {
+				t.Fatal("the blob wasn't streamed")
+			}
+			if growth := int64(storage.peakHeap) - int64(baseline); growth > size/8 {
+				t.Errorf("heap grew by %d bytes aggregating %d bytes, want it flat", growth, size)
+			}
+		})
+	}
+}
+
+func TestAggregateAnswersFromTheStoredRows(t *testing.T) {
+	minGroupSize := config.AppConfig.AggregateMinGroupSize
+	config.AppConfig.AggregateMinGroupSize = 1
+	t.Cleanup(func() { config.AppConfig.AggregateMinGroupSize = minGroupSize })
+
+	h := newTestHandler(t)
+	h.storeTestDataset(t, testOwnerKey, "id,score,active\n1,2,true\n2,4,true\n3,9,false\n", "small")
+	recorder := serve(http.MethodPost, "/data/aggregate", h.AggregateDataset, h.aggregateRequest(t, true))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("aggregate = %d %s", recorder.Code, recorder.Body.String())
+	}
+	_, result := aggregateResult(t, recorder.Body.Bytes())
+	averages := make(map[string]string)
+	for _, group := range result.Groups {
+		if group.Value != nil {
+			averages[group.Key] = fmt.Sprintf("%g over %d", *group.Value, group.Rows)
+		}
+	}
+	if result.RowsScanned != 3 || averages["true"] != "3 over 2" || averages["false"] != "9 over 1" {
+		t.Errorf("aggregated %d rows to %v, want 3 rows averaging 3 over 2 and 9 over 1", result.RowsScanned, averages)
+	}
+}
+
+func TestAggregateStopsReadingAtTheDeadline(t *testing.T) {
+	timeout := config.AppConfig.AggregateTimeout
+	config.AppConfig.AggregateTimeout = 0
+	t.Cleanup(func() { config.AppConfig.AggregateTimeout = timeout })
+
+	h := newTestHandler(t)
+	h.storeTestDataset(t, testOwnerKey, testCSV, "late")
+	recorder := serve(http.MethodPost, "/data/aggregate", h.AggregateDataset, h.aggregateRequest(t, true))
+	response, _ := aggregateResult(t, recorder.Body.Bytes())
+	if recorder.Code != http.StatusUnprocessableEntity || response.Code != models.ErrCodeAggregateLimit {
+		t.Errorf("aggregate past its deadline = %d %q, want 422 %s", recorder.Code, response.Code, models.ErrCodeAggregateLimit)
+	}
+}
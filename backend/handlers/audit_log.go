@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/datax/backend/middleware"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// GetAuditLog returns a page of the reads of an owner's datasets, newest first, optionally
+// narrowed to one dataset, one requester or a time range. The owner's wallet signature is
+// required, since the log shows who downloaded what
+func (h *Handler) GetAuditLog(c *gin.Context) {
+	var req models.AuditLogRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.To > 0 && req.From > req.To {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "from must not be after to",
+		})
+		return
+	}
+	if !h.verifyWalletSignature(c, req.Owner, req.WalletSignature) {
+		return
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultAuditPageSize
+	}
+	if limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+
+	owner, _ := services.NormalizeAddress(req.Owner)
+	filter := models.AuditFilter{DatasetID: req.DatasetID, From: req.From, To: req.To}
+	if req.Requester != "" {
+		filter.Requester, _ = services.NormalizeAddress(req.Requester)
+	}
+
+	entries, total, err := h.auditLog.List(owner, filter, req.Offset, limit)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to list audit log of %s: %v\n", owner, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.AuditLogPage{
+			Entries: entries,
+			Total:   total,
+			Offset:  req.Offset,
+			Limit:   limit,
+		},
+	})
+}
+
+// recordAudit queues an audit entry for a read that returned rows of an owner's dataset
+// (0 for ciphertext and presigned URLs). Reads that ended in an error aren't recorded
+func (h *Handler) recordAudit(c *gin.Context, owner string, datasetID uint64, requester string, rows int) {
+	if c.Writer.Status() >= http.StatusMultipleChoices {
+		return
+	}
+	ownerAddr, err := services.NormalizeAddress(owner)
+	if err != nil {
+		ownerAddr = owner
+	}
+	requesterAddr, err := services.NormalizeAddress(requester)
+	if err != nil {
+		requesterAddr = requester
+	}
+	h.auditLog.Record(models.AuditEntry{
+		Owner:     ownerAddr,
+		DatasetID: datasetID,
+		Requester: requesterAddr,
+		Endpoint:  c.FullPath(),
+		Rows:      rows,
+		Timestamp: time.Now().Unix(),
+		RequestID: c.GetString(middleware.RequestIDKey),
+	})
+}
+
+// GetDatasetAnalytics returns read counters for each of an owner's datasets over a time
+// window (the last 7 days by default), with zeros for datasets nobody read. The owner's
+// wallet signature is required, as for the audit log the counters come from
+func (h *Handler) GetDatasetAnalytics(c *gin.Context) {
+	var req models.DatasetAnalyticsRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if req.To > 0 && req.From > req.To {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "from must not be after to",
+		})
+		return
+	}
+	if !h.verifyWalletSignature(c, req.Owner, req.WalletSignature) {
+		return
+	}
+
+	owner, _ := services.NormalizeAddress(req.Owner)
+	analytics, err := h.auditLog.Analytics(h.aptosService, owner, req.From, req.To)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to compute analytics of %s: %v\n", owner, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    analytics,
+	})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+)
+
+// getAnalytics asks /data/analytics for the owner's counters, signed with privateKey
+func (h *testHandler) getAnalytics(t *testing.T, owner string, privateKey string, from int64, to int64) (int, models.DatasetAnalytics) {
+	t.Helper()
+	request := jsonRequest(t, http.MethodPost, "/data/analytics", models.DatasetAnalyticsRequest{
+		Owner: owner, From: from, To: to,
+		WalletSignature: h.signProof(t, owner, privateKey).WalletSignature(),
+	})
+	recorder := serve(http.MethodPost, "/data/analytics", h.GetDatasetAnalytics, request)
+	var response struct {
+		Data models.DatasetAnalytics `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response.Data
+}
+
+func TestDatasetAnalyticsHasARowForEveryDataset(t *testing.T) {
+	h := newTestHandler(t)
+	owner, requester := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+	h.submitTestDataset(t, testOwnerKey, fmt.Sprintf("0x%064x", 1), "weather")
+	h.submitTestDataset(t, testOwnerKey, fmt.Sprintf("0x%064x", 2), "traffic")
+
+	const from, to = 1_000_000, 2_000_000
+	repo := services.NewStateAuditLogRepository(nil)
+	repo.Append([]models.AuditEntry{
+		{Owner: owner, DatasetID: 0, Requester: requester, Endpoint: "/api/v1/data/get-csv", Rows: 4, Timestamp: from},
+		{Owner: owner, DatasetID: 0, Requester: requester, Endpoint: "/api/v1/data/get-csv", Rows: 4, Timestamp: to + 1},
+	})
+	h.auditLog = services.NewAuditLog(repo)
+
+	status, analytics := h.getAnalytics(t, owner, testOwnerKey, from, to)
+	if status != http.StatusOK {
+		t.Fatalf("analytics = %d, want 200", status)
+	}
+	want := []models.DatasetActivity{
+		{DatasetID: 0, Name: "weather", UniqueRequesters: 1, Downloads: 1, RowsReturned: 4, LastAccessAt: from},
+		{DatasetID: 1, Name: "traffic"},
+	}
+	if len(analytics.Datasets) != len(want) || analytics.Datasets[0] != want[0] || analytics.Datasets[1] != want[1] {
+		t.Errorf("datasets = %+v, want %+v", analytics.Datasets, want)
+	}
+
+	// The counters are the owner's to see, over a window that makes sense
+	if status, _ := h.getAnalytics(t, owner, testRequesterKey, from, to); status != http.StatusUnauthorized {
+		t.Errorf("analytics signed by someone else = %d, want 401", status)
+	}
+	if status, _ := h.getAnalytics(t, owner, testOwnerKey, to, from); status != http.StatusBadRequest {
+		t.Errorf("analytics from after to = %d, want 400", status)
+	}
+}
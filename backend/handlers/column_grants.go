@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// headerWithheldColumns lists, URL-escaped and comma-separated, the columns left out of a read
+// because the requester's grant doesn't cover them
+const headerWithheldColumns = "X-Withheld-Columns"
+
+// grantColumns cleans the columns a grant is limited to: names are trimmed and duplicates,
+// compared case-insensitively, dropped
+func grantColumns(columns []string) []string {
+	seen := make(map[string]bool, len(columns))
+	cleaned := make([]string, 0, len(columns))
+	for _, name := range columns {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		cleaned = append(cleaned, name)
+	}
+	return cleaned
+}
+
+// storeColumnGrant records the columns a grant is limited to before the grant goes on chain,
+// so a requester is never left with full access because the record couldn't be written
+func (h *Handler) storeColumnGrant(owner string, datasetID uint64, requester string, columns []string) error {
+	store, ok := h.storageService.(services.ColumnGrantStore)
+	if !ok {
+		return fmt.Errorf("storage backend cannot keep column restrictions")
+	}
+	return store.StoreColumnGrant(owner, models.ColumnGrant{
+		DatasetID: datasetID,
+		Requester: requester,
+		Columns:   columns,
+		CreatedAt: time.Now().Unix(),
+	})
+}
+
+// deleteColumnGrant drops a grant's column restriction, if the backend keeps any
+func (h *Handler) deleteColumnGrant(owner string, datasetID uint64, requester string) error {
+	store, ok := h.storageService.(services.ColumnGrantStore)
+	if !ok {
+		return nil
+	}
+	return store.DeleteColumnGrant(owner, datasetID, requester)
+}
+
+// allowedColumns returns the columns requester may read of the owner's dataset, or nil when
+// they may read every column: they own it, or their grant isn't restricted. A restriction
+// that can't be read fails the request with a 500 rather than opening up every column
+func (h *Handler) allowedColumns(c *gin.Context, owner string, datasetID uint64, requester string) ([]string, bool) {
+	if strings.EqualFold(strings.TrimSpace(owner), strings.TrimSpace(requester)) {
+		return nil, true
+	}
+	store, ok := h.storageService.(services.ColumnGrantStore)
+	if !ok {
+		return nil, true
+	}
+
+	grant, err := store.RetrieveColumnGrant(owner, datasetID, requester)
+	if errors.Is(err, services.ErrColumnGrantNotFound) {
+		return nil, true
+	}
+	if err != nil {
+		fmt.Printf("ERROR: Failed to read column grant of dataset %d for %s: %v\n", datasetID, requester, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to check which columns you may read: %v", err),
+		})
+		return nil, false
+	}
+	return grant.Columns, true
+}
+
+// requireAllColumns refuses, with 403 COLUMNS_RESTRICTED, reads that hand out the whole blob
+// or its data key, which can't leave out the columns a restricted grant doesn't cover.
+// It returns true when the requester may read every column
+func (h *Handler) requireAllColumns(c *gin.Context, owner string, datasetID uint64, requester string, alternative string) bool {
+	allowed, ok := h.allowedColumns(c, owner, datasetID, requester)
+	if !ok {
+		return false
+	}
+	if allowed == nil {
+		return true
+	}
+	c.JSON(http.StatusForbidden, models.Response{
+		Success: false,
+		Error:   fmt.Sprintf("Your grant covers only some columns (%s), so the whole dataset can't be handed out; %s", strings.Join(allowed, ", "), alternative),
+		Code:    models.ErrCodeColumnsRestricted,
+	})
+	return false
+}
+
+// withholdColumns removes the columns allowed doesn't name (case-insensitively) from records,
+// keeping the order of the rest, and returns the header names it removed. A nil allowed keeps
+// everything
+func withholdColumns(records [][]string, allowed []string) ([][]string, []string) {
+	if len(records) == 0 {
+		return records, nil
+	}
+	indexes, withheld := keptColumnIndexes(records[0], allowed)
+	if indexes == nil {
+		return records, nil
+	}
+
+	kept := make([][]string, len(records))
+	for r, record := range records {
+		kept[r] = keepColumns(record, indexes)
+	}
+	return kept, withheld
+}
+
+// keptColumnIndexes returns the positions of the header's columns that allowed names, and the
+// names of the others. Positions are nil when nothing is withheld
+func keptColumnIndexes(header []string, allowed []string) ([]int, []string) {
+	if allowed == nil {
+		return nil, nil
+	}
+	permitted := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		permitted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	indexes := []int{}
+	var withheld []string
+	for i, name := range header {
+		if permitted[strings.ToLower(strings.TrimSpace(name))] {
+			indexes = append(indexes, i)
+		} else {
+			withheld = append(withheld, name)
+		}
+	}
+	if len(withheld) == 0 {
+		return nil, nil
+	}
+	return indexes, withheld
+}
+
+// keepColumns returns the cells of record at indexes, or record itself for nil indexes
+func keepColumns(record []string, indexes []int) []string {
+	if indexes == nil {
+		return record
+	}
+	row := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		if i < len(record) {
+			row = append(row, record[i])
+		}
+	}
+	return row
+}
+
+// noteWithheldColumns sets X-Withheld-Columns and returns the message telling the requester
+// which columns were left out; "" when none were
+func noteWithheldColumns(c *gin.Context, withheld []string) string {
+	if len(withheld) == 0 {
+		return ""
+	}
+	escaped := make([]string, len(withheld))
+	for i, name := range withheld {
+		escaped[i] = url.PathEscape(name)
+	}
+	c.Header(headerWithheldColumns, strings.Join(escaped, ","))
+	return fmt.Sprintf("Columns withheld because your grant doesn't cover them: %s", strings.Join(withheld, ", "))
+}
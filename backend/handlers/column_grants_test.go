@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+)
+
+// contactsCSV is a dataset whose email column an owner may keep back from a grant
+const contactsCSV = "id,name,email\n1,alpha,a@example.com\n2,beta,b@example.com\n"
+
+// grantColumnsTo grants the requester access to the owner's dataset 0, limited to columns
+// when there are any
+func (h *testHandler) grantColumnsTo(t *testing.T, requester string, columns []string) {
+	t.Helper()
+	datasetID, expiresAt := uint64(0), uint64(0)
+	request := jsonRequest(t, http.MethodPost, "/access/grant", models.GrantAccessRequest{
+		PrivateKey: testOwnerKey, DatasetID: &datasetID, Requester: requester, ExpiresAt: &expiresAt, Columns: columns,
+	})
+	if recorder := serve(http.MethodPost, "/access/grant", h.GrantAccess, request); recorder.Code != http.StatusOK {
+		t.Fatalf("grant = %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestColumnGrantLimitsAReadOfEveryColumn(t *testing.T) {
+	h := newTestHandler(t)
+	owner, requester := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+	dataHash := h.storeTestDataset(t, testOwnerKey, contactsCSV, "contacts")
+	h.grantColumnsTo(t, requester, []string{"ID", " name "})
+	datasetID := uint64(0)
+
+	// Asking for everything returns only the granted columns, noting the rest
+	request := jsonRequest(t, http.MethodPost, "/data/get-csv", models.GetCSVDataRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: requester,
+		DataAccessProof: h.signProof(t, requester, testRequesterKey),
+	})
+	recorder := serve(http.MethodPost, "/data/get-csv", h.GetCSVData, request)
+	var response struct {
+		models.Response
+		Data [][]string `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	want := [][]string{{"id", "name"}, {"1", "alpha"}, {"2", "beta"}}
+	if recorder.Code != http.StatusOK || !reflect.DeepEqual(response.Data, want) {
+		t.Fatalf("get-csv of every column = %d %v, want 200 %v", recorder.Code, response.Data, want)
+	}
+	if withheld := recorder.Header().Get(headerWithheldColumns); withheld != "email" || response.Message == "" {
+		t.Errorf("%s %q, message %q, want email noted", headerWithheldColumns, withheld, response.Message)
+	}
+
+	// Naming a column outside the grant drops it rather than handing it out
+	request = jsonRequest(t, http.MethodPost, "/data/get-csv", models.GetCSVDataRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: requester, Columns: []string{"email", "name"},
+		DataAccessProof: h.signProof(t, requester, testRequesterKey),
+	})
+	recorder = serve(http.MethodPost, "/data/get-csv", h.GetCSVData, request)
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if want := [][]string{{"name"}, {"alpha"}, {"beta"}}; recorder.Code != http.StatusOK || !reflect.DeepEqual(response.Data, want) {
+		t.Errorf("get-csv of email and name = %d %v, want 200 %v", recorder.Code, response.Data, want)
+	}
+
+	// Export and preview leave the column out the same way
+	request = jsonRequest(t, http.MethodPost, "/data/export", models.ExportDataRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: requester, Format: "csv",
+		DataAccessProof: h.signProof(t, requester, testRequesterKey),
+	})
+	recorder = serve(http.MethodPost, "/data/export", h.ExportData, request)
+	if want := "id,name\n1,alpha\n2,beta\n"; recorder.Code != http.StatusOK || recorder.Body.String() != want {
+		t.Errorf("export = %d %q, want 200 %q", recorder.Code, recorder.Body.String(), want)
+	}
+	request = jsonRequest(t, http.MethodPost, "/data/preview", models.PreviewCSVRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: requester,
+		DataAccessProof: h.signProof(t, requester, testRequesterKey),
+	})
+	recorder = serve(http.MethodPost, "/data/preview", h.PreviewCSVData, request)
+	var preview struct {
+		Data models.CSVPreview `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &preview)
+	if recorder.Code != http.StatusOK || !reflect.DeepEqual(preview.Data.Header, []string{"id", "name"}) ||
+		!reflect.DeepEqual(preview.Data.WithheldColumns, []string{"email"}) {
+		t.Errorf("preview = %d %v withholding %v, want 200 id,name withholding email", recorder.Code, preview.Data.Header, preview.Data.WithheldColumns)
+	}
+
+	// The whole blob can't leave out a column, so a presigned download is refused
+	request = jsonRequest(t, http.MethodPost, "/data/download-url", models.DownloadURLRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: requester,
+		DataAccessProof: h.signProof(t, requester, testRequesterKey),
+	})
+	recorder = serve(http.MethodPost, "/data/download-url", h.GetDownloadURL, request)
+	var refused models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &refused)
+	if recorder.Code != http.StatusForbidden || refused.Code != models.ErrCodeColumnsRestricted {
+		t.Errorf("download-url = %d %q, want 403 %s", recorder.Code, refused.Code, models.ErrCodeColumnsRestricted)
+	}
+
+	// The owner still reads every column
+	request = jsonRequest(t, http.MethodPost, "/data/get-csv", models.GetCSVDataRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: owner,
+		DataAccessProof: h.signProof(t, owner, testOwnerKey),
+	})
+	recorder = serve(http.MethodPost, "/data/get-csv", h.GetCSVData, request)
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusOK || len(response.Data) == 0 || len(response.Data[0]) != 3 {
+		t.Errorf("owner's get-csv = %d %v, want every column", recorder.Code, response.Data)
+	}
+}
+
+func TestColumnGrantIsLiftedAndCleared(t *testing.T) {
+	h := newTestHandler(t)
+	owner, requester := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+	h.storeTestDataset(t, testOwnerKey, contactsCSV, "contacts")
+	store := h.storage.(services.ColumnGrantStore)
+
+	h.grantColumnsTo(t, requester, []string{"id"})
+	if grant, err := store.RetrieveColumnGrant(owner, 0, requester); err != nil || !reflect.DeepEqual(grant.Columns, []string{"id"}) {
+		t.Fatalf("column grant = %v, %v, want id", grant, err)
+	}
+
+	// A later grant without columns lifts the restriction
+	h.grantColumnsTo(t, requester, nil)
+	if _, err := store.RetrieveColumnGrant(owner, 0, requester); !errors.Is(err, services.ErrColumnGrantNotFound) {
+		t.Errorf("column grant after an unrestricted grant: %v, want %v", err, services.ErrColumnGrantNotFound)
+	}
+
+	// Revoking clears it, so a grant made again isn't restricted by the old one
+	h.grantColumnsTo(t, requester, []string{"id"})
+	datasetID := uint64(0)
+	request := jsonRequest(t, http.MethodPost, "/access/revoke", models.RevokeAccessRequest{
+		PrivateKey: testOwnerKey, DatasetID: &datasetID, Requester: requester,
+	})
+	if recorder := serve(http.MethodPost, "/access/revoke", h.RevokeAccess, request); recorder.Code != http.StatusOK {
+		t.Fatalf("revoke = %d %s", recorder.Code, recorder.Body)
+	}
+	if _, err := store.RetrieveColumnGrant(owner, 0, requester); !errors.Is(err, services.ErrColumnGrantNotFound) {
+		t.Errorf("column grant after revocation: %v, want %v", err, services.ErrColumnGrantNotFound)
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Text encodings an uploaded CSV is read as. Anything but UTF-8 is transcoded to it first
+const (
+	encodingUTF8        = "utf-8"
+	encodingUTF16LE     = "utf-16le"
+	encodingUTF16BE     = "utf-16be"
+	encodingWindows1252 = "windows-1252"
+)
+
+var (
+	// errBinaryUpload marks an upload that isn't text: it has NUL bytes or starts like a binary format
+	errBinaryUpload = errors.New("file is not text")
+	// errInvalidEncoding marks an upload read as UTF-8 that stops being valid UTF-8 past the
+	// sample its encoding was detected from
+	errInvalidEncoding = errors.New("file is not valid UTF-8")
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// binarySignatures are the leading bytes of formats that get renamed to .csv by mistake.
+// Zip archives aren't listed: they are tried as .xlsx workbooks before text is sniffed
+var binarySignatures = []struct {
+	prefix []byte
+	kind   string
+}{
+	{[]byte("\x89PNG\r\n\x1a\n"), "a PNG image"},
+	{[]byte("\xFF\xD8\xFF"), "a JPEG image"},
+	{[]byte("GIF87a"), "a GIF image"},
+	{[]byte("GIF89a"), "a GIF image"},
+	{[]byte("%PDF-"), "a PDF document"},
+	{[]byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), "a legacy Office file (.xls); save it as .xlsx or CSV"},
+	{[]byte("\x1F\x8B"), "a gzip archive"},
+	{[]byte("7z\xBC\xAF\x27\x1C"), "a 7-Zip archive"},
+	{[]byte("Rar!\x1A\x07"), "a RAR archive"},
+	{[]byte("PAR1"), "a Parquet file"},
+	{[]byte("SQLite format 3\x00"), "an SQLite database"},
+	{[]byte("\x7FELF"), "an executable"},
+}
+
+// decodeCSVText sniffs the first delimiterSampleBytes of an upload, which r must be able to
+// peek, and returns the upload as UTF-8 with \n line endings along with the encoding it was
+// read as. A byte order mark decides the encoding; without one, UTF-16 is recognized by its
+// NUL bytes and a sample that isn't UTF-8 is read as Windows-1252, which agrees with Latin-1
+// on every printable character. Binary signatures and NUL bytes are refused with
+// errBinaryUpload, and UTF-8 that turns invalid later in the stream fails it with
+// errInvalidEncoding, so nothing is buffered beyond the sample
+func decodeCSVText(r *bufio.Reader) (io.Reader, string, error) {
+	sample, _ := r.Peek(delimiterSampleBytes)
+	for _, signature := range binarySignatures {
+		if bytes.HasPrefix(sample, signature.prefix) {
+			return nil, "", fmt.Errorf("%w: it looks like %s", errBinaryUpload, signature.kind)
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(sample, utf8BOM):
+		r.Discard(len(utf8BOM))
+		return newNormalizedText(r), encodingUTF8, nil
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return newNormalizedText(unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Reader(r)), encodingUTF16LE, nil
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return newNormalizedText(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Reader(r)), encodingUTF16BE, nil
+	}
+
+	if i := bytes.IndexByte(sample, 0); i >= 0 {
+		if endianness, ok := sniffUTF16(sample); ok {
+			encoding := encodingUTF16LE
+			if endianness == unicode.BigEndian {
+				encoding = encodingUTF16BE
+			}
+			return newNormalizedText(unicode.UTF16(endianness, unicode.IgnoreBOM).NewDecoder().Reader(r)), encoding, nil
+		}
+		return nil, "", fmt.Errorf("%w: it has a NUL byte at offset %d", errBinaryUpload, i)
+	}
+
+	// A full sample can end partway through a character
+	if len(sample) == delimiterSampleBytes {
+		for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(sample[i]) {
+				if !utf8.FullRune(sample[i:]) {
+					sample = sample[:i]
+				}
+				break
+			}
+		}
+	}
+	if !utf8.Valid(sample) {
+		return newNormalizedText(charmap.Windows1252.NewDecoder().Reader(r)), encodingWindows1252, nil
+	}
+	return newNormalizedText(r), encodingUTF8, nil
+}
+
+// sniffUTF16 recognizes UTF-16 without a byte order mark from mostly-ASCII text, where every
+// other byte is NUL: the odd ones in little-endian, the even ones in big-endian
+func sniffUTF16(sample []byte) (unicode.Endianness, bool) {
+	pairs := len(sample) / 2
+	if pairs == 0 {
+		return unicode.LittleEndian, false
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < pairs*2; i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	switch {
+	case oddZeros*2 >= pairs && evenZeros*10 < oddZeros:
+		return unicode.LittleEndian, true
+	case evenZeros*2 >= pairs && oddZeros*10 < evenZeros:
+		return unicode.BigEndian, true
+	}
+	return unicode.LittleEndian, false
+}
+
+// encodingDetails describes the encoding an upload was read as for its response, with a
+// warning when it had to be converted
+func encodingDetails(details map[string]interface{}, encoding string) {
+	details["encoding"] = encoding
+	if encoding != encodingUTF8 {
+		details["encoding_warning"] = fmt.Sprintf("The file was read as %s and converted to UTF-8; check non-ASCII characters came through as intended", encoding)
+	}
+}
+
+// normalizedText passes UTF-8 through with \r\n and lone \r line endings turned into \n. It
+// fails with errBinaryUpload at a NUL byte and with errInvalidEncoding at invalid UTF-8
+type normalizedText struct {
+	src     io.Reader
+	chunk   []byte
+	carry   []byte // Start of a character split across reads
+	out     []byte // Normalized bytes not yet returned
+	offset  int64  // Of the first carried byte in the text
+	afterCR bool   // A \r was just turned into \n, so a following \n is dropped
+	err     error
+}
+
+func newNormalizedText(src io.Reader) *normalizedText {
+	return &normalizedText{src: src, chunk: make([]byte, 32*1024)}
+}
+
+func (t *normalizedText) Read(p []byte) (int, error) {
+	for len(t.out) == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		t.fill()
+	}
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
+
+// fill reads the next chunk from src and normalizes it into out
+func (t *normalizedText) fill() {
+	n, readErr := t.src.Read(t.chunk)
+	data := append(t.carry, t.chunk[:n]...)
+	t.carry = nil
+	out := t.out[:0]
+
+	i := 0
+	for i < len(data) {
+		b := data[i]
+		if b < utf8.RuneSelf {
+			switch {
+			case b == 0:
+				t.err = fmt.Errorf("%w: it has a NUL byte at offset %d", errBinaryUpload, t.offset+int64(i))
+			case b == '\r':
+				out = append(out, '\n')
+			case b != '\n' || !t.afterCR:
+				out = append(out, b)
+			}
+			if t.err != nil {
+				break
+			}
+			t.afterCR = b == '\r'
+			i++
+			continue
+		}
+
+		t.afterCR = false
+		if !utf8.FullRune(data[i:]) && readErr == nil {
+			t.carry = append([]byte(nil), data[i:]...)
+			break
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size <= 1 {
+			t.err = fmt.Errorf("%w: invalid byte 0x%02X at offset %d", errInvalidEncoding, data[i], t.offset+int64(i))
+			break
+		}
+		out = append(out, data[i:i+size]...)
+		i += size
+	}
+
+	t.offset += int64(len(data) - len(t.carry))
+	t.out = out
+	if t.err == nil && readErr != nil {
+		t.err = readErr
+	}
+}
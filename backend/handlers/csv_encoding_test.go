@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+
+	"github.com/datax/backend/models"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// encodeUTF16 encodes text as UTF-16 in either byte order, after bom when it isn't empty
+func encodeUTF16(text string, bigEndian bool, bom bool) string {
+	units := utf16.Encode([]rune(text))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	encoded := make([]byte, 0, 2*len(units))
+	for _, unit := range units {
+		if bigEndian {
+			encoded = append(encoded, byte(unit>>8), byte(unit))
+		} else {
+			encoded = append(encoded, byte(unit), byte(unit>>8))
+		}
+	}
+	return string(encoded)
+}
+
+// pngUpload is the start of a PNG image, as a screenshot renamed to .csv would be
+const pngUpload = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x10\x00\x00\x00\x10\x08\x02\x00\x00\x00"
+
+func TestDecodeCSVText(t *testing.T) {
+	const want = "id,name\n1,café\n2,naïve\n"
+	// Invalid bytes past the sample the encoding is detected from
+	longText := strings.Repeat("1,ascii\n", delimiterSampleBytes/8+1)
+
+	cases := []struct {
+		name     string
+		upload   string
+		want     string
+		encoding string
+		err      error
+	}{
+		{"UTF-8", want, want, encodingUTF8, nil},
+		{"UTF-8 with a BOM", "\xEF\xBB\xBF" + want, want, encodingUTF8, nil},
+		{"UTF-16LE with a BOM", encodeUTF16(want, false, true), want, encodingUTF16LE, nil},
+		{"UTF-16BE with a BOM", encodeUTF16(want, true, true), want, encodingUTF16BE, nil},
+		{"UTF-16LE without a BOM", encodeUTF16(want, false, false), want, encodingUTF16LE, nil},
+		{"UTF-16BE without a BOM", encodeUTF16(want, true, false), want, encodingUTF16BE, nil},
+		{"Latin-1", "id,name\n1,caf\xE9\n2,na\xEFve\n", want, encodingWindows1252, nil},
+		{"CRLF and CR line endings", "id,name\r\n1,café\r2,naïve\r\n", want, encodingUTF8, nil},
+		{"PNG renamed to .csv", pngUpload, "", "", errBinaryUpload},
+		{"PDF renamed to .csv", "%PDF-1.7\n%\xE2\xE3\xCF\xD3\n", "", "", errBinaryUpload},
+		{"NUL in the sample", "id,name\n1,a\x00b\n", "", "", errBinaryUpload},
+		{"NUL past the sample", longText + "2,a\x00b\n", "", encodingUTF8, errBinaryUpload},
+		{"invalid UTF-8 past the sample", longText + "2,caf\xE9\n", "", encodingUTF8, errInvalidEncoding},
+	}
+	for _, tc := range cases {
+		for _, oneByte := range []bool{false, true} {
+			var src io.Reader = strings.NewReader(tc.upload)
+			if oneByte {
+				src = iotest.OneByteReader(src)
+			}
+			text, encoding, err := decodeCSVText(bufio.NewReaderSize(src, delimiterSampleBytes))
+			var decoded []byte
+			if err == nil {
+				decoded, err = io.ReadAll(text)
+			}
+			if !errors.Is(err, tc.err) || encoding != tc.encoding {
+				t.Errorf("%s (one byte at a time: %t): %s, %v, want %s, %v", tc.name, oneByte, encoding, err, tc.encoding, tc.err)
+				continue
+			}
+			if tc.err == nil && string(decoded) != tc.want {
+				t.Errorf("%s (one byte at a time: %t): decoded %q, want %q", tc.name, oneByte, decoded, tc.want)
+			}
+		}
+	}
+}
+
+func TestSubmitCSVDecodesTextEncodings(t *testing.T) {
+	sum := sha256.Sum256([]byte(testCSV))
+	wantHash := "0x" + hex.EncodeToString(sum[:])
+
+	cases := []struct {
+		name     string
+		upload   string
+		encoding string
+	}{
+		{"UTF-8", testCSV, encodingUTF8},
+		{"UTF-8 with a BOM", "\xEF\xBB\xBF" + testCSV, encodingUTF8},
+		{"UTF-16LE", encodeUTF16(testCSV, false, true), encodingUTF16LE},
+		{"UTF-16BE", encodeUTF16(strings.ReplaceAll(testCSV, "\n", "\r\n"), true, true), encodingUTF16BE},
+	}
+	for _, tc := range cases {
+		h := newTestHandler(t)
+		owner := addressOf(t, testOwnerKey)
+		status, response := h.submitCSV(t, h.signedUploadFields(t, owner, testOwnerKey), tc.upload)
+		if status != http.StatusOK {
+			t.Errorf("%s upload = %d %s", tc.name, status, response.Error)
+			continue
+		}
+		data, _ := response.Data.(map[string]interface{})
+		// Every encoding of the same rows stores the same canonical CSV
+		if data["data_hash"] != wantHash || data["encoding"] != tc.encoding {
+			t.Errorf("%s upload hashed to %v read as %v, want %s read as %s", tc.name, data["data_hash"], data["encoding"], wantHash, tc.encoding)
+		}
+		if _, warned := data["encoding_warning"]; warned != (tc.encoding != encodingUTF8) {
+			t.Errorf("%s upload encoding_warning = %v", tc.name, data["encoding_warning"])
+		}
+	}
+}
+
+func TestSubmitCSVRejectsFilesThatArentText(t *testing.T) {
+	cases := []struct {
+		name   string
+		upload string
+		code   string
+	}{
+		{"PNG renamed to .csv", pngUpload, models.ErrCodeBinaryFile},
+		{"NUL past the sample", strings.Repeat("1,ascii\n", delimiterSampleBytes/8+1) + "2,a\x00b\n", models.ErrCodeBinaryFile},
+		{"invalid UTF-8 past the sample", "id,name\n" + strings.Repeat("1,ascii\n", delimiterSampleBytes/8+1) + "2,caf\xE9\n", models.ErrCodeInvalidEncoding},
+	}
+	for _, tc := range cases {
+		h := newTestHandler(t)
+		owner := addressOf(t, testOwnerKey)
+		status, response := h.submitCSV(t, h.signedUploadFields(t, owner, testOwnerKey), tc.upload)
+		if status != http.StatusUnprocessableEntity || response.Code != tc.code {
+			t.Errorf("%s upload = %d %q, want 422 %s", tc.name, status, response.Code, tc.code)
+		}
+		manifest, _ := h.storage.RetrieveManifest(owner)
+		if len(manifest) != 0 {
+			t.Errorf("%s upload was indexed: %v", tc.name, manifest)
+		}
+	}
+}
+
+func TestSniffUTF16(t *testing.T) {
+	if endianness, ok := sniffUTF16([]byte(encodeUTF16("id,name", false, false))); !ok || endianness != unicode.LittleEndian {
+		t.Error("little-endian UTF-16 wasn't recognized")
+	}
+	if endianness, ok := sniffUTF16([]byte(encodeUTF16("id,name", true, false))); !ok || endianness != unicode.BigEndian {
+		t.Error("big-endian UTF-16 wasn't recognized")
+	}
+	// NULs that don't alternate are binary, not text
+	for _, sample := range []string{"", "a", "id,name\n1,alpha\n", "\x00\x00\x00\x00", "ab\x00\x00cd\x00\x00"} {
+		if _, ok := sniffUTF16([]byte(sample)); ok {
+			t.Errorf("sniffUTF16(%q) recognized UTF-16", sample)
+		}
+	}
+}
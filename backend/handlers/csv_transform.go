@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/datax/backend/models"
+	dataschema "github.com/datax/backend/schema"
+)
+
+// CSV output formats accepted by GetCSVData
+const (
+	csvFormatRows    = "rows"    // Arrays of strings, header first
+	csvFormatRecords = "records" // Objects keyed by header name with coerced values
+)
+
+// formatCSVRows renders data rows in the requested output format
+func formatCSVRows(header []string, rows [][]string, format string) interface{} {
+	if format == csvFormatRecords {
+		return dataschema.ToRecords(header, rows)
+	}
+	return rows
+}
+
+// paginateCSV slices the data rows of a parsed CSV (header first) into a page rendered
+// in the given format. An offset past the end yields an empty page
+func paginateCSV(records [][]string, offset *int, limit *int, format string) models.CSVPage {
+	page := models.CSVPage{Header: []string{}, Rows: formatCSVRows(nil, [][]string{}, format)}
+	if len(records) == 0 {
+		return page
+	}
+	page.Header = records[0]
+	rows := records[1:]
+	page.TotalRows = len(rows)
+
+	if offset != nil {
+		page.Offset = *offset
+	}
+	page.Limit = page.TotalRows - page.Offset
+	if limit != nil {
+		page.Limit = *limit
+	}
+	if page.Limit < 0 {
+		page.Limit = 0
+	}
+
+	if page.Offset < len(rows) {
+		end := page.Offset + page.Limit
+		if end > len(rows) {
+			end = len(rows)
+		}
+		page.Rows = formatCSVRows(page.Header, rows[page.Offset:end], format)
+	}
+	return page
+}
+
+// projectCSV keeps only the named columns of a parsed CSV (header first), in the order
+// requested. Names match the header case-insensitively; the first matching column wins.
+// Names with no match are returned and the records are left untouched
+func projectCSV(records [][]string, columns []string) ([][]string, []string) {
+	if len(records) == 0 {
+		return records, columns
+	}
+
+	positions := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, ok := positions[key]; !ok {
+			positions[key] = i
+		}
+	}
+
+	indexes := make([]int, 0, len(columns))
+	var missing []string
+	for _, name := range columns {
+		i, ok := positions[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	if len(missing) > 0 {
+		return records, missing
+	}
+
+	projected := make([][]string, len(records))
+	for r, record := range records {
+		row := make([]string, len(indexes))
+		for j, i := range indexes {
+			if i < len(record) {
+				row[j] = record[i]
+			}
+		}
+		projected[r] = row
+	}
+	return projected, nil
+}
@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/datax/backend/xlsx"
+	"github.com/gin-gonic/gin"
+)
+
+// contentTypeXLSX is the MIME type browsers send for Excel workbooks
+const contentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// maxFormFieldBytes bounds the size of a non-file form field in an upload
+const maxFormFieldBytes = 1 << 20
+
+// errCSVFormat wraps upload framing failures so they map to 400 rather than 500
+var errCSVFormat = errors.New("invalid upload")
+
+// errCSVInvalid marks a CSV that failed structural validation; the report holds the details
+var errCSVInvalid = errors.New("CSV failed validation")
+
+// limitUploadBody caps the request body at MAX_UPLOAD_BYTES, rejecting declared oversize
+// bodies with 413 up front. It returns false when a response has been written
+func limitUploadBody(c *gin.Context) bool {
+	maxBytes := config.AppConfig.MaxUploadBytes
+	if c.Request.ContentLength > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Upload exceeds the %d byte limit", maxBytes),
+		})
+		return false
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	return true
+}
+
+// uploadOptions returns the configured shape limits for uploaded datasets, reading comma-separated input
+func uploadOptions() csvOptions {
+	return csvOptions{
+		maxRows:    config.AppConfig.MaxCSVRows,
+		maxColumns: config.AppConfig.MaxCSVColumns,
+	}
+}
+
+// uploadSignatureFields are the form fields carrying the owner's wallet signature of an upload
+var uploadSignatureFields = []string{"nonce", "signed_message", "public_key", "signature"}
+
+// requireUploadFields checks the form fields every dataset upload needs, including the
+// account owner's wallet signature, so nothing is stored or indexed under an account by
+// anyone but its owner. data_hash is optional: the server computes the authoritative hash
+// while streaming
+func (h *Handler) requireUploadFields(c *gin.Context, fields map[string]string, fileField string) bool {
+	if fields["account_address"] == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Missing required field: account_address (it must be sent before %s)", fileField),
+		})
+		return false
+	}
+	address, err := services.NormalizeAddress(fields["account_address"])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid account_address: %v", err),
+			Code:    models.ErrCodeValidationFailed,
+		})
+		return false
+	}
+	fields["account_address"] = address
+
+	for _, name := range uploadSignatureFields {
+		if fields[name] == "" {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("Missing required field: %s (the owner's wallet signature must be sent before %s)", name, fileField),
+			})
+			return false
+		}
+	}
+	return h.verifyWalletSignature(c, address, models.WalletSignature{
+		Nonce:         fields["nonce"],
+		SignedMessage: fields["signed_message"],
+		PublicKey:     fields["public_key"],
+		Signature:     fields["signature"],
+	})
+}
+
+// readUploadForm reads multipart form fields up to the fileField part, which is returned
+// unread so the caller can stream it. Fields after the file are not seen
+func readUploadForm(r *http.Request, fileField string) (map[string]string, *multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: expected a multipart upload: %v", errCSVFormat, err)
+	}
+
+	fields := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return fields, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if part.FormName() == fileField {
+			return fields, part, nil
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxFormFieldBytes))
+		part.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		fields[part.FormName()] = string(value)
+	}
+}
+
+// maxReportedViolations caps the violations collected before validation stops
+const maxReportedViolations = 100
+
+// csvUploadSource returns the CSV stream for an uploaded file part and the options to
+// read it with. Excel workbooks, detected by extension, content type, or magic bytes, are
+// converted from the worksheet named by the "sheet" field (default: the first). Text files
+// are decoded to UTF-8 (see decodeCSVText) and use the "delimiter" field when given,
+// otherwise the delimiter is sniffed from the first few KB. The returned details describe
+// the source for the upload response
+func csvUploadSource(part *multipart.Part, fields map[string]string) (io.Reader, csvOptions, map[string]interface{}, error) {
+	opts := uploadOptions()
+	buffered := bufio.NewReaderSize(part, delimiterSampleBytes)
+	head, _ := buffered.Peek(8)
+
+	isWorkbook := strings.HasSuffix(strings.ToLower(part.FileName()), ".xlsx") ||
+		part.Header.Get("Content-Type") == contentTypeXLSX ||
+		xlsx.LooksLikeWorkbook(head)
+	if !isWorkbook {
+		decoded, encoding, err := decodeCSVText(buffered)
+		if err != nil {
+			return nil, opts, nil, err
+		}
+		if encoding != encodingUTF8 {
+			fmt.Printf("WARNING: Upload %q read as %s and converted to UTF-8\n", part.FileName(), encoding)
+		}
+		text := bufio.NewReaderSize(decoded, delimiterSampleBytes)
+
+		if explicit := fields["delimiter"]; explicit != "" {
+			delimiter, ok := parseDelimiter(explicit)
+			if !ok {
+				return nil, opts, nil, fmt.Errorf("%w: unsupported delimiter %q (use comma, semicolon, tab, or pipe)", errCSVFormat, explicit)
+			}
+			opts.delimiter = delimiter
+		} else {
+			sample, _ := text.Peek(delimiterSampleBytes)
+			opts.delimiter = sniffDelimiter(sample)
+		}
+		details := map[string]interface{}{"delimiter": string(opts.delimiter)}
+		encodingDetails(details, encoding)
+		return text, opts, details, nil
+	}
+
+	// Zip archives need random access, so the workbook is read whole; the request body
+	// is already capped at MAX_UPLOAD_BYTES
+	data, err := io.ReadAll(buffered)
+	if err != nil {
+		return nil, opts, nil, err
+	}
+	rows, err := xlsx.ReadSheet(data, fields["sheet"])
+	if err != nil {
+		return nil, opts, nil, fmt.Errorf("%w: %v", errCSVFormat, err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		writer := csv.NewWriter(pw)
+		writer.WriteAll(rows)
+		pw.CloseWithError(writer.Error())
+	}()
+	details := map[string]interface{}{"source_format": "xlsx"}
+	if fields["sheet"] != "" {
+		details["sheet"] = fields["sheet"]
+	}
+	return pr, opts, details, nil
+}
+
+// delimiterSampleBytes is how much of a text upload is sampled to sniff its delimiter
+const delimiterSampleBytes = 8 * 1024
+
+// candidateDelimiters are tried in order; earlier ones win ties
+var candidateDelimiters = []rune{',', ';', '\t', '|'}
+
+// parseDelimiter accepts a delimiter character or its name
+func parseDelimiter(value string) (rune, bool) {
+	switch strings.ToLower(value) {
+	case ",", "comma":
+		return ',', true
+	case ";", "semicolon":
+		return ';', true
+	case "\t", "\\t", "tab":
+		return '\t', true
+	case "|", "pipe":
+		return '|', true
+	}
+	return 0, false
+}
+
+// sniffDelimiter picks the candidate that splits the sampled lines most consistently:
+// the most lines sharing the same non-zero field separator count, then the higher count.
+// Separators inside quoted fields are ignored. The last sampled line may be cut short,
+// so it is skipped when the sample is full. Falls back to comma
+func sniffDelimiter(sample []byte) rune {
+	lines := strings.Split(string(sample), "\n")
+	if len(sample) >= delimiterSampleBytes && len(lines) > 1 {
+		lines = lines[:len(lines)-1]
+	}
+
+	best, bestLines, bestCount := ',', 0, 0
+	for _, delimiter := range candidateDelimiters {
+		frequency := make(map[int]int)
+		inQuotes := false
+		for _, line := range lines {
+			count := 0
+			for _, r := range line {
+				switch {
+				case r == '"':
+					inQuotes = !inQuotes
+				case r == delimiter && !inQuotes:
+					count++
+				}
+			}
+			// A quoted field spanning lines carries over; count only lines that end outside quotes
+			if !inQuotes && count > 0 {
+				frequency[count]++
+			}
+		}
+
+		modeLines, modeCount := 0, 0
+		for count, lineCount := range frequency {
+			if lineCount > modeLines || (lineCount == modeLines && count > modeCount) {
+				modeLines, modeCount = lineCount, count
+			}
+		}
+		if modeLines > bestLines || (modeLines == bestLines && modeCount > bestCount) {
+			best, bestLines, bestCount = delimiter, modeLines, modeCount
+		}
+	}
+	return best
+}
+
+// csvOptions describes how to read an uploaded CSV and bounds its shape
+type csvOptions struct {
+	delimiter  rune // Input field separator; 0 means ','. Output is always comma-separated
+	maxRows    int
+	maxColumns int
+}
+
+// recordObserver sees each CSV record as it streams past, e.g. for schema inference or statistics
+type recordObserver interface {
+	Observe(record []string)
+}
+
+// csvStreamResult is the outcome of streaming a CSV upload
+type csvStreamResult struct {
+	report models.CSVValidationReport
+	err    error
+}
+
+// streamCSV parses CSV from src row by row, validates its structure, and writes it
+// re-encoded to dst as canonical CSV bytes (see newCanonicalCSVWriter). Output stops at the first violation and the result carries
+// errCSVInvalid, so a partially written upload is never completed by storage. Every
+// record written, header included, is also passed to the observers
+func streamCSV(src io.Reader, dst io.Writer, opts csvOptions, observers ...recordObserver) csvStreamResult {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1 // Ragged rows are reported as violations, not parse errors
+	if opts.delimiter != 0 {
+		reader.Comma = opts.delimiter
+	}
+	writer := newCanonicalCSVWriter(dst)
+
+	result := csvStreamResult{report: models.CSVValidationReport{Violations: []models.CSVViolation{}, Delimiter: string(reader.Comma)}}
+	report := &result.report
+	violate := func(row int, column, format string, args ...interface{}) bool {
+		if len(report.Violations) >= maxReportedViolations {
+			report.Truncated = true
+			return false
+		}
+		report.Violations = append(report.Violations, models.CSVViolation{
+			Row:     row,
+			Column:  column,
+			Message: fmt.Sprintf(format, args...),
+		})
+		return true
+	}
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			if row == 1 {
+				violate(0, "", "file is empty")
+			}
+			break
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) || errors.Is(err, errBinaryUpload) || errors.Is(err, errInvalidEncoding) {
+				result.err = err
+				return result
+			}
+			violate(row, "", "malformed CSV: %v", err)
+			break
+		}
+
+		if row == 1 {
+			if !validateCSVHeader(record, opts, violate) {
+				break
+			}
+			report.ColumnCount = len(record)
+			report.Columns = append([]string(nil), record...)
+		} else {
+			report.RowCount++
+			if report.RowCount > opts.maxRows {
+				violate(row, "", "file has more than the %d data rows allowed", opts.maxRows)
+				report.RowCount--
+				break
+			}
+			if len(record) != report.ColumnCount {
+				if !violate(row, "", "row has %d columns, expected %d", len(record), report.ColumnCount) {
+					break
+				}
+			}
+		}
+
+		// Keep validating after the first violation so the report is complete, but stop writing
+		if len(report.Violations) == 0 {
+			for _, observer := range observers {
+				observer.Observe(record)
+			}
+			if err := writer.Write(record); err != nil {
+				result.err = err
+				return result
+			}
+		}
+	}
+
+	report.Valid = len(report.Violations) == 0
+	if !report.Valid {
+		result.err = errCSVInvalid
+		return result
+	}
+
+	writer.Flush()
+	result.err = writer.Error()
+	return result
+}
+
+// validateCSVHeader reports blank, duplicate, and excess column names in the header row
+// It returns false when the header is unusable and validation should stop
+func validateCSVHeader(header []string, opts csvOptions, violate func(int, string, string, ...interface{}) bool) bool {
+	if len(header) > opts.maxColumns {
+		violate(1, "", "header has %d columns, more than the %d allowed", len(header), opts.maxColumns)
+		return false
+	}
+
+	blank := 0
+	seen := make(map[string]int, len(header))
+	for i, name := range header {
+		column := fmt.Sprintf("%d", i+1)
+		trimmed := strings.TrimSpace(name)
+		if trimmed == "" {
+			blank++
+			violate(1, column, "column name is blank")
+			continue
+		}
+		key := strings.ToLower(trimmed)
+		if first, ok := seen[key]; ok {
+			violate(1, column, "duplicate column name %q (first used by column %d)", trimmed, first)
+			continue
+		}
+		seen[key] = i + 1
+	}
+
+	if blank == len(header) {
+		violate(1, "", "header row is empty")
+		return false
+	}
+	return true
+}
+
+// respondCSVInvalid reports structural violations with 422
+func respondCSVInvalid(c *gin.Context, report models.CSVValidationReport) {
+	c.JSON(http.StatusUnprocessableEntity, models.Response{
+		Success: false,
+		Error:   fmt.Sprintf("CSV failed validation with %d violation(s)", len(report.Violations)),
+		Code:    models.ErrCodeInvalidCSV,
+		Data:    report,
+	})
+}
+
+// respondUploadError maps upload failures to 413 (too large), 422 (not text), 400 (bad
+// input), or 500
+func respondUploadError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		c.JSON(http.StatusRequestEntityTooLarge, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Upload exceeds the %d byte limit", maxBytesErr.Limit),
+		})
+	case errors.Is(err, errBinaryUpload):
+		c.JSON(http.StatusUnprocessableEntity, models.Response{
+			Success: false,
+			Error:   "Upload is not a CSV: " + err.Error(),
+			Code:    models.ErrCodeBinaryFile,
+		})
+	case errors.Is(err, errInvalidEncoding):
+		c.JSON(http.StatusUnprocessableEntity, models.Response{
+			Success: false,
+			Error:   "Upload is not a readable CSV: " + err.Error() + "; save it as UTF-8",
+			Code:    models.ErrCodeInvalidEncoding,
+		})
+	case errors.Is(err, errCSVFormat), errors.Is(err, multipart.ErrMessageTooLarge):
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Failed to parse upload: " + err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   "Failed to read upload: " + err.Error(),
+		})
+	}
+}
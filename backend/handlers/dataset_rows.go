@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rowsCheckInterval is how many in-memory rows are read between checks of the context;
+// streamed rows are checked on every read from storage
+const rowsCheckInterval = 1000
+
+// datasetRows reads a dataset's records a row at a time. A blob that can be checked against
+// the on-chain hash before anything is read from it is streamed from storage, so the dataset
+// is never held whatever its size; any other is read into memory by retrieveDatasetCSV
+type datasetRows struct {
+	Header   []string
+	BlobName string
+
+	ctx     context.Context
+	open    func() (io.ReadCloser, error) // Nil for rows held in memory
+	body    io.ReadCloser
+	reader  *csv.Reader
+	records [][]string
+	next    int
+}
+
+// contextReader fails reads once its context is done, so a pass over a blob stops with the
+// request or its deadline
+type contextReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
+
+// openDatasetRows opens a dataset's records for reading, streamed from storage where the
+// blob allows (see streamMatchesDataset) and otherwise loaded by retrieveDatasetCSV, which
+// writes the error response when that fails. When ctx ends first it returns false without
+// responding, for the caller to report its own deadline; the caller closes the rows
+func (h *Handler) openDatasetRows(c *gin.Context, ctx context.Context, owner string, datasetID uint64, dataHash string) (*datasetRows, bool) {
+	if rows := h.streamDatasetRows(ctx, owner, datasetID); rows != nil {
+		return rows, true
+	}
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	records, blobName, ok := h.retrieveDatasetCSV(c, owner, datasetID, dataHash)
+	if !ok {
+		return nil, false
+	}
+	return newRecordRows(ctx, blobName, records), true
+}
+
+// streamDatasetRows opens a dataset's blob as a stream of rows, or returns nil when it can't
+// be streamed or doesn't hash canonically to the on-chain hash
+func (h *Handler) streamDatasetRows(ctx context.Context, owner string, datasetID uint64) *datasetRows {
+	blobName, onChainHash, err := h.resolveDatasetBlob(owner, datasetID)
+	if err != nil || !h.streamMatchesDataset(ctx, owner, blobName, onChainHash) {
+		return nil
+	}
+	rows := &datasetRows{
+		BlobName: blobName,
+		ctx:      ctx,
+		open:     func() (io.ReadCloser, error) { return h.openDatasetStream(owner, blobName) },
+	}
+	if err := rows.start(); err != nil {
+		fmt.Printf("DEBUG: Can't stream %s, reading it into memory: %v\n", blobName, err)
+		return nil
+	}
+	return rows
+}
+
+// newRecordRows serves records already in memory, the header first, as datasetRows
+func newRecordRows(ctx context.Context, blobName string, records [][]string) *datasetRows {
+	rows := &datasetRows{BlobName: blobName, ctx: ctx, Header: []string{}}
+	if len(records) > 0 {
+		rows.Header, rows.records = records[0], records[1:]
+	}
+	return rows
+}
+
+// start opens the stream and reads its header
+func (r *datasetRows) start() error {
+	body, err := r.open()
+	if err != nil {
+		return err
+	}
+	reader := csv.NewReader(contextReader{r.ctx, body})
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil && err != io.EOF {
+		body.Close()
+		return err
+	}
+	// The reader reuses the slice for the next row
+	r.Header = slices.Clone(header)
+	if r.Header == nil {
+		r.Header = []string{}
+	}
+	r.body, r.reader = body, reader
+	return nil
+}
+
+// Read returns the next data row, or io.EOF after the last. A streamed row is only valid
+// until the next Read
+func (r *datasetRows) Read() ([]string, error) {
+	if r.open != nil {
+		return r.reader.Read()
+	}
+	if r.next%rowsCheckInterval == 0 {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if r.next >= len(r.records) {
+		return nil, io.EOF
+	}
+	r.next++
+	return r.records[r.next-1], nil
+}
+
+// Rewind starts the rows over from the first after the header. A streamed blob is opened
+// again
+func (r *datasetRows) Rewind() error {
+	if r.open == nil {
+		r.next = 0
+		return nil
+	}
+	// Should reopening fail, reads keep failing on the closed body
+	r.body.Close()
+	r.body = nil
+	return r.start()
+}
+
+// Close releases the stream, if any
+func (r *datasetRows) Close() {
+	if r.body != nil {
+		r.body.Close()
+	}
+}
+
+// scanRows passes every remaining row to observe, stopping at the first read error
+func scanRows(rows *datasetRows, observe func(record []string)) error {
+	for {
+		record, err := rows.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		observe(record)
+	}
+}
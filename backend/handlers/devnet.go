@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetDevnetStatus returns what the local devnet bootstrap did at startup: whether it ran, the
+// deployer it funded and the module addresses it published
+func (h *Handler) GetDevnetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    services.DevnetBootstrapStatus(),
+	})
+}
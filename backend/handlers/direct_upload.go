@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	dataschema "github.com/datax/backend/schema"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// directUploadStorage is implemented by storage backends that accept presigned uploads
+type directUploadStorage interface {
+	NewPendingUpload(accountAddress string, contentType string, size int64, ttl time.Duration) (string, string, string, error)
+	PendingUpload(accountAddress string, uploadID string) (models.BlobManifestEntry, error)
+	HeadBlob(accountAddress string, blobName string) (int64, error)
+	OpenBlob(accountAddress string, blobName string) (io.ReadCloser, error)
+	CompletePendingUpload(accountAddress string, uploadID string, dataHash string, entry models.BlobManifestEntry) error
+	PurgeExpiredUploads(accountAddress string) (int, error)
+}
+
+// directUploadContentTypes are the declared content types a presigned upload may use
+var directUploadContentTypes = map[string]bool{
+	"text/csv":        true,
+	"application/csv": true,
+	"text/plain":      true,
+}
+
+// directUploader returns the storage backend as a directUploadStorage, writing a 501 when
+// it doesn't support presigned uploads. Presigned bytes never pass through the server, so
+// they can't be encrypted at rest and direct uploads are refused while encryption is on
+func (h *Handler) directUploader(c *gin.Context) (directUploadStorage, bool) {
+	if services.EncryptionEnabled() {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "Direct uploads are disabled while encryption at rest is enabled; use /data/submit-csv",
+		})
+		return nil, false
+	}
+	uploader, ok := h.storageService.(directUploadStorage)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, models.Response{
+			Success: false,
+			Error:   "Storage backend does not support direct uploads; use /data/submit-csv",
+		})
+	}
+	return uploader, ok
+}
+
+// CreateUploadURL returns a presigned URL the client PUTs its CSV to directly, for a key the
+// backend chooses under the caller's address. The upload is pending until FinalizeUpload
+func (h *Handler) CreateUploadURL(c *gin.Context) {
+	var req models.UploadURLRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if req.Size > config.AppConfig.MaxUploadBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Upload is larger than the %d bytes allowed", config.AppConfig.MaxUploadBytes),
+		})
+		return
+	}
+	contentType := strings.ToLower(strings.TrimSpace(strings.SplitN(req.ContentType, ";", 2)[0]))
+	if !directUploadContentTypes[contentType] {
+		c.JSON(http.StatusUnsupportedMediaType, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Unsupported content type %q; direct uploads must be CSV", req.ContentType),
+		})
+		return
+	}
+
+	if !h.verifyWalletSignature(c, req.AccountAddress, req.WalletSignature) {
+		return
+	}
+
+	uploader, ok := h.directUploader(c)
+	if !ok {
+		return
+	}
+
+	// Abandoned uploads are collected whenever the owner starts a new one
+	if _, err := uploader.PurgeExpiredUploads(req.AccountAddress); err != nil {
+		fmt.Printf("ERROR: Failed to purge expired uploads for %s: %v\n", req.AccountAddress, err)
+	}
+
+	ttl := time.Duration(config.AppConfig.PresignMaxTTL) * time.Second
+	uploadID, blobName, url, err := uploader.NewPendingUpload(req.AccountAddress, contentType, req.Size, ttl)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to create upload URL for %s: %v\n", req.AccountAddress, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to create upload URL: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"upload_id":    uploadID,
+			"url":          url,
+			"method":       http.MethodPut,
+			"headers":      map[string]string{"Content-Type": contentType},
+			"blob_name":    blobName,
+			"expires_at":   time.Now().Add(ttl).Unix(),
+			"content_type": contentType,
+			"size":         req.Size,
+		},
+	})
+}
+
+// FinalizeUpload completes a presigned upload: it checks the object arrived with the declared
+// size, validates and hashes it like SubmitCSV, and records it in the manifest under the
+// computed data hash, which the client then registers on chain. Invalid uploads are deleted
+func (h *Handler) FinalizeUpload(c *gin.Context) {
+	var req models.FinalizeUploadRequest
+	if !bindAndValidate(c, &req) || !checkDatasetMetadata(c, metadataText(req.Metadata)) {
+		return
+	}
+
+	if !h.verifyWalletSignature(c, req.AccountAddress, req.WalletSignature) {
+		return
+	}
+
+	uploader, ok := h.directUploader(c)
+	if !ok {
+		return
+	}
+
+	pending, err := uploader.PendingUpload(req.AccountAddress, req.UploadID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrUploadNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// discard removes an upload that can't be finalized
+	discard := func() {
+		if err := h.storageService.DeleteBlob(req.AccountAddress, pending.BlobName); err != nil {
+			fmt.Printf("ERROR: Failed to delete rejected upload %s: %v\n", pending.BlobName, err)
+		}
+	}
+
+	if time.Now().Unix() > pending.ExpiresAt {
+		discard()
+		c.JSON(http.StatusGone, models.Response{
+			Success: false,
+			Error:   "Upload expired before it was finalized; request a new upload URL",
+			Code:    models.ErrCodeUploadExpired,
+		})
+		return
+	}
+
+	size, err := uploader.HeadBlob(req.AccountAddress, pending.BlobName)
+	if err != nil {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "Upload not found in storage; PUT the file to the upload URL first",
+		})
+		return
+	}
+	if size != pending.Size {
+		discard()
+		c.JSON(http.StatusUnprocessableEntity, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Uploaded %d bytes, but %d were declared", size, pending.Size),
+		})
+		return
+	}
+
+	body, err := uploader.OpenBlob(req.AccountAddress, pending.BlobName)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to read upload %s: %v\n", pending.BlobName, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to read uploaded file: %v", err),
+		})
+		return
+	}
+	defer body.Close()
+
+	text, encoding, err := decodeCSVText(bufio.NewReaderSize(body, delimiterSampleBytes))
+	if err != nil {
+		discard()
+		respondUploadError(c, err)
+		return
+	}
+
+	// Hash the canonical re-encoding, not the raw bytes, so downloads verify the same way
+	hasher := sha256.New()
+	statsCollector := dataschema.NewStatsCollector(config.AppConfig.StatsMaxDistinct)
+	observers := []recordObserver{statsCollector}
+	piiScanner := uploadPIIScanner()
+	if piiScanner != nil {
+		observers = append(observers, piiScanner)
+	}
+	stream := streamCSV(text, hasher, uploadOptions(), observers...)
+	if errors.Is(stream.err, errCSVInvalid) {
+		discard()
+		respondCSVInvalid(c, stream.report)
+		return
+	}
+	if errors.Is(stream.err, errBinaryUpload) || errors.Is(stream.err, errInvalidEncoding) {
+		discard()
+		respondUploadError(c, stream.err)
+		return
+	}
+	if stream.err != nil {
+		respondUploadError(c, stream.err)
+		return
+	}
+	if encoding != encodingUTF8 {
+		fmt.Printf("WARNING: Upload %s read as %s and converted to UTF-8\n", pending.BlobName, encoding)
+	}
+
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	computedHash := "0x" + contentHash
+	if !checkClientDataHash(c, req.DataHash, computedHash, pending.BlobName) {
+		discard()
+		return
+	}
+
+	err = uploader.CompletePendingUpload(req.AccountAddress, req.UploadID, computedHash, models.BlobManifestEntry{
+		BlobName:   pending.BlobName,
+		UploadedAt: time.Now().Unix(),
+		Size:       size,
+		Verified:   true,
+	})
+	if err != nil {
+		fmt.Printf("ERROR: Failed to finalize upload %s: %v\n", req.UploadID, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to finalize upload: %v", err),
+		})
+		return
+	}
+
+	stats := statsCollector.Stats()
+	stats.DataHash = computedHash
+	stats.BlobName = pending.BlobName
+	stats.ComputedAt = time.Now().UTC().Format(time.RFC3339)
+	data := map[string]interface{}{
+		"account_address":  req.AccountAddress,
+		"blob_name":        pending.BlobName,
+		"data_hash":        computedHash, // Use this in the submit_data transaction
+		"client_data_hash": req.DataHash,
+		"content_hash":     contentHash,
+		"row_count":        stream.report.RowCount,
+		"column_count":     stream.report.ColumnCount,
+		"size":             size,
+	}
+	encodingDetails(data, encoding)
+	piiDetails(piiScanner, &stats, data)
+	if err := h.storageService.StoreCSVStats(req.AccountAddress, pending.BlobName, &stats); err != nil {
+		fmt.Printf("ERROR: Failed to store CSV stats for %s: %v\n", pending.BlobName, err)
+	}
+	h.recordBlobMetadata(req.AccountAddress, pending.BlobName, computedHash, stream.report, size, nil)
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "Upload finalized",
+		Data:    data,
+	})
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// SubmitEncryptedCSV stores a CSV the client encrypted itself. The server never sees the
+// plaintext, so it can't validate or hash it: data_hash (the hash registered on chain) and
+// encryption_metadata (a JSON object, typically algorithm and nonce) must be sent before
+// encrypted_file, and the metadata is stored as the blob's .meta with mode "client". The
+// dataset metadata, when sent as metadata, is checked against its schema as for SubmitCSV
+func (h *Handler) SubmitEncryptedCSV(c *gin.Context) {
+	if !limitUploadBody(c) {
+		return
+	}
+
+	fields, filePart, err := readUploadForm(c.Request, "encrypted_file")
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if filePart == nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Missing encrypted file: encrypted_file",
+		})
+		return
+	}
+	if !h.requireUploadFields(c, fields, "encrypted_file") || !checkDatasetMetadata(c, fields["metadata"]) {
+		return
+	}
+
+	accountAddress := fields["account_address"]
+	dataHash := services.NormalizeDataHash(fields["data_hash"])
+	if dataHash == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Missing or invalid data_hash (it must be sent before encrypted_file): the server can't compute it from ciphertext",
+		})
+		return
+	}
+
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(fields["encryption_metadata"]), &metadata); err != nil || metadata == nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "encryption_metadata must be a JSON object sent before encrypted_file",
+		})
+		return
+	}
+	// A client blob never carries a wrapped key, so the server won't try to decrypt it
+	delete(metadata, "wrapped_key")
+	metadata["mode"] = services.EncryptionModeClient
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Invalid encryption_metadata: " + err.Error(),
+		})
+		return
+	}
+
+	store, ok := h.storageService.(services.EncryptedCSVStorage)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, models.Response{
+			Success: false,
+			Error:   "Storage backend cannot store encrypted blobs",
+		})
+		return
+	}
+
+	ciphertext, err := io.ReadAll(filePart)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if len(ciphertext) == 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "encrypted_file is empty",
+		})
+		return
+	}
+
+	blobName, err := store.StoreEncryptedCSV(accountAddress, ciphertext, metadataJSON)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to store encrypted CSV for %s: %v\n", accountAddress, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to store encrypted data: %v", err),
+		})
+		return
+	}
+	fmt.Printf("DEBUG: Stored client-encrypted CSV %s for account %s\n", blobName, accountAddress)
+
+	err = h.storageService.UpdateManifest(accountAddress, dataHash, models.BlobManifestEntry{
+		BlobName:   blobName,
+		UploadedAt: time.Now().Unix(),
+		Size:       int64(len(ciphertext)),
+		Encrypted:  true,
+	})
+	if err != nil {
+		fmt.Printf("ERROR: Failed to record %s in manifest under %s: %v\n", blobName, dataHash, err)
+	}
+
+	ciphertextHash := sha256.Sum256(ciphertext)
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "Encrypted data received and stored",
+		Data: map[string]interface{}{
+			"account_address": accountAddress,
+			"data_hash":       dataHash, // Use this in the submit_data transaction
+			"blob_name":       blobName,
+			"size":            len(ciphertext),
+			"ciphertext_hash": hex.EncodeToString(ciphertextHash[:]),
+		},
+	})
+}
+
+// GetEncryptedCSV returns a dataset's ciphertext as stored, base64-encoded, with its .meta
+// and on-chain data hash, so a client-encrypted dataset can be decrypted and checked locally.
+// It is GetCSVData with decryption "client"
+func (h *Handler) GetEncryptedCSV(c *gin.Context) {
+	var req models.EncryptedCSVRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if !h.authorizeDataAccess(c, req.Owner, *req.DatasetID, req.Requester, req.DataAccessProof) {
+		return
+	}
+	if !h.requireAllColumns(c, req.Owner, *req.DatasetID, req.Requester, "use /data/get-csv or /data/export") {
+		return
+	}
+
+	h.respondCiphertext(c, req.Owner, *req.DatasetID, req.DataHash)
+	h.recordAudit(c, req.Owner, *req.DatasetID, req.Requester, 0)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+)
+
+// clientEncryption is a dataset sealed the way a client encrypting locally would: AES-256-GCM
+// under its own key, with the algorithm and nonce sent as encryption_metadata
+type clientEncryption struct {
+	key, nonce, ciphertext []byte
+	metadata               string
+}
+
+func encryptLocally(t *testing.T, plaintext string) clientEncryption {
+	t.Helper()
+	key, nonce := make([]byte, 32), make([]byte, 12)
+	rand.Read(key)
+	rand.Read(nonce)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher: %v", err)
+	}
+	gcm, _ := cipher.NewGCM(block)
+	metadata, _ := json.Marshal(map[string]string{"algorithm": services.AlgorithmAES256GCM, "nonce": base64.StdEncoding.EncodeToString(nonce)})
+	return clientEncryption{key: key, nonce: nonce, ciphertext: gcm.Seal(nil, nonce, []byte(plaintext), nil), metadata: string(metadata)}
+}
+
+// decryptLocally is the client opening a download with the key it kept and the nonce from .meta
+func decryptLocally(t *testing.T, key []byte, ciphertext []byte, metadata json.RawMessage) string {
+	t.Helper()
+	var recorded struct {
+		Algorithm string `json:"algorithm"`
+		Nonce     string `json:"nonce"`
+		Mode      string `json:"mode"`
+	}
+	if err := json.Unmarshal(metadata, &recorded); err != nil || recorded.Algorithm != services.AlgorithmAES256GCM || recorded.Mode != services.EncryptionModeClient {
+		t.Fatalf("encryption_metadata = %s, %v, want the client's AES-256-GCM metadata", metadata, err)
+	}
+	nonce, _ := base64.StdEncoding.DecodeString(recorded.Nonce)
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("decrypt download: %v", err)
+	}
+	return string(plaintext)
+}
+
+// submitEncryptedCSV posts fields, in order, and then the ciphertext to /data/submit-encrypted-csv
+func (h *testHandler) submitEncryptedCSV(t *testing.T, fields map[string]string, ciphertext []byte) (int, models.Response) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, name := range []string{"account_address", "nonce", "signed_message", "public_key", "signature", "data_hash", "encryption_metadata"} {
+		if value, ok := fields[name]; ok {
+			form.WriteField(name, value)
+		}
+	}
+	file, _ := form.CreateFormFile("encrypted_file", "data.csv.enc")
+	file.Write(ciphertext)
+	form.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/data/submit-encrypted-csv", &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	recorder := serve(http.MethodPost, "/data/submit-encrypted-csv", h.SubmitEncryptedCSV, request)
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+// getEncryptedCSV downloads the owner's dataset 0 as the requester signing with requesterKey
+func (h *testHandler) getEncryptedCSV(t *testing.T, dataHash string, owner string, requester string, requesterKey string) (int, map[string]json.RawMessage) {
+	t.Helper()
+	datasetID := uint64(0)
+	request := jsonRequest(t, http.MethodPost, "/data/get-encrypted-csv", models.EncryptedCSVRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: requester,
+		DataAccessProof: h.signProof(t, requester, requesterKey),
+	})
+	recorder := serve(http.MethodPost, "/data/get-encrypted-csv", h.GetEncryptedCSV, request)
+	var response struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response.Data
+}
+
+func TestClientEncryptedCSVRoundTrips(t *testing.T) {
+	h := newTestHandler(t)
+	owner, requester := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+	sum := sha256.Sum256([]byte(testCSV))
+	dataHash := "0x" + hex.EncodeToString(sum[:])
+	sealed := encryptLocally(t, testCSV)
+
+	// Upload the ciphertext, then register its plaintext hash on chain as the client would
+	fields := h.signedUploadFields(t, owner, testOwnerKey)
+	fields["data_hash"] = dataHash
+	fields["encryption_metadata"] = sealed.metadata
+	status, response := h.submitEncryptedCSV(t, fields, sealed.ciphertext)
+	if status != http.StatusOK {
+		t.Fatalf("upload = %d %s", status, response.Error)
+	}
+	h.submitTestDataset(t, testOwnerKey, dataHash, "client-encrypted")
+
+	// The server stored ciphertext only
+	blobName, _ := response.Data.(map[string]interface{})["blob_name"].(string)
+	stored, _, err := h.storage.(services.EncryptedCSVStorage).RetrieveEncryptedCSV(owner, blobName)
+	if err != nil || !bytes.Equal(stored, sealed.ciphertext) {
+		t.Errorf("stored blob = %d bytes, %v, want the uploaded ciphertext as is", len(stored), err)
+	}
+
+	// A requester without a grant gets nothing
+	if status, _ := h.getEncryptedCSV(t, dataHash, owner, requester, testRequesterKey); status != http.StatusForbidden {
+		t.Errorf("download before the grant = %d, want 403", status)
+	}
+	h.grantColumnsTo(t, requester, nil)
+
+	for _, reader := range []struct{ address, key string }{{owner, testOwnerKey}, {requester, testRequesterKey}} {
+		status, data := h.getEncryptedCSV(t, dataHash, owner, reader.address, reader.key)
+		if status != http.StatusOK {
+			t.Fatalf("download as %s = %d, want 200", reader.address, status)
+		}
+		var encoded, onChainHash string
+		json.Unmarshal(data["ciphertext"], &encoded)
+		json.Unmarshal(data["data_hash"], &onChainHash)
+		ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || !bytes.Equal(ciphertext, sealed.ciphertext) {
+			t.Fatalf("downloaded ciphertext differs from the upload: %v", err)
+		}
+
+		// Decrypted locally, the data matches the hash registered on chain
+		plaintext := decryptLocally(t, sealed.key, ciphertext, data["encryption_metadata"])
+		digest := sha256.Sum256([]byte(plaintext))
+		if plaintext != testCSV || onChainHash != dataHash || "0x"+hex.EncodeToString(digest[:]) != onChainHash {
+			t.Errorf("as %s: decrypted %q checked against %q, want the upload and %s", reader.address, plaintext, onChainHash, dataHash)
+		}
+	}
+}
+
+func TestSubmitEncryptedCSVNeedsItsHashAndMetadata(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	sealed := encryptLocally(t, testCSV)
+
+	cases := []struct {
+		name       string
+		dataHash   string
+		metadata   string
+		ciphertext []byte
+	}{
+		{"no data hash", "", sealed.metadata, sealed.ciphertext},
+		{"metadata not an object", "0x" + hex.EncodeToString(make([]byte, 32)), `"AES-256-GCM"`, sealed.ciphertext},
+		{"empty file", "0x" + hex.EncodeToString(make([]byte, 32)), sealed.metadata, nil},
+	}
+	for _, tc := range cases {
+		fields := h.signedUploadFields(t, owner, testOwnerKey)
+		fields["data_hash"] = tc.dataHash
+		fields["encryption_metadata"] = tc.metadata
+		if status, _ := h.submitEncryptedCSV(t, fields, tc.ciphertext); status != http.StatusBadRequest {
+			t.Errorf("%s: upload = %d, want 400", tc.name, status)
+		}
+	}
+	if blobs, _ := h.storage.ListBlobs(owner); len(blobs) != 0 {
+		t.Errorf("%d blobs stored by refused uploads, want none", len(blobs))
+	}
+}
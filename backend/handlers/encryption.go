@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// MigrateEncryption brings an owner's blobs up to date with encryption at rest: plain CSV
+// blobs are encrypted under fresh data keys, and server-encrypted blobs whose data key was
+// wrapped by a previous master key are re-wrapped under the current one. Blobs the
+// client encrypted are left alone. It is safe to run again after a partial failure
+func (h *Handler) MigrateEncryption(c *gin.Context) {
+	var req models.MigrateEncryptionRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if !services.EncryptionEnabled() {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "Encryption at rest is not enabled; set ENCRYPTION_MASTER_KEY or KEY_PROVIDER",
+		})
+		return
+	}
+	store, ok := h.storageService.(services.EncryptedCSVStorage)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, models.Response{
+			Success: false,
+			Error:   "Storage backend cannot store encrypted blobs",
+		})
+		return
+	}
+
+	blobs, err := h.storageService.ListBlobs(req.Owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to list blobs: %v", err),
+		})
+		return
+	}
+
+	encrypted, rewrapped, skipped := 0, 0, 0
+	failed := map[string]string{}
+	for _, blob := range blobs {
+		var changed bool
+		var err error
+		if blob.Encrypted {
+			changed, err = h.rewrapBlob(store, req.Owner, blob.Name)
+		} else {
+			changed, err = h.encryptBlob(store, req.Owner, blob.Name)
+		}
+
+		switch {
+		case err != nil:
+			fmt.Printf("ERROR: Encryption migration of %s failed: %v\n", blob.Name, err)
+			failed[blob.Name] = err.Error()
+		case !changed:
+			skipped++
+		case blob.Encrypted:
+			rewrapped++
+		default:
+			encrypted++
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: len(failed) == 0,
+		Data: map[string]interface{}{
+			"owner":     req.Owner,
+			"key_id":    services.CurrentMasterKeyID(),
+			"encrypted": encrypted,
+			"rewrapped": rewrapped,
+			"skipped":   skipped,
+			"failed":    failed,
+		},
+	})
+}
+
+// encryptBlob replaces a plain CSV blob with an encrypted copy, carrying over its statistics
+// and manifest entries. The plain blob is deleted only once the manifest points at the copy
+func (h *Handler) encryptBlob(store services.EncryptedCSVStorage, owner string, blobName string) (bool, error) {
+	records, err := h.storageService.RetrieveCSV(owner, blobName)
+	if err != nil {
+		return false, err
+	}
+	plaintext, err := canonicalCSV(records)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode CSV: %w", err)
+	}
+	ciphertext, metadata, err := services.SealCSV(plaintext)
+	if err != nil {
+		return false, err
+	}
+	newName, err := store.StoreEncryptedCSV(owner, ciphertext, metadata)
+	if err != nil {
+		return false, err
+	}
+
+	if stats, err := h.storageService.RetrieveCSVStats(owner, blobName); err == nil {
+		stats.BlobName = newName
+		if err := h.storageService.StoreCSVStats(owner, newName, stats); err != nil {
+			fmt.Printf("WARNING: Failed to copy CSV stats from %s to %s: %v\n", blobName, newName, err)
+		}
+	}
+
+	if err := h.repointManifest(owner, blobName, newName, services.EnvelopeKeyID(metadata), int64(len(ciphertext))); err != nil {
+		return false, err
+	}
+	if err := h.storageService.DeleteBlob(owner, blobName); err != nil {
+		return true, fmt.Errorf("encrypted as %s but the plain blob could not be deleted: %w", newName, err)
+	}
+	fmt.Printf("DEBUG: Encrypted %s as %s\n", blobName, newName)
+	return true, nil
+}
+
+// rewrapBlob re-wraps a server-encrypted blob's data key under the current master key. The
+// ciphertext is unchanged; backends that name blobs after it store the new metadata in place
+func (h *Handler) rewrapBlob(store services.EncryptedCSVStorage, owner string, blobName string) (bool, error) {
+	ciphertext, metadata, err := store.RetrieveEncryptedCSV(owner, blobName)
+	if err != nil {
+		return false, err
+	}
+	rewrapped, changed, err := services.RewrapEnvelope(metadata)
+	if errors.Is(err, services.ErrNotEnvelope) || (err == nil && !changed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	newName, err := store.StoreEncryptedCSV(owner, ciphertext, rewrapped)
+	if err != nil {
+		return false, err
+	}
+	if err := h.repointManifest(owner, blobName, newName, services.EnvelopeKeyID(rewrapped), int64(len(ciphertext))); err != nil {
+		return false, err
+	}
+	if newName != blobName {
+		if err := h.storageService.DeleteBlob(owner, blobName); err != nil {
+			return true, fmt.Errorf("re-wrapped as %s but %s could not be deleted: %w", newName, blobName, err)
+		}
+	}
+	return true, nil
+}
+
+// repointManifest moves the manifest entries of oldName to newName, marking them encrypted
+// under keyID. A plain blob no entry points at is recorded under the hash in its name, so the
+// data hash still resolves once the old name is gone
+func (h *Handler) repointManifest(owner string, oldName string, newName string, keyID string, size int64) error {
+	manifest, err := h.storageService.RetrieveManifest(owner)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	entries := map[string]models.BlobManifestEntry{}
+	for hash, entry := range manifest {
+		if entry.BlobName == oldName && !entry.Pending {
+			entries[hash] = entry
+		}
+	}
+	if len(entries) == 0 {
+		hash := services.BlobNameHash(oldName)
+		if hash == "" || !strings.HasSuffix(oldName, ".csv") {
+			return nil
+		}
+		entries["0x"+hash] = models.BlobManifestEntry{UploadedAt: time.Now().Unix(), Verified: services.ContentHash(oldName) == "0x"+hash}
+	}
+
+	for hash, entry := range entries {
+		entry.BlobName = newName
+		entry.Size = size
+		entry.Encrypted = true
+		entry.KeyID = keyID
+		if err := h.storageService.UpdateManifest(owner, hash, entry); err != nil {
+			return fmt.Errorf("failed to record %s in manifest under %s: %w", newName, hash, err)
+		}
+	}
+	return nil
+}
+
+// wrapKeyForGrantee wraps the data key of a server-encrypted dataset for a requester's public
+// key and stores it for /access/wrapped-key
+func (h *Handler) wrapKeyForGrantee(privateKey string, datasetID uint64, requester string, recipient *ecdh.PublicKey) error {
+	keyStore, ok := h.storageService.(services.GranteeKeyStore)
+	encryptedStore, encrypts := h.storageService.(services.EncryptedCSVStorage)
+	if !ok || !encrypts {
+		return fmt.Errorf("storage backend cannot keep wrapped keys")
+	}
+
+	owner, err := services.AddressFromPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	blobName, _, err := h.resolveDatasetBlob(owner, datasetID)
+	if err != nil {
+		return err
+	}
+	metadata, err := encryptedStore.RetrieveEncryptionMetadata(owner, blobName)
+	if err != nil {
+		return fmt.Errorf("dataset %d is not encrypted by the server: %w", datasetID, err)
+	}
+
+	key, err := services.WrapDataKeyForGrantee(metadata, recipient)
+	if err != nil {
+		return err
+	}
+	key.DatasetID = datasetID
+	key.Requester = requester
+	key.BlobName = blobName
+	return keyStore.StoreGranteeKey(owner, key)
+}
+
+// GetWrappedKey returns the data key wrapped for the requester when the owner granted them
+// access, so they can decrypt the blob from a presigned download themselves
+func (h *Handler) GetWrappedKey(c *gin.Context) {
+	var req models.WrappedKeyRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if !h.authorizeDataAccess(c, req.Owner, *req.DatasetID, req.Requester, req.DataAccessProof) {
+		return
+	}
+	if !h.requireAllColumns(c, req.Owner, *req.DatasetID, req.Requester, "use /data/get-csv or /data/export") {
+		return
+	}
+
+	keyStore, ok := h.storageService.(services.GranteeKeyStore)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, models.Response{
+			Success: false,
+			Error:   "Storage backend cannot keep wrapped keys",
+		})
+		return
+	}
+
+	key, err := keyStore.RetrieveGranteeKey(req.Owner, *req.DatasetID, req.Requester)
+	if errors.Is(err, services.ErrGranteeKeyNotFound) {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   "No data key was wrapped for you; ask the owner to grant access with your public key",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to read wrapped key: %v", err),
+		})
+		return
+	}
+
+	// A re-upload gets a new data key, so a key wrapped for the old blob no longer helps
+	if blobName, _, err := h.resolveDatasetBlob(req.Owner, *req.DatasetID); err == nil && blobName != key.BlobName {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "The dataset was re-uploaded since access was granted; ask the owner to grant access again",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    key,
+	})
+}
+
+// hasGranteeKey reports whether a data key is stored wrapped for the requester
+func (h *Handler) hasGranteeKey(owner string, datasetID uint64, requester string) bool {
+	keyStore, ok := h.storageService.(services.GranteeKeyStore)
+	if !ok {
+		return false
+	}
+	_, err := keyStore.RetrieveGranteeKey(owner, datasetID, requester)
+	return err == nil
+}
+
+// decryptionProvidedKey is the GetCSVData decryption mode that decrypts with a key the caller sends
+const decryptionProvidedKey = "provided_key"
+
+// decryptionMode picks how GetCSVData serves a dataset: the requested mode, or else the one
+// the blob's .meta records. Plain blobs and blobs that can't be located are served the
+// server way, which reports the failure
+func (h *Handler) decryptionMode(owner string, datasetID uint64, dataHash string, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	store, ok := h.storageService.(services.EncryptedCSVStorage)
+	if !ok {
+		return services.EncryptionModeServer
+	}
+	blobName, _, err := h.resolveDatasetBlob(owner, datasetID)
+	if err != nil || strings.HasSuffix(blobName, ".csv") {
+		return services.EncryptionModeServer
+	}
+	metadata, err := store.RetrieveEncryptionMetadata(owner, blobName)
+	if err != nil {
+		return services.EncryptionModeServer
+	}
+	return services.EncryptionMode(metadata)
+}
+
+// retrieveEncryptedDataset downloads a dataset's ciphertext and .meta. On failure it writes
+// the error response and returns false
+func (h *Handler) retrieveEncryptedDataset(c *gin.Context, owner string, datasetID uint64, dataHash string) ([]byte, []byte, string, bool) {
+	store, ok := h.storageService.(services.EncryptedCSVStorage)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, models.Response{
+			Success: false,
+			Error:   "Storage backend cannot store encrypted blobs",
+		})
+		return nil, nil, "", false
+	}
+	blobName, _, err := h.resolveDatasetBlob(owner, datasetID)
+	if err != nil {
+		respondBlobNotFound(c, dataHash, err)
+		return nil, nil, "", false
+	}
+	if strings.HasSuffix(blobName, ".csv") {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "This dataset is not stored encrypted; request it without a decryption mode",
+		})
+		return nil, nil, "", false
+	}
+	ciphertext, metadata, err := store.RetrieveEncryptedCSV(owner, blobName)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to retrieve %s: %v\n", blobName, err)
+		respondBlobNotFound(c, dataHash, err)
+		return nil, nil, "", false
+	}
+	return ciphertext, metadata, blobName, true
+}
+
+// respondCiphertext returns a dataset exactly as stored, with its .meta, for the caller to
+// decrypt, and the on-chain data hash to check the plaintext against when it is known
+func (h *Handler) respondCiphertext(c *gin.Context, owner string, datasetID uint64, dataHash string) {
+	ciphertext, metadata, blobName, ok := h.retrieveEncryptedDataset(c, owner, datasetID, dataHash)
+	if !ok {
+		return
+	}
+	data := map[string]interface{}{
+		"decryption":          services.EncryptionModeClient,
+		"blob_name":           blobName,
+		"ciphertext":          base64.StdEncoding.EncodeToString(ciphertext),
+		"encryption_metadata": json.RawMessage(metadata),
+	}
+	if onChainHash := h.datasetDataHash(owner, datasetID); onChainHash != "" {
+		data["data_hash"] = onChainHash
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// retrieveWithProvidedKey decrypts a dataset with the caller's data key and checks the result
+// against the on-chain data hash. On failure it writes the error response and returns false
+func (h *Handler) retrieveWithProvidedKey(c *gin.Context, owner string, datasetID uint64, dataHash string, keyValue string) ([][]string, bool) {
+	key, err := parseDataKey(keyValue)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("decryption_key: %v", err),
+		})
+		return nil, false
+	}
+
+	ciphertext, metadata, blobName, ok := h.retrieveEncryptedDataset(c, owner, datasetID, dataHash)
+	if !ok {
+		return nil, false
+	}
+	plaintext, err := services.OpenCSVWithKey(ciphertext, metadata, key)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Could not decrypt the dataset with the provided key: %v", err),
+		})
+		return nil, false
+	}
+	records, err := csv.NewReader(bytes.NewReader(plaintext)).ReadAll()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Decrypted dataset is not valid CSV: %v", err),
+		})
+		return nil, false
+	}
+
+	if !h.verifyDatasetIntegrity(c, owner, datasetID, blobName, records) {
+		return nil, false
+	}
+	return records, true
+}
+
+// parseDataKey decodes a 256-bit data key given as hex or base64
+func parseDataKey(value string) ([]byte, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "0x")
+	if value == "" {
+		return nil, fmt.Errorf("required for decryption provided_key")
+	}
+	if key, err := hex.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("must be 32 bytes as hex or base64")
+}
+
+// GetEncryptionInfo returns the .meta recorded when a dataset was encrypted, so a requester
+// with access can decrypt a client-encrypted download locally. Datasets without a .meta fall
+// back to the encryption details in their on-chain metadata; unencrypted ones get no
+// encryption fields at all
+func (h *Handler) GetEncryptionInfo(c *gin.Context) {
+	var req models.EncryptionInfoRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if !h.authorizeDataAccess(c, req.Owner, *req.DatasetID, req.Requester, req.DataAccessProof) {
+		return
+	}
+
+	blobName, _, err := h.resolveDatasetBlob(req.Owner, *req.DatasetID)
+	if err != nil {
+		respondBlobNotFound(c, req.DataHash, err)
+		return
+	}
+
+	var metadata []byte
+	if store, ok := h.storageService.(services.EncryptedCSVStorage); ok && !strings.HasSuffix(blobName, ".csv") {
+		if metadata, err = store.RetrieveEncryptionMetadata(req.Owner, blobName); err != nil {
+			fmt.Printf("DEBUG: No encryption metadata for %s, falling back to on-chain metadata: %v\n", blobName, err)
+		}
+	}
+
+	onChain, extra := h.datasetMetadata(req.Owner, *req.DatasetID)
+	if metadata == nil {
+		if fields, ok := extra.(map[string]interface{}); ok && fields["encryption_metadata"] != nil {
+			metadata, _ = json.Marshal(fields["encryption_metadata"])
+		}
+	}
+	algorithm := services.EncryptionMetadataAlgorithm(metadata)
+	if algorithm == "" {
+		algorithm = onChain.EncryptionAlgorithm
+	}
+
+	data := map[string]interface{}{
+		"blob_name": blobName,
+		"encrypted": metadata != nil || algorithm != "",
+	}
+	if metadata != nil {
+		data["encryption_metadata"] = json.RawMessage(metadata)
+		data["encryption_mode"] = services.EncryptionMode(metadata)
+	}
+	if algorithm != "" {
+		data["encryption_algorithm"] = algorithm
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    data,
+	})
+}
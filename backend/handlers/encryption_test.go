@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+)
+
+// fetchWrappedKey asks /access/wrapped-key for the requester's key to the owner's dataset 0
+func (h *testHandler) fetchWrappedKey(t *testing.T, owner string, requester string) (int, models.GranteeKey) {
+	t.Helper()
+	datasetID := uint64(0)
+	request := jsonRequest(t, http.MethodPost, "/access/wrapped-key", models.WrappedKeyRequest{
+		Owner: owner, DatasetID: &datasetID, Requester: requester,
+		DataAccessProof: h.signProof(t, requester, testRequesterKey),
+	})
+	recorder := serve(http.MethodPost, "/access/wrapped-key", h.GetWrappedKey, request)
+	var response struct {
+		Data models.GranteeKey `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response.Data
+}
+
+func TestGrantWrapsTheDataKeyForTheGrantee(t *testing.T) {
+	masterKey := config.AppConfig.EncryptionMasterKey
+	config.AppConfig.EncryptionMasterKey = strings.Repeat("ab", 32)
+	t.Cleanup(func() { config.AppConfig.EncryptionMasterKey = masterKey })
+
+	h := newTestHandler(t)
+	owner, requester := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+	// An upload is sealed under a fresh data key before it is stored
+	status, response := h.submitCSV(t, h.signedUploadFields(t, owner, testOwnerKey), testCSV)
+	if status != http.StatusOK {
+		t.Fatalf("upload = %d %s", status, response.Error)
+	}
+	sum := sha256.Sum256([]byte(testCSV))
+	h.submitTestDataset(t, testOwnerKey, "0x"+hex.EncodeToString(sum[:]), "sealed")
+	grantee, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	// Without a grant there is no key to hand out
+	if status, _ := h.fetchWrappedKey(t, owner, requester); status != http.StatusForbidden {
+		t.Errorf("wrapped-key before the grant = %d, want 403", status)
+	}
+
+	datasetID, expiresAt := uint64(0), uint64(0)
+	request := jsonRequest(t, http.MethodPost, "/access/grant", models.GrantAccessRequest{
+		PrivateKey: testOwnerKey, DatasetID: &datasetID, Requester: requester, ExpiresAt: &expiresAt,
+		RequesterPublicKey: hex.EncodeToString(grantee.PublicKey().Bytes()), RequesterKeyType: "x25519",
+	})
+	recorder := serve(http.MethodPost, "/access/grant", h.GrantAccess, request)
+	var granted struct {
+		Data models.TransactionResponse `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &granted)
+	if recorder.Code != http.StatusOK || granted.Data.Message != "Access granted successfully" {
+		t.Fatalf("grant = %d %q", recorder.Code, granted.Data.Message)
+	}
+
+	// The grantee unwraps the key with their private key and decrypts the stored blob with it
+	status, key := h.fetchWrappedKey(t, owner, requester)
+	if status != http.StatusOK {
+		t.Fatalf("wrapped-key = %d, want 200", status)
+	}
+	ciphertext, metadata, err := h.storage.(services.EncryptedCSVStorage).RetrieveEncryptedCSV(owner, key.BlobName)
+	if err != nil {
+		t.Fatalf("RetrieveEncryptedCSV(%q): %v", key.BlobName, err)
+	}
+	dek, err := services.OpenGranteeKey(key, grantee)
+	if err != nil {
+		t.Fatalf("OpenGranteeKey: %v", err)
+	}
+	if plaintext, err := services.OpenCSVWithKey(ciphertext, metadata, dek); err != nil || string(plaintext) != testCSV {
+		t.Errorf("blob decrypted with the unwrapped key = %q, %v, want the uploaded CSV", plaintext, err)
+	}
+
+	// Revoking deletes the wrapped key, so it isn't handed out again
+	request = jsonRequest(t, http.MethodPost, "/access/revoke", models.RevokeAccessRequest{
+		PrivateKey: testOwnerKey, DatasetID: &datasetID, Requester: requester,
+	})
+	if recorder := serve(http.MethodPost, "/access/revoke", h.RevokeAccess, request); recorder.Code != http.StatusOK {
+		t.Fatalf("revoke = %d %s", recorder.Code, recorder.Body)
+	}
+	if _, err := h.storage.(services.GranteeKeyStore).RetrieveGranteeKey(owner, 0, requester); err == nil {
+		t.Error("wrapped key kept after revocation")
+	}
+
+	// A grant made again without a public key leaves nothing to fetch
+	request = jsonRequest(t, http.MethodPost, "/access/grant", models.GrantAccessRequest{
+		PrivateKey: testOwnerKey, DatasetID: &datasetID, Requester: requester, ExpiresAt: &expiresAt,
+	})
+	serve(http.MethodPost, "/access/grant", h.GrantAccess, request)
+	if status, _ := h.fetchWrappedKey(t, owner, requester); status != http.StatusNotFound {
+		t.Errorf("wrapped-key after a grant without a public key = %d, want 404", status)
+	}
+}
+
+func TestGrantRefusesABadRequesterPublicKey(t *testing.T) {
+	h := newTestHandler(t)
+	requester := addressOf(t, testRequesterKey)
+	h.storeTestDataset(t, testOwnerKey, testCSV, "plain")
+
+	datasetID, expiresAt := uint64(0), uint64(0)
+	request := jsonRequest(t, http.MethodPost, "/access/grant", models.GrantAccessRequest{
+		PrivateKey: testOwnerKey, DatasetID: &datasetID, Requester: requester, ExpiresAt: &expiresAt,
+		RequesterPublicKey: "0x1234",
+	})
+	if recorder := serve(http.MethodPost, "/access/grant", h.GrantAccess, request); recorder.Code != http.StatusBadRequest {
+		t.Errorf("grant with a short public key = %d, want 400", recorder.Code)
+	}
+	// The bad key was refused before anything went on chain
+	if ok, _ := h.chain.CheckAccess(addressOf(t, testOwnerKey), datasetID, requester); ok {
+		t.Error("access granted though the public key was refused")
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// DepositEscrow lets a requester put APT in escrow for access to an owner's dataset
+func (h *Handler) DepositEscrow(c *gin.Context) {
+	var req models.EscrowDepositRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	txHash, err := h.aptosService.DepositEscrow(req.PrivateKey, req.Owner, *req.DatasetID, req.Amount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.TransactionResponse{
+			Hash:    txHash,
+			Success: true,
+			Message: "Deposit placed in escrow",
+		},
+	})
+}
+
+// ReleaseEscrow lets the owner collect a requester's deposit. The Escrow module grants the
+// requester access in the same transaction, so the funds never move without the grant
+func (h *Handler) ReleaseEscrow(c *gin.Context) {
+	var req models.EscrowReleaseRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	// As for /access/grant, 0 (no expiry) is sent as the latest deadline
+	expiresAt := req.ExpiresAt
+	if expiresAt == 0 {
+		expiresAt = math.MaxUint64
+	}
+	txHash, err := h.aptosService.ReleaseEscrow(req.PrivateKey, *req.DatasetID, req.Requester, expiresAt)
+	if err != nil {
+		respondEscrowError(c, err)
+		return
+	}
+
+	if owner, err := services.AddressFromPrivateKey(req.PrivateKey); err == nil {
+		h.webhooks.Notify(owner, models.WebhookEventAccessGranted, map[string]interface{}{
+			"dataset_id":       *req.DatasetID,
+			"requester":        req.Requester,
+			"expires_at":       expiresAt,
+			"transaction_hash": txHash,
+		})
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.TransactionResponse{
+			Hash:    txHash,
+			Success: true,
+			Message: "Escrow released and access granted",
+		},
+	})
+}
+
+// RefundEscrow lets a requester take back a deposit the owner hasn't released within the
+// refund timeout
+func (h *Handler) RefundEscrow(c *gin.Context) {
+	var req models.EscrowRefundRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	txHash, err := h.aptosService.RefundEscrow(req.PrivateKey, req.Owner, *req.DatasetID)
+	if err != nil {
+		respondEscrowError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.TransactionResponse{
+			Hash:    txHash,
+			Success: true,
+			Message: "Escrow refunded",
+		},
+	})
+}
+
+// GetEscrowBalance returns what a requester holds in escrow for an owner's dataset, so the
+// UI can show deposits waiting on the owner
+func (h *Handler) GetEscrowBalance(c *gin.Context) {
+	var req models.EscrowBalanceRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	owner, _ := services.NormalizeAddress(req.Owner)
+	requester, _ := services.NormalizeAddress(req.Requester)
+	amount, err := h.aptosService.GetEscrowBalance(owner, *req.DatasetID, requester)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.EscrowBalance{
+			Owner:       owner,
+			DatasetID:   *req.DatasetID,
+			Requester:   requester,
+			AmountOctas: amount,
+		},
+	})
+}
+
+// respondEscrowError maps escrow failures to 404, 409 or 500
+func respondEscrowError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrEscrowNotFound):
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ErrCodeEscrowNotFound,
+		})
+		return
+	case errors.Is(err, services.ErrEscrowRefundTooEarly):
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ErrCodeEscrowRefundTooEarly,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.Response{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/parquet"
+	dataschema "github.com/datax/backend/schema"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Export content types
+const (
+	contentTypeParquet = "application/vnd.apache.parquet"
+	contentTypeCSV     = "text/csv; charset=utf-8"
+	contentTypeJSONL   = "application/x-ndjson"
+)
+
+// exportContentTypes maps each export format to its content type
+var exportContentTypes = map[string]string{
+	"parquet": contentTypeParquet,
+	"csv":     contentTypeCSV,
+	"jsonl":   contentTypeJSONL,
+}
+
+// errStreamUnsupported is returned by openDatasetStream for storage that can't stream blobs
+var errStreamUnsupported = errors.New("this storage backend can't stream blobs")
+
+// blobStreamer is implemented by storage backends that can read a whole blob as a stream
+type blobStreamer interface {
+	OpenBlob(accountAddress string, blobName string) (io.ReadCloser, error)
+}
+
+// unsafeFilenameChars are replaced when deriving a download filename from metadata
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ExportData downloads a dataset as Parquet, CSV or JSON Lines after the same owner-or-access
+// check as GetCSVData. Parquet columns are typed from the dataset's metadata schema and upload
+// statistics; any column whose values don't all fit that type is written as strings. JSON
+// Lines holds one object per row, coerced like the records format of GetCSVData. Every
+// format is written a row at a time, streamed from storage where the blob allows (see
+// openDatasetRows); Parquet reads the blob once more first when a column has a type to
+// check. CSV exports honor a single-range Range header where the stored blob allows it (see
+// serveExportRange). Columns the requester's grant doesn't cover are left out and named in
+// X-Withheld-Columns
+func (h *Handler) ExportData(c *gin.Context) {
+	var req models.ExportDataRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if !h.authorizeDataAccess(c, req.Owner, *req.DatasetID, req.Requester, req.DataAccessProof) {
+		return
+	}
+	allowed, ok := h.allowedColumns(c, req.Owner, *req.DatasetID, req.Requester)
+	if !ok {
+		return
+	}
+
+	switch {
+	case c.GetHeader("Range") != "" && req.Format != "csv":
+		c.Header(headerRangeIgnored, "byte ranges are only served for format csv")
+	case c.GetHeader("Range") != "" && allowed != nil:
+		c.Header(headerRangeIgnored, "your grant covers only some columns, so the export is rebuilt without the others")
+	case req.Format == "csv" && allowed == nil:
+		if h.serveExportRange(c, req) {
+			return
+		}
+	}
+
+	// A request that ends while the blob is checked has no one left to answer
+	rows, ok := h.openDatasetRows(c, c.Request.Context(), req.Owner, *req.DatasetID, req.DataHash)
+	if !ok {
+		return
+	}
+	defer rows.Close()
+	indexes, withheld := keptColumnIndexes(rows.Header, allowed)
+	header := keepColumns(rows.Header, indexes)
+
+	meta, extra := h.datasetMetadata(req.Owner, *req.DatasetID)
+	var out exportWriter
+	switch req.Format {
+	case "csv":
+		out = newCSVExportWriter(c.Writer)
+	case "jsonl":
+		out = newJSONLExportWriter(c.Writer, header)
+	default:
+		columns, err := h.exportColumns(req.Owner, rows, header, indexes, extra)
+		if err != nil {
+			fmt.Printf("ERROR: Failed to read %s for a Parquet export: %v\n", rows.BlobName, err)
+			if c.Request.Context().Err() == nil {
+				c.JSON(http.StatusInternalServerError, models.Response{
+					Success: false,
+					Error:   fmt.Sprintf("Failed to read the dataset: %v", err),
+				})
+			}
+			return
+		}
+		out = parquet.NewWriter(c.Writer, columns)
+	}
+
+	noteWithheldColumns(c, withheld)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFilename(meta.Name, *req.DatasetID, req.Format)))
+	c.Header("Content-Type", exportContentTypes[req.Format])
+	c.Status(http.StatusOK)
+
+	var err error
+	if req.Format == "csv" {
+		err = out.Write(header)
+	}
+	count := 0
+	for err == nil {
+		var record []string
+		if record, err = rows.Read(); err != nil {
+			break
+		}
+		if err = out.Write(keepColumns(record, indexes)); err == nil {
+			count++
+		}
+	}
+	if err == io.EOF {
+		err = out.Close()
+	}
+	if err != nil {
+		// Headers are already sent; all that's left is to log it
+		fmt.Printf("ERROR: %s export of %s failed after %d rows: %v\n", req.Format, rows.BlobName, count, err)
+		return
+	}
+	h.recordAudit(c, req.Owner, *req.DatasetID, req.Requester, count)
+}
+
+// streamMatchesDataset reports whether a blob can be streamed as the dataset its on-chain
+// hash resolved it for: its name proves it, or its records hash canonically to that hash.
+// The frontend's legacy hash needs the whole blob, so those datasets aren't streamed.
+// Hashing stops when ctx ends
+func (h *Handler) streamMatchesDataset(ctx context.Context, owner string, blobName string, onChainHash string) bool {
+	hash := services.NormalizeDataHash(onChainHash)
+	if services.ContentHash(blobName) == hash {
+		return true
+	}
+	if cidHash, err := services.CIDDataHash(blobName); err == nil && cidHash == hash {
+		return true
+	}
+
+	body, err := h.openDatasetStream(owner, blobName)
+	if err != nil {
+		fmt.Printf("DEBUG: Can't stream %s, reading it into memory: %v\n", blobName, err)
+		return false
+	}
+	defer body.Close()
+	computed, err := canonicalCSVStreamHash(contextReader{ctx, body})
+	if err != nil || computed != hash {
+		fmt.Printf("DEBUG: %s doesn't hash canonically to %s (%v), reading it into memory\n", blobName, hash, err)
+		return false
+	}
+	return true
+}
+
+// openDatasetStream opens a blob's CSV bytes as a stream, decrypting a server-encrypted blob
+// a chunk at a time. Blobs encrypted as a single unit can't be streamed; the caller closes
+// the reader
+func (h *Handler) openDatasetStream(owner string, blobName string) (io.ReadCloser, error) {
+	streamer, ok := h.storageService.(blobStreamer)
+	if !ok {
+		return nil, errStreamUnsupported
+	}
+	if !strings.HasSuffix(blobName, ".enc") {
+		return streamer.OpenBlob(owner, blobName)
+	}
+
+	encrypted, ok := h.storageService.(services.EncryptedCSVStorage)
+	if !ok {
+		return nil, errStreamUnsupported
+	}
+	metadata, err := encrypted.RetrieveEncryptionMetadata(owner, blobName)
+	if err != nil {
+		return nil, err
+	}
+	body, err := streamer.OpenBlob(owner, blobName)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := services.OpenCSVStream(body, metadata)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{plaintext, body}, nil
+}
+
+// exportWriter writes an export's rows in one format
+type exportWriter interface {
+	Write(record []string) error
+	Close() error
+}
+
+// csvExportWriter writes rows as canonical CSV
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVExportWriter(w io.Writer) *csvExportWriter {
+	return &csvExportWriter{writer: csv.NewWriter(w)}
+}
+
+func (w *csvExportWriter) Write(record []string) error {
+	return w.writer.Write(record)
+}
+
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// jsonlExportWriter writes each row as a record object on its own line
+type jsonlExportWriter struct {
+	keys    []string
+	encoder *json.Encoder
+}
+
+func newJSONLExportWriter(w io.Writer, header []string) *jsonlExportWriter {
+	return &jsonlExportWriter{keys: dataschema.UniqueNames(header), encoder: json.NewEncoder(w)}
+}
+
+func (w *jsonlExportWriter) Write(record []string) error {
+	return w.encoder.Encode(dataschema.ToRecord(w.keys, record))
+}
+
+func (w *jsonlExportWriter) Close() error { return nil }
+
+// datasetMetadata fetches and parses a dataset's on-chain metadata; lookup failures just
+// mean no metadata, since it only refines the export
+func (h *Handler) datasetMetadata(owner string, datasetID uint64) (models.DatasetMetadata, interface{}) {
+	datasetRaw, err := h.aptosService.GetDataset(owner, datasetID)
+	if err != nil {
+		fmt.Printf("DEBUG: No metadata for dataset %d of %s: %v\n", datasetID, owner, err)
+		return services.ParseDatasetMetadata("")
+	}
+	datasetMap, _ := datasetRaw.(map[string]interface{})
+	metadataStr, _ := datasetMap["metadata"].(string)
+	return services.ParseDatasetMetadata(metadataStr)
+}
+
+// declaredColumnTypes reads the "schema" list the upload form stores in metadata
+// ([{"name": ..., "type": "number"|"boolean"|...}]) keyed by lowercase column name
+func declaredColumnTypes(extra interface{}) map[string]parquet.Type {
+	declared := make(map[string]parquet.Type)
+	fields, _ := extra.(map[string]interface{})
+	schemaList, _ := fields["schema"].([]interface{})
+	for _, entry := range schemaList {
+		column, _ := entry.(map[string]interface{})
+		name, _ := column["name"].(string)
+		typeName, _ := column["type"].(string)
+		if name == "" {
+			continue
+		}
+		switch strings.ToLower(typeName) {
+		case "int", "integer", "int64":
+			declared[strings.ToLower(name)] = parquet.Int64
+		case "number", "float", "double", "decimal":
+			declared[strings.ToLower(name)] = parquet.Double
+		case "bool", "boolean":
+			declared[strings.ToLower(name)] = parquet.Bool
+		}
+	}
+	return declared
+}
+
+// exportColumns types a Parquet export's columns: the type the metadata schema declares, or
+// Double for columns the upload statistics found numeric, narrowed to one every value
+// satisfies (see exportColumnTypes). Names are made unique, as Parquet column paths must be
+func (h *Handler) exportColumns(owner string, rows *datasetRows, header []string, indexes []int, extra interface{}) ([]parquet.Column, error) {
+	declared := declaredColumnTypes(extra)
+	if stats, err := h.storageService.RetrieveCSVStats(owner, rows.BlobName); err == nil {
+		for _, column := range stats.Columns {
+			key := strings.ToLower(column.Name)
+			if _, ok := declared[key]; !ok && column.Numeric {
+				declared[key] = parquet.Double
+			}
+		}
+	}
+
+	types := make([]parquet.Type, len(header))
+	for i, name := range header {
+		types[i] = declared[strings.ToLower(name)]
+	}
+	types, err := exportColumnTypes(types, rows, indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	names := dataschema.UniqueNames(header)
+	columns := make([]parquet.Column, len(header))
+	for i := range header {
+		columns[i] = parquet.Column{Name: names[i], Type: types[i]}
+	}
+	return columns, nil
+}
+
+// exportCandidates are the types a column declared as t may be exported as, narrowest first
+func exportCandidates(t parquet.Type) []parquet.Type {
+	switch t {
+	case parquet.Int64, parquet.Double:
+		return []parquet.Type{parquet.Int64, parquet.Double}
+	case parquet.Bool:
+		return []parquet.Type{parquet.Bool}
+	}
+	return nil
+}
+
+// exportColumnTypes narrows each declared type to one every value in its column satisfies:
+// numeric columns become Int64 when all values are integers, and anything that doesn't
+// parse falls back to String. When any column declares a type the rows are read through
+// once, holding only which types still fit, and rewound for the export
+func exportColumnTypes(declared []parquet.Type, rows *datasetRows, indexes []int) ([]parquet.Type, error) {
+	candidates := make([][]parquet.Type, len(declared))
+	fits := make([][]bool, len(declared))
+	typed := false
+	for i, t := range declared {
+		candidates[i] = exportCandidates(t)
+		fits[i] = make([]bool, len(candidates[i]))
+		for j := range fits[i] {
+			fits[i][j] = true
+		}
+		typed = typed || len(candidates[i]) > 0
+	}
+
+	if typed {
+		for {
+			record, err := rows.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			record = keepColumns(record, indexes)
+			for i := range candidates {
+				cell := ""
+				if i < len(record) {
+					cell = record[i]
+				}
+				for j, t := range candidates[i] {
+					if fits[i][j] {
+						_, fits[i][j] = parquet.ParseValue(t, cell)
+					}
+				}
+			}
+		}
+		if err := rows.Rewind(); err != nil {
+			return nil, err
+		}
+	}
+
+	types := make([]parquet.Type, len(declared))
+	for i := range types {
+		types[i] = parquet.String
+		if j := slices.Index(fits[i], true); j >= 0 {
+			types[i] = candidates[i][j]
+		}
+	}
+	return types, nil
+}
+
+// exportFilename derives a safe download filename from the dataset name
+func exportFilename(name string, datasetID uint64, format string) string {
+	base := strings.Trim(unsafeFilenameChars.ReplaceAllString(strings.TrimSpace(name), "-"), "-.")
+	if base == "" {
+		base = fmt.Sprintf("dataset-%d", datasetID)
+	}
+	return base + "." + format
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/gin-gonic/gin"
+	parquetgo "github.com/parquet-go/parquet-go"
+)
+
+// exportRequest is an export of the owner's dataset 0 in format, signed by the owner
+func (h *testHandler) exportRequest(t *testing.T, dataHash string, format string) *http.Request {
+	t.Helper()
+	owner := addressOf(t, testOwnerKey)
+	datasetID := uint64(0)
+	return jsonRequest(t, http.MethodPost, "/data/export", models.ExportDataRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: owner, Format: format,
+		DataAccessProof: h.signProof(t, owner, testOwnerKey),
+	})
+}
+
+// heapWatcher is a ResponseWriter that counts and discards the body, sampling the live heap
+// each time another sampleEvery bytes have been written
+type heapWatcher struct {
+	header      http.Header
+	status      int
+	written     int
+	lines       int
+	last        []byte // The last line written
+	partial     []byte // The line being written
+	sampleEvery int
+	nextSample  int
+	peakHeap    uint64
+}
+
+func (w *heapWatcher) Header() http.Header    { return w.header }
+func (w *heapWatcher) WriteHeader(status int) { w.status = status }
+
+func (w *heapWatcher) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written += len(p)
+	for _, chunk := range bytes.SplitAfter(p, []byte("\n")) {
+		w.partial = append(w.partial, chunk...)
+		if bytes.HasSuffix(chunk, []byte("\n")) {
+			w.lines++
+			w.last = append(w.last[:0], bytes.TrimSuffix(w.partial, []byte("\n"))...)
+			w.partial = w.partial[:0]
+		}
+	}
+	if w.written >= w.nextSample {
+		w.nextSample = w.written + w.sampleEvery
+		w.peakHeap = max(w.peakHeap, liveHeap())
+	}
+	return len(p), nil
+}
+
+// liveHeap is the heap still in use after a collection
+func liveHeap() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// largeTestCSV is a canonical CSV of id, name, score and active columns about size bytes long,
+// returned with its number of rows
+func largeTestCSV(size int) (string, int) {
+	var text strings.Builder
+	text.WriteString("id,name,score,active\n")
+	rows := 0
+	for text.Len() < size {
+		rows++
+		fmt.Fprintf(&text, "%d,row-%d,%d.5,%t\n", rows, rows, rows%1000, rows%2 == 0)
+	}
+	return text.String(), rows
+}
+
+// parquetRowGroupAllowance is the heap a Parquet export may hold for its row group buffers,
+// measured at about 4.4MB from 4MB to 32MB exports
+const parquetRowGroupAllowance = 6 << 20
+
+func TestExportStreamsLargeDatasetsInFlatMemory(t *testing.T) {
+	const size = 8 << 20
+	for _, format := range []string{"jsonl", "csv", "parquet"} {
+		for _, encrypted := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s encrypted=%t", format, encrypted), func(t *testing.T) {
+				if encrypted {
+					masterKey := config.AppConfig.EncryptionMasterKey
+					config.AppConfig.EncryptionMasterKey = strings.Repeat("ab", 32)
+					t.Cleanup(func() { config.AppConfig.EncryptionMasterKey = masterKey })
+				}
+				h := newTestHandler(t)
+				dataHash, rows := h.storeLargeDataset(t, size, encrypted)
+				request := h.exportRequest(t, dataHash, format)
+				router := gin.New()
+				router.POST("/data/export", h.ExportData)
+
+				baseline := liveHeap()
+				watcher := &heapWatcher{header: make(http.Header), sampleEvery: 256 << 10}
+				router.ServeHTTP(watcher, request)
+
+				if watcher.status != http.StatusOK || watcher.header.Get("Content-Type") != exportContentTypes[format] {
+					t.Fatalf("export = %d %s", watcher.status, watcher.header.Get("Content-Type"))
+				}
+				switch format {
+				case "jsonl":
+					if watcher.lines != rows {
+						t.Fatalf("%d lines exported, want %d", watcher.lines, rows)
+					}
+					var last map[string]interface{}
+					if err := json.Unmarshal(watcher.last, &last); err != nil || last["id"] != float64(rows) || last["name"] != fmt.Sprintf("row-%d", rows) {
+						t.Errorf("last line %s, want row %d", watcher.last, rows)
+					}
+				case "csv":
+					if watcher.lines != rows+1 || !bytes.HasPrefix(watcher.last, []byte(fmt.Sprintf("%d,row-%d,", rows, rows))) {
+						t.Fatalf("%d lines exported ending %q, want %d ending with row %d", watcher.lines, watcher.last, rows+1, rows)
+					}
+				case "parquet":
+					// Statistics find score numeric, so the blob is read once to type it
+					if watcher.written == 0 {
+						t.Fatal("nothing exported")
+					}
+				}
+				// Holding the parsed rows would take several times the dataset's size. The
+				// Parquet writer also buffers a row group, a few MB however long the export
+				allowance := int64(size / 8)
+				if format == "parquet" {
+					allowance += parquetRowGroupAllowance
+				}
+				if growth := int64(watcher.peakHeap) - int64(baseline); growth > allowance {
+					t.Errorf("heap grew by %d bytes exporting %d bytes, want it flat", growth, size)
+				}
+			})
+		}
+	}
+}
+
+// storeLargeDataset registers a dataset of about size bytes for the owner, sealed when
+// encrypted, and returns its data hash and number of rows. Only the count outlives the call,
+// so the heap measured afterwards doesn't hold the dataset
+func (h *testHandler) storeLargeDataset(t *testing.T, size int, encrypted bool) (string, int) {
+	t.Helper()
+	csvText, rows := largeTestCSV(size)
+	if !encrypted {
+		return h.storeTestDataset(t, testOwnerKey, csvText, "large"), rows
+	}
+
+	owner := addressOf(t, testOwnerKey)
+	status, response := h.submitCSV(t, h.signedUploadFields(t, owner, testOwnerKey), csvText)
+	if status != http.StatusOK {
+		t.Fatalf("upload = %d %s", status, response.Error)
+	}
+	sum := sha256.Sum256([]byte(csvText))
+	dataHash := "0x" + hex.EncodeToString(sum[:])
+	manifest, _ := h.storage.RetrieveManifest(owner)
+	if !strings.HasSuffix(manifest[dataHash].BlobName, ".enc") {
+		t.Fatalf("manifest = %v, want a sealed blob", manifest)
+	}
+	h.submitTestDataset(t, testOwnerKey, dataHash, "large")
+	return dataHash, rows
+}
+
+func TestExportJSONLStreamsBlobsThatHashToTheDataset(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	sum := sha256.Sum256([]byte(testCSV))
+	dataHash := "0x" + hex.EncodeToString(sum[:])
+	h.submitTestDataset(t, testOwnerKey, dataHash, "legacy")
+
+	// A timestamp-named blob doesn't prove its content by name, so it is hashed first
+	blobName := h.writeTestBlob(t, owner+"/1700000000_"+hex.EncodeToString(sum[:])+".csv", testCSV)
+	if err := h.storage.UpdateManifest(owner, dataHash, models.BlobManifestEntry{BlobName: blobName}); err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+	recorder := serve(http.MethodPost, "/data/export", h.ExportData, h.exportRequest(t, dataHash, "jsonl"))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("export = %d %s", recorder.Code, recorder.Body.String())
+	}
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 4 || records[0]["id"] != float64(1) || records[3]["name"] != "delta" {
+		t.Errorf("exported %v, want the four rows with ids coerced to numbers", records)
+	}
+
+	// Once altered, the blob isn't streamed and the export refuses it
+	h.writeTestBlob(t, blobName, strings.Replace(testCSV, "alpha", "ALTERED", 1))
+	recorder = serve(http.MethodPost, "/data/export", h.ExportData, h.exportRequest(t, dataHash, "jsonl"))
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusConflict || response.Code != models.ErrCodeIntegrityMismatch {
+		t.Errorf("export of an altered blob = %d %q, want 409 %s", recorder.Code, response.Code, models.ErrCodeIntegrityMismatch)
+	}
+}
+
+// readParquet reads an exported Parquet file back with parquet-go, returning its column
+// names and physical types and its rows as Go values, nil for nulls
+func readParquet(t *testing.T, file []byte) ([]string, []string, [][]interface{}) {
+	t.Helper()
+	f, err := parquetgo.OpenFile(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	var names, types []string
+	for _, field := range f.Schema().Fields() {
+		names = append(names, field.Name())
+		types = append(types, field.Type().Kind().String())
+	}
+	reader := parquetgo.NewReader(f)
+	defer reader.Close()
+	buffer := make([]parquetgo.Row, f.NumRows()+1)
+	n, err := reader.ReadRows(buffer)
+	if err != nil && err != io.EOF {
+		t.Fatalf("ReadRows: %v", err)
+	}
+	var rows [][]interface{}
+	for _, row := range buffer[:n] {
+		values := make([]interface{}, len(row))
+		for i, value := range row {
+			switch {
+			case value.IsNull():
+			case value.Kind() == parquetgo.Int64:
+				values[i] = value.Int64()
+			case value.Kind() == parquetgo.Double:
+				values[i] = value.Double()
+			case value.Kind() == parquetgo.Boolean:
+				values[i] = value.Boolean()
+			default:
+				values[i] = value.String()
+			}
+		}
+		rows = append(rows, values)
+	}
+	return names, types, rows
+}
+
+func TestExportParquetTypesColumnsTheirValuesFit(t *testing.T) {
+	const csvText = "id,name,score,active,note,name\n1,alpha,2.5,true,,a\n2,,x,false,,b\n3,gamma,,yes,,c\n"
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	sum := sha256.Sum256([]byte(csvText))
+	dataHash := "0x" + hex.EncodeToString(sum[:])
+	if _, err := h.storage.StoreCSVStream(owner, dataHash, strings.NewReader(csvText)); err != nil {
+		t.Fatalf("StoreCSVStream: %v", err)
+	}
+	h.submitTestDatasetMetadata(t, testOwnerKey, dataHash, `{"name":"typed","schema":[{"name":"id","type":"integer"},`+
+		`{"name":"score","type":"number"},{"name":"active","type":"boolean"},{"name":"note","type":"number"}]}`)
+
+	recorder := serve(http.MethodPost, "/data/export", h.ExportData, h.exportRequest(t, dataHash, "parquet"))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != contentTypeParquet {
+		t.Fatalf("export = %d %s", recorder.Code, recorder.Body.String())
+	}
+	names, types, rows := readParquet(t, recorder.Body.Bytes())
+
+	// score holds a word and active a "yes", so both fall back to strings; the all-empty
+	// note keeps its declared type with only nulls
+	if want := []string{"id", "name", "score", "active", "note", "name_2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("columns %v, want %v", names, want)
+	}
+	if want := []string{"INT64", "BYTE_ARRAY", "BYTE_ARRAY", "BYTE_ARRAY", "INT64", "BYTE_ARRAY"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("types %v, want %v", types, want)
+	}
+	want := [][]interface{}{
+		{int64(1), "alpha", "2.5", "true", nil, "a"},
+		{int64(2), nil, "x", "false", nil, "b"},
+		{int64(3), "gamma", nil, "yes", nil, "c"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows %v, want %v", rows, want)
+	}
+}
@@ -1,15 +1,25 @@
 package handlers
 
 import (
-	"encoding/csv"
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/datax/backend/config"
 	"github.com/datax/backend/models"
+	dataschema "github.com/datax/backend/schema"
 	"github.com/datax/backend/services"
 	"github.com/gin-gonic/gin"
 )
@@ -17,12 +27,25 @@ import (
 type Handler struct {
 	aptosService   services.AptosService
 	storageService services.StorageService
+	walletAuth     *services.WalletAuthService
+	webhooks       *services.WebhookService
+	accessRequests services.AccessRequestRepository
+	accessTokens   *services.AccessTokenService
+	auditLog       *services.AuditLog
+	rewards        *services.RewardService // nil unless REWARDS_ENABLED
+	apiSpec        []byte                  // OpenAPI document, set once the routes are registered
 }
 
-func NewHandler(aptosService services.AptosService, storageService services.StorageService) *Handler {
+func NewHandler(aptosService services.AptosService, storageService services.StorageService, walletAuth *services.WalletAuthService, webhooks *services.WebhookService, accessRequests services.AccessRequestRepository, accessTokens *services.AccessTokenService, auditLog *services.AuditLog, rewards *services.RewardService) *Handler {
 	return &Handler{
 		aptosService:   aptosService,
 		storageService: storageService,
+		walletAuth:     walletAuth,
+		webhooks:       webhooks,
+		accessRequests: accessRequests,
+		accessTokens:   accessTokens,
+		auditLog:       auditLog,
+		rewards:        rewards,
 	}
 }
 
@@ -33,11 +56,7 @@ func NewHandler(aptosService services.AptosService, storageService services.Stor
 // This endpoint is kept for backward compatibility but returns a message
 func (h *Handler) InitializeUser(c *gin.Context) {
 	var req models.InitializeUserRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+	if !bindAndValidate(c, &req) {
 		return
 	}
 
@@ -54,20 +73,23 @@ func (h *Handler) InitializeUser(c *gin.Context) {
 	})
 }
 
-// CheckDataHash checks if a data hash already exists
+// CheckDataHash checks if a data hash is already registered, by anyone or only by owner,
+// and returns the matching datasets so the client can link to them
 func (h *Handler) CheckDataHash(c *gin.Context) {
-	var req struct {
-		DataHash string `json:"data_hash" binding:"required"`
+	var req models.CheckDataHashRequest
+	if !bindAndValidate(c, &req) {
+		return
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+
+	if services.NormalizeDataHash(req.DataHash) == "" {
 		c.JSON(http.StatusBadRequest, models.Response{
 			Success: false,
-			Error:   err.Error(),
+			Error:   "data_hash must be a hex digest",
 		})
 		return
 	}
 
-	exists, err := h.aptosService.CheckDataHashExists(req.DataHash)
+	datasets, err := h.aptosService.FindDatasetsByDataHash(c.Request.Context(), req.DataHash, req.Owner)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
@@ -78,23 +100,64 @@ func (h *Handler) CheckDataHash(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
-		Data:    exists,
+		Data: map[string]interface{}{
+			"data_hash": services.NormalizeDataHash(req.DataHash),
+			"exists":    len(datasets) > 0,
+			"datasets":  datasets,
+		},
 	})
 }
 
 // DeleteDataset deletes a dataset
 func (h *Handler) DeleteDataset(c *gin.Context) {
 	var req models.DeleteDatasetRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	txHash, err := h.aptosService.DeleteDataset(req.PrivateKey, *req.DatasetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	txHash, err := h.aptosService.DeleteDataset(req.PrivateKey, req.DatasetID)
-	if err != nil {
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.TransactionResponse{
+			Hash:    txHash,
+			Success: true,
+			Message: "Dataset deleted successfully",
+		},
+	})
+}
+
+// ReactivateDataset undoes a deletion, making the dataset active again
+func (h *Handler) ReactivateDataset(c *gin.Context) {
+	var req models.ReactivateDatasetRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	txHash, err := h.aptosService.ReactivateDataset(req.PrivateKey, *req.DatasetID)
+	switch {
+	case errors.Is(err, services.ErrDatasetNotReactivatable):
+		c.JSON(http.StatusGone, models.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ErrCodeNotReactivatable,
+		})
+		return
+	case errors.Is(err, services.ErrDatasetAlreadyActive):
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ErrCodeDatasetActive,
+		})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
 			Error:   err.Error(),
@@ -107,7 +170,7 @@ func (h *Handler) DeleteDataset(c *gin.Context) {
 		Data: models.TransactionResponse{
 			Hash:    txHash,
 			Success: true,
-			Message: "Dataset deleted successfully",
+			Message: "Dataset reactivated successfully",
 		},
 	})
 }
@@ -115,15 +178,66 @@ func (h *Handler) DeleteDataset(c *gin.Context) {
 // GrantAccess grants access to a requester
 func (h *Handler) GrantAccess(c *gin.Context) {
 	var req models.GrantAccessRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+	if !bindAndValidate(c, &req) {
 		return
 	}
 
-	txHash, err := h.aptosService.GrantAccess(req.PrivateKey, req.DatasetID, req.Requester, req.ExpiresAt)
+	// Check the requester's key before the grant goes on chain, so a bad key fails cleanly
+	var recipient *ecdh.PublicKey
+	if req.RequesterPublicKey != "" {
+		key, err := services.ParseRecipientKey(req.RequesterPublicKey, req.RequesterKeyType)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("Invalid requester_public_key: %v", err),
+			})
+			return
+		}
+		recipient = key
+	}
+
+	// A column restriction is written before the grant goes on chain, so the requester never
+	// has full access in between. A grant without columns lifts an earlier restriction
+	columns := grantColumns(req.Columns)
+	owner, ownerErr := services.AddressFromPrivateKey(req.PrivateKey)
+	if len(columns) > 0 {
+		if recipient != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   "columns can't be combined with requester_public_key: the data key decrypts every column",
+			})
+			return
+		}
+		if ownerErr != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("Invalid private_key: %v", ownerErr),
+			})
+			return
+		}
+		if err := h.storeColumnGrant(owner, *req.DatasetID, req.Requester, columns); err != nil {
+			fmt.Printf("ERROR: Failed to store column grant of dataset %d for %s: %v\n", *req.DatasetID, req.Requester, err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to record the granted columns, nothing was granted: %v", err),
+			})
+			return
+		}
+		// A key wrapped by an earlier, unrestricted grant would still decrypt every column
+		if keyStore, ok := h.storageService.(services.GranteeKeyStore); ok {
+			if err := keyStore.DeleteGranteeKey(owner, *req.DatasetID, req.Requester); err != nil {
+				fmt.Printf("ERROR: Failed to delete wrapped key of dataset %d for %s: %v\n", *req.DatasetID, req.Requester, err)
+			}
+		}
+	}
+
+	// The module treats expires_at as a deadline, so 0 (no expiry) is sent as the latest one
+	expiresAt := *req.ExpiresAt
+	if expiresAt == 0 {
+		expiresAt = math.MaxUint64
+	}
+
+	txHash, err := h.aptosService.GrantAccess(req.PrivateKey, *req.DatasetID, req.Requester, expiresAt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
@@ -132,12 +246,41 @@ func (h *Handler) GrantAccess(c *gin.Context) {
 		return
 	}
 
+	// The grant is on chain either way; a key that couldn't be wrapped is reported, not fatal
+	message := "Access granted successfully"
+	if recipient != nil {
+		if err := h.wrapKeyForGrantee(req.PrivateKey, *req.DatasetID, req.Requester, recipient); err != nil {
+			fmt.Printf("ERROR: Failed to wrap data key of dataset %d for %s: %v\n", *req.DatasetID, req.Requester, err)
+			message = fmt.Sprintf("Access granted, but the data key could not be wrapped for the requester: %v", err)
+		}
+	}
+
+	if len(columns) == 0 && ownerErr == nil {
+		if err := h.deleteColumnGrant(owner, *req.DatasetID, req.Requester); err != nil {
+			fmt.Printf("ERROR: Failed to lift column grant of dataset %d for %s: %v\n", *req.DatasetID, req.Requester, err)
+			message = fmt.Sprintf("Access granted, but an earlier column restriction could not be lifted: %v", err)
+		}
+	}
+
+	if ownerErr == nil {
+		payload := map[string]interface{}{
+			"dataset_id":       *req.DatasetID,
+			"requester":        req.Requester,
+			"expires_at":       expiresAt,
+			"transaction_hash": txHash,
+		}
+		if len(columns) > 0 {
+			payload["columns"] = columns
+		}
+		h.webhooks.Notify(owner, models.WebhookEventAccessGranted, payload)
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
 		Data: models.TransactionResponse{
 			Hash:    txHash,
 			Success: true,
-			Message: "Access granted successfully",
+			Message: message,
 		},
 	})
 }
@@ -145,15 +288,11 @@ func (h *Handler) GrantAccess(c *gin.Context) {
 // RevokeAccess revokes access from a requester
 func (h *Handler) RevokeAccess(c *gin.Context) {
 	var req models.RevokeAccessRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+	if !bindAndValidate(c, &req) {
 		return
 	}
 
-	txHash, err := h.aptosService.RevokeAccess(req.PrivateKey, req.DatasetID, req.Requester)
+	txHash, err := h.aptosService.RevokeAccess(req.PrivateKey, *req.DatasetID, req.Requester)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
@@ -162,6 +301,33 @@ func (h *Handler) RevokeAccess(c *gin.Context) {
 		return
 	}
 
+	owner, ownerErr := services.AddressFromPrivateKey(req.PrivateKey)
+
+	// Access tokens handed out for the grant stop working now rather than when they expire
+	if ownerErr == nil {
+		if err := h.accessTokens.Revoke(owner, *req.DatasetID, req.Requester); err != nil {
+			fmt.Printf("ERROR: Failed to revoke access tokens of dataset %d for %s: %v\n", *req.DatasetID, req.Requester, err)
+		}
+	}
+
+	// A key the requester already fetched can't be recalled, but it isn't handed out again
+	if keyStore, ok := h.storageService.(services.GranteeKeyStore); ok {
+		err := ownerErr
+		if err == nil {
+			err = keyStore.DeleteGranteeKey(owner, *req.DatasetID, req.Requester)
+		}
+		if err != nil {
+			fmt.Printf("ERROR: Failed to delete wrapped key of dataset %d for %s: %v\n", *req.DatasetID, req.Requester, err)
+		}
+	}
+
+	// A later grant starts from every column unless it names some again
+	if ownerErr == nil {
+		if err := h.deleteColumnGrant(owner, *req.DatasetID, req.Requester); err != nil {
+			fmt.Printf("ERROR: Failed to delete column grant of dataset %d for %s: %v\n", *req.DatasetID, req.Requester, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
 		Data: models.TransactionResponse{
@@ -172,18 +338,134 @@ func (h *Handler) RevokeAccess(c *gin.Context) {
 	})
 }
 
-// CheckAccess checks if a requester has access
+// CheckAccess checks if a requester has access, telling an expired grant apart from none
 func (h *Handler) CheckAccess(c *gin.Context) {
 	var req models.CheckAccessRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	owner, _ := services.NormalizeAddress(req.Owner)
+	requester, _ := services.NormalizeAddress(req.Requester)
+	if owner == requester {
+		c.JSON(http.StatusOK, models.Response{
+			Success: true,
+			Data:    models.AccessInfo{HasAccess: true},
+		})
+		return
+	}
+
+	grant, err := h.aptosService.GetAccessGrant(owner, *req.DatasetID, requester)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// No grant means it was never made or has been revoked
+	var info models.AccessInfo
+	if grant != nil {
+		info = models.AccessInfo{HasAccess: !grant.Expired, ExpiresAt: grant.ExpiresAt, Expired: grant.Expired}
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    info,
+	})
+}
+
+// ListAllGrants returns every grant an owner has issued across their datasets, sorted by
+// dataset then requester, optionally only one requester's and only active or expired ones
+func (h *Handler) ListAllGrants(c *gin.Context) {
+	var req models.ListAllGrantsRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	owner, _ := services.NormalizeAddress(req.Owner)
+	requester := ""
+	if req.Requester != "" {
+		requester, _ = services.NormalizeAddress(req.Requester)
+	}
+
+	grants, err := h.aptosService.GetAllGrantsByOwner(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	hasAccess, err := h.aptosService.CheckAccess(req.Owner, req.DatasetID, req.Requester)
+	// The chain doesn't record when a grant was made; approved access requests do
+	type grantKey struct {
+		requester string
+		datasetID uint64
+	}
+	approvedAt := make(map[grantKey]string)
+	stored, err := h.accessRequests.ListByOwner(owner)
+	if err != nil {
+		fmt.Printf("WARNING: Failed to load access requests for %s's grants: %v\n", owner, err)
+	}
+	for _, r := range stored {
+		if r.ApprovedAt != "" {
+			approvedAt[grantKey{r.RequesterAddress, r.DatasetID}] = r.ApprovedAt
+		}
+	}
+
+	filtered := make([]models.AccessGrant, 0, len(grants))
+	for _, grant := range grants {
+		if requester != "" && grant.Requester != requester {
+			continue
+		}
+		if (req.Status == "active" && grant.Expired) || (req.Status == "expired" && !grant.Expired) {
+			continue
+		}
+		grant.GrantedAt = approvedAt[grantKey{grant.Requester, grant.DatasetID}]
+		filtered = append(filtered, grant)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    filtered,
+	})
+}
+
+const (
+	defaultAccessiblePageSize = 20
+	maxAccessiblePageSize     = 100
+)
+
+// ListAccessibleDatasets returns a page of the datasets a requester currently has access
+// to, with the grant's expiry and whether the CSV can be fetched from storage
+func (h *Handler) ListAccessibleDatasets(c *gin.Context) {
+	var req models.AccessibleDatasetsRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	requester, _ := services.NormalizeAddress(req.Requester)
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultAccessiblePageSize
+	}
+	if limit > maxAccessiblePageSize {
+		limit = maxAccessiblePageSize
+	}
+
+	// Without the event index, grants made through access requests are still found
+	var known []models.DatasetRef
+	stored, err := h.accessRequests.ListByRequester(requester)
+	if err != nil {
+		fmt.Printf("WARNING: Failed to load access requests of %s: %v\n", requester, err)
+	}
+	for _, r := range stored {
+		if r.Status == services.AccessRequestApproved || r.Status == services.AccessRequestPaid {
+			known = append(known, models.DatasetRef{Owner: r.OwnerAddress, DatasetID: r.DatasetID})
+		}
+	}
+
+	datasets, err := h.aptosService.GetAccessibleDatasets(requester, known)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
@@ -192,11 +474,29 @@ func (h *Handler) CheckAccess(c *gin.Context) {
 		return
 	}
 
+	page := models.AccessibleDatasetsPage{Total: len(datasets), Offset: req.Offset, Limit: limit}
+	if req.Offset < len(datasets) {
+		datasets = datasets[req.Offset:]
+	} else {
+		datasets = datasets[:0]
+	}
+	if limit < len(datasets) {
+		datasets = datasets[:limit]
+	}
+
+	// The list may be cached, so copy the page before filling in storage state
+	page.Datasets = make([]models.AccessibleDataset, len(datasets))
+	for i, dataset := range datasets {
+		if h.storageService != nil {
+			blobName, err := h.findBlobByDataHash(dataset.Owner, dataset.DataHash)
+			dataset.BlobAvailable = err == nil && blobName != ""
+		}
+		page.Datasets[i] = dataset
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
-		Data: models.AccessInfo{
-			HasAccess: hasAccess,
-		},
+		Data:    page,
 	})
 }
 
@@ -204,11 +504,7 @@ func (h *Handler) CheckAccess(c *gin.Context) {
 func (h *Handler) GetDataset(c *gin.Context) {
 	// First, try to bind to a map to handle flexible types
 	var rawBody map[string]interface{}
-	if err := c.ShouldBindJSON(&rawBody); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   fmt.Sprintf("Invalid JSON: %v", err),
-		})
+	if !bindAndValidate(c, &rawBody) {
 		return
 	}
 
@@ -258,19 +554,7 @@ func (h *Handler) GetDataset(c *gin.Context) {
 		return
 	}
 
-	if datasetID == 0 {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   "dataset_id must be greater than 0",
-		})
-		return
-	}
-
-	var req models.GetDatasetRequest
-	req.User = user
-	req.DatasetID = datasetID
-
-	datasetRaw, err := h.aptosService.GetDataset(req.User, req.DatasetID)
+	dataset, err := h.loadDataset(user, datasetID)
 	if err != nil {
 		fmt.Printf("ERROR: GetDataset failed: %v\n", err)
 		c.JSON(http.StatusInternalServerError, models.Response{
@@ -280,78 +564,59 @@ func (h *Handler) GetDataset(c *gin.Context) {
 		return
 	}
 
-	// Convert the raw result to DatasetInfo format
-	datasetMap, ok := datasetRaw.(map[string]interface{})
-	if !ok {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Success: false,
-			Error:   "unexpected dataset format",
-		})
-		return
-	}
-
-	// The service now returns data_hash as hex string and metadata as string
-	dataHashHex, _ := datasetMap["data_hash"].(string)
-	metadataStr, _ := datasetMap["metadata"].(string)
-
-	var createdAt uint64
-	switch v := datasetMap["created_at"].(type) {
-	case float64:
-		createdAt = uint64(v)
-	case uint64:
-		createdAt = v
-	case string:
-		parsed, _ := strconv.ParseUint(v, 10, 64)
-		createdAt = parsed
-	}
-
-	isActive, _ := datasetMap["is_active"].(bool)
-
-	dataset := models.DatasetInfo{
-		ID:        req.DatasetID,
-		Owner:     req.User,
-		DataHash:  dataHashHex,
-		Metadata:  metadataStr,
-		CreatedAt: createdAt,
-		IsActive:  isActive,
-	}
-
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
 		Data:    dataset,
 	})
 }
 
+// loadDataset reads a dataset's on-chain record, lifting the documented metadata fields
+// to the top level
+func (h *Handler) loadDataset(user string, datasetID uint64) (models.DatasetInfo, error) {
+	datasetRaw, err := h.aptosService.GetDataset(user, datasetID)
+	if err != nil {
+		return models.DatasetInfo{}, err
+	}
+
+	return services.DatasetInfoFromView(user, datasetID, datasetRaw)
+}
+
 // GetMarketplaceDatasets retrieves all datasets from the marketplace
+// Optional query parameters:
+//   - q: keyword search, results ranked by relevance
+//   - owner: only datasets from this owner address
+//   - created_after / created_before: unix timestamp range (inclusive)
+//   - include_inactive: also return deleted datasets
+//   - category: metadata category ("uncategorized" for datasets without one)
+//   - tags: comma-separated metadata tags; datasets must carry all of them
+//   - limit / cursor: page through results
+//   - envelope: return an object with the datasets under "datasets" plus summary
+//     metadata (total_datasets, unique_owners, last_refreshed_at, source)
+//
+// Paginated requests always get the envelope; otherwise a bare array is returned
+// until the frontend migrates to envelope=true
+//
+// Responses carry an ETag; pollers sending it back in If-None-Match get 304 Not Modified
+// while the listing is unchanged
 func (h *Handler) GetMarketplaceDatasets(c *gin.Context) {
 	fmt.Printf("DEBUG: GetMarketplaceDatasets endpoint called\n")
-	startTime := time.Now()
-
-	datasets, err := h.aptosService.GetMarketplaceDatasets()
-	elapsed := time.Since(startTime)
 
+	filter, err := parseMarketplaceFilter(c)
 	if err != nil {
-		fmt.Printf("ERROR: GetMarketplaceDatasets failed after %v: %v\n", elapsed, err)
-		c.JSON(http.StatusInternalServerError, models.Response{
+		c.JSON(http.StatusBadRequest, models.Response{
 			Success: false,
-			Error:   fmt.Sprintf("Failed to fetch marketplace datasets: %v", err),
+			Error:   err.Error(),
 		})
 		return
 	}
 
-	fmt.Printf("DEBUG: GetMarketplaceDatasets completed in %v, returning %d datasets\n", elapsed, len(datasets))
-	c.JSON(http.StatusOK, models.Response{
-		Success: true,
-		Data:    datasets,
-	})
-}
+	// Unpaginated requests keep returning a bare array for the existing frontend
+	envelope, _ := strconv.ParseBool(c.Query("envelope"))
+	startTime := time.Now()
+	response, err := h.aptosService.GetMarketplaceResponse(c.Request.Context(), filter, filter.Limit > 0 || envelope)
+	elapsed := time.Since(startTime)
 
-// GetAccessRequests retrieves access requests for a dataset owner
-func (h *Handler) GetAccessRequests(c *gin.Context) {
-	var req struct {
-		Owner string `json:"owner" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if errors.Is(err, services.ErrInvalidCursor) {
 		c.JSON(http.StatusBadRequest, models.Response{
 			Success: false,
 			Error:   err.Error(),
@@ -359,306 +624,1365 @@ func (h *Handler) GetAccessRequests(c *gin.Context) {
 		return
 	}
 
-	requests, err := h.aptosService.GetAccessRequests(req.Owner)
 	if err != nil {
+		fmt.Printf("ERROR: GetMarketplaceDatasets failed after %v: %v\n", elapsed, err)
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
-			Error:   err.Error(),
+			Error:   fmt.Sprintf("Failed to fetch marketplace datasets: %v", err),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, models.Response{
-		Success: true,
-		Data:    requests,
-	})
+	fmt.Printf("DEBUG: GetMarketplaceDatasets completed in %v, returning %d bytes\n", elapsed, len(response.Body))
+	writeWithETag(c, response)
 }
 
-// RequestAccess creates an access request
-func (h *Handler) RequestAccess(c *gin.Context) {
-	var req struct {
-		Owner     string `json:"owner" binding:"required"`
-		DatasetID uint64 `json:"dataset_id" binding:"required"`
-		Requester string `json:"requester" binding:"required"`
-		Message   string `json:"message"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
+// respondWithETag writes a 200 JSON response tagged with a hash of its body, or an empty
+// 304 Not Modified when the request's If-None-Match already carries that hash
+func respondWithETag(c *gin.Context, response models.Response) {
+	encoded, err := services.NewEncodedResponse(response)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
-			Error:   err.Error(),
+			Error:   fmt.Sprintf("Failed to encode response: %v", err),
 		})
 		return
 	}
-
-	services.RequestAccess(req.Owner, req.DatasetID, req.Requester, req.Message)
-
-	c.JSON(http.StatusOK, models.Response{
-		Success: true,
-		Message: "Access request submitted",
-	})
+	writeWithETag(c, encoded)
 }
 
-// RegisterUserForMarketplace allows users to manually register themselves
-// This is useful if they submitted data before the registry was set up
-func (h *Handler) RegisterUserForMarketplace(c *gin.Context) {
-	var req struct {
-		UserAddress string `json:"user_address" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+// writeWithETag writes an encoded 200 JSON response under its ETag, or an empty 304 Not
+// Modified when the request's If-None-Match already carries it
+func writeWithETag(c *gin.Context, response *services.EncodedResponse) {
+	c.Header("ETag", response.ETag)
+	c.Header("Cache-Control", "no-cache")
+
+	if etagMatches(c.GetHeader("If-None-Match"), response.ETag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	// User discovery is now automatic from the blockchain
-	// No registration needed - users are discovered by querying recent transactions
-	c.JSON(http.StatusOK, models.Response{
-		Success: true,
-		Message: "User discovery is automatic from the blockchain. No registration needed.",
-	})
+	c.Data(http.StatusOK, "application/json; charset=utf-8", response.Body)
 }
 
-// GetCSVData retrieves CSV data if user has access
-func (h *Handler) GetCSVData(c *gin.Context) {
-	fmt.Printf("DEBUG: GetCSVData endpoint called\n")
-	fmt.Printf("DEBUG: Request method: %s, Path: %s\n", c.Request.Method, c.Request.URL.Path)
+// etagMatches reports whether an If-None-Match header value matches the ETag
+// The header may list several tags, use "*", or mark tags weak (W/); anything
+// malformed simply doesn't match
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if len(candidate) < 2 || !strings.HasPrefix(candidate, `"`) || !strings.HasSuffix(candidate, `"`) {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Marketplace page size bounds
+const (
+	defaultMarketplacePageSize = 50
+	maxMarketplacePageSize     = 200
+)
 
-	var req struct {
-		DataHash  string `json:"data_hash" binding:"required"`
-		Owner     string `json:"owner" binding:"required"`
-		DatasetID uint64 `json:"dataset_id" binding:"required"`
-		Requester string `json:"requester" binding:"required"`
+// parseMarketplaceFilter reads the marketplace filter from query parameters
+func parseMarketplaceFilter(c *gin.Context) (models.MarketplaceFilter, error) {
+	filter := models.MarketplaceFilter{
+		Query:    strings.TrimSpace(c.Query("q")),
+		Owner:    strings.TrimSpace(c.Query("owner")),
+		Category: strings.TrimSpace(c.Query("category")),
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		fmt.Printf("ERROR: Failed to bind request: %v\n", err)
-		c.JSON(http.StatusBadRequest, models.Response{
+
+	// tags may be repeated (?tags=a&tags=b) or comma-separated (?tags=a,b)
+	for _, v := range c.QueryArray("tags") {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				filter.Tags = append(filter.Tags, tag)
+			}
+		}
+	}
+
+	if v := c.Query("created_after"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("created_after must be a unix timestamp: %v", err)
+		}
+		filter.CreatedAfter = parsed
+	}
+
+	if v := c.Query("created_before"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("created_before must be a unix timestamp: %v", err)
+		}
+		filter.CreatedBefore = parsed
+	}
+
+	if filter.CreatedAfter > 0 && filter.CreatedBefore > 0 && filter.CreatedAfter > filter.CreatedBefore {
+		return filter, fmt.Errorf("created_after must not be later than created_before")
+	}
+
+	if v := c.Query("include_inactive"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("include_inactive must be true or false")
+		}
+		filter.IncludeInactive = parsed
+	}
+
+	filter.Cursor = c.Query("cursor")
+	if v := c.Query("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxMarketplacePageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxMarketplacePageSize)
+		}
+		filter.Limit = parsed
+	} else if filter.Cursor != "" {
+		filter.Limit = defaultMarketplacePageSize
+	}
+
+	return filter, nil
+}
+
+// GetAccessRequests retrieves access requests for a dataset owner: those made through the
+// API, with their escrow status, and the AccessRequested events read from chain
+// Optional status filter: pending, approved, denied or paid
+func (h *Handler) GetAccessRequests(c *gin.Context) {
+	var req models.ListAccessRequestsRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	switch req.Status {
+	case "", services.AccessRequestPending, services.AccessRequestApproved, services.AccessRequestDenied, services.AccessRequestPaid:
+	default:
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "status must be one of: pending, approved, denied, paid",
+		})
+		return
+	}
+	owner, err := services.NormalizeAddress(req.Owner)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("invalid owner address: %v", err),
+		})
+		return
+	}
+
+	onChain, err := h.aptosService.GetAccessRequests(owner, req.Start, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	stored, err := h.accessRequests.ListByOwner(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	requests := mergeAccessRequests(stored, onChain)
+
+	if req.Status != "" {
+		filtered := make([]models.AccessRequest, 0, len(requests))
+		for _, r := range requests {
+			if r.Status == req.Status {
+				filtered = append(filtered, r)
+			}
+		}
+		requests = filtered
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    requests,
+	})
+}
+
+// RequestAccess creates an access request
+func (h *Handler) RequestAccess(c *gin.Context) {
+	var req models.RequestAccessRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	owner, errOwner := services.NormalizeAddress(req.Owner)
+	requester, errRequester := services.NormalizeAddress(req.Requester)
+	if errOwner != nil || errRequester != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "owner and requester must be valid account addresses",
+		})
+		return
+	}
+
+	request, err := h.accessRequests.Create(models.AccessRequest{
+		OwnerAddress:     owner,
+		RequesterAddress: requester,
+		DatasetID:        *req.DatasetID,
+		Message:          req.Message,
+		PriceAPT:         defaultAccessPriceAPT,
+	})
+	if err != nil {
+		fmt.Printf("ERROR: Failed to store access request: %v\n", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	h.webhooks.Notify(owner, models.WebhookEventAccessRequested, map[string]interface{}{
+		"dataset_id": *req.DatasetID,
+		"requester":  requester,
+		"message":    req.Message,
+	})
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "Access request submitted",
+		Data:    request,
+	})
+}
+
+// RegisterUserForMarketplace allows users to manually register themselves
+// This is useful if they submitted data before the registry was set up
+func (h *Handler) RegisterUserForMarketplace(c *gin.Context) {
+	var req models.RegisterMarketplaceUserRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	// User discovery is now automatic from the blockchain
+	// No registration needed - users are discovered by querying recent transactions
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "User discovery is automatic from the blockchain. No registration needed.",
+	})
+}
+
+// GetCSVData retrieves CSV data if user has access
+func (h *Handler) GetCSVData(c *gin.Context) {
+	fmt.Printf("DEBUG: GetCSVData endpoint called\n")
+	fmt.Printf("DEBUG: Request method: %s, Path: %s\n", c.Request.Method, c.Request.URL.Path)
+
+	var req models.GetCSVDataRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	h.respondCSVData(c, req)
+}
+
+// respondCSVData checks the requester's access and writes the dataset's rows as GetCSVData
+// describes; shared by the v1 POST and v2 GET routes
+func (h *Handler) respondCSVData(c *gin.Context, req models.GetCSVDataRequest) {
+	fmt.Printf("DEBUG: GetCSVData request - dataHash=%s, owner=%s, datasetID=%d, requester=%s\n", req.DataHash, req.Owner, *req.DatasetID, req.Requester)
+
+	if !h.authorizeDataAccess(c, req.Owner, *req.DatasetID, req.Requester, req.DataAccessProof) {
+		return
+	}
+	allowed, ok := h.allowedColumns(c, req.Owner, *req.DatasetID, req.Requester)
+	if !ok {
+		return
+	}
+
+	var csvData [][]string
+	switch h.decryptionMode(req.Owner, *req.DatasetID, req.DataHash, req.Decryption) {
+	case services.EncryptionModeClient:
+		if allowed != nil {
+			h.requireAllColumns(c, req.Owner, *req.DatasetID, req.Requester, "ask for it with decryption \"server\" or \"provided_key\"")
+			return
+		}
+		h.respondCiphertext(c, req.Owner, *req.DatasetID, req.DataHash)
+		h.recordAudit(c, req.Owner, *req.DatasetID, req.Requester, 0)
+		return
+	case decryptionProvidedKey:
+		csvData, ok = h.retrieveWithProvidedKey(c, req.Owner, *req.DatasetID, req.DataHash, req.DecryptionKey)
+	default:
+		csvData, _, ok = h.retrieveDatasetCSV(c, req.Owner, *req.DatasetID, req.DataHash)
+	}
+	if !ok {
+		return
+	}
+
+	if len(req.Columns) > 0 {
+		var missing []string
+		csvData, missing = projectCSV(csvData, req.Columns)
+		if len(missing) > 0 {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("Unknown columns: %s", strings.Join(missing, ", ")),
+				Data:    map[string]interface{}{"unknown_columns": missing},
+			})
+			return
+		}
+	}
+	// Columns asked for but not granted are dropped rather than refused
+	csvData, withheld := withholdColumns(csvData, allowed)
+	message := noteWithheldColumns(c, withheld)
+
+	// Without pagination the whole CSV is returned as before
+	if req.Offset == nil && req.Limit == nil {
+		var data interface{} = csvData
+		if req.Format == csvFormatRecords {
+			data = []dataschema.Record{}
+			if len(csvData) > 0 {
+				data = formatCSVRows(csvData[0], csvData[1:], req.Format)
+			}
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Success: true,
+			Message: message,
+			Data:    data,
+		})
+		h.recordAudit(c, req.Owner, *req.DatasetID, req.Requester, max(len(csvData)-1, 0))
+		return
+	}
+
+	page := paginateCSV(csvData, req.Offset, req.Limit, req.Format)
+	page.WithheldColumns = withheld
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: message,
+		Data:    page,
+	})
+	h.recordAudit(c, req.Owner, *req.DatasetID, req.Requester, max(min(page.Limit, page.TotalRows-page.Offset), 0))
+}
+
+// retrieveDatasetCSV loads a dataset's CSV from the blob its on-chain data hash resolves to, checks it
+// against the on-chain data hash, and returns the blob that was read. On failure it writes
+// the error response (404, or 409 for an integrity mismatch) and returns false
+func (h *Handler) retrieveDatasetCSV(c *gin.Context, owner string, datasetID uint64, dataHash string) ([][]string, string, bool) {
+	blobName, _, err := h.resolveDatasetBlob(owner, datasetID)
+	if err != nil {
+		respondBlobNotFound(c, dataHash, err)
+		return nil, "", false
+	}
+
+	csvData, err := h.storageService.RetrieveCSV(owner, blobName)
+	if errors.Is(err, services.ErrNotEnvelope) {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   "This dataset was encrypted by the client; request it with decryption \"client\" or \"provided_key\"",
+		})
+		return nil, "", false
+	}
+	if err != nil {
+		fmt.Printf("ERROR: Failed to retrieve %s: %v\n", blobName, err)
+		respondBlobNotFound(c, dataHash, err)
+		return nil, "", false
+	}
+	fmt.Printf("DEBUG: Successfully retrieved CSV from storage: %s\n", blobName)
+
+	if !h.verifyDatasetIntegrity(c, owner, datasetID, blobName, csvData) {
+		return nil, "", false
+	}
+
+	return csvData, blobName, true
+}
+
+// respondBlobNotFound writes the 404 for a dataset whose CSV can't be located. Serving some
+// other blob instead would hand the requester a different dataset's contents
+func respondBlobNotFound(c *gin.Context, dataHash string, err error) {
+	c.JSON(http.StatusNotFound, models.Response{
+		Success: false,
+		Error:   fmt.Sprintf("CSV data not found. Data hash: %s. Error: %v", dataHash, err),
+		Code:    models.ErrCodeBlobNotFound,
+	})
+}
+
+// authorizeDataAccess verifies the requester's wallet signature and that they own the
+// dataset or hold access to it, or instead an access token from an earlier read. Reads
+// proven with a signature get a fresh token back in X-Access-Token. It writes the error
+// response and returns false otherwise
+func (h *Handler) authorizeDataAccess(c *gin.Context, owner string, datasetID uint64, requester string, proof models.DataAccessProof) bool {
+	if proof.AccessToken != "" {
+		return h.verifyAccessToken(c, owner, datasetID, requester, proof.AccessToken)
+	}
+
+	// The requester must prove they control the address before it's trusted for access checks
+	if !h.verifyWalletSignature(c, requester, proof.WalletSignature()) {
+		return false
+	}
+
+	// Owners can always view their data
+	if requester == owner {
+		h.issueAccessToken(c, owner, datasetID, requester, 0)
+		return true
+	}
+
+	grant, err := h.aptosService.GetAccessGrant(owner, datasetID, requester)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return false
+	}
+
+	if grant == nil {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Access denied",
+		})
+		return false
+	}
+	if grant.Expired {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Access expired at %s", time.Unix(int64(grant.ExpiresAt), 0).UTC().Format(time.RFC3339)),
+			Code:    models.ErrCodeAccessExpired,
+		})
+		return false
+	}
+	h.issueAccessToken(c, owner, datasetID, requester, grant.ExpiresAt)
+	return true
+}
+
+// verifyAccessToken checks an access token presented instead of a wallet signature,
+// writing a 401 INVALID_ACCESS_TOKEN response when it doesn't hold
+func (h *Handler) verifyAccessToken(c *gin.Context, owner string, datasetID uint64, requester string, token string) bool {
+	err := h.accessTokens.Verify(token, owner, datasetID, requester)
+	if err == nil {
+		return true
+	}
+	fmt.Printf("DEBUG: Access token rejected for %s on dataset %d of %s: %v\n", requester, datasetID, owner, err)
+	c.JSON(http.StatusUnauthorized, models.Response{
+		Success: false,
+		Error:   err.Error() + "; sign a new challenge instead",
+		Code:    models.ErrCodeInvalidAccessToken,
+	})
+	return false
+}
+
+// issueAccessToken sets the X-Access-Token and X-Access-Token-Expires headers on a read
+// that passed the full check. A token that can't be issued only costs the next read a signature
+func (h *Handler) issueAccessToken(c *gin.Context, owner string, datasetID uint64, requester string, notAfter uint64) {
+	token, expiresAt, err := h.accessTokens.Issue(owner, datasetID, requester, notAfter)
+	if err != nil {
+		fmt.Printf("WARNING: Failed to issue access token for %s on dataset %d of %s: %v\n", requester, datasetID, owner, err)
+		return
+	}
+	c.Header(headerAccessToken, token)
+	c.Header(headerAccessTokenExpires, expiresAt.UTC().Format(time.RFC3339))
+}
+
+// Preview row limits
+const (
+	defaultPreviewRows = 20
+	maxPreviewRows     = 100
+)
+
+// PreviewCSVData returns the header and first rows of a dataset without transferring the
+// whole file. The same owner-or-access check as GetCSVData applies, and the blob is the one
+// the on-chain data hash resolves to, whatever data_hash the request carries
+func (h *Handler) PreviewCSVData(c *gin.Context) {
+	var req models.PreviewCSVRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultPreviewRows
+	}
+	if limit > maxPreviewRows {
+		limit = maxPreviewRows
+	}
+
+	if !h.authorizeDataAccess(c, req.Owner, *req.DatasetID, req.Requester, req.DataAccessProof) {
+		return
+	}
+	allowed, ok := h.allowedColumns(c, req.Owner, *req.DatasetID, req.Requester)
+	if !ok {
+		return
+	}
+
+	blobName, onChainHash, err := h.resolveDatasetBlob(req.Owner, *req.DatasetID)
+	if err != nil {
+		respondBlobNotFound(c, req.DataHash, err)
+		return
+	}
+	// Only the first rows are read, so the blob is checked against the dataset on its own
+	if !h.verifyBlobMatchesDataset(c, req.Owner, *req.DatasetID, blobName, onChainHash) {
+		return
+	}
+
+	records, err := h.storageService.PreviewCSV(req.Owner, blobName, limit)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to preview %s: %v\n", blobName, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to preview CSV data: %v", err),
+		})
+		return
+	}
+
+	preview := models.CSVPreview{Header: []string{}, Rows: [][]string{}}
+	if len(records) > 0 {
+		preview.Header = records[0]
+		preview.Rows = records[1:]
+	}
+	if len(preview.Rows) > limit {
+		preview.Rows = preview.Rows[:limit]
+		preview.HasMore = true
+	}
+	if len(records) > 0 {
+		var kept [][]string
+		kept, preview.WithheldColumns = withholdColumns(append([][]string{preview.Header}, preview.Rows...), allowed)
+		preview.Header, preview.Rows = kept[0], kept[1:]
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: noteWithheldColumns(c, preview.WithheldColumns),
+		Data:    preview,
+	})
+	h.recordAudit(c, req.Owner, *req.DatasetID, req.Requester, len(preview.Rows))
+}
+
+// GetUserVault retrieves user's vault datasets
+func (h *Handler) GetUserVault(c *gin.Context) {
+	var req models.GetUserVaultRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	datasets, err := h.aptosService.GetUserVault(c.Request.Context(), req.User)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.VaultInfo{
+			Datasets: datasets,
+			Count:    uint64(len(datasets)),
+		},
+	})
+}
+
+// GetUserDatasetsMetadata retrieves minimal metadata for all user datasets (optimized for batch operations)
+func (h *Handler) GetUserDatasetsMetadata(c *gin.Context) {
+	var req models.GetUserVaultRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	metadata, err := h.aptosService.GetUserDatasetsMetadata(req.User)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	for _, d := range metadata {
+		if datasetMap, ok := d.(map[string]interface{}); ok {
+			services.MarkReactivatable(datasetMap)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    metadata,
+	})
+}
+
+// CheckInitialization checks if the user account is initialized
+func (h *Handler) CheckInitialization(c *gin.Context) {
+	var req models.CheckInitializationRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	initialized, err := h.aptosService.IsAccountInitialized(req.User)
+	if err != nil {
+		// Never answer false on a failed check: the frontend would ask the user to initialize again
+		if errors.Is(err, services.ErrChainUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, models.Response{
+				Success: false,
+				Error:   err.Error(),
+				Code:    models.ErrCodeChainUnavailable,
+			})
+			return
+		}
+		c.JSON(http.StatusBadGateway, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.InitializationInfo{
+			Initialized: initialized,
+		},
+	})
+}
+
+// RegisterToken registers a user to receive tokens
+func (h *Handler) RegisterToken(c *gin.Context) {
+	var req models.RegisterTokenRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	txHash, err := h.aptosService.RegisterToken(req.PrivateKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.TransactionResponse{
+			Hash:    txHash,
+			Success: true,
+			Message: "Token registration successful",
+		},
+	})
+}
+
+// MintToken mints tokens to a recipient
+func (h *Handler) MintToken(c *gin.Context) {
+	var req models.MintTokenRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	// Only the minter's mint can succeed. Check before anything is submitted, so the sponsor
+	// never pays for a registration no mint follows
+	minter, err := h.aptosService.IsMintAuthority(req.PrivateKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("invalid private_key: %v", err),
+			Code:    models.ErrCodeValidationFailed,
+		})
+		return
+	}
+	if !minter {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "private_key is not the DataX token's mint authority",
+			Code:    models.ErrCodeNotMintAuthority,
+		})
+		return
+	}
+
+	// coin::deposit aborts for a recipient that hasn't registered, which reads as an opaque
+	// Move abort; check first so the caller is told what to do. A failed check doesn't block
+	// the mint, the chain still refuses unregistered recipients
+	var registerHash string
+	registered, err := h.aptosService.IsTokenRegistered(req.Recipient)
+	if err != nil {
+		fmt.Printf("WARNING: Failed to check token registration of %s, minting anyway: %v\n", req.Recipient, err)
+	} else if !registered {
+		if !req.AutoRegister {
+			respondRecipientNotRegistered(c, req.Recipient, "")
+			return
+		}
+		var ok bool
+		if registerHash, ok = h.registerRecipient(c, req); !ok {
+			return
+		}
+	}
+
+	txHash, err := h.aptosService.MintToken(req.PrivateKey, req.Recipient, req.Amount)
+	if errors.Is(err, services.ErrRecipientNotRegistered) {
+		respondRecipientNotRegistered(c, req.Recipient, "")
+		return
+	}
+	if err != nil && registerHash != "" {
+		// The registration stands, so a plain retry of the mint is all that's left
+		fmt.Printf("ERROR: Registered %s in %s but failed to mint: %v\n", req.Recipient, registerHash, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("recipient registered in %s, but minting failed: %v; retry the mint without auto_register", registerHash, err),
+			Data: models.MintTokenResponse{
+				RegisterHash: registerHash,
+				Success:      false,
+			},
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	fmt.Printf("DEBUG: GetCSVData request - dataHash=%s, owner=%s, datasetID=%d, requester=%s\n", req.DataHash, req.Owner, req.DatasetID, req.Requester)
+	message := "Tokens minted successfully"
+	if registerHash != "" {
+		message = "Recipient registered and tokens minted successfully"
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.MintTokenResponse{
+			Hash:         txHash,
+			RegisterHash: registerHash,
+			Success:      true,
+			Message:      message,
+		},
+	})
+}
+
+// registerRecipient registers the mint recipient with the sponsor paying gas. Without the
+// recipient's signature it answers with the registration for the recipient's wallet to sign;
+// with it, it submits the registration. When it can't go on it answers the request itself and
+// returns false
+func (h *Handler) registerRecipient(c *gin.Context, req models.MintTokenRequest) (string, bool) {
+	if req.RegisterTransaction != "" {
+		registerHash, err := h.aptosService.SubmitSponsoredRegistration(req.Recipient, req.RegisterTransaction, req.RecipientAuthenticator)
+		switch {
+		case err == nil:
+			return registerHash, true
+		case errors.Is(err, services.ErrSponsoredTransactionUnknown):
+			// Expired or already used: hand out a fresh one below
+			fmt.Printf("DEBUG: Sponsored registration of %s can't be used, issuing another: %v\n", req.Recipient, err)
+		case errors.Is(err, services.ErrSponsorNotConfigured):
+			respondRecipientNotRegistered(c, req.Recipient, "auto_register needs a sponsor account and none is configured")
+			return "", false
+		case errors.Is(err, services.ErrInvalidSignature):
+			c.JSON(http.StatusUnauthorized, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("recipient_authenticator: %v", err),
+				Code:    models.ErrCodeInvalidSignature,
+			})
+			return "", false
+		default:
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("failed to register recipient: %v", err),
+			})
+			return "", false
+		}
+	}
+
+	transaction, err := h.aptosService.BuildSponsoredRegistration(req.Recipient)
+	if errors.Is(err, services.ErrSponsorNotConfigured) {
+		respondRecipientNotRegistered(c, req.Recipient, "auto_register needs a sponsor account and none is configured")
+		return "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to build the recipient's registration: %v", err),
+		})
+		return "", false
+	}
+	c.JSON(http.StatusConflict, models.Response{
+		Success: false,
+		Error: fmt.Sprintf("recipient %s must sign its registration: have its wallet sign data.raw_transaction and send the mint again "+
+			"with register_transaction and recipient_authenticator before %d", req.Recipient, transaction.ExpiresAt),
+		Code: models.ErrCodeRecipientSignatureRequired,
+		Data: transaction,
+	})
+	return "", false
+}
+
+// respondRecipientNotRegistered refuses a mint to an account that can't receive the token,
+// with reason saying why it wasn't registered on the spot when auto_register was asked for
+func respondRecipientNotRegistered(c *gin.Context, recipient string, reason string) {
+	message := fmt.Sprintf("recipient %s has not registered to receive the token; it must call POST /api/v1/token/register first", recipient)
+	if reason != "" {
+		message = reason + ": " + message
+	}
+	c.JSON(http.StatusConflict, models.Response{
+		Success: false,
+		Error:   message,
+		Code:    models.ErrCodeRecipientNotRegistered,
+	})
+}
+
+// CheckTokenRegistration reports whether an account has registered to receive the DataX token
+func (h *Handler) CheckTokenRegistration(c *gin.Context) {
+	var req models.TokenRegistrationRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	registered, err := h.aptosService.IsTokenRegistered(req.Address)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: models.TokenRegistration{
+			Address:    req.Address,
+			Registered: registered,
+		},
+	})
+}
+
+// GetTokenInfo returns the DataX token's supply, decimals, symbol and minter
+func (h *Handler) GetTokenInfo(c *gin.Context) {
+	info, err := h.aptosService.GetTokenInfo()
+	if err != nil {
+		fmt.Printf("ERROR: Failed to read token info: %v\n", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    info,
+	})
+}
+
+// GetTransactionReceipt returns what a transaction did and cost: gas used and price, commit
+// time, and the events it emitted, with those of the DataX modules decoded
+func (h *Handler) GetTransactionReceipt(c *gin.Context) {
+	hash := strings.TrimPrefix(strings.ToLower(c.Param("hash")), "0x")
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != 32 {
+		respondBadQuery(c, "hash must be a 32-byte transaction hash in hex")
+		return
+	}
+
+	receipt, err := h.aptosService.GetTransactionReceipt(hash)
+	switch {
+	case errors.Is(err, services.ErrTransactionNotFound):
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ErrCodeTransactionNotFound,
+		})
+		return
+	case errors.Is(err, services.ErrTransactionPending):
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ErrCodeTransactionPending,
+		})
+		return
+	case err != nil:
+		fmt.Printf("ERROR: GetTransactionReceipt failed for %s: %v\n", hash, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    receipt,
+	})
+}
+
+// SubmitCSV handles CSV file upload and processing
+// The multipart body is streamed: form fields must come before csv_file, the CSV is
+// validated row by row while it is hashed and uploaded, and nothing holds the whole file
+// in memory. Uploads over MAX_UPLOAD_BYTES are rejected with 413, structurally invalid
+// CSVs with 422 and a violation report. With validate_only=true the report is returned
+// without storing anything. When the schema field is omitted it is inferred from the rows.
+// A metadata field, the dataset metadata the client will submit on chain, is checked against
+// its JSON Schema first and fails the upload with 422 METADATA_INVALID when it doesn't conform.
+// Excel .xlsx workbooks are accepted too and converted to CSV (see csvUploadSource)
+func (h *Handler) SubmitCSV(c *gin.Context) {
+	if !limitUploadBody(c) {
+		return
+	}
+
+	fields, filePart, err := readUploadForm(c.Request, "csv_file")
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	if filePart == nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Missing CSV file: csv_file",
+		})
+		return
+	}
+	if !checkDatasetMetadata(c, fields["metadata"]) {
+		return
+	}
+
+	src, opts, sourceDetails, err := csvUploadSource(filePart, fields)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if closer, ok := src.(io.Closer); ok {
+		defer closer.Close() // Stops a workbook conversion if parsing ends early
+	}
 
-	// Check if requester is the owner (owners can always view their data)
-	isOwner := (req.Requester == req.Owner)
+	// Pre-flight: validate only, store nothing
+	if validateOnly, _ := strconv.ParseBool(fields["validate_only"]); validateOnly {
+		stream := streamCSV(src, io.Discard, opts)
+		if stream.err != nil && !errors.Is(stream.err, errCSVInvalid) {
+			respondUploadError(c, stream.err)
+			return
+		}
+		if !stream.report.Valid {
+			respondCSVInvalid(c, stream.report)
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Success: true,
+			Message: "CSV passed validation",
+			Data:    stream.report,
+		})
+		return
+	}
 
-	var hasAccess bool
-	if !isOwner {
-		// Check if requester has access
-		var err error
-		hasAccess, err = h.aptosService.CheckAccess(req.Owner, req.DatasetID, req.Requester)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.Response{
+	if !h.requireUploadFields(c, fields, "csv_file") {
+		return
+	}
+
+	h.ingestCSV(c, fields, src, opts, sourceDetails)
+}
+
+// ingestCSV validates, hashes, and stores an uploaded CSV stream, records its column
+// statistics, and writes the upload response. extraData is merged into the response data
+func (h *Handler) ingestCSV(c *gin.Context, fields map[string]string, src io.Reader, opts csvOptions, extraData map[string]interface{}) {
+	accountAddress := fields["account_address"]
+	dataHash := fields["data_hash"]
+	schemaJSON := fields["schema"]
+
+	// Column statistics are always collected; the schema is inferred only when it wasn't sent
+	statsCollector := dataschema.NewStatsCollector(config.AppConfig.StatsMaxDistinct)
+	observers := []recordObserver{statsCollector}
+	piiScanner := uploadPIIScanner()
+	if piiScanner != nil {
+		observers = append(observers, piiScanner)
+	}
+
+	var schema interface{}
+	var inferrer *dataschema.Inferrer
+	if schemaJSON == "" {
+		inferrer = dataschema.NewInferrer(config.AppConfig.SchemaSampleRows)
+		observers = append(observers, inferrer)
+	} else {
+		var provided map[string]interface{}
+		if err := json.Unmarshal([]byte(schemaJSON), &provided); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
 				Success: false,
-				Error:   err.Error(),
+				Error:   "Invalid schema JSON: " + err.Error(),
 			})
 			return
 		}
-	} else {
-		hasAccess = true
+		schema = provided
 	}
 
-	if !hasAccess {
-		c.JSON(http.StatusForbidden, models.Response{
+	fmt.Printf("DEBUG: CSV submitted for user %s\n", accountAddress)
+
+	// Parse and re-encode the CSV in one goroutine while storage uploads from the other end of the pipe
+	pr, pw := io.Pipe()
+	hasher := sha256.New()
+	var size byteCounter
+	streamDone := make(chan csvStreamResult, 1)
+	go func() {
+		result := streamCSV(src, io.MultiWriter(pw, hasher, &size), opts, observers...)
+		pw.CloseWithError(result.err)
+		streamDone <- result
+	}()
+
+	blobName, keyID, storeErr := h.storeUpload(accountAddress, pr)
+	pr.Close() // Unblock the parser if storage stopped reading early
+	stream := <-streamDone
+
+	if errors.Is(stream.err, errCSVInvalid) {
+		respondCSVInvalid(c, stream.report)
+		return
+	}
+	// A closed pipe means storage gave up first; its error is the one worth reporting
+	if stream.err != nil && !errors.Is(stream.err, io.ErrClosedPipe) {
+		respondUploadError(c, stream.err)
+		return
+	}
+	if storeErr != nil {
+		fmt.Printf("ERROR: Failed to store CSV in Supabase S3: %v\n", storeErr)
+		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
-			Error:   "Access denied",
+			Error:   fmt.Sprintf("Failed to store CSV data: %v", storeErr),
 		})
 		return
 	}
+	fmt.Printf("DEBUG: Stored CSV data in Supabase S3 with blob name: %s for account: %s\n", blobName, accountAddress)
 
-	// Retrieve CSV data directly from storage service
-	// Try using the data hash directly first (in case it's already a blob name)
-	// Also try if blob name contains "/" (Supabase format: {account}/{timestamp}_{hash}.csv)
-	var csvData [][]string
-	var err error
-
-	if strings.HasPrefix(req.DataHash, "csv_") || strings.Contains(req.DataHash, "/") {
-		fmt.Printf("DEBUG: Data hash looks like a blob name, trying direct retrieval: %s\n", req.DataHash)
-		csvData, err = h.storageService.RetrieveCSV(req.Owner, req.DataHash)
-		if err != nil {
-			fmt.Printf("DEBUG: Direct retrieval failed, trying to find blob by pattern: %v\n", err)
+	// The hash of the stored canonical bytes is authoritative; the client's data_hash is only checked against it
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	computedHash := "0x" + contentHash
+
+	// With use_cid_hash the digest of the blob's CID goes on chain instead, so the blob name
+	// alone proves the stored bytes match the dataset
+	onChainHash := computedHash
+	if fields["use_cid_hash"] == "true" {
+		if keyID != "" {
+			h.discardUpload(accountAddress, blobName)
+			c.JSON(http.StatusUnprocessableEntity, models.Response{
+				Success: false,
+				Error:   "use_cid_hash can't be used while encryption at rest is enabled: the CID would be of the ciphertext",
+			})
+			return
 		}
-	} else {
-		// Try direct retrieval first
-		csvData, err = h.storageService.RetrieveCSV(req.Owner, req.DataHash)
+		cidHash, err := services.CIDDataHash(blobName)
 		if err != nil {
-			fmt.Printf("DEBUG: Direct retrieval failed, trying to find blob by pattern: %v\n", err)
-		}
-	}
-
-	// If direct retrieval failed, try to find blob by listing S3 objects
-	if err != nil {
-		fmt.Printf("DEBUG: Attempting to find blob by listing S3 objects for owner: %s\n", req.Owner)
-		if supabaseService, ok := h.storageService.(interface {
-			FindBlobByPattern(accountAddress string, pattern string) (string, error)
-		}); ok {
-			// Try with empty pattern to list all objects for this owner and get the most recent CSV
-			blobName, findErr := supabaseService.FindBlobByPattern(req.Owner, "")
-			if findErr == nil {
-				fmt.Printf("DEBUG: Found blob by listing: %s\n", blobName)
-				csvData, err = h.storageService.RetrieveCSV(req.Owner, blobName)
-				if err != nil {
-					fmt.Printf("ERROR: Failed to retrieve after listing: %v\n", err)
-					c.JSON(http.StatusNotFound, models.Response{
-						Success: false,
-						Error:   fmt.Sprintf("CSV data not found in storage: %v", err),
-					})
-					return
-				}
-				fmt.Printf("DEBUG: Successfully retrieved CSV from storage: %s\n", blobName)
-			} else {
-				fmt.Printf("ERROR: Listing objects failed: %v\n", findErr)
-				c.JSON(http.StatusNotFound, models.Response{
-					Success: false,
-					Error:   fmt.Sprintf("CSV data not found. Data hash: %s. Error: %v", req.DataHash, findErr),
-				})
-				return
-			}
-		} else {
-			c.JSON(http.StatusNotFound, models.Response{
+			h.discardUpload(accountAddress, blobName)
+			c.JSON(http.StatusUnprocessableEntity, models.Response{
 				Success: false,
-				Error:   fmt.Sprintf("CSV data not found. Data hash: %s. The file may not have been stored.", req.DataHash),
+				Error:   fmt.Sprintf("use_cid_hash needs a content-addressed storage backend: %v", err),
 			})
 			return
 		}
+		onChainHash = cidHash
+	}
+	if services.NormalizeDataHash(dataHash) != computedHash && !checkClientDataHash(c, dataHash, onChainHash, blobName) {
+		h.discardUpload(accountAddress, blobName)
+		return
+	}
+
+	// Only now that the hashes are settled is the blob indexed, and only under the ones the
+	// server computed: a client hash never points the manifest at a blob
+	manifestHashes := []string{computedHash}
+	if onChainHash != computedHash {
+		manifestHashes = append(manifestHashes, onChainHash)
+	}
+	for _, hash := range manifestHashes {
+		err := h.storageService.UpdateManifest(accountAddress, hash, models.BlobManifestEntry{
+			BlobName:   blobName,
+			UploadedAt: time.Now().Unix(),
+			Size:       int64(size),
+			Encrypted:  keyID != "",
+			KeyID:      keyID,
+			Verified:   true,
+		})
+		if err != nil {
+			fmt.Printf("ERROR: Failed to record %s in manifest under %s: %v\n", blobName, hash, err)
+		}
+	}
+
+	if inferrer != nil {
+		schema = inferrer.Schema()
+	}
+	h.recordBlobMetadata(accountAddress, blobName, onChainHash, stream.report, int64(size), schema)
+
+	// Stats are a convenience for buyers; failing to store them doesn't fail the upload
+	stats := statsCollector.Stats()
+	stats.DataHash = onChainHash
+	stats.BlobName = blobName
+	stats.ComputedAt = time.Now().UTC().Format(time.RFC3339)
+	data := map[string]interface{}{
+		"account_address":  accountAddress,
+		"data_hash":        onChainHash, // Use this in the submit_data transaction
+		"client_data_hash": dataHash,
+		"content_hash":     contentHash, // SHA-256 of the stored CSV bytes
+		"row_count":        stream.report.RowCount,
+		"column_count":     stream.report.ColumnCount,
+		"schema":           schema,
+		"schema_inferred":  inferrer != nil,
+	}
+	if onChainHash != computedHash {
+		data["cid"] = blobName
+	}
+	if keyID != "" {
+		data["encryption_algorithm"] = services.EncryptionAlgorithm() // Record in the dataset metadata
+	}
+	piiDetails(piiScanner, &stats, data)
+	if err := h.storageService.StoreCSVStats(accountAddress, blobName, &stats); err != nil {
+		fmt.Printf("ERROR: Failed to store CSV stats for %s: %v\n", blobName, err)
+	}
+	for key, value := range extraData {
+		data[key] = value
 	}
 
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
-		Data:    csvData,
+		Message: "CSV data received and processed",
+		Data:    data,
 	})
 }
 
-// GetUserVault retrieves user's vault datasets
-func (h *Handler) GetUserVault(c *gin.Context) {
-	var req models.GetUserVaultRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
-		return
+// storeUpload stores an upload's canonical CSV bytes without indexing them; ingestCSV records
+// the blob in the manifest once its hash is checked. With encryption at rest the bytes are
+// sealed in chunks under a fresh data key as they stream through, and keyID is the master
+// key that wrapped that key. Backends that can't store a stream hold the ciphertext whole
+func (h *Handler) storeUpload(accountAddress string, r io.Reader) (blobName string, keyID string, err error) {
+	store, ok := h.storageService.(services.EncryptedCSVStorage)
+	if !services.EncryptionEnabled() || !ok {
+		blobName, err = h.storageService.StoreCSVStream(accountAddress, "", r)
+		return blobName, "", err
 	}
 
-	datasets, err := h.aptosService.GetUserVault(req.User)
+	sealed, err := services.SealCSVStream(r)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+		return "", "", err
+	}
+	if streamer, ok := h.storageService.(services.EncryptedStreamStorage); ok {
+		if blobName, err = streamer.StoreEncryptedCSVStream(accountAddress, sealed, sealed.Metadata); err != nil {
+			return "", "", err
+		}
+		return blobName, sealed.KeyID(), nil
+	}
+
+	ciphertext, err := io.ReadAll(sealed)
+	if err != nil {
+		return "", "", err
+	}
+	metadata, err := sealed.Metadata()
+	if err != nil {
+		return "", "", err
+	}
+	blobName, err = store.StoreEncryptedCSV(accountAddress, ciphertext, metadata)
+	if err != nil {
+		return "", "", err
+	}
+	return blobName, sealed.KeyID(), nil
+}
+
+// discardUpload deletes a stored upload whose hash was rejected, unless the manifest points
+// at the blob: identical data stored earlier shares its content-addressed name
+func (h *Handler) discardUpload(accountAddress string, blobName string) {
+	manifest, err := h.storageService.RetrieveManifest(accountAddress)
+	if err != nil {
+		fmt.Printf("ERROR: Keeping rejected upload %s, manifest unreadable: %v\n", blobName, err)
 		return
 	}
+	for _, entry := range manifest {
+		if entry.BlobName == blobName || slices.Contains(entry.LegacyBlobNames, blobName) {
+			return
+		}
+	}
+	if err := h.storageService.DeleteBlob(accountAddress, blobName); err != nil {
+		fmt.Printf("ERROR: Failed to delete rejected upload %s: %v\n", blobName, err)
+	}
+}
 
-	c.JSON(http.StatusOK, models.Response{
-		Success: true,
-		Data: models.VaultInfo{
-			Datasets: datasets,
-			Count:    uint64(len(datasets)),
-		},
+// recordBlobMetadata attaches what parsing learned about an upload to its blob, so listings
+// can describe it. A failure is only logged: the upload itself succeeded
+func (h *Handler) recordBlobMetadata(accountAddress string, blobName string, dataHash string, report models.CSVValidationReport, size int64, schema interface{}) {
+	err := h.storageService.SetBlobMetadata(accountAddress, blobName, models.BlobMetadata{
+		RowCount:          report.RowCount,
+		ColumnCount:       report.ColumnCount,
+		PlaintextSize:     size,
+		SchemaFingerprint: schemaFingerprint(report.Columns, schema),
+		DataHash:          dataHash,
 	})
+	if err != nil {
+		fmt.Printf("ERROR: Failed to record metadata for %s: %v\n", blobName, err)
+	}
 }
 
-// GetUserDatasetsMetadata retrieves minimal metadata for all user datasets (optimized for batch operations)
-func (h *Handler) GetUserDatasetsMetadata(c *gin.Context) {
-	var req models.GetUserVaultRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+// schemaFingerprint identifies a dataset's column layout: the SHA-256 of its column names and
+// inferred types, of the schema JSON the uploader provided, or of the header alone
+func schemaFingerprint(header []string, schema interface{}) string {
+	var layout interface{} = header
+	switch s := schema.(type) {
+	case dataschema.Schema:
+		columns := make([][2]string, len(s.Columns))
+		for i, column := range s.Columns {
+			columns[i] = [2]string{column.Name, column.Type}
+		}
+		layout = columns
+	case map[string]interface{}:
+		layout = s
+	}
+
+	body, err := json.Marshal(layout)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetCSVStats returns the column statistics computed when a dataset was uploaded
+// They are aggregates, not rows, so no access check is needed
+func (h *Handler) GetCSVStats(c *gin.Context) {
+	var req models.GetCSVStatsRequest
+	if !bindAndValidate(c, &req) {
 		return
 	}
 
-	metadata, err := h.aptosService.GetUserDatasetsMetadata(req.User)
+	blobName, err := h.findBlobByDataHash(req.Owner, req.DataHash)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
+		respondBlobNotFound(c, req.DataHash, err)
+		return
+	}
+
+	stats, err := h.storageService.RetrieveCSVStats(req.Owner, blobName)
+	if err != nil {
+		fmt.Printf("DEBUG: No CSV stats for owner=%s dataHash=%s: %v\n", req.Owner, req.DataHash, err)
+		c.JSON(http.StatusNotFound, models.Response{
 			Success: false,
-			Error:   err.Error(),
+			Error:   "Statistics not found for this dataset",
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
-		Data:    metadata,
+		Data:    stats,
 	})
 }
 
-// CheckInitialization checks if the user account is initialized
-func (h *Handler) CheckInitialization(c *gin.Context) {
-	var req models.CheckInitializationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
-		return
+// resolveDatasetBlob maps a dataset to its storage blob through the data hash registered on
+// chain, never through anything the caller sent: the owner's manifest entry for that hash,
+// else the blob named after it. It returns the blob and the on-chain hash. Errors wrap
+// services.ErrBlobNotFound
+func (h *Handler) resolveDatasetBlob(owner string, datasetID uint64) (string, string, error) {
+	onChainHash := h.datasetDataHash(owner, datasetID)
+	if services.NormalizeDataHash(onChainHash) == "" {
+		return "", "", fmt.Errorf("%w: no on-chain data hash for dataset %d of %s", services.ErrBlobNotFound, datasetID, owner)
 	}
 
-	initialized, err := h.aptosService.IsAccountInitialized(req.User)
+	blobName, err := h.findBlobByDataHash(owner, onChainHash)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
+		return "", "", err
+	}
+	return blobName, onChainHash, nil
+}
+
+// verifyBlobMatchesDataset checks that a blob holds the dataset its on-chain hash resolved
+// it for, for reads that don't load the whole blob themselves. A content-addressed or CID
+// named blob is checked by its name; any other blob is read and hashed as
+// verifyDatasetIntegrity does. Otherwise it writes the error response and returns false
+func (h *Handler) verifyBlobMatchesDataset(c *gin.Context, owner string, datasetID uint64, blobName string, onChainHash string) bool {
+	hash := services.NormalizeDataHash(onChainHash)
+	if services.ContentHash(blobName) == hash {
+		return true
+	}
+	if cidHash, err := services.CIDDataHash(blobName); err == nil && cidHash == hash {
+		return true
+	}
+
+	records, err := h.storageService.RetrieveCSV(owner, blobName)
+	if errors.Is(err, services.ErrNotEnvelope) {
+		c.JSON(http.StatusConflict, models.Response{
 			Success: false,
-			Error:   err.Error(),
+			Error:   "This dataset was encrypted by the client; request it with decryption \"client\" or \"provided_key\"",
 		})
-		return
+		return false
+	}
+	if err != nil {
+		fmt.Printf("ERROR: Failed to retrieve %s for verification: %v\n", blobName, err)
+		respondBlobNotFound(c, onChainHash, err)
+		return false
 	}
+	return h.verifyDatasetIntegrity(c, owner, datasetID, blobName, records)
+}
 
-	c.JSON(http.StatusOK, models.Response{
-		Success: true,
-		Data: models.InitializationInfo{
-			Initialized: initialized,
-		},
-	})
+// findBlobByDataHash maps a data hash, when no dataset ID is known, to the owner's blob for
+// it: the manifest entry, else a blob named after it. Only hex digests are looked up, and a
+// blob outside the owner's storage is never returned. Errors wrap services.ErrBlobNotFound
+func (h *Handler) findBlobByDataHash(owner string, dataHash string) (string, error) {
+	hash := services.NormalizeDataHash(dataHash)
+	if hash == "" {
+		return "", fmt.Errorf("%w: %q is not a data hash", services.ErrBlobNotFound, dataHash)
+	}
+
+	// The manifest records the exact blob stored at upload time
+	blobName := ""
+	manifest, err := h.storageService.RetrieveManifest(owner)
+	if err != nil {
+		fmt.Printf("DEBUG: Could not read manifest for %s, falling back to listing: %v\n", owner, err)
+	} else if entry, ok := manifest[hash]; ok {
+		blobName = entry.BlobName
+	}
+	if blobName == "" {
+		if blobName, err = h.storageService.FindBlobByDataHash(owner, hash); err != nil {
+			return "", err
+		}
+	}
+
+	if !services.BlobBelongsTo(owner, blobName) {
+		fmt.Printf("ERROR: Data hash %s resolved to %s, outside %s's storage\n", hash, blobName, owner)
+		return "", fmt.Errorf("%w: %s is not stored under %s", services.ErrBlobNotFound, blobName, owner)
+	}
+	return blobName, nil
 }
 
-// RegisterToken registers a user to receive tokens
-func (h *Handler) RegisterToken(c *gin.Context) {
-	var req models.RegisterTokenRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+// InferSchema samples the start of an uploaded CSV and returns inferred column types
+// Only the first SCHEMA_SAMPLE_BYTES of csv_file are read
+func (h *Handler) InferSchema(c *gin.Context) {
+	_, filePart, err := readUploadForm(c.Request, "csv_file")
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if filePart == nil {
 		c.JSON(http.StatusBadRequest, models.Response{
 			Success: false,
-			Error:   err.Error(),
+			Error:   "Missing CSV file: csv_file",
 		})
 		return
 	}
 
-	txHash, err := h.aptosService.RegisterToken(req.PrivateKey)
+	sample, err := io.ReadAll(io.LimitReader(filePart, int64(config.AppConfig.SchemaSampleBytes)))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
+		respondUploadError(c, err)
+		return
+	}
+
+	// A full sample probably cut the last line short; drop it so it can't skew the types
+	if len(sample) == config.AppConfig.SchemaSampleBytes {
+		if end := bytes.LastIndexByte(sample, '\n'); end > 0 {
+			sample = sample[:end+1]
+		}
+	}
+
+	inferred, err := dataschema.Infer(bytes.NewReader(sample), config.AppConfig.SchemaSampleRows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
 			Success: false,
-			Error:   err.Error(),
+			Error:   "Failed to parse CSV file: " + err.Error(),
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
-		Data: models.TransactionResponse{
-			Hash:    txHash,
-			Success: true,
-			Message: "Token registration successful",
-		},
+		Data:    inferred,
 	})
 }
 
-// MintToken mints tokens to a recipient
-func (h *Handler) MintToken(c *gin.Context) {
-	var req models.MintTokenRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   err.Error(),
-		})
+// CreateAuthChallenge issues a single-use nonce for a wallet to sign
+func (h *Handler) CreateAuthChallenge(c *gin.Context) {
+	var req models.AuthChallengeRequest
+	if !bindAndValidate(c, &req) {
 		return
 	}
 
-	txHash, err := h.aptosService.MintToken(req.PrivateKey, req.Recipient, req.Amount)
+	challenge, err := h.walletAuth.IssueChallenge(req.Address)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
+		c.JSON(http.StatusBadRequest, models.Response{
 			Success: false,
 			Error:   err.Error(),
 		})
@@ -667,106 +1991,174 @@ func (h *Handler) MintToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
-		Data: models.TransactionResponse{
-			Hash:    txHash,
-			Success: true,
-			Message: "Tokens minted successfully",
-		},
+		Data:    challenge,
 	})
 }
 
-// SubmitCSV handles CSV file upload and processing
-func (h *Handler) SubmitCSV(c *gin.Context) {
-	accountAddress := c.PostForm("account_address")
-	dataHash := c.PostForm("data_hash")
-	schemaJSON := c.PostForm("schema")
+// verifyWalletSignature checks the wallet signature for an address and writes the error
+// response when it doesn't hold up. Returns true when the caller may proceed
+func (h *Handler) verifyWalletSignature(c *gin.Context, address string, sig models.WalletSignature) bool {
+	err := h.walletAuth.VerifySignature(h.aptosService, address, sig.Nonce, sig.SignedMessage, sig.PublicKey, sig.Signature)
+	if err == nil {
+		return true
+	}
 
-	if accountAddress == "" || dataHash == "" || schemaJSON == "" {
-		c.JSON(http.StatusBadRequest, models.Response{
+	if errors.Is(err, services.ErrInvalidNonce) || errors.Is(err, services.ErrInvalidSignature) {
+		fmt.Printf("DEBUG: Wallet signature rejected for %s: %v\n", address, err)
+		c.JSON(http.StatusUnauthorized, models.Response{
 			Success: false,
-			Error:   "Missing required fields: account_address, data_hash, schema",
+			Error:   err.Error(),
+			Code:    models.ErrCodeInvalidSignature,
 		})
-		return
+		return false
 	}
 
-	// Get the uploaded CSV file
-	file, err := c.FormFile("csv_file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   "Missing CSV file: " + err.Error(),
-		})
+	fmt.Printf("ERROR: Wallet signature verification failed for %s: %v\n", address, err)
+	c.JSON(http.StatusInternalServerError, models.Response{
+		Success: false,
+		Error:   err.Error(),
+	})
+	return false
+}
+
+// BackfillManifest rebuilds an owner's data hash -> blob manifest from the objects in storage,
+// for datasets uploaded before the manifest existed
+func (h *Handler) BackfillManifest(c *gin.Context) {
+	var req models.BackfillManifestRequest
+	if !bindAndValidate(c, &req) {
 		return
 	}
 
-	// Open the uploaded file
-	src, err := file.Open()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
+	rebuilder, ok := h.storageService.(interface {
+		RebuildManifest(accountAddress string) (models.BlobManifest, int, error)
+	})
+	if !ok {
+		c.JSON(http.StatusNotImplemented, models.Response{
 			Success: false,
-			Error:   "Failed to open uploaded file: " + err.Error(),
+			Error:   "Storage backend cannot list objects to rebuild manifests",
 		})
 		return
 	}
-	defer src.Close()
 
-	// Read and parse CSV file
-	csvReader := csv.NewReader(src)
-	csvData, err := csvReader.ReadAll()
+	manifest, added, err := rebuilder.RebuildManifest(req.Owner)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
+		fmt.Printf("ERROR: Manifest backfill for %s failed: %v\n", req.Owner, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
 			Success: false,
-			Error:   "Failed to parse CSV file: " + err.Error(),
+			Error:   fmt.Sprintf("Failed to rebuild manifest: %v", err),
 		})
 		return
 	}
 
-	// Parse schema
-	var schema map[string]interface{}
-	if err := json.Unmarshal([]byte(schemaJSON), &schema); err != nil {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Success: false,
-			Error:   "Invalid schema JSON: " + err.Error(),
-		})
-		return
-	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"owner":    req.Owner,
+			"added":    added,
+			"manifest": manifest,
+		},
+	})
+}
 
-	fmt.Printf("DEBUG: CSV submitted for user %s\n", accountAddress)
+// GetDiscoveryCheckpoint returns the user discovery scanner's checkpoint for debugging
+func (h *Handler) GetDiscoveryCheckpoint(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    h.aptosService.GetDiscoveryCheckpoint(),
+	})
+}
 
-	// Store CSV data in Supabase S3
-	blobName, err := h.storageService.StoreCSV(accountAddress, csvData)
+// ReloadConfig re-reads the runtime-tunable settings, as SIGHUP does. Changes to settings
+// that need a restart are listed in ignored and left as they were
+func (h *Handler) ReloadConfig(c *gin.Context) {
+	changed, ignored, err := config.Reload()
 	if err != nil {
-		fmt.Printf("ERROR: Failed to store CSV in Supabase S3: %v\n", err)
-		c.JSON(http.StatusInternalServerError, models.Response{
+		c.JSON(http.StatusBadRequest, models.Response{
 			Success: false,
-			Error:   fmt.Sprintf("Failed to store CSV data: %v", err),
+			Error:   err.Error(),
+			Code:    models.ErrCodeInvalidConfiguration,
 		})
 		return
 	}
-	fmt.Printf("DEBUG: Stored CSV data in Supabase S3 with blob name: %s for account: %s\n", blobName, accountAddress)
 
+	message := "Configuration reloaded"
+	if len(ignored) > 0 {
+		message = "Configuration reloaded; changes to settings that need a restart were ignored"
+	}
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
-		Message: "CSV data received and processed",
-		Data: map[string]interface{}{
-			"account_address": accountAddress,
-			"data_hash":       dataHash,
-			"row_count":       len(csvData) - 1, // Exclude header
-			"column_count": func() int {
-				if len(csvData) > 0 {
-					return len(csvData[0])
-				}
-				return 0
-			}(),
-			"schema": schema,
+		Message: message,
+		Data: models.ConfigReload{
+			Changed: changed,
+			Ignored: ignored,
 		},
 	})
 }
 
 // Health check endpoint
 func (h *Handler) HealthCheck(c *gin.Context) {
+	data := gin.H{}
+	message := "Service is healthy"
+	if config.AppConfig.MockChain {
+		data["mock_chain"] = true
+		message = "Service is healthy (MOCK CHAIN: transactions are simulated, nothing is on Aptos)"
+	}
+
+	// Storage is the one dependency every data route needs
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	started := time.Now()
+	err := h.storageService.Ping(ctx)
+	storage := gin.H{
+		"backend":    config.AppConfig.StorageBackend,
+		"ok":         err == nil,
+		"latency_ms": time.Since(started).Milliseconds(),
+	}
+	data["storage"] = storage
+	if err != nil {
+		fmt.Printf("ERROR: Storage health check failed: %v\n", err)
+		storage["error"] = err.Error()
+		c.JSON(http.StatusServiceUnavailable, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Storage is not reachable: %v", err),
+			Data:    data,
+		})
+		return
+	}
+
+	// An unreachable KMS or Vault only takes down encrypted reads and writes, so it degrades
+	// the service rather than failing the check
+	if services.EncryptionEnabled() {
+		provider := services.CurrentKeyProvider()
+		started := time.Now()
+		err := provider.Ping(ctx)
+		keyProvider := gin.H{
+			"provider":   provider.Name(),
+			"ok":         err == nil,
+			"latency_ms": time.Since(started).Milliseconds(),
+		}
+		data["key_provider"] = keyProvider
+		if err != nil {
+			fmt.Printf("ERROR: Key provider health check failed: %v\n", err)
+			keyProvider["error"] = err.Error()
+			message = fmt.Sprintf("Service is degraded: the %s key provider is not reachable, so encrypted datasets can't be read or written", provider.Name())
+		}
+	}
+
+	if reporter, ok := h.aptosService.(services.IndexerReporter); ok {
+		if status, configured := reporter.IndexerStatus(); configured {
+			data["indexer"] = status
+		}
+	}
+
+	// While the local event index lags, reads quietly fall back to the remote paths
+	if reporter, ok := h.aptosService.(services.EventIndexReporter); ok && config.AppConfig.ReadSource == services.ReadSourceLocal {
+		data["event_index"] = reporter.EventIndexStatus()
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Success: true,
-		Message: "Service is healthy",
+		Message: message,
+		Data:    data,
 	})
 }
@@ -0,0 +1,1032 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+	"github.com/aptos-labs/aptos-go-sdk/bcs"
+	"github.com/aptos-labs/aptos-go-sdk/crypto"
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// getMarketplace requests the marketplace listing, sending ifNoneMatch when it isn't empty
+func (h *testHandler) getMarketplace(ifNoneMatch string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/marketplace/datasets", nil)
+	if ifNoneMatch != "" {
+		request.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	return serve(http.MethodGet, "/marketplace/datasets", h.GetMarketplaceDatasets, request)
+}
+
+func TestMarketplaceETagUnchangedData(t *testing.T) {
+	h := newTestHandler(t)
+	h.submitTestDataset(t, testOwnerKey, strings.Repeat("a", 64), "first")
+
+	first := h.getMarketplace("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request = %d with ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+
+	second := h.getMarketplace(etag)
+	if second.Code != http.StatusNotModified {
+		t.Fatalf("request with the current ETag = %d, want 304", second.Code)
+	}
+	if second.Body.Len() != 0 {
+		t.Errorf("304 carried a %d byte body", second.Body.Len())
+	}
+	if got := second.Header().Get("ETag"); got != etag {
+		t.Errorf("304 ETag = %q, want %q", got, etag)
+	}
+
+	// Weak and listed forms of the same tag match too
+	for _, header := range []string{"W/" + etag, `"other", ` + etag, "*"} {
+		if got := h.getMarketplace(header).Code; got != http.StatusNotModified {
+			t.Errorf("If-None-Match %s = %d, want 304", header, got)
+		}
+	}
+}
+
+func TestMarketplaceETagChangedData(t *testing.T) {
+	h := newTestHandler(t)
+	h.submitTestDataset(t, testOwnerKey, strings.Repeat("a", 64), "first")
+	etag := h.getMarketplace("").Header().Get("ETag")
+
+	h.submitTestDataset(t, testOwnerKey, strings.Repeat("b", 64), "second")
+
+	response := h.getMarketplace(etag)
+	if response.Code != http.StatusOK {
+		t.Fatalf("request with a stale ETag = %d, want 200", response.Code)
+	}
+	if got := response.Header().Get("ETag"); got == "" || got == etag {
+		t.Errorf("ETag after a new dataset = %q, want one different from %q", got, etag)
+	}
+	if !strings.Contains(response.Body.String(), "second") {
+		t.Errorf("body is missing the new dataset: %s", response.Body.String())
+	}
+}
+
+func TestMarketplaceETagMalformed(t *testing.T) {
+	h := newTestHandler(t)
+	h.submitTestDataset(t, testOwnerKey, strings.Repeat("a", 64), "first")
+	etag := h.getMarketplace("").Header().Get("ETag")
+	unquoted := strings.Trim(etag, `"`)
+
+	for _, header := range []string{unquoted, `"`, "W/", `"` + unquoted, unquoted + `"`, ",,", "garbage"} {
+		response := h.getMarketplace(header)
+		if response.Code != http.StatusOK {
+			t.Errorf("If-None-Match %q = %d, want 200", header, response.Code)
+		}
+		if response.Body.Len() == 0 {
+			t.Errorf("If-None-Match %q got an empty body", header)
+		}
+	}
+}
+
+func TestMarketplaceETagPerResponseShape(t *testing.T) {
+	h := newTestHandler(t)
+	h.submitTestDataset(t, testOwnerKey, strings.Repeat("a", 64), "first")
+	bare := h.getMarketplace("").Header().Get("ETag")
+
+	// The envelope is a different body, so the bare array's ETag doesn't answer for it
+	request := httptest.NewRequest(http.MethodGet, "/marketplace/datasets?envelope=true", nil)
+	request.Header.Set("If-None-Match", bare)
+	response := serve(http.MethodGet, "/marketplace/datasets", h.GetMarketplaceDatasets, request)
+	if response.Code != http.StatusOK || response.Header().Get("ETag") == bare {
+		t.Errorf("envelope with the bare array's ETag = %d under %s, want 200 under another ETag", response.Code, response.Header().Get("ETag"))
+	}
+	if !strings.Contains(response.Body.String(), `"total_datasets":1`) {
+		t.Errorf("envelope body = %s, want the page summary", response.Body.String())
+	}
+}
+
+// getCSVData posts a GetCSVData request for the owner's dataset 0
+func (h *testHandler) getCSVData(t *testing.T, owner string, dataHash string, requester string, proof models.DataAccessProof) (int, models.Response) {
+	t.Helper()
+	datasetID := uint64(0)
+	request := jsonRequest(t, http.MethodPost, "/data/get-csv", models.GetCSVDataRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: requester, DataAccessProof: proof,
+	})
+	recorder := serve(http.MethodPost, "/data/get-csv", h.GetCSVData, request)
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+func TestGetCSVDataRejectsARequesterPosingAsTheOwner(t *testing.T) {
+	h := newTestHandler(t)
+	dataHash := strings.Repeat("a", 64)
+	h.submitTestDataset(t, testOwnerKey, dataHash, "private")
+	owner := addressOf(t, testOwnerKey)
+
+	// The requester asks for a challenge for the owner's address and signs it with their own key
+	forged := h.signProof(t, owner, testRequesterKey)
+	status, response := h.getCSVData(t, owner, dataHash, owner, forged)
+	if status != http.StatusUnauthorized || response.Code != models.ErrCodeInvalidSignature {
+		t.Errorf("forged signature = %d %q, want 401 %s", status, response.Code, models.ErrCodeInvalidSignature)
+	}
+	if response.Data != nil {
+		t.Errorf("forged request got data: %v", response.Data)
+	}
+}
+
+func TestGetCSVDataRejectsReplayedNonces(t *testing.T) {
+	h := newTestHandler(t)
+	dataHash := strings.Repeat("a", 64)
+	h.submitTestDataset(t, testOwnerKey, dataHash, "private")
+	owner := addressOf(t, testOwnerKey)
+
+	proof := h.signProof(t, owner, testOwnerKey)
+	if status, response := h.getCSVData(t, owner, dataHash, owner, proof); status == http.StatusUnauthorized {
+		t.Fatalf("first use of the signature = 401 %s", response.Error)
+	}
+
+	status, response := h.getCSVData(t, owner, dataHash, owner, proof)
+	if status != http.StatusUnauthorized || response.Code != models.ErrCodeInvalidSignature {
+		t.Errorf("replayed signature = %d %q, want 401 %s", status, response.Code, models.ErrCodeInvalidSignature)
+	}
+}
+
+func TestGetCSVDataNeedsAGrantForOtherRequesters(t *testing.T) {
+	h := newTestHandler(t)
+	dataHash := strings.Repeat("a", 64)
+	h.submitTestDataset(t, testOwnerKey, dataHash, "private")
+	owner := addressOf(t, testOwnerKey)
+	requester := addressOf(t, testRequesterKey)
+
+	// A genuine signature proves who the requester is, not that they may read
+	status, _ := h.getCSVData(t, owner, dataHash, requester, h.signProof(t, requester, testRequesterKey))
+	if status != http.StatusForbidden {
+		t.Errorf("requester without a grant = %d, want 403", status)
+	}
+}
+
+// testCSV is a canonical CSV with more rows than a preview of two returns
+const testCSV = "id,name\n1,alpha\n2,beta\n3,gamma\n4,delta\n"
+
+// previewCSV posts a preview of two rows of the owner's dataset 0, signed by the owner
+func (h *testHandler) previewCSV(t *testing.T, dataHash string) (int, models.Response) {
+	t.Helper()
+	owner := addressOf(t, testOwnerKey)
+	datasetID := uint64(0)
+	request := jsonRequest(t, http.MethodPost, "/data/preview", models.PreviewCSVRequest{
+		DataHash: dataHash, Owner: owner, DatasetID: &datasetID, Requester: owner, Limit: 2,
+		DataAccessProof: h.signProof(t, owner, testOwnerKey),
+	})
+	recorder := serve(http.MethodPost, "/data/preview", h.PreviewCSVData, request)
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+func TestPreviewCSVDataServesTheBlobOfTheOnChainHash(t *testing.T) {
+	h := newTestHandler(t)
+	h.storeTestDataset(t, testOwnerKey, testCSV, "mine")
+	// Another stored blob, whose hash the request names instead of the dataset's
+	otherHash := h.storeTestDataset(t, testOwnerKey, "secret\nhidden\n", "other")
+
+	status, response := h.previewCSV(t, otherHash)
+	if status != http.StatusOK {
+		t.Fatalf("preview = %d %s", status, response.Error)
+	}
+	preview, _ := json.Marshal(response.Data)
+	if !strings.Contains(string(preview), "alpha") || strings.Contains(string(preview), "hidden") {
+		t.Errorf("preview = %s, want dataset 0's rows", preview)
+	}
+}
+
+func TestPreviewCSVDataVerifiesPartialPreviews(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	sum := sha256.Sum256([]byte(testCSV))
+	dataHash := "0x" + hex.EncodeToString(sum[:])
+	h.submitTestDataset(t, testOwnerKey, dataHash, "tampered")
+
+	// A legacy-named blob for the hash whose rows were altered after upload
+	blobName := h.writeTestBlob(t, owner+"/1700000000_"+hex.EncodeToString(sum[:])+".csv", strings.Replace(testCSV, "alpha", "ALTERED", 1))
+	if err := h.storage.UpdateManifest(owner, dataHash, models.BlobManifestEntry{BlobName: blobName}); err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+
+	// Two of four rows: the preview alone couldn't be hashed, but it is still refused
+	status, response := h.previewCSV(t, dataHash)
+	if status != http.StatusConflict || response.Code != models.ErrCodeIntegrityMismatch {
+		t.Errorf("preview of an altered blob = %d %q, want 409 %s", status, response.Code, models.ErrCodeIntegrityMismatch)
+	}
+}
+
+func TestPreviewCSVDataRefusesBlobsOfOtherOwners(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	victim := addressOf(t, testRequesterKey)
+	victimHash := h.storeTestDataset(t, testRequesterKey, "secret\nhidden\n", "victim's")
+
+	// The owner registers the victim's hash and points their manifest at the victim's blob
+	h.submitTestDataset(t, testOwnerKey, victimHash, "stolen")
+	victimBlob := victim + "/" + strings.TrimPrefix(victimHash, "0x") + ".csv"
+	if err := h.storage.UpdateManifest(owner, victimHash, models.BlobManifestEntry{BlobName: victimBlob}); err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+
+	status, response := h.previewCSV(t, victimHash)
+	if status != http.StatusNotFound {
+		t.Errorf("preview through another owner's blob = %d, want 404", status)
+	}
+	if preview, _ := json.Marshal(response.Data); strings.Contains(string(preview), "hidden") {
+		t.Errorf("preview leaked the victim's rows: %s", preview)
+	}
+}
+
+func TestGetCSVDataReadsTheOnChainDatasetWhateverHashIsSent(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	dataHash := h.storeTestDataset(t, testOwnerKey, testCSV, "mine")
+	victimHash := h.storeTestDataset(t, testRequesterKey, "secret\nhidden\n", "victim's")
+
+	status, response := h.getCSVData(t, owner, victimHash, owner, h.signProof(t, owner, testOwnerKey))
+	if status != http.StatusOK {
+		t.Fatalf("GetCSVData = %d %s", status, response.Error)
+	}
+	body, _ := json.Marshal(response.Data)
+	if !strings.Contains(string(body), "alpha") || strings.Contains(string(body), "hidden") {
+		t.Errorf("GetCSVData with another hash = %s, want dataset 0 (%s)", body, dataHash)
+	}
+}
+
+func TestGetCSVStatsRejectsBlobNames(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	victimHash := h.storeTestDataset(t, testRequesterKey, "secret\nhidden\n", "victim's")
+	victimBlob := addressOf(t, testRequesterKey) + "/" + strings.TrimPrefix(victimHash, "0x") + ".csv"
+
+	for _, dataHash := range []string{victimBlob, "csv_1700000000_abc", "../" + victimBlob} {
+		request := jsonRequest(t, http.MethodPost, "/data/stats", models.GetCSVStatsRequest{Owner: owner, DataHash: dataHash})
+		recorder := serve(http.MethodPost, "/data/stats", h.GetCSVStats, request)
+		var response models.Response
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		if recorder.Code != http.StatusBadRequest || response.Code != models.ErrCodeValidationFailed {
+			t.Errorf("stats for %q = %d %q, want 400 %s", dataHash, recorder.Code, response.Code, models.ErrCodeValidationFailed)
+		}
+	}
+}
+
+// presigningStorage is local storage that presigns a URL naming the blob, as Supabase would
+type presigningStorage struct {
+	services.StorageService
+}
+
+func (presigningStorage) GeneratePresignedDownloadURL(accountAddress string, blobName string, ttl time.Duration) (string, error) {
+	return "https://storage.test/" + blobName, nil
+}
+
+func TestGetDownloadURLPresignsTheOnChainBlobOnly(t *testing.T) {
+	h := newTestHandler(t)
+	h.storageService = presigningStorage{h.storage}
+	owner := addressOf(t, testOwnerKey)
+	dataHash := h.storeTestDataset(t, testOwnerKey, testCSV, "mine")
+	victimHash := h.storeTestDataset(t, testRequesterKey, "secret\nhidden\n", "victim's")
+
+	datasetID := uint64(0)
+	request := jsonRequest(t, http.MethodPost, "/data/download-url", models.DownloadURLRequest{
+		DataHash: victimHash, Owner: owner, DatasetID: &datasetID, Requester: owner,
+		DataAccessProof: h.signProof(t, owner, testOwnerKey),
+	})
+	recorder := serve(http.MethodPost, "/data/download-url", h.GetDownloadURL, request)
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GetDownloadURL = %d %s", recorder.Code, response.Error)
+	}
+
+	data, _ := response.Data.(map[string]interface{})
+	want := owner + "/" + strings.TrimPrefix(dataHash, "0x") + ".csv"
+	if data["blob_name"] != want || data["url"] != "https://storage.test/"+want {
+		t.Errorf("presigned %v (%v), want dataset 0's blob %s", data["blob_name"], data["url"], want)
+	}
+}
+
+// submitCSV posts a multipart upload of csvText with the given form fields sent first
+func (h *testHandler) submitCSV(t *testing.T, fields map[string]string, csvText string) (int, models.Response) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, name := range []string{"account_address", "nonce", "signed_message", "public_key", "signature", "data_hash"} {
+		if value, ok := fields[name]; ok {
+			form.WriteField(name, value)
+		}
+	}
+	file, _ := form.CreateFormFile("csv_file", "data.csv")
+	io.WriteString(file, csvText)
+	form.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/data/submit-csv", &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	recorder := serve(http.MethodPost, "/data/submit-csv", h.SubmitCSV, request)
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+// signedUploadFields are the form fields of an upload for address signed with privateKey
+func (h *testHandler) signedUploadFields(t *testing.T, address string, privateKey string) map[string]string {
+	proof := h.signProof(t, address, privateKey)
+	return map[string]string{
+		"account_address": address,
+		"nonce":           proof.Nonce,
+		"signed_message":  proof.SignedMessage,
+		"public_key":      proof.PublicKey,
+		"signature":       proof.Signature,
+	}
+}
+
+func TestSubmitCSVRequiresTheOwnersSignature(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+
+	status, _ := h.submitCSV(t, map[string]string{"account_address": owner}, testCSV)
+	if status != http.StatusBadRequest {
+		t.Errorf("unsigned upload = %d, want 400", status)
+	}
+
+	// Someone else's key signing for the owner's address
+	status, response := h.submitCSV(t, h.signedUploadFields(t, owner, testRequesterKey), testCSV)
+	if status != http.StatusUnauthorized || response.Code != models.ErrCodeInvalidSignature {
+		t.Errorf("upload signed by another wallet = %d %q, want 401 %s", status, response.Code, models.ErrCodeInvalidSignature)
+	}
+
+	if entries, err := os.ReadDir(filepath.Join(h.root, owner)); err == nil && len(entries) > 0 {
+		t.Errorf("rejected uploads stored %d files under the owner", len(entries))
+	}
+}
+
+func TestSubmitCSVIndexesOnlyTheComputedHash(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	sum := sha256.Sum256([]byte(testCSV))
+	computedHash := "0x" + hex.EncodeToString(sum[:])
+	claimedHash := "0x" + strings.Repeat("b", 64)
+
+	// A claimed hash that isn't the data's is refused, and never indexed
+	fields := h.signedUploadFields(t, owner, testOwnerKey)
+	fields["data_hash"] = claimedHash
+	status, response := h.submitCSV(t, fields, testCSV)
+	if status != http.StatusUnprocessableEntity || response.Code != models.ErrCodeDataHashMismatch {
+		t.Fatalf("mismatched data_hash = %d %q, want 422 %s", status, response.Code, models.ErrCodeDataHashMismatch)
+	}
+	manifest, _ := h.storage.RetrieveManifest(owner)
+	if len(manifest) != 0 {
+		t.Errorf("manifest after a rejected upload = %v, want it empty", manifest)
+	}
+
+	status, response = h.submitCSV(t, h.signedUploadFields(t, owner, testOwnerKey), testCSV)
+	if status != http.StatusOK {
+		t.Fatalf("upload = %d %s", status, response.Error)
+	}
+	manifest, _ = h.storage.RetrieveManifest(owner)
+	if _, ok := manifest[computedHash]; !ok || len(manifest) != 1 {
+		t.Errorf("manifest = %v, want only %s", manifest, computedHash)
+	}
+}
+
+func TestSubmitCSVDeletesRejectedUploads(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	sum := sha256.Sum256([]byte(testCSV))
+	blobFile := filepath.Join(h.root, owner, hex.EncodeToString(sum[:])+".csv")
+
+	fields := h.signedUploadFields(t, owner, testOwnerKey)
+	fields["data_hash"] = "0x" + strings.Repeat("b", 64)
+	if status, _ := h.submitCSV(t, fields, testCSV); status != http.StatusUnprocessableEntity {
+		t.Fatalf("mismatched data_hash = %d, want 422", status)
+	}
+	if _, err := os.Stat(blobFile); !os.IsNotExist(err) {
+		t.Errorf("rejected upload left its blob behind: %v", err)
+	}
+
+	// Identical data already indexed shares the blob, which a rejected re-upload must keep
+	if status, response := h.submitCSV(t, h.signedUploadFields(t, owner, testOwnerKey), testCSV); status != http.StatusOK {
+		t.Fatalf("upload = %d %s", status, response.Error)
+	}
+	fields = h.signedUploadFields(t, owner, testOwnerKey)
+	fields["data_hash"] = "0x" + strings.Repeat("b", 64)
+	h.submitCSV(t, fields, testCSV)
+	if _, err := os.Stat(blobFile); err != nil {
+		t.Errorf("rejected re-upload deleted the indexed blob: %v", err)
+	}
+}
+
+func TestSubmitCSVSealsUploadsWithEncryptionOn(t *testing.T) {
+	masterKey := config.AppConfig.EncryptionMasterKey
+	config.AppConfig.EncryptionMasterKey = strings.Repeat("ab", 32)
+	t.Cleanup(func() { config.AppConfig.EncryptionMasterKey = masterKey })
+
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+	sum := sha256.Sum256([]byte(testCSV))
+	computedHash := "0x" + hex.EncodeToString(sum[:])
+
+	status, response := h.submitCSV(t, h.signedUploadFields(t, owner, testOwnerKey), testCSV)
+	if status != http.StatusOK {
+		t.Fatalf("upload = %d %s", status, response.Error)
+	}
+	manifest, _ := h.storage.RetrieveManifest(owner)
+	entry, ok := manifest[computedHash]
+	if !ok || !strings.HasSuffix(entry.BlobName, ".csv.enc") {
+		t.Fatalf("manifest = %v, want %s indexed to a sealed blob", manifest, computedHash)
+	}
+
+	sealed, err := os.ReadFile(filepath.Join(h.root, entry.BlobName))
+	if err != nil || bytes.Contains(sealed, []byte("alpha")) {
+		t.Errorf("stored blob is not sealed: %v", err)
+	}
+	records, err := h.storage.RetrieveCSV(owner, entry.BlobName)
+	if err != nil || len(records) != 5 || records[4][1] != "delta" {
+		t.Errorf("RetrieveCSV = %v, %v", records, err)
+	}
+}
+
+func TestReleaseEscrowGrantsAccess(t *testing.T) {
+	h := newTestHandler(t)
+	owner, requester := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+	h.submitTestDataset(t, testOwnerKey, "0x"+strings.Repeat("a", 64), "paid")
+	datasetID := uint64(0)
+	if _, err := h.chain.DepositEscrow(testRequesterKey, owner, datasetID, 500); err != nil {
+		t.Fatalf("DepositEscrow: %v", err)
+	}
+
+	// The owner can't wait the requester out: the deposit stays until the refund timeout
+	refund := jsonRequest(t, http.MethodPost, "/escrow/refund", models.EscrowRefundRequest{PrivateKey: testRequesterKey, Owner: owner, DatasetID: &datasetID})
+	recorder := serve(http.MethodPost, "/escrow/refund", h.RefundEscrow, refund)
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusConflict || response.Code != models.ErrCodeEscrowRefundTooEarly {
+		t.Errorf("early refund = %d %q, want 409 %s", recorder.Code, response.Code, models.ErrCodeEscrowRefundTooEarly)
+	}
+
+	release := jsonRequest(t, http.MethodPost, "/escrow/release", models.EscrowReleaseRequest{PrivateKey: testOwnerKey, Requester: requester, DatasetID: &datasetID})
+	if recorder := serve(http.MethodPost, "/escrow/release", h.ReleaseEscrow, release); recorder.Code != http.StatusOK {
+		t.Fatalf("release = %d %s", recorder.Code, recorder.Body)
+	}
+	if ok, err := h.chain.CheckAccess(owner, datasetID, requester); !ok || err != nil {
+		t.Errorf("access after the release = %v, %v, want granted", ok, err)
+	}
+	if balance, _ := h.chain.GetEscrowBalance(owner, datasetID, requester); balance != 0 {
+		t.Errorf("escrow after the release = %d, want 0", balance)
+	}
+
+	// Without a deposit nothing is released, and nothing granted
+	other := uint64(1)
+	h.submitTestDataset(t, testOwnerKey, "0x"+strings.Repeat("c", 64), "unpaid")
+	release = jsonRequest(t, http.MethodPost, "/escrow/release", models.EscrowReleaseRequest{PrivateKey: testOwnerKey, Requester: requester, DatasetID: &other})
+	if recorder := serve(http.MethodPost, "/escrow/release", h.ReleaseEscrow, release); recorder.Code != http.StatusNotFound {
+		t.Errorf("release without a deposit = %d, want 404", recorder.Code)
+	}
+	if ok, _ := h.chain.CheckAccess(owner, other, requester); ok {
+		t.Error("a release without a deposit granted access")
+	}
+}
+
+// initializationChain is the mock chain with the account check answering err
+type initializationChain struct {
+	*services.MockAptosService
+	err error
+}
+
+func (c initializationChain) IsAccountInitialized(userAddress string) (bool, error) {
+	return false, c.err
+}
+
+func TestCheckInitializationNeverAnswersFalseOnAFailedCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"node down", fmt.Errorf("failed to check the Vault resource: %w", services.ErrChainUnavailable), http.StatusServiceUnavailable, models.ErrCodeChainUnavailable},
+		{"node refusing", fmt.Errorf("unexpected status code: 403"), http.StatusBadGateway, ""},
+	}
+	for _, tc := range cases {
+		h := newTestHandler(t)
+		h.aptosService = initializationChain{MockAptosService: h.chain, err: tc.err}
+
+		request := jsonRequest(t, http.MethodPost, "/users/check-initialization", models.CheckInitializationRequest{User: addressOf(t, testOwnerKey)})
+		recorder := serve(http.MethodPost, "/users/check-initialization", h.CheckInitialization, request)
+
+		var response models.Response
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		if recorder.Code != tc.status || response.Code != tc.code || response.Success {
+			t.Errorf("%s: status %d code %q, want %d %q", tc.name, recorder.Code, response.Code, tc.status, tc.code)
+		}
+		if data, ok := response.Data.(map[string]any); ok {
+			t.Errorf("%s: answered %v", tc.name, data)
+		}
+	}
+}
+
+func TestBindAndValidateNormalizesAddresses(t *testing.T) {
+	type grant struct {
+		Requester string `json:"requester" binding:"required,aptos_address"`
+	}
+	var request struct {
+		Owner  string `json:"owner" binding:"required,aptos_address"`
+		Grant  grant  `json:"grant"`
+		Backup *grant `json:"backup"`
+		Note   string `json:"note"`
+	}
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = jsonRequest(t, http.MethodPost, "/", map[string]any{
+		"owner":  " 0XA550C18",
+		"grant":  map[string]string{"requester": "1"},
+		"backup": map[string]string{"requester": "0xCAFE"},
+		"note":   "0xA550C18",
+	})
+
+	if !bindAndValidate(c, &request) {
+		t.Fatalf("bindAndValidate refused short-form addresses: %s", recorder.Body.String())
+	}
+	want := map[string]string{
+		"owner":            "0x" + strings.Repeat("0", 57) + "a550c18",
+		"grant.requester":  "0x1",
+		"backup.requester": "0x" + strings.Repeat("0", 60) + "cafe",
+		"note":             "0xA550C18", // Not an address field
+	}
+	got := map[string]string{"owner": request.Owner, "grant.requester": request.Grant.Requester, "backup.requester": request.Backup.Requester, "note": request.Note}
+	for field, value := range want {
+		if got[field] != value {
+			t.Errorf("%s = %q, want %q", field, got[field], value)
+		}
+	}
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = jsonRequest(t, http.MethodPost, "/", map[string]any{"owner": "0x" + strings.Repeat("1", 65), "grant": map[string]string{"requester": "1"}})
+	if bindAndValidate(c, &request) {
+		t.Error("bindAndValidate accepted a 65-digit address")
+	}
+}
+
+// grantRequest is a grant of the owner's dataset to the requester, with the fields in body
+// replacing or, set to nil, removing the defaults
+func grantRequest(t *testing.T, requester string, body map[string]any) *http.Request {
+	t.Helper()
+	fields := map[string]any{"private_key": testOwnerKey, "dataset_id": 0, "requester": requester, "expires_at": 0}
+	for field, value := range body {
+		if value == nil {
+			delete(fields, field)
+		} else {
+			fields[field] = value
+		}
+	}
+	return jsonRequest(t, http.MethodPost, "/access/grant", fields)
+}
+
+func TestGrantAccessTellsZeroFromMissing(t *testing.T) {
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+
+	cases := []struct {
+		name      string
+		body      map[string]any
+		status    int
+		field     string // Field named in the validation failure
+		rule      string
+		expiresAt uint64 // Grant read back after a success; 0 never expires
+	}{
+		{"dataset 0 without expiry", map[string]any{}, http.StatusOK, "", "", 0},
+		{"dataset 0 until a future time", map[string]any{"expires_at": future}, http.StatusOK, "", "", uint64(future)},
+		{"expiry in the past", map[string]any{"expires_at": past}, http.StatusBadRequest, "expires_at", "deadline", 0},
+		{"expiry of 1", map[string]any{"expires_at": 1}, http.StatusBadRequest, "expires_at", "deadline", 0},
+		{"missing expires_at", map[string]any{"expires_at": nil}, http.StatusBadRequest, "expires_at", "required", 0},
+		{"missing dataset_id", map[string]any{"dataset_id": nil}, http.StatusBadRequest, "dataset_id", "required", 0},
+		{"dataset_id as a string", map[string]any{"dataset_id": "0"}, http.StatusBadRequest, "dataset_id", "type", 0},
+	}
+	for _, tc := range cases {
+		h := newTestHandler(t)
+		owner, requester := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+		h.submitTestDataset(t, testOwnerKey, strings.Repeat("a", 64), "first")
+
+		recorder := serve(http.MethodPost, "/access/grant", h.GrantAccess, grantRequest(t, requester, tc.body))
+		var response models.Response
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		if recorder.Code != tc.status {
+			t.Errorf("%s: grant = %d %s, want %d", tc.name, recorder.Code, response.Error, tc.status)
+			continue
+		}
+
+		grant, err := h.chain.GetAccessGrant(owner, 0, requester)
+		if tc.status != http.StatusOK {
+			if response.Code != models.ErrCodeValidationFailed || len(response.Details) != 1 ||
+				response.Details[0].Field != tc.field || response.Details[0].Rule != tc.rule {
+				t.Errorf("%s: refused with %q %+v, want %s failing %s", tc.name, response.Code, response.Details, tc.field, tc.rule)
+			}
+			if err == nil && grant != nil {
+				t.Errorf("%s: refused grant reached the chain: %+v", tc.name, grant)
+			}
+			continue
+		}
+		if err != nil || grant == nil || grant.ExpiresAt != tc.expiresAt {
+			t.Errorf("%s: grant on chain = %+v, %v, want dataset 0 expiring at %d", tc.name, grant, err, tc.expiresAt)
+		}
+
+		// Dataset 0 is an ordinary dataset to the read endpoints too
+		check := jsonRequest(t, http.MethodPost, "/access/check", map[string]any{"owner": owner, "dataset_id": 0, "requester": requester})
+		recorder = serve(http.MethodPost, "/access/check", h.CheckAccess, check)
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"has_access":true`) {
+			t.Errorf("%s: check of dataset 0 = %d %s, want access", tc.name, recorder.Code, recorder.Body)
+		}
+		dataset := jsonRequest(t, http.MethodPost, "/data/get-dataset", map[string]any{"user": owner, "dataset_id": 0})
+		recorder = serve(http.MethodPost, "/data/get-dataset", h.GetDataset, dataset)
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"first"`) {
+			t.Errorf("%s: get-dataset of dataset 0 = %d %s", tc.name, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestReleaseEscrowRefusesAPastExpiry(t *testing.T) {
+	h := newTestHandler(t)
+	owner, requester := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+	h.submitTestDataset(t, testOwnerKey, "0x"+strings.Repeat("a", 64), "paid")
+	if _, err := h.chain.DepositEscrow(testRequesterKey, owner, 0, 500); err != nil {
+		t.Fatalf("DepositEscrow: %v", err)
+	}
+
+	release := jsonRequest(t, http.MethodPost, "/escrow/release", map[string]any{
+		"private_key": testOwnerKey, "requester": requester, "dataset_id": 0, "expires_at": time.Now().Add(-time.Minute).Unix(),
+	})
+	recorder := serve(http.MethodPost, "/escrow/release", h.ReleaseEscrow, release)
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusBadRequest || len(response.Details) != 1 || response.Details[0].Field != "expires_at" {
+		t.Errorf("release with a past expiry = %d %+v, want 400 on expires_at", recorder.Code, response.Details)
+	}
+	if balance, _ := h.chain.GetEscrowBalance(owner, 0, requester); balance != 500 {
+		t.Errorf("escrow after a refused release = %d, want 500 kept", balance)
+	}
+}
+
+func TestSubmitCSVNormalizesTheAccountAddress(t *testing.T) {
+	h := newTestHandler(t)
+	owner := addressOf(t, testOwnerKey)
+
+	fields := h.signedUploadFields(t, owner, testOwnerKey)
+	fields["account_address"] = strings.ToUpper(strings.TrimPrefix(owner, "0x"))
+	status, response := h.submitCSV(t, fields, testCSV)
+	if status != http.StatusOK {
+		t.Fatalf("upload with an unprefixed upper-case address = %d %s", status, response.Error)
+	}
+	if manifest, _ := h.storage.RetrieveManifest(owner); len(manifest) != 1 {
+		t.Errorf("manifest of %s = %v, want the upload", owner, manifest)
+	}
+
+	fields = h.signedUploadFields(t, owner, testOwnerKey)
+	fields["account_address"] = "0xnot-an-address"
+	status, response = h.submitCSV(t, fields, testCSV)
+	if status != http.StatusBadRequest || response.Code != models.ErrCodeValidationFailed {
+		t.Errorf("invalid account_address = %d %q, want 400 %s", status, response.Code, models.ErrCodeValidationFailed)
+	}
+}
+
+const testSponsorKey = "ed25519-priv-0x3333333333333333333333333333333333333333333333333333333333333333"
+
+// withMinter makes privateKey the token's mint authority and turns sponsoring on, for one test
+func withMinter(t *testing.T, privateKey string) {
+	t.Helper()
+	moduleAddr, sponsorKey := config.AppConfig.DataXModuleAddr, config.AppConfig.SponsorPrivateKey
+	config.AppConfig.DataXModuleAddr, config.AppConfig.SponsorPrivateKey = addressOf(t, privateKey), testSponsorKey
+	t.Cleanup(func() {
+		config.AppConfig.DataXModuleAddr, config.AppConfig.SponsorPrivateKey = moduleAddr, sponsorKey
+	})
+}
+
+// cosign signs a sponsored transaction with privateKey as a wallet would and returns the BCS
+// hex of the authenticator
+func cosign(t *testing.T, privateKey string, rawTransaction string) string {
+	t.Helper()
+	rawBytes, err := hex.DecodeString(strings.TrimPrefix(rawTransaction, "0x"))
+	if err != nil {
+		t.Fatalf("raw_transaction is not hex: %v", err)
+	}
+	rawTxn := &aptos.RawTransactionWithData{}
+	rawTxn.UnmarshalTypeScriptBCS(bcs.NewDeserializer(rawBytes))
+
+	keyBytes, err := crypto.ParsePrivateKey(privateKey, crypto.PrivateKeyVariantEd25519)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey: %v", err)
+	}
+	key := &crypto.Ed25519PrivateKey{}
+	if err := key.FromBytes(keyBytes); err != nil {
+		t.Fatalf("FromBytes: %v", err)
+	}
+	authenticator, err := rawTxn.Sign(key)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	encoded, err := bcs.Serialize(authenticator)
+	if err != nil {
+		t.Fatalf("encode authenticator: %v", err)
+	}
+	return "0x" + hex.EncodeToString(encoded)
+}
+
+func (h *testHandler) mint(t *testing.T, request models.MintTokenRequest) (int, models.Response) {
+	t.Helper()
+	recorder := serve(http.MethodPost, "/token/mint", h.MintToken, jsonRequest(t, http.MethodPost, "/token/mint", request))
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+func TestMintTokenChecksTheMintAuthorityFirst(t *testing.T) {
+	h := newTestHandler(t)
+	withMinter(t, testOwnerKey)
+	recipient := addressOf(t, testRequesterKey)
+
+	status, response := h.mint(t, models.MintTokenRequest{PrivateKey: testRequesterKey, Recipient: recipient, Amount: 10, AutoRegister: true})
+	if status != http.StatusForbidden || response.Code != models.ErrCodeNotMintAuthority {
+		t.Errorf("mint by another key = %d %q, want 403 %s", status, response.Code, models.ErrCodeNotMintAuthority)
+	}
+	if response.Data != nil {
+		t.Errorf("a registration was handed out to a mint that can't succeed: %v", response.Data)
+	}
+}
+
+func TestMintTokenRegistersRecipientsThatCoSign(t *testing.T) {
+	h := newTestHandler(t)
+	withMinter(t, testOwnerKey)
+	recipient := addressOf(t, testRequesterKey)
+	request := models.MintTokenRequest{PrivateKey: testOwnerKey, Recipient: recipient, Amount: 10, AutoRegister: true}
+
+	status, response := h.mint(t, request)
+	if status != http.StatusConflict || response.Code != models.ErrCodeRecipientSignatureRequired {
+		t.Fatalf("first call = %d %q, want 409 %s", status, response.Code, models.ErrCodeRecipientSignatureRequired)
+	}
+	data, _ := response.Data.(map[string]any)
+	rawTransaction, _ := data["raw_transaction"].(string)
+	if data["sender"] != recipient || data["fee_payer"] != addressOf(t, testSponsorKey) || rawTransaction == "" {
+		t.Fatalf("registration = %v, want one sent by the recipient and paid by the sponsor", data)
+	}
+
+	// Signed by someone other than the recipient
+	request.RegisterTransaction, request.RecipientAuthenticator = rawTransaction, cosign(t, testOwnerKey, rawTransaction)
+	status, response = h.mint(t, request)
+	if status != http.StatusUnauthorized || response.Code != models.ErrCodeInvalidSignature {
+		t.Fatalf("forged co-signature = %d %q, want 401 %s", status, response.Code, models.ErrCodeInvalidSignature)
+	}
+	if registered, _ := h.chain.IsTokenRegistered(recipient); registered {
+		t.Fatal("a forged co-signature registered the recipient")
+	}
+
+	// A transaction is used once, so the forged attempt spent it and a new one is handed out
+	request.RecipientAuthenticator = cosign(t, testRequesterKey, rawTransaction)
+	status, response = h.mint(t, request)
+	if status != http.StatusConflict || response.Code != models.ErrCodeRecipientSignatureRequired {
+		t.Fatalf("reused transaction = %d %q, want a fresh 409 %s", status, response.Code, models.ErrCodeRecipientSignatureRequired)
+	}
+	data, _ = response.Data.(map[string]any)
+	rawTransaction, _ = data["raw_transaction"].(string)
+
+	request.RegisterTransaction, request.RecipientAuthenticator = rawTransaction, cosign(t, testRequesterKey, rawTransaction)
+	status, response = h.mint(t, request)
+	data, _ = response.Data.(map[string]any)
+	if status != http.StatusOK || data["hash"] == "" || data["register_hash"] == nil {
+		t.Fatalf("co-signed mint = %d %v (%s), want both hashes", status, data, response.Error)
+	}
+	if registered, _ := h.chain.IsTokenRegistered(recipient); !registered {
+		t.Error("recipient is not registered after the co-signed mint")
+	}
+}
+
+// checkHash asks /data/check-hash about dataHash, scoped to owner when it's set
+func (h *testHandler) checkHash(t *testing.T, dataHash string, owner string) (int, string, bool, []models.DatasetRef) {
+	t.Helper()
+	request := jsonRequest(t, http.MethodPost, "/data/check-hash", models.CheckDataHashRequest{DataHash: dataHash, Owner: owner})
+	recorder := serve(http.MethodPost, "/data/check-hash", h.CheckDataHash, request)
+	var response struct {
+		Data struct {
+			DataHash string              `json:"data_hash"`
+			Exists   bool                `json:"exists"`
+			Datasets []models.DatasetRef `json:"datasets"`
+		} `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response.Data.DataHash, response.Data.Exists, response.Data.Datasets
+}
+
+func TestCheckDataHashMatchesRegisteredHashes(t *testing.T) {
+	h := newTestHandler(t)
+	owner, other := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+	stored := h.storeTestDataset(t, testOwnerKey, testCSV, "stored")
+	// Registered on chain, but its blob was never uploaded
+	unstored := fmt.Sprintf("0x%064x", 0xabc)
+	h.submitTestDataset(t, testRequesterKey, unstored, "unstored")
+
+	cases := []struct {
+		name     string
+		dataHash string
+		owner    string
+		want     []models.DatasetRef
+	}{
+		{"match", stored, "", []models.DatasetRef{{Owner: owner, DatasetID: 0}}},
+		{"match in uppercase without 0x", strings.ToUpper(strings.TrimPrefix(stored, "0x")), "", []models.DatasetRef{{Owner: owner, DatasetID: 0}}},
+		{"match scoped to its owner", stored, owner, []models.DatasetRef{{Owner: owner, DatasetID: 0}}},
+		{"match scoped to another owner", stored, other, nil},
+		{"mismatch", fmt.Sprintf("0x%064x", 0xdef), "", nil},
+		{"missing blob", unstored, "", []models.DatasetRef{{Owner: other, DatasetID: 0}}},
+	}
+	for _, tc := range cases {
+		status, dataHash, exists, datasets := h.checkHash(t, tc.dataHash, tc.owner)
+		if status != http.StatusOK {
+			t.Errorf("%s: check-hash = %d, want 200", tc.name, status)
+			continue
+		}
+		if dataHash != services.NormalizeDataHash(tc.dataHash) {
+			t.Errorf("%s: data_hash = %q, want it normalized", tc.name, dataHash)
+		}
+		if exists != (len(tc.want) > 0) || len(datasets) != len(tc.want) || (len(tc.want) > 0 && !reflect.DeepEqual(datasets, tc.want)) {
+			t.Errorf("%s: exists %v, datasets %+v, want %+v", tc.name, exists, datasets, tc.want)
+		}
+	}
+
+	if status, _, _, _ := h.checkHash(t, "not-a-hash", ""); status != http.StatusBadRequest {
+		t.Errorf("check-hash of a non-hex hash = %d, want 400", status)
+	}
+}
+
+// listAllGrants posts body to /access/list-all
+func (h *testHandler) listAllGrants(t *testing.T, body models.ListAllGrantsRequest) (int, []models.AccessGrant) {
+	t.Helper()
+	request := jsonRequest(t, http.MethodPost, "/access/list-all", body)
+	recorder := serve(http.MethodPost, "/access/list-all", h.ListAllGrants, request)
+	var response struct {
+		Data []models.AccessGrant `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response.Data
+}
+
+func TestListAllGrantsAcrossDatasets(t *testing.T) {
+	h := newTestHandler(t)
+	owner, requester := addressOf(t, testOwnerKey), addressOf(t, testRequesterKey)
+	other := "0x" + strings.Repeat("0", 60) + "c003"
+	h.submitTestDataset(t, testOwnerKey, fmt.Sprintf("0x%064x", 1), "weather")
+	h.submitTestDataset(t, testOwnerKey, fmt.Sprintf("0x%064x", 2), "traffic")
+	for _, grant := range []struct {
+		datasetID uint64
+		requester string
+		expiresAt uint64
+	}{
+		{1, requester, 100}, // Long expired
+		{0, requester, 0},
+		{0, other, uint64(time.Now().Add(time.Hour).Unix())},
+	} {
+		if _, err := h.chain.GrantAccess(testOwnerKey, grant.datasetID, grant.requester, grant.expiresAt); err != nil {
+			t.Fatalf("GrantAccess: %v", err)
+		}
+	}
+	// The requester's grant on dataset 0 came from an approved access request
+	h.accessRequests.Create(models.AccessRequest{OwnerAddress: owner, RequesterAddress: requester, DatasetID: 0})
+	approved, err := h.accessRequests.Transition(owner, requester, 0, services.AccessRequestPending, services.AccessRequestApproved, nil)
+	if err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		requester string
+		status    string
+		want      []string // dataset_id:requester, in order
+	}{
+		{"everything", "", "", []string{"0:" + other, "0:" + requester, "1:" + requester}},
+		{"one requester", requester, "", []string{"0:" + requester, "1:" + requester}},
+		{"active", "", "active", []string{"0:" + other, "0:" + requester}},
+		{"expired", "", "expired", []string{"1:" + requester}},
+		{"one requester's active grants", requester, "active", []string{"0:" + requester}},
+	}
+	for _, tc := range cases {
+		status, grants := h.listAllGrants(t, models.ListAllGrantsRequest{Owner: owner, Requester: tc.requester, Status: tc.status})
+		if status != http.StatusOK {
+			t.Errorf("%s: list-all = %d, want 200", tc.name, status)
+			continue
+		}
+		got := make([]string, 0, len(grants))
+		for _, grant := range grants {
+			got = append(got, fmt.Sprintf("%d:%s", grant.DatasetID, grant.Requester))
+			wantName := map[uint64]string{0: "weather", 1: "traffic"}[grant.DatasetID]
+			if grant.DatasetName != wantName || grant.Expired != (grant.DatasetID == 1) {
+				t.Errorf("%s: grant %+v, want it named %q and expired only on dataset 1", tc.name, grant, wantName)
+			}
+			wantGrantedAt := ""
+			if grant.DatasetID == 0 && grant.Requester == requester {
+				wantGrantedAt = approved.ApprovedAt
+			}
+			if grant.GrantedAt != wantGrantedAt {
+				t.Errorf("%s: grant %+v granted_at %q, want %q", tc.name, grant, grant.GrantedAt, wantGrantedAt)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: grants = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if status, _ := h.listAllGrants(t, models.ListAllGrantsRequest{Owner: owner, Status: "revoked"}); status != http.StatusBadRequest {
+		t.Errorf("list-all with an unknown status = %d, want 400", status)
+	}
+}
+
+// requireCleanFailure fails unless a GetCSVData answer is a JSON error response carrying no rows
+func requireCleanFailure(t *testing.T, name string, status int, response models.Response, wantStatus int, wantCode string) {
+	t.Helper()
+	if status != wantStatus || response.Success || response.Error == "" || response.Data != nil {
+		t.Errorf("%s: get-csv = %d %+v, want a %d error without data", name, status, response, wantStatus)
+	}
+	if wantCode != "" && response.Code != wantCode {
+		t.Errorf("%s: code = %q, want %s", name, response.Code, wantCode)
+	}
+}
+
+func TestGetCSVDataRefusesCorruptedBlobs(t *testing.T) {
+	sum := sha256.Sum256([]byte(testCSV))
+	dataHash := "0x" + hex.EncodeToString(sum[:])
+	cases := []struct {
+		name       string
+		content    string
+		wantStatus int
+		wantCode   string
+	}{
+		{"altered row", strings.Replace(testCSV, "alpha", "ALTERED", 1), http.StatusConflict, models.ErrCodeIntegrityMismatch},
+		{"truncated after a row", testCSV[:strings.Index(testCSV, "3,gamma")], http.StatusConflict, models.ErrCodeIntegrityMismatch},
+		{"truncated mid-row", testCSV[:len(testCSV)-4], http.StatusConflict, models.ErrCodeIntegrityMismatch},
+		{"truncated in a quoted field", "id,name\n1,\"alp", http.StatusNotFound, models.ErrCodeBlobNotFound},
+		{"binary garbage", "\x00\xff\xfe\"\x00,\n\x1f\x8b", http.StatusNotFound, models.ErrCodeBlobNotFound},
+		{"empty", "", http.StatusConflict, models.ErrCodeIntegrityMismatch},
+	}
+	for _, tc := range cases {
+		h := newTestHandler(t)
+		owner := addressOf(t, testOwnerKey)
+		h.submitTestDataset(t, testOwnerKey, dataHash, "corrupted")
+		blobName := h.writeTestBlob(t, owner+"/1700000000_"+hex.EncodeToString(sum[:])+".csv", tc.content)
+		if err := h.storage.UpdateManifest(owner, dataHash, models.BlobManifestEntry{BlobName: blobName}); err != nil {
+			t.Fatalf("UpdateManifest: %v", err)
+		}
+
+		status, response := h.getCSVData(t, owner, dataHash, owner, h.signProof(t, owner, testOwnerKey))
+		requireCleanFailure(t, tc.name, status, response, tc.wantStatus, tc.wantCode)
+	}
+}
+
+func TestGetCSVDataRefusesCorruptedSealedBlobs(t *testing.T) {
+	masterKey := config.AppConfig.EncryptionMasterKey
+	config.AppConfig.EncryptionMasterKey = strings.Repeat("ab", 32)
+	t.Cleanup(func() { config.AppConfig.EncryptionMasterKey = masterKey })
+
+	sum := sha256.Sum256([]byte(testCSV))
+	dataHash := "0x" + hex.EncodeToString(sum[:])
+	cases := []struct {
+		name    string
+		corrupt func(sealed []byte) []byte
+	}{
+		{"truncated", func(sealed []byte) []byte { return sealed[:len(sealed)/2] }},
+		{"last byte cut", func(sealed []byte) []byte { return sealed[:len(sealed)-1] }},
+		{"flipped bit", func(sealed []byte) []byte { sealed[len(sealed)-1] ^= 1; return sealed }},
+		{"emptied", func(sealed []byte) []byte { return nil }},
+	}
+	for _, tc := range cases {
+		h := newTestHandler(t)
+		owner := addressOf(t, testOwnerKey)
+		if status, response := h.submitCSV(t, h.signedUploadFields(t, owner, testOwnerKey), testCSV); status != http.StatusOK {
+			t.Fatalf("upload = %d %s", status, response.Error)
+		}
+		h.submitTestDataset(t, testOwnerKey, dataHash, "sealed")
+		manifest, _ := h.storage.RetrieveManifest(owner)
+		blobPath := filepath.Join(h.root, manifest[dataHash].BlobName)
+		sealed, err := os.ReadFile(blobPath)
+		if err != nil {
+			t.Fatalf("read sealed blob: %v", err)
+		}
+		if err := os.WriteFile(blobPath, tc.corrupt(sealed), 0o644); err != nil {
+			t.Fatalf("corrupt sealed blob: %v", err)
+		}
+
+		// The envelope fails to open, so nothing decrypted is served
+		status, response := h.getCSVData(t, owner, dataHash, owner, h.signProof(t, owner, testOwnerKey))
+		requireCleanFailure(t, tc.name, status, response, http.StatusNotFound, models.ErrCodeBlobNotFound)
+	}
+}
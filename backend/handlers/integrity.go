@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// newCanonicalCSVWriter returns the writer that defines canonical CSV bytes, the input to
+// every data hash the server computes:
+//   - comma delimiter, whatever delimiter the upload used
+//   - fields quoted only when they contain a comma, quote, line break or leading space
+//   - every record, the last one included, terminated by a single "\n" (never "\r\n")
+//
+// streamCSV writes these bytes to storage at upload and canonicalCSV re-creates them from
+// parsed records when data is served, so the two hashes agree
+func newCanonicalCSVWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	writer.Comma = ','
+	writer.UseCRLF = false
+	return writer
+}
+
+// canonicalCSV encodes records in the canonical form
+func canonicalCSV(records [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := newCanonicalCSVWriter(&buf)
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalCSVStreamHash returns the canonicalCSVHash of the records read from r, encoding
+// them as they are read
+func canonicalCSVStreamHash(r io.Reader) (string, error) {
+	hasher := sha256.New()
+	writer := newCanonicalCSVWriter(hasher)
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := writer.Write(record); err != nil {
+			return "", err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", err
+	}
+	return "0x" + hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// canonicalCSVHash returns "0x" + the hex SHA-256 of canonical CSV bytes
+func canonicalCSVHash(canonical []byte) string {
+	sum := sha256.Sum256(canonical)
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+// datasetDataHash returns the data hash registered on chain for a dataset, or "" when it
+// can't be read
+func (h *Handler) datasetDataHash(owner string, datasetID uint64) string {
+	datasetRaw, err := h.aptosService.GetDataset(owner, datasetID)
+	if err != nil {
+		fmt.Printf("DEBUG: Could not read dataset %d of %s: %v\n", datasetID, owner, err)
+		return ""
+	}
+	datasetMap, _ := datasetRaw.(map[string]interface{})
+	dataHash, _ := datasetMap["data_hash"].(string)
+	if dataHash == "0x" {
+		return ""
+	}
+	return dataHash
+}
+
+// verifyDatasetIntegrity checks that records served for a dataset hash to its on-chain data
+// hash, either canonically, the way the upload page hashed datasets before the server
+// computed it, or as the digest of the blob's CID. On mismatch it writes a 409 and returns false, unless INTEGRITY_WARN_ONLY is
+// set. Datasets whose on-chain hash can't be read are served unverified
+func (h *Handler) verifyDatasetIntegrity(c *gin.Context, owner string, datasetID uint64, blobName string, records [][]string) bool {
+	onChainHash := services.NormalizeDataHash(h.datasetDataHash(owner, datasetID))
+	if onChainHash == "" {
+		fmt.Printf("DEBUG: No on-chain data hash for dataset %d of %s, serving %s unverified\n", datasetID, owner, blobName)
+		return true
+	}
+
+	// A blob named by a CID whose digest is the on-chain hash was verified block by block as
+	// IPFS served it
+	if cidHash, err := services.CIDDataHash(blobName); err == nil && cidHash == onChainHash {
+		return true
+	}
+
+	canonical, err := canonicalCSV(records)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to encode %s for integrity check: %v\n", blobName, err)
+		return true
+	}
+	computed := canonicalCSVHash(canonical)
+	if computed == onChainHash || services.FrontendDataHash(canonical) == onChainHash {
+		return true
+	}
+
+	fmt.Printf("ERROR: Integrity mismatch for dataset %d of %s: blob %s hashes to %s, on-chain data hash is %s\n", datasetID, owner, blobName, computed, onChainHash)
+	if config.AppConfig.IntegrityWarnOnly {
+		fmt.Printf("WARNING: Serving dataset %d despite integrity mismatch (INTEGRITY_WARN_ONLY)\n", datasetID)
+		return true
+	}
+
+	c.JSON(http.StatusConflict, models.Response{
+		Success: false,
+		Error:   fmt.Sprintf("Stored data does not match the on-chain data hash %s", onChainHash),
+		Code:    models.ErrCodeIntegrityMismatch,
+	})
+	return false
+}
+
+// checkClientDataHash compares an optional client-supplied data_hash with the hash computed
+// from the stored bytes. A mismatch writes a 422 carrying the computed hash and returns
+// false; with REJECT_DATA_HASH_MISMATCH=false it is only logged
+func checkClientDataHash(c *gin.Context, clientHash string, computedHash string, blobName string) bool {
+	if clientHash == "" || services.NormalizeDataHash(clientHash) == computedHash {
+		return true
+	}
+
+	fmt.Printf("WARNING: Client data hash %s for %s differs from computed %s\n", clientHash, blobName, computedHash)
+	if !config.AppConfig.RejectDataHashMismatch {
+		return true
+	}
+	c.JSON(http.StatusUnprocessableEntity, models.Response{
+		Success: false,
+		Error:   fmt.Sprintf("data_hash %s does not match the uploaded data, whose hash is %s", clientHash, computedHash),
+		Code:    models.ErrCodeDataHashMismatch,
+		Data:    map[string]string{"data_hash": computedHash},
+	})
+	return false
+}
+
+// byteCounter is an io.Writer that only counts what is written to it
+type byteCounter int64
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	*b += byteCounter(len(p))
+	return len(p), nil
+}
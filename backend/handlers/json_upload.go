@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/datax/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// flattenedJSON is a JSON upload converted to CSV rows
+type flattenedJSON struct {
+	header     []string
+	rows       [][]string
+	nestedKeys []string // Dotted columns generated from nested objects
+	violations []models.CSVViolation
+}
+
+// SubmitJSON handles NDJSON or JSON-array dataset uploads
+// Each record must be a JSON object. Records are flattened to one CSV row each and then
+// stored exactly like a CSV upload, so retrieval code sees a normal CSV blob:
+//   - nested objects become dotted columns ({"a": {"b": 1}} -> column "a.b")
+//   - arrays are kept as their JSON text in a single cell
+//   - null and missing fields become empty cells
+//
+// Columns appear in the order their keys are first seen
+func (h *Handler) SubmitJSON(c *gin.Context) {
+	if !limitUploadBody(c) {
+		return
+	}
+
+	fields, filePart, err := readUploadForm(c.Request, "json_file")
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	if filePart == nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Missing JSON file: json_file",
+		})
+		return
+	}
+
+	if !h.requireUploadFields(c, fields, "json_file") || !checkDatasetMetadata(c, fields["metadata"]) {
+		return
+	}
+
+	flattened, err := flattenJSONUpload(filePart, uploadOptions().maxRows)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if len(flattened.violations) > 0 {
+		respondCSVInvalid(c, models.CSVValidationReport{
+			Violations: flattened.violations,
+			Truncated:  len(flattened.violations) >= maxReportedViolations,
+		})
+		return
+	}
+
+	// Feed the flattened rows through the CSV upload path
+	pr, pw := io.Pipe()
+	go func() {
+		writer := csv.NewWriter(pw)
+		writer.Write(flattened.header)
+		writer.WriteAll(flattened.rows)
+		pw.CloseWithError(writer.Error())
+	}()
+	defer pr.Close()
+
+	h.ingestCSV(c, fields, pr, uploadOptions(), map[string]interface{}{
+		"records_flattened": len(flattened.rows),
+		"nested_keys":       flattened.nestedKeys,
+	})
+}
+
+// flattenJSONUpload reads a JSON array of objects or newline-delimited objects and
+// flattens them into CSV rows. Decoding stops past maxRows records; streamCSV reports
+// the limit when the rows are ingested
+func flattenJSONUpload(r io.Reader, maxRows int) (*flattenedJSON, error) {
+	buffered := bufio.NewReader(r)
+	decoder := json.NewDecoder(buffered)
+	decoder.UseNumber()
+
+	result := &flattenedJSON{nestedKeys: []string{}}
+	violate := func(record int, format string, args ...interface{}) {
+		if len(result.violations) < maxReportedViolations {
+			result.violations = append(result.violations, models.CSVViolation{
+				Row:     record,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+	}
+
+	// A leading '[' means a JSON array; anything else is read as a stream of values (NDJSON)
+	isArray := false
+	if first, err := peekNonSpace(buffered); err == nil && first == '[' {
+		isArray = true
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	columns := make(map[string]int)
+	nested := make(map[string]bool)
+	var records []map[string]string
+
+	for record := 1; len(records) <= maxRows; record++ {
+		if isArray && !decoder.More() {
+			break
+		}
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF && !isArray {
+				break
+			}
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return nil, err
+			}
+			violate(record, "record %d is not valid JSON: %v", record, err)
+			break
+		}
+
+		row := make(map[string]string)
+		var order []string
+		emit := func(column string, value string, isNested bool) {
+			if _, dup := row[column]; !dup {
+				order = append(order, column)
+			}
+			row[column] = value
+			if isNested {
+				nested[column] = true
+			}
+		}
+		if !isJSONObject(raw) {
+			violate(record, "record %d is not a JSON object", record)
+			continue
+		}
+		if err := flattenJSONObject("", raw, emit); err != nil {
+			violate(record, "record %d could not be flattened: %v", record, err)
+			continue
+		}
+
+		for _, key := range order {
+			if _, seen := columns[key]; !seen {
+				columns[key] = len(result.header)
+				result.header = append(result.header, key)
+			}
+		}
+		records = append(records, row)
+	}
+
+	if len(records) == 0 && len(result.violations) == 0 {
+		violate(0, "file contains no records")
+	}
+
+	result.rows = make([][]string, len(records))
+	for i, row := range records {
+		cells := make([]string, len(result.header))
+		for key, value := range row {
+			cells[columns[key]] = value
+		}
+		result.rows[i] = cells
+	}
+	for _, key := range result.header {
+		if nested[key] {
+			result.nestedKeys = append(result.nestedKeys, key)
+		}
+	}
+	return result, nil
+}
+
+// flattenJSONObject walks a JSON object in key order, emitting one cell per leaf
+// Nested objects recurse with a dotted prefix; arrays are emitted as compact JSON text
+func flattenJSONObject(prefix string, raw json.RawMessage, emit func(column string, value string, nested bool)) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if _, err := decoder.Token(); err != nil { // '{'
+		return err
+	}
+
+	for decoder.More() {
+		keyToken, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := keyToken.(string)
+		column := key
+		if prefix != "" {
+			column = prefix + "." + key
+		}
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+
+		switch {
+		case isJSONObject(value):
+			if err := flattenJSONObject(column, value, emit); err != nil {
+				return err
+			}
+		case bytes.HasPrefix(bytes.TrimSpace(value), []byte("[")):
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, value); err != nil {
+				return err
+			}
+			emit(column, compacted.String(), prefix != "")
+		default:
+			var scalar interface{}
+			scalarDecoder := json.NewDecoder(bytes.NewReader(value))
+			scalarDecoder.UseNumber()
+			if err := scalarDecoder.Decode(&scalar); err != nil {
+				return err
+			}
+			cell := ""
+			if scalar != nil {
+				cell = fmt.Sprint(scalar) // string, json.Number, or bool
+			}
+			emit(column, cell, prefix != "")
+		}
+	}
+	return nil
+}
+
+func isJSONObject(raw json.RawMessage) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{"))
+}
+
+// peekNonSpace returns the first non-whitespace byte without consuming it
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+			return b[0], nil
+		}
+		r.ReadByte()
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Ed25519 seeds of the accounts used across the handler tests
+const (
+	testOwnerKey     = "ed25519-priv-0x1111111111111111111111111111111111111111111111111111111111111111"
+	testRequesterKey = "ed25519-priv-0x2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Setenv("STORAGE_BACKEND", "local")
+	if err := config.LoadConfig(); err != nil {
+		fmt.Printf("test config did not validate: %v\n", err)
+	}
+	if err := RegisterValidators(); err != nil {
+		fmt.Printf("failed to register validators: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// testHandler is a Handler on the mock chain and local storage in a temporary directory
+type testHandler struct {
+	*Handler
+	chain   *services.MockAptosService
+	storage services.StorageService
+	root    string // Directory the local storage keeps blobs in
+}
+
+func newTestHandler(t testing.TB) *testHandler {
+	t.Helper()
+	chain, err := services.NewMockAptosService("")
+	if err != nil {
+		t.Fatalf("NewMockAptosService: %v", err)
+	}
+	root := t.TempDir()
+	storage := services.NewLocalStorageService(root)
+	// Without a state store the webhooks, access requests and audit log are kept in memory
+	handler := NewHandler(chain, storage, services.NewWalletAuthService(), services.NewWebhookService(nil),
+		services.NewStateAccessRequestRepository(nil), services.NewAccessTokenService(),
+		services.NewAuditLog(services.NewStateAuditLogRepository(nil)), nil)
+	return &testHandler{Handler: handler, chain: chain, storage: storage, root: root}
+}
+
+// addressOf is the account address a test key signs for
+func addressOf(t testing.TB, privateKey string) string {
+	t.Helper()
+	address, err := services.AddressFromPrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("AddressFromPrivateKey: %v", err)
+	}
+	return address
+}
+
+// submitTestDataset initializes the key's account when needed and registers a dataset
+func (h *testHandler) submitTestDataset(t testing.TB, privateKey string, dataHash string, name string) {
+	t.Helper()
+	h.submitTestDatasetMetadata(t, privateKey, dataHash, fmt.Sprintf(`{"name":%q,"description":"test"}`, name))
+}
+
+// submitTestDatasetMetadata registers a dataset on chain with the given metadata JSON
+func (h *testHandler) submitTestDatasetMetadata(t testing.TB, privateKey string, dataHash string, metadata string) {
+	t.Helper()
+	if ok, _ := h.chain.IsAccountInitialized(addressOf(t, privateKey)); !ok {
+		if _, err := h.chain.InitializeUser(privateKey); err != nil {
+			t.Fatalf("InitializeUser: %v", err)
+		}
+	}
+	if _, err := h.chain.SubmitData(privateKey, dataHash, metadata); err != nil {
+		t.Fatalf("SubmitData: %v", err)
+	}
+}
+
+// storeTestDataset stores canonical CSV text as an upload would and registers it on chain
+// under its SHA-256, returning that data hash
+func (h *testHandler) storeTestDataset(t testing.TB, privateKey string, csvText string, name string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(csvText))
+	dataHash := "0x" + hex.EncodeToString(sum[:])
+	if _, err := h.storage.StoreCSVStream(addressOf(t, privateKey), dataHash, strings.NewReader(csvText)); err != nil {
+		t.Fatalf("StoreCSVStream: %v", err)
+	}
+	h.submitTestDataset(t, privateKey, dataHash, name)
+	return dataHash
+}
+
+// writeTestBlob writes a blob file straight into the local storage directory, bypassing
+// the content addressing uploads get, and returns its blob name
+func (h *testHandler) writeTestBlob(t testing.TB, blobName string, content string) string {
+	t.Helper()
+	filePath := filepath.Join(h.root, filepath.FromSlash(blobName))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		t.Fatalf("create blob directory: %v", err)
+	}
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("write blob: %v", err)
+	}
+	return blobName
+}
+
+// serve sends one request through a router holding only the given route
+func serve(method string, path string, handler gin.HandlerFunc, request *http.Request) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(method, path, handler)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// jsonRequest builds a request with body encoded as JSON
+func jsonRequest(t testing.TB, method string, target string, body interface{}) *http.Request {
+	t.Helper()
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("encode request: %v", err)
+	}
+	request := httptest.NewRequest(method, target, bytes.NewReader(encoded))
+	request.Header.Set("Content-Type", "application/json")
+	return request
+}
+
+// signProof asks for a challenge for address and signs it with privateKey, as a wallet would
+func (h *testHandler) signProof(t testing.TB, address string, privateKey string) models.DataAccessProof {
+	t.Helper()
+	challenge, err := h.walletAuth.IssueChallenge(address)
+	if err != nil {
+		t.Fatalf("IssueChallenge: %v", err)
+	}
+	seed, err := hex.DecodeString(privateKey[strings.LastIndex(privateKey, "0x")+2:])
+	if err != nil {
+		t.Fatalf("decode test key: %v", err)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	message := challenge.Message + "\nnonce: " + challenge.Nonce
+	return models.DataAccessProof{
+		Nonce:         challenge.Nonce,
+		SignedMessage: message,
+		PublicKey:     hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature:     hex.EncodeToString(ed25519.Sign(key, []byte(message))),
+	}
+}
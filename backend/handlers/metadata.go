@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// metadataText returns the dataset metadata a JSON body carried: the content of a JSON
+// string, which is how it goes on chain, or an object as sent. null is no metadata
+func metadataText(raw json.RawMessage) string {
+	if strings.TrimSpace(string(raw)) == "null" {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	return string(raw)
+}
+
+// checkDatasetMetadata answers 422 METADATA_INVALID, listing the fields at fault, when
+// metadata breaks the dataset metadata schema. Requests without metadata pass: it is only
+// checked when the client sends what it will submit on chain
+func checkDatasetMetadata(c *gin.Context, metadata string) bool {
+	if strings.TrimSpace(metadata) == "" {
+		return true
+	}
+	details := services.ValidateDatasetMetadata(metadata)
+	if len(details) == 0 {
+		return true
+	}
+
+	messages := make([]string, len(details))
+	for i, detail := range details {
+		messages[i] = detail.Message
+	}
+	c.JSON(http.StatusUnprocessableEntity, models.Response{
+		Success: false,
+		Error:   strings.Join(messages, "; "),
+		Code:    models.ErrCodeMetadataInvalid,
+		Details: details,
+	})
+	return false
+}
+
+// ValidateMetadata handles POST /api/v1/data/validate-metadata, checking dataset metadata
+// against its JSON Schema without storing anything, so a form can be checked as it is
+// filled in. Conforming metadata is returned as the marketplace will read it
+func (h *Handler) ValidateMetadata(c *gin.Context) {
+	var req models.ValidateMetadataRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	metadata := metadataText(req.Metadata)
+	if strings.TrimSpace(metadata) == "" {
+		// An empty string would otherwise pass as "no metadata sent"
+		metadata = `""`
+	}
+	if !checkDatasetMetadata(c, metadata) {
+		return
+	}
+
+	meta, _ := services.ParseDatasetMetadata(metadata)
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "Metadata is valid",
+		Data:    meta,
+	})
+}
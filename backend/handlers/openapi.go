@@ -0,0 +1,558 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/datax/backend/internal/openapi"
+	"github.com/datax/backend/middleware"
+	"github.com/datax/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// SetAPISpec sets the OpenAPI document served by OpenAPISpec, built once the routes are registered
+func (h *Handler) SetAPISpec(spec []byte) {
+	h.apiSpec = spec
+}
+
+// OpenAPISpec serves the OpenAPI document describing every route
+func (h *Handler) OpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", h.apiSpec)
+}
+
+// APIDocs renders the OpenAPI document with Redoc
+func (h *Handler) APIDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(apiDocsPage))
+}
+
+const apiDocsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>DataX API</title>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+  <redoc spec-url="/api/v1/openapi.json"></redoc>
+  <script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+// Form fields shared by the dataset upload endpoints, which read them in order while
+// streaming, so they must come before the file
+var (
+	uploadAccountField  = openapi.Param{Name: "account_address", Required: true, Description: "Owner of the dataset; must be sent before the file"}
+	uploadHashField     = openapi.Param{Name: "data_hash", Description: "Hash to register on chain; the server computes the authoritative one and rejects a mismatch with 422 DATA_HASH_MISMATCH"}
+	uploadSchemaField   = openapi.Param{Name: "schema", Description: "Column schema as JSON; inferred from the rows when omitted"}
+	uploadCIDField      = openapi.Param{Name: "use_cid_hash", Type: "boolean", Description: "With IPFS storage, return the CID's SHA-256 digest as data_hash"}
+	uploadMetadataField = openapi.Param{Name: "metadata", Description: "Dataset metadata JSON to be submitted on chain; a value breaking its schema fails the upload with 422 METADATA_INVALID"}
+)
+
+// uploadSignature is the account_address wallet signature every upload sends as form fields
+var uploadSignature = []openapi.Param{
+	{Name: "nonce", Required: true, Description: "Nonce from /api/v1/auth/challenge for account_address"},
+	{Name: "signed_message", Required: true, Description: "Exact text the wallet signed, containing the nonce"},
+	{Name: "public_key", Required: true, Description: "Ed25519 public key (hex)"},
+	{Name: "signature", Required: true, Description: "Ed25519 signature (hex)"},
+}
+
+// uploadForm lists an upload's form fields: account_address and its signature, then fields
+func uploadForm(fields ...openapi.Param) []openapi.Param {
+	return append(append([]openapi.Param{uploadAccountField}, uploadSignature...), fields...)
+}
+
+// Query parameters of the marketplace listing, served on v1 and v2
+var marketplaceQuery = []openapi.Param{
+	{Name: "q", Description: "Full-text search over names, descriptions and tags"},
+	{Name: "owner", Description: "Only this owner's datasets"},
+	{Name: "category", Description: "Category (case-insensitive)"},
+	{Name: "tags", Description: "Comma-separated or repeated; all must match"},
+	{Name: "created_after", Type: "integer", Description: "Unix timestamp"},
+	{Name: "created_before", Type: "integer", Description: "Unix timestamp"},
+	{Name: "include_inactive", Type: "boolean"},
+	{Name: "limit", Type: "integer", Description: "Page size, 1 to 200"},
+	{Name: "cursor", Description: "next_cursor of the previous page"},
+	{Name: "envelope", Type: "boolean", Description: "Return a page envelope even without paging"},
+}
+
+// Headers carrying the wallet signature of protected /api/v2 reads
+var walletSignatureHeaders = []openapi.Param{
+	{Name: headerWalletNonce, Required: true, Description: "Nonce from /api/v1/auth/challenge"},
+	{Name: headerWalletSignedMessage, Required: true, Description: "Exact text the wallet signed"},
+	{Name: headerWalletPublicKey, Required: true, Description: "Ed25519 public key (hex)"},
+	{Name: headerWalletSignature, Required: true, Description: "Ed25519 signature (hex)"},
+}
+
+// Header carrying the admin credential of /api/v1/admin routes
+var adminKeyHeader = []openapi.Param{
+	{Name: middleware.AdminKeyHeader, Required: true, Description: "One of the keys in ADMIN_API_KEYS; the admin routes answer 403 ADMIN_DISABLED when none is set"},
+}
+
+// APIOperations documents every route registered in main. openapi.Build refuses a router
+// with a route missing here, so a new endpoint needs an entry before the server starts
+func APIOperations() map[string]openapi.Operation {
+	key := openapi.Key
+	return map[string]openapi.Operation{
+		// Service
+		key(http.MethodGet, "/health"): {
+			Summary: "Service health", Tag: "Service", Public: true,
+			Description: "Reports the storage backend, chain, key provider and event index; 503 while a dependency is down.",
+			Errors:      []int{http.StatusServiceUnavailable},
+		},
+		key(http.MethodGet, "/docs"): {
+			Summary: "API documentation", Tag: "Service", Public: true,
+			RawResponse: []string{"text/html"},
+		},
+		key(http.MethodGet, "/api/v1/openapi.json"): {
+			Summary: "This OpenAPI document", Tag: "Service", Public: true,
+			RawResponse: []string{"application/json"},
+		},
+
+		// Wallet signature challenge
+		key(http.MethodPost, "/api/v1/auth/challenge"): {
+			Summary: "Issue a nonce to sign", Tag: "Auth",
+			Description: "Returns the nonce and message a wallet signs to prove control of an address to the endpoints that take a wallet signature.",
+			Request:     models.AuthChallengeRequest{}, Response: models.AuthChallenge{},
+		},
+
+		// User initialization
+		key(http.MethodPost, "/api/v1/users/initialize"): {
+			Summary: "Initialize a user's data store and vault", Tag: "Users", PrivateKey: true, Idempotent: true,
+			Request: models.InitializeUserRequest{}, Response: models.TransactionResponse{},
+		},
+		key(http.MethodPost, "/api/v1/users/check-initialization"): {
+			Summary: "Check whether a user is initialized", Tag: "Users",
+			Description: "initialized is false only when the node reports no Vault resource. When the node can't be reached the check fails with 503 CHAIN_UNAVAILABLE instead, and with 502 on any other node error.",
+			Request:     models.CheckInitializationRequest{},
+			Response:    models.InitializationInfo{},
+			Errors:      []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+		},
+
+		// Data operations
+		key(http.MethodPost, "/api/v1/data/delete"): {
+			Summary: "Delete a dataset", Tag: "Data", PrivateKey: true, Idempotent: true,
+			Request: models.DeleteDatasetRequest{}, Response: models.TransactionResponse{},
+		},
+		key(http.MethodPost, "/api/v1/data/reactivate"): {
+			Summary: "Reactivate a deleted dataset", Tag: "Data", PrivateKey: true, Idempotent: true,
+			Description: "Undoes /data/delete and puts the dataset back in the vault. Deleted datasets listed with can_reactivate can be reactivated.",
+			Request:     models.ReactivateDatasetRequest{}, Response: models.TransactionResponse{},
+			Errors: []int{http.StatusConflict, http.StatusGone},
+		},
+		key(http.MethodPost, "/api/v1/data/get"): {
+			Summary: "Get a dataset's on-chain record", Tag: "Data",
+			Request: models.GetDatasetRequest{},
+		},
+		key(http.MethodPost, "/api/v1/data/check-hash"): {
+			Summary: "Check whether a data hash is registered", Tag: "Data",
+			Request: models.CheckDataHashRequest{},
+		},
+
+		// Access control
+		key(http.MethodPost, "/api/v1/access/grant"): {
+			Summary: "Grant access to a requester", Tag: "Access", PrivateKey: true, Idempotent: true,
+			Description: "columns limits the grant to those header names: reads drop the others and name them in X-Withheld-Columns, and whole-blob reads get 403 COLUMNS_RESTRICTED. " +
+				"The restriction is stored off chain before the grant is submitted; a later grant without columns, or a revoke, clears it.",
+			Request: models.GrantAccessRequest{}, Response: models.TransactionResponse{},
+		},
+		key(http.MethodPost, "/api/v1/access/revoke"): {
+			Summary: "Revoke a requester's access", Tag: "Access", PrivateKey: true, Idempotent: true,
+			Request: models.RevokeAccessRequest{}, Response: models.TransactionResponse{},
+		},
+		key(http.MethodPost, "/api/v1/access/check"): {
+			Summary: "Check whether a requester has access", Tag: "Access",
+			Description: "Expiry is judged against the node's ledger timestamp, allowing ACCESS_EXPIRY_SKEW seconds. A requester without access has expired set when their grant has run out; otherwise there is no grant, because it was never made or was revoked.",
+			Request:     models.CheckAccessRequest{}, Response: models.AccessInfo{},
+		},
+		key(http.MethodPost, "/api/v1/access/list-all"): {
+			Summary: "List every grant an owner has issued", Tag: "Access",
+			Description: "Reads the owner's AccessControl resource once and returns its grants across datasets, sorted by dataset then requester, with dataset names from the metadata.",
+			Request:     models.ListAllGrantsRequest{}, Response: []models.AccessGrant{},
+		},
+		key(http.MethodPost, "/api/v1/access/my-datasets"): {
+			Summary: "List the datasets a requester has access to", Tag: "Access",
+			Description: "Grants found through the event index (SOURCE=local) and the requester's approved access requests are checked against each owner's AccessControl resource, so revoked and expired ones are left out. The list is cached for ACCESSIBLE_CACHE_TTL seconds.",
+			Request:     models.AccessibleDatasetsRequest{}, Response: models.AccessibleDatasetsPage{},
+		},
+		key(http.MethodPost, "/api/v1/access/wrapped-key"): {
+			Summary: "Fetch the data key wrapped for a requester", Tag: "Access", Signer: "requester",
+			Request: models.WrappedKeyRequest{}, Response: models.GranteeKey{},
+			Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusNotImplemented},
+		},
+
+		// Escrow
+		key(http.MethodPost, "/api/v1/escrow/deposit"): {
+			Summary: "Put APT in escrow for access to a dataset", Tag: "Escrow", PrivateKey: true, Idempotent: true,
+			Description: "Signed by the requester. amount is in octas; depositing again for the same dataset adds to the deposit.",
+			Request:     models.EscrowDepositRequest{}, Response: models.TransactionResponse{},
+		},
+		key(http.MethodPost, "/api/v1/escrow/release"): {
+			Summary: "Collect a requester's deposit", Tag: "Escrow", PrivateKey: true, Idempotent: true,
+			Description: "Signed by the owner. The requester is granted access until expires_at (0 never expires) " +
+				"in the same transaction, so the deposit is only paid out together with the grant.",
+			Request: models.EscrowReleaseRequest{}, Response: models.TransactionResponse{},
+			Errors: []int{http.StatusNotFound},
+		},
+		key(http.MethodPost, "/api/v1/escrow/refund"): {
+			Summary: "Take back a deposit the owner hasn't released", Tag: "Escrow", PrivateKey: true, Idempotent: true,
+			Description: "Signed by the requester. Refused with 409 until 7 days after the last deposit, which the owner has to release it.",
+			Request:     models.EscrowRefundRequest{}, Response: models.TransactionResponse{},
+			Errors: []int{http.StatusNotFound, http.StatusConflict},
+		},
+		key(http.MethodPost, "/api/v1/escrow/balance"): {
+			Summary: "Octas a requester holds in escrow for a dataset", Tag: "Escrow",
+			Request: models.EscrowBalanceRequest{}, Response: models.EscrowBalance{},
+		},
+
+		// Webhooks
+		key(http.MethodPost, "/api/v1/webhooks"): {
+			Summary: "Register a webhook", Tag: "Webhooks", Signer: "owner", Idempotent: true,
+			Description: "The response carries the secret once; later listings leave it out.",
+			Request:     models.RegisterWebhookRequest{}, Response: models.Webhook{},
+		},
+		key(http.MethodPost, "/api/v1/webhooks/list"): {
+			Summary: "List an owner's webhooks", Tag: "Webhooks", Signer: "owner",
+			Request: models.WebhookOwnerRequest{}, Response: []models.Webhook{},
+		},
+		key(http.MethodPost, "/api/v1/webhooks/delete"): {
+			Summary: "Delete a webhook", Tag: "Webhooks", Signer: "owner", Idempotent: true,
+			Request: models.WebhookOwnerRequest{}, Errors: []int{http.StatusNotFound},
+		},
+		key(http.MethodPost, "/api/v1/webhooks/status"): {
+			Summary: "Recent deliveries of a webhook", Tag: "Webhooks", Signer: "owner",
+			Request: models.WebhookOwnerRequest{}, Response: []models.WebhookDelivery{},
+			Errors: []int{http.StatusNotFound},
+		},
+
+		// Vault operations
+		key(http.MethodPost, "/api/v1/vault/get"): {
+			Summary: "List the dataset IDs in a user's vault", Tag: "Vault",
+			Request: models.GetUserVaultRequest{}, Response: models.VaultInfo{},
+		},
+		key(http.MethodPost, "/api/v1/vault/metadata"): {
+			Summary: "List a user's datasets with metadata", Tag: "Vault",
+			Request: models.GetUserVaultRequest{},
+		},
+
+		// Token operations
+		key(http.MethodPost, "/api/v1/token/register"): {
+			Summary: "Register to receive tokens", Tag: "Token", PrivateKey: true, Idempotent: true,
+			Request: models.RegisterTokenRequest{}, Response: models.TransactionResponse{},
+		},
+		key(http.MethodPost, "/api/v1/token/mint"): {
+			Summary: "Mint tokens", Tag: "Token", PrivateKey: true, Idempotent: true,
+			Description: "Fails with 403 NOT_MINT_AUTHORITY, before anything else, when private_key isn't the token's mint authority. " +
+				"Fails with 409 RECIPIENT_NOT_REGISTERED, before submitting anything, when the recipient hasn't registered to receive the token. " +
+				"With auto_register the recipient is registered first instead, paid for by the SPONSOR_PRIVATE_KEY account: the first call answers " +
+				"409 RECIPIENT_SIGNATURE_REQUIRED with a SponsoredTransaction for the recipient's wallet to sign, and the retry sends its raw_transaction " +
+				"back as register_transaction with the wallet's AccountAuthenticator as recipient_authenticator (BCS hex). " +
+				"register_hash is then returned with the mint hash; without a sponsor the 409 RECIPIENT_NOT_REGISTERED stands. " +
+				"When the registration commits but the mint fails, the 500 carries register_hash and the mint can be retried without auto_register.",
+			Request:  models.MintTokenRequest{},
+			Response: models.MintTokenResponse{},
+			Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict},
+		},
+		key(http.MethodPost, "/api/v1/token/check-registration"): {
+			Summary: "Check whether an account can receive tokens", Tag: "Token",
+			Description: "registered is read from the 0x1::coin::is_account_registered view. Node errors fail with 502.",
+			Request:     models.TokenRegistrationRequest{},
+			Response:    models.TokenRegistration{},
+			Errors:      []int{http.StatusBadGateway},
+		},
+		key(http.MethodGet, "/api/v1/token/info"): {
+			Summary: "Supply, decimals, symbol and minter of the DataX token", Tag: "Token",
+			Description: "supply is read from chain on every call and is null when the coin was initialized without supply tracking, " +
+				"as data_token does. minter is the account holding the mint capability.",
+			Response: models.TokenInfo{},
+		},
+
+		// Transactions
+		key(http.MethodGet, "/api/v1/tx/:hash/receipt"): {
+			Summary: "Receipt of a committed transaction", Tag: "Transactions",
+			Description: "Gas used, gas price and commit time, with the events of the DataX modules decoded. Other events keep only their raw data. Grants and revocations emit no event on chain, so they are read from the call and marked derived.",
+			Response:    models.TransactionReceipt{},
+			Errors:      []int{http.StatusNotFound, http.StatusConflict},
+		},
+
+		// Uploads
+		key(http.MethodPost, "/api/v1/data/submit-csv"): {
+			Summary: "Upload a CSV (or .xlsx workbook)", Tag: "Uploads",
+			Description: "Streams the file while validating, hashing and storing it. Structurally invalid CSVs get 422 with a violation report. " +
+				"UTF-16 and non-UTF-8 text is converted to UTF-8 with an encoding_warning; binary files get 422 BINARY_FILE and invalid UTF-8 422 INVALID_ENCODING. " +
+				"Unless PII_SCAN_ENABLED is off, the response carries an advisory PII report (pii) and the flagged detectors (pii_flags) to record in the metadata.",
+			Form: uploadForm(uploadHashField, uploadSchemaField, uploadCIDField, uploadMetadataField,
+				openapi.Param{Name: "delimiter", Description: "comma (default), semicolon, tab or pipe"},
+				openapi.Param{Name: "sheet", Description: "Worksheet to convert from an .xlsx upload; the first one by default"},
+				openapi.Param{Name: "validate_only", Type: "boolean", Description: "Return the validation report without storing anything; needs no signature"},
+				openapi.Param{Name: "csv_file", Type: "binary", Required: true},
+			),
+			Errors: []int{http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity},
+		},
+		key(http.MethodPost, "/api/v1/data/submit-json"): {
+			Summary: "Upload NDJSON or a JSON array of objects", Tag: "Uploads",
+			Description: "Records are flattened to one CSV row each and stored like a CSV upload.",
+			Form: uploadForm(uploadHashField, uploadSchemaField, uploadCIDField, uploadMetadataField,
+				openapi.Param{Name: "json_file", Type: "binary", Required: true},
+			),
+			Errors: []int{http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity},
+		},
+		key(http.MethodPost, "/api/v1/data/submit-encrypted-csv"): {
+			Summary: "Upload a CSV encrypted by the client", Tag: "Uploads",
+			Form: uploadForm(
+				openapi.Param{Name: "data_hash", Required: true, Description: "Hash to register on chain, which the server can't compute"},
+				openapi.Param{Name: "encryption_metadata", Required: true, Description: `JSON object such as {"algorithm": "AES-256-GCM", "nonce": "..."}`},
+				uploadMetadataField,
+				openapi.Param{Name: "encrypted_file", Type: "binary", Required: true},
+			),
+			Errors: []int{http.StatusUnauthorized, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusNotImplemented},
+		},
+		key(http.MethodPost, "/api/v1/data/infer-schema"): {
+			Summary: "Infer column types from the start of a CSV", Tag: "Uploads",
+			Form:   []openapi.Param{{Name: "csv_file", Type: "binary", Required: true}},
+			Errors: []int{http.StatusRequestEntityTooLarge},
+		},
+		key(http.MethodPost, "/api/v1/data/validate-metadata"): {
+			Summary: "Check dataset metadata against its schema", Tag: "Uploads",
+			Description: "metadata is a JSON object, or the string to be submitted on chain. name and description are required; category, tags, price_apt, license and the other documented fields are checked when present, and other keys are allowed. " +
+				"Metadata breaking the schema gets 422 METADATA_INVALID with one entry per field in details; valid metadata is returned as the marketplace will read it. Nothing is stored, and metadata already on chain is read whether it conforms or not.",
+			Request: models.ValidateMetadataRequest{}, Response: models.DatasetMetadata{},
+			Errors: []int{http.StatusUnprocessableEntity},
+		},
+		key(http.MethodPost, "/api/v1/data/scan-pii"): {
+			Summary: "Scan a CSV for columns that look like personal data", Tag: "Uploads",
+			Description: "Runs the upload PII detectors over the first PII_SAMPLE_ROWS rows and returns the report as pii, with the flagged detectors as pii_flags. Nothing is stored, and detection is advisory.",
+			Form: []openapi.Param{
+				{Name: "delimiter", Description: "comma, semicolon, tab or pipe; sniffed when omitted"},
+				{Name: "sheet", Description: "Worksheet to scan from an .xlsx upload; the first one by default"},
+				{Name: "csv_file", Type: "binary", Required: true},
+			},
+			Errors: []int{http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity},
+		},
+		key(http.MethodPost, "/api/v1/data/stats"): {
+			Summary: "Column statistics of an uploaded dataset", Tag: "Data",
+			Request: models.GetCSVStatsRequest{}, Response: models.CSVStats{},
+			Errors: []int{http.StatusNotFound},
+		},
+
+		// Marketplace
+		key(http.MethodGet, "/api/v1/marketplace/datasets"): {
+			Summary: "List marketplace datasets", Tag: "Marketplace",
+			Description: "Returns a bare array unless limit, cursor or envelope=true is given, in which case the datasets come in a page envelope. The envelope has partial=true when some owners' DataStores couldn't be read from chain within MARKETPLACE_TIMEOUT. Responses carry an ETag for If-None-Match.",
+			Query:       marketplaceQuery,
+			Response:    models.MarketplacePage{},
+			Errors:      []int{http.StatusNotModified},
+		},
+		key(http.MethodPost, "/api/v1/marketplace/access-requests"): {
+			Summary: "List the access requests made for an owner's datasets", Tag: "Marketplace",
+			Request: models.ListAccessRequestsRequest{}, Response: []models.AccessRequest{},
+		},
+		key(http.MethodPost, "/api/v1/marketplace/request-access"): {
+			Summary: "Request access to a dataset", Tag: "Marketplace", Idempotent: true,
+			Request: models.RequestAccessRequest{}, Response: models.AccessRequest{},
+		},
+		key(http.MethodPost, "/api/v1/marketplace/access-requests/sent"): {
+			Summary: "List the access requests a requester made", Tag: "Marketplace",
+			Request: models.SentAccessRequestsRequest{}, Response: []models.AccessRequest{},
+		},
+		key(http.MethodPost, "/api/v1/marketplace/access-requests/approve"): {
+			Summary: "Approve a pending access request", Tag: "Marketplace", Signer: "owner_address", Idempotent: true,
+			Request: models.ApproveAccessRequestInput{}, Response: models.AccessRequest{},
+			Errors: []int{http.StatusNotFound, http.StatusConflict},
+		},
+		key(http.MethodPost, "/api/v1/marketplace/access-requests/deny"): {
+			Summary: "Deny a pending access request", Tag: "Marketplace", Signer: "owner_address", Idempotent: true,
+			Request: models.ApproveAccessRequestInput{}, Response: models.AccessRequest{},
+			Errors: []int{http.StatusNotFound, http.StatusConflict},
+		},
+		key(http.MethodPost, "/api/v1/marketplace/access-requests/confirm-payment"): {
+			Summary: "Record the payment for an approved access request", Tag: "Marketplace", Signer: "requester_address", Idempotent: true,
+			Description: "tx_hash must be a successful APT transfer from the requester to the owner (or PAYMENT_ESCROW_ADDRESS) " +
+				"of at least the dataset's price, committed after the request was made. A transaction pays for one request only.",
+			Request: models.ConfirmPaymentInput{}, Response: models.AccessRequest{},
+			Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		key(http.MethodPost, "/api/v1/marketplace/register-user"): {
+			Summary: "Register for the marketplace (no-op; users are discovered from chain)", Tag: "Marketplace",
+			Request: models.RegisterMarketplaceUserRequest{},
+		},
+
+		// Dataset contents
+		key(http.MethodPost, "/api/v1/data/get-csv"): {
+			Summary: "Read a dataset's rows", Tag: "Data", Signer: "requester",
+			Description: "The requester must be the owner or hold access. Rows are checked against the on-chain hash. " +
+				"A verified read returns an X-Access-Token that can replace the signature until it expires. " +
+				"Columns the requester's grant doesn't cover are dropped, even when asked for, and named in X-Withheld-Columns and the message.",
+			Request: models.GetCSVDataRequest{},
+			Errors:  []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusNotImplemented},
+		},
+		key(http.MethodPost, "/api/v1/data/get-encrypted-csv"): {
+			Summary: "Download a dataset's ciphertext as stored", Tag: "Data", Signer: "requester",
+			Request: models.EncryptedCSVRequest{},
+			Errors:  []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+		},
+		key(http.MethodPost, "/api/v1/data/preview"): {
+			Summary: "Preview a dataset's header and first rows", Tag: "Data", Signer: "requester",
+			Description: "Columns the requester's grant doesn't cover are left out and listed in withheld_columns.",
+			Request:     models.PreviewCSVRequest{}, Response: models.CSVPreview{},
+			Errors: []int{http.StatusForbidden, http.StatusNotFound},
+		},
+		key(http.MethodPost, "/api/v1/data/sample"): {
+			Summary: "A fixed pseudo-random sample of a dataset's rows, open to anyone", Tag: "Data",
+			Description: "Only datasets whose metadata sets sample_enabled; sample_rows and SAMPLE_MAX_ROWS cap the rows whatever rows asks for. " +
+				"The rows are chosen by the dataset alone, so repeat requests return the same ones. Columns a PII scan flags are left out.",
+			Request: models.SampleRequest{}, Response: models.CSVSample{},
+			Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusGone},
+		},
+		key(http.MethodPost, "/api/v1/data/aggregate"): {
+			Summary: "Count, sum, avg, min or max of a dataset's rows, optionally grouped and filtered", Tag: "Data", Signer: "requester",
+			Description: "Returns only the aggregate table. The access proof is optional when the owner set aggregates_enabled in the metadata; " +
+				"without one, columns a PII scan flags can't be queried. Groups under AGGREGATE_MIN_GROUP_SIZE rows are left out and counted in suppressed_groups.",
+			Request: models.AggregateRequest{}, Response: models.AggregateResult{},
+			Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusGone, http.StatusUnprocessableEntity},
+		},
+		key(http.MethodPost, "/api/v1/data/get-encryption-info"): {
+			Summary: "Encryption metadata needed to decrypt a dataset locally", Tag: "Data", Signer: "requester",
+			Request: models.EncryptionInfoRequest{},
+			Errors:  []int{http.StatusForbidden, http.StatusNotFound},
+		},
+		key(http.MethodPost, "/api/v1/data/export"): {
+			Summary: "Download a whole dataset as CSV, Parquet or JSON Lines", Tag: "Data", Signer: "requester",
+			Description: "Format jsonl writes one object per line, keyed by header name and coerced like format records of POST /api/v1/data/get-csv. " +
+				"Format parquet types columns from the metadata schema and upload statistics, as strings where values don't fit. " +
+				"Every format is streamed from storage as rows are read. " +
+				"CSV exports of unencrypted, content-addressed blobs answer a single-range Range header with 206 and advertise Accept-Ranges; " +
+				"other exports ignore Range, send the whole file and say why in X-Range-Ignored. " +
+				"Columns the requester's grant doesn't cover are left out and named in X-Withheld-Columns.",
+			Request: models.ExportDataRequest{}, RawResponse: []string{contentTypeCSV, contentTypeParquet, contentTypeJSONL},
+			Headers: []openapi.Param{{Name: "Range", Description: "bytes=start-end, bytes=start- or bytes=-suffix, to resume a CSV download"}},
+			Errors:  []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusRequestedRangeNotSatisfiable, http.StatusUnprocessableEntity},
+		},
+		key(http.MethodPost, "/api/v1/data/audit-log"): {
+			Summary: "Who read an owner's datasets, newest first", Tag: "Data", Signer: "owner",
+			Description: "Entries are written in the background, so a read can take a second or two to appear.",
+			Request:     models.AuditLogRequest{}, Response: models.AuditLogPage{},
+		},
+		key(http.MethodPost, "/api/v1/data/analytics"): {
+			Summary: "Read counters for each of an owner's datasets", Tag: "Data", Signer: "owner",
+			Description: "Counts come from the audit log over from..to (the last 7 days by default) and are cached for ANALYTICS_CACHE_TTL seconds.",
+			Request:     models.DatasetAnalyticsRequest{}, Response: models.DatasetAnalytics{},
+		},
+
+		// Direct (presigned) storage access
+		key(http.MethodPost, "/api/v1/data/upload-url"): {
+			Summary: "Presigned URL to upload a blob directly to storage", Tag: "Storage", Signer: "account_address",
+			Request: models.UploadURLRequest{},
+			Errors:  []int{http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusConflict, http.StatusNotImplemented},
+		},
+		key(http.MethodPost, "/api/v1/data/finalize-upload"): {
+			Summary: "Validate and register a blob uploaded to a presigned URL", Tag: "Storage", Signer: "account_address", Idempotent: true,
+			Request: models.FinalizeUploadRequest{},
+			Errors:  []int{http.StatusNotFound, http.StatusConflict, http.StatusGone, http.StatusUnprocessableEntity},
+		},
+		key(http.MethodPost, "/api/v1/data/download-url"): {
+			Summary: "Presigned URL to download a blob directly from storage", Tag: "Storage", Signer: "requester",
+			Request: models.DownloadURLRequest{},
+			Errors:  []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusGone, http.StatusNotImplemented},
+		},
+		key(http.MethodPost, "/api/v1/data/delete-blob"): {
+			Summary: "Delete a stored blob", Tag: "Storage", Signer: "owner", Idempotent: true,
+			Request: models.DeleteBlobRequest{},
+			Errors:  []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+		},
+		key(http.MethodPost, "/api/v1/storage/list"): {
+			Summary: "List an owner's stored blobs, flagging orphans", Tag: "Storage", Signer: "owner",
+			Request: models.ListBlobsRequest{},
+		},
+
+		// REST reads (v2)
+		key(http.MethodGet, "/api/v2/datasets/:owner"): {
+			Summary: "List an owner's datasets with metadata", Tag: "v2",
+			Query: []openapi.Param{
+				{Name: "active", Type: "boolean", Description: "true for live datasets only, false for deleted ones only"},
+				{Name: "offset", Type: "integer"},
+				{Name: "limit", Type: "integer", Description: "Page size; all remaining datasets when omitted"},
+			},
+			Response: models.OwnerDatasetsPage{},
+			Errors:   []int{http.StatusNotModified},
+		},
+		key(http.MethodGet, "/api/v2/datasets/:owner/:id"): {
+			Summary: "Get a dataset's on-chain record", Tag: "v2",
+			Response: models.DatasetInfo{},
+			Errors:   []int{http.StatusNotModified},
+		},
+		key(http.MethodGet, "/api/v2/datasets/:owner/:id/csv"): {
+			Summary: "Read a dataset's rows", Tag: "v2", Signer: "requester",
+			Description: "The requester must be the owner or hold access. Same behavior as POST /api/v1/data/get-csv.",
+			Query: []openapi.Param{
+				{Name: "requester", Required: true},
+				{Name: "data_hash", Description: "The on-chain data hash when omitted"},
+				{Name: "offset", Type: "integer", Description: "First data row to return (0-based, header excluded)"},
+				{Name: "limit", Type: "integer", Description: "Data rows to return; all remaining when omitted"},
+				{Name: "columns", Description: "Header names to keep, comma-separated or repeated"},
+				{Name: "format", Description: "rows (default) or records"},
+				{Name: "decryption", Description: "server, client or provided_key"},
+			},
+			Headers: append(walletSignatureHeaders, openapi.Param{Name: headerDecryptionKey, Description: "256-bit data key (hex or base64) for decryption=provided_key"}),
+			Errors:  []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusNotImplemented},
+		},
+		key(http.MethodGet, "/api/v2/marketplace/datasets"): {
+			Summary: "List marketplace datasets", Tag: "v2",
+			Description: "Same behavior as GET /api/v1/marketplace/datasets.",
+			Query:       marketplaceQuery, Response: models.MarketplacePage{},
+			Errors: []int{http.StatusNotModified},
+		},
+		key(http.MethodGet, "/api/v2/users/:address/vault"): {
+			Summary: "List the dataset IDs in a user's vault", Tag: "v2",
+			Response: models.VaultInfo{},
+			Errors:   []int{http.StatusNotModified},
+		},
+
+		// Admin
+		key(http.MethodGet, "/api/v1/admin/discovery-checkpoint"): {
+			Summary: "Progress of the user discovery scanner", Tag: "Admin",
+			Headers: adminKeyHeader, Response: models.DiscoveryCheckpoint{},
+			Errors: []int{http.StatusUnauthorized, http.StatusForbidden},
+		},
+		key(http.MethodPost, "/api/v1/admin/manifest/backfill"): {
+			Summary: "Rebuild an owner's data hash manifest from storage", Tag: "Admin",
+			Headers: adminKeyHeader, Request: models.BackfillManifestRequest{},
+			Errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotImplemented},
+		},
+		key(http.MethodPost, "/api/v1/admin/encryption/migrate"): {
+			Summary: "Re-wrap and encrypt an owner's blobs under the current master key", Tag: "Admin",
+			Headers: adminKeyHeader, Request: models.MigrateEncryptionRequest{},
+			Errors: []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusNotImplemented},
+		},
+		key(http.MethodPost, "/api/v1/admin/config/reload"): {
+			Summary: "Re-read the runtime-tunable settings", Tag: "Admin",
+			Description: "Same as sending SIGHUP: LOG_LEVEL, rate limits, marketplace and cache settings are re-read from the environment and .env. " +
+				"Nothing changes when one is invalid. Other settings need a restart; changes to them are listed in ignored and left as they were.",
+			Headers: adminKeyHeader, Response: models.ConfigReload{},
+			Errors: []int{http.StatusUnauthorized, http.StatusForbidden},
+		},
+		key(http.MethodGet, "/api/v1/admin/rewards"): {
+			Summary: "Contribution reward ledger", Tag: "Admin",
+			Description: "The reward worker's cursor, pause state, today's totals by address and its latest entries, newest first. " +
+				"Fails with 409 when REWARDS_ENABLED is off.",
+			Query:    []openapi.Param{{Name: "address", Description: "Only entries rewarding this address"}},
+			Headers:  adminKeyHeader,
+			Response: models.RewardLedger{},
+			Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict},
+		},
+		key(http.MethodPost, "/api/v1/admin/rewards/pause"): {
+			Summary: "Pause or resume contribution rewards", Tag: "Admin",
+			Description: "While paused no reward is minted; submissions made meanwhile are rewarded on resume. The state survives restarts.",
+			Request:     models.PauseRewardsRequest{},
+			Headers:     adminKeyHeader,
+			Errors:      []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict},
+		},
+		key(http.MethodGet, "/api/v1/admin/devnet"): {
+			Summary: "Local devnet bootstrap status", Tag: "Admin",
+			Description: "What DEVNET_BOOTSTRAP did at startup: disabled, skipped (not a local node, with the reason) or ready, " +
+				"with the deployer it funded, the publish transaction and the module addresses in effect.",
+			Headers:  adminKeyHeader,
+			Response: models.DevnetStatus{},
+			Errors:   []int{http.StatusUnauthorized, http.StatusForbidden},
+		},
+	}
+}
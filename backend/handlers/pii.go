@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	dataschema "github.com/datax/backend/schema"
+	"github.com/gin-gonic/gin"
+)
+
+// newPIIScanner returns a scanner set up from the PII_* settings
+func newPIIScanner() (*dataschema.PIIScanner, error) {
+	detectors, err := dataschema.PIIDetectors(config.AppConfig.PIIDetectors, config.AppConfig.PIIPatterns)
+	if err != nil {
+		return nil, err
+	}
+	return dataschema.NewPIIScanner(detectors, config.AppConfig.PIISampleRows, float64(config.AppConfig.PIIFlagPercent)), nil
+}
+
+// uploadPIIScanner returns the scanner for an upload's rows, or nil when PII_SCAN_ENABLED is
+// off. The scan is advisory, so bad detector settings skip it rather than fail the upload
+func uploadPIIScanner() *dataschema.PIIScanner {
+	if !config.AppConfig.PIIScanEnabled {
+		return nil
+	}
+	scanner, err := newPIIScanner()
+	if err != nil {
+		fmt.Printf("WARNING: Skipping the PII scan: %v\n", err)
+		return nil
+	}
+	return scanner
+}
+
+// piiDetails adds a scan's report to an upload's stats and response. The flags belong in the
+// dataset metadata's pii_flags, where the marketplace shows them
+func piiDetails(scanner *dataschema.PIIScanner, stats *models.CSVStats, data map[string]interface{}) {
+	if scanner == nil {
+		return
+	}
+	report := scanner.Report()
+	stats.PII = &report
+	data["pii"] = report
+	data["pii_flags"] = report.Flags // Record in the dataset metadata
+}
+
+// piiColumns returns the columns a PII report flagged for any detector
+func piiColumns(report *models.PIIReport) []string {
+	if report == nil {
+		return nil
+	}
+	var columns []string
+	for _, column := range report.Columns {
+		for _, finding := range column.Findings {
+			if finding.Flagged {
+				columns = append(columns, column.Name)
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// flaggedPIIColumns returns the columns of a dataset that its upload's PII scan flagged or
+// that a scan of all of its rows flags now, for reads that hand data to requesters without
+// access. The rows are read through and rewound. Detectors that can't be built, or rows
+// that can't be read, fail the read with a 500, since flagged columns couldn't be told
+// apart; when the rows' context ends first it returns false without responding
+func (h *Handler) flaggedPIIColumns(c *gin.Context, owner string, rows *datasetRows) ([]string, bool) {
+	detectors, err := dataschema.PIIDetectors(config.AppConfig.PIIDetectors, config.AppConfig.PIIPatterns)
+	if err != nil {
+		fmt.Printf("ERROR: PII detectors are misconfigured: %v\n", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("PII detectors are misconfigured: %v", err),
+		})
+		return nil, false
+	}
+	scanner := dataschema.NewPIIScanner(detectors, 0, float64(config.AppConfig.PIIFlagPercent))
+	scanner.Observe(rows.Header)
+	err = scanRows(rows, scanner.Observe)
+	if err == nil {
+		err = rows.Rewind()
+	}
+	if err != nil {
+		if rows.ctx.Err() != nil {
+			return nil, false
+		}
+		fmt.Printf("ERROR: Failed to scan %s for PII: %v\n", rows.BlobName, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to read the dataset: %v", err),
+		})
+		return nil, false
+	}
+	report := scanner.Report()
+	flagged := piiColumns(&report)
+	if stats, err := h.storageService.RetrieveCSVStats(owner, rows.BlobName); err == nil {
+		flagged = append(flagged, piiColumns(stats.PII)...)
+	}
+	return flagged, true
+}
+
+// ScanPII handles POST /api/v1/data/scan-pii, reporting the columns of an uploaded CSV or
+// .xlsx file that look like they hold personal data. Up to PII_SAMPLE_ROWS rows are scanned
+// and nothing is stored; the same scan runs on every upload while PII_SCAN_ENABLED is on
+func (h *Handler) ScanPII(c *gin.Context) {
+	if !limitUploadBody(c) {
+		return
+	}
+
+	fields, filePart, err := readUploadForm(c.Request, "csv_file")
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if filePart == nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Missing CSV file: csv_file",
+		})
+		return
+	}
+
+	src, opts, sourceDetails, err := csvUploadSource(filePart, fields)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if closer, ok := src.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	scanner, err := newPIIScanner()
+	if err != nil {
+		fmt.Printf("ERROR: PII detectors are misconfigured: %v\n", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("PII detectors are misconfigured: %v", err),
+		})
+		return
+	}
+
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	if opts.delimiter != 0 {
+		reader.Comma = opts.delimiter
+	}
+	for !scanner.Done() {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				c.JSON(http.StatusBadRequest, models.Response{
+					Success: false,
+					Error:   "Failed to parse CSV file: " + err.Error(),
+				})
+				return
+			}
+			respondUploadError(c, err)
+			return
+		}
+		scanner.Observe(record)
+	}
+
+	report := scanner.Report()
+	data := map[string]interface{}{
+		"pii":       report,
+		"pii_flags": report.Flags,
+	}
+	for key, value := range sourceDetails {
+		data[key] = value
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "PII scan is advisory: flagged columns may be false positives, and unflagged ones may still hold personal data",
+		Data:    data,
+	})
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// headerRangeIgnored explains why a Range header was answered with the whole body
+const headerRangeIgnored = "X-Range-Ignored"
+
+var (
+	errRangeMalformed     = errors.New("malformed Range header; only bytes=start-end, bytes=start- and bytes=-suffix are understood")
+	errRangeMultiple      = errors.New("only a single byte range is supported")
+	errRangeUnsatisfiable = errors.New("range starts past the end of the blob")
+)
+
+// rangedBlobReader is implemented by storage backends that can read part of a blob without
+// downloading the rest
+type rangedBlobReader interface {
+	HeadBlob(accountAddress string, blobName string) (int64, error)
+	OpenBlobRange(accountAddress string, blobName string, offset int64, length int64) (io.ReadCloser, error)
+}
+
+// serveExportRange answers a CSV export from the stored blob when it can be read in byte
+// ranges: it advertises Accept-Ranges, and for a Range header writes the 206 or 416 itself
+// and returns true. Otherwise it returns false for the full export to be served, with
+// X-Range-Ignored saying why when a Range was asked for
+func (h *Handler) serveExportRange(c *gin.Context, req models.ExportDataRequest) bool {
+	rangeHeader := c.GetHeader("Range")
+
+	blobName, _, err := h.resolveDatasetBlob(req.Owner, *req.DatasetID)
+	if err != nil {
+		// The full export reports it
+		return false
+	}
+	reader, reason := h.exportRangeReader(req.Owner, *req.DatasetID, blobName)
+	if reader == nil {
+		if rangeHeader != "" {
+			c.Header(headerRangeIgnored, reason)
+		}
+		return false
+	}
+	c.Header("Accept-Ranges", "bytes")
+	if rangeHeader == "" {
+		return false
+	}
+
+	size, err := reader.HeadBlob(req.Owner, blobName)
+	if err != nil {
+		respondBlobNotFound(c, req.DataHash, err)
+		return true
+	}
+	start, length, err := parseByteRange(rangeHeader, size)
+	if errors.Is(err, errRangeUnsatisfiable) {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+		c.JSON(http.StatusRequestedRangeNotSatisfiable, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Range %q is outside the %d bytes of this dataset", rangeHeader, size),
+			Code:    models.ErrCodeRangeNotSatisfiable,
+		})
+		return true
+	}
+	if err != nil {
+		// RFC 9110 lets a server ignore a Range it can't use and send the whole body
+		c.Header(headerRangeIgnored, err.Error())
+		return false
+	}
+
+	body, err := reader.OpenBlobRange(req.Owner, blobName, start, length)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to read bytes %d-%d of %s: %v\n", start, start+length-1, blobName, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to read dataset: %v", err),
+		})
+		return true
+	}
+	defer body.Close()
+
+	meta, _ := h.datasetMetadata(req.Owner, *req.DatasetID)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFilename(meta.Name, *req.DatasetID, req.Format)))
+	c.Header("Content-Type", contentTypeCSV)
+	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+	c.Header("Content-Length", strconv.FormatInt(length, 10))
+	c.Status(http.StatusPartialContent)
+	if _, err := io.Copy(c.Writer, body); err != nil {
+		fmt.Printf("ERROR: Ranged export of %s failed: %v\n", blobName, err)
+		return true
+	}
+	// A resumed download is one read, logged when it starts; row counts don't apply to bytes
+	if start == 0 {
+		h.recordAudit(c, req.Owner, *req.DatasetID, req.Requester, 0)
+	}
+	return true
+}
+
+// exportRangeReader returns the storage to read a blob's byte ranges from, or nil and the
+// reason it can't be. Ranges come from the stored object, so they only line up with the full
+// CSV export when the blob holds exactly the canonical CSV the on-chain data hash covers,
+// which a content-addressed name equal to that hash proves. Blobs sealed with AES-GCM are
+// authenticated as a whole and can't be decrypted a range at a time
+func (h *Handler) exportRangeReader(owner string, datasetID uint64, blobName string) (rangedBlobReader, string) {
+	reader, ok := h.storageService.(rangedBlobReader)
+	if !ok {
+		return nil, "this storage backend can't read byte ranges"
+	}
+	if strings.HasSuffix(blobName, ".enc") {
+		return nil, "the dataset is encrypted as a single unit and can only be decrypted whole"
+	}
+	contentHash := services.ContentHash(blobName)
+	if contentHash == "" || contentHash != services.NormalizeDataHash(h.datasetDataHash(owner, datasetID)) {
+		return nil, "the stored blob is not the canonical CSV the data hash covers, so byte offsets wouldn't match this download"
+	}
+	return reader, ""
+}
+
+// parseByteRange reads a single-range Range header against a blob of size bytes, returning
+// the first byte and how many to send. An end past the blob is clamped to it
+func parseByteRange(header string, size int64) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok {
+		return 0, 0, errRangeMalformed
+	}
+	if strings.Contains(spec, ",") {
+		return 0, 0, errRangeMultiple
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, errRangeMalformed
+	}
+
+	if first == "" {
+		// bytes=-n is the last n bytes
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, errRangeMalformed
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, errRangeUnsatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, errRangeMalformed
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, errRangeMalformed
+		}
+	}
+	if start >= size {
+		return 0, 0, errRangeUnsatisfiable
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return start, end - start + 1, nil
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+func TestParseByteRange(t *testing.T) {
+	cases := []struct {
+		header        string
+		size          int64
+		start, length int64
+		err           error
+	}{
+		{"bytes=0-9", 100, 0, 10, nil},
+		{"bytes=90-", 100, 90, 10, nil},
+		{"bytes=90-500", 100, 90, 10, nil}, // An end past the blob is clamped
+		{"bytes=-10", 100, 90, 10, nil},
+		{"bytes=-500", 100, 0, 100, nil},
+		{" bytes=5-5 ", 100, 5, 1, nil},
+		{"bytes=100-", 100, 0, 0, errRangeUnsatisfiable},
+		{"bytes=-0", 100, 0, 0, errRangeUnsatisfiable},
+		{"bytes=-5", 0, 0, 0, errRangeUnsatisfiable},
+		{"bytes=0-1,5-6", 100, 0, 0, errRangeMultiple},
+		{"items=0-9", 100, 0, 0, errRangeMalformed},
+		{"bytes=9-0", 100, 0, 0, errRangeMalformed},
+		{"bytes=a-9", 100, 0, 0, errRangeMalformed},
+		{"bytes=5", 100, 0, 0, errRangeMalformed},
+		{"bytes=-1-2", 100, 0, 0, errRangeMalformed},
+	}
+	for _, tc := range cases {
+		start, length, err := parseByteRange(tc.header, tc.size)
+		if !errors.Is(err, tc.err) || start != tc.start || length != tc.length {
+			t.Errorf("parseByteRange(%q, %d) = %d, %d, %v, want %d, %d, %v",
+				tc.header, tc.size, start, length, err, tc.start, tc.length, tc.err)
+		}
+	}
+}
+
+// exportRange posts a CSV export of the owner's dataset 0 with the given Range header, when
+// it isn't empty
+func (h *testHandler) exportRange(t *testing.T, dataHash string, rangeHeader string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := h.exportRequest(t, dataHash, "csv")
+	if rangeHeader != "" {
+		request.Header.Set("Range", rangeHeader)
+	}
+	return serve(http.MethodPost, "/data/export", h.ExportData, request)
+}
+
+func TestExportServesByteRangesOfCanonicalBlobs(t *testing.T) {
+	h := newTestHandler(t)
+	dataHash := h.storeTestDataset(t, testOwnerKey, testCSV, "ranged")
+	size := len(testCSV)
+
+	cases := []struct {
+		header     string
+		start, end int
+	}{
+		{"bytes=8-15", 8, 15},
+		{"bytes=16-", 16, size - 1},
+		{"bytes=-6", size - 6, size - 1},
+		{"bytes=0-1000", 0, size - 1},
+	}
+	for _, tc := range cases {
+		recorder := h.exportRange(t, dataHash, tc.header)
+		if recorder.Code != http.StatusPartialContent {
+			t.Errorf("%s = %d %s, want 206", tc.header, recorder.Code, recorder.Body.String())
+			continue
+		}
+		if body, want := recorder.Body.String(), testCSV[tc.start:tc.end+1]; body != want {
+			t.Errorf("%s body %q, want %q", tc.header, body, want)
+		}
+		if got, want := recorder.Header().Get("Content-Range"), fmt.Sprintf("bytes %d-%d/%d", tc.start, tc.end, size); got != want {
+			t.Errorf("%s Content-Range %q, want %q", tc.header, got, want)
+		}
+		if got, want := recorder.Header().Get("Content-Length"), fmt.Sprint(tc.end-tc.start+1); got != want {
+			t.Errorf("%s Content-Length %q, want %q", tc.header, got, want)
+		}
+	}
+
+	// Without a Range the whole file is sent, and ranges are advertised for a resume
+	recorder := h.exportRange(t, dataHash, "")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != testCSV || recorder.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("export = %d %q, Accept-Ranges %q, want 200 with the whole CSV and bytes",
+			recorder.Code, recorder.Body.String(), recorder.Header().Get("Accept-Ranges"))
+	}
+}
+
+func TestExportRefusesRangesPastTheEnd(t *testing.T) {
+	h := newTestHandler(t)
+	dataHash := h.storeTestDataset(t, testOwnerKey, testCSV, "ranged")
+
+	recorder := h.exportRange(t, dataHash, fmt.Sprintf("bytes=%d-", len(testCSV)))
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusRequestedRangeNotSatisfiable || response.Code != models.ErrCodeRangeNotSatisfiable {
+		t.Fatalf("range past the end = %d %q, want 416 %s", recorder.Code, response.Code, models.ErrCodeRangeNotSatisfiable)
+	}
+	if got, want := recorder.Header().Get("Content-Range"), fmt.Sprintf("bytes */%d", len(testCSV)); got != want {
+		t.Errorf("Content-Range %q, want %q", got, want)
+	}
+}
+
+func TestExportIgnoresRangesItCantServe(t *testing.T) {
+	sum := sha256.Sum256([]byte(testCSV))
+	dataHash := "0x" + hex.EncodeToString(sum[:])
+
+	cases := []struct {
+		name   string
+		setup  func(t *testing.T, h *testHandler)
+		header string
+	}{
+		{"multiple ranges", func(t *testing.T, h *testHandler) {
+			h.storeTestDataset(t, testOwnerKey, testCSV, "ranged")
+		}, "bytes=0-1,4-5"},
+		{"malformed range", func(t *testing.T, h *testHandler) {
+			h.storeTestDataset(t, testOwnerKey, testCSV, "ranged")
+		}, "lines=1-2"},
+		{"timestamp-named blob", func(t *testing.T, h *testHandler) {
+			owner := addressOf(t, testOwnerKey)
+			h.submitTestDataset(t, testOwnerKey, dataHash, "legacy")
+			blobName := h.writeTestBlob(t, owner+"/1700000000_"+hex.EncodeToString(sum[:])+".csv", testCSV)
+			if err := h.storage.UpdateManifest(owner, dataHash, models.BlobManifestEntry{BlobName: blobName}); err != nil {
+				t.Fatalf("UpdateManifest: %v", err)
+			}
+		}, "bytes=0-9"},
+		{"encrypted blob", func(t *testing.T, h *testHandler) {
+			masterKey := config.AppConfig.EncryptionMasterKey
+			config.AppConfig.EncryptionMasterKey = strings.Repeat("ab", 32)
+			t.Cleanup(func() { config.AppConfig.EncryptionMasterKey = masterKey })
+			owner := addressOf(t, testOwnerKey)
+			if status, response := h.submitCSV(t, h.signedUploadFields(t, owner, testOwnerKey), testCSV); status != http.StatusOK {
+				t.Fatalf("upload = %d %s", status, response.Error)
+			}
+			h.submitTestDataset(t, testOwnerKey, dataHash, "sealed")
+		}, "bytes=0-9"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newTestHandler(t)
+			tc.setup(t, h)
+			request := h.exportRequest(t, dataHash, "csv")
+			request.Header.Set("Range", tc.header)
+			recorder := serve(http.MethodPost, "/data/export", h.ExportData, request)
+
+			if recorder.Code != http.StatusOK || recorder.Body.String() != testCSV {
+				t.Fatalf("export = %d %q, want 200 with the whole CSV", recorder.Code, recorder.Body.String())
+			}
+			if recorder.Header().Get(headerRangeIgnored) == "" {
+				t.Errorf("whole file sent without saying why in %s", headerRangeIgnored)
+			}
+			if recorder.Header().Get("Content-Range") != "" {
+				t.Errorf("Content-Range %q on a whole file", recorder.Header().Get("Content-Range"))
+			}
+		})
+	}
+}
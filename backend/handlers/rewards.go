@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetRewardLedger returns the contribution reward worker's state and latest ledger entries,
+// only those of ?address= when given
+func (h *Handler) GetRewardLedger(c *gin.Context) {
+	var address string
+	if v := c.Query("address"); v != "" {
+		normalized, err := services.NormalizeAddress(v)
+		if err != nil {
+			respondBadQuery(c, "address must be an account address of up to 64 hex digits")
+			return
+		}
+		address = normalized
+	}
+
+	ledger, err := h.rewards.Ledger(address)
+	if err != nil {
+		respondRewardError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    ledger,
+	})
+}
+
+// PauseRewards stops or resumes the contribution reward worker
+func (h *Handler) PauseRewards(c *gin.Context) {
+	var req models.PauseRewardsRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if err := h.rewards.SetPaused(*req.Paused); err != nil {
+		respondRewardError(c, err)
+		return
+	}
+
+	message := "Rewards resumed"
+	if *req.Paused {
+		message = "Rewards paused"
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: message,
+	})
+}
+
+func respondRewardError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrRewardsDisabled) {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.Response{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
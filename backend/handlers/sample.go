@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// sampleRowIndexes picks n of total data rows, in their original order. The choice is seeded
+// by the dataset alone, so every request for the dataset draws from the same shuffle: asking
+// again, or for fewer rows, never reveals a row a larger sample wouldn't have
+func sampleRowIndexes(owner string, datasetID uint64, total int, n int) []int {
+	if normalized, err := services.NormalizeAddress(owner); err == nil {
+		owner = normalized
+	}
+	seed := sha256.Sum256(fmt.Appendf(nil, "sample:%s:%d", owner, datasetID))
+	order := rand.New(rand.NewChaCha8(seed)).Perm(total)
+	picked := order[:min(n, total)]
+	slices.Sort(picked)
+	return picked
+}
+
+// withoutColumns removes the named columns (case-insensitively) from records, returning the
+// header names it removed
+func withoutColumns(records [][]string, excluded []string) ([][]string, []string) {
+	if len(excluded) == 0 || len(records) == 0 {
+		return records, nil
+	}
+	var allowed []string
+	for _, name := range records[0] {
+		if !slices.ContainsFunc(excluded, func(e string) bool { return strings.EqualFold(strings.TrimSpace(e), strings.TrimSpace(name)) }) {
+			allowed = append(allowed, name)
+		}
+	}
+	if allowed == nil {
+		allowed = []string{}
+	}
+	return withholdColumns(records, allowed)
+}
+
+// activeDataset reads a dataset from chain with its parsed metadata, answering 404 when it
+// can't be read and 410 DATASET_INACTIVE when it was deleted
+func (h *Handler) activeDataset(c *gin.Context, owner string, datasetID uint64) (map[string]interface{}, models.DatasetMetadata, bool) {
+	datasetRaw, err := h.aptosService.GetDataset(owner, datasetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Dataset not found: %v", err),
+		})
+		return nil, models.DatasetMetadata{}, false
+	}
+	datasetMap, _ := datasetRaw.(map[string]interface{})
+	if active, ok := datasetMap["is_active"].(bool); ok && !active {
+		c.JSON(http.StatusGone, models.Response{
+			Success: false,
+			Error:   "Dataset is no longer active",
+			Code:    models.ErrCodeDatasetInactive,
+		})
+		return nil, models.DatasetMetadata{}, false
+	}
+	rawMetadata, _ := datasetMap["metadata"].(string)
+	meta, _ := services.ParseDatasetMetadata(rawMetadata)
+	return datasetMap, meta, true
+}
+
+// SampleDataset handles POST /api/v1/data/sample, returning a few of a dataset's rows to
+// anyone, without an access check, when its owner set sample_enabled in the metadata. The
+// rows are a fixed pseudo-random pick for the dataset, at most the dataset's sample_rows and
+// SAMPLE_MAX_ROWS, and every column the upload's or a fresh PII scan flags is left out
+func (h *Handler) SampleDataset(c *gin.Context) {
+	var req models.SampleRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	datasetMap, meta, ok := h.activeDataset(c, req.Owner, *req.DatasetID)
+	if !ok {
+		return
+	}
+	if !meta.SampleEnabled {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "The owner hasn't made a sample of this dataset available",
+			Code:    models.ErrCodeSampleDisabled,
+		})
+		return
+	}
+
+	limit := config.AppConfig.SampleMaxRows
+	if meta.SampleRows > 0 {
+		limit = min(limit, meta.SampleRows)
+	}
+	if req.Rows > 0 {
+		limit = min(limit, req.Rows)
+	}
+
+	// The blob is resolved from the on-chain hash; it also names the dataset in errors
+	dataHash, _ := datasetMap["data_hash"].(string)
+	records, blobName, ok := h.retrieveDatasetCSV(c, req.Owner, *req.DatasetID, dataHash)
+	if !ok {
+		return
+	}
+
+	excluded, ok := h.flaggedPIIColumns(c, req.Owner, newRecordRows(c.Request.Context(), blobName, records))
+	if !ok {
+		return
+	}
+
+	sample := models.CSVSample{Sample: true, Header: []string{}, Rows: [][]string{}}
+	if len(records) > 0 {
+		rows := records[1:]
+		selected := [][]string{records[0]}
+		for _, i := range sampleRowIndexes(req.Owner, *req.DatasetID, len(rows), limit) {
+			selected = append(selected, rows[i])
+		}
+		kept, withheld := withoutColumns(selected, excluded)
+		sample.Header, sample.Rows, sample.TotalRows, sample.WithheldColumns = kept[0], kept[1:], len(rows), withheld
+	}
+
+	message := "Sample rows only; they don't grant access to the dataset"
+	if len(sample.WithheldColumns) > 0 {
+		message += fmt.Sprintf(". Columns withheld as likely personal data: %s", strings.Join(sample.WithheldColumns, ", "))
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: message,
+		Data:    sample,
+	})
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// DeleteBlob removes one of the owner's stored blobs. The owner must sign the request, and a
+// blob still backing an active on-chain dataset is only deleted with force set
+func (h *Handler) DeleteBlob(c *gin.Context) {
+	var req models.DeleteBlobRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if !h.verifyWalletSignature(c, req.Owner, req.WalletSignature) {
+		return
+	}
+
+	if strings.Contains(req.BlobName, "/") && !strings.HasPrefix(req.BlobName, req.Owner+"/") {
+		c.JSON(http.StatusForbidden, models.Response{
+			Success: false,
+			Error:   "Blob does not belong to the owner",
+			Code:    models.ErrCodeUnauthorized,
+		})
+		return
+	}
+
+	datasetIDs, err := h.datasetsBackedBy(req.Owner, req.BlobName)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to check datasets backed by %s: %v\n", req.BlobName, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to check which datasets use the blob: %v", err),
+		})
+		return
+	}
+	if len(datasetIDs) > 0 && !req.Force {
+		c.JSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Blob backs active datasets %v; set force to delete it anyway", datasetIDs),
+			Code:    models.ErrCodeBlobInUse,
+			Data:    map[string]interface{}{"dataset_ids": datasetIDs},
+		})
+		return
+	}
+
+	if err := h.storageService.DeleteBlob(req.Owner, req.BlobName); err != nil {
+		if errors.Is(err, services.ErrBlobNotFound) {
+			respondBlobNotFound(c, req.BlobName, err)
+			return
+		}
+		fmt.Printf("ERROR: Failed to delete blob %s: %v\n", req.BlobName, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to delete blob: %v", err),
+		})
+		return
+	}
+
+	data := map[string]interface{}{
+		"blob_name":   req.BlobName,
+		"dataset_ids": datasetIDs,
+	}
+	message := "Blob deleted"
+	if len(datasetIDs) > 0 {
+		message = fmt.Sprintf("Blob deleted; active datasets %v no longer have stored data", datasetIDs)
+		data["warning"] = message
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// ListStoredBlobs lists the blobs held in storage for the signing owner, flagging orphans
+// that no active on-chain dataset resolves to
+func (h *Handler) ListStoredBlobs(c *gin.Context) {
+	var req models.ListBlobsRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if !h.verifyWalletSignature(c, req.Owner, req.WalletSignature) {
+		return
+	}
+
+	blobs, err := h.storageService.ListBlobs(req.Owner)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to list blobs for %s: %v\n", req.Owner, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to list stored blobs: %v", err),
+		})
+		return
+	}
+
+	names := make([]string, len(blobs))
+	for i, blob := range blobs {
+		names[i] = blob.Name
+	}
+	links, err := h.linkedDatasets(req.Owner, names)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to link blobs to datasets for %s: %v\n", req.Owner, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to check which datasets use the blobs: %v", err),
+		})
+		return
+	}
+
+	orphans := 0
+	for i := range blobs {
+		blobs[i].DatasetIDs = links[blobs[i].Name]
+		blobs[i].Orphan = len(blobs[i].DatasetIDs) == 0
+		if blobs[i].Orphan {
+			orphans++
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"blobs":   blobs,
+			"count":   len(blobs),
+			"orphans": orphans,
+		},
+	})
+}
+
+// GetDownloadURL returns a short-lived presigned URL for downloading a dataset's blob
+// straight from storage. The requester passes the same access check as GetCSVData, but the
+// bytes never reach the backend, so the client is responsible for checking the data hash
+func (h *Handler) GetDownloadURL(c *gin.Context) {
+	var req models.DownloadURLRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+
+	if !h.authorizeDataAccess(c, req.Owner, *req.DatasetID, req.Requester, req.DataAccessProof) {
+		return
+	}
+	if !h.requireAllColumns(c, req.Owner, *req.DatasetID, req.Requester, "use /data/get-csv or /data/export") {
+		return
+	}
+
+	presigner, ok := h.storageService.(interface {
+		GeneratePresignedDownloadURL(accountAddress string, blobName string, ttl time.Duration) (string, error)
+	})
+	if !ok {
+		c.JSON(http.StatusNotImplemented, models.Response{
+			Success: false,
+			Error:   "Storage backend does not support presigned downloads; use /data/get-csv",
+		})
+		return
+	}
+
+	datasetRaw, err := h.aptosService.GetDataset(req.Owner, *req.DatasetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Dataset not found: %v", err),
+		})
+		return
+	}
+	datasetMap, _ := datasetRaw.(map[string]interface{})
+	if active, ok := datasetMap["is_active"].(bool); ok && !active {
+		c.JSON(http.StatusGone, models.Response{
+			Success: false,
+			Error:   "Dataset is no longer active",
+			Code:    models.ErrCodeDatasetInactive,
+		})
+		return
+	}
+
+	// Only the blob of the data hash the authorized dataset registered on chain is presigned
+	onChainHash, _ := datasetMap["data_hash"].(string)
+	blobName, err := h.findBlobByDataHash(req.Owner, onChainHash)
+	if err != nil {
+		respondBlobNotFound(c, onChainHash, err)
+		return
+	}
+
+	// Encrypted blobs are decrypted client-side; plain CSV needs nothing beyond the URL
+	encrypted := strings.HasSuffix(blobName, ".csv.enc")
+	if manifest, err := h.storageService.RetrieveManifest(req.Owner); err == nil {
+		if entry, ok := manifest[services.NormalizeDataHash(onChainHash)]; ok && entry.BlobName == blobName {
+			encrypted = encrypted || entry.Encrypted
+			// A server-encrypted blob is only useful to requesters holding a wrapped data key
+			if entry.KeyID != "" && !h.hasGranteeKey(req.Owner, *req.DatasetID, req.Requester) {
+				c.JSON(http.StatusConflict, models.Response{
+					Success: false,
+					Error:   "Dataset is encrypted at rest by the server; use /data/get-csv, or ask the owner to grant access with your public key",
+				})
+				return
+			}
+		}
+	}
+
+	ttlSeconds := config.AppConfig.PresignDownloadTTL
+	if req.TTLSeconds > 0 {
+		ttlSeconds = req.TTLSeconds
+	}
+	if ttlSeconds > config.AppConfig.PresignMaxTTL {
+		ttlSeconds = config.AppConfig.PresignMaxTTL
+	}
+	ttl := time.Duration(ttlSeconds) * time.Second
+
+	url, err := presigner.GeneratePresignedDownloadURL(req.Owner, blobName, ttl)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to presign %s: %v\n", blobName, err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to create download URL: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"url":         url,
+			"blob_name":   blobName,
+			"expires_at":  time.Now().Add(ttl).Unix(),
+			"ttl_seconds": ttlSeconds,
+			"encrypted":   encrypted,
+		},
+	})
+	h.recordAudit(c, req.Owner, *req.DatasetID, req.Requester, 0)
+}
+
+// datasetsBackedBy returns the IDs of the owner's active datasets whose data hash resolves to blobName
+func (h *Handler) datasetsBackedBy(owner string, blobName string) ([]uint64, error) {
+	links, err := h.linkedDatasets(owner, []string{blobName})
+	if err != nil {
+		return nil, err
+	}
+	if ids := links[blobName]; ids != nil {
+		return ids, nil
+	}
+	return []uint64{}, nil
+}
+
+// linkedDatasets maps each of blobNames to the owner's active datasets whose data hash
+// resolves to it, either through the manifest or because the blob is named after the hash.
+// Blobs no dataset resolves to are absent from the map
+func (h *Handler) linkedDatasets(owner string, blobNames []string) (map[string][]uint64, error) {
+	datasets, err := h.aptosService.GetUserDatasetsMetadata(owner)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := h.storageService.RetrieveManifest(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bare Supabase file names are compared with their {owner}/ prefix; Shelby names have none
+	fullName := func(name string) string {
+		if strings.HasPrefix(name, "csv_") || strings.Contains(name, "/") {
+			return name
+		}
+		return owner + "/" + name
+	}
+
+	links := make(map[string][]uint64)
+	for _, raw := range datasets {
+		dataset, _ := raw.(map[string]interface{})
+		id, _ := dataset["id"].(uint64)
+		active, _ := dataset["is_active"].(bool)
+		dataHash, _ := dataset["data_hash"].(string)
+		key := services.NormalizeDataHash(dataHash)
+		if !active || key == "" {
+			continue
+		}
+
+		entry, inManifest := manifest[key]
+		manifestNames := map[string]bool{}
+		if inManifest {
+			manifestNames[fullName(entry.BlobName)] = true
+			for _, legacy := range entry.LegacyBlobNames {
+				manifestNames[fullName(legacy)] = true
+			}
+		}
+		// Content-addressed {hash}.csv or legacy {timestamp}_{hash}.csv
+		contentName := strings.TrimPrefix(key, "0x") + ".csv"
+		namedSuffix := "_" + contentName
+		for _, name := range blobNames {
+			lower := strings.ToLower(name)
+			base := path.Base(lower)
+			if manifestNames[fullName(name)] ||
+				base == contentName || base == contentName+".enc" ||
+				strings.HasSuffix(lower, namedSuffix) || strings.HasSuffix(lower, namedSuffix+".enc") {
+				links[name] = append(links[name], id)
+			}
+		}
+	}
+	return links, nil
+}
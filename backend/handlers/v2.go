@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// The /api/v2 routes serve the v1 reads as GETs: path parameters name the resource, query
+// parameters carry paging and filters, and protected reads take the wallet signature in
+// X-Wallet-* headers. They call the same service methods and response helpers as v1
+
+// Wallet signature headers of protected GET routes, which have no body to carry it
+const (
+	headerWalletNonce         = "X-Wallet-Nonce"
+	headerWalletSignedMessage = "X-Wallet-Signed-Message"
+	headerWalletPublicKey     = "X-Wallet-Public-Key"
+	headerWalletSignature     = "X-Wallet-Signature"
+	headerDecryptionKey       = "X-Decryption-Key" // Kept out of the URL, where it would be logged
+	headerAccessToken         = "X-Access-Token"   // Sent back by data reads and accepted instead of the X-Wallet-* headers
+	headerAccessTokenExpires  = "X-Access-Token-Expires"
+)
+
+// ListOwnerDatasets returns an owner's datasets with metadata, like /vault/metadata
+// Optional query parameters:
+//   - active: true for live datasets only, false for deleted ones only
+//   - offset / limit: page through the list
+func (h *Handler) ListOwnerDatasets(c *gin.Context) {
+	owner, ok := pathAddress(c, "owner")
+	if !ok {
+		return
+	}
+
+	var active *bool
+	if v := c.Query("active"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			respondBadQuery(c, "active must be true or false")
+			return
+		}
+		active = &parsed
+	}
+	offset, limit, ok := queryPage(c)
+	if !ok {
+		return
+	}
+
+	metadata, err := h.aptosService.GetUserDatasetsMetadata(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	datasets := make([]interface{}, 0, len(metadata))
+	for _, d := range metadata {
+		datasetMap, _ := d.(map[string]interface{})
+		if active != nil {
+			isActive, _ := datasetMap["is_active"].(bool)
+			if isActive != *active {
+				continue
+			}
+		}
+		if datasetMap != nil {
+			services.MarkReactivatable(datasetMap)
+		}
+		datasets = append(datasets, d)
+	}
+
+	page := models.OwnerDatasetsPage{Total: len(datasets), Offset: offset, Limit: limit}
+	if offset < len(datasets) {
+		datasets = datasets[offset:]
+	} else {
+		datasets = datasets[:0]
+	}
+	if limit > 0 && limit < len(datasets) {
+		datasets = datasets[:limit]
+	}
+	page.Datasets = datasets
+
+	respondWithETag(c, models.Response{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// GetOwnerDataset returns one dataset's on-chain record, like /data/get
+func (h *Handler) GetOwnerDataset(c *gin.Context) {
+	owner, datasetID, ok := pathDataset(c)
+	if !ok {
+		return
+	}
+
+	dataset, err := h.loadDataset(owner, datasetID)
+	if err != nil {
+		fmt.Printf("ERROR: GetDataset failed: %v\n", err)
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	respondWithETag(c, models.Response{
+		Success: true,
+		Data:    dataset,
+	})
+}
+
+// GetOwnerDatasetCSV returns a dataset's rows, like /data/get-csv. requester is a query
+// parameter and its wallet signature comes in the X-Wallet-* headers. data_hash may be
+// omitted, in which case the on-chain one is used
+func (h *Handler) GetOwnerDatasetCSV(c *gin.Context) {
+	owner, datasetID, ok := pathDataset(c)
+	if !ok {
+		return
+	}
+
+	req := models.GetCSVDataRequest{
+		Owner:         owner,
+		DatasetID:     &datasetID,
+		DataHash:      c.Query("data_hash"),
+		Format:        c.Query("format"),
+		Decryption:    c.Query("decryption"),
+		DecryptionKey: c.GetHeader(headerDecryptionKey),
+		DataAccessProof: models.DataAccessProof{
+			Nonce:         c.GetHeader(headerWalletNonce),
+			SignedMessage: c.GetHeader(headerWalletSignedMessage),
+			PublicKey:     c.GetHeader(headerWalletPublicKey),
+			Signature:     c.GetHeader(headerWalletSignature),
+			AccessToken:   c.GetHeader(headerAccessToken),
+		},
+	}
+
+	requester, err := services.NormalizeAddress(c.Query("requester"))
+	if err != nil {
+		respondBadQuery(c, "requester must be a valid account address")
+		return
+	}
+	req.Requester = requester
+
+	proof := req.DataAccessProof
+	if proof.AccessToken == "" && (proof.Nonce == "" || proof.SignedMessage == "" || proof.PublicKey == "" || proof.Signature == "") {
+		respondBadQuery(c, fmt.Sprintf("%s, %s, %s and %s headers are required without an %s header", headerWalletNonce, headerWalletSignedMessage, headerWalletPublicKey, headerWalletSignature, headerAccessToken))
+		return
+	}
+	switch req.Format {
+	case "", csvFormatRows, csvFormatRecords:
+	default:
+		respondBadQuery(c, "format must be rows or records")
+		return
+	}
+	switch req.Decryption {
+	case "", "server", "client", "provided_key":
+	default:
+		respondBadQuery(c, "decryption must be server, client or provided_key")
+		return
+	}
+
+	for _, v := range c.QueryArray("columns") {
+		for _, column := range strings.Split(v, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				req.Columns = append(req.Columns, column)
+			}
+		}
+	}
+	// Unlike the owner listing, rows are only paginated when offset or limit is given
+	for _, param := range []struct {
+		name   string
+		target **int
+	}{{"offset", &req.Offset}, {"limit", &req.Limit}} {
+		v := c.Query(param.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			respondBadQuery(c, param.name+" must be a non-negative integer")
+			return
+		}
+		*param.target = &parsed
+	}
+
+	if req.DataHash == "" {
+		dataset, err := h.loadDataset(owner, datasetID)
+		if err != nil {
+			fmt.Printf("ERROR: GetDataset failed: %v\n", err)
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		req.DataHash = dataset.DataHash
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	// Rows depend on who's asking and their grant, so shared caches must not keep them
+	c.Header("Cache-Control", "private, no-store")
+	h.respondCSVData(c, req)
+}
+
+// GetUserVaultByAddress returns the dataset IDs in a user's vault, like /vault/get
+func (h *Handler) GetUserVaultByAddress(c *gin.Context) {
+	user, ok := pathAddress(c, "address")
+	if !ok {
+		return
+	}
+
+	datasets, err := h.aptosService.GetUserVault(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	respondWithETag(c, models.Response{
+		Success: true,
+		Data: models.VaultInfo{
+			Datasets: datasets,
+			Count:    uint64(len(datasets)),
+		},
+	})
+}
+
+// pathAddress reads and normalizes an account address path parameter
+func pathAddress(c *gin.Context, name string) (string, bool) {
+	address, err := services.NormalizeAddress(c.Param(name))
+	if err != nil {
+		respondBadQuery(c, fmt.Sprintf("invalid %s path parameter: %v", name, err))
+		return "", false
+	}
+	return address, true
+}
+
+// pathDataset reads the :owner and :id path parameters
+func pathDataset(c *gin.Context) (string, uint64, bool) {
+	owner, ok := pathAddress(c, "owner")
+	if !ok {
+		return "", 0, false
+	}
+	datasetID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		respondBadQuery(c, fmt.Sprintf("dataset id must be a valid number: %v", err))
+		return "", 0, false
+	}
+	return owner, datasetID, true
+}
+
+// queryPage reads the offset and limit query parameters; a zero limit means no limit
+func queryPage(c *gin.Context) (int, int, bool) {
+	var page [2]int
+	for i, name := range []string{"offset", "limit"} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			respondBadQuery(c, name+" must be a non-negative integer")
+			return 0, 0, false
+		}
+		page[i] = parsed
+	}
+	return page[0], page[1], true
+}
+
+func respondBadQuery(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, models.Response{
+		Success: false,
+		Error:   message,
+		Code:    models.ErrCodeValidationFailed,
+	})
+}
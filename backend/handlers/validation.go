@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Custom binding rules, so malformed addresses and hashes are refused before any service call
+const (
+	ruleAptosAddress = "aptos_address" // Account address as up to 64 hex digits (AIP-40), 0x prefix optional
+	ruleHexHash      = "hexhash"       // Data hash as hex, 0x prefix optional, as dataHashKey accepts
+	ruleDeadline     = "deadline"      // Unix seconds still to come, or 0 for none
+)
+
+// maxHexHashLength matches the longest data hash the storage backends look blobs up by
+const maxHexHashLength = 128
+
+// RegisterValidators adds the custom binding rules to gin's validator and makes it name
+// fields by their JSON names. Call it once before serving
+func RegisterValidators() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return fmt.Errorf("unexpected validator engine %T", binding.Validator.Engine())
+	}
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	if err := v.RegisterValidation(ruleAptosAddress, func(fl validator.FieldLevel) bool {
+		_, err := services.NormalizeAddress(fl.Field().String())
+		return err == nil
+	}); err != nil {
+		return err
+	}
+	// A grant that has already expired is a mistake, most often a timestamp in the wrong unit
+	if err := v.RegisterValidation(ruleDeadline, func(fl validator.FieldLevel) bool {
+		deadline := fl.Field().Uint()
+		return deadline == 0 || deadline > uint64(time.Now().Unix())
+	}); err != nil {
+		return err
+	}
+	return v.RegisterValidation(ruleHexHash, func(fl validator.FieldLevel) bool {
+		hash := strings.TrimPrefix(strings.TrimPrefix(fl.Field().String(), "0x"), "0X")
+		if hash == "" || len(hash) > maxHexHashLength {
+			return false
+		}
+		for _, r := range hash {
+			if !unicode.Is(unicode.ASCII_Hex_Digit, r) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// bindAndValidate binds the JSON body into obj. When it's malformed or fails a binding
+// rule, it answers 400 VALIDATION_FAILED with the problem fields and returns false.
+// Addresses are rewritten to their normal form, so handlers and services only see one
+// spelling of each account
+func bindAndValidate(c *gin.Context, obj interface{}) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		normalizeAddresses(reflect.ValueOf(obj))
+		return true
+	}
+	c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+	return false
+}
+
+// normalizeAddresses rewrites the string fields bound with the aptos_address rule, in v and
+// the structs it embeds or nests, to services.NormalizeAddress form
+func normalizeAddresses(v reflect.Value) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if value.Kind() == reflect.String && strings.Contains(field.Tag.Get("binding"), ruleAptosAddress) {
+			if address, err := services.NormalizeAddress(value.String()); err == nil {
+				value.SetString(address)
+			}
+			continue
+		}
+		normalizeAddresses(value)
+	}
+}
+
+// validationErrorResponse turns a binding error into a response listing the fields at fault
+func validationErrorResponse(err error) models.Response {
+	var details []models.FieldError
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		for _, fe := range validationErrs {
+			details = append(details, fieldError(fe))
+		}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		details = []models.FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be %s", typeErr.Field, jsonTypeName(typeErr.Type)),
+		}}
+	case errors.Is(err, io.EOF):
+		return models.Response{Success: false, Error: "request body is required", Code: models.ErrCodeValidationFailed}
+	default:
+		return models.Response{Success: false, Error: fmt.Sprintf("invalid JSON body: %v", err), Code: models.ErrCodeValidationFailed}
+	}
+
+	messages := make([]string, len(details))
+	for i, detail := range details {
+		messages[i] = detail.Message
+	}
+	return models.Response{
+		Success: false,
+		Error:   strings.Join(messages, "; "),
+		Code:    models.ErrCodeValidationFailed,
+		Details: details,
+	}
+}
+
+// fieldError describes one failed rule, naming the field by its JSON path
+func fieldError(fe validator.FieldError) models.FieldError {
+	// The namespace starts with the struct's Go name. Other Go names left in it are embedded
+	// structs (every other field has a json tag), which JSON flattens
+	var path []string
+	for _, segment := range strings.Split(fe.Namespace(), ".")[1:] {
+		if segment != "" && !unicode.IsUpper(rune(segment[0])) {
+			path = append(path, segment)
+		}
+	}
+	field := strings.Join(path, ".")
+	if field == "" {
+		field = fe.Field()
+	}
+
+	var rule string
+	switch fe.Tag() {
+	case "required":
+		rule = "is required"
+	case "required_without":
+		rule = "is required unless " + snakeCase(fe.Param()) + " is given"
+	case "required_with":
+		rule = "is required when " + snakeCase(fe.Param()) + " is given"
+	case "required_unless":
+		other, value, _ := strings.Cut(fe.Param(), " ")
+		rule = "is required unless " + snakeCase(other) + " is " + value
+	case "min", "max":
+		bound := map[string]string{"min": "at least", "max": "at most"}[fe.Tag()]
+		switch fe.Kind() {
+		case reflect.String:
+			rule = fmt.Sprintf("must be %s %s characters", bound, fe.Param())
+		case reflect.Slice, reflect.Array, reflect.Map:
+			rule = fmt.Sprintf("must have %s %s items", bound, fe.Param())
+		default:
+			rule = fmt.Sprintf("must be %s %s", bound, fe.Param())
+		}
+	case "oneof":
+		rule = "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "url":
+		rule = "must be a valid URL"
+	case ruleAptosAddress:
+		rule = "must be an account address of up to 64 hex digits"
+	case ruleHexHash:
+		rule = fmt.Sprintf("must be a hex hash of at most %d digits", maxHexHashLength)
+	case ruleDeadline:
+		rule = "must be a future Unix time in seconds, or 0 for no expiry"
+	default:
+		rule = fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+
+	return models.FieldError{Field: field, Rule: fe.Tag(), Message: field + " " + rule}
+}
+
+// snakeCase turns the Go name of a field named in a rule's parameter into its JSON name,
+// which for every request model is the snake_case form
+func snakeCase(goName string) string {
+	var b strings.Builder
+	for i, r := range goName {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// jsonTypeName names the JSON type a Go type is decoded from
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterWebhook registers an endpoint to be notified of events on the owner's datasets.
+// The response carries the secret once; later listings leave it out
+func (h *Handler) RegisterWebhook(c *gin.Context) {
+	var req models.RegisterWebhookRequest
+	if !bindAndValidate(c, &req) {
+		return
+	}
+	if !h.verifyWalletSignature(c, req.Owner, req.WalletSignature) {
+		return
+	}
+
+	hook, err := h.webhooks.Register(req.Owner, req.URL, req.Secret, req.Events)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "Webhook registered",
+		Data:    hook,
+	})
+}
+
+// ListWebhooks returns the owner's webhooks
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	req, ok := h.bindWebhookOwner(c, false)
+	if !ok {
+		return
+	}
+
+	hooks, err := h.webhooks.List(req.Owner)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data:    hooks,
+	})
+}
+
+// DeleteWebhook removes one of the owner's webhooks
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	req, ok := h.bindWebhookOwner(c, true)
+	if !ok {
+		return
+	}
+
+	if err := h.webhooks.Delete(req.Owner, req.ID); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Message: "Webhook deleted",
+	})
+}
+
+// GetWebhookStatus returns a webhook's recent delivery attempts, newest first
+func (h *Handler) GetWebhookStatus(c *gin.Context) {
+	req, ok := h.bindWebhookOwner(c, true)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.webhooks.Deliveries(req.Owner, req.ID)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"id":         req.ID,
+			"deliveries": deliveries,
+		},
+	})
+}
+
+// bindWebhookOwner binds a webhook request and verifies the owner's wallet signature. It
+// writes the error response and returns false on failure
+func (h *Handler) bindWebhookOwner(c *gin.Context, needID bool) (models.WebhookOwnerRequest, bool) {
+	var req models.WebhookOwnerRequest
+	if !bindAndValidate(c, &req) {
+		return req, false
+	}
+	if needID && req.ID == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Success: false,
+			Error:   "Missing required field: id",
+		})
+		return req, false
+	}
+	return req, h.verifyWalletSignature(c, req.Owner, req.WalletSignature)
+}
+
+// respondWebhookError maps webhook failures to 404, 400 or 500
+func respondWebhookError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidWebhook):
+		status = http.StatusBadRequest
+	default:
+		fmt.Printf("ERROR: Webhook operation failed: %v\n", err)
+	}
+	c.JSON(status, models.Response{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/datax/backend/models"
+)
+
+const accessRequestColumns = `id, owner_address, requester_address, dataset_id, status, message, price_apt, payment_tx_hash,
+	paid_amount_octas, payment_version, created_at, approved_at, paid_at`
+
+// CreateAccessRequest stores a pending request. A request already made for the same owner,
+// requester and dataset is returned unchanged, unless it was denied: asking again reopens it
+func (d *DB) CreateAccessRequest(request models.AccessRequest) (models.AccessRequest, error) {
+	id, err := randomID()
+	if err != nil {
+		return models.AccessRequest{}, err
+	}
+	_, err = d.sql.Exec(d.rebind(`INSERT INTO access_requests (id, owner_address, requester_address, dataset_id, status, message, price_apt, created_at)
+		VALUES ($1, $2, $3, $4, 'pending', $5, $6, $7)
+		ON CONFLICT (owner_address, requester_address, dataset_id) DO UPDATE
+		SET status = 'pending', message = excluded.message, price_apt = excluded.price_apt, created_at = excluded.created_at,
+			payment_tx_hash = '', paid_amount_octas = NULL, payment_version = NULL, approved_at = NULL, paid_at = NULL
+		WHERE access_requests.status = 'denied'`),
+		id, request.OwnerAddress, request.RequesterAddress, int64(request.DatasetID), request.Message, request.PriceAPT, time.Now().Unix())
+	if err != nil {
+		return models.AccessRequest{}, fmt.Errorf("failed to store access request: %w", err)
+	}
+	return d.GetAccessRequest(request.OwnerAddress, request.RequesterAddress, request.DatasetID)
+}
+
+// GetAccessRequest returns the request a requester made for an owner's dataset, or ErrNotFound
+func (d *DB) GetAccessRequest(owner string, requester string, datasetID uint64) (models.AccessRequest, error) {
+	row := d.sql.QueryRow(d.rebind(`SELECT `+accessRequestColumns+` FROM access_requests
+		WHERE owner_address = $1 AND requester_address = $2 AND dataset_id = $3`), owner, requester, int64(datasetID))
+	request, err := scanAccessRequest(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.AccessRequest{}, ErrNotFound
+	}
+	if err != nil {
+		return models.AccessRequest{}, fmt.Errorf("failed to load access request: %w", err)
+	}
+	return request, nil
+}
+
+// ListAccessRequestsByOwner returns the requests made for an owner's datasets, newest first
+func (d *DB) ListAccessRequestsByOwner(owner string) ([]models.AccessRequest, error) {
+	return d.listAccessRequests(`owner_address = $1`, owner)
+}
+
+// ListAccessRequestsByRequester returns the requests a requester made, newest first
+func (d *DB) ListAccessRequestsByRequester(requester string) ([]models.AccessRequest, error) {
+	return d.listAccessRequests(`requester_address = $1`, requester)
+}
+
+func (d *DB) listAccessRequests(where string, address string) ([]models.AccessRequest, error) {
+	rows, err := d.sql.Query(d.rebind(`SELECT `+accessRequestColumns+` FROM access_requests WHERE `+where+` ORDER BY created_at DESC, id`), address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := make([]models.AccessRequest, 0)
+	for rows.Next() {
+		request, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read access request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+// TransitionAccessRequest moves a request from one status to another, stamping approved_at
+// or paid_at. A payment, for paid, is recorded on the request and its transaction marked
+// consumed in the same transaction. Returns ErrNotFound when there's no such request,
+// ErrConflict when it isn't in the from status and ErrDuplicate when the payment
+// transaction already paid for another request
+func (d *DB) TransitionAccessRequest(owner string, requester string, datasetID uint64, from string, to string, payment *models.VerifiedPayment) (models.AccessRequest, error) {
+	now := time.Now().Unix()
+	var approvedAt, paidAt interface{}
+	switch to {
+	case "approved":
+		approvedAt = now
+	case "paid":
+		paidAt = now
+	}
+	paymentTxHash := ""
+	var paidAmount, paymentVersion interface{}
+	if payment != nil {
+		paymentTxHash = payment.TxHash
+		paidAmount = int64(payment.AmountOctas)
+		paymentVersion = int64(payment.Version)
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return models.AccessRequest{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(d.rebind(`UPDATE access_requests
+		SET status = $1, approved_at = COALESCE($2, approved_at), paid_at = COALESCE($3, paid_at),
+			payment_tx_hash = CASE WHEN $4 = '' THEN payment_tx_hash ELSE $4 END,
+			paid_amount_octas = COALESCE($5, paid_amount_octas), payment_version = COALESCE($6, payment_version)
+		WHERE owner_address = $7 AND requester_address = $8 AND dataset_id = $9 AND status = $10`),
+		to, approvedAt, paidAt, paymentTxHash, paidAmount, paymentVersion, owner, requester, int64(datasetID), from)
+	if err != nil {
+		return models.AccessRequest{}, fmt.Errorf("failed to update access request: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		tx.Rollback()
+		if _, err := d.GetAccessRequest(owner, requester, datasetID); err != nil {
+			return models.AccessRequest{}, err
+		}
+		return models.AccessRequest{}, ErrConflict
+	}
+
+	if payment != nil {
+		result, err := tx.Exec(d.rebind(`INSERT INTO payment_transactions (tx_hash, access_request_id, consumed_at)
+			SELECT $1, id, $2 FROM access_requests WHERE owner_address = $3 AND requester_address = $4 AND dataset_id = $5
+			ON CONFLICT (tx_hash) DO NOTHING`),
+			payment.TxHash, now, owner, requester, int64(datasetID))
+		if err != nil {
+			return models.AccessRequest{}, fmt.Errorf("failed to record payment transaction: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return models.AccessRequest{}, ErrDuplicate
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.AccessRequest{}, fmt.Errorf("failed to commit access request: %w", err)
+	}
+	return d.GetAccessRequest(owner, requester, datasetID)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAccessRequest(row rowScanner) (models.AccessRequest, error) {
+	var request models.AccessRequest
+	var datasetID, createdAt int64
+	var paidAmount, paymentVersion, approvedAt, paidAt sql.NullInt64
+	err := row.Scan(&request.ID, &request.OwnerAddress, &request.RequesterAddress, &datasetID, &request.Status,
+		&request.Message, &request.PriceAPT, &request.PaymentTxHash, &paidAmount, &paymentVersion, &createdAt, &approvedAt, &paidAt)
+	if err != nil {
+		return models.AccessRequest{}, err
+	}
+	request.DatasetID = uint64(datasetID)
+	request.PaidAmountOctas = uint64(paidAmount.Int64)
+	request.PaymentVersion = uint64(paymentVersion.Int64)
+	request.CreatedAt = formatUnix(createdAt)
+	if approvedAt.Valid {
+		request.ApprovedAt = formatUnix(approvedAt.Int64)
+	}
+	if paidAt.Valid {
+		request.PaidAt = formatUnix(paidAt.Int64)
+	}
+	return request, nil
+}
+
+func formatUnix(seconds int64) string {
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+)
+
+// AppendAuditEntries adds entries to the audit log in one transaction. Rows are only ever
+// inserted, never updated or deleted
+func (d *DB) AppendAuditEntries(entries []models.AuditEntry) error {
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin audit log write: %w", err)
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.Prepare(d.rebind(`INSERT INTO audit_log (id, owner_address, dataset_id, requester_address, endpoint, rows_returned, created_at, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare audit log write: %w", err)
+	}
+	defer statement.Close()
+
+	for _, entry := range entries {
+		id, err := randomID()
+		if err != nil {
+			return err
+		}
+		_, err = statement.Exec(id, entry.Owner, int64(entry.DatasetID), entry.Requester, entry.Endpoint, entry.Rows, entry.Timestamp, entry.RequestID)
+		if err != nil {
+			return fmt.Errorf("failed to write audit log: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries returns a page of owner's audit entries matching filter, newest first,
+// and how many match in all
+func (d *DB) ListAuditEntries(owner string, filter models.AuditFilter, offset int, limit int) ([]models.AuditEntry, int, error) {
+	clause, args := auditConditions(owner, filter)
+
+	var total int
+	if err := d.sql.QueryRow(d.rebind(`SELECT COUNT(*) FROM audit_log WHERE `+clause), args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit log: %w", err)
+	}
+
+	entries := make([]models.AuditEntry, 0)
+	query := fmt.Sprintf(`SELECT `+auditColumns+` FROM audit_log WHERE %s ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d`, clause, len(args)+1, len(args)+2)
+	err := d.scanAuditEntries(query, append(args, limit, offset), func(entry models.AuditEntry) {
+		entries = append(entries, entry)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// EachAuditEntry calls fn with every one of owner's audit entries matching filter, oldest
+// first, reading them as a stream rather than all at once
+func (d *DB) EachAuditEntry(owner string, filter models.AuditFilter, fn func(models.AuditEntry)) error {
+	clause, args := auditConditions(owner, filter)
+	return d.scanAuditEntries(`SELECT `+auditColumns+` FROM audit_log WHERE `+clause+` ORDER BY created_at, id`, args, fn)
+}
+
+const auditColumns = `owner_address, dataset_id, requester_address, endpoint, rows_returned, created_at, request_id`
+
+// auditConditions is the WHERE clause selecting owner's entries that match filter, and its arguments
+func auditConditions(owner string, filter models.AuditFilter) (string, []interface{}) {
+	conditions := []string{`owner_address = $1`}
+	args := []interface{}{owner}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.DatasetID != nil {
+		where(`dataset_id = $?`, int64(*filter.DatasetID))
+	}
+	if filter.Requester != "" {
+		where(`requester_address = $?`, filter.Requester)
+	}
+	if filter.From > 0 {
+		where(`created_at >= $?`, filter.From)
+	}
+	if filter.To > 0 {
+		where(`created_at <= $?`, filter.To)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (d *DB) scanAuditEntries(query string, args []interface{}, fn func(models.AuditEntry)) error {
+	rows, err := d.sql.Query(d.rebind(query), args...)
+	if err != nil {
+		return fmt.Errorf("failed to list audit log: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		var datasetID int64
+		err := rows.Scan(&entry.Owner, &datasetID, &entry.Requester, &entry.Endpoint, &entry.Rows, &entry.Timestamp, &entry.RequestID)
+		if err != nil {
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+		entry.DatasetID = uint64(datasetID)
+		fn(entry)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,265 @@
+// Package db is the optional SQL persistence layer selected by DATABASE_URL. It holds the
+// backend's state documents, access requests, idempotency keys and audit log in Postgres
+// or SQLite, with the schema migrated in code on Open
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQL dialects
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite3"
+)
+
+var (
+	// ErrNotFound is returned when a row doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a conditional write lost to a concurrent one
+	ErrConflict = errors.New("modified concurrently")
+	// ErrDuplicate is returned when a row with the same unique key already exists
+	ErrDuplicate = errors.New("already exists")
+)
+
+// DB is an open database with its schema migrated
+type DB struct {
+	sql     *sql.DB
+	dialect string
+}
+
+// Open connects to DATABASE_URL and applies pending migrations. Accepted forms are
+// postgres://... (or postgresql://...) and sqlite://path (or sqlite:///absolute/path)
+func Open(databaseURL string) (*DB, error) {
+	var dialect, dsn string
+	switch {
+	case strings.HasPrefix(databaseURL, "postgres://"), strings.HasPrefix(databaseURL, "postgresql://"):
+		dialect, dsn = DialectPostgres, databaseURL
+	case strings.HasPrefix(databaseURL, "sqlite://"):
+		path := strings.TrimPrefix(databaseURL, "sqlite://")
+		if path == "" {
+			return nil, fmt.Errorf("DATABASE_URL sqlite:// needs a file path")
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+		dialect, dsn = DialectSQLite, "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on"
+	default:
+		return nil, fmt.Errorf("unsupported DATABASE_URL scheme (supported: postgres://, sqlite://)")
+	}
+
+	conn, err := sql.Open(dialect, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	d := &DB{sql: conn, dialect: dialect}
+	if err := d.migrate(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close closes the connection pool
+func (d *DB) Close() error {
+	return d.sql.Close()
+}
+
+// Dialect is DialectPostgres or DialectSQLite
+func (d *DB) Dialect() string {
+	return d.dialect
+}
+
+// placeholder matches the $1, $2, ... bind parameters queries are written with
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// rebind adapts a query to the dialect: SQLite takes numbered parameters as ?1, ?2, ...
+func (d *DB) rebind(query string) string {
+	if d.dialect == DialectSQLite {
+		return placeholder.ReplaceAllString(query, "?$1")
+	}
+	return query
+}
+
+// migration is one schema change. Statements must work on both Postgres and SQLite
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// migrations are applied in order and never edited once released; add a new one instead
+var migrations = []migration{
+	{1, "state documents", []string{
+		`CREATE TABLE state_documents (
+			key        TEXT PRIMARY KEY,
+			value      TEXT NOT NULL,
+			etag       TEXT NOT NULL,
+			updated_at BIGINT NOT NULL
+		)`,
+	}},
+	{2, "access requests", []string{
+		`CREATE TABLE access_requests (
+			id                TEXT PRIMARY KEY,
+			owner_address     TEXT NOT NULL,
+			requester_address TEXT NOT NULL,
+			dataset_id        BIGINT NOT NULL,
+			status            TEXT NOT NULL CHECK (status IN ('pending', 'approved', 'denied', 'paid')),
+			message           TEXT NOT NULL DEFAULT '',
+			price_apt         DOUBLE PRECISION NOT NULL DEFAULT 0,
+			payment_tx_hash   TEXT NOT NULL DEFAULT '',
+			created_at        BIGINT NOT NULL,
+			approved_at       BIGINT,
+			paid_at           BIGINT,
+			UNIQUE (owner_address, requester_address, dataset_id)
+		)`,
+		`CREATE INDEX idx_access_requests_owner ON access_requests(owner_address, created_at)`,
+		`CREATE INDEX idx_access_requests_requester ON access_requests(requester_address, created_at)`,
+	}},
+	{3, "idempotency keys", []string{
+		`CREATE TABLE idempotency_keys (
+			key          TEXT PRIMARY KEY,
+			fingerprint  TEXT NOT NULL,
+			status_code  INTEGER NOT NULL DEFAULT 0,
+			content_type TEXT NOT NULL DEFAULT '',
+			body         TEXT NOT NULL DEFAULT '',
+			expires_at   BIGINT NOT NULL
+		)`,
+		`CREATE INDEX idx_idempotency_keys_expires ON idempotency_keys(expires_at)`,
+	}},
+	{4, "audit log", []string{
+		`CREATE TABLE audit_log (
+			id                TEXT PRIMARY KEY,
+			owner_address     TEXT NOT NULL,
+			dataset_id        BIGINT NOT NULL,
+			requester_address TEXT NOT NULL,
+			endpoint          TEXT NOT NULL,
+			rows_returned     INTEGER NOT NULL,
+			created_at        BIGINT NOT NULL,
+			request_id        TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX idx_audit_log_owner ON audit_log(owner_address, created_at)`,
+	}},
+	{5, "payment transactions", []string{
+		`ALTER TABLE access_requests ADD COLUMN paid_amount_octas BIGINT`,
+		`ALTER TABLE access_requests ADD COLUMN payment_version BIGINT`,
+		`CREATE TABLE payment_transactions (
+			tx_hash           TEXT PRIMARY KEY,
+			access_request_id TEXT NOT NULL,
+			consumed_at       BIGINT NOT NULL
+		)`,
+		`INSERT INTO payment_transactions (tx_hash, access_request_id, consumed_at)
+			SELECT CASE WHEN LOWER(payment_tx_hash) LIKE '0x%' THEN LOWER(payment_tx_hash) ELSE '0x' || LOWER(payment_tx_hash) END,
+				id, COALESCE(paid_at, created_at)
+			FROM access_requests WHERE payment_tx_hash <> ''
+			ON CONFLICT (tx_hash) DO NOTHING`,
+	}},
+}
+
+// migrate applies the migrations newer than the recorded schema version in one transaction.
+// On Postgres an advisory lock keeps instances starting together from migrating twice
+func (d *DB) migrate() error {
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	if d.dialect == DialectPostgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(7244851)`); err != nil {
+			return fmt.Errorf("failed to lock schema for migration: %w", err)
+		}
+	}
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		for _, statement := range m.statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.Exec(d.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`), m.version, m.name, time.Now().Unix()); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		fmt.Printf("DEBUG: Applied database migration %d (%s)\n", m.version, m.name)
+	}
+	return tx.Commit()
+}
+
+// LoadDocument returns the JSON document stored at key and its ETag, or ErrNotFound
+func (d *DB) LoadDocument(key string) ([]byte, string, error) {
+	var value, etag string
+	err := d.sql.QueryRow(d.rebind(`SELECT value, etag FROM state_documents WHERE key = $1`), key).Scan(&value, &etag)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load %s: %w", key, err)
+	}
+	return []byte(value), etag, nil
+}
+
+// SaveDocument stores value at key if the stored ETag is still etag (or, with an empty
+// etag, if nothing is stored yet) and returns the new ETag. Returns ErrConflict otherwise
+func (d *DB) SaveDocument(key string, value []byte, etag string) (string, error) {
+	newETag, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	var result sql.Result
+	if etag == "" {
+		result, err = d.sql.Exec(d.rebind(`INSERT INTO state_documents (key, value, etag, updated_at) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (key) DO NOTHING`), key, string(value), newETag, time.Now().Unix())
+	} else {
+		result, err = d.sql.Exec(d.rebind(`UPDATE state_documents SET value = $1, etag = $2, updated_at = $3 WHERE key = $4 AND etag = $5`),
+			string(value), newETag, time.Now().Unix(), key, etag)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save %s: %w", key, err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return "", ErrConflict
+	}
+	return newETag, nil
+}
+
+func randomID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
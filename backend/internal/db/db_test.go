@@ -0,0 +1,279 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/datax/backend/models"
+)
+
+const (
+	testOwner     = "0x000000000000000000000000000000000000000000000000000000000000a001"
+	testRequester = "0x000000000000000000000000000000000000000000000000000000000000b002"
+	testOther     = "0x000000000000000000000000000000000000000000000000000000000000c003"
+)
+
+// openTestDB opens a migrated SQLite database in a temporary directory
+func openTestDB(t *testing.T) (*DB, string) {
+	t.Helper()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "nested", "datax.db")
+	d, err := Open(url)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d, url
+}
+
+func TestOpenMigratesOnce(t *testing.T) {
+	d, url := openTestDB(t)
+	if d.Dialect() != DialectSQLite {
+		t.Errorf("Dialect = %q, want %q", d.Dialect(), DialectSQLite)
+	}
+	var version, applied int
+	d.sql.QueryRow(`SELECT MAX(version), COUNT(*) FROM schema_migrations`).Scan(&version, &applied)
+	if version != migrations[len(migrations)-1].version || applied != len(migrations) {
+		t.Fatalf("schema at version %d after %d migrations, want %d after %d", version, applied, migrations[len(migrations)-1].version, len(migrations))
+	}
+	if _, err := d.SaveDocument("kept", []byte(`{}`), ""); err != nil {
+		t.Fatalf("SaveDocument: %v", err)
+	}
+	d.Close()
+
+	// Reopening applies nothing again and keeps the data
+	reopened, err := Open(url)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close()
+	reopened.sql.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied)
+	if applied != len(migrations) {
+		t.Errorf("%d migrations recorded after reopening, want %d", applied, len(migrations))
+	}
+	if _, _, err := reopened.LoadDocument("kept"); err != nil {
+		t.Errorf("LoadDocument after reopening: %v", err)
+	}
+}
+
+func TestOpenRejectsUnknownURLs(t *testing.T) {
+	for _, url := range []string{"", "mysql://localhost/datax", "sqlite://"} {
+		if d, err := Open(url); err == nil {
+			d.Close()
+			t.Errorf("Open(%q) succeeded", url)
+		}
+	}
+}
+
+func TestDocumentsAreWrittenConditionally(t *testing.T) {
+	d, _ := openTestDB(t)
+
+	if _, _, err := d.LoadDocument("state"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("LoadDocument of a missing key = %v, want %v", err, ErrNotFound)
+	}
+	etag, err := d.SaveDocument("state", []byte(`{"n":1}`), "")
+	if err != nil {
+		t.Fatalf("first SaveDocument: %v", err)
+	}
+	// Creating it again, or writing over a stale ETag, loses
+	if _, err := d.SaveDocument("state", []byte(`{"n":2}`), ""); !errors.Is(err, ErrConflict) {
+		t.Errorf("second create = %v, want %v", err, ErrConflict)
+	}
+	updated, err := d.SaveDocument("state", []byte(`{"n":3}`), etag)
+	if err != nil || updated == etag {
+		t.Fatalf("update = %q, %v, want a new ETag", updated, err)
+	}
+	if _, err := d.SaveDocument("state", []byte(`{"n":4}`), etag); !errors.Is(err, ErrConflict) {
+		t.Errorf("update over a stale ETag = %v, want %v", err, ErrConflict)
+	}
+
+	value, loadedETag, err := d.LoadDocument("state")
+	if err != nil || string(value) != `{"n":3}` || loadedETag != updated {
+		t.Errorf("LoadDocument = %s, %q, %v, want {\"n\":3}, %q", value, loadedETag, err, updated)
+	}
+}
+
+func TestAccessRequestLifecycle(t *testing.T) {
+	d, _ := openTestDB(t)
+	request := models.AccessRequest{OwnerAddress: testOwner, RequesterAddress: testRequester, DatasetID: 2, Message: "please", PriceAPT: 1.5}
+
+	created, err := d.CreateAccessRequest(request)
+	if err != nil {
+		t.Fatalf("CreateAccessRequest: %v", err)
+	}
+	if created.ID == "" || created.Status != "pending" || created.Message != "please" || created.PriceAPT != 1.5 || created.CreatedAt == "" {
+		t.Fatalf("created %+v", created)
+	}
+	// Asking again while it's pending changes nothing
+	again, err := d.CreateAccessRequest(models.AccessRequest{OwnerAddress: testOwner, RequesterAddress: testRequester, DatasetID: 2, Message: "again"})
+	if err != nil || again.ID != created.ID || again.Message != "please" {
+		t.Errorf("repeated request = %+v, %v, want the first unchanged", again, err)
+	}
+
+	// Only the status a request is in moves it on
+	if _, err := d.TransitionAccessRequest(testOwner, testRequester, 2, "approved", "paid", nil); !errors.Is(err, ErrConflict) {
+		t.Errorf("transition from the wrong status = %v, want %v", err, ErrConflict)
+	}
+	if _, err := d.TransitionAccessRequest(testOwner, testOther, 2, "pending", "approved", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("transition of a missing request = %v, want %v", err, ErrNotFound)
+	}
+	approved, err := d.TransitionAccessRequest(testOwner, testRequester, 2, "pending", "approved", nil)
+	if err != nil || approved.Status != "approved" || approved.ApprovedAt == "" || approved.PaidAt != "" {
+		t.Fatalf("approve = %+v, %v", approved, err)
+	}
+
+	payment := &models.VerifiedPayment{TxHash: "0xabc", AmountOctas: 150000000, Version: 42}
+	paid, err := d.TransitionAccessRequest(testOwner, testRequester, 2, "approved", "paid", payment)
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+	if paid.Status != "paid" || paid.PaidAt == "" || paid.ApprovedAt != approved.ApprovedAt ||
+		paid.PaymentTxHash != "0xabc" || paid.PaidAmountOctas != 150000000 || paid.PaymentVersion != 42 {
+		t.Errorf("paid %+v", paid)
+	}
+
+	// A payment pays for one request only, and the losing request is left as it was
+	d.CreateAccessRequest(models.AccessRequest{OwnerAddress: testOwner, RequesterAddress: testRequester, DatasetID: 3})
+	d.TransitionAccessRequest(testOwner, testRequester, 3, "pending", "approved", nil)
+	if _, err := d.TransitionAccessRequest(testOwner, testRequester, 3, "approved", "paid", payment); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("paying twice with one transaction = %v, want %v", err, ErrDuplicate)
+	}
+	if other, _ := d.GetAccessRequest(testOwner, testRequester, 3); other.Status != "approved" || other.PaymentTxHash != "" {
+		t.Errorf("request paid with a spent transaction was left %+v", other)
+	}
+}
+
+func TestAccessRequestDeniedCanBeAskedAgain(t *testing.T) {
+	d, _ := openTestDB(t)
+	first, _ := d.CreateAccessRequest(models.AccessRequest{OwnerAddress: testOwner, RequesterAddress: testRequester, DatasetID: 1, Message: "first"})
+	if _, err := d.TransitionAccessRequest(testOwner, testRequester, 1, "pending", "denied", nil); err != nil {
+		t.Fatalf("deny: %v", err)
+	}
+
+	reopened, err := d.CreateAccessRequest(models.AccessRequest{OwnerAddress: testOwner, RequesterAddress: testRequester, DatasetID: 1, Message: "second"})
+	if err != nil || reopened.ID != first.ID || reopened.Status != "pending" || reopened.Message != "second" {
+		t.Errorf("request after a denial = %+v, %v, want the same request pending again", reopened, err)
+	}
+}
+
+func TestAccessRequestsAreListedByOwnerAndRequester(t *testing.T) {
+	d, _ := openTestDB(t)
+	d.CreateAccessRequest(models.AccessRequest{OwnerAddress: testOwner, RequesterAddress: testRequester, DatasetID: 1})
+	d.CreateAccessRequest(models.AccessRequest{OwnerAddress: testOwner, RequesterAddress: testOther, DatasetID: 1})
+	d.CreateAccessRequest(models.AccessRequest{OwnerAddress: testOther, RequesterAddress: testRequester, DatasetID: 5})
+	// An older request lists after the newer ones
+	d.sql.Exec(`UPDATE access_requests SET created_at = 1 WHERE requester_address = ?`, testOther)
+
+	byOwner, err := d.ListAccessRequestsByOwner(testOwner)
+	if err != nil || len(byOwner) != 2 || byOwner[1].RequesterAddress != testOther {
+		t.Errorf("ListAccessRequestsByOwner = %+v, %v, want two with %s's last", byOwner, err, testOther)
+	}
+	byRequester, err := d.ListAccessRequestsByRequester(testRequester)
+	if err != nil || len(byRequester) != 2 {
+		t.Errorf("ListAccessRequestsByRequester = %+v, %v, want two", byRequester, err)
+	}
+	if none, err := d.ListAccessRequestsByOwner(testRequester); err != nil || none == nil || len(none) != 0 {
+		t.Errorf("ListAccessRequestsByOwner without requests = %#v, %v, want an empty list", none, err)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	d, _ := openTestDB(t)
+	record := models.IdempotencyRecord{Key: "k", Fingerprint: "f", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+
+	if _, reserved, err := d.ReserveIdempotencyKey(record); !reserved || err != nil {
+		t.Fatalf("first reserve = %t, %v", reserved, err)
+	}
+	existing, reserved, err := d.ReserveIdempotencyKey(record)
+	if reserved || err != nil || existing.StatusCode != 0 || existing.Fingerprint != "f" {
+		t.Fatalf("reserve of a running key = %+v, %t, %v, want the running record", existing, reserved, err)
+	}
+
+	completed := record
+	completed.StatusCode, completed.ContentType, completed.Body = 201, "application/json", []byte(`{"ok":true}`)
+	if err := d.CompleteIdempotencyKey(completed); err != nil {
+		t.Fatalf("CompleteIdempotencyKey: %v", err)
+	}
+	existing, _, _ = d.ReserveIdempotencyKey(record)
+	if existing.StatusCode != 201 || existing.ContentType != "application/json" || string(existing.Body) != `{"ok":true}` {
+		t.Errorf("completed record = %+v", existing)
+	}
+	// A finished key is no longer held, so neither completing nor releasing it again does anything
+	if err := d.CompleteIdempotencyKey(completed); !errors.Is(err, ErrNotFound) {
+		t.Errorf("completing twice = %v, want %v", err, ErrNotFound)
+	}
+	d.ReleaseIdempotencyKey(record)
+	if _, reserved, _ := d.ReserveIdempotencyKey(record); reserved {
+		t.Error("release freed a completed key")
+	}
+
+	// A released key and an expired one are free again
+	released := models.IdempotencyRecord{Key: "r", Fingerprint: "f", ExpiresAt: record.ExpiresAt}
+	d.ReserveIdempotencyKey(released)
+	if err := d.ReleaseIdempotencyKey(released); err != nil {
+		t.Fatalf("ReleaseIdempotencyKey: %v", err)
+	}
+	if _, reserved, _ := d.ReserveIdempotencyKey(released); !reserved {
+		t.Error("released key wasn't free")
+	}
+	expired := models.IdempotencyRecord{Key: "e", Fingerprint: "f", ExpiresAt: time.Now().Add(-time.Second).Unix()}
+	d.ReserveIdempotencyKey(expired)
+	expired.ExpiresAt = record.ExpiresAt
+	if _, reserved, _ := d.ReserveIdempotencyKey(expired); !reserved {
+		t.Error("expired key wasn't free")
+	}
+}
+
+func TestAuditLogFiltersAndPages(t *testing.T) {
+	d, _ := openTestDB(t)
+	one, two := uint64(1), uint64(2)
+	entries := []models.AuditEntry{
+		{Owner: testOwner, DatasetID: 1, Requester: testRequester, Endpoint: "/api/v1/data/get-csv", Rows: 10, Timestamp: 100, RequestID: "a"},
+		{Owner: testOwner, DatasetID: 2, Requester: testOther, Endpoint: "/api/v1/data/export", Rows: 20, Timestamp: 200, RequestID: "b"},
+		{Owner: testOwner, DatasetID: 1, Requester: testOther, Endpoint: "/api/v1/data/preview", Rows: 2, Timestamp: 300, RequestID: "c"},
+		{Owner: testOther, DatasetID: 1, Requester: testRequester, Endpoint: "/api/v1/data/get-csv", Rows: 1, Timestamp: 400, RequestID: "d"},
+	}
+	if err := d.AppendAuditEntries(entries); err != nil {
+		t.Fatalf("AppendAuditEntries: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		filter models.AuditFilter
+		want   string // Request IDs, newest first
+	}{
+		{"everything", models.AuditFilter{}, "cba"},
+		{"dataset", models.AuditFilter{DatasetID: &one}, "ca"},
+		{"requester", models.AuditFilter{Requester: testOther}, "cb"},
+		{"time range", models.AuditFilter{From: 150, To: 300}, "cb"},
+		{"dataset and requester", models.AuditFilter{DatasetID: &two, Requester: testRequester}, ""},
+	}
+	for _, tc := range cases {
+		page, total, err := d.ListAuditEntries(testOwner, tc.filter, 0, 10)
+		if got := requestIDs(page); err != nil || got != tc.want || total != len(tc.want) {
+			t.Errorf("%s: %q of %d, %v, want %q", tc.name, got, total, err, tc.want)
+		}
+	}
+
+	page, total, _ := d.ListAuditEntries(testOwner, models.AuditFilter{}, 1, 1)
+	if requestIDs(page) != "b" || total != 3 || page[0] != entries[1] {
+		t.Errorf("second page of one = %+v of %d, want entry b of 3", page, total)
+	}
+
+	var streamed []models.AuditEntry
+	if err := d.EachAuditEntry(testOwner, models.AuditFilter{}, func(entry models.AuditEntry) { streamed = append(streamed, entry) }); err != nil {
+		t.Fatalf("EachAuditEntry: %v", err)
+	}
+	if requestIDs(streamed) != "abc" {
+		t.Errorf("EachAuditEntry = %q, want oldest first abc", requestIDs(streamed))
+	}
+}
+
+func requestIDs(entries []models.AuditEntry) string {
+	ids := ""
+	for _, entry := range entries {
+		ids += entry.RequestID
+	}
+	return ids
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/datax/backend/models"
+)
+
+// ReserveIdempotencyKey claims record.Key for a request that is starting. It returns
+// record and true when the key was free (or had expired), and the record holding the key
+// and false otherwise. Expired keys are purged on the way
+func (d *DB) ReserveIdempotencyKey(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	if _, err := d.sql.Exec(d.rebind(`DELETE FROM idempotency_keys WHERE expires_at <= $1`), time.Now().Unix()); err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+
+	result, err := d.sql.Exec(d.rebind(`INSERT INTO idempotency_keys (key, fingerprint, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO NOTHING`), record.Key, record.Fingerprint, record.ExpiresAt)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 1 {
+		return record, true, nil
+	}
+
+	var existing models.IdempotencyRecord
+	var body string
+	err = d.sql.QueryRow(d.rebind(`SELECT key, fingerprint, status_code, content_type, body, expires_at FROM idempotency_keys WHERE key = $1`), record.Key).
+		Scan(&existing.Key, &existing.Fingerprint, &existing.StatusCode, &existing.ContentType, &body, &existing.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between the insert and this read
+		return models.IdempotencyRecord{}, false, ErrConflict
+	}
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+	existing.Body = []byte(body)
+	return existing, false, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request holding record.Key and extends
+// the key to record.ExpiresAt. Returns ErrNotFound when the request no longer holds it
+func (d *DB) CompleteIdempotencyKey(record models.IdempotencyRecord) error {
+	result, err := d.sql.Exec(d.rebind(`UPDATE idempotency_keys SET status_code = $1, content_type = $2, body = $3, expires_at = $4
+		WHERE key = $5 AND fingerprint = $6 AND status_code = 0`),
+		record.StatusCode, record.ContentType, string(record.Body), record.ExpiresAt, record.Key, record.Fingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey frees a key whose request failed without a response worth replaying
+func (d *DB) ReleaseIdempotencyKey(record models.IdempotencyRecord) error {
+	_, err := d.sql.Exec(d.rebind(`DELETE FROM idempotency_keys WHERE key = $1 AND fingerprint = $2 AND status_code = 0`), record.Key, record.Fingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
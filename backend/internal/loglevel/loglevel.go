@@ -0,0 +1,81 @@
+// Package loglevel applies LOG_LEVEL to the backend's output. Services and handlers print
+// "DEBUG: ", "WARNING: " and "ERROR: " lines to stdout with fmt.Printf; stdout is routed
+// through a filter that drops the lines below the current level, asked for on every line so
+// a reloaded level applies at once. Lines without a level prefix count as info
+package loglevel
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// severity orders the levels; unknown names count as debug so nothing is lost
+func severity(level string) int {
+	switch level {
+	case "info":
+		return 1
+	case "warning":
+		return 2
+	case "error":
+		return 3
+	}
+	return 0
+}
+
+// lineSeverity reads the level of a line from its prefix
+func lineSeverity(line []byte) int {
+	switch {
+	case bytes.HasPrefix(line, []byte("DEBUG:")):
+		return 0
+	case bytes.HasPrefix(line, []byte("WARNING:")):
+		return 2
+	case bytes.HasPrefix(line, []byte("ERROR:")):
+		return 3
+	}
+	return 1
+}
+
+// FilterStdout replaces os.Stdout with a pipe whose lines are copied to the real stdout when
+// they are at or above level(). The returned flush restores os.Stdout and waits until every
+// line written so far is copied, and should run before the process exits
+func FilterStdout(level func() string) (flush func(), err error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		copyLines(stdout, reader, level)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			os.Stdout = stdout
+			writer.Close()
+			<-done
+			reader.Close()
+		})
+	}, nil
+}
+
+// copyLines copies the lines of in at or above level() to out until in is closed
+func copyLines(out io.Writer, in io.Reader, level func() string) {
+	lines := bufio.NewReader(in)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if len(line) > 0 && lineSeverity(line) >= severity(level()) {
+			out.Write(line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
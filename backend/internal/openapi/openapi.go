@@ -0,0 +1,430 @@
+// Package openapi builds the OpenAPI 3 document served at /api/v1/openapi.json. Paths come
+// from the routes registered on the router and each route's Operation; request and
+// response schemas are generated from the Go structs' json and binding tags, so the
+// document can't drift from what the handlers bind
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Operation documents one route
+type Operation struct {
+	Summary     string
+	Description string
+	Tag         string
+	Request     interface{} // JSON body, as a value of the struct the handler binds
+	Form        []Param     // multipart/form-data fields, in the order they must be sent
+	Query       []Param
+	Headers     []Param
+	Response    interface{} // Value of the type returned in Response.data; nil leaves it unspecified
+	RawResponse []string    // Content types of a success body sent without the envelope (file downloads, pages)
+	Signer      string      // Body field holding the address that must sign the wallet signature
+	PrivateKey  bool        // The body carries the account's private key (deprecated endpoints)
+	Public      bool        // Served without an API key
+	Idempotent  bool        // Accepts an Idempotency-Key header (middleware.Idempotency)
+	Errors      []int       // Statuses returned besides 200, 400 and 500
+}
+
+// Param is a query parameter, header or form field
+type Param struct {
+	Name        string
+	Type        string // string, integer, boolean, number or binary (a file)
+	Required    bool
+	Description string
+}
+
+// Info describes the API as a whole
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+	Envelope    interface{} // Value of the response envelope every JSON answer is wrapped in
+	ErrorCodes  []string    // Values of the envelope's machine-readable code
+	APIKeys     bool        // Operations not marked Public need a bearer API key
+}
+
+// Key is the Operation map key of a route
+func Key(method string, path string) string {
+	return method + " " + path
+}
+
+// Build returns the OpenAPI document for routes. Every route must have an Operation and
+// every Operation a route; the error lists the ones that don't match
+func Build(routes gin.RoutesInfo, operations map[string]Operation, info Info) ([]byte, error) {
+	b := &builder{schemas: make(map[string]interface{})}
+	envelopeRef := b.schema(reflect.TypeOf(info.Envelope))
+	if ref, ok := envelopeRef["$ref"].(string); ok && len(info.ErrorCodes) > 0 {
+		b.schemas["ErrorCode"] = map[string]interface{}{"type": "string", "enum": info.ErrorCodes}
+		if envelope, ok := b.schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{}); ok {
+			envelope["properties"].(map[string]interface{})["code"] = map[string]interface{}{"$ref": "#/components/schemas/ErrorCode"}
+		}
+	}
+
+	paths := make(map[string]map[string]interface{})
+	seen := make(map[string]bool, len(routes))
+	var undocumented []string
+	for _, route := range routes {
+		key := Key(route.Method, route.Path)
+		seen[key] = true
+		op, ok := operations[key]
+		if !ok {
+			undocumented = append(undocumented, key)
+			continue
+		}
+		path, params := openAPIPath(route.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = b.operation(route, op, params, envelopeRef, info)
+	}
+
+	var stale []string
+	for key := range operations {
+		if !seen[key] {
+			stale = append(stale, key)
+		}
+	}
+	if len(undocumented) > 0 || len(stale) > 0 {
+		sort.Strings(undocumented)
+		sort.Strings(stale)
+		return nil, fmt.Errorf("routes without an OpenAPI operation: %v; operations without a route: %v", undocumented, stale)
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "One of the keys in API_KEYS"},
+			},
+		},
+	}
+	if info.APIKeys {
+		doc["security"] = []interface{}{map[string]interface{}{"apiKey": []string{}}}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+type builder struct {
+	schemas map[string]interface{}
+}
+
+func (b *builder) operation(route gin.RouteInfo, op Operation, params []interface{}, envelopeRef map[string]interface{}, info Info) map[string]interface{} {
+	description := op.Description
+	if op.Signer != "" {
+		description = strings.TrimSpace(description + fmt.Sprintf("\n\nRequires a wallet signature by the `%s` address: request a nonce from `/api/v1/auth/challenge` and send the signed message with the request.", op.Signer))
+	}
+	if op.PrivateKey {
+		description = strings.TrimSpace(description + "\n\nThe body carries the account's private key; prefer signing transactions in the wallet.")
+	}
+
+	out := map[string]interface{}{
+		"operationId": operationID(route.Method, route.Path),
+		"summary":     op.Summary,
+	}
+	if description != "" {
+		out["description"] = description
+	}
+	if op.Tag != "" {
+		out["tags"] = []string{op.Tag}
+	}
+	if op.Signer != "" {
+		out["x-wallet-signature"] = map[string]interface{}{"signer": op.Signer}
+	}
+	if op.Public && info.APIKeys {
+		out["security"] = []interface{}{}
+	}
+
+	for _, group := range []struct {
+		in     string
+		params []Param
+	}{{"query", op.Query}, {"header", op.Headers}} {
+		if group.in == "header" && op.Idempotent {
+			group.params = append(group.params, Param{Name: "Idempotency-Key", Description: "Retries with the same key and body replay the first response instead of running again"})
+		}
+		for _, p := range group.params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          group.in,
+				"required":    p.Required,
+				"description": p.Description,
+				"schema":      paramSchema(p.Type),
+			})
+		}
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	switch {
+	case op.Request != nil:
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(op.Request))},
+			},
+		}
+	case len(op.Form) > 0:
+		properties := make(map[string]interface{}, len(op.Form))
+		order := make([]string, 0, len(op.Form))
+		var required []string
+		for _, field := range op.Form {
+			schema := paramSchema(field.Type)
+			if field.Description != "" {
+				schema["description"] = field.Description
+			}
+			properties[field.Name] = schema
+			order = append(order, field.Name)
+			if field.Required {
+				required = append(required, field.Name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties, "x-field-order": order}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"multipart/form-data": map[string]interface{}{"schema": schema},
+			},
+		}
+	}
+
+	success := envelopeRef
+	if op.Response != nil {
+		success = map[string]interface{}{
+			"allOf": []interface{}{
+				envelopeRef,
+				map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"data": b.schema(reflect.TypeOf(op.Response))},
+				},
+			},
+		}
+	}
+	content := map[string]interface{}{"application/json": map[string]interface{}{"schema": success}}
+	if len(op.RawResponse) > 0 {
+		content = make(map[string]interface{}, len(op.RawResponse))
+		for _, contentType := range op.RawResponse {
+			raw := map[string]interface{}{"type": "string", "format": "binary"}
+			if strings.Contains(contentType, "json") {
+				raw = map[string]interface{}{"type": "object"}
+			}
+			content[contentType] = map[string]interface{}{"schema": raw}
+		}
+	}
+	responses := map[string]interface{}{
+		"200": map[string]interface{}{"description": "OK", "content": content},
+	}
+
+	failure := map[string]interface{}{"application/json": map[string]interface{}{"schema": envelopeRef}}
+	statuses := append([]int{http.StatusBadRequest, http.StatusTooManyRequests, http.StatusInternalServerError}, op.Errors...)
+	if op.Signer != "" || (info.APIKeys && !op.Public) {
+		statuses = append(statuses, http.StatusUnauthorized)
+	}
+	if op.Idempotent {
+		statuses = append(statuses, http.StatusConflict, http.StatusUnprocessableEntity)
+	}
+	for _, status := range statuses {
+		if status == http.StatusNotModified {
+			responses["304"] = map[string]interface{}{"description": http.StatusText(status)}
+			continue
+		}
+		responses[fmt.Sprint(status)] = map[string]interface{}{"description": http.StatusText(status), "content": failure}
+	}
+	out["responses"] = responses
+	return out
+}
+
+// schema returns the schema of t, registering named structs as components
+func (b *builder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := t.Name()
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = map[string]interface{}{} // Placeholder so recursive types terminate
+			b.schemas[name] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	}
+	return map[string]interface{}{} // interface{}: any value
+}
+
+// structSchema describes a struct the way encoding/json and gin's binding see it: json tag
+// names, embedded structs flattened, binding:"required" fields required
+func (b *builder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if field.Anonymous && name == "" {
+				embedded := field.Type
+				for embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					addFields(embedded)
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			schema := b.schema(field.Type)
+			if applyBinding(schema, field.Type, field.Tag.Get("binding")) {
+				required = append(required, name)
+			}
+			properties[name] = schema
+		}
+	}
+	addFields(t)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// applyBinding adds the validator rules of a binding tag the schema can express and
+// reports whether the field is required. Rules after "dive" apply to the items
+func applyBinding(schema map[string]interface{}, t reflect.Type, tag string) bool {
+	if tag == "" {
+		return false
+	}
+	required, dived := false, false
+	target := schema
+	for _, rule := range strings.Split(tag, ",") {
+		name, value, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = required || !dived
+		case "dive":
+			items, ok := schema["items"].(map[string]interface{})
+			if !ok {
+				return required
+			}
+			target, dived = items, true
+		case "oneof":
+			target["enum"] = strings.Fields(value)
+		case "url":
+			target["format"] = "uri"
+		// Custom rules registered by handlers.RegisterValidators
+		case "aptos_address":
+			target["pattern"] = "^(0x)?[0-9a-fA-F]{64}$"
+		case "hexhash":
+			target["pattern"] = "^(0x)?[0-9a-fA-F]{1,128}$"
+		case "min", "max":
+			var bound float64
+			if _, err := fmt.Sscan(value, &bound); err != nil {
+				continue
+			}
+			keyword := map[string]string{"string": "Length", "array": "Items"}[fmt.Sprint(target["type"])]
+			if keyword == "" {
+				keyword = map[string]string{"min": "minimum", "max": "maximum"}[name]
+			} else {
+				keyword = name + keyword
+			}
+			target[keyword] = bound
+		}
+	}
+	return required
+}
+
+func paramSchema(paramType string) map[string]interface{} {
+	if paramType == "binary" {
+		return map[string]interface{}{"type": "string", "format": "binary"}
+	}
+	if paramType == "" {
+		paramType = "string"
+	}
+	return map[string]interface{}{"type": paramType}
+}
+
+// openAPIPath converts gin's :name and *name segments to {name} and returns their parameters
+func openAPIPath(path string) (string, []interface{}) {
+	segments := strings.Split(path, "/")
+	params := make([]interface{}, 0)
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derives a stable ID from the method and path, e.g. post_data_get_csv
+func operationID(method string, path string) string {
+	path = strings.TrimPrefix(path, "/api/v1")
+	id := strings.ToLower(method) + strings.NewReplacer("/", "_", "-", "_", ":", "", "*", "").Replace(path)
+	return strings.TrimSuffix(id, "_")
+}
@@ -0,0 +1,361 @@
+// Package store keeps a local SQLite index of DataX on-chain events, so marketplace,
+// vault and access reads can be answered without the fullnode or the public indexer
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Event kinds recorded in the index
+const (
+	EventDataSubmitted       = "DataSubmitted"
+	EventDatasetDeleted      = "DatasetDeleted"
+	EventDatasetReactivated  = "DatasetReactivated"
+	EventAccessGranted       = "AccessGranted"
+	EventAccessRevoked       = "AccessRevoked"
+	EventVaultDatasetAdded   = "VaultDatasetAdded"   // UserVault::add_dataset called directly
+	EventVaultDatasetRemoved = "VaultDatasetRemoved" // UserVault::remove_dataset called directly
+)
+
+// Event is one state change extracted from a committed transaction. Addresses must be
+// normalized by the caller so lookups match
+type Event struct {
+	Kind      string `json:"kind"`
+	Version   uint64 `json:"version"` // Transaction version
+	Index     int    `json:"index"`   // Position among the transaction's indexed events
+	Owner     string `json:"owner"`
+	DatasetID uint64 `json:"dataset_id"`
+	DataHash  string `json:"data_hash,omitempty"`  // DataSubmitted
+	Metadata  string `json:"metadata,omitempty"`   // DataSubmitted, in its on-chain hex form
+	CreatedAt uint64 `json:"created_at,omitempty"` // DataSubmitted, seconds
+	Requester string `json:"requester,omitempty"`  // AccessGranted, AccessRevoked
+	ExpiresAt uint64 `json:"expires_at,omitempty"` // AccessGranted, seconds
+}
+
+// Checkpoint is how far the index has read the chain
+type Checkpoint struct {
+	Version       uint64    // Last transaction version indexed
+	LedgerVersion uint64    // Ledger tip seen when Version was stored
+	UpdatedAt     time.Time // When the indexer last reported progress
+}
+
+// Dataset is a dataset as the index last saw it
+type Dataset struct {
+	Owner     string
+	ID        uint64
+	DataHash  string
+	Metadata  string
+	CreatedAt uint64
+	IsActive  bool
+}
+
+// Grant is an access grant as the index last saw it
+type Grant struct {
+	Owner     string
+	DatasetID uint64
+	Requester string
+	ExpiresAt uint64 // Seconds; grants that never expire hold math.MaxInt64, the largest deadline SQLite stores
+}
+
+// Store is a SQLite event index. It is safe for concurrent use; writes are serialized
+// by SQLite and reads run alongside them in WAL mode
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS checkpoint (
+	id             INTEGER PRIMARY KEY CHECK (id = 1),
+	version        INTEGER NOT NULL,
+	ledger_version INTEGER NOT NULL,
+	updated_at     INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS events (
+	version    INTEGER NOT NULL,
+	idx        INTEGER NOT NULL,
+	kind       TEXT    NOT NULL,
+	owner      TEXT    NOT NULL,
+	dataset_id INTEGER NOT NULL,
+	payload    TEXT    NOT NULL,
+	PRIMARY KEY (version, idx)
+);
+CREATE INDEX IF NOT EXISTS idx_events_owner ON events(owner, dataset_id);
+CREATE TABLE IF NOT EXISTS datasets (
+	owner      TEXT    NOT NULL,
+	dataset_id INTEGER NOT NULL,
+	data_hash  TEXT    NOT NULL,
+	metadata   TEXT    NOT NULL,
+	created_at INTEGER NOT NULL,
+	is_active  INTEGER NOT NULL,
+	PRIMARY KEY (owner, dataset_id)
+);
+CREATE TABLE IF NOT EXISTS vault_entries (
+	owner      TEXT    NOT NULL,
+	dataset_id INTEGER NOT NULL,
+	PRIMARY KEY (owner, dataset_id)
+);
+CREATE TABLE IF NOT EXISTS access_grants (
+	owner      TEXT    NOT NULL,
+	dataset_id INTEGER NOT NULL,
+	requester  TEXT    NOT NULL,
+	expires_at INTEGER NOT NULL,
+	PRIMARY KEY (owner, dataset_id, requester)
+);
+CREATE INDEX IF NOT EXISTS idx_access_grants_requester ON access_grants(requester);
+`
+
+// Open opens (creating if needed) the index database at path
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create index directory: %w", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index database: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create index schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// LoadCheckpoint returns the stored checkpoint, or nil before anything was indexed
+func (s *Store) LoadCheckpoint() (*Checkpoint, error) {
+	var version, ledgerVersion, updatedAt int64
+	err := s.db.QueryRow(`SELECT version, ledger_version, updated_at FROM checkpoint WHERE id = 1`).
+		Scan(&version, &ledgerVersion, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index checkpoint: %w", err)
+	}
+	return &Checkpoint{
+		Version:       uint64(version),
+		LedgerVersion: uint64(ledgerVersion),
+		UpdatedAt:     time.Unix(updatedAt, 0).UTC(),
+	}, nil
+}
+
+// Apply records events in order and moves the checkpoint to version in one transaction,
+// so a crash never leaves events indexed past the checkpoint or the other way around
+func (s *Store) Apply(events []Event, version uint64, ledgerVersion uint64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin index transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, event := range events {
+		if err := applyEvent(tx, event); err != nil {
+			return fmt.Errorf("failed to index %s at version %d: %w", event.Kind, event.Version, err)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO checkpoint (id, version, ledger_version, updated_at) VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET version = excluded.version, ledger_version = excluded.ledger_version, updated_at = excluded.updated_at`,
+		int64(version), int64(ledgerVersion), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save index checkpoint: %w", err)
+	}
+	return tx.Commit()
+}
+
+// applyEvent logs an event and updates the state tables it affects. Every update is
+// idempotent, so replaying an event is harmless
+func applyEvent(tx *sql.Tx, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT OR IGNORE INTO events (version, idx, kind, owner, dataset_id, payload) VALUES (?, ?, ?, ?, ?, ?)`,
+		int64(event.Version), event.Index, event.Kind, event.Owner, int64(event.DatasetID), string(payload))
+	if err != nil {
+		return err
+	}
+
+	switch event.Kind {
+	case EventDataSubmitted:
+		_, err = tx.Exec(`INSERT INTO datasets (owner, dataset_id, data_hash, metadata, created_at, is_active) VALUES (?, ?, ?, ?, ?, 1)
+			ON CONFLICT(owner, dataset_id) DO UPDATE SET data_hash = excluded.data_hash, metadata = excluded.metadata, created_at = excluded.created_at`,
+			event.Owner, int64(event.DatasetID), event.DataHash, event.Metadata, int64(event.CreatedAt))
+		if err == nil {
+			err = addVaultEntry(tx, event.Owner, event.DatasetID)
+		}
+	case EventDatasetDeleted:
+		_, err = tx.Exec(`UPDATE datasets SET is_active = 0 WHERE owner = ? AND dataset_id = ?`, event.Owner, int64(event.DatasetID))
+		if err == nil {
+			err = removeVaultEntry(tx, event.Owner, event.DatasetID)
+		}
+	case EventDatasetReactivated:
+		_, err = tx.Exec(`UPDATE datasets SET is_active = 1 WHERE owner = ? AND dataset_id = ?`, event.Owner, int64(event.DatasetID))
+		if err == nil {
+			err = addVaultEntry(tx, event.Owner, event.DatasetID)
+		}
+	case EventVaultDatasetAdded:
+		err = addVaultEntry(tx, event.Owner, event.DatasetID)
+	case EventVaultDatasetRemoved:
+		err = removeVaultEntry(tx, event.Owner, event.DatasetID)
+	case EventAccessGranted:
+		_, err = tx.Exec(`INSERT INTO access_grants (owner, dataset_id, requester, expires_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(owner, dataset_id, requester) DO UPDATE SET expires_at = excluded.expires_at`,
+			event.Owner, int64(event.DatasetID), event.Requester, clampInt64(event.ExpiresAt))
+	case EventAccessRevoked:
+		_, err = tx.Exec(`DELETE FROM access_grants WHERE owner = ? AND dataset_id = ? AND requester = ?`,
+			event.Owner, int64(event.DatasetID), event.Requester)
+	default:
+		err = fmt.Errorf("unknown event kind %q", event.Kind)
+	}
+	return err
+}
+
+// addVaultEntry appends a dataset to the owner's vault unless it's already there, keeping
+// the on-chain vector's insertion order in the rowid
+func addVaultEntry(tx *sql.Tx, owner string, datasetID uint64) error {
+	_, err := tx.Exec(`INSERT OR IGNORE INTO vault_entries (owner, dataset_id) VALUES (?, ?)`, owner, int64(datasetID))
+	return err
+}
+
+func removeVaultEntry(tx *sql.Tx, owner string, datasetID uint64) error {
+	_, err := tx.Exec(`DELETE FROM vault_entries WHERE owner = ? AND dataset_id = ?`, owner, int64(datasetID))
+	return err
+}
+
+// Datasets returns the indexed datasets of an owner, or of everyone when owner is empty,
+// ordered by owner and dataset ID
+func (s *Store) Datasets(owner string) ([]Dataset, error) {
+	query := `SELECT owner, dataset_id, data_hash, metadata, created_at, is_active FROM datasets`
+	var args []interface{}
+	if owner != "" {
+		query += ` WHERE owner = ?`
+		args = append(args, owner)
+	}
+	query += ` ORDER BY owner, dataset_id`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexed datasets: %w", err)
+	}
+	defer rows.Close()
+
+	datasets := make([]Dataset, 0)
+	for rows.Next() {
+		var d Dataset
+		var id, createdAt int64
+		if err := rows.Scan(&d.Owner, &id, &d.DataHash, &d.Metadata, &createdAt, &d.IsActive); err != nil {
+			return nil, fmt.Errorf("failed to read indexed dataset: %w", err)
+		}
+		d.ID = uint64(id)
+		d.CreatedAt = uint64(createdAt)
+		datasets = append(datasets, d)
+	}
+	return datasets, rows.Err()
+}
+
+// VaultDatasetIDs returns the dataset IDs in an owner's vault, in on-chain order
+func (s *Store) VaultDatasetIDs(owner string) ([]uint64, error) {
+	rows, err := s.db.Query(`SELECT dataset_id FROM vault_entries WHERE owner = ? ORDER BY rowid`, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexed vault: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]uint64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to read indexed vault entry: %w", err)
+		}
+		ids = append(ids, uint64(id))
+	}
+	return ids, rows.Err()
+}
+
+// Grant returns requester's grant on the dataset, expired or not, or nil when there is
+// none. Expiry is left to the caller, which judges it against the ledger clock
+func (s *Store) Grant(owner string, datasetID uint64, requester string) (*Grant, error) {
+	var expiresAt int64
+	err := s.db.QueryRow(`SELECT expires_at FROM access_grants WHERE owner = ? AND dataset_id = ? AND requester = ?`,
+		owner, int64(datasetID), requester).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexed access grant: %w", err)
+	}
+	return &Grant{Owner: owner, DatasetID: datasetID, Requester: requester, ExpiresAt: uint64(expiresAt)}, nil
+}
+
+// GrantsForRequester returns the grants naming requester, expired ones included, ordered
+// by owner and dataset ID
+func (s *Store) GrantsForRequester(requester string) ([]Grant, error) {
+	rows, err := s.db.Query(`SELECT owner, dataset_id, expires_at FROM access_grants WHERE requester = ? ORDER BY owner, dataset_id`, requester)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexed access grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := make([]Grant, 0)
+	for rows.Next() {
+		g := Grant{Requester: requester}
+		var id, expiresAt int64
+		if err := rows.Scan(&g.Owner, &id, &expiresAt); err != nil {
+			return nil, fmt.Errorf("failed to read indexed access grant: %w", err)
+		}
+		g.DatasetID = uint64(id)
+		g.ExpiresAt = uint64(expiresAt)
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+// EventsAfter returns up to limit events of a kind recorded after position (version, index),
+// in chain order
+func (s *Store) EventsAfter(kind string, version uint64, index int, limit int) ([]Event, error) {
+	rows, err := s.db.Query(`SELECT payload FROM events WHERE kind = ? AND (version > ? OR (version = ? AND idx > ?))
+		ORDER BY version, idx LIMIT ?`, kind, int64(version), int64(version), index, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexed events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]Event, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, fmt.Errorf("failed to read indexed event: %w", err)
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			return nil, fmt.Errorf("failed to decode indexed event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// clampInt64 fits a u64 into SQLite's signed integers. Only expiries past year 292 billion
+// are affected, and those still never expire
+func clampInt64(v uint64) int64 {
+	if v > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(v)
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	testOwner     = "0x000000000000000000000000000000000000000000000000000000000000a001"
+	testRequester = "0x000000000000000000000000000000000000000000000000000000000000b002"
+	testOther     = "0x000000000000000000000000000000000000000000000000000000000000c003"
+)
+
+// openTestStore opens an index in a temporary directory
+func openTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "index", "events.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+// submitted is a DataSubmitted event for the owner's dataset id at version
+func submitted(version uint64, owner string, id uint64, dataHash string) Event {
+	return Event{Kind: EventDataSubmitted, Version: version, Owner: owner, DatasetID: id, DataHash: dataHash, Metadata: "0x7b7d", CreatedAt: 1000 + version}
+}
+
+func TestApplyMovesTheCheckpoint(t *testing.T) {
+	s, path := openTestStore(t)
+	if checkpoint, err := s.LoadCheckpoint(); checkpoint != nil || err != nil {
+		t.Fatalf("LoadCheckpoint before indexing = %+v, %v, want none", checkpoint, err)
+	}
+
+	if err := s.Apply([]Event{submitted(10, testOwner, 0, "aa")}, 12, 50); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	checkpoint, err := s.LoadCheckpoint()
+	if err != nil || checkpoint == nil || checkpoint.Version != 12 || checkpoint.LedgerVersion != 50 || checkpoint.UpdatedAt.IsZero() {
+		t.Fatalf("LoadCheckpoint = %+v, %v, want version 12 at ledger 50", checkpoint, err)
+	}
+
+	// An event that can't be indexed rolls back the whole batch with its checkpoint
+	err = s.Apply([]Event{submitted(13, testOwner, 1, "bb"), {Kind: "Unknown", Version: 14, Owner: testOwner}}, 14, 60)
+	if err == nil {
+		t.Fatal("Apply of an unknown event kind succeeded")
+	}
+	if checkpoint, _ := s.LoadCheckpoint(); checkpoint.Version != 12 {
+		t.Errorf("checkpoint after a failed batch = %d, want 12", checkpoint.Version)
+	}
+	if datasets, _ := s.Datasets(testOwner); len(datasets) != 1 {
+		t.Errorf("%d datasets after a failed batch, want 1", len(datasets))
+	}
+
+	// The index survives reopening
+	s.Close()
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close()
+	if checkpoint, _ := reopened.LoadCheckpoint(); checkpoint == nil || checkpoint.Version != 12 {
+		t.Errorf("checkpoint after reopening = %+v, want version 12", checkpoint)
+	}
+}
+
+func TestApplyTracksDatasetsAndVaults(t *testing.T) {
+	s, _ := openTestStore(t)
+	events := []Event{
+		submitted(1, testOwner, 0, "aa"),
+		submitted(2, testOwner, 1, "bb"),
+		submitted(3, testOther, 0, "cc"),
+		{Kind: EventDatasetDeleted, Version: 4, Owner: testOwner, DatasetID: 0},
+		{Kind: EventVaultDatasetAdded, Version: 5, Owner: testOther, DatasetID: 7},
+		{Kind: EventVaultDatasetRemoved, Version: 6, Owner: testOther, DatasetID: 0},
+	}
+	if err := s.Apply(events, 6, 6); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	datasets, err := s.Datasets(testOwner)
+	want := []Dataset{
+		{Owner: testOwner, ID: 0, DataHash: "aa", Metadata: "0x7b7d", CreatedAt: 1001, IsActive: false},
+		{Owner: testOwner, ID: 1, DataHash: "bb", Metadata: "0x7b7d", CreatedAt: 1002, IsActive: true},
+	}
+	if err != nil || !reflect.DeepEqual(datasets, want) {
+		t.Errorf("Datasets(owner) = %+v, %v, want %+v", datasets, err, want)
+	}
+	if all, _ := s.Datasets(""); len(all) != 3 {
+		t.Errorf("Datasets(\"\") = %d datasets, want 3", len(all))
+	}
+	if vault, _ := s.VaultDatasetIDs(testOwner); !reflect.DeepEqual(vault, []uint64{1}) {
+		t.Errorf("owner's vault = %v, want [1]", vault)
+	}
+	if vault, _ := s.VaultDatasetIDs(testOther); !reflect.DeepEqual(vault, []uint64{7}) {
+		t.Errorf("other's vault = %v, want [7]", vault)
+	}
+
+	// Reactivating puts the dataset back at the end of the vault, as the vector push does
+	if err := s.Apply([]Event{{Kind: EventDatasetReactivated, Version: 7, Owner: testOwner, DatasetID: 0}}, 7, 7); err != nil {
+		t.Fatalf("Apply reactivation: %v", err)
+	}
+	if vault, _ := s.VaultDatasetIDs(testOwner); !reflect.DeepEqual(vault, []uint64{1, 0}) {
+		t.Errorf("owner's vault after reactivation = %v, want [1 0]", vault)
+	}
+	if datasets, _ := s.Datasets(testOwner); !datasets[0].IsActive {
+		t.Error("reactivated dataset is still inactive")
+	}
+
+	// Replaying events already indexed changes nothing
+	if err := s.Apply(events[:3], 7, 7); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if vault, _ := s.VaultDatasetIDs(testOwner); !reflect.DeepEqual(vault, []uint64{1, 0}) {
+		t.Errorf("owner's vault after a replay = %v, want [1 0]", vault)
+	}
+}
+
+func TestApplyTracksGrants(t *testing.T) {
+	s, _ := openTestStore(t)
+	events := []Event{
+		{Kind: EventAccessGranted, Version: 1, Owner: testOwner, DatasetID: 0, Requester: testRequester, ExpiresAt: 500},
+		{Kind: EventAccessGranted, Version: 2, Owner: testOther, DatasetID: 3, Requester: testRequester, ExpiresAt: math.MaxUint64},
+		{Kind: EventAccessGranted, Version: 3, Owner: testOwner, DatasetID: 1, Requester: testOther, ExpiresAt: 900},
+		// A grant made again moves its expiry
+		{Kind: EventAccessGranted, Version: 4, Owner: testOwner, DatasetID: 0, Requester: testRequester, ExpiresAt: 800},
+	}
+	if err := s.Apply(events, 4, 4); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	grant, err := s.Grant(testOwner, 0, testRequester)
+	if err != nil || grant == nil || grant.ExpiresAt != 800 {
+		t.Errorf("Grant = %+v, %v, want expiring at 800", grant, err)
+	}
+	grants, err := s.GrantsForRequester(testRequester)
+	want := []Grant{
+		{Owner: testOwner, DatasetID: 0, Requester: testRequester, ExpiresAt: 800},
+		{Owner: testOther, DatasetID: 3, Requester: testRequester, ExpiresAt: math.MaxInt64}, // Clamped to fit SQLite
+	}
+	if err != nil || !reflect.DeepEqual(grants, want) {
+		t.Errorf("GrantsForRequester = %+v, %v, want %+v", grants, err, want)
+	}
+
+	if err := s.Apply([]Event{{Kind: EventAccessRevoked, Version: 5, Owner: testOwner, DatasetID: 0, Requester: testRequester}}, 5, 5); err != nil {
+		t.Fatalf("Apply revocation: %v", err)
+	}
+	if grant, err := s.Grant(testOwner, 0, testRequester); grant != nil || err != nil {
+		t.Errorf("Grant after revocation = %+v, %v, want none", grant, err)
+	}
+	if grants, _ := s.GrantsForRequester(testRequester); len(grants) != 1 {
+		t.Errorf("%d grants after revocation, want 1", len(grants))
+	}
+}
+
+func TestEventsAfterPagesInChainOrder(t *testing.T) {
+	s, _ := openTestStore(t)
+	events := []Event{
+		submitted(1, testOwner, 0, "aa"),
+		{Kind: EventAccessGranted, Version: 2, Owner: testOwner, DatasetID: 0, Requester: testRequester, ExpiresAt: 10},
+		{Kind: EventDataSubmitted, Version: 2, Index: 1, Owner: testOwner, DatasetID: 1, DataHash: "bb", CreatedAt: 2},
+		submitted(3, testOther, 0, "cc"),
+	}
+	if err := s.Apply(events, 3, 3); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	page, err := s.EventsAfter(EventDataSubmitted, 0, 0, 2)
+	if err != nil || len(page) != 2 || page[0] != events[0] || page[1] != events[2] {
+		t.Fatalf("first page = %+v, %v, want versions 1 and 2:1", page, err)
+	}
+	page, _ = s.EventsAfter(EventDataSubmitted, page[1].Version, page[1].Index, 2)
+	if len(page) != 1 || page[0] != events[3] {
+		t.Errorf("second page = %+v, want version 3 only", page)
+	}
+	if page, _ := s.EventsAfter(EventAccessRevoked, 0, 0, 10); page == nil || len(page) != 0 {
+		t.Errorf("events of a kind never seen = %#v, want an empty list", page)
+	}
+}
@@ -1,11 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/datax/backend/config"
 	"github.com/datax/backend/handlers"
+	"github.com/datax/backend/internal/db"
+	"github.com/datax/backend/internal/loglevel"
+	"github.com/datax/backend/internal/openapi"
+	"github.com/datax/backend/internal/store"
+	"github.com/datax/backend/middleware"
+	"github.com/datax/backend/models"
 	"github.com/datax/backend/services"
 	"github.com/gin-gonic/gin"
 )
@@ -16,85 +30,434 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Initialize Aptos service (returns AptosServiceImpl which implements AptosService interface)
-	aptosService, err := services.NewAptosService()
+	// Drop stdout lines below LOG_LEVEL; the level is read per line so a reload applies it
+	flushOutput, err := loglevel.FilterStdout(func() string { return config.Tunable().LogLevel })
 	if err != nil {
-		log.Fatalf("Failed to initialize Aptos service: %v", err)
+		log.Fatalf("Failed to filter output by LOG_LEVEL: %v", err)
 	}
+	defer flushOutput()
 
-	// Initialize Supabase storage service
-	storageService := services.NewSupabaseService()
+	// ctx is cancelled on SIGINT/SIGTERM; background work should derive from it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP re-reads the runtime-tunable settings, as POST /api/v1/admin/config/reload does
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				if _, _, err := config.Reload(); err != nil {
+					log.Printf("ERROR: Configuration reload on SIGHUP failed: %v", err)
+				}
+			}
+		}
+	}()
+
+	// On a local node, fund a deployer and publish the Move package before anything reads the
+	// module addresses; on any other chain DEVNET_BOOTSTRAP does nothing
+	if err := services.BootstrapDevnet(ctx); err != nil {
+		log.Fatalf("Devnet bootstrap failed: %v", err)
+	}
+
+	// Initialize Aptos service, or the in-memory mock chain for frontend development
+	var aptosService services.AptosService
+	if config.AppConfig.MockChain {
+		if config.AppConfig.IsProduction() {
+			log.Fatalf("MOCK_CHAIN cannot be enabled in production")
+		}
+		mockService, err := services.NewMockAptosService(config.AppConfig.MockChainStateFile)
+		if err != nil {
+			log.Fatalf("Failed to initialize mock chain: %v", err)
+		}
+		log.Printf("WARNING: MOCK_CHAIN is enabled, transactions are simulated and nothing reaches Aptos")
+		aptosService = mockService
+	} else {
+		chainService, err := services.NewAptosService()
+		if err != nil {
+			log.Fatalf("Failed to initialize Aptos service: %v", err)
+		}
+
+		// Catch a node and chain ID from different profiles before anything is signed
+		checkCtx, cancelCheck := context.WithTimeout(ctx, 15*time.Second)
+		err = chainService.CheckChainID(checkCtx)
+		cancelCheck()
+		if errors.Is(err, services.ErrChainIDMismatch) {
+			log.Fatalf("Invalid configuration for profile %q: %v", config.AppConfig.Profile, err)
+		}
+		if err != nil {
+			log.Printf("WARNING: Could not check the chain ID of %s: %v", config.AppConfig.AptosNodeURL, err)
+		}
+		aptosService = chainService
+	}
+
+	if err := services.ValidateEncryptionConfig(); err != nil {
+		log.Fatalf("Invalid encryption configuration: %v", err)
+	}
+	if err := services.InitKeyProvider(context.Background()); err != nil {
+		log.Fatalf("Failed to initialize key provider: %v", err)
+	}
+	if services.EncryptionEnabled() {
+		log.Printf("Encryption at rest enabled with %s and master key %s", services.EncryptionAlgorithm(), services.CurrentMasterKeyID())
+	}
+
+	// Initialize the storage backend selected by STORAGE_BACKEND
+	storageService, err := services.NewStorageService()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Surface a wrong bucket or unreachable backend now rather than on the first upload
+	pingCtx, cancelPing := context.WithTimeout(ctx, 15*time.Second)
+	err = storageService.Ping(pingCtx)
+	cancelPing()
+	if err != nil {
+		if config.AppConfig.StorageStrictStartup {
+			log.Fatalf("Storage backend %q is not usable: %v (set STORAGE_STRICT_STARTUP=false to start anyway)", config.AppConfig.StorageBackend, err)
+		}
+		log.Printf("WARNING: Storage backend %q is not usable, starting anyway: %v", config.AppConfig.StorageBackend, err)
+	}
+
+	// Keep state (discovery progress, known users, webhooks), access requests, idempotency
+	// keys and the audit log in the DATABASE_URL database, or in the storage bucket when none
+	// is configured
+	var stateStore services.StateStore
+	var accessRequests services.AccessRequestRepository
+	var idempotencyKeys services.IdempotencyStore
+	var auditEntries services.AuditLogRepository
+	if config.AppConfig.DatabaseURL != "" {
+		database, err := db.Open(config.AppConfig.DatabaseURL)
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		defer database.Close()
+		log.Printf("Using %s database for state, access requests, idempotency keys and the audit log", database.Dialect())
+		stateStore = services.NewSQLStateStore(database)
+		accessRequests = services.NewSQLAccessRequestRepository(database)
+		idempotencyKeys = services.NewSQLIdempotencyStore(database)
+		auditEntries = services.NewSQLAuditLogRepository(database)
+	} else {
+		if storageState, ok := storageService.(services.StateStore); ok {
+			stateStore = storageState
+		} else {
+			log.Printf("WARNING: Storage backend %q has no state store, webhooks, access requests, idempotency keys and the audit log are kept in memory only", config.AppConfig.StorageBackend)
+		}
+		accessRequests = services.NewStateAccessRequestRepository(stateStore)
+		idempotencyKeys = services.NewStateIdempotencyStore(stateStore)
+		auditEntries = services.NewStateAuditLogRepository(stateStore)
+	}
+
+	// Persist user discovery progress so restarts resume scanning
+	if stateStore != nil {
+		if chainService, ok := aptosService.(*services.AptosServiceImpl); ok {
+			chainService.SetStateStore(stateStore)
+		}
+	}
+
+	// Index DataX events into SQLite so marketplace, vault and access reads can be served locally
+	switch config.AppConfig.ReadSource {
+	case services.ReadSourceRemote:
+	case services.ReadSourceLocal:
+		chainService, ok := aptosService.(*services.AptosServiceImpl)
+		if !ok {
+			log.Printf("WARNING: SOURCE=local is ignored with MOCK_CHAIN")
+			break
+		}
+		eventStore, err := store.Open(config.AppConfig.IndexDBPath)
+		if err != nil {
+			log.Fatalf("Failed to open event index: %v", err)
+		}
+		defer eventStore.Close()
+		chainService.SetEventStore(eventStore)
+		go chainService.RunEventIndexer(ctx)
+	default:
+		log.Fatalf("Unknown SOURCE %q (supported: remote, local)", config.AppConfig.ReadSource)
+	}
+
+	// Mint contribution rewards for the submissions the event index records
+	var rewards *services.RewardService
+	if config.AppConfig.RewardsEnabled {
+		chainService, ok := aptosService.(*services.AptosServiceImpl)
+		if !ok {
+			log.Printf("WARNING: REWARDS_ENABLED is ignored with MOCK_CHAIN")
+		} else {
+			rewards, err = services.NewRewardService(chainService, stateStore)
+			if err != nil {
+				log.Fatalf("Failed to start contribution rewards: %v", err)
+			}
+			go rewards.Run(ctx)
+		}
+	}
+
+	// Abort multipart uploads that interrupted uploads left incomplete
+	if cleaner, ok := storageService.(services.MultipartCleaner); ok {
+		go cleaner.CleanupMultipartUploads(ctx)
+	}
+
+	// Deliver webhook notifications, keeping registrations in the state store when there is one
+	webhooks := services.NewWebhookService(stateStore)
+	go webhooks.Run(ctx)
+
+	// Write the audit trail of dataset reads in the background; Close, deferred so it runs
+	// after the server has drained, writes what is still queued
+	auditLog := services.NewAuditLog(auditEntries)
+	go auditLog.Run()
+	defer auditLog.Close()
+
+	// Reject malformed addresses and hashes at binding, with errors naming JSON fields
+	if err := handlers.RegisterValidators(); err != nil {
+		log.Fatalf("Failed to register request validators: %v", err)
+	}
 
 	// Initialize handlers
-	handler := handlers.NewHandler(aptosService, storageService)
+	handler := handlers.NewHandler(aptosService, storageService, services.NewWalletAuthService(), webhooks, accessRequests, services.NewAccessTokenService(), auditLog, rewards)
+
+	router, err := newRouter(ctx, handler, idempotencyKeys)
+	if err != nil {
+		log.Fatalf("Failed to set up routes: %v", err)
+	}
+	spec, err := buildAPISpec(router)
+	if err != nil {
+		log.Fatalf("OpenAPI document is out of date: %v", err)
+	}
+	handler.SetAPISpec(spec)
+
+	// Start server
+	addr := fmt.Sprintf(":%s", config.AppConfig.Port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+	server := &http.Server{
+		Addr:    addr,
+		Handler: router,
+	}
 
+	log.Printf("Server starting on %s", addr)
+	if err := runServer(ctx, server, listener, time.Duration(config.AppConfig.ShutdownGracePeriod)*time.Second); err != nil {
+		log.Printf("ERROR: %v", err)
+		return
+	}
+	log.Printf("Server stopped")
+}
+
+// newRouter registers the middleware and every route on a new engine. ctx bounds the
+// rate limiters' background cleanup
+func newRouter(ctx context.Context, handler *handlers.Handler, idempotencyKeys services.IdempotencyStore) (*gin.Engine, error) {
 	// Setup Gin router
 	router := gin.Default()
 
-	// CORS middleware
-	router.Use(corsMiddleware())
+	// Only trust X-Forwarded-For from our own proxies when resolving client IPs
+	if err := router.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	// Tag every request with an X-Request-ID for logs and the audit trail
+	router.Use(middleware.RequestID())
+
+	// CORS middleware - permissive only outside production when no allowlist is configured
+	router.Use(middleware.CORS(
+		config.AppConfig.CORSAllowedOrigins,
+		!config.AppConfig.IsProduction(),
+		config.AppConfig.CORSMaxAge,
+	))
+
+	// Compress large responses (CSV data, marketplace listings)
+	router.Use(middleware.Gzip(middleware.DefaultGzipMinSize))
 
 	// Health check
 	router.GET("/health", handler.HealthCheck)
 
+	// API documentation
+	router.GET("/docs", handler.APIDocs)
+
 	// API routes
 	api := router.Group("/api/v1")
+
+	// Per-IP rate limits: every route shares the default tier, and expensive routes
+	// (chain-wide listings, uploads, downloads) also draw from a stricter one. The limits are
+	// read per request so a configuration reload applies them
+	defaultLimiter := middleware.NewRateLimiter(ctx, "default", func() (int, int) {
+		tunables := config.Tunable()
+		return tunables.RateLimitPerMinute, tunables.RateLimitBurst
+	})
+	expensiveLimiter := middleware.NewRateLimiter(ctx, "expensive", func() (int, int) {
+		tunables := config.Tunable()
+		return tunables.RateLimitExpensivePerMinute, tunables.RateLimitExpensiveBurst
+	})
+	expensive := expensiveLimiter.Middleware()
+	api.Use(defaultLimiter.Middleware())
+
+	if len(config.AppConfig.APIKeys) > 0 {
+		api.Use(middleware.APIKeyAuth(config.AppConfig.APIKeys, "/api/v1/openapi.json"))
+	} else {
+		log.Printf("WARNING: API_KEYS is not set, /api/v1 is unauthenticated")
+	}
+	if len(config.AppConfig.AdminAPIKeys) == 0 {
+		log.Printf("Admin routes are disabled, set ADMIN_API_KEYS to enable them")
+	}
+
+	// Writes replay their first response to retries sent with the same Idempotency-Key.
+	// Streamed uploads are left out: their bodies are too large to fingerprint up front
+	idempotent := middleware.Idempotency(idempotencyKeys, time.Duration(config.AppConfig.IdempotencyTTL)*time.Second)
 	{
+		// OpenAPI document
+		api.GET("/openapi.json", handler.OpenAPISpec)
+
+		// Wallet signature challenge
+		api.POST("/auth/challenge", handler.CreateAuthChallenge)
+
 		// User initialization
-		api.POST("/users/initialize", handler.InitializeUser)
+		api.POST("/users/initialize", idempotent, handler.InitializeUser)
 		api.POST("/users/check-initialization", handler.CheckInitialization)
 
 		// Data operations
-		api.POST("/data/delete", handler.DeleteDataset)
+		api.POST("/data/delete", idempotent, handler.DeleteDataset)
+		api.POST("/data/reactivate", idempotent, handler.ReactivateDataset)
 		api.POST("/data/get", handler.GetDataset)
 		api.POST("/data/check-hash", handler.CheckDataHash)
 
 		// Access control
-		api.POST("/access/grant", handler.GrantAccess)
-		api.POST("/access/revoke", handler.RevokeAccess)
+		api.POST("/access/grant", idempotent, handler.GrantAccess)
+		api.POST("/access/revoke", idempotent, handler.RevokeAccess)
 		api.POST("/access/check", handler.CheckAccess)
+		api.POST("/access/list-all", handler.ListAllGrants)
+		api.POST("/access/my-datasets", handler.ListAccessibleDatasets)
+		api.POST("/access/wrapped-key", handler.GetWrappedKey)
+
+		// Escrow
+		api.POST("/escrow/deposit", idempotent, handler.DepositEscrow)
+		api.POST("/escrow/release", idempotent, handler.ReleaseEscrow)
+		api.POST("/escrow/refund", idempotent, handler.RefundEscrow)
+		api.POST("/escrow/balance", handler.GetEscrowBalance)
+
+		// Webhooks
+		api.POST("/webhooks", idempotent, handler.RegisterWebhook)
+		api.POST("/webhooks/list", handler.ListWebhooks)
+		api.POST("/webhooks/delete", idempotent, handler.DeleteWebhook)
+		api.POST("/webhooks/status", handler.GetWebhookStatus)
 
 		// Vault operations
 		api.POST("/vault/get", handler.GetUserVault)
 		api.POST("/vault/metadata", handler.GetUserDatasetsMetadata)
 
 		// Token operations
-		api.POST("/token/register", handler.RegisterToken)
-		api.POST("/token/mint", handler.MintToken)
+		api.POST("/token/register", idempotent, handler.RegisterToken)
+		api.POST("/token/mint", idempotent, handler.MintToken)
+		api.POST("/token/check-registration", handler.CheckTokenRegistration)
+		api.GET("/token/info", handler.GetTokenInfo)
+
+		// Transactions
+		api.GET("/tx/:hash/receipt", handler.GetTransactionReceipt)
 
 		// CSV upload
-		api.POST("/data/submit-csv", handler.SubmitCSV)
+		api.POST("/data/submit-csv", expensive, handler.SubmitCSV)
+		api.POST("/data/submit-json", expensive, handler.SubmitJSON)
+		api.POST("/data/submit-encrypted-csv", expensive, handler.SubmitEncryptedCSV)
+		api.POST("/data/infer-schema", handler.InferSchema)
+		api.POST("/data/validate-metadata", handler.ValidateMetadata)
+		api.POST("/data/scan-pii", handler.ScanPII)
+		api.POST("/data/stats", handler.GetCSVStats)
 
 		// Marketplace
-		api.GET("/marketplace/datasets", handler.GetMarketplaceDatasets)
+		api.GET("/marketplace/datasets", expensive, handler.GetMarketplaceDatasets)
 		api.POST("/marketplace/access-requests", handler.GetAccessRequests)
-		api.POST("/marketplace/request-access", handler.RequestAccess)
+		api.POST("/marketplace/request-access", idempotent, handler.RequestAccess)
+		api.POST("/marketplace/access-requests/sent", handler.GetSentAccessRequests)
+		api.POST("/marketplace/access-requests/approve", idempotent, handler.ApproveAccessRequest)
+		api.POST("/marketplace/access-requests/deny", idempotent, handler.DenyAccessRequest)
+		api.POST("/marketplace/access-requests/confirm-payment", idempotent, handler.ConfirmAccessPayment)
 		api.POST("/marketplace/register-user", handler.RegisterUserForMarketplace)
 
 		// CSV data viewing
-		api.POST("/data/get-csv", handler.GetCSVData)
+		api.POST("/data/get-csv", expensive, handler.GetCSVData)
+		api.POST("/data/get-encrypted-csv", expensive, handler.GetEncryptedCSV)
+		api.POST("/data/preview", handler.PreviewCSVData)
+		api.POST("/data/sample", expensive, handler.SampleDataset)
+		api.POST("/data/aggregate", expensive, handler.AggregateDataset)
+		api.POST("/data/get-encryption-info", handler.GetEncryptionInfo)
+		api.POST("/data/export", expensive, handler.ExportData)
+		api.POST("/data/upload-url", handler.CreateUploadURL)
+		api.POST("/data/finalize-upload", expensive, idempotent, handler.FinalizeUpload)
+		api.POST("/data/download-url", handler.GetDownloadURL)
+		api.POST("/data/audit-log", handler.GetAuditLog)
+		api.POST("/data/analytics", handler.GetDatasetAnalytics)
+		api.POST("/data/delete-blob", idempotent, handler.DeleteBlob)
+		api.POST("/storage/list", handler.ListStoredBlobs)
+
+		// Admin: need an ADMIN_API_KEYS key as well, and are off without one
+		admin := api.Group("/admin", middleware.AdminAuth(config.AppConfig.AdminAPIKeys))
+		admin.GET("/discovery-checkpoint", handler.GetDiscoveryCheckpoint)
+		admin.POST("/manifest/backfill", expensive, handler.BackfillManifest)
+		admin.POST("/encryption/migrate", expensive, handler.MigrateEncryption)
+		admin.POST("/config/reload", handler.ReloadConfig)
+		admin.GET("/rewards", handler.GetRewardLedger)
+		admin.POST("/rewards/pause", handler.PauseRewards)
+		admin.GET("/devnet", handler.GetDevnetStatus)
 	}
 
-	// Start server
-	addr := fmt.Sprintf(":%s", config.AppConfig.Port)
-	log.Printf("Server starting on %s", addr)
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// REST reads: the v1 reads as GETs with path and query parameters, cacheable by
+	// browsers and CDNs. Protected reads take the wallet signature in X-Wallet-* headers
+	v2 := router.Group("/api/v2")
+	v2.Use(defaultLimiter.Middleware())
+	if len(config.AppConfig.APIKeys) > 0 {
+		v2.Use(middleware.APIKeyAuth(config.AppConfig.APIKeys))
+	}
+	{
+		v2.GET("/datasets/:owner", handler.ListOwnerDatasets)
+		v2.GET("/datasets/:owner/:id", handler.GetOwnerDataset)
+		v2.GET("/datasets/:owner/:id/csv", expensive, handler.GetOwnerDatasetCSV)
+		v2.GET("/marketplace/datasets", expensive, handler.GetMarketplaceDatasets)
+		v2.GET("/users/:address/vault", handler.GetUserVaultByAddress)
 	}
+
+	return router, nil
 }
 
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+// buildAPISpec describes every route of router. A route without an operation in
+// handlers.APIOperations, or an operation without a route, is an error, which stops startup
+func buildAPISpec(router *gin.Engine) ([]byte, error) {
+	return openapi.Build(router.Routes(), handlers.APIOperations(), openapi.Info{
+		Title:       "DataX Backend API",
+		Version:     "v1",
+		Description: "Every JSON answer is wrapped in the Response envelope; failures set success to false, error and, where one applies, code.",
+		Envelope:    models.Response{},
+		ErrorCodes:  models.ErrorCodes,
+		APIKeys:     len(config.AppConfig.APIKeys) > 0,
+	})
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+}
+
+// runServer serves on listener until ctx ends, then stops accepting connections and lets
+// in-flight requests (e.g. transactions waiting for confirmation) finish within grace
+func runServer(ctx context.Context, server *http.Server, listener net.Listener, grace time.Duration) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			return fmt.Errorf("server failed: %w", err)
 		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %v for in-flight requests", grace)
 
-		c.Next()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("graceful shutdown did not complete: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/handlers"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+func TestShutdownLetsInFlightRequestsFinish(t *testing.T) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stands in for a submission waiting on WaitForTransaction
+		close(started)
+		time.Sleep(500 * time.Millisecond)
+		io.WriteString(w, "committed")
+	})}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- runServer(ctx, server, listener, 5*time.Second) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	url := "http://" + listener.Addr().String() + "/slow"
+	go func() {
+		response, err := http.Get(url)
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		slow <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("send SIGTERM: %v", err)
+	}
+
+	got := <-slow
+	if got.err != nil || got.body != "committed" {
+		t.Fatalf("in-flight request = %q, %v; want it to complete", got.body, got.err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("runServer: %v", err)
+	}
+
+	// Once drained, the server takes no new connections
+	if _, err := http.Get(url); err == nil {
+		t.Errorf("request after shutdown succeeded")
+	}
+}
+
+func TestShutdownGivesUpAfterTheGracePeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- runServer(ctx, server, listener, 100*time.Millisecond) }()
+	go http.Get("http://" + listener.Addr().String() + "/stuck")
+
+	<-started
+	cancel()
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Errorf("runServer returned nil with a request still running past the grace period")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runServer did not return after the grace period")
+	}
+}
+
+// testRouter builds the server's router on the mock chain and local storage
+func testRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("STORAGE_BACKEND", "local")
+	t.Setenv("API_KEYS", "")
+	t.Setenv("ADMIN_API_KEYS", "")
+	if err := config.LoadConfig(); err != nil {
+		t.Logf("test config did not validate: %v", err)
+	}
+	chain, err := services.NewMockAptosService("")
+	if err != nil {
+		t.Fatalf("NewMockAptosService: %v", err)
+	}
+	handler := handlers.NewHandler(chain, services.NewLocalStorageService(t.TempDir()), services.NewWalletAuthService(),
+		services.NewWebhookService(nil), services.NewStateAccessRequestRepository(nil), services.NewAccessTokenService(),
+		services.NewAuditLog(services.NewStateAuditLogRepository(nil)), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	router, err := newRouter(ctx, handler, services.NewStateIdempotencyStore(nil))
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+	return router
+}
+
+func TestEveryRouteHasAnOpenAPIOperation(t *testing.T) {
+	router := testRouter(t)
+	spec, err := buildAPISpec(router)
+	if err != nil {
+		t.Fatalf("routes and handlers.APIOperations have drifted apart: %v", err)
+	}
+
+	var doc struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	described := 0
+	for _, methods := range doc.Paths {
+		described += len(methods)
+	}
+	if routes := len(router.Routes()); described != routes {
+		t.Errorf("spec describes %d operations for %d routes", described, routes)
+	}
+}
+
+func TestBuildAPISpecCatchesUndocumentedRoutes(t *testing.T) {
+	router := testRouter(t)
+	router.GET("/api/v1/undocumented", func(c *gin.Context) {})
+	if _, err := buildAPISpec(router); err == nil || !strings.Contains(err.Error(), "GET /api/v1/undocumented") {
+		t.Errorf("buildAPISpec with an undocumented route = %v, want it named", err)
+	}
+}
+
+func TestDevnetStatusIsAnAdminRoute(t *testing.T) {
+	router := testRouter(t)
+	for path, want := range map[string]int{
+		"/api/v1/debug/devnet": http.StatusNotFound,
+		// Without ADMIN_API_KEYS the admin routes are off
+		"/api/v1/admin/devnet": http.StatusForbidden,
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != want {
+			t.Errorf("GET %s = %d %s, want %d", path, recorder.Code, recorder.Body.String(), want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyLabelKey is the context key holding the label of the authenticated API key
+const APIKeyLabelKey = "api_key_label"
+
+// APIKeyAuth requires an "Authorization: Bearer <key>" header matching one of the keys
+// Paths listed in skipPaths are let through unauthenticated. Requests are counted per
+// key label so we can see which client is doing what
+func APIKeyAuth(keys []config.APIKey, skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	var countsMu sync.Mutex
+	counts := make(map[string]uint64, len(keys))
+
+	return func(c *gin.Context) {
+		if skip[c.FullPath()] || skip[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		token := ""
+		if header := c.GetHeader("Authorization"); len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+			token = strings.TrimSpace(header[7:])
+		}
+
+		label, ok := matchAPIKey(keys, token)
+		if !ok {
+			fmt.Printf("AUTH: Rejected %s %s from %s (missing or invalid API key)\n", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+				Success: false,
+				Error:   "missing or invalid API key",
+				Code:    models.ErrCodeUnauthorized,
+			})
+			return
+		}
+
+		countsMu.Lock()
+		counts[label]++
+		count := counts[label]
+		countsMu.Unlock()
+
+		fmt.Printf("AUTH: %s %s by key %q (request #%d)\n", c.Request.Method, c.Request.URL.Path, label, count)
+		c.Set(APIKeyLabelKey, label)
+		c.Next()
+	}
+}
+
+// matchAPIKey returns the label of the key equal to token
+// Every key is compared in constant time so timing doesn't reveal how close a guess was
+func matchAPIKey(keys []config.APIKey, token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+
+	label := ""
+	matched := false
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key.Key)) == 1 && !matched {
+			label = key.Label
+			matched = true
+		}
+	}
+	return label, matched
+}
+
+// AdminKeyHeader carries the admin credential, kept apart from the API key in Authorization
+const AdminKeyHeader = "X-Admin-Key"
+
+// AdminAuth requires an X-Admin-Key header matching one of the admin keys
+// With no admin keys configured every request is refused, so the admin routes are off
+// unless an operator turns them on
+func AdminAuth(keys []config.APIKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(keys) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.Response{
+				Success: false,
+				Error:   "admin routes are disabled; set ADMIN_API_KEYS to enable them",
+				Code:    models.ErrCodeAdminDisabled,
+			})
+			return
+		}
+
+		label, ok := matchAPIKey(keys, strings.TrimSpace(c.GetHeader(AdminKeyHeader)))
+		if !ok {
+			fmt.Printf("AUTH: Rejected admin %s %s from %s (missing or invalid admin key)\n", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+				Success: false,
+				Error:   "missing or invalid admin key",
+				Code:    models.ErrCodeUnauthorized,
+			})
+			return
+		}
+
+		fmt.Printf("AUTH: Admin %s %s by key %q\n", c.Request.Method, c.Request.URL.Path, label)
+		c.Next()
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+var testAPIKeys = []config.APIKey{{Label: "frontend", Key: "api-secret"}}
+var testAdminKeys = []config.APIKey{{Label: "ops", Key: "admin-secret"}}
+
+// adminRouter mounts an admin route behind both the API key and the admin key, as main.go does
+func adminRouter(adminKeys []config.APIKey) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api/v1", APIKeyAuth(testAPIKeys))
+	admin := api.Group("/admin", AdminAuth(adminKeys))
+	admin.POST("/config/reload", func(c *gin.Context) {
+		c.JSON(http.StatusOK, models.Response{Success: true})
+	})
+	return router
+}
+
+func adminRequest(router *gin.Engine, apiKey string, adminKey string) (int, models.Response) {
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/admin/config/reload", nil)
+	if apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	if adminKey != "" {
+		request.Header.Set(AdminKeyHeader, adminKey)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+func TestAdminRoutesNeedTheAdminKey(t *testing.T) {
+	router := adminRouter(testAdminKeys)
+
+	cases := []struct {
+		name     string
+		apiKey   string
+		adminKey string
+		status   int
+	}{
+		{"both keys", "api-secret", "admin-secret", http.StatusOK},
+		{"API key only", "api-secret", "", http.StatusUnauthorized},
+		{"wrong admin key", "api-secret", "admin-secreT", http.StatusUnauthorized},
+		{"API key as admin key", "api-secret", "api-secret", http.StatusUnauthorized},
+		{"admin key only", "", "admin-secret", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		status, response := adminRequest(router, tc.apiKey, tc.adminKey)
+		if status != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, status, tc.status)
+		}
+		if tc.status == http.StatusUnauthorized && response.Code != models.ErrCodeUnauthorized {
+			t.Errorf("%s: code %q, want %s", tc.name, response.Code, models.ErrCodeUnauthorized)
+		}
+	}
+}
+
+func TestAdminRoutesAreOffWithoutAdminKeys(t *testing.T) {
+	router := adminRouter(nil)
+
+	status, response := adminRequest(router, "api-secret", "anything")
+	if status != http.StatusForbidden || response.Code != models.ErrCodeAdminDisabled {
+		t.Errorf("status %d code %q, want 403 %s", status, response.Code, models.ErrCodeAdminDisabled)
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// The X-Wallet-*, X-Access-Token and X-Decryption-Key headers carry the wallet signature of GETs on /api/v2
+	corsAllowHeaders = "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-None-Match, Idempotency-Key, X-Request-ID, Range, " +
+		"X-Wallet-Nonce, X-Wallet-Signed-Message, X-Wallet-Public-Key, X-Wallet-Signature, X-Access-Token, X-Decryption-Key"
+	corsAllowMethods = "POST, OPTIONS, GET, PUT, DELETE"
+	// Response headers the frontend reads: export filenames, marketplace ETags, rate limit back-off, replayed writes,
+	// data access tokens, request IDs, resumable exports, columns a grant doesn't cover
+	corsExposeHeaders = "Content-Disposition, ETag, Retry-After, Idempotent-Replayed, X-Access-Token, X-Access-Token-Expires, X-Request-ID, " +
+		"Accept-Ranges, Content-Range, X-Range-Ignored, X-Withheld-Columns"
+)
+
+// CORS allows cross-origin requests from the configured origins
+// Entries are exact origins ("https://datax.app") or wildcard subdomains ("*.datax.app"
+// or "https://*.datax.app"). Matching origins are echoed back with credentials allowed;
+// other origins get no CORS headers and their preflights are refused.
+// With an empty list and allowAny set (non-production), any origin is allowed without
+// credentials, as before the allowlist existed
+func CORS(allowedOrigins []string, allowAny bool, maxAgeSeconds int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		c.Writer.Header().Add("Vary", "Origin")
+
+		allowed := false
+		switch {
+		case origin == "":
+			// Not a cross-origin request
+		case len(allowedOrigins) == 0 && allowAny:
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+			allowed = true
+		case originAllowed(origin, allowedOrigins):
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			allowed = true
+		}
+
+		if !preflight {
+			if allowed {
+				c.Writer.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			}
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !allowed {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Writer.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+		c.Writer.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+		if maxAgeSeconds > 0 {
+			c.Writer.Header().Set("Access-Control-Max-Age", strconv.Itoa(maxAgeSeconds))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// originAllowed reports whether an Origin header value matches an allowlist entry
+func originAllowed(origin string, allowedOrigins []string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return false
+	}
+	host := strings.ToLower(parsed.Host)
+
+	for _, pattern := range allowedOrigins {
+		pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "/"))
+		if pattern == "" {
+			continue
+		}
+
+		scheme := ""
+		if i := strings.Index(pattern, "://"); i >= 0 {
+			scheme = pattern[:i]
+			pattern = pattern[i+3:]
+		}
+		if scheme != "" && scheme != strings.ToLower(parsed.Scheme) {
+			continue
+		}
+
+		if strings.HasPrefix(pattern, "*.") {
+			// Wildcard matches subdomains only, not the bare domain
+			if strings.HasSuffix(host, pattern[1:]) && len(host) > len(pattern)-1 {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
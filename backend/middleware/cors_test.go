@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testAllowedOrigins = []string{"https://datax.app", "https://*.preview.datax.app"}
+
+func corsRouter(allowedOrigins []string, allowAny bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORS(allowedOrigins, allowAny, 600))
+	router.GET("/data", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return router
+}
+
+func corsRequest(router *gin.Engine, method string, origin string, preflight bool) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/data", nil)
+	if origin != "" {
+		request.Header.Set("Origin", origin)
+	}
+	if preflight {
+		request.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	router := corsRouter(testAllowedOrigins, true)
+
+	for _, origin := range []string{"https://datax.app", "https://pr-12.preview.datax.app", "https://DATAX.app"} {
+		response := corsRequest(router, http.MethodGet, origin, false)
+		if response.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", origin, response.Code)
+		}
+		if got := response.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want the origin echoed", origin, got)
+		}
+		if got := response.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q, want true", origin, got)
+		}
+		if got := response.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("%s: Vary = %q, want Origin", origin, got)
+		}
+	}
+}
+
+func TestCORSDeniedOrigins(t *testing.T) {
+	router := corsRouter(testAllowedOrigins, true)
+
+	denied := []string{
+		"https://evil.example",
+		"http://datax.app",          // Scheme differs
+		"https://preview.datax.app", // Wildcards match subdomains only
+		"https://datax.app.evil.example",
+		"https://evilpreview.datax.app",
+		"null",
+	}
+	for _, origin := range denied {
+		response := corsRequest(router, http.MethodGet, origin, false)
+		if got := response.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want none", origin, got)
+		}
+		if got := response.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q, want none", origin, got)
+		}
+		if got := response.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("%s: Vary = %q, want Origin", origin, got)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := corsRouter(testAllowedOrigins, false)
+
+	allowed := corsRequest(router, http.MethodOptions, "https://datax.app", true)
+	if allowed.Code != http.StatusNoContent {
+		t.Fatalf("allowed preflight: status %d, want 204", allowed.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://datax.app",
+		"Access-Control-Allow-Methods": corsAllowMethods,
+		"Access-Control-Allow-Headers": corsAllowHeaders,
+		"Access-Control-Max-Age":       "600",
+	} {
+		if got := allowed.Header().Get(header); got != want {
+			t.Errorf("allowed preflight: %s = %q, want %q", header, got, want)
+		}
+	}
+
+	denied := corsRequest(router, http.MethodOptions, "https://evil.example", true)
+	if denied.Code != http.StatusForbidden {
+		t.Errorf("denied preflight: status %d, want 403", denied.Code)
+	}
+	if got := denied.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("denied preflight: Access-Control-Allow-Methods = %q, want none", got)
+	}
+}
+
+func TestCORSPermissiveOnlyWithoutAnAllowlist(t *testing.T) {
+	// Non-production with no list: any origin, but never with credentials
+	open := corsRequest(corsRouter(nil, true), http.MethodGet, "https://anything.example", false)
+	if got := open.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("no allowlist: Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := open.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("no allowlist: Access-Control-Allow-Credentials = %q, want none", got)
+	}
+
+	// Production with no list: nothing is allowed
+	closed := corsRequest(corsRouter(nil, false), http.MethodOptions, "https://anything.example", true)
+	if closed.Code != http.StatusForbidden {
+		t.Errorf("production without allowlist: preflight status %d, want 403", closed.Code)
+	}
+}
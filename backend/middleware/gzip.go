@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultGzipMinSize is the smallest response body worth compressing
+const DefaultGzipMinSize = 1024
+
+// Content types that are already compressed and gain nothing from gzip
+var precompressedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/octet-stream",
+}
+
+// Gzip compresses responses for clients that accept gzip
+// Bodies smaller than minSize, responses that already set Content-Encoding, partial
+// (range) responses, and already-compressed content types are passed through untouched.
+// Handlers that stream (call Flush) get compressed output flushed as they go
+func Gzip(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Added, not set: CORS has already put Origin in Vary
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		writer := &gzipWriter{ResponseWriter: c.Writer, minSize: minSize}
+		c.Writer = writer
+
+		defer func() {
+			writer.finish()
+			c.Writer = writer.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip (and doesn't set q=0)
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), "gzip") {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+			if param == "q=0" || param == "q=0.0" || param == "q=0.00" || param == "q=0.000" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter buffers the start of a response until it knows whether compressing is worthwhile
+type gzipWriter struct {
+	gin.ResponseWriter
+	minSize  int
+	buf      []byte
+	gz       *gzip.Writer
+	decided  bool
+	compress bool
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.compress {
+			return w.gz.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.minSize {
+		w.decide(w.compressible())
+		if err := w.flushBuffer(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends whatever has been written so far, compressing it if eligible
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.decide(len(w.buf) > 0 && w.compressible())
+		if err := w.flushBuffer(); err != nil {
+			return
+		}
+	}
+	if w.compress {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// compressible reports whether the response headers allow compression
+func (w *gzipWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	// Range offsets refer to the identity body; compressing a partial response would break them
+	if status == http.StatusPartialContent || header.Get("Content-Range") != "" {
+		return false
+	}
+
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, skip := range precompressedContentTypes {
+		if strings.HasPrefix(contentType, skip) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide fixes whether the rest of the response is compressed
+func (w *gzipWriter) decide(compress bool) {
+	w.decided = true
+	w.compress = compress
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+}
+
+// flushBuffer writes out the bytes buffered before the decision
+func (w *gzipWriter) flushBuffer() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	if w.compress {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish completes the response once the handler chain has returned
+func (w *gzipWriter) finish() {
+	if !w.decided {
+		// Whole body fits under minSize - send it as-is
+		w.decide(false)
+		w.flushBuffer()
+		return
+	}
+	if w.compress {
+		w.gz.Close()
+	}
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// largeCSV is a CSV well over DefaultGzipMinSize
+func largeCSV() []byte {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"id", "name", "note"})
+	for i := 0; i < 5000; i++ {
+		writer.Write([]string{fmt.Sprint(i), fmt.Sprintf("row %d", i), `quoted, "with" commas`})
+	}
+	writer.Flush()
+	return buf.Bytes()
+}
+
+// gzipRouter serves /csv with the whole body at once, /stream flushing it in chunks and
+// /partial as a 206, behind CORS and Gzip as main.go orders them
+func gzipRouter(body []byte) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORS([]string{"https://datax.app"}, false, 0))
+	router.Use(Gzip(DefaultGzipMinSize))
+	router.GET("/csv", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/csv", body)
+	})
+	router.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		for start := 0; start < len(body); start += 4096 {
+			end := min(start+4096, len(body))
+			c.Writer.Write(body[start:end])
+			c.Writer.Flush()
+		}
+	})
+	router.GET("/partial", func(c *gin.Context) {
+		c.Header("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(body)-1, len(body)*2))
+		c.Data(http.StatusPartialContent, "text/csv", body)
+	})
+	return router
+}
+
+func get(router *gin.Engine, path string, acceptEncoding string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Origin", "https://datax.app")
+	if acceptEncoding != "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func gunzip(t *testing.T, body []byte) []byte {
+	t.Helper()
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	return plain
+}
+
+func TestGzipCompressesLargeCSV(t *testing.T) {
+	body := largeCSV()
+	router := gzipRouter(body)
+
+	for _, path := range []string{"/csv", "/stream"} {
+		response := get(router, path, "gzip, deflate")
+		if got := response.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("%s: Content-Encoding = %q, want gzip", path, got)
+		}
+		if response.Body.Len() >= len(body) {
+			t.Errorf("%s: compressed body is %d bytes, the CSV %d", path, response.Body.Len(), len(body))
+		}
+		if !bytes.Equal(gunzip(t, response.Body.Bytes()), body) {
+			t.Errorf("%s: decompressed body differs from the CSV", path)
+		}
+	}
+}
+
+func TestGzipKeepsCORSVary(t *testing.T) {
+	router := gzipRouter(largeCSV())
+
+	for _, acceptEncoding := range []string{"gzip", ""} {
+		response := get(router, "/csv", acceptEncoding)
+		vary := strings.Join(response.Header().Values("Vary"), ", ")
+		if !strings.Contains(vary, "Origin") || !strings.Contains(vary, "Accept-Encoding") {
+			t.Errorf("Accept-Encoding %q: Vary = %q, want Origin and Accept-Encoding", acceptEncoding, vary)
+		}
+		if got := response.Header().Get("Access-Control-Allow-Origin"); got != "https://datax.app" {
+			t.Errorf("Accept-Encoding %q: Access-Control-Allow-Origin = %q", acceptEncoding, got)
+		}
+	}
+}
+
+func TestGzipLeavesRangeResponsesAlone(t *testing.T) {
+	body := largeCSV()
+	response := get(gzipRouter(body), "/partial", "gzip")
+
+	if response.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", response.Code)
+	}
+	if got := response.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q on a partial response", got)
+	}
+	if !bytes.Equal(response.Body.Bytes(), body) {
+		t.Errorf("partial body was altered")
+	}
+}
+
+func TestGzipSkipsClientsWithoutGzip(t *testing.T) {
+	body := largeCSV()
+	for _, acceptEncoding := range []string{"", "br", "gzip;q=0"} {
+		response := get(gzipRouter(body), "/csv", acceptEncoding)
+		if got := response.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q", acceptEncoding, got)
+		}
+		if !bytes.Equal(response.Body.Bytes(), body) {
+			t.Errorf("Accept-Encoding %q: body was altered", acceptEncoding)
+		}
+	}
+}
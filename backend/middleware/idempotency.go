@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader names the client-chosen key that makes a write safe to retry
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on a response replayed for a repeated key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodyBytes  = 1 << 20 // Write bodies are small JSON; streamed uploads don't take a key
+	// A running request holds its key this long, covering transactions waiting for
+	// confirmation. After a crash the key frees up once it passes
+	idempotencyReservation = 10 * time.Minute
+)
+
+// Idempotency makes writes with an Idempotency-Key header safe to retry. The first request
+// with a key runs and its response is kept for ttl; a repeat with the same method, path
+// and body gets that response back instead of running again. A repeat with a different
+// request is refused with 422, and one arriving while the first still runs with 409.
+// Keys are scoped to the client: its API key, or without API keys its address. Failures (5xx) aren't kept, so their retries run again.
+// Requests without the header are let through untouched
+func Idempotency(store services.IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength),
+			})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentBodyBytes+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("failed to read request body: %v", err),
+			})
+			return
+		}
+		if len(body) > maxIdempotentBodyBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, models.Response{
+				Success: false,
+				Error:   fmt.Sprintf("requests with an %s are limited to %d bytes", IdempotencyKeyHeader, maxIdempotentBodyBytes),
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := models.IdempotencyRecord{
+			Key:         idempotencyScope(idempotencyClient(c), key),
+			Fingerprint: requestFingerprint(c.Request.Method, c.Request.URL.Path, body),
+			ExpiresAt:   time.Now().Add(idempotencyReservation).Unix(),
+		}
+		existing, reserved, err := store.Reserve(record)
+		if err != nil {
+			fmt.Printf("ERROR: Failed to reserve idempotency key for %s: %v\n", c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+				Success: false,
+				Error:   "failed to check the idempotency key",
+			})
+			return
+		}
+		if !reserved {
+			replayIdempotent(c, record, existing)
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			c.Writer = writer.ResponseWriter
+			// Free the key if the handler failed or panicked, so the retry runs again
+			if completed {
+				return
+			}
+			if err := store.Release(record); err != nil {
+				fmt.Printf("WARNING: Failed to release idempotency key for %s: %v\n", c.Request.URL.Path, err)
+			}
+		}()
+
+		c.Next()
+
+		if writer.Status() >= http.StatusInternalServerError || !writer.Written() {
+			return
+		}
+		record.StatusCode = writer.Status()
+		record.ContentType = writer.Header().Get("Content-Type")
+		record.Body = writer.body.Bytes()
+		record.ExpiresAt = time.Now().Add(ttl).Unix()
+		if err := store.Complete(record); err != nil {
+			fmt.Printf("WARNING: Failed to store idempotent response for %s: %v\n", c.Request.URL.Path, err)
+			return
+		}
+		completed = true
+	}
+}
+
+// replayIdempotent answers a request whose key is already held by existing
+func replayIdempotent(c *gin.Context, record models.IdempotencyRecord, existing models.IdempotencyRecord) {
+	switch {
+	case existing.Fingerprint != record.Fingerprint:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("%s was already used with a different request", IdempotencyKeyHeader),
+			Code:    models.ErrCodeIdempotencyKeyReused,
+		})
+	case existing.StatusCode == 0:
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusConflict, models.Response{
+			Success: false,
+			Error:   fmt.Sprintf("a request with this %s is still in progress", IdempotencyKeyHeader),
+			Code:    models.ErrCodeIdempotencyInProgress,
+		})
+	default:
+		fmt.Printf("DEBUG: Replaying idempotent response for %s %s\n", c.Request.Method, c.Request.URL.Path)
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+		c.Abort()
+	}
+}
+
+// idempotencyClient names the client a key belongs to: the label of its API key, or when
+// API_KEYS is unset its address (as TRUSTED_PROXIES resolves it), so one client can't
+// replay another's response
+func idempotencyClient(c *gin.Context) string {
+	if label := c.GetString(APIKeyLabelKey); label != "" {
+		return "key:" + label
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// idempotencyScope keys a client's Idempotency-Key by the client, hashed so any key text
+// is safe to store
+func idempotencyScope(client string, key string) string {
+	sum := sha256.Sum256([]byte(client + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestFingerprint identifies the request a key was first used with
+func requestFingerprint(method string, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body as it's written
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datax/backend/models"
+	"github.com/datax/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentRouter mounts a write that counts its runs behind Idempotency. A request's
+// X-Test-Label header stands in for the API key it authenticated with, and X-Test-Fail
+// makes the write fail with a 500
+func idempotentRouter(ttl time.Duration) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+	runs := 0
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if label := c.GetHeader("X-Test-Label"); label != "" {
+			c.Set(APIKeyLabelKey, label)
+		}
+	})
+	router.POST("/write", Idempotency(services.NewStateIdempotencyStore(nil), ttl), func(c *gin.Context) {
+		runs++
+		if c.GetHeader("X-Test-Fail") != "" {
+			c.JSON(http.StatusInternalServerError, models.Response{Success: false, Error: "failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, models.Response{Success: true, Data: runs})
+	})
+	return router, &runs
+}
+
+// idempotentRequest posts body to the write with an Idempotency-Key from remoteAddr
+func idempotentRequest(router *gin.Engine, key string, body string, remoteAddr string, header ...string) (*httptest.ResponseRecorder, models.Response) {
+	request := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+	request.Header.Set(IdempotencyKeyHeader, key)
+	request.RemoteAddr = remoteAddr
+	for i := 0; i+1 < len(header); i += 2 {
+		request.Header.Set(header[i], header[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	var response models.Response
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response
+}
+
+func TestIdempotencyReplaysTheFirstResponse(t *testing.T) {
+	router, runs := idempotentRouter(time.Hour)
+
+	first, _ := idempotentRequest(router, "key-1", `{"amount":1}`, "10.0.0.1:1000")
+	if first.Code != http.StatusCreated || first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("first request = %d, replayed %q, want 201 run", first.Code, first.Header().Get(IdempotentReplayedHeader))
+	}
+	retry, _ := idempotentRequest(router, "key-1", `{"amount":1}`, "10.0.0.1:2000")
+	if retry.Code != http.StatusCreated || retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("retry = %d, replayed %q, want 201 replayed", retry.Code, retry.Header().Get(IdempotentReplayedHeader))
+	}
+	if retry.Body.String() != first.Body.String() || retry.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Errorf("retry body %q (%s), want %q (%s)", retry.Body.String(), retry.Header().Get("Content-Type"),
+			first.Body.String(), first.Header().Get("Content-Type"))
+	}
+	if *runs != 1 {
+		t.Errorf("write ran %d times, want once", *runs)
+	}
+
+	// Requests without a key always run
+	for range 2 {
+		idempotentRequest(router, "", `{"amount":1}`, "10.0.0.1:1000")
+	}
+	if *runs != 3 {
+		t.Errorf("write ran %d times with keyless retries, want 3", *runs)
+	}
+}
+
+func TestIdempotencyRefusesAKeyReusedForAnotherRequest(t *testing.T) {
+	router, runs := idempotentRouter(time.Hour)
+
+	idempotentRequest(router, "key-1", `{"amount":1}`, "10.0.0.1:1000")
+	recorder, response := idempotentRequest(router, "key-1", `{"amount":2}`, "10.0.0.1:1000")
+	if recorder.Code != http.StatusUnprocessableEntity || response.Code != models.ErrCodeIdempotencyKeyReused {
+		t.Errorf("reused key = %d %q, want 422 %s", recorder.Code, response.Code, models.ErrCodeIdempotencyKeyReused)
+	}
+	if *runs != 1 {
+		t.Errorf("write ran %d times, want once", *runs)
+	}
+}
+
+func TestIdempotencyRefusesARetryWhileTheFirstRuns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := services.NewStateIdempotencyStore(nil)
+	router := gin.New()
+	var retry *httptest.ResponseRecorder
+	var response models.Response
+	router.POST("/write", Idempotency(store, time.Hour), func(c *gin.Context) {
+		if retry == nil {
+			retry, response = idempotentRequest(router, "key-1", `{}`, "10.0.0.1:1000")
+		}
+		c.JSON(http.StatusOK, models.Response{Success: true})
+	})
+
+	idempotentRequest(router, "key-1", `{}`, "10.0.0.1:1000")
+	if retry.Code != http.StatusConflict || response.Code != models.ErrCodeIdempotencyInProgress || retry.Header().Get("Retry-After") == "" {
+		t.Errorf("retry in flight = %d %q, Retry-After %q, want 409 %s", retry.Code, response.Code,
+			retry.Header().Get("Retry-After"), models.ErrCodeIdempotencyInProgress)
+	}
+}
+
+func TestIdempotencyRunsAgainOnceTheResponseExpires(t *testing.T) {
+	// A response kept for no time has expired by the retry
+	router, runs := idempotentRouter(-time.Second)
+
+	idempotentRequest(router, "key-1", `{"amount":1}`, "10.0.0.1:1000")
+	retry, _ := idempotentRequest(router, "key-1", `{"amount":1}`, "10.0.0.1:1000")
+	if retry.Code != http.StatusCreated || retry.Header().Get(IdempotentReplayedHeader) != "" || *runs != 2 {
+		t.Errorf("retry after expiry = %d, replayed %q, %d runs, want 201 run again", retry.Code,
+			retry.Header().Get(IdempotentReplayedHeader), *runs)
+	}
+	// Nor does the expired response hold the key against another request
+	reused, _ := idempotentRequest(router, "key-1", `{"amount":2}`, "10.0.0.1:1000")
+	if reused.Code != http.StatusCreated || *runs != 3 {
+		t.Errorf("new request after expiry = %d, %d runs, want 201 run", reused.Code, *runs)
+	}
+}
+
+func TestIdempotencyDoesntKeepServerErrors(t *testing.T) {
+	router, runs := idempotentRouter(time.Hour)
+
+	failed, _ := idempotentRequest(router, "key-1", `{}`, "10.0.0.1:1000", "X-Test-Fail", "1")
+	if failed.Code != http.StatusInternalServerError {
+		t.Fatalf("failing write = %d, want 500", failed.Code)
+	}
+	retry, _ := idempotentRequest(router, "key-1", `{}`, "10.0.0.1:1000")
+	if retry.Code != http.StatusCreated || retry.Header().Get(IdempotentReplayedHeader) != "" || *runs != 2 {
+		t.Errorf("retry after a 500 = %d, replayed %q, %d runs, want 201 run again", retry.Code,
+			retry.Header().Get(IdempotentReplayedHeader), *runs)
+	}
+}
+
+func TestIdempotencyKeysAreScopedToTheClient(t *testing.T) {
+	cases := []struct {
+		name         string
+		first, other []string // remote address, then API key label
+		shared       bool
+	}{
+		{"same API key from another address", []string{"10.0.0.1:1000", "frontend"}, []string{"10.0.0.2:1000", "frontend"}, true},
+		{"another API key", []string{"10.0.0.1:1000", "frontend"}, []string{"10.0.0.1:1000", "indexer"}, false},
+		{"same address without API keys", []string{"10.0.0.1:1000", ""}, []string{"10.0.0.1:2000", ""}, true},
+		{"another address without API keys", []string{"10.0.0.1:1000", ""}, []string{"10.0.0.2:1000", ""}, false},
+	}
+	for _, tc := range cases {
+		router, runs := idempotentRouter(time.Hour)
+		first, _ := idempotentRequest(router, "key-1", `{"amount":1}`, tc.first[0], "X-Test-Label", tc.first[1])
+		other, _ := idempotentRequest(router, "key-1", `{"amount":1}`, tc.other[0], "X-Test-Label", tc.other[1])
+
+		replayed := other.Header().Get(IdempotentReplayedHeader) == "true"
+		if replayed != tc.shared || (*runs == 1) != tc.shared {
+			t.Errorf("%s: replayed %t after %d runs, want shared %t", tc.name, replayed, *runs, tc.shared)
+		}
+		if !tc.shared && other.Body.String() == first.Body.String() {
+			t.Errorf("%s: got the other client's response %q", tc.name, first.Body.String())
+		}
+	}
+}
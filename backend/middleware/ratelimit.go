@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Idle buckets are dropped after this long so one-off clients don't leak memory
+const rateLimitIdleTimeout = 10 * time.Minute
+
+// tokenBucket holds the remaining tokens for one client IP
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimits returns the sustained rate per minute and burst a limiter currently enforces
+type RateLimits func() (perMinute int, burst int)
+
+// RateLimiter is a per-client-IP token bucket limiter
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	limits  RateLimits
+	name    string // Tier name for logs
+}
+
+// NewRateLimiter allows perMinute requests per client IP on average, with bursts of up to burst.
+// limits is asked on every request, so new limits apply without a restart
+// Idle clients are cleaned up in the background until ctx is cancelled
+func NewRateLimiter(ctx context.Context, name string, limits RateLimits) *RateLimiter {
+	limiter := &RateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		limits:  limits,
+		name:    name,
+	}
+	go limiter.cleanup(ctx)
+	return limiter
+}
+
+// Middleware rejects requests over the limit with 429 and a Retry-After header
+// Client IPs come from c.ClientIP, which only honors X-Forwarded-For from trusted proxies
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		allowed, retryAfter := l.take(ip, time.Now())
+		if allowed {
+			c.Next()
+			return
+		}
+
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		fmt.Printf("DEBUG: Rate limited %s on %s (%s tier), retry after %ds\n", ip, c.Request.URL.Path, l.name, seconds)
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, models.Response{
+			Success: false,
+			Error:   "rate limit exceeded",
+			Code:    models.ErrCodeRateLimited,
+		})
+	}
+}
+
+// take consumes a token for the IP, or reports how long until one is available
+func (l *RateLimiter) take(ip string, now time.Time) (bool, time.Duration) {
+	perMinute, maxBurst := l.limits()
+	rate := float64(perMinute) / 60 // Tokens added per second
+	burst := float64(max(maxBurst, 1))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[ip]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, lastSeen: now}
+		l.buckets[ip] = bucket
+	} else {
+		bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*rate)
+		bucket.lastSeen = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	if rate <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+}
+
+// cleanup periodically drops buckets of clients that have gone idle
+func (l *RateLimiter) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for ip, bucket := range l.buckets {
+				if now.Sub(bucket.lastSeen) > rateLimitIdleTimeout {
+					delete(l.buckets, ip)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
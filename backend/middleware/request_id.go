@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader carries the ID that ties a request to its log lines and audit entries
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is the context key holding the request's ID
+	RequestIDKey = "request_id"
+)
+
+// clientRequestID is the shape of a request ID a client may choose for itself
+var clientRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID gives every request an ID, echoed in the X-Request-ID response header. A
+// well-formed X-Request-ID sent by the client (or a proxy in front of us) is kept;
+// otherwise a random one is generated
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !clientRequestID.MatchString(id) {
+			raw := make([]byte, 16)
+			rand.Read(raw)
+			id = hex.EncodeToString(raw)
+		}
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
@@ -1,69 +1,863 @@
 package models
 
+import "encoding/json"
+
 // Request models
 type InitializeUserRequest struct {
-	AccountAddress string `json:"account_address" binding:"required"`
+	AccountAddress string `json:"account_address" binding:"required,aptos_address"`
 }
 
 type SubmitDataRequest struct {
 	PrivateKey string `json:"private_key" binding:"required"`
-	DataHash   string `json:"data_hash" binding:"required"`
+	DataHash   string `json:"data_hash" binding:"required,hexhash"`
 	Metadata   string `json:"metadata"`
 }
 
 type DeleteDatasetRequest struct {
-	PrivateKey string `json:"private_key" binding:"required"`
-	DatasetID  uint64 `json:"dataset_id" binding:"required"`
+	PrivateKey string  `json:"private_key" binding:"required"`
+	DatasetID  *uint64 `json:"dataset_id" binding:"required"`
+}
+
+type ReactivateDatasetRequest struct {
+	PrivateKey string  `json:"private_key" binding:"required"`
+	DatasetID  *uint64 `json:"dataset_id" binding:"required"`
 }
 
 type GrantAccessRequest struct {
-	PrivateKey string `json:"private_key" binding:"required"`
-	DatasetID  uint64 `json:"dataset_id" binding:"required"`
-	Requester  string `json:"requester" binding:"required"`
-	ExpiresAt  uint64 `json:"expires_at" binding:"required"`
+	PrivateKey string  `json:"private_key" binding:"required"`
+	DatasetID  *uint64 `json:"dataset_id" binding:"required"`
+	Requester  string  `json:"requester" binding:"required,aptos_address"`
+	ExpiresAt  *uint64 `json:"expires_at" binding:"required,deadline"` // Unix seconds, still to come; 0 never expires
+
+	// When given, a server-encrypted dataset's data key is wrapped for this key (hex) so the
+	// requester can decrypt the blob themselves; see /access/wrapped-key
+	RequesterPublicKey string `json:"requester_public_key"`
+	RequesterKeyType   string `json:"requester_key_type" binding:"omitempty,oneof=ed25519 x25519"` // Default ed25519
+
+	// When given, the requester may only read these columns (header names, case-insensitive).
+	// A later grant without columns lifts the restriction
+	Columns []string `json:"columns" binding:"omitempty,dive,required"`
 }
 
 type RevokeAccessRequest struct {
-	PrivateKey string `json:"private_key" binding:"required"`
-	DatasetID  uint64 `json:"dataset_id" binding:"required"`
-	Requester  string `json:"requester" binding:"required"`
+	PrivateKey string  `json:"private_key" binding:"required"`
+	DatasetID  *uint64 `json:"dataset_id" binding:"required"`
+	Requester  string  `json:"requester" binding:"required,aptos_address"`
+}
+
+type WrappedKeyRequest struct {
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
+	Requester string  `json:"requester" binding:"required,aptos_address"`
+	DataAccessProof
+}
+
+// ListAllGrantsRequest lists every grant an owner has issued, optionally narrowed down
+type ListAllGrantsRequest struct {
+	Owner     string `json:"owner" binding:"required,aptos_address"`
+	Requester string `json:"requester" binding:"omitempty,aptos_address"`
+	Status    string `json:"status" binding:"omitempty,oneof=active expired"` // Only active or only expired grants
 }
 
 type CheckAccessRequest struct {
-	Owner     string `json:"owner" binding:"required"`
-	DatasetID uint64 `json:"dataset_id" binding:"required"`
-	Requester string `json:"requester" binding:"required"`
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
+	Requester string  `json:"requester" binding:"required,aptos_address"`
+}
+
+// EscrowDepositRequest puts APT in escrow for access to an owner's dataset, signed by the requester
+type EscrowDepositRequest struct {
+	PrivateKey string  `json:"private_key" binding:"required"`
+	Owner      string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID  *uint64 `json:"dataset_id" binding:"required"`
+	Amount     uint64  `json:"amount" binding:"required,gt=0"` // Octas
+}
+
+// EscrowReleaseRequest pays a requester's deposit out to the owner and grants the requester
+// access until expires_at, signed by the owner
+type EscrowReleaseRequest struct {
+	PrivateKey string  `json:"private_key" binding:"required"`
+	Requester  string  `json:"requester" binding:"required,aptos_address"`
+	DatasetID  *uint64 `json:"dataset_id" binding:"required"`
+	ExpiresAt  uint64  `json:"expires_at" binding:"deadline"` // Unix seconds, still to come; 0 never expires
+}
+
+// EscrowRefundRequest gives a deposit the owner hasn't released back to the requester, signed by the requester
+type EscrowRefundRequest struct {
+	PrivateKey string  `json:"private_key" binding:"required"`
+	Owner      string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID  *uint64 `json:"dataset_id" binding:"required"`
+}
+
+type EscrowBalanceRequest struct {
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
+	Requester string  `json:"requester" binding:"required,aptos_address"`
 }
 
 type RegisterTokenRequest struct {
 	PrivateKey string `json:"private_key" binding:"required"`
 }
 
+type TokenRegistrationRequest struct {
+	Address string `json:"address" binding:"required,aptos_address"`
+}
+
 type MintTokenRequest struct {
 	PrivateKey string `json:"private_key" binding:"required"`
-	Recipient  string `json:"recipient" binding:"required"`
+	Recipient  string `json:"recipient" binding:"required,aptos_address"`
 	Amount     uint64 `json:"amount" binding:"required"`
+
+	// With AutoRegister an unregistered recipient is registered first, paid for by the sponsor
+	// account. The recipient co-signs: the first call answers 409 RECIPIENT_SIGNATURE_REQUIRED
+	// with the registration, and the retry sends it back with the wallet's authenticator
+	AutoRegister           bool   `json:"auto_register"`
+	RegisterTransaction    string `json:"register_transaction,omitempty"`                                                // raw_transaction of the SponsoredTransaction, as returned
+	RecipientAuthenticator string `json:"recipient_authenticator,omitempty" binding:"required_with=RegisterTransaction"` // BCS hex of the recipient wallet's AccountAuthenticator for it
+}
+
+// SponsoredTransaction is a transaction whose gas the sponsor account pays, handed to its
+// sender's wallet to sign before the backend adds the sponsor's signature and submits it
+type SponsoredTransaction struct {
+	RawTransaction string `json:"raw_transaction"` // BCS hex, as the TypeScript SDK's SimpleTransaction (fee payer included)
+	Sender         string `json:"sender"`
+	FeePayer       string `json:"fee_payer"`
+	ExpiresAt      int64  `json:"expires_at"` // Unix seconds; the signed transaction must be sent back before then
+}
+
+// MintTokenResponse is the mint transaction and, when the recipient was registered in the same
+// call, the registration transaction
+type MintTokenResponse struct {
+	Hash         string `json:"hash,omitempty"`
+	RegisterHash string `json:"register_hash,omitempty"`
+	Success      bool   `json:"success"`
+	Message      string `json:"message,omitempty"`
+}
+
+// TokenRegistration reports whether an account can receive the DataX token
+type TokenRegistration struct {
+	Address    string `json:"address"`
+	Registered bool   `json:"registered"`
+}
+
+// TokenInfo describes the DataX token, the coin data_token initializes
+type TokenInfo struct {
+	CoinType string  `json:"coin_type"` // {module address}::data_token::DataToken
+	Name     string  `json:"name"`
+	Symbol   string  `json:"symbol"`
+	Decimals uint8   `json:"decimals"`
+	Supply   *string `json:"supply"`           // Total minted less burned, in base units as a decimal string; null when the coin doesn't track supply
+	Minter   string  `json:"minter,omitempty"` // Account holding the mint capability (managed_coin::Capabilities); empty when none does
 }
 
 type GetDatasetRequest struct {
-	User      string `json:"user" binding:"required"`
-	DatasetID uint64 `json:"dataset_id" binding:"required"`
+	User      string  `json:"user" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
 }
 
 type GetUserVaultRequest struct {
-	User string `json:"user" binding:"required"`
+	User string `json:"user" binding:"required,aptos_address"`
 }
 
 type CheckInitializationRequest struct {
-	User string `json:"user" binding:"required"`
+	User string `json:"user" binding:"required,aptos_address"`
+}
+
+type AuthChallengeRequest struct {
+	Address string `json:"address" binding:"required,aptos_address"`
+}
+
+// WalletSignature proves the caller controls an address: the wallet signs a message
+// containing a nonce from /auth/challenge
+type WalletSignature struct {
+	Nonce         string `json:"nonce" binding:"required"`
+	SignedMessage string `json:"signed_message" binding:"required"` // Exact text the wallet signed
+	PublicKey     string `json:"public_key" binding:"required"`     // Ed25519 public key (hex)
+	Signature     string `json:"signature" binding:"required"`      // Ed25519 signature (hex)
+}
+
+// DataAccessProof is how a data read proves the requester may read the dataset: a wallet
+// signature, or the access token returned by an earlier read that was proven with one
+type DataAccessProof struct {
+	Nonce         string `json:"nonce" binding:"required_without=AccessToken"`
+	SignedMessage string `json:"signed_message" binding:"required_without=AccessToken"` // Exact text the wallet signed
+	PublicKey     string `json:"public_key" binding:"required_without=AccessToken"`     // Ed25519 public key (hex)
+	Signature     string `json:"signature" binding:"required_without=AccessToken"`      // Ed25519 signature (hex)
+	AccessToken   string `json:"access_token,omitempty"`                                // From the X-Access-Token header of an earlier read
+}
+
+// WalletSignature returns the signature part of the proof
+func (p DataAccessProof) WalletSignature() WalletSignature {
+	return WalletSignature{Nonce: p.Nonce, SignedMessage: p.SignedMessage, PublicKey: p.PublicKey, Signature: p.Signature}
+}
+
+// DatasetMetadata is the documented schema for the metadata string stored with a dataset:
+//
+//	{"name": "...", "description": "...", "category": "...", "tags": ["..."], "price_apt": 1.5,
+//	 "license": "CC-BY-4.0", "encryption_algorithm": "AES-256-GCM", "pii_flags": ["email"],
+//	 "sample_enabled": true, "sample_rows": 10, "aggregates_enabled": true}
+//
+// New metadata must pass services.DatasetMetadataSchema, which requires name and
+// description. Metadata already on chain is read as it is: every field may be missing, and
+// metadata that isn't a JSON object predates the schema and is reported in the
+// "uncategorized" category.
+type DatasetMetadata struct {
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Category    string   `json:"category,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	PriceAPT    *float64 `json:"price_apt,omitempty"`
+	License     string   `json:"license,omitempty"`
+
+	EncryptionAlgorithm string   `json:"encryption_algorithm,omitempty"` // Copied from the upload response when the data is encrypted at rest
+	PIIFlags            []string `json:"pii_flags,omitempty"`            // Copied from the upload response; detectors that flagged a column
+
+	SampleEnabled bool `json:"sample_enabled,omitempty"` // The owner lets anyone fetch a sample from /data/sample
+	SampleRows    int  `json:"sample_rows,omitempty"`    // Rows in that sample; 0 or more than SAMPLE_MAX_ROWS means SAMPLE_MAX_ROWS
+
+	AggregatesEnabled bool `json:"aggregates_enabled,omitempty"` // The owner lets anyone run /data/aggregate, without access
+}
+
+// MarketplaceFilter narrows the marketplace listing; zero values mean "no filter"
+type MarketplaceFilter struct {
+	Query           string   // Keyword search over metadata and owner prefix
+	Owner           string   // Owner address
+	CreatedAfter    uint64   // Unix seconds, inclusive
+	CreatedBefore   uint64   // Unix seconds, inclusive
+	IncludeInactive bool     // Include deleted (is_active=false) datasets
+	Limit           int      // Page size; 0 returns every matching dataset
+	Cursor          string   // Opaque cursor from a previous page's next_cursor
+	Category        string   // Metadata category, case-insensitive ("uncategorized" matches pre-schema metadata)
+	Tags            []string // Metadata tags, case-insensitive; a dataset must carry all of them
+}
+
+// DatasetRef identifies a dataset on chain
+type DatasetRef struct {
+	Owner     string `json:"owner"`
+	DatasetID uint64 `json:"dataset_id"`
+}
+
+// Webhook event types
+const (
+	WebhookEventAccessRequested = "access.requested"
+	WebhookEventAccessGranted   = "access.granted"
+)
+
+// Webhook is an owner's endpoint notified of events on their datasets. The secret keys the
+// HMAC-SHA256 signature of each payload and is never returned after registration
+type Webhook struct {
+	ID         string            `json:"id"`
+	Owner      string            `json:"owner"`
+	URL        string            `json:"url"`
+	Secret     string            `json:"secret,omitempty"`
+	Events     []string          `json:"events"`
+	CreatedAt  int64             `json:"created_at"`
+	Deliveries []WebhookDelivery `json:"deliveries,omitempty"` // Most recent first, capped
+}
+
+// WebhookDelivery records one attempt to deliver an event
+type WebhookDelivery struct {
+	DeliveryID  string `json:"delivery_id"` // Shared by the retries of one event
+	Event       string `json:"event"`
+	Attempt     int    `json:"attempt"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Success     bool   `json:"success"`
+	AttemptedAt int64  `json:"attempted_at"`
+}
+
+// WebhookEvent is the JSON body POSTed to a webhook
+type WebhookEvent struct {
+	DeliveryID string      `json:"delivery_id"`
+	Event      string      `json:"event"`
+	Owner      string      `json:"owner"`
+	CreatedAt  int64       `json:"created_at"`
+	Data       interface{} `json:"data"`
+}
+
+// RegisterWebhookRequest registers a webhook; the owner proves control of the address
+// with a wallet signature
+type RegisterWebhookRequest struct {
+	Owner  string   `json:"owner" binding:"required,aptos_address"`
+	URL    string   `json:"url" binding:"required,url"`
+	Secret string   `json:"secret" binding:"required,min=16"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=access.requested access.granted"`
+	WalletSignature
+}
+
+// WebhookOwnerRequest lists an owner's webhooks, or deletes or inspects one of them by ID
+type WebhookOwnerRequest struct {
+	Owner string `json:"owner" binding:"required,aptos_address"`
+	ID    string `json:"id"`
+	WalletSignature
+}
+
+// MarketplacePage is a page of marketplace datasets plus summary metadata about the listing
+type MarketplacePage struct {
+	Datasets        []interface{} `json:"datasets"`
+	NextCursor      string        `json:"next_cursor,omitempty"`
+	TotalCount      int           `json:"total_count"`       // Datasets matching the filter across all pages
+	TotalDatasets   int           `json:"total_datasets"`    // Active datasets in the listing, whatever the search, category, tag or date filters
+	UniqueOwners    int           `json:"unique_owners"`     // Distinct providers among those datasets
+	LastRefreshedAt string        `json:"last_refreshed_at"` // When the underlying snapshot was assembled (RFC3339)
+	Source          string        `json:"source"`            // "indexer", "blockchain", or "indexer+blockchain"
+	Partial         bool          `json:"partial,omitempty"` // Some owners' datasets are missing: their DataStores couldn't be read within MARKETPLACE_TIMEOUT
+}
+
+// DiscoveryCheckpoint is the persisted progress of the submit_data transaction scanner
+type DiscoveryCheckpoint struct {
+	LastScannedVersion uint64   `json:"last_scanned_version"`       // Highest transaction version already scanned
+	SkippedVersions    uint64   `json:"skipped_versions,omitempty"` // Versions jumped over to keep up with the ledger tip
+	Users              []string `json:"users"`                      // Every submitter found so far
+	UpdatedAt          string   `json:"updated_at,omitempty"`       // RFC3339
+}
+
+// ConfigReload reports what a configuration reload changed
+type ConfigReload struct {
+	Changed []string `json:"changed"` // Runtime-tunable settings now in effect with new values
+	Ignored []string `json:"ignored"` // Settings that changed but need a restart, left as they were
+}
+
+// Reward ledger entry statuses
+const (
+	RewardPending     = "pending"     // Claimed and being minted
+	RewardMinted      = "minted"      // Minted in TransactionHash
+	RewardSkipped     = "skipped"     // Not rewarded, see Reason
+	RewardRetrying    = "retrying"    // The mint failed and is tried again at RetryAt
+	RewardFailed      = "failed"      // Every mint attempt failed; it is not retried
+	RewardInterrupted = "interrupted" // The server stopped while minting; check the minter's transactions before paying by hand
+)
+
+// RewardEntry is what the reward worker did with one DataSubmitted event
+type RewardEntry struct {
+	Version         uint64 `json:"version"`     // Transaction of the DataSubmitted event
+	EventIndex      int    `json:"event_index"` // Position among the transaction's indexed events
+	Owner           string `json:"owner"`
+	DatasetID       uint64 `json:"dataset_id"`
+	Amount          uint64 `json:"amount"` // Base units minted, or that would have been
+	Status          string `json:"status"`
+	Reason          string `json:"reason,omitempty"`
+	TransactionHash string `json:"transaction_hash,omitempty"`
+	CreatedAt       int64  `json:"created_at"`
+	Attempts        int    `json:"attempts,omitempty"` // Mints submitted for it so far
+	RetryAt         int64  `json:"retry_at,omitempty"` // When a retrying mint is next tried
+}
+
+// RewardLedger is the reward worker's state and its latest entries, newest first
+type RewardLedger struct {
+	Paused      bool              `json:"paused"`
+	Version     uint64            `json:"version"`      // Events up to this transaction have been handled
+	EventIndex  int               `json:"event_index"`  // and up to this event within it
+	Day         string            `json:"day"`          // UTC date DailyTotals count
+	DailyTotals map[string]uint64 `json:"daily_totals"` // Base units rewarded today, by address
+	Entries     []RewardEntry     `json:"entries"`
+}
+
+type PauseRewardsRequest struct {
+	Paused *bool `json:"paused" binding:"required"`
+}
+
+// EventIndexStatus reports how far the local event index has read the chain
+type EventIndexStatus struct {
+	Source        string `json:"source"`               // SOURCE: remote or local
+	Version       uint64 `json:"version"`              // Last transaction version indexed
+	LedgerVersion uint64 `json:"ledger_version"`       // Ledger tip at the last poll
+	Lag           uint64 `json:"lag"`                  // Versions the index trails the ledger
+	UpdatedAt     string `json:"updated_at,omitempty"` // RFC3339 time of the last poll
+	Ready         bool   `json:"ready"`                // Reads are served from the index
+}
+
+// IndexerStatus reports the GraphQL indexer requests made since startup
+type IndexerStatus struct {
+	Requests      uint64 `json:"requests"`
+	Failures      uint64 `json:"failures"`       // Transport errors and 5xx responses
+	AvgLatencyMs  int64  `json:"avg_latency_ms"` // Until the response headers arrived
+	LastLatencyMs int64  `json:"last_latency_ms"`
+	LastRequestAt string `json:"last_request_at,omitempty"` // RFC3339
+}
+
+// Devnet bootstrap states
+const (
+	DevnetDisabled = "disabled" // DEVNET_BOOTSTRAP is off
+	DevnetSkipped  = "skipped"  // Not a local node, see Reason; nothing was changed
+	DevnetReady    = "ready"    // The deployer is funded and, with a package path, the package published
+)
+
+// DevnetStatus is what the local devnet bootstrap did at startup
+type DevnetStatus struct {
+	Status                 string `json:"status"`
+	Reason                 string `json:"reason,omitempty"`
+	NodeURL                string `json:"node_url,omitempty"`
+	FaucetURL              string `json:"faucet_url,omitempty"`
+	ChainID                uint8  `json:"chain_id,omitempty"`
+	DeployerAddress        string `json:"deployer_address,omitempty"`
+	FundedOctas            uint64 `json:"funded_octas,omitempty"`
+	Published              bool   `json:"published"`
+	PublishTransactionHash string `json:"publish_transaction_hash,omitempty"`
+	DataXModuleAddr        string `json:"datax_module_addr,omitempty"` // Module addresses in effect
+	NetworkModuleAddr      string `json:"network_module_addr,omitempty"`
+	EscrowModuleAddr       string `json:"escrow_module_addr,omitempty"`
+	SponsorAddress         string `json:"sponsor_address,omitempty"` // Set when the deployer pays for sponsored transactions
+	CompletedAt            string `json:"completed_at,omitempty"`    // RFC3339
+}
+
+// CSVViolation is one structural problem found while validating an uploaded CSV
+type CSVViolation struct {
+	Row     int    `json:"row"`              // 1-based record number, header is row 1; 0 for file-level problems
+	Column  string `json:"column,omitempty"` // Column name or 1-based position when the problem is column-specific
+	Message string `json:"message"`
+}
+
+// CSVValidationReport is the result of validating an uploaded CSV
+type CSVValidationReport struct {
+	Valid       bool           `json:"valid"`
+	RowCount    int            `json:"row_count"` // Data rows, excluding the header
+	ColumnCount int            `json:"column_count"`
+	Columns     []string       `json:"columns"`
+	Violations  []CSVViolation `json:"violations"`
+	Truncated   bool           `json:"truncated,omitempty"` // Validation stopped after too many violations
+	Delimiter   string         `json:"delimiter,omitempty"` // Field separator the file was read with
+}
+
+// CSVStats are aggregate statistics computed while a CSV is uploaded, stored next to its blob
+type CSVStats struct {
+	DataHash    string        `json:"data_hash"`
+	BlobName    string        `json:"blob_name"`
+	RowCount    int           `json:"row_count"`
+	ColumnCount int           `json:"column_count"`
+	Columns     []ColumnStats `json:"columns"`
+	ComputedAt  string        `json:"computed_at"`   // RFC3339
+	PII         *PIIReport    `json:"pii,omitempty"` // Absent when PII_SCAN_ENABLED was off
+}
+
+// ColumnStats summarises one CSV column; numeric fields are set only when every non-null value is a number
+type ColumnStats struct {
+	Name           string   `json:"name"`
+	NullCount      int      `json:"null_count"`
+	NullPercent    float64  `json:"null_percent"`
+	Numeric        bool     `json:"numeric"`
+	Min            *float64 `json:"min,omitempty"`
+	Max            *float64 `json:"max,omitempty"`
+	Mean           *float64 `json:"mean,omitempty"`
+	DistinctCount  int      `json:"distinct_count"`
+	DistinctCapped bool     `json:"distinct_capped,omitempty"` // Tracking stopped at the cardinality limit; the true count is higher
+}
+
+// PIIReport is the advisory result of scanning sampled rows for personal data. Only columns
+// with at least one match are listed
+type PIIReport struct {
+	SampledRows int         `json:"sampled_rows"`
+	FlagPercent float64     `json:"flag_percent"` // Match rate at which a finding is flagged
+	Columns     []PIIColumn `json:"columns"`
+	Flags       []string    `json:"flags"` // Detectors that flagged any column, sorted
+}
+
+type PIIColumn struct {
+	Name     string       `json:"name"`
+	Findings []PIIFinding `json:"findings"`
+}
+
+// PIIFinding is one detector's matches in a column. Examples are redacted to their last
+// two letters or digits
+type PIIFinding struct {
+	Detector     string   `json:"detector"`
+	Matches      int      `json:"matches"`
+	MatchPercent float64  `json:"match_percent"` // Of the column's non-null sampled values
+	Flagged      bool     `json:"flagged"`
+	Examples     []string `json:"examples"`
+}
+
+type GetCSVStatsRequest struct {
+	Owner    string `json:"owner" binding:"required,aptos_address"`
+	DataHash string `json:"data_hash" binding:"required,hexhash"`
+}
+
+// CheckDataHashRequest asks whether a data hash is registered, by anyone or only by owner
+type CheckDataHashRequest struct {
+	DataHash string `json:"data_hash" binding:"required,hexhash"`
+	Owner    string `json:"owner" binding:"omitempty,aptos_address"` // Only look at this owner's datasets
+}
+
+// GetCSVDataRequest reads a dataset's rows; the requester must be the owner or hold access,
+// proven with a wallet signature
+type GetCSVDataRequest struct {
+	DataHash  string   `json:"data_hash" binding:"required,hexhash"`
+	Owner     string   `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64  `json:"dataset_id" binding:"required"`
+	Requester string   `json:"requester" binding:"required,aptos_address"`
+	Offset    *int     `json:"offset" binding:"omitempty,min=0"` // First data row to return (0-based, header excluded)
+	Limit     *int     `json:"limit" binding:"omitempty,min=0"`  // Data rows to return; all remaining when omitted
+	Columns   []string `json:"columns"`                          // Header names to keep, in this order (case-insensitive)
+	Format    string   `json:"format" binding:"omitempty,oneof=rows records"`
+	// server decrypts with the wrapped data key, client returns the ciphertext as stored,
+	// provided_key decrypts with decryption_key. Defaults to the mode the blob was stored under
+	Decryption    string `json:"decryption" binding:"omitempty,oneof=server client provided_key"`
+	DecryptionKey string `json:"decryption_key"` // 256-bit data key as hex or base64, for provided_key
+	DataAccessProof
+}
+
+// PreviewCSVRequest asks for the header and first rows of a dataset; the requester
+// must be the owner or hold access, proven with a wallet signature
+type PreviewCSVRequest struct {
+	DataHash  string  `json:"data_hash" binding:"required,hexhash"`
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
+	Requester string  `json:"requester" binding:"required,aptos_address"`
+	Limit     int     `json:"limit"` // Data rows to return; default 20, max 100
+	DataAccessProof
+}
+
+// EncryptionInfoRequest asks for what's needed to decrypt a dataset locally, subject to the
+// same access check as GetCSVData
+type EncryptionInfoRequest struct {
+	DataHash  string  `json:"data_hash" binding:"required,hexhash"`
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
+	Requester string  `json:"requester" binding:"required,aptos_address"`
+	DataAccessProof
+}
+
+// EncryptedCSVRequest downloads a dataset's ciphertext as stored, subject to the same access
+// check as GetCSVData
+type EncryptedCSVRequest struct {
+	DataHash  string  `json:"data_hash" binding:"required,hexhash"`
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
+	Requester string  `json:"requester" binding:"required,aptos_address"`
+	DataAccessProof
+}
+
+// ExportDataRequest downloads a whole dataset as a file, subject to the same access check as GetCSVData
+type ExportDataRequest struct {
+	DataHash  string  `json:"data_hash" binding:"required,hexhash"`
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
+	Requester string  `json:"requester" binding:"required,aptos_address"`
+	Format    string  `json:"format" binding:"required,oneof=parquet csv jsonl"`
+	DataAccessProof
+}
+
+type CSVPreview struct {
+	Header  []string   `json:"header"`
+	Rows    [][]string `json:"rows"`
+	HasMore bool       `json:"has_more"` // The dataset has rows beyond this preview
+
+	WithheldColumns []string `json:"withheld_columns,omitempty"` // Left out because the requester's grant doesn't cover them
+}
+
+// SampleRequest asks for a dataset's public sample. No access is needed, but the owner must
+// have turned sampling on in the dataset's metadata
+type SampleRequest struct {
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
+	Rows      int     `json:"rows" binding:"min=0"` // Rows wanted; never more than the dataset's sample_rows or SAMPLE_MAX_ROWS
+}
+
+// CSVSample is a fixed pseudo-random selection of a dataset's rows, in their original order.
+// Repeat requests get the same rows, so asking again reveals nothing more
+type CSVSample struct {
+	Sample    bool       `json:"sample"` // Always true: these rows are a sample, not access to the dataset
+	Header    []string   `json:"header"`
+	Rows      [][]string `json:"rows"`
+	TotalRows int        `json:"total_rows"` // Data rows in the whole dataset
+
+	WithheldColumns []string `json:"withheld_columns,omitempty"` // Left out because they were flagged as personal data
+}
+
+// AggregateRequest asks for an aggregate of a dataset's rows instead of the rows. It needs
+// the access proof of GetCSVData, unless the owner set aggregates_enabled in the metadata
+type AggregateRequest struct {
+	Owner     string           `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64          `json:"dataset_id" binding:"required"`
+	Requester string           `json:"requester" binding:"omitempty,aptos_address"`
+	GroupBy   string           `json:"group_by"`                                        // Column to group rows by; omitted aggregates every row as one group
+	Column    string           `json:"column" binding:"required_unless=Function count"` // Column aggregated; count without one counts rows
+	Function  string           `json:"function" binding:"required,oneof=count sum avg min max"`
+	Filter    *AggregateFilter `json:"filter"` // Only rows matching it are aggregated
+	*DataAccessProof
+}
+
+// AggregateFilter keeps the rows whose value in Column equals Value exactly, after trimming
+type AggregateFilter struct {
+	Column string `json:"column" binding:"required"`
+	Value  string `json:"value"`
+}
+
+// AggregateResult answers POST /api/v1/data/aggregate. Groups with fewer than MinGroupSize
+// rows are left out and only counted in SuppressedGroups
+type AggregateResult struct {
+	GroupBy          string           `json:"group_by,omitempty"`
+	Column           string           `json:"column,omitempty"`
+	Function         string           `json:"function"`
+	Groups           []AggregateGroup `json:"groups"`
+	SuppressedGroups int              `json:"suppressed_groups"`
+	MinGroupSize     int              `json:"min_group_size"`
+	RowsScanned      int              `json:"rows_scanned"` // Data rows in the dataset
+}
+
+// AggregateGroup is one row of an aggregate table. Empty and null values of the group_by column
+// are grouped under the key ""
+type AggregateGroup struct {
+	Key    string   `json:"key"`
+	Rows   int      `json:"rows"`
+	Values int      `json:"values"` // Values aggregated: non-null ones for count, numeric ones otherwise
+	Value  *float64 `json:"value"`  // Null for avg, min and max of a group without numeric values
+}
+
+// BlobManifestEntry records where a dataset's CSV was stored when it was uploaded
+type BlobManifestEntry struct {
+	BlobName   string `json:"blob_name"`
+	UploadedAt int64  `json:"uploaded_at"` // Unix seconds
+	Size       int64  `json:"size"`        // Bytes stored
+	Encrypted  bool   `json:"encrypted"`
+	KeyID      string `json:"key_id,omitempty"`     // Master key that wrapped the data key of a server-encrypted blob
+	Pending    bool   `json:"pending,omitempty"`    // Presigned upload not yet finalized; Size is the declared size
+	ExpiresAt  int64  `json:"expires_at,omitempty"` // Unix seconds after which a pending upload may be purged
+	Verified   bool   `json:"verified,omitempty"`   // The blob's bytes were hashed and gave this data hash
+
+	LegacyBlobNames []string      `json:"legacy_blob_names,omitempty"` // Older blobs with the same data, e.g. timestamp-named copies
+	Metadata        *BlobMetadata `json:"metadata,omitempty"`
+}
+
+// BlobMetadata describes the dataset inside a blob, so owners can tell blobs apart without
+// downloading them. It is recorded once the upload has been parsed
+type BlobMetadata struct {
+	RowCount          int    `json:"row_count"`
+	ColumnCount       int    `json:"column_count"`
+	PlaintextSize     int64  `json:"plaintext_size"`               // Bytes of CSV before any encryption
+	SchemaFingerprint string `json:"schema_fingerprint,omitempty"` // SHA-256 of the column layout
+	DataHash          string `json:"data_hash,omitempty"`          // Data hash the upload was registered under
+}
+
+// GranteeKey is a dataset's data key wrapped for one requester's X25519 key when access was
+// granted, stored as {owner}/grants/{dataset_id}_{requester}.json. With it and their private
+// key the requester can decrypt the blob downloaded from a presigned URL
+type GranteeKey struct {
+	DatasetID          uint64 `json:"dataset_id"`
+	Requester          string `json:"requester"`
+	BlobName           string `json:"blob_name"`            // The blob whose data key was wrapped
+	Algorithm          string `json:"algorithm"`            // How the data key is wrapped: X25519-HKDF-SHA256-AES-256-GCM
+	RecipientPublicKey string `json:"recipient_public_key"` // X25519, hex
+	EphemeralPublicKey string `json:"ephemeral_public_key"` // X25519, hex
+	Nonce              string `json:"nonce"`                // base64 nonce the data key was wrapped with
+	WrappedKey         string `json:"wrapped_key"`          // base64
+	DataAlgorithm      string `json:"data_algorithm"`       // How the blob itself is encrypted
+	DataNonce          string `json:"data_nonce"`           // base64 nonce the blob was encrypted with
+	CreatedAt          int64  `json:"created_at"`           // Unix seconds
+}
+
+// ColumnGrant limits a grant to some of a dataset's columns, stored as
+// {owner}/grants/{dataset_id}_{requester}.columns.json. Grants without one cover every column
+type ColumnGrant struct {
+	DatasetID uint64   `json:"dataset_id"`
+	Requester string   `json:"requester"`
+	Columns   []string `json:"columns"`    // Header names, matched case-insensitively
+	CreatedAt int64    `json:"created_at"` // Unix seconds
+}
+
+// BlobManifest is an owner's {owner}/manifest.json, keyed by normalized data hash ("0x" + lowercase hex)
+// Pending presigned uploads are keyed "pending:{upload_id}" until finalized
+type BlobManifest map[string]BlobManifestEntry
+
+// BlobInfo describes a stored dataset object
+type BlobInfo struct {
+	Name         string   `json:"name"`
+	Size         int64    `json:"size"`
+	LastModified int64    `json:"last_modified"` // Unix seconds
+	Encrypted    bool     `json:"encrypted"`
+	DatasetIDs   []uint64 `json:"dataset_ids,omitempty"` // Active on-chain datasets backed by the blob (set by /storage/list)
+	Orphan       bool     `json:"orphan"`                // Not linked to any active on-chain dataset (set by /storage/list)
+
+	Metadata *BlobMetadata `json:"metadata,omitempty"` // From the owner's manifest; absent for blobs stored before it was recorded
+}
+
+type UploadURLRequest struct {
+	AccountAddress string `json:"account_address" binding:"required,aptos_address"`
+	Size           int64  `json:"size" binding:"required,min=1"` // Exact byte size of the file to be PUT
+	ContentType    string `json:"content_type" binding:"required"`
+	WalletSignature
+}
+
+type FinalizeUploadRequest struct {
+	AccountAddress string          `json:"account_address" binding:"required,aptos_address"`
+	UploadID       string          `json:"upload_id" binding:"required"`
+	DataHash       string          `json:"data_hash" binding:"omitempty,hexhash"` // Optional client hash, checked against the computed one
+	Metadata       json.RawMessage `json:"metadata,omitempty"`                    // Optional dataset metadata to be submitted on chain, checked against its schema first
+	WalletSignature
+}
+
+// ValidateMetadataRequest carries dataset metadata, as a JSON object or the string to be
+// submitted on chain
+type ValidateMetadataRequest struct {
+	Metadata json.RawMessage `json:"metadata" binding:"required"`
+}
+
+type DownloadURLRequest struct {
+	DataHash   string  `json:"data_hash" binding:"required,hexhash"`
+	Owner      string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID  *uint64 `json:"dataset_id" binding:"required"`
+	Requester  string  `json:"requester" binding:"required,aptos_address"`
+	TTLSeconds int     `json:"ttl_seconds" binding:"omitempty,min=1"` // Capped by PRESIGN_MAX_TTL
+	DataAccessProof
+}
+
+type ListBlobsRequest struct {
+	Owner string `json:"owner" binding:"required,aptos_address"`
+	WalletSignature
+}
+
+type DeleteBlobRequest struct {
+	Owner    string `json:"owner" binding:"required,aptos_address"`
+	BlobName string `json:"blob_name" binding:"required"`
+	Force    bool   `json:"force"` // Delete even if the blob backs an active on-chain dataset
+	WalletSignature
+}
+
+type BackfillManifestRequest struct {
+	Owner string `json:"owner" binding:"required,aptos_address"`
+}
+
+type MigrateEncryptionRequest struct {
+	Owner string `json:"owner" binding:"required,aptos_address"`
+}
+
+// CSVPage is a window of a dataset's rows returned by GetCSVData when offset or limit is given
+type CSVPage struct {
+	Header    []string    `json:"header"`
+	Rows      interface{} `json:"rows"`       // [][]string, or objects keyed by header for the "records" format
+	TotalRows int         `json:"total_rows"` // Data rows in the whole dataset, header excluded
+	Offset    int         `json:"offset"`
+	Limit     int         `json:"limit"`
+
+	WithheldColumns []string `json:"withheld_columns,omitempty"` // Left out because the requester's grant doesn't cover them
 }
 
 // Response models
 type Response struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success bool         `json:"success"`
+	Message string       `json:"message,omitempty"`
+	Data    interface{}  `json:"data,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Code    string       `json:"code,omitempty"`    // Machine-readable error code (see ErrCode constants)
+	Details []FieldError `json:"details,omitempty"` // Per-field problems with a VALIDATION_FAILED request or METADATA_INVALID metadata
+}
+
+// FieldError is one request field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`   // JSON name, dotted for nested fields
+	Rule    string `json:"rule"`    // Binding rule or JSON Schema keyword that failed, e.g. required, oneof, aptos_address, or type
+	Message string `json:"message"` // Readable sentence naming the field
+}
+
+// Error codes returned in Response.Code
+const (
+	ErrCodeValidationFailed  = "VALIDATION_FAILED"
+	ErrCodeUnauthorized      = "UNAUTHORIZED"
+	ErrCodeInvalidSignature  = "INVALID_SIGNATURE"
+	ErrCodeRateLimited       = "RATE_LIMITED"
+	ErrCodeInvalidCSV        = "INVALID_CSV"
+	ErrCodeBlobNotFound      = "BLOB_NOT_FOUND"
+	ErrCodeIntegrityMismatch = "INTEGRITY_MISMATCH"
+	ErrCodeDataHashMismatch  = "DATA_HASH_MISMATCH"
+	ErrCodeBlobInUse         = "BLOB_IN_USE"
+	ErrCodeDatasetInactive   = "DATASET_INACTIVE"
+	ErrCodeUploadExpired     = "UPLOAD_EXPIRED"
+	ErrCodeDatasetActive     = "DATASET_ACTIVE"            // Reactivating a dataset that wasn't deleted
+	ErrCodeNotReactivatable  = "DATASET_NOT_REACTIVATABLE" // The dataset is gone from chain, so it can't be reactivated
+	ErrCodeAccessExpired     = "ACCESS_EXPIRED"            // The requester's grant has passed its expires_at
+
+	ErrCodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"  // The Idempotency-Key was first used with a different request
+	ErrCodeIdempotencyInProgress = "IDEMPOTENCY_IN_PROGRESS" // The request first sent with the Idempotency-Key hasn't finished
+
+	ErrCodeTransactionNotFound = "TRANSACTION_NOT_FOUND" // No transaction with the hash, committed or pending
+	ErrCodeTransactionPending  = "TRANSACTION_PENDING"   // The transaction hasn't been committed yet
+
+	ErrCodeInvalidAccessToken = "INVALID_ACCESS_TOKEN" // The access token is malformed, expired or revoked; sign a new challenge
+
+	ErrCodePaymentInvalid     = "PAYMENT_INVALID"      // The transaction isn't a payment of the request's price from the requester to the owner
+	ErrCodePaymentAlreadyUsed = "PAYMENT_ALREADY_USED" // The transaction already paid for another access request
+
+	ErrCodeEscrowNotFound       = "ESCROW_NOT_FOUND"        // The requester has no deposit in escrow for the dataset
+	ErrCodeEscrowRefundTooEarly = "ESCROW_REFUND_TOO_EARLY" // The owner can still release the deposit; refunds open once the refund timeout has passed
+)
+
+const (
+	ErrCodeChainUnavailable = "CHAIN_UNAVAILABLE" // The fullnode couldn't be reached; the answer is unknown, retry later
+
+	ErrCodeInvalidConfiguration = "INVALID_CONFIGURATION" // A reloaded setting is invalid, so nothing was changed
+
+	ErrCodeRecipientNotRegistered     = "RECIPIENT_NOT_REGISTERED"     // The mint recipient must register for the token (POST /token/register) first
+	ErrCodeRecipientSignatureRequired = "RECIPIENT_SIGNATURE_REQUIRED" // auto_register: have the recipient's wallet sign data.raw_transaction and send the mint again with it
+	ErrCodeNotMintAuthority           = "NOT_MINT_AUTHORITY"           // private_key isn't the account holding the token's mint capability
+
+	ErrCodeRangeNotSatisfiable = "RANGE_NOT_SATISFIABLE" // The Range header starts past the end of the blob; Content-Range carries its size
+
+	ErrCodeBinaryFile      = "BINARY_FILE"      // The upload has NUL bytes or starts like a binary format (an image, a PDF, an archive...)
+	ErrCodeInvalidEncoding = "INVALID_ENCODING" // The upload was read as UTF-8 but has bytes that aren't
+
+	ErrCodeColumnsRestricted = "COLUMNS_RESTRICTED" // The grant covers only some columns, so the whole blob or its key can't be handed out
+
+	ErrCodeSampleDisabled = "SAMPLE_DISABLED" // The owner hasn't turned on sampling (sample_enabled) in the dataset's metadata
+
+	ErrCodeAggregatesDisabled = "AGGREGATES_DISABLED"      // No access proof was given and the owner hasn't set aggregates_enabled in the metadata
+	ErrCodePIIColumn          = "PII_COLUMN"               // The column was flagged as personal data, so only requesters with access may aggregate it
+	ErrCodeAggregateLimit     = "AGGREGATE_LIMIT_EXCEEDED" // The aggregate has too many groups or ran too long; group by a coarser column or add a filter
+
+	ErrCodeMetadataInvalid = "METADATA_INVALID" // The dataset metadata doesn't follow its JSON Schema; details lists the fields
+
+	ErrCodeAdminDisabled = "ADMIN_DISABLED" // ADMIN_API_KEYS isn't set, so the admin routes are turned off
+)
+
+// ErrorCodes lists every error code, for the OpenAPI document
+var ErrorCodes = []string{
+	ErrCodeValidationFailed,
+	ErrCodeUnauthorized,
+	ErrCodeInvalidSignature,
+	ErrCodeRateLimited,
+	ErrCodeInvalidCSV,
+	ErrCodeBlobNotFound,
+	ErrCodeIntegrityMismatch,
+	ErrCodeDataHashMismatch,
+	ErrCodeBlobInUse,
+	ErrCodeDatasetInactive,
+	ErrCodeUploadExpired,
+	ErrCodeDatasetActive,
+	ErrCodeNotReactivatable,
+	ErrCodeAccessExpired,
+	ErrCodeIdempotencyKeyReused,
+	ErrCodeIdempotencyInProgress,
+	ErrCodeTransactionNotFound,
+	ErrCodeTransactionPending,
+	ErrCodeInvalidAccessToken,
+	ErrCodePaymentInvalid,
+	ErrCodePaymentAlreadyUsed,
+	ErrCodeEscrowNotFound,
+	ErrCodeEscrowRefundTooEarly,
+	ErrCodeChainUnavailable,
+	ErrCodeInvalidConfiguration,
+	ErrCodeRecipientNotRegistered,
+	ErrCodeRecipientSignatureRequired,
+	ErrCodeNotMintAuthority,
+	ErrCodeRangeNotSatisfiable,
+	ErrCodeBinaryFile,
+	ErrCodeInvalidEncoding,
+	ErrCodeColumnsRestricted,
+	ErrCodeSampleDisabled,
+	ErrCodeAggregatesDisabled,
+	ErrCodePIIColumn,
+	ErrCodeAggregateLimit,
+	ErrCodeMetadataInvalid,
+	ErrCodeAdminDisabled,
+}
+
+// AccessGrant is one entry of an owner's AccessControl resource
+type AccessGrant struct {
+	DatasetID   uint64 `json:"dataset_id"`
+	DatasetName string `json:"dataset_name,omitempty"` // From the dataset's metadata
+	Requester   string `json:"requester"`
+	GrantedAt   string `json:"granted_at,omitempty"` // Approval time of the access request behind the grant; the chain doesn't record one
+	ExpiresAt   uint64 `json:"expires_at"`           // Unix seconds; 0 never expires
+	Expired     bool   `json:"expired"`              // Past expires_at by the node's ledger clock, beyond ACCESS_EXPIRY_SKEW
 }
 
 type TransactionResponse struct {
@@ -72,6 +866,94 @@ type TransactionResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+// EscrowBalance is what a requester holds in escrow for an owner's dataset
+type EscrowBalance struct {
+	Owner       string `json:"owner"`
+	DatasetID   uint64 `json:"dataset_id"`
+	Requester   string `json:"requester"`
+	AmountOctas uint64 `json:"amount_octas"`
+}
+
+// TransactionReceipt is what a committed transaction did and cost, with the events of the
+// DataX modules decoded
+type TransactionReceipt struct {
+	Hash         string         `json:"hash"`
+	Version      uint64         `json:"version"`
+	Sender       string         `json:"sender"`
+	Function     string         `json:"function,omitempty"` // Entry function called, as address::module::name
+	Success      bool           `json:"success"`
+	VMStatus     string         `json:"vm_status"`
+	GasUsed      uint64         `json:"gas_used"`
+	GasUnitPrice uint64         `json:"gas_unit_price"` // Octas per gas unit
+	GasFee       uint64         `json:"gas_fee"`        // gas_used * gas_unit_price, in octas
+	Timestamp    uint64         `json:"timestamp"`      // Unix seconds
+	Events       []ReceiptEvent `json:"events"`
+}
+
+// ReceiptEvent is one event of a transaction receipt. Events of the DataX modules are
+// decoded into the field named after them; every event keeps its raw data, so event types
+// the backend doesn't know pass through unchanged
+type ReceiptEvent struct {
+	Type            string                `json:"type"`              // Move type, or the entry function for derived events
+	Name            string                `json:"name,omitempty"`    // DataX event name when decoded
+	Derived         bool                  `json:"derived,omitempty"` // Read from the entry function call, as the module emits no event for it
+	DataSubmitted   *DataSubmittedEvent   `json:"data_submitted,omitempty"`
+	DataDeleted     *DataDeletedEvent     `json:"data_deleted,omitempty"`
+	DataReactivated *DataReactivatedEvent `json:"data_reactivated,omitempty"`
+	AccessRequested *AccessRequestedEvent `json:"access_requested,omitempty"`
+	AccessGranted   *AccessGrantedEvent   `json:"access_granted,omitempty"`
+	AccessRevoked   *AccessRevokedEvent   `json:"access_revoked,omitempty"`
+	Data            interface{}           `json:"data,omitempty"` // Event data as the node returned it
+}
+
+// Names of the DataX events a receipt decodes
+const (
+	EventNameDataSubmitted   = "DataSubmitted"
+	EventNameDataDeleted     = "DataDeleted"
+	EventNameDataReactivated = "DataReactivated"
+	EventNameAccessRequested = "AccessRequested"
+	EventNameAccessGranted   = "AccessGranted" // Derived from AccessControl::grant_access
+	EventNameAccessRevoked   = "AccessRevoked" // Derived from AccessControl::revoke_access
+)
+
+type DataSubmittedEvent struct {
+	Owner     string `json:"owner"`
+	DatasetID uint64 `json:"dataset_id"`
+	DataHash  string `json:"data_hash"`
+	Metadata  string `json:"metadata"`
+}
+
+type DataDeletedEvent struct {
+	Owner     string `json:"owner"`
+	DatasetID uint64 `json:"dataset_id"`
+}
+
+type DataReactivatedEvent struct {
+	Owner     string `json:"owner"`
+	DatasetID uint64 `json:"dataset_id"`
+}
+
+type AccessRequestedEvent struct {
+	Owner       string `json:"owner"`
+	Requester   string `json:"requester"`
+	DatasetID   uint64 `json:"dataset_id"`
+	Message     string `json:"message"`
+	RequestedAt uint64 `json:"requested_at"` // Unix seconds
+}
+
+type AccessGrantedEvent struct {
+	Owner     string `json:"owner"`
+	Requester string `json:"requester"`
+	DatasetID uint64 `json:"dataset_id"`
+	ExpiresAt uint64 `json:"expires_at"` // Unix seconds; 0 never expires
+}
+
+type AccessRevokedEvent struct {
+	Owner     string `json:"owner"`
+	Requester string `json:"requester"`
+	DatasetID uint64 `json:"dataset_id"`
+}
+
 type DatasetInfo struct {
 	ID        uint64 `json:"id"`
 	Owner     string `json:"owner"`
@@ -79,11 +961,52 @@ type DatasetInfo struct {
 	Metadata  string `json:"metadata"`
 	CreatedAt uint64 `json:"created_at"`
 	IsActive  bool   `json:"is_active"`
+
+	// Fields lifted from Metadata when it follows the DatasetMetadata schema
+	Name        string      `json:"name,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Category    string      `json:"category"`
+	Tags        []string    `json:"tags,omitempty"`
+	PriceAPT    *float64    `json:"price_apt,omitempty"`
+	License     string      `json:"license,omitempty"`
+	RawMetadata interface{} `json:"raw_metadata,omitempty"` // Keys outside the schema, or the text of pre-schema metadata
+
+	EncryptionAlgorithm string   `json:"encryption_algorithm,omitempty"`
+	PIIFlags            []string `json:"pii_flags,omitempty"`
+	SampleEnabled       bool     `json:"sample_enabled,omitempty"`
+	SampleRows          int      `json:"sample_rows,omitempty"`
+	AggregatesEnabled   bool     `json:"aggregates_enabled,omitempty"`
 }
 
+// AccessInfo answers POST /api/v1/access/check. A requester without access either holds
+// an expired grant (Expired) or none at all, because it was never made or was revoked
 type AccessInfo struct {
 	HasAccess bool   `json:"has_access"`
-	ExpiresAt uint64 `json:"expires_at,omitempty"`
+	ExpiresAt uint64 `json:"expires_at,omitempty"` // Expiry of the grant, when there is one that expires
+	Expired   bool   `json:"expired,omitempty"`
+}
+
+// AccessibleDataset is a dataset a requester holds an unexpired grant on
+type AccessibleDataset struct {
+	DatasetInfo
+	ExpiresAt     uint64 `json:"expires_at"`     // 0 when the grant never expires
+	BlobAvailable bool   `json:"blob_available"` // The CSV is in storage, so it can be downloaded
+}
+
+// AccessibleDatasetsPage is a page of the datasets from POST /api/v1/access/my-datasets
+type AccessibleDatasetsPage struct {
+	Datasets []AccessibleDataset `json:"datasets"`
+	Total    int                 `json:"total"` // Accessible datasets across all pages
+	Offset   int                 `json:"offset"`
+	Limit    int                 `json:"limit"`
+}
+
+// OwnerDatasetsPage is a page of an owner's datasets from GET /api/v2/datasets/:owner
+type OwnerDatasetsPage struct {
+	Datasets []interface{} `json:"datasets"`
+	Total    int           `json:"total"` // Datasets matching the filters, across all pages
+	Offset   int           `json:"offset"`
+	Limit    int           `json:"limit,omitempty"`
 }
 
 type VaultInfo struct {
@@ -91,13 +1014,20 @@ type VaultInfo struct {
 	Count    uint64   `json:"count"`
 }
 
+type AuthChallenge struct {
+	Address   string `json:"address"`
+	Nonce     string `json:"nonce"`
+	Message   string `json:"message"`    // Suggested message for the wallet to sign along with the nonce
+	ExpiresAt int64  `json:"expires_at"` // Unix seconds
+}
+
 type InitializationInfo struct {
 	Initialized bool `json:"initialized"`
 }
 
 type SubmitCSVRequest struct {
-	AccountAddress string `json:"account_address" binding:"required"`
-	DataHash       string `json:"data_hash" binding:"required"`
+	AccountAddress string `json:"account_address" binding:"required,aptos_address"`
+	DataHash       string `json:"data_hash" binding:"required,hexhash"`
 	Schema         string `json:"schema" binding:"required"`
 	CSVData        string `json:"csv_data" binding:"required"`
 }
@@ -112,27 +1042,167 @@ type AccessRequest struct {
 	Message          string  `json:"message,omitempty"`
 	PriceAPT         float64 `json:"price_apt"`
 	PaymentTxHash    string  `json:"payment_tx_hash,omitempty"`
+	PaidAmountOctas  uint64  `json:"paid_amount_octas,omitempty"` // APT transferred by the verified payment, in octas
+	PaymentVersion   uint64  `json:"payment_version,omitempty"`   // Ledger version of the payment transaction
 	CreatedAt        string  `json:"created_at,omitempty"`
 	ApprovedAt       string  `json:"approved_at,omitempty"`
 	PaidAt           string  `json:"paid_at,omitempty"`
 }
 
+// ExpectedPayment is what a payment transaction must show to pay for an access request
+type ExpectedPayment struct {
+	Sender     string   // The requester
+	Recipients []string // The owner, and the escrow account when one is configured
+	MinOctas   uint64   // The request's price
+	NotBefore  uint64   // Unix seconds; older transactions paid for something else
+}
+
+// VerifiedPayment is an APT transfer read from chain that satisfied an ExpectedPayment
+type VerifiedPayment struct {
+	TxHash      string `json:"tx_hash"`
+	Sender      string `json:"sender"`
+	Recipient   string `json:"recipient"`
+	AmountOctas uint64 `json:"amount_octas"`
+	Version     uint64 `json:"version"`
+	Timestamp   uint64 `json:"timestamp"` // Unix seconds
+}
+
+// IdempotencyRecord is kept for an Idempotency-Key: the request it was first sent with and,
+// once that request finished, the response to replay for retries
+type IdempotencyRecord struct {
+	Key         string `json:"key"`
+	Fingerprint string `json:"fingerprint"`           // SHA-256 of the method, path and body
+	StatusCode  int    `json:"status_code,omitempty"` // 0 while the first request is still running
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+	ExpiresAt   int64  `json:"expires_at"` // Unix seconds after which the key is free again
+}
+
+// AuditEntry records one successful read of a dataset's contents
+type AuditEntry struct {
+	Owner     string `json:"owner"`
+	DatasetID uint64 `json:"dataset_id"`
+	Requester string `json:"requester"`
+	Endpoint  string `json:"endpoint"`   // Route that served the read, e.g. /api/v1/data/get-csv
+	Rows      int    `json:"rows"`       // Data rows returned; 0 for ciphertext and presigned URLs
+	Timestamp int64  `json:"timestamp"`  // Unix seconds
+	RequestID string `json:"request_id"` // X-Request-ID of the read
+}
+
+// AuditFilter narrows an owner's audit log. From and To are Unix seconds, both inclusive;
+// 0 leaves that end open
+type AuditFilter struct {
+	DatasetID *uint64
+	Requester string
+	From      int64
+	To        int64
+}
+
+// RequestAccessRequest asks an owner for access to one of their datasets
+type RequestAccessRequest struct {
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id" binding:"required"`
+	Requester string  `json:"requester" binding:"required,aptos_address"`
+	Message   string  `json:"message"`
+}
+
+// ListAccessRequestsRequest lists the requests made for an owner's datasets. Start and
+// Limit page through the on-chain request events
+type ListAccessRequestsRequest struct {
+	Owner  string `json:"owner" binding:"required,aptos_address"`
+	Status string `json:"status"` // pending, approved, denied or paid
+	Start  uint64 `json:"start"`
+	Limit  uint64 `json:"limit"`
+}
+
+// SentAccessRequestsRequest lists the requests a requester made
+type SentAccessRequestsRequest struct {
+	Requester string `json:"requester" binding:"required,aptos_address"`
+	Status    string `json:"status"` // pending, approved, denied or paid
+}
+
+// AccessibleDatasetsRequest lists the datasets a requester currently has access to
+type AccessibleDatasetsRequest struct {
+	Requester string `json:"requester" binding:"required,aptos_address"`
+	Offset    int    `json:"offset" binding:"min=0"`
+	Limit     int    `json:"limit" binding:"min=0"` // Datasets to return; default 20, max 100
+}
+
+// AuditLogRequest pages through the reads of an owner's datasets, newest first. The owner
+// signs it, since the log shows who downloaded what
+type AuditLogRequest struct {
+	Owner     string  `json:"owner" binding:"required,aptos_address"`
+	DatasetID *uint64 `json:"dataset_id"`
+	Requester string  `json:"requester" binding:"omitempty,aptos_address"`
+	From      int64   `json:"from" binding:"min=0"` // Unix seconds, inclusive
+	To        int64   `json:"to" binding:"min=0"`   // Unix seconds, inclusive
+	Offset    int     `json:"offset" binding:"min=0"`
+	Limit     int     `json:"limit" binding:"min=0"` // Entries to return; default 50, max 500
+	WalletSignature
+}
+
+// AuditLogPage is a page of entries from POST /api/v1/data/audit-log
+type AuditLogPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"` // Matching entries across all pages
+	Offset  int          `json:"offset"`
+	Limit   int          `json:"limit"`
+}
+
+// DatasetAnalyticsRequest asks for read counters of each of an owner's datasets over a time
+// window. The owner signs it, like the audit log it is computed from
+type DatasetAnalyticsRequest struct {
+	Owner string `json:"owner" binding:"required,aptos_address"`
+	From  int64  `json:"from" binding:"min=0"` // Unix seconds, inclusive; defaults to 7 days before to
+	To    int64  `json:"to" binding:"min=0"`   // Unix seconds, inclusive; defaults to now
+	WalletSignature
+}
+
+// DatasetActivity counts the reads of one dataset within an analytics window
+type DatasetActivity struct {
+	DatasetID        uint64 `json:"dataset_id"`
+	Name             string `json:"name,omitempty"`
+	UniqueRequesters int    `json:"unique_requesters"` // Requesters who read the dataset in any way
+	Downloads        int    `json:"downloads"`         // Reads other than previews
+	Previews         int    `json:"previews"`
+	RowsReturned     int    `json:"rows_returned"`
+	LastAccessAt     int64  `json:"last_access_at"` // Unix seconds of the latest read; 0 when there was none
+}
+
+// DatasetAnalytics is the answer of POST /api/v1/data/analytics: a row for every one of
+// the owner's datasets, by ID, including those nobody read
+type DatasetAnalytics struct {
+	From        int64             `json:"from"`
+	To          int64             `json:"to"`
+	Datasets    []DatasetActivity `json:"datasets"`
+	GeneratedAt int64             `json:"generated_at"` // When the counters were computed; they are cached
+}
+
+// RegisterMarketplaceUserRequest is kept for older clients; users are discovered from chain
+type RegisterMarketplaceUserRequest struct {
+	UserAddress string `json:"user_address" binding:"required,aptos_address"`
+}
+
 type CreateAccessRequestInput struct {
-	OwnerAddress     string `json:"owner_address" binding:"required"`
-	RequesterAddress string `json:"requester_address" binding:"required"`
-	DatasetID        uint64 `json:"dataset_id" binding:"required"`
-	Message          string `json:"message"`
+	OwnerAddress     string  `json:"owner_address" binding:"required,aptos_address"`
+	RequesterAddress string  `json:"requester_address" binding:"required,aptos_address"`
+	DatasetID        *uint64 `json:"dataset_id" binding:"required"`
+	Message          string  `json:"message"`
 }
 
+// ApproveAccessRequestInput approves or denies a pending request; signed by the owner
 type ApproveAccessRequestInput struct {
-	OwnerAddress     string `json:"owner_address" binding:"required"`
-	RequesterAddress string `json:"requester_address" binding:"required"`
-	DatasetID        uint64 `json:"dataset_id" binding:"required"`
+	OwnerAddress     string  `json:"owner_address" binding:"required,aptos_address"`
+	RequesterAddress string  `json:"requester_address" binding:"required,aptos_address"`
+	DatasetID        *uint64 `json:"dataset_id" binding:"required"`
+	WalletSignature
 }
 
+// ConfirmPaymentInput records the payment for an approved request; signed by the requester
 type ConfirmPaymentInput struct {
-	OwnerAddress     string `json:"owner_address" binding:"required"`
-	RequesterAddress string `json:"requester_address" binding:"required"`
-	DatasetID        uint64 `json:"dataset_id" binding:"required"`
-	TxHash           string `json:"tx_hash" binding:"required"`
+	OwnerAddress     string  `json:"owner_address" binding:"required,aptos_address"`
+	RequesterAddress string  `json:"requester_address" binding:"required,aptos_address"`
+	DatasetID        *uint64 `json:"dataset_id" binding:"required"`
+	TxHash           string  `json:"tx_hash" binding:"required,hexhash"`
+	WalletSignature
 }
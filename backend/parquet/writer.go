@@ -0,0 +1,186 @@
+// Package parquet writes dataset exports as Parquet files using parquet-go
+//
+// Only what dataset exports need is exposed: flat schemas of optional INT64, DOUBLE,
+// BOOLEAN, and UTF-8 string columns, kept in the order given and Snappy compressed. Rows
+// are written as they arrive and flushed every RowGroupRows rows, so an export of any
+// length is written in bounded memory.
+package parquet
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	parquetgo "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+// Type is the physical type of a column
+type Type int
+
+const (
+	String Type = iota // BYTE_ARRAY annotated as UTF8
+	Int64
+	Double
+	Bool
+)
+
+func (t Type) String() string {
+	switch t {
+	case Int64:
+		return "int64"
+	case Double:
+		return "double"
+	case Bool:
+		return "bool"
+	default:
+		return "string"
+	}
+}
+
+// RowGroupRows is how many rows are buffered before they are written out as a row group
+const RowGroupRows = 64 * 1024
+
+// Column describes one output column
+type Column struct {
+	Name string
+	Type Type
+}
+
+// ParseValue converts a CSV cell to a column's type. Empty cells are null (ok=true,
+// value=nil); cells that don't parse return ok=false
+func ParseValue(t Type, cell string) (value interface{}, ok bool) {
+	trimmed := strings.TrimSpace(cell)
+	if trimmed == "" {
+		return nil, true
+	}
+	switch t {
+	case Int64:
+		v, err := strconv.ParseInt(trimmed, 10, 64)
+		return v, err == nil
+	case Double:
+		v, err := strconv.ParseFloat(trimmed, 64)
+		return v, err == nil && !math.IsNaN(v) && !math.IsInf(v, 0)
+	case Bool:
+		switch strings.ToLower(trimmed) {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+		return nil, false
+	default:
+		return cell, true
+	}
+}
+
+// Writer writes CSV records as the rows of a Parquet file
+type Writer struct {
+	columns []Column
+	writer  *parquetgo.Writer
+	row     parquetgo.Row
+	rows    int
+}
+
+// NewWriter starts a Parquet file with the given columns on w. Nothing is written until
+// the first row group fills or the writer is closed
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	fields := make(orderedGroup, len(columns))
+	for i, column := range columns {
+		fields[i] = namedField{Node: parquetgo.Optional(leafNode(column.Type)), name: column.Name}
+	}
+	return &Writer{
+		columns: columns,
+		writer: parquetgo.NewWriter(w,
+			parquetgo.NewSchema("schema", fields),
+			parquetgo.Compression(&parquetgo.Snappy),
+			parquetgo.MaxRowsPerRowGroup(RowGroupRows),
+		),
+		row: make(parquetgo.Row, len(columns)),
+	}
+}
+
+// Write adds a record as the next row. Every cell must parse with ParseValue for its
+// column's type; choose String for columns that might not. Cells missing from a short
+// record are null
+func (w *Writer) Write(record []string) error {
+	w.rows++
+	for i, column := range w.columns {
+		cell := ""
+		if i < len(record) {
+			cell = record[i]
+		}
+		value, ok := ParseValue(column.Type, cell)
+		if !ok {
+			return fmt.Errorf("column %q row %d: %q is not a valid %s", column.Name, w.rows, cell, column.Type)
+		}
+		if value == nil {
+			w.row[i] = parquetgo.NullValue().Level(0, 0, i)
+		} else {
+			w.row[i] = parquetgo.ValueOf(value).Level(0, 1, i)
+		}
+	}
+	_, err := w.writer.WriteRows([]parquetgo.Row{w.row})
+	return err
+}
+
+// Close writes any buffered rows and the file footer. It doesn't close the underlying writer
+func (w *Writer) Close() error {
+	return w.writer.Close()
+}
+
+// WriteCSV writes CSV data rows as a Parquet file
+func WriteCSV(w io.Writer, columns []Column, rows [][]string) error {
+	writer := NewWriter(w, columns)
+	for _, row := range rows {
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// leafNode is the parquet-go column node for a type
+func leafNode(t Type) parquetgo.Node {
+	switch t {
+	case Int64:
+		return parquetgo.Leaf(parquetgo.Int64Type)
+	case Double:
+		return parquetgo.Leaf(parquetgo.DoubleType)
+	case Bool:
+		return parquetgo.Leaf(parquetgo.BooleanType)
+	default:
+		return parquetgo.String()
+	}
+}
+
+// namedField names a column node within orderedGroup
+type namedField struct {
+	parquetgo.Node
+	name string
+}
+
+func (f namedField) Name() string { return f.name }
+
+// Value is only used when writing Go values; the writer is given rows instead
+func (f namedField) Value(base reflect.Value) reflect.Value { return reflect.Value{} }
+
+// orderedGroup is a schema root that keeps its columns in the CSV's order, where
+// parquetgo.Group sorts them by name
+type orderedGroup []parquetgo.Field
+
+func (g orderedGroup) ID() int                     { return 0 }
+func (g orderedGroup) String() string              { return parquetgo.NewSchema("", g).String() }
+func (g orderedGroup) Type() parquetgo.Type        { return parquetgo.Group{}.Type() }
+func (g orderedGroup) Optional() bool              { return false }
+func (g orderedGroup) Repeated() bool              { return false }
+func (g orderedGroup) Required() bool              { return true }
+func (g orderedGroup) Leaf() bool                  { return false }
+func (g orderedGroup) Fields() []parquetgo.Field   { return g }
+func (g orderedGroup) Encoding() encoding.Encoding { return nil }
+func (g orderedGroup) Compression() compress.Codec { return nil }
+func (g orderedGroup) GoType() reflect.Type        { return reflect.TypeOf(map[string]interface{}{}) }
@@ -0,0 +1,178 @@
+package parquet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	parquetgo "github.com/parquet-go/parquet-go"
+)
+
+// readBack opens a written file with parquet-go and returns its column names, physical
+// types, row group count, and rows as Go values, nil for nulls
+func readBack(t *testing.T, file []byte) ([]string, []string, int, [][]interface{}) {
+	t.Helper()
+	f, err := parquetgo.OpenFile(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	var names, types []string
+	for _, field := range f.Schema().Fields() {
+		names = append(names, field.Name())
+		types = append(types, field.Type().Kind().String())
+	}
+
+	reader := parquetgo.NewReader(f)
+	defer reader.Close()
+	var rows [][]interface{}
+	buffer := make([]parquetgo.Row, 64)
+	for {
+		n, err := reader.ReadRows(buffer)
+		for _, row := range buffer[:n] {
+			values := make([]interface{}, len(row))
+			for i, value := range row {
+				if value.IsNull() {
+					continue
+				}
+				switch value.Kind() {
+				case parquetgo.Int64:
+					values[i] = value.Int64()
+				case parquetgo.Double:
+					values[i] = value.Double()
+				case parquetgo.Boolean:
+					values[i] = value.Boolean()
+				default:
+					values[i] = value.String()
+				}
+			}
+			rows = append(rows, values)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadRows: %v", err)
+		}
+	}
+	return names, types, len(f.RowGroups()), rows
+}
+
+func TestWriteCSVRoundTrips(t *testing.T) {
+	columns := []Column{
+		{Name: "name", Type: String},
+		{Name: "id", Type: Int64},
+		{Name: "score", Type: Double},
+		{Name: "active", Type: Bool},
+		{Name: "mixed", Type: String},
+		{Name: "empty", Type: Int64},
+	}
+	rows := [][]string{
+		{"alpha", "1", "2.5", "true", "12", ""},
+		{"", " 2 ", "-1e3", "FALSE", "abc", " "},
+		{"γ, with a comma", "", "", "", "", ""},
+		{"short"}, // Cells past the end are null
+	}
+
+	var file bytes.Buffer
+	if err := WriteCSV(&file, columns, rows); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	names, types, _, got := readBack(t, file.Bytes())
+
+	// Columns stay in the order given rather than sorted by name
+	if want := []string{"name", "id", "score", "active", "mixed", "empty"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("columns %v, want %v", names, want)
+	}
+	if want := []string{"BYTE_ARRAY", "INT64", "DOUBLE", "BOOLEAN", "BYTE_ARRAY", "INT64"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("types %v, want %v", types, want)
+	}
+	want := [][]interface{}{
+		{"alpha", int64(1), 2.5, true, "12", nil},
+		{nil, int64(2), -1000.0, false, "abc", nil},
+		{"γ, with a comma", nil, nil, nil, nil, nil},
+		{"short", nil, nil, nil, nil, nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read back %v, want %v", got, want)
+	}
+}
+
+func TestWriteCSVWithNoRows(t *testing.T) {
+	var file bytes.Buffer
+	if err := WriteCSV(&file, []Column{{Name: "id", Type: Int64}}, nil); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	names, _, _, rows := readBack(t, file.Bytes())
+	if !reflect.DeepEqual(names, []string{"id"}) || len(rows) != 0 {
+		t.Errorf("read back columns %v and %d rows, want id and none", names, len(rows))
+	}
+}
+
+func TestWriterFlushesRowGroups(t *testing.T) {
+	var file bytes.Buffer
+	writer := NewWriter(&file, []Column{{Name: "id", Type: Int64}, {Name: "label", Type: String}})
+	total := RowGroupRows + 10
+	for i := 1; i <= total; i++ {
+		if err := writer.Write([]string{fmt.Sprint(i), strings.Repeat("x", i%7)}); err != nil {
+			t.Fatalf("Write row %d: %v", i, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	_, _, groups, rows := readBack(t, file.Bytes())
+	if groups != 2 || len(rows) != total {
+		t.Fatalf("%d row groups of %d rows, want 2 of %d", groups, len(rows), total)
+	}
+	if last := rows[total-1]; last[0] != int64(total) {
+		t.Errorf("last row %v, want id %d", last, total)
+	}
+}
+
+func TestWriterRefusesCellsThatDontFitTheirType(t *testing.T) {
+	cases := []struct {
+		column Column
+		cell   string
+	}{
+		{Column{Name: "id", Type: Int64}, "1.5"},
+		{Column{Name: "score", Type: Double}, "NaN"},
+		{Column{Name: "score", Type: Double}, "1e400"},
+		{Column{Name: "active", Type: Bool}, "yes"},
+	}
+	for _, tc := range cases {
+		writer := NewWriter(io.Discard, []Column{tc.column})
+		if err := writer.Write([]string{tc.cell}); err == nil {
+			t.Errorf("%s %q was written", tc.column.Type, tc.cell)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	cases := []struct {
+		t     Type
+		cell  string
+		value interface{}
+		ok    bool
+	}{
+		{String, " padded ", " padded ", true},
+		{String, "  ", nil, true},
+		{Int64, "-42", int64(-42), true},
+		{Int64, "007", int64(7), true},
+		{Int64, "9223372036854775808", nil, false},
+		{Double, "3.25", 3.25, true},
+		{Double, "Inf", nil, false},
+		{Bool, "True", true, true},
+		{Bool, "0", nil, false},
+		{Bool, "", nil, true},
+	}
+	for _, tc := range cases {
+		value, ok := ParseValue(tc.t, tc.cell)
+		if ok != tc.ok || (ok && !reflect.DeepEqual(value, tc.value)) {
+			t.Errorf("ParseValue(%s, %q) = %v, %t, want %v, %t", tc.t, tc.cell, value, ok, tc.value, tc.ok)
+		}
+	}
+}
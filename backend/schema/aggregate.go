@@ -0,0 +1,195 @@
+package schema
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+)
+
+// Aggregate functions
+const (
+	AggregateCount = "count"
+	AggregateSum   = "sum"
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+)
+
+// ErrTooManyGroups is returned by Observe once a query has more distinct groups than allowed
+var ErrTooManyGroups = errors.New("too many groups")
+
+// AggregateQuery describes one aggregate over a CSV's data rows. Column names are matched
+// case-insensitively, ignoring surrounding spaces
+type AggregateQuery struct {
+	GroupBy      string // Rows are grouped by this column's values; "" makes every row one group
+	Column       string // Column aggregated; count without one counts rows
+	Function     string // One of the Aggregate* functions
+	FilterColumn string // When set, only rows whose value in it equals FilterValue are aggregated
+	FilterValue  string
+}
+
+type aggregateGroup struct {
+	rows   int
+	values int // Numeric values aggregated, or non-null ones for count
+	sum    float64
+	min    float64
+	max    float64
+}
+
+// Aggregator computes an AggregateQuery one data row at a time, holding one small
+// accumulator per group and at most maxGroups of them
+type Aggregator struct {
+	query     AggregateQuery
+	maxGroups int
+	groupBy   int // Column indexes, -1 when unused
+	column    int
+	filter    int
+	groups    map[string]*aggregateGroup
+	rows      int
+}
+
+// NewAggregator creates an Aggregator for a CSV with the given header, or returns the
+// columns of the query the header doesn't have
+func NewAggregator(query AggregateQuery, header []string, maxGroups int) (*Aggregator, []string) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, ok := positions[key]; !ok {
+			positions[key] = i
+		}
+	}
+
+	var missing []string
+	index := func(name string) int {
+		if name == "" {
+			return -1
+		}
+		i, ok := positions[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			if !containsString(missing, name) {
+				missing = append(missing, name)
+			}
+			return -1
+		}
+		return i
+	}
+	a := &Aggregator{
+		query:     query,
+		maxGroups: maxGroups,
+		groupBy:   index(query.GroupBy),
+		column:    index(query.Column),
+		filter:    index(query.FilterColumn),
+		groups:    make(map[string]*aggregateGroup),
+	}
+	if len(missing) > 0 {
+		return nil, missing
+	}
+	return a, nil
+}
+
+// Observe feeds the next data row to the aggregator. It fails with ErrTooManyGroups when
+// the row would start a group beyond the limit
+func (a *Aggregator) Observe(record []string) error {
+	a.rows++
+	if a.filter >= 0 && cell(record, a.filter) != a.query.FilterValue {
+		return nil
+	}
+
+	key := ""
+	if a.groupBy >= 0 {
+		key = cell(record, a.groupBy)
+		if isNull(key) {
+			key = ""
+		}
+	}
+	group, ok := a.groups[key]
+	if !ok {
+		if a.maxGroups > 0 && len(a.groups) >= a.maxGroups {
+			return ErrTooManyGroups
+		}
+		group = &aggregateGroup{}
+		a.groups[key] = group
+	}
+	group.rows++
+
+	if a.column < 0 {
+		return nil
+	}
+	value := cell(record, a.column)
+	if isNull(value) {
+		return nil
+	}
+	if a.query.Function == AggregateCount {
+		group.values++
+		return nil
+	}
+	// Values that aren't numbers are left out of sum, avg, min and max
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || !floatPattern.MatchString(value) {
+		return nil
+	}
+	if group.values == 0 || n < group.min {
+		group.min = n
+	}
+	if group.values == 0 || n > group.max {
+		group.max = n
+	}
+	group.sum += n
+	group.values++
+	return nil
+}
+
+// Result returns the aggregate of every group with at least minGroupSize rows, sorted by
+// key. Smaller groups are only counted, so a single row can't be picked out of the result
+func (a *Aggregator) Result(minGroupSize int) models.AggregateResult {
+	result := models.AggregateResult{
+		GroupBy:      a.query.GroupBy,
+		Column:       a.query.Column,
+		Function:     a.query.Function,
+		Groups:       []models.AggregateGroup{},
+		MinGroupSize: minGroupSize,
+		RowsScanned:  a.rows,
+	}
+	for key, group := range a.groups {
+		if group.rows < minGroupSize {
+			result.SuppressedGroups++
+			continue
+		}
+		entry := models.AggregateGroup{Key: key, Rows: group.rows, Values: group.values}
+		if a.query.Function == AggregateCount && a.column < 0 {
+			entry.Values = group.rows
+		}
+		var value float64
+		switch a.query.Function {
+		case AggregateCount:
+			value = float64(group.rows)
+			if a.column >= 0 {
+				value = float64(group.values)
+			}
+		case AggregateSum:
+			value = group.sum
+		case AggregateAvg:
+			value = group.sum / float64(group.values)
+		case AggregateMin:
+			value = group.min
+		case AggregateMax:
+			value = group.max
+		}
+		if a.query.Function == AggregateCount || a.query.Function == AggregateSum || group.values > 0 {
+			entry.Value = &value
+		}
+		result.Groups = append(result.Groups, entry)
+	}
+	sort.Slice(result.Groups, func(i, j int) bool { return result.Groups[i].Key < result.Groups[j].Key })
+	return result
+}
+
+func cell(record []string, i int) string {
+	if i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
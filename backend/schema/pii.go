@@ -0,0 +1,267 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/datax/backend/models"
+)
+
+// Built-in PII detectors, by the name PII_DETECTORS enables them with
+const (
+	PIIEmail      = "email"
+	PIIPhone      = "phone"
+	PIISSN        = "ssn"
+	PIICreditCard = "credit_card"
+)
+
+// maxRedactedLength caps an example value; longer ones are cut before redaction
+const maxRedactedLength = 40
+
+// PIIDetector recognizes one kind of personal data in a cell
+type PIIDetector struct {
+	Name  string
+	Match func(value string) bool
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`^\+?[0-9 ().-]+$`)
+	ssnPattern   = regexp.MustCompile(`^(\d{3})-(\d{2})-(\d{4})$`)
+	cardPattern  = regexp.MustCompile(`^[0-9][0-9 -]+[0-9]$`)
+	// Dates written with dashes or dots look like phone numbers
+	dashedDatePattern = regexp.MustCompile(`^(\d{4}[-.]\d{1,2}[-.]\d{1,2}|\d{1,2}[-.]\d{1,2}[-.]\d{2,4})$`)
+)
+
+var builtinPIIDetectors = map[string]func(string) bool{
+	PIIEmail:      emailPattern.MatchString,
+	PIIPhone:      isPhoneNumber,
+	PIISSN:        isSSN,
+	PIICreditCard: isCardNumber,
+}
+
+// BuiltinPIIDetectorNames lists the built-in detectors, sorted
+func BuiltinPIIDetectorNames() []string {
+	names := make([]string, 0, len(builtinPIIDetectors))
+	for name := range builtinPIIDetectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PIIDetectors builds the detectors named in names (every built-in one when names is empty)
+// plus one per "name=regex" pattern, which flags cells the regex finds a match in
+func PIIDetectors(names []string, patterns []string) ([]PIIDetector, error) {
+	if len(names) == 0 {
+		names = BuiltinPIIDetectorNames()
+	}
+	detectors := make([]PIIDetector, 0, len(names)+len(patterns))
+	for _, name := range names {
+		match, ok := builtinPIIDetectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown PII detector %q (built in: %s)", name, strings.Join(BuiltinPIIDetectorNames(), ", "))
+		}
+		detectors = append(detectors, PIIDetector{Name: name, Match: match})
+	}
+	for _, pattern := range patterns {
+		name, expr, ok := strings.Cut(pattern, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("PII pattern %q is not name=regex", pattern)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("PII pattern %s: %w", name, err)
+		}
+		detectors = append(detectors, PIIDetector{Name: strings.TrimSpace(name), Match: re.MatchString})
+	}
+	return detectors, nil
+}
+
+// isPhoneNumber accepts 7 to 15 digits written the way phone numbers are: with a leading +
+// or split into groups by spaces, dashes, dots or parentheses. Bare digit runs are left
+// alone, since they are far more often IDs, amounts or timestamps, and so are dates and
+// values shaped like SSNs
+func isPhoneNumber(value string) bool {
+	if !phonePattern.MatchString(value) || dashedDatePattern.MatchString(value) || ssnPattern.MatchString(value) {
+		return false
+	}
+	digits, separators := 0, 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits++
+		} else if r != '+' {
+			separators++
+		}
+	}
+	if digits < 7 || digits > 15 {
+		return false
+	}
+	// A single dot is a decimal number
+	return strings.HasPrefix(value, "+") || separators >= 2 || (separators == 1 && !strings.Contains(value, "."))
+}
+
+// isSSN accepts a dashed US Social Security number in the ranges the SSA assigns
+func isSSN(value string) bool {
+	parts := ssnPattern.FindStringSubmatch(value)
+	if parts == nil {
+		return false
+	}
+	area, group, serial := parts[1], parts[2], parts[3]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// isCardNumber accepts 13 to 19 digits, optionally grouped by spaces or dashes, starting
+// like a card network's numbers and passing the Luhn check
+func isCardNumber(value string) bool {
+	if !cardPattern.MatchString(value) {
+		return false
+	}
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(value)
+	if len(digits) < 13 || len(digits) > 19 || digits[0] < '2' || digits[0] > '6' {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// RedactPII masks every letter and digit of a value except the last two, keeping
+// punctuation so the shape of the value still shows
+func RedactPII(value string) string {
+	runes := []rune(value)
+	if len(runes) > maxRedactedLength {
+		runes = append(runes[:maxRedactedLength], '…')
+	}
+	keep := 2
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+type piiColumnState struct {
+	values   int   // Non-null sampled values
+	matches  []int // Per detector
+	examples [][]string
+}
+
+// PIIScanner looks for personal data in sampled rows, one record at a time. The first
+// record observed is the header; data rows beyond the sample limit are ignored. It only
+// reads the records, so scanning never changes the data
+type PIIScanner struct {
+	detectors   []PIIDetector
+	maxRows     int
+	flagPercent float64
+	header      []string
+	columns     []piiColumnState
+	rows        int
+}
+
+// NewPIIScanner creates a PIIScanner that samples at most maxRows data rows (0 means no
+// limit) and flags a column for a detector when at least flagPercent of its non-null
+// sampled values match
+func NewPIIScanner(detectors []PIIDetector, maxRows int, flagPercent float64) *PIIScanner {
+	return &PIIScanner{detectors: detectors, maxRows: maxRows, flagPercent: flagPercent}
+}
+
+// Observe feeds the next record to the scanner
+func (s *PIIScanner) Observe(record []string) {
+	if s.header == nil {
+		s.header = append([]string{}, record...)
+		s.columns = make([]piiColumnState, len(record))
+		for i := range s.columns {
+			s.columns[i].matches = make([]int, len(s.detectors))
+			s.columns[i].examples = make([][]string, len(s.detectors))
+		}
+		return
+	}
+	if s.Done() {
+		return
+	}
+	s.rows++
+
+	for i := range s.columns {
+		if i >= len(record) {
+			break
+		}
+		value := strings.TrimSpace(record[i])
+		if isNull(value) {
+			continue
+		}
+		col := &s.columns[i]
+		col.values++
+		for d, detector := range s.detectors {
+			if !detector.Match(value) {
+				continue
+			}
+			col.matches[d]++
+			if len(col.examples[d]) < maxExamples {
+				redacted := RedactPII(value)
+				if !containsString(col.examples[d], redacted) {
+					col.examples[d] = append(col.examples[d], redacted)
+				}
+			}
+		}
+	}
+}
+
+// Done reports whether the sample is full, so a caller reading only for the scan can stop
+func (s *PIIScanner) Done() bool {
+	return s.maxRows > 0 && s.rows >= s.maxRows
+}
+
+// Report returns what the sampled rows revealed: every column with at least one match, and
+// the detectors that flagged any column
+func (s *PIIScanner) Report() models.PIIReport {
+	report := models.PIIReport{
+		SampledRows: s.rows,
+		FlagPercent: s.flagPercent,
+		Columns:     []models.PIIColumn{},
+		Flags:       []string{},
+	}
+	flagged := make(map[string]bool)
+	for i, col := range s.columns {
+		column := models.PIIColumn{Name: s.header[i]}
+		for d, detector := range s.detectors {
+			if col.matches[d] == 0 {
+				continue
+			}
+			finding := models.PIIFinding{
+				Detector:     detector.Name,
+				Matches:      col.matches[d],
+				MatchPercent: float64(col.matches[d]) * 100 / float64(col.values),
+				Examples:     col.examples[d],
+			}
+			finding.Flagged = finding.MatchPercent >= s.flagPercent
+			if finding.Flagged && !flagged[detector.Name] {
+				flagged[detector.Name] = true
+				report.Flags = append(report.Flags, detector.Name)
+			}
+			column.Findings = append(column.Findings, finding)
+		}
+		if len(column.Findings) > 0 {
+			report.Columns = append(report.Columns, column)
+		}
+	}
+	sort.Strings(report.Flags)
+	return report
+}
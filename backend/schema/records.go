@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Record is one CSV row keyed by header name. It marshals as a JSON object whose keys
+// keep the header order
+type Record struct {
+	keys   []string
+	values []interface{}
+}
+
+// MarshalJSON writes the record as an object in header order
+func (r Record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// ToRecords converts data rows to records keyed by header name, coercing each value with
+// CoerceValue. Duplicate header names are disambiguated by UniqueNames; missing trailing
+// cells become null and cells beyond the header are dropped
+func ToRecords(header []string, rows [][]string) []Record {
+	keys := UniqueNames(header)
+	records := make([]Record, len(rows))
+	for r, row := range rows {
+		records[r] = ToRecord(keys, row)
+	}
+	return records
+}
+
+// ToRecord converts one data row the way ToRecords does, keyed by keys, which must already
+// be unique (UniqueNames of the header). Callers converting rows one at a time compute the
+// keys once and share them
+func ToRecord(keys []string, row []string) Record {
+	values := make([]interface{}, len(keys))
+	for i := range keys {
+		if i < len(row) {
+			values[i] = CoerceValue(row[i])
+		}
+	}
+	return Record{keys: keys, values: values}
+}
+
+// UniqueNames makes header names unique deterministically: the first occurrence keeps its
+// name and later ones get the lowest free suffix ("name", "name_2", "name_3"). A suffixed
+// name never takes a name that another column literally has
+func UniqueNames(header []string) []string {
+	literal := make(map[string]bool, len(header))
+	for _, name := range header {
+		literal[name] = true
+	}
+
+	used := make(map[string]bool, len(header))
+	names := make([]string, len(header))
+	for i, name := range header {
+		unique := name
+		if used[unique] {
+			for n := 2; ; n++ {
+				candidate := fmt.Sprintf("%s_%d", name, n)
+				if !used[candidate] && !literal[candidate] {
+					unique = candidate
+					break
+				}
+			}
+		}
+		used[unique] = true
+		names[i] = unique
+	}
+	return names
+}
+
+// CoerceValue converts a CSV cell to a JSON-friendly value on a best-effort basis:
+// empty cells become nil, integers int64, decimals float64, true/false bool. Anything
+// else, including numbers with leading zeros, stays a string
+func CoerceValue(value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return nil
+	}
+
+	if floatPattern.MatchString(trimmed) && !hasLeadingZero(trimmed) {
+		if n, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return n
+		}
+		if !isInteger(trimmed) {
+			if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+				return f
+			}
+		}
+		return value // Integers too large for int64 would lose digits as floats
+	}
+
+	if strings.EqualFold(trimmed, "true") {
+		return true
+	}
+	if strings.EqualFold(trimmed, "false") {
+		return false
+	}
+	return value
+}
+
+func isInteger(value string) bool {
+	digits := strings.TrimLeft(value, "+-")
+	if digits == "" {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
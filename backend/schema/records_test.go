@@ -0,0 +1,117 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestToRecords(t *testing.T) {
+	cases := []struct {
+		name   string
+		header []string
+		rows   [][]string
+		want   string
+	}{
+		{
+			"values coerced in header order",
+			[]string{"zeta", "alpha", "score", "active", "zip", "big"},
+			[][]string{{"1", " x ", "2.5", "TRUE", "007", "123456789012345678901234567890"}},
+			`[{"zeta":1,"alpha":" x ","score":2.5,"active":true,"zip":"007","big":"123456789012345678901234567890"}]`,
+		},
+		{
+			"duplicate headers",
+			[]string{"name", "name", "name_2", "name"},
+			[][]string{{"a", "b", "c", "d"}},
+			`[{"name":"a","name_3":"b","name_2":"c","name_4":"d"}]`,
+		},
+		{
+			"short row",
+			[]string{"id", "name", "note"},
+			[][]string{{"1"}, {"2", ""}},
+			`[{"id":1,"name":null,"note":null},{"id":2,"name":null,"note":null}]`,
+		},
+		{
+			"long row",
+			[]string{"id"},
+			[][]string{{"1", "extra", "cells"}},
+			`[{"id":1}]`,
+		},
+		{
+			"empty header",
+			[]string{},
+			[][]string{{"1"}},
+			`[{}]`,
+		},
+		{
+			"no rows",
+			[]string{"id"},
+			[][]string{},
+			`[]`,
+		},
+		{
+			"special characters in keys",
+			[]string{`say "hi"`, "tab\tkey", ""},
+			[][]string{{"1", "2", "3"}},
+			`[{"say \"hi\"":1,"tab\tkey":2,"":3}]`,
+		},
+	}
+	for _, tc := range cases {
+		got, err := json.Marshal(ToRecords(tc.header, tc.rows))
+		if err != nil {
+			t.Errorf("%s: Marshal: %v", tc.name, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUniqueNames(t *testing.T) {
+	cases := []struct {
+		header []string
+		want   []string
+	}{
+		{[]string{"a", "b"}, []string{"a", "b"}},
+		{[]string{"a", "a", "a"}, []string{"a", "a_2", "a_3"}},
+		// A suffix never takes a name another column literally has, even a later one
+		{[]string{"a", "a", "a_2"}, []string{"a", "a_3", "a_2"}},
+		{[]string{"", ""}, []string{"", "_2"}},
+		{nil, []string{}},
+	}
+	for _, tc := range cases {
+		if got := UniqueNames(tc.header); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("UniqueNames(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestCoerceValue(t *testing.T) {
+	cases := []struct {
+		value string
+		want  interface{}
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"42", int64(42)},
+		{" -7 ", int64(-7)},
+		{"0", int64(0)},
+		{"3.25", 3.25},
+		{"1e3", 1000.0},
+		{"0.5", 0.5},
+		{"007", "007"},
+		{"9223372036854775808", "9223372036854775808"}, // Past int64, kept exact
+		{"true", true},
+		{"False", false},
+		{"NaN", "NaN"},
+		{"0x1F", "0x1F"},
+		{"null", "null"},
+		{" padded ", " padded "},
+	}
+	for _, tc := range cases {
+		if got := CoerceValue(tc.value); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("CoerceValue(%q) = %#v, want %#v", tc.value, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package schema infers column types from sampled CSV rows
+package schema
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types reported by inference
+const (
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+	TypeDate   = "date"
+	TypeString = "string"
+)
+
+// maxExamples is how many distinct example values are kept per column
+const maxExamples = 3
+
+// ErrEmptyCSV is returned when the sample has no header row
+var ErrEmptyCSV = errors.New("CSV has no header row")
+
+type Column struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Nullable bool     `json:"nullable"` // At least one sampled value was empty or "null"
+	Examples []string `json:"examples"` // Up to three distinct non-empty sampled values
+}
+
+type Schema struct {
+	Columns     []Column `json:"columns"`
+	SampledRows int      `json:"sampled_rows"`
+}
+
+// Candidate types as bits; a column keeps the types every sampled value satisfies
+const (
+	canInt = 1 << iota
+	canFloat
+	canBool
+	canDate
+	canAny = canInt | canFloat | canBool | canDate
+)
+
+// dateLayouts are the date formats recognised, most common first
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006/01/02",
+	"01/02/2006",
+}
+
+// floatPattern accepts plain decimal and exponent notation; ParseFloat alone would also
+// accept "NaN", "Inf", and hex floats, which are almost always text in a CSV
+var floatPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+type columnState struct {
+	candidates int
+	seen       bool // At least one non-null value
+	nullable   bool
+	examples   []string
+}
+
+// Inferrer accumulates type evidence one record at a time. The first record observed is
+// the header; data rows beyond the sample limit are ignored
+type Inferrer struct {
+	maxRows int
+	header  []string
+	columns []columnState
+	rows    int
+}
+
+// NewInferrer creates an Inferrer that samples at most maxRows data rows (0 means no limit)
+func NewInferrer(maxRows int) *Inferrer {
+	return &Inferrer{maxRows: maxRows}
+}
+
+// Observe feeds the next record to the inferrer
+func (in *Inferrer) Observe(record []string) {
+	if in.header == nil {
+		in.header = append([]string{}, record...)
+		in.columns = make([]columnState, len(record))
+		for i := range in.columns {
+			in.columns[i].candidates = canAny
+		}
+		return
+	}
+	if in.maxRows > 0 && in.rows >= in.maxRows {
+		return
+	}
+	in.rows++
+
+	for i := range in.columns {
+		col := &in.columns[i]
+		value := ""
+		if i < len(record) {
+			value = strings.TrimSpace(record[i])
+		}
+		if isNull(value) {
+			col.nullable = true
+			continue
+		}
+		col.seen = true
+		col.candidates &= classify(value)
+		if len(col.examples) < maxExamples && !containsString(col.examples, value) {
+			col.examples = append(col.examples, value)
+		}
+	}
+}
+
+// Schema returns the schema inferred from the records observed so far
+func (in *Inferrer) Schema() Schema {
+	result := Schema{Columns: make([]Column, len(in.columns)), SampledRows: in.rows}
+	for i, col := range in.columns {
+		examples := col.examples
+		if examples == nil {
+			examples = []string{}
+		}
+		result.Columns[i] = Column{
+			Name:     in.header[i],
+			Type:     resolveType(col),
+			Nullable: col.nullable || !col.seen,
+			Examples: examples,
+		}
+	}
+	return result
+}
+
+// Infer reads a header and up to maxRows data rows from r and infers their schema
+// A truncated final record, as left by sampling the first bytes of a file, is ignored
+func Infer(r io.Reader, maxRows int) (Schema, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	inferrer := NewInferrer(maxRows)
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) && inferrer.header != nil {
+				break
+			}
+			return Schema{}, err
+		}
+		inferrer.Observe(record)
+		if maxRows > 0 && inferrer.rows >= maxRows {
+			break
+		}
+	}
+
+	if inferrer.header == nil {
+		return Schema{}, ErrEmptyCSV
+	}
+	return inferrer.Schema(), nil
+}
+
+// resolveType picks the most specific type every sampled value satisfied
+func resolveType(col columnState) string {
+	if !col.seen {
+		return TypeString
+	}
+	switch {
+	case col.candidates&canInt != 0:
+		return TypeInt
+	case col.candidates&canFloat != 0:
+		return TypeFloat
+	case col.candidates&canBool != 0:
+		return TypeBool
+	case col.candidates&canDate != 0:
+		return TypeDate
+	default:
+		return TypeString
+	}
+}
+
+// classify returns the candidate types a single non-null value satisfies
+func classify(value string) int {
+	candidates := 0
+	if floatPattern.MatchString(value) {
+		if hasLeadingZero(value) {
+			return 0 // Identifiers like ZIP codes and account numbers lose meaning as numbers
+		}
+		candidates |= canFloat
+		if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+			candidates |= canInt
+		}
+	}
+	if strings.EqualFold(value, "true") || strings.EqualFold(value, "false") {
+		candidates |= canBool
+	}
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			candidates |= canDate
+			break
+		}
+	}
+	return candidates
+}
+
+// hasLeadingZero reports numbers like "007" or "-01.5"; "0" and "0.5" are fine
+func hasLeadingZero(value string) bool {
+	digits := strings.TrimLeft(value, "+-")
+	return len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9'
+}
+
+func isNull(value string) bool {
+	return value == "" || strings.EqualFold(value, "null")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
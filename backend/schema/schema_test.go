@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferColumnTypes(t *testing.T) {
+	cases := []struct {
+		name     string
+		values   []string // One data row each, under a single column
+		want     string
+		nullable bool
+	}{
+		{"integers", []string{"1", "-20", "+3"}, TypeInt, false},
+		{"integers and decimals", []string{"1", "2.5", "1e3"}, TypeFloat, false},
+		{"zero and fractions below one", []string{"0", "0.5", ".25"}, TypeFloat, false},
+		{"leading zeros", []string{"007", "123"}, TypeString, false},
+		{"signed leading zeros", []string{"-01.5"}, TypeString, false},
+		{"booleans", []string{"true", "FALSE", "True"}, TypeBool, false},
+		{"dates", []string{"2024-01-31", "2024/02/01", "03/15/2024"}, TypeDate, false},
+		{"timestamps", []string{"2024-01-31T10:00:00Z", "2024-01-31 10:00:00"}, TypeDate, false},
+		{"numbers and words", []string{"1", "two", "3"}, TypeString, false},
+		{"numbers and booleans", []string{"1", "true"}, TypeString, false},
+		{"numbers and dates", []string{"2024-01-31", "5"}, TypeString, false},
+		{"NaN and Inf", []string{"NaN", "Inf"}, TypeString, false},
+		{"integer with nulls", []string{"", "4", "null", " NULL "}, TypeInt, true},
+		{"all empty", []string{"", "", ""}, TypeString, true},
+		{"all null", []string{"null", "NULL"}, TypeString, true},
+	}
+	for _, tc := range cases {
+		csvText := "value\n" + strings.Join(tc.values, "\n") + "\n"
+		got, err := Infer(strings.NewReader(csvText), 0)
+		if err != nil {
+			t.Errorf("%s: Infer: %v", tc.name, err)
+			continue
+		}
+		if column := got.Columns[0]; column.Type != tc.want || column.Nullable != tc.nullable {
+			t.Errorf("%s: %s nullable %t, want %s nullable %t", tc.name, column.Type, column.Nullable, tc.want, tc.nullable)
+		}
+	}
+}
+
+func TestInferColumnsIndependently(t *testing.T) {
+	const csvText = "id,zip,score,note,active\n1,02134,1.5,,true\n2,10001,2,,false\n3,94105,x,,\n"
+	got, err := Infer(strings.NewReader(csvText), 0)
+	if err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+	want := Schema{
+		Columns: []Column{
+			{Name: "id", Type: TypeInt, Examples: []string{"1", "2", "3"}},
+			{Name: "zip", Type: TypeString, Examples: []string{"02134", "10001", "94105"}},
+			{Name: "score", Type: TypeString, Examples: []string{"1.5", "2", "x"}},
+			{Name: "note", Type: TypeString, Nullable: true, Examples: []string{}},
+			{Name: "active", Type: TypeBool, Nullable: true, Examples: []string{"true", "false"}},
+		},
+		SampledRows: 3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("schema\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestInferSamplesRows(t *testing.T) {
+	// The word past the sample doesn't make the column a string
+	got, err := Infer(strings.NewReader("n\n1\n2\nthree\n"), 2)
+	if err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+	if got.SampledRows != 2 || got.Columns[0].Type != TypeInt {
+		t.Errorf("sampled %d rows as %s, want 2 as %s", got.SampledRows, got.Columns[0].Type, TypeInt)
+	}
+}
+
+func TestInferKeepsDistinctExamples(t *testing.T) {
+	got, err := Infer(strings.NewReader("n\n1\n1\n2\n3\n4\n"), 0)
+	if err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+	if examples := got.Columns[0].Examples; !reflect.DeepEqual(examples, []string{"1", "2", "3"}) {
+		t.Errorf("examples %v, want the first three distinct values", examples)
+	}
+}
+
+func TestInferToleratesATruncatedLastRecord(t *testing.T) {
+	// Sampling the first bytes of a file can cut a quoted field short
+	got, err := Infer(strings.NewReader("id,name\n1,alpha\n2,\"be"), 0)
+	if err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+	if got.SampledRows != 1 || got.Columns[0].Type != TypeInt {
+		t.Errorf("sampled %d rows, id %s, want the one whole row", got.SampledRows, got.Columns[0].Type)
+	}
+}
+
+func TestInferNeedsAHeader(t *testing.T) {
+	if _, err := Infer(strings.NewReader(""), 0); !errors.Is(err, ErrEmptyCSV) {
+		t.Errorf("empty input: %v, want ErrEmptyCSV", err)
+	}
+}
+
+func TestInferShortRowsAreNull(t *testing.T) {
+	got, err := Infer(strings.NewReader("a,b\n1\n2,3\n"), 0)
+	if err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+	if b := got.Columns[1]; b.Type != TypeInt || !b.Nullable {
+		t.Errorf("column b %s nullable %t, want %s nullable", b.Type, b.Nullable, TypeInt)
+	}
+}
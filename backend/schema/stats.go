@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+)
+
+type columnAccumulator struct {
+	nulls          int
+	numeric        bool // Every non-null value so far parsed as a number
+	count          int  // Non-null values
+	sum            float64
+	min            float64
+	max            float64
+	distinct       map[string]struct{}
+	distinctCapped bool
+}
+
+// StatsCollector accumulates per-column statistics one record at a time. The first record
+// observed is the header. Distinct values are tracked up to maxDistinct per column so a
+// unique-ID column can't grow memory without bound
+type StatsCollector struct {
+	maxDistinct int
+	header      []string
+	columns     []columnAccumulator
+	rows        int
+}
+
+// NewStatsCollector creates a StatsCollector with the given per-column cardinality limit
+func NewStatsCollector(maxDistinct int) *StatsCollector {
+	return &StatsCollector{maxDistinct: maxDistinct}
+}
+
+// Observe feeds the next record to the collector
+func (sc *StatsCollector) Observe(record []string) {
+	if sc.header == nil {
+		sc.header = append([]string{}, record...)
+		sc.columns = make([]columnAccumulator, len(record))
+		for i := range sc.columns {
+			sc.columns[i].numeric = true
+			sc.columns[i].distinct = make(map[string]struct{})
+		}
+		return
+	}
+	sc.rows++
+
+	for i := range sc.columns {
+		col := &sc.columns[i]
+		value := ""
+		if i < len(record) {
+			value = strings.TrimSpace(record[i])
+		}
+		if isNull(value) {
+			col.nulls++
+			continue
+		}
+
+		if col.numeric {
+			if n, err := strconv.ParseFloat(value, 64); err == nil && floatPattern.MatchString(value) {
+				if col.count == 0 || n < col.min {
+					col.min = n
+				}
+				if col.count == 0 || n > col.max {
+					col.max = n
+				}
+				col.sum += n
+			} else {
+				col.numeric = false
+			}
+		}
+		col.count++
+
+		if !col.distinctCapped {
+			if _, ok := col.distinct[value]; !ok {
+				if len(col.distinct) >= sc.maxDistinct {
+					col.distinctCapped = true
+					col.distinct = nil // Release the set; the capped count is all that's reported
+				} else {
+					col.distinct[value] = struct{}{}
+				}
+			}
+		}
+	}
+}
+
+// Stats returns the statistics for the records observed so far
+func (sc *StatsCollector) Stats() models.CSVStats {
+	stats := models.CSVStats{
+		RowCount:    sc.rows,
+		ColumnCount: len(sc.columns),
+		Columns:     make([]models.ColumnStats, len(sc.columns)),
+	}
+	for i, col := range sc.columns {
+		column := models.ColumnStats{
+			Name:           sc.header[i],
+			NullCount:      col.nulls,
+			Numeric:        col.numeric && col.count > 0,
+			DistinctCount:  len(col.distinct),
+			DistinctCapped: col.distinctCapped,
+		}
+		if col.distinctCapped {
+			column.DistinctCount = sc.maxDistinct
+		}
+		if sc.rows > 0 {
+			column.NullPercent = float64(col.nulls) * 100 / float64(sc.rows)
+		}
+		if column.Numeric {
+			minValue, maxValue, mean := col.min, col.max, col.sum/float64(col.count)
+			column.Min, column.Max, column.Mean = &minValue, &maxValue, &mean
+		}
+		stats.Columns[i] = column
+	}
+	return stats
+}
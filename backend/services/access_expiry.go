@@ -0,0 +1,102 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+)
+
+// LedgerTimestamp returns the timestamp of the node's latest ledger, in seconds. Grant
+// expiry is judged by it rather than the local clock, which can drift from the chain's
+func (s *AptosServiceImpl) LedgerTimestamp() (uint64, error) {
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
+
+	body, status, err := s.getWithRetry(nodeURL+"/v1", "ledger info")
+	if err != nil {
+		return 0, err
+	}
+	if status == http.StatusNotFound {
+		return 0, fmt.Errorf("ledger info not found")
+	}
+
+	var ledgerInfo struct {
+		LedgerTimestamp string `json:"ledger_timestamp"` // Microseconds
+	}
+	if err := json.Unmarshal(body, &ledgerInfo); err != nil {
+		return 0, fmt.Errorf("failed to decode ledger info: %w", err)
+	}
+
+	timestamp, err := strconv.ParseUint(ledgerInfo.LedgerTimestamp, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ledger timestamp %q: %w", ledgerInfo.LedgerTimestamp, err)
+	}
+	return timestamp / 1_000_000, nil
+}
+
+// GetAccessGrant returns requester's grant on the dataset with Expired judged by the
+// ledger clock, or nil when there is none because it was never made or was revoked
+func (s *AptosServiceImpl) GetAccessGrant(owner string, datasetID uint64, requester string) (*models.AccessGrant, error) {
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return nil, err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := s.findAccessEntry(ownerAddr.String(), datasetID, requesterAddr.String())
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	now, err := s.LedgerTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the ledger clock: %w", err)
+	}
+	grant := accessGrant(*entry, now, s.cfg.AccessExpirySkew)
+	return &grant, nil
+}
+
+// findAccessEntry looks up one AccessList entry, in the local index when it's ready and
+// in the owner's resource otherwise
+func (s *AptosServiceImpl) findAccessEntry(owner string, datasetID uint64, requester string) (*accessListEntry, error) {
+	if index := s.localIndex(); index != nil {
+		grant, err := index.Grant(owner, datasetID, requester)
+		if err == nil {
+			if grant == nil {
+				return nil, nil
+			}
+			expiresAt := grant.ExpiresAt
+			// The index clamps deadlines to what SQLite stores
+			if expiresAt >= math.MaxInt64 {
+				expiresAt = math.MaxUint64
+			}
+			return &accessListEntry{DatasetID: datasetID, Requester: requester, ExpiresAt: expiresAt}, nil
+		}
+		fmt.Printf("WARNING: Local index access check failed, asking the chain: %v\n", err)
+	}
+
+	entries, err := s.accessList(owner)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.DatasetID == datasetID && e.Requester == requester {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+// grantExpired reports whether a grant with the on-chain expires_at has expired at
+// ledger time now. As in AccessControl::has_access a grant lasts through its expires_at
+// second; skew (ACCESS_EXPIRY_SKEW) seconds more are allowed for the ledger lagging the chain
+func grantExpired(expiresAt uint64, now uint64, skew int) bool {
+	allowed := uint64(max(skew, 0))
+	return now > allowed && expiresAt < now-allowed
+}
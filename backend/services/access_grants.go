@@ -0,0 +1,162 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+)
+
+// accessListEntry is one Access entry of an owner's AccessControl::AccessList
+type accessListEntry struct {
+	DatasetID uint64
+	Requester string // Normalized
+	ExpiresAt uint64 // As stored on chain
+}
+
+// GetAllGrantsByOwner returns every grant in the owner's AccessControl resource, across
+// all their datasets, sorted by dataset then requester
+func (s *AptosServiceImpl) GetAllGrantsByOwner(owner string) ([]models.AccessGrant, error) {
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.accessList(ownerAddr.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return []models.AccessGrant{}, nil
+	}
+
+	// Names are a nicety; the grants are still worth returning without them
+	datasets, err := s.GetUserDatasetsMetadata(ownerAddr.String())
+	if err != nil {
+		fmt.Printf("WARNING: Failed to load dataset names for %s's grants: %v\n", ownerAddr.String(), err)
+	}
+	now, err := s.LedgerTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the ledger clock: %w", err)
+	}
+	return flattenGrants(entries, datasetNames(datasets), now, s.cfg.AccessExpirySkew), nil
+}
+
+// accessList reads the entries of an owner's AccessControl::AccessList. An owner who never
+// granted anything has none
+func (s *AptosServiceImpl) accessList(owner string) ([]accessListEntry, error) {
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return nil, err
+	}
+	moduleAddr, err := parseAddress(s.cfg.NetworkModuleAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceType := fmt.Sprintf("%s::AccessControl::AccessList", moduleAddr.String())
+	resourceURL := fmt.Sprintf("%s/v1/accounts/%s/resource/%s",
+		strings.TrimSuffix(s.cfg.AptosNodeURL, "/"),
+		ownerAddr.String(),
+		url.PathEscape(resourceType))
+
+	body, status, err := s.getWithRetry(resourceURL, "AccessList")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query AccessList resource: %w", err)
+	}
+	if status == http.StatusNotFound {
+		// AccessControl is only initialized by the first grant
+		return nil, nil
+	}
+
+	var resource struct {
+		Data struct {
+			Entries []struct {
+				DatasetID string `json:"dataset_id"`
+				Requester string `json:"requester"`
+				ExpiresAt string `json:"expires_at"`
+			} `json:"entries"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resource); err != nil {
+		return nil, fmt.Errorf("failed to decode AccessList resource: %w", err)
+	}
+
+	entries := make([]accessListEntry, 0, len(resource.Data.Entries))
+	for _, e := range resource.Data.Entries {
+		datasetID, err := strconv.ParseUint(e.DatasetID, 10, 64)
+		if err != nil {
+			continue
+		}
+		requester, err := parseAddress(e.Requester)
+		if err != nil {
+			continue
+		}
+		expiresAt, err := strconv.ParseUint(e.ExpiresAt, 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, accessListEntry{DatasetID: datasetID, Requester: requester.String(), ExpiresAt: expiresAt})
+	}
+	return entries, nil
+}
+
+// flattenGrants turns AccessList entries into grants, named from names and sorted by
+// dataset then requester, with expiry judged at ledger time now allowing skew seconds
+func flattenGrants(entries []accessListEntry, names map[uint64]string, now uint64, skew int) []models.AccessGrant {
+	grants := make([]models.AccessGrant, 0, len(entries))
+	for _, e := range entries {
+		grant := accessGrant(e, now, skew)
+		grant.DatasetName = names[e.DatasetID]
+		grants = append(grants, grant)
+	}
+
+	sort.SliceStable(grants, func(i, j int) bool {
+		if grants[i].DatasetID != grants[j].DatasetID {
+			return grants[i].DatasetID < grants[j].DatasetID
+		}
+		return grants[i].Requester < grants[j].Requester
+	})
+	return grants
+}
+
+// accessGrant turns an AccessList entry into a grant, with expiry judged at ledger time now
+// allowing skew seconds
+func accessGrant(e accessListEntry, now uint64, skew int) models.AccessGrant {
+	grant := models.AccessGrant{
+		DatasetID: e.DatasetID,
+		Requester: e.Requester,
+		ExpiresAt: e.ExpiresAt,
+		Expired:   grantExpired(e.ExpiresAt, now, skew),
+	}
+	// Grants that never expire are stored as the latest deadline; report them as 0 like the API takes them
+	if grant.ExpiresAt == math.MaxUint64 {
+		grant.ExpiresAt = 0
+	}
+	return grant
+}
+
+// datasetNames maps dataset IDs to the names in their metadata, for datasets that have one
+func datasetNames(datasets []interface{}) map[uint64]string {
+	names := make(map[uint64]string, len(datasets))
+	for _, d := range datasets {
+		datasetMap, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, ok := datasetMap["id"].(uint64)
+		if !ok {
+			continue
+		}
+		rawMetadata, _ := datasetMap["metadata"].(string)
+		if meta, _ := ParseDatasetMetadata(rawMetadata); meta.Name != "" {
+			names[id] = meta.Name
+		}
+	}
+	return names
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/datax/backend/models"
+)
+
+func TestGetAllGrantsByOwnerFlattensTheAccessList(t *testing.T) {
+	node := newFakeNode(t)
+	service := newTestService(t, node, func(cfg *ServiceConfig) { cfg.AccessExpirySkew = 0 })
+	const now = 1_800_000_000
+	node.handleJSON("/v1", map[string]string{"ledger_timestamp": strconv.FormatUint(now*1_000_000, 10)})
+	// Grants on three datasets, in the order they were made rather than sorted
+	node.handleJSON(accessListPath(testOwnerA), map[string]interface{}{
+		"data": map[string]interface{}{"entries": []map[string]string{
+			accessListEntryJSON(2, testOwnerC, now+60),
+			accessListEntryJSON(0, testOwnerC, math.MaxUint64),
+			accessListEntryJSON(2, testOwnerB, now-60),
+			accessListEntryJSON(0, testOwnerB, now+3600),
+			accessListEntryJSON(1, testOwnerB, now),
+		}},
+	})
+	// Dataset 1 has no name in its metadata
+	node.handleJSON(dataStorePath(testOwnerA), dataStoreResource(
+		testDataset{id: 0, metadata: `{"name":"weather","description":"test"}`, createdAt: 100, active: true},
+		testDataset{id: 1, metadata: `{"description":"unnamed"}`, createdAt: 200, active: true},
+		testDataset{id: 2, metadata: `{"name":"traffic","description":"test"}`, createdAt: 300, active: true},
+	))
+
+	grants, err := service.GetAllGrantsByOwner(testOwnerA)
+	if err != nil {
+		t.Fatalf("GetAllGrantsByOwner: %v", err)
+	}
+	want := []models.AccessGrant{
+		{DatasetID: 0, DatasetName: "weather", Requester: mustAddress(testOwnerB), ExpiresAt: now + 3600},
+		{DatasetID: 0, DatasetName: "weather", Requester: mustAddress(testOwnerC), ExpiresAt: 0}, // Never expires
+		{DatasetID: 1, Requester: mustAddress(testOwnerB), ExpiresAt: now},                       // Lasts through its expires_at second
+		{DatasetID: 2, DatasetName: "traffic", Requester: mustAddress(testOwnerB), ExpiresAt: now - 60, Expired: true},
+		{DatasetID: 2, DatasetName: "traffic", Requester: mustAddress(testOwnerC), ExpiresAt: now + 60},
+	}
+	if !reflect.DeepEqual(grants, want) {
+		t.Errorf("grants =\n%+v\nwant\n%+v", grants, want)
+	}
+	// The whole list comes from one read of the resource
+	if hits := node.count(accessListPath(testOwnerA)); hits != 1 {
+		t.Errorf("AccessList read %d times, want once", hits)
+	}
+}
+
+func TestGetAllGrantsByOwnerWithoutAnAccessList(t *testing.T) {
+	node := newFakeNode(t)
+	service := newTestService(t, node, nil)
+
+	// The owner never granted anything, so the AccessList resource doesn't exist
+	grants, err := service.GetAllGrantsByOwner(testOwnerC)
+	if err != nil || grants == nil || len(grants) != 0 {
+		t.Errorf("GetAllGrantsByOwner = %#v, %v, want an empty list", grants, err)
+	}
+	if _, err := service.GetAllGrantsByOwner("not-an-address"); err == nil {
+		t.Error("a malformed owner was accepted")
+	}
+}
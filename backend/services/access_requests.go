@@ -0,0 +1,290 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/internal/db"
+	"github.com/datax/backend/models"
+)
+
+// Access request statuses in the escrow flow: the owner approves or denies a pending
+// request, then the requester pays for an approved one
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+	AccessRequestPaid     = "paid"
+)
+
+const (
+	// accessRequestStateKey is the state document holding every access request when there's no database
+	accessRequestStateKey = "system/access-requests.json"
+	// accessRequestStateConflicts is how many times a write that lost to another instance is retried
+	accessRequestStateConflicts = 3
+)
+
+var (
+	// ErrAccessRequestNotFound is returned when no request was made for the owner, requester and dataset
+	ErrAccessRequestNotFound = errors.New("access request not found")
+	// ErrAccessRequestStatus is returned when a request isn't in the status a transition starts from
+	ErrAccessRequestStatus = errors.New("access request is not in the expected status")
+	// ErrPaymentAlreadyUsed is returned when a payment transaction already paid for another request
+	ErrPaymentAlreadyUsed = errors.New("payment transaction already paid for another access request")
+)
+
+// AccessRequestRepository stores the escrow state of access requests, keyed by owner,
+// requester and dataset. Addresses are expected in normalized form
+type AccessRequestRepository interface {
+	// Create stores a pending request and returns it. An existing request is returned
+	// unchanged, unless it was denied: asking again reopens it
+	Create(request models.AccessRequest) (models.AccessRequest, error)
+	Get(owner string, requester string, datasetID uint64) (models.AccessRequest, error)
+	// ListByOwner and ListByRequester return requests newest first
+	ListByOwner(owner string) ([]models.AccessRequest, error)
+	ListByRequester(requester string) ([]models.AccessRequest, error)
+	// Transition moves a request from one status to another, recording payment when it's
+	// paid. Returns ErrAccessRequestStatus when the request isn't in the from status and
+	// ErrPaymentAlreadyUsed when payment's transaction already paid for another request
+	Transition(owner string, requester string, datasetID uint64, from string, to string, payment *models.VerifiedPayment) (models.AccessRequest, error)
+}
+
+// sqlAccessRequests keeps access requests in the DATABASE_URL database
+type sqlAccessRequests struct {
+	db *db.DB
+}
+
+// NewSQLAccessRequestRepository returns a repository backed by the database
+func NewSQLAccessRequestRepository(database *db.DB) AccessRequestRepository {
+	return &sqlAccessRequests{db: database}
+}
+
+func (r *sqlAccessRequests) Create(request models.AccessRequest) (models.AccessRequest, error) {
+	return r.db.CreateAccessRequest(request)
+}
+
+func (r *sqlAccessRequests) Get(owner string, requester string, datasetID uint64) (models.AccessRequest, error) {
+	request, err := r.db.GetAccessRequest(owner, requester, datasetID)
+	return request, accessRequestError(err)
+}
+
+func (r *sqlAccessRequests) ListByOwner(owner string) ([]models.AccessRequest, error) {
+	return r.db.ListAccessRequestsByOwner(owner)
+}
+
+func (r *sqlAccessRequests) ListByRequester(requester string) ([]models.AccessRequest, error) {
+	return r.db.ListAccessRequestsByRequester(requester)
+}
+
+func (r *sqlAccessRequests) Transition(owner string, requester string, datasetID uint64, from string, to string, payment *models.VerifiedPayment) (models.AccessRequest, error) {
+	request, err := r.db.TransitionAccessRequest(owner, requester, datasetID, from, to, payment)
+	return request, accessRequestError(err)
+}
+
+// accessRequestError maps database errors onto the repository's
+func accessRequestError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return ErrAccessRequestNotFound
+	case errors.Is(err, db.ErrConflict):
+		return ErrAccessRequestStatus
+	case errors.Is(err, db.ErrDuplicate):
+		return ErrPaymentAlreadyUsed
+	}
+	return err
+}
+
+// stateAccessRequests keeps access requests as one JSON document in the state store, for
+// deployments without a database, or in memory when the storage backend has no state store
+type stateAccessRequests struct {
+	store  StateStore // nil keeps requests in memory, lost on restart
+	mu     sync.Mutex
+	memory []models.AccessRequest
+}
+
+// NewStateAccessRequestRepository returns a repository backed by store, which may be nil
+func NewStateAccessRequestRepository(store StateStore) AccessRequestRepository {
+	return &stateAccessRequests{store: store}
+}
+
+func (r *stateAccessRequests) Create(request models.AccessRequest) (models.AccessRequest, error) {
+	var created models.AccessRequest
+	err := r.update(func(requests []models.AccessRequest) ([]models.AccessRequest, error) {
+		now := time.Now().UTC().Format(time.RFC3339)
+		for i, existing := range requests {
+			if !sameAccessRequest(existing, request.OwnerAddress, request.RequesterAddress, request.DatasetID) {
+				continue
+			}
+			if existing.Status == AccessRequestDenied {
+				existing.Status = AccessRequestPending
+				existing.Message = request.Message
+				existing.PriceAPT = request.PriceAPT
+				existing.PaymentTxHash = ""
+				existing.PaidAmountOctas = 0
+				existing.PaymentVersion = 0
+				existing.CreatedAt = now
+				existing.ApprovedAt = ""
+				existing.PaidAt = ""
+				requests[i] = existing
+			}
+			created = requests[i]
+			return requests, nil
+		}
+
+		id, err := randomAccessRequestID()
+		if err != nil {
+			return nil, err
+		}
+		request.ID = id
+		request.Status = AccessRequestPending
+		request.PaymentTxHash = ""
+		request.CreatedAt = now
+		request.ApprovedAt = ""
+		request.PaidAt = ""
+		created = request
+		return append(requests, request), nil
+	})
+	return created, err
+}
+
+func (r *stateAccessRequests) Get(owner string, requester string, datasetID uint64) (models.AccessRequest, error) {
+	requests, err := r.load()
+	if err != nil {
+		return models.AccessRequest{}, err
+	}
+	for _, request := range requests {
+		if sameAccessRequest(request, owner, requester, datasetID) {
+			return request, nil
+		}
+	}
+	return models.AccessRequest{}, ErrAccessRequestNotFound
+}
+
+func (r *stateAccessRequests) ListByOwner(owner string) ([]models.AccessRequest, error) {
+	return r.list(func(request models.AccessRequest) bool { return request.OwnerAddress == owner })
+}
+
+func (r *stateAccessRequests) ListByRequester(requester string) ([]models.AccessRequest, error) {
+	return r.list(func(request models.AccessRequest) bool { return request.RequesterAddress == requester })
+}
+
+func (r *stateAccessRequests) Transition(owner string, requester string, datasetID uint64, from string, to string, payment *models.VerifiedPayment) (models.AccessRequest, error) {
+	var updated models.AccessRequest
+	err := r.update(func(requests []models.AccessRequest) ([]models.AccessRequest, error) {
+		if payment != nil {
+			for _, request := range requests {
+				if request.PaymentTxHash != "" && NormalizeTxHash(request.PaymentTxHash) == payment.TxHash &&
+					!sameAccessRequest(request, owner, requester, datasetID) {
+					return nil, ErrPaymentAlreadyUsed
+				}
+			}
+		}
+		for i, request := range requests {
+			if !sameAccessRequest(request, owner, requester, datasetID) {
+				continue
+			}
+			if request.Status != from {
+				return nil, ErrAccessRequestStatus
+			}
+			now := time.Now().UTC().Format(time.RFC3339)
+			request.Status = to
+			switch to {
+			case AccessRequestApproved:
+				request.ApprovedAt = now
+			case AccessRequestPaid:
+				request.PaidAt = now
+			}
+			if payment != nil {
+				request.PaymentTxHash = payment.TxHash
+				request.PaidAmountOctas = payment.AmountOctas
+				request.PaymentVersion = payment.Version
+			}
+			requests[i] = request
+			updated = request
+			return requests, nil
+		}
+		return nil, ErrAccessRequestNotFound
+	})
+	return updated, err
+}
+
+func (r *stateAccessRequests) list(match func(models.AccessRequest) bool) ([]models.AccessRequest, error) {
+	requests, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]models.AccessRequest, 0)
+	for _, request := range requests {
+		if match(request) {
+			matched = append(matched, request)
+		}
+	}
+	// RFC3339 UTC timestamps sort chronologically as strings
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].CreatedAt > matched[j].CreatedAt })
+	return matched, nil
+}
+
+func (r *stateAccessRequests) load() ([]models.AccessRequest, error) {
+	if r.store == nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return append([]models.AccessRequest(nil), r.memory...), nil
+	}
+
+	var requests []models.AccessRequest
+	_, err := r.store.LoadState(accessRequestStateKey, &requests)
+	if errors.Is(err, ErrStateNotFound) {
+		return nil, nil
+	}
+	return requests, err
+}
+
+// update applies fn to the stored requests and saves the result, reloading and applying
+// fn again when another instance wrote the document in between
+func (r *stateAccessRequests) update(fn func([]models.AccessRequest) ([]models.AccessRequest, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.store == nil {
+		requests, err := fn(append([]models.AccessRequest(nil), r.memory...))
+		if err != nil {
+			return err
+		}
+		r.memory = requests
+		return nil
+	}
+
+	for range accessRequestStateConflicts {
+		var requests []models.AccessRequest
+		etag, err := r.store.LoadState(accessRequestStateKey, &requests)
+		if err != nil && !errors.Is(err, ErrStateNotFound) {
+			return err
+		}
+		requests, err = fn(requests)
+		if err != nil {
+			return err
+		}
+		_, err = r.store.SaveState(accessRequestStateKey, requests, etag)
+		if !errors.Is(err, ErrStateConflict) {
+			return err
+		}
+	}
+	return ErrStateConflict
+}
+
+func sameAccessRequest(request models.AccessRequest, owner string, requester string, datasetID uint64) bool {
+	return request.OwnerAddress == owner && request.RequesterAddress == requester && request.DatasetID == datasetID
+}
+
+func randomAccessRequestID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate access request ID: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/config"
+)
+
+var (
+	// ErrAccessTokenInvalid is returned for a token that is malformed, wasn't signed with
+	// this server's secret, or stands for another dataset or requester
+	ErrAccessTokenInvalid = errors.New("invalid access token")
+	// ErrAccessTokenExpired is returned for a token past its expiry
+	ErrAccessTokenExpired = errors.New("access token has expired")
+	// ErrAccessTokenRevoked is returned for a token issued before its grant was revoked
+	ErrAccessTokenRevoked = errors.New("access token was revoked")
+)
+
+// accessTokenVersion starts every token payload, so the format can change later
+const accessTokenVersion = "v1"
+
+// accessTokenSubject is the grant a token stands for
+type accessTokenSubject struct {
+	owner     string
+	datasetID uint64
+	requester string
+}
+
+// AccessTokenService issues short-lived tokens that let a requester skip the wallet
+// signature and access check on later reads of the same dataset. A token is an HMAC over
+// the owner, dataset, requester, issue time and expiry. Revocations are kept for one TTL,
+// after which every token issued before them has expired anyway
+type AccessTokenService struct {
+	secret []byte
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	revoked map[accessTokenSubject]int64 // When each grant was revoked, Unix seconds
+}
+
+func NewAccessTokenService() *AccessTokenService {
+	secret := []byte(config.AppConfig.AccessTokenSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+		fmt.Printf("WARNING: ACCESS_TOKEN_SECRET is not set, so access tokens only work on this instance until it restarts\n")
+	}
+	return &AccessTokenService{
+		secret:  secret,
+		ttl:     time.Duration(config.AppConfig.AccessTokenTTL) * time.Second,
+		revoked: make(map[accessTokenSubject]int64),
+	}
+}
+
+// Issue returns a token for requester's access to the dataset and when it expires. notAfter
+// (Unix seconds, 0 for none) caps the expiry, so a token doesn't outlive its grant
+func (s *AccessTokenService) Issue(owner string, datasetID uint64, requester string, notAfter uint64) (string, time.Time, error) {
+	subject, err := newAccessTokenSubject(owner, datasetID, requester)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	issuedAt := time.Now()
+	expiresAt := issuedAt.Add(s.ttl)
+	if notAfter != 0 && notAfter < uint64(expiresAt.Unix()) {
+		expiresAt = time.Unix(int64(notAfter), 0)
+	}
+
+	payload := strings.Join([]string{
+		accessTokenVersion,
+		subject.owner,
+		strconv.FormatUint(subject.datasetID, 10),
+		subject.requester,
+		strconv.FormatInt(issuedAt.Unix(), 10),
+		strconv.FormatInt(expiresAt.Unix(), 10),
+	}, "|")
+	token := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload))
+	return token, expiresAt, nil
+}
+
+// Verify checks that token was issued by this server for requester's access to the
+// dataset, hasn't expired and wasn't issued before the grant was revoked
+func (s *AccessTokenService) Verify(token string, owner string, datasetID uint64, requester string) error {
+	subject, err := newAccessTokenSubject(owner, datasetID, requester)
+	if err != nil {
+		return ErrAccessTokenInvalid
+	}
+
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrAccessTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return ErrAccessTokenInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.sign(string(payload))) {
+		return ErrAccessTokenInvalid
+	}
+
+	fields := strings.Split(string(payload), "|")
+	if len(fields) != 6 || fields[0] != accessTokenVersion {
+		return ErrAccessTokenInvalid
+	}
+	if fields[1] != subject.owner || fields[2] != strconv.FormatUint(subject.datasetID, 10) || fields[3] != subject.requester {
+		return ErrAccessTokenInvalid
+	}
+	issuedAt, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return ErrAccessTokenInvalid
+	}
+	expiresAt, err := strconv.ParseInt(fields[5], 10, 64)
+	if err != nil {
+		return ErrAccessTokenInvalid
+	}
+
+	if time.Now().Unix() >= expiresAt {
+		return ErrAccessTokenExpired
+	}
+	s.mu.Lock()
+	revokedAt, revoked := s.revoked[subject]
+	s.mu.Unlock()
+	// A token from the same second as the revocation may predate it, so it goes too
+	if revoked && issuedAt <= revokedAt {
+		return ErrAccessTokenRevoked
+	}
+	return nil
+}
+
+// Revoke invalidates the tokens issued so far for requester's access to the dataset
+func (s *AccessTokenService) Revoke(owner string, datasetID uint64, requester string) error {
+	subject, err := newAccessTokenSubject(owner, datasetID, requester)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	// Tokens issued before an old revocation have all expired, so it can be forgotten
+	for other, revokedAt := range s.revoked {
+		if now-revokedAt > int64(s.ttl/time.Second) {
+			delete(s.revoked, other)
+		}
+	}
+	s.revoked[subject] = now
+	return nil
+}
+
+// sign is the HMAC-SHA256 of a token payload under the server secret
+func (s *AccessTokenService) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func newAccessTokenSubject(owner string, datasetID uint64, requester string) (accessTokenSubject, error) {
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return accessTokenSubject{}, err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return accessTokenSubject{}, err
+	}
+	return accessTokenSubject{owner: ownerAddr.String(), datasetID: datasetID, requester: requesterAddr.String()}, nil
+}
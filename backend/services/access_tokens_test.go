@@ -0,0 +1,160 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAccessTokens returns a token service with a fixed secret and a one hour TTL
+func newTestAccessTokens(secret string) *AccessTokenService {
+	return &AccessTokenService{secret: []byte(secret), ttl: time.Hour, revoked: make(map[accessTokenSubject]int64)}
+}
+
+// issueTestToken issues a token for testOwnerB's access to testOwnerA's dataset 3
+func issueTestToken(t *testing.T, tokens *AccessTokenService, notAfter uint64) string {
+	t.Helper()
+	token, _, err := tokens.Issue(testOwnerA, 3, testOwnerB, notAfter)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return token
+}
+
+func TestAccessTokenVerifiesForItsGrantOnly(t *testing.T) {
+	tokens := newTestAccessTokens("secret")
+	token, expiresAt, err := tokens.Issue(testOwnerA, 3, testOwnerB, 0)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if until := time.Until(expiresAt); until <= 59*time.Minute || until > time.Hour {
+		t.Errorf("token expires in %s, want the one hour TTL", until)
+	}
+	// Addresses are compared in their canonical form
+	if err := tokens.Verify(token, "0xa001", 3, strings.ToUpper(testOwnerB[2:])); err != nil {
+		t.Errorf("Verify of a fresh token: %v", err)
+	}
+
+	cases := []struct {
+		name             string
+		owner, requester string
+		datasetID        uint64
+	}{
+		{"another dataset", testOwnerA, testOwnerB, 4},
+		{"another owner", testOwnerC, testOwnerB, 3},
+		{"another requester", testOwnerA, testOwnerC, 3},
+		{"owner and requester swapped", testOwnerB, testOwnerA, 3},
+		{"malformed requester", testOwnerA, "not-an-address", 3},
+	}
+	for _, tc := range cases {
+		if err := tokens.Verify(token, tc.owner, tc.datasetID, tc.requester); !errors.Is(err, ErrAccessTokenInvalid) {
+			t.Errorf("%s: Verify = %v, want %v", tc.name, err, ErrAccessTokenInvalid)
+		}
+	}
+}
+
+func TestAccessTokenExpires(t *testing.T) {
+	tokens := newTestAccessTokens("secret")
+
+	// A grant that has already ended caps the token's expiry in the past
+	token := issueTestToken(t, tokens, uint64(time.Now().Add(-time.Minute).Unix()))
+	if err := tokens.Verify(token, testOwnerA, 3, testOwnerB); !errors.Is(err, ErrAccessTokenExpired) {
+		t.Errorf("Verify of an expired token = %v, want %v", err, ErrAccessTokenExpired)
+	}
+
+	// A grant ending within the TTL caps the expiry; one ending after it doesn't
+	notAfter := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	if _, expiresAt, _ := tokens.Issue(testOwnerA, 3, testOwnerB, uint64(notAfter.Unix())); !expiresAt.Equal(notAfter) {
+		t.Errorf("token for a grant ending at %s expires at %s", notAfter, expiresAt)
+	}
+	if _, expiresAt, _ := tokens.Issue(testOwnerA, 3, testOwnerB, uint64(time.Now().Add(48*time.Hour).Unix())); time.Until(expiresAt) > time.Hour {
+		t.Errorf("token for a grant ending in two days expires at %s, past the TTL", expiresAt)
+	}
+}
+
+func TestAccessTokenRejectsTampering(t *testing.T) {
+	tokens := newTestAccessTokens("secret")
+	token := issueTestToken(t, tokens, 0)
+	encodedPayload, encodedMAC, _ := strings.Cut(token, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(encodedPayload)
+	mac, _ := base64.RawURLEncoding.DecodeString(encodedMAC)
+
+	// resigned re-encodes a payload with the MAC of another secret
+	resigned := func(payload string) string {
+		forger := newTestAccessTokens("guessed")
+		return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(forger.sign(payload))
+	}
+	fields := strings.Split(string(payload), "|")
+	farExpiry := strings.Join(append(fields[:5:5], "9999999999"), "|")
+	flippedMAC := append([]byte{}, mac...)
+	flippedMAC[0] ^= 1
+
+	cases := []struct {
+		name  string
+		token string
+	}{
+		{"expiry pushed out", base64.RawURLEncoding.EncodeToString([]byte(farExpiry)) + "." + encodedMAC},
+		{"dataset changed", base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(payload), "|3|", "|4|", 1))) + "." + encodedMAC},
+		{"signature bit flipped", encodedPayload + "." + base64.RawURLEncoding.EncodeToString(flippedMAC)},
+		{"signature truncated", encodedPayload + "." + base64.RawURLEncoding.EncodeToString(mac[:16])},
+		{"signature missing", encodedPayload},
+		{"signed with another secret", resigned(string(payload))},
+		{"signature not base64", encodedPayload + ".!!"},
+		{"empty", ""},
+	}
+	for _, tc := range cases {
+		if err := tokens.Verify(tc.token, testOwnerA, 3, testOwnerB); !errors.Is(err, ErrAccessTokenInvalid) {
+			t.Errorf("%s: Verify = %v, want %v", tc.name, err, ErrAccessTokenInvalid)
+		}
+	}
+
+	// Another instance sharing the secret accepts the token; one with its own doesn't
+	if err := newTestAccessTokens("secret").Verify(token, testOwnerA, 3, testOwnerB); err != nil {
+		t.Errorf("Verify on an instance sharing the secret: %v", err)
+	}
+	if err := newTestAccessTokens("other").Verify(token, testOwnerA, 3, testOwnerB); !errors.Is(err, ErrAccessTokenInvalid) {
+		t.Errorf("Verify on an instance with another secret = %v, want %v", err, ErrAccessTokenInvalid)
+	}
+}
+
+func TestAccessTokenRevocation(t *testing.T) {
+	tokens := newTestAccessTokens("secret")
+	token := issueTestToken(t, tokens, 0)
+	other, _, _ := tokens.Issue(testOwnerA, 4, testOwnerB, 0)
+
+	if err := tokens.Revoke(testOwnerA, 3, testOwnerB); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := tokens.Verify(token, testOwnerA, 3, testOwnerB); !errors.Is(err, ErrAccessTokenRevoked) {
+		t.Errorf("Verify after revocation = %v, want %v", err, ErrAccessTokenRevoked)
+	}
+	// Tokens for the requester's other grants stand
+	if err := tokens.Verify(other, testOwnerA, 4, testOwnerB); err != nil {
+		t.Errorf("Verify of a token for another dataset after revocation: %v", err)
+	}
+	// A token from the second of the revocation may predate it
+	subject, _ := newAccessTokenSubject(testOwnerA, 3, testOwnerB)
+	sameSecond := issueTestToken(t, tokens, 0)
+	encodedPayload, _, _ := strings.Cut(sameSecond, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(encodedPayload)
+	tokens.revoked[subject], _ = strconv.ParseInt(strings.Split(string(payload), "|")[4], 10, 64)
+	if err := tokens.Verify(sameSecond, testOwnerA, 3, testOwnerB); !errors.Is(err, ErrAccessTokenRevoked) {
+		t.Errorf("Verify of a token issued in the second of the revocation = %v, want %v", err, ErrAccessTokenRevoked)
+	}
+
+	// Once the grant is given again, tokens issued after the revocation verify
+	tokens.revoked[subject] = time.Now().Add(-time.Minute).Unix()
+	if err := tokens.Verify(issueTestToken(t, tokens, 0), testOwnerA, 3, testOwnerB); err != nil {
+		t.Errorf("Verify of a token issued after the revocation: %v", err)
+	}
+
+	// Revocations older than the TTL are forgotten on the next one
+	tokens.revoked[subject] = time.Now().Add(-2 * time.Hour).Unix()
+	tokens.Revoke(testOwnerC, 1, testOwnerB)
+	if _, kept := tokens.revoked[subject]; kept {
+		t.Error("a revocation older than the TTL was kept")
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+// accessibleSnapshot is a requester's verified list of accessible datasets
+type accessibleSnapshot struct {
+	datasets    []models.AccessibleDataset
+	refreshedAt time.Time
+}
+
+// GetAccessibleDatasets returns the datasets requester holds an unexpired grant on, sorted
+// by owner then dataset. Candidate grants come from the event index, when there is one, and
+// from known, grants recorded off chain such as approved access requests. Each is checked
+// against its owner's AccessList, the resource AccessControl::has_access reads, so revoked
+// and expired grants are left out. The list is reused for ACCESSIBLE_CACHE_TTL seconds
+func (s *AptosServiceImpl) GetAccessibleDatasets(requester string, known []models.DatasetRef) ([]models.AccessibleDataset, error) {
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return nil, err
+	}
+	key := requesterAddr.String()
+
+	ttl := time.Duration(config.Tunable().AccessibleCacheTTL) * time.Second
+	s.accessibleMu.Lock()
+	cached, ok := s.accessibleCache[key]
+	s.accessibleMu.Unlock()
+	if ok && time.Since(cached.refreshedAt) < ttl {
+		fmt.Printf("DEBUG: Using cached accessible datasets for %s (age %v)\n", key, time.Since(cached.refreshedAt).Round(time.Second))
+		return cached.datasets, nil
+	}
+
+	// Candidate dataset IDs by owner
+	candidates := make(map[string]map[uint64]bool)
+	addCandidate := func(owner string, datasetID uint64) {
+		if candidates[owner] == nil {
+			candidates[owner] = make(map[uint64]bool)
+		}
+		candidates[owner][datasetID] = true
+	}
+	if s.eventStore != nil {
+		grants, err := s.eventStore.GrantsForRequester(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range grants {
+			addCandidate(g.Owner, g.DatasetID)
+		}
+	}
+	for _, ref := range known {
+		ownerAddr, err := parseAddress(ref.Owner)
+		if err != nil {
+			continue
+		}
+		addCandidate(ownerAddr.String(), ref.DatasetID)
+	}
+
+	now, err := s.LedgerTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the ledger clock: %w", err)
+	}
+	datasets := make([]models.AccessibleDataset, 0)
+	for owner, ids := range candidates {
+		entries, err := s.accessList(owner)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Requester != key || !ids[e.DatasetID] || grantExpired(e.ExpiresAt, now, s.cfg.AccessExpirySkew) {
+				continue
+			}
+			raw, err := s.GetDataset(owner, e.DatasetID)
+			if err != nil {
+				fmt.Printf("WARNING: Failed to load dataset %d of %s for %s: %v\n", e.DatasetID, owner, key, err)
+				continue
+			}
+			info, err := DatasetInfoFromView(owner, e.DatasetID, raw)
+			if err != nil {
+				fmt.Printf("WARNING: Failed to load dataset %d of %s for %s: %v\n", e.DatasetID, owner, key, err)
+				continue
+			}
+			datasets = append(datasets, models.AccessibleDataset{DatasetInfo: info, ExpiresAt: accessGrant(e, now, s.cfg.AccessExpirySkew).ExpiresAt})
+		}
+	}
+	sortAccessible(datasets)
+
+	s.accessibleMu.Lock()
+	if s.accessibleCache == nil {
+		s.accessibleCache = make(map[string]accessibleSnapshot)
+	}
+	s.accessibleCache[key] = accessibleSnapshot{datasets: datasets, refreshedAt: time.Now()}
+	s.accessibleMu.Unlock()
+	return datasets, nil
+}
+
+// sortAccessible orders accessible datasets by owner then dataset ID
+func sortAccessible(datasets []models.AccessibleDataset) {
+	sort.Slice(datasets, func(i, j int) bool {
+		if datasets[i].Owner != datasets[j].Owner {
+			return datasets[i].Owner < datasets[j].Owner
+		}
+		return datasets[i].ID < datasets[j].ID
+	})
+}
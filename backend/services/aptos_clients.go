@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+	"github.com/aptos-labs/aptos-go-sdk/api"
+	"github.com/datax/backend/config"
+	"github.com/hasura/go-graphql-client"
+)
+
+// AptosClientAPI is the part of the Aptos SDK client AptosServiceImpl calls, so a fake can
+// stand in for the fullnode
+type AptosClientAPI interface {
+	BuildSignAndSubmitTransaction(sender aptos.TransactionSigner, payload aptos.TransactionPayload, options ...any) (*api.SubmitTransactionResponse, error)
+	BuildTransactionMultiAgent(sender aptos.AccountAddress, payload aptos.TransactionPayload, options ...any) (*aptos.RawTransactionWithData, error)
+	SubmitTransaction(signedTransaction *aptos.SignedTransaction) (*api.SubmitTransactionResponse, error)
+	WaitForTransaction(txnHash string, options ...any) (*api.UserTransaction, error)
+	View(payload *aptos.ViewPayload, ledgerVersion ...uint64) ([]any, error)
+}
+
+// GraphQLClient runs indexer queries
+type GraphQLClient interface {
+	Query(ctx context.Context, q any, variables map[string]any, options ...graphql.Option) error
+}
+
+var (
+	_ AptosClientAPI = (*aptos.Client)(nil)
+	_ GraphQLClient  = (*graphql.Client)(nil)
+)
+
+// ServiceConfig holds the settings AptosServiceImpl reads: the chain, indexer and modules it
+// talks to and the limits of its scans. They are fixed for the life of the service; the
+// runtime-tunable ones are still read from config.Tunable()
+type ServiceConfig struct {
+	AptosNodeURL       string // Without /v1; REST paths are appended to it
+	AptosIndexerURL    string
+	AptosIndexerAPIKey string
+	UseIndexer         bool
+	DataXModuleAddr    string
+	NetworkModuleAddr  string
+	EscrowModuleAddr   string
+	ChainID            uint8
+
+	AccessExpirySkew  int
+	SponsorPrivateKey string
+
+	IndexerPageSize int
+	IndexerMaxPages int
+
+	TxScanBatchSize    int
+	TxScanMaxLag       int
+	TxScanTimeBudget   int
+	TxScanStartVersion int
+
+	ReadSource        string
+	IndexPollInterval int
+	IndexBatchSize    int
+	IndexMaxLag       int
+	IndexStartVersion int
+}
+
+// ServiceConfigFrom copies the settings AptosServiceImpl reads out of the startup config
+func ServiceConfigFrom(c *config.Config) ServiceConfig {
+	return ServiceConfig{
+		AptosNodeURL:       c.AptosNodeURL,
+		AptosIndexerURL:    c.AptosIndexerURL,
+		AptosIndexerAPIKey: c.AptosIndexerAPIKey,
+		UseIndexer:         c.UseIndexer,
+		DataXModuleAddr:    c.DataXModuleAddr,
+		NetworkModuleAddr:  c.NetworkModuleAddr,
+		EscrowModuleAddr:   c.EscrowModuleAddr,
+		ChainID:            c.ChainID,
+
+		AccessExpirySkew:  c.AccessExpirySkew,
+		SponsorPrivateKey: c.SponsorPrivateKey,
+
+		IndexerPageSize: c.IndexerPageSize,
+		IndexerMaxPages: c.IndexerMaxPages,
+
+		TxScanBatchSize:    c.TxScanBatchSize,
+		TxScanMaxLag:       c.TxScanMaxLag,
+		TxScanTimeBudget:   c.TxScanTimeBudget,
+		TxScanStartVersion: c.TxScanStartVersion,
+
+		ReadSource:        c.ReadSource,
+		IndexPollInterval: c.IndexPollInterval,
+		IndexBatchSize:    c.IndexBatchSize,
+		IndexMaxLag:       c.IndexMaxLag,
+		IndexStartVersion: c.IndexStartVersion,
+	}
+}
+
+// NewAptosServiceWithClients creates the service on the given clients instead of building
+// them from config.AppConfig. httpClient makes the REST calls to cfg.AptosNodeURL and
+// defaults to one with a 30 second timeout; graphql may be nil when there is no indexer
+func NewAptosServiceWithClients(client AptosClientAPI, httpClient *http.Client, graphql GraphQLClient, cfg ServiceConfig) (*AptosServiceImpl, error) {
+	sponsor, err := loadSponsor(cfg.SponsorPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient == nil {
+		httpClient = createHTTPClient()
+	}
+	return &AptosServiceImpl{
+		client:        client,
+		cfg:           cfg,
+		chainID:       cfg.ChainID,
+		httpClient:    httpClient,
+		graphqlClient: graphql,
+		sponsor:       sponsor,
+	}, nil
+}
@@ -3,20 +3,46 @@ package services
 // This file defines the interface for AptosService
 // The implementation is in aptos_service_impl.go
 
+import (
+	"context"
+
+	"github.com/datax/backend/models"
+)
+
 type AptosService interface {
 	InitializeUser(privateKeyHex string) (string, error)
 	SubmitData(privateKeyHex string, dataHash string, metadata string) (string, error)
 	DeleteDataset(privateKeyHex string, datasetID uint64) (string, error)
+	ReactivateDataset(privateKeyHex string, datasetID uint64) (string, error) // ErrDatasetNotReactivatable / ErrDatasetAlreadyActive when the module refuses
 	GrantAccess(privateKeyHex string, datasetID uint64, requester string, expiresAt uint64) (string, error)
 	RevokeAccess(privateKeyHex string, datasetID uint64, requester string) (string, error)
+	DepositEscrow(privateKeyHex string, owner string, datasetID uint64, amount uint64) (string, error)        // Signed by the requester; amount in octas
+	ReleaseEscrow(privateKeyHex string, datasetID uint64, requester string, expiresAt uint64) (string, error) // Signed by the owner, granting access in the same transaction; ErrEscrowNotFound without a deposit
+	RefundEscrow(privateKeyHex string, owner string, datasetID uint64) (string, error)                        // Signed by the requester; ErrEscrowNotFound without a deposit, ErrEscrowRefundTooEarly within EscrowRefundTimeout of it
+	GetEscrowBalance(owner string, datasetID uint64, requester string) (uint64, error)                        // Octas the requester holds in escrow for the dataset
 	RegisterToken(privateKeyHex string) (string, error)
 	MintToken(privateKeyHex string, recipient string, amount uint64) (string, error)
+	IsMintAuthority(privateKeyHex string) (bool, error)                                                                 // Whether the key's account holds the token's mint capability
+	BuildSponsoredRegistration(recipient string) (*models.SponsoredTransaction, error)                                  // data_token::register with the sponsor paying gas, for the recipient to sign; ErrSponsorNotConfigured without one
+	SubmitSponsoredRegistration(recipient string, rawTransaction string, recipientAuthenticator string) (string, error) // Adds the sponsor's signature to a co-signed BuildSponsoredRegistration and submits it
+	IsTokenRegistered(address string) (bool, error)                                                                     // Whether the account can receive the DataX token
+	GetTokenInfo() (*models.TokenInfo, error)                                                                           // Supply is read per call and nil when the coin doesn't track it
 	GetDataset(userAddress string, datasetID uint64) (interface{}, error)
 	CheckAccess(owner string, datasetID uint64, requester string) (bool, error)
-	GetUserVault(userAddress string) ([]uint64, error)
-	GetUserDatasetsMetadata(userAddress string) ([]interface{}, error) // Returns minimal metadata (id, metadata, is_active) for all datasets
-	IsAccountInitialized(userAddress string) (bool, error)
-	GetMarketplaceDatasets() ([]interface{}, error)
-	GetAccessRequests(ownerAddress string) ([]interface{}, error)
-	CheckDataHashExists(dataHash string) (bool, error)
+	GetAccessGrant(owner string, datasetID uint64, requester string) (*models.AccessGrant, error)                 // Requester's grant with Expired judged by the ledger clock; nil if never granted or revoked
+	GetAllGrantsByOwner(owner string) ([]models.AccessGrant, error)                                               // Every grant in the owner's AccessControl resource, sorted by dataset then requester
+	GetAccessibleDatasets(requester string, known []models.DatasetRef) ([]models.AccessibleDataset, error)        // Datasets with an unexpired grant for requester, found through the event index and known; briefly cached
+	GetUserVault(ctx context.Context, userAddress string) ([]uint64, error)                                       // Gives up, retries included, when ctx ends
+	GetUserDatasetsMetadata(userAddress string) ([]interface{}, error)                                            // Returns minimal metadata (id, data_hash, metadata, is_active) for all datasets
+	IsAccountInitialized(userAddress string) (bool, error)                                                        // Errors wrap ErrChainUnavailable when the node couldn't answer
+	GetMarketplaceDatasets(ctx context.Context, filter models.MarketplaceFilter) (*models.MarketplacePage, error) // Chain reads stop, and the page is partial, when ctx ends
+	SearchMarketplace(ctx context.Context, query string) ([]interface{}, error)                                   // Keyword search over metadata name/description/tags and owner prefix
+	// The same page as a response body (the datasets alone unless envelope) and its ETag, encoded once per snapshot
+	GetMarketplaceResponse(ctx context.Context, filter models.MarketplaceFilter, envelope bool) (*EncodedResponse, error)
+	GetAccessRequests(ownerAddress string, start uint64, limit uint64) ([]models.AccessRequest, error)
+	FindDatasetsByDataHash(ctx context.Context, dataHash string, owner string) ([]models.DatasetRef, error) // Datasets registered with dataHash (case and 0x prefix ignored), only owner's when given
+	GetDiscoveryCheckpoint() models.DiscoveryCheckpoint                                                     // Progress of the submit_data transaction scanner
+	GetAuthenticationKey(userAddress string) (string, error)
+	GetTransactionReceipt(hash string) (*models.TransactionReceipt, error)                         // Committed transaction with gas and decoded DataX events; ErrTransactionNotFound / ErrTransactionPending otherwise
+	VerifyPayment(txHash string, expected models.ExpectedPayment) (*models.VerifiedPayment, error) // Committed APT transfer matching expected; ErrPaymentInvalid (wrapped with the reason) when it doesn't
 }
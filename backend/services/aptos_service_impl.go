@@ -14,10 +14,12 @@ import (
 	"time"
 
 	"github.com/aptos-labs/aptos-go-sdk"
-	"github.com/aptos-labs/aptos-go-sdk/bcs"
 	"github.com/aptos-labs/aptos-go-sdk/crypto"
 	"github.com/datax/backend/config"
+	"github.com/datax/backend/internal/store"
+	"github.com/datax/backend/models"
 	"github.com/hasura/go-graphql-client"
+	"golang.org/x/sync/errgroup"
 )
 
 // Ensure AptosServiceImpl implements AptosService interface
@@ -25,25 +27,36 @@ var _ AptosService = (*AptosServiceImpl)(nil)
 
 // Update the AptosService to use the actual SDK
 type AptosServiceImpl struct {
-	client        *aptos.Client
+	client        AptosClientAPI
+	cfg           ServiceConfig
 	chainID       uint8
-	httpClient    *http.Client    // HTTP client with timeout for API requests
-	graphqlClient *graphql.Client // GraphQL client for indexer queries
-}
+	httpClient    *http.Client          // HTTP client with timeout for API requests
+	graphqlClient GraphQLClient         // GraphQL client for indexer queries, nil without an indexer
+	indexerStats  *roundTripStats       // Latency of indexer requests, nil without an indexer
+	sponsor       *aptos.Account        // Pays gas for sponsored transactions, nil without SPONSOR_PRIVATE_KEY
+	sponsored     sponsoredTransactions // Sponsored transactions awaiting their sender's signature
 
-// authTransport wraps http.Transport to add Authorization header
-type authTransport struct {
-	apiKey string
-	base   http.RoundTripper
-}
+	marketplaceMu    sync.Mutex           // Serializes marketplace snapshot refreshes
+	marketplaceCache *marketplaceSnapshot // Cached unfiltered marketplace listing
 
-func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Set("Authorization", "Bearer "+t.apiKey)
-	fmt.Printf("DEBUG: Added Authorization header to request (key length: %d)\n", len(t.apiKey))
-	if t.base == nil {
-		return http.DefaultTransport.RoundTrip(req)
-	}
-	return t.base.RoundTrip(req)
+	accessibleMu    sync.Mutex                    // Protects accessibleCache
+	accessibleCache map[string]accessibleSnapshot // Verified accessible datasets by requester
+
+	tokenInfoMu sync.Mutex        // Protects tokenInfo
+	tokenInfo   *models.TokenInfo // Name, symbol, decimals and minter of the DataX token, read once
+
+	stateStore     StateStore                  // Optional persistence for discovery progress
+	scanMu         sync.Mutex                  // Serializes transaction scans
+	scanCheckpoint *models.DiscoveryCheckpoint // Loaded lazily on the first scan
+	scanETag       string                      // ETag of the stored checkpoint
+
+	knownUsersMu   sync.Mutex          // Protects the known-user set
+	knownUsers     *knownUsersDocument // Loaded lazily from the state store
+	knownUsersETag string              // ETag of the stored known-user set
+
+	eventStore      *store.Store      // Local event index, when SOURCE=local
+	indexMu         sync.Mutex        // Protects indexCheckpoint
+	indexCheckpoint *store.Checkpoint // Progress of the event indexer, nil until its first poll
 }
 
 // createHTTPClient creates an HTTP client with timeout and retry support
@@ -53,11 +66,15 @@ func createHTTPClient() *http.Client {
 	}
 }
 
+// NewAptosService creates the service on the SDK, REST and indexer clients config.AppConfig
+// describes
 func NewAptosService() (*AptosServiceImpl, error) {
+	cfg := ServiceConfigFrom(config.AppConfig)
+
 	// Create network config for testnet
 	networkConfig := aptos.NetworkConfig{
-		NodeUrl: config.AppConfig.AptosNodeURL,
-		ChainId: config.AppConfig.ChainID,
+		NodeUrl: cfg.AptosNodeURL,
+		ChainId: cfg.ChainID,
 	}
 
 	client, err := aptos.NewClient(networkConfig)
@@ -66,37 +83,37 @@ func NewAptosService() (*AptosServiceImpl, error) {
 	}
 
 	// Create GraphQL client if indexer URL is configured
-	var graphqlClient *graphql.Client
-	if config.AppConfig.AptosIndexerURL != "" {
-		apiKey := strings.TrimSpace(config.AppConfig.AptosIndexerAPIKey)
+	var graphqlClient GraphQLClient
+	var indexerStats *roundTripStats
+	if cfg.AptosIndexerURL != "" {
+		apiKey := strings.TrimSpace(cfg.AptosIndexerAPIKey)
 
-		// Create HTTP client with custom transport that adds Authorization header
-		var httpClient *http.Client
+		// Logged once here, never per request, and without anything about the key itself
 		if apiKey != "" {
-			fmt.Printf("DEBUG: Initializing GraphQL client with API key (length: %d chars)\n", len(apiKey))
-			// Create a transport that adds the Authorization header
-			transport := &authTransport{
-				apiKey: apiKey,
-				base:   http.DefaultTransport,
-			}
-			httpClient = &http.Client{
-				Timeout:   30 * time.Second,
-				Transport: transport,
-			}
+			fmt.Printf("DEBUG: Initializing GraphQL client for %s with API key authentication\n", cfg.AptosIndexerURL)
 		} else {
 			fmt.Printf("WARNING: APTOS_INDEXER_API_KEY is empty but indexer URL is set\n")
-			httpClient = &http.Client{Timeout: 30 * time.Second}
 		}
 
-		graphqlClient = graphql.NewClient(config.AppConfig.AptosIndexerURL, httpClient)
+		// The transport adds the Authorization header and records request latency
+		indexerStats = &roundTripStats{}
+		httpClient := &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &authTransport{
+				apiKey: apiKey,
+				base:   http.DefaultTransport,
+				stats:  indexerStats,
+			},
+		}
+		graphqlClient = graphql.NewClient(cfg.AptosIndexerURL, httpClient)
 	}
 
-	return &AptosServiceImpl{
-		client:        client,
-		chainID:       config.AppConfig.ChainID,
-		httpClient:    createHTTPClient(),
-		graphqlClient: graphqlClient,
-	}, nil
+	service, err := NewAptosServiceWithClients(client, createHTTPClient(), graphqlClient, cfg)
+	if err != nil {
+		return nil, err
+	}
+	service.indexerStats = indexerStats
+	return service, nil
 }
 
 // Get account from private key hex string
@@ -125,52 +142,48 @@ func getAccountFromPrivateKey(privateKeyHex string) (*aptos.Account, error) {
 	return account, nil
 }
 
-// Parse address from hex string
-func parseAddress(addressHex string) (*aptos.AccountAddress, error) {
-	addressHex = strings.TrimPrefix(addressHex, "0x")
-	addressBytes, err := hex.DecodeString(addressHex)
+// AddressFromPrivateKey returns the address of the account a private key signs for
+func AddressFromPrivateKey(privateKeyHex string) (string, error) {
+	account, err := getAccountFromPrivateKey(privateKeyHex)
 	if err != nil {
-		return nil, fmt.Errorf("invalid address hex: %w", err)
+		return "", err
 	}
+	return account.Address.String(), nil
+}
 
-	if len(addressBytes) != 32 {
-		return nil, fmt.Errorf("address must be 32 bytes")
+// NormalizeAddress returns an account address in its AIP-40 form: 0x and 64 lowercase hex
+// digits, or 0x and one digit for the special addresses 0x0 to 0xf
+func NormalizeAddress(addressHex string) (string, error) {
+	address, err := parseAddress(addressHex)
+	if err != nil {
+		return "", err
 	}
-
-	var address aptos.AccountAddress
-	copy(address[:], addressBytes)
-	return &address, nil
+	return address.String(), nil
 }
 
-// Serialize argument to BCS bytes
-func serializeArg(arg interface{}) ([]byte, error) {
-	ser := &bcs.Serializer{}
-
-	switch v := arg.(type) {
-	case []byte:
-		ser.WriteBytes(v)
-	case string:
-		ser.WriteString(v)
-	case uint64:
-		ser.U64(v)
-	case *aptos.AccountAddress:
-		ser.Struct(v)
-	case aptos.AccountAddress:
-		ser.Struct(&v)
-	default:
-		// Try to serialize as BCS Marshaler
-		if marshaler, ok := arg.(bcs.Marshaler); ok {
-			ser.Struct(marshaler)
-		} else {
-			return nil, fmt.Errorf("unsupported argument type: %T", arg)
-		}
+// parseAddress reads an account address as AIP-40 allows it to be written: 0x optional, any
+// case, surrounding whitespace ignored, and leading zeros trimmed (0x1, 0xA550C18) up to the
+// full 64 hex digits
+func parseAddress(addressHex string) (*aptos.AccountAddress, error) {
+	addressHex = strings.TrimSpace(addressHex)
+	if prefix := addressHex[:min(len(addressHex), 2)]; prefix == "0x" || prefix == "0X" {
+		addressHex = addressHex[2:]
+	}
+	if addressHex == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+	if len(addressHex) > 64 {
+		return nil, fmt.Errorf("address must be at most 64 hex digits, got %d", len(addressHex))
 	}
 
-	if err := ser.Error(); err != nil {
-		return nil, err
+	addressBytes, err := hex.DecodeString(strings.Repeat("0", 64-len(addressHex)) + addressHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address hex: %w", err)
 	}
 
-	return ser.ToBytes(), nil
+	var address aptos.AccountAddress
+	copy(address[:], addressBytes)
+	return &address, nil
 }
 
 // Submit a transaction and wait for confirmation
@@ -181,12 +194,33 @@ func (s *AptosServiceImpl) submitTransaction(
 	functionName string,
 	args []interface{},
 ) (string, error) {
+	payload, err := entryFunctionPayload(moduleAddress, moduleName, functionName, args)
+	if err != nil {
+		return "", err
+	}
+
+	// Build, sign and submit transaction
+	response, err := s.client.BuildSignAndSubmitTransaction(account, payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to build, sign and submit transaction: %w", err)
+	}
+
+	return s.waitForSuccess(response.Hash)
+}
+
+// entryFunctionPayload builds the payload calling an entry function with BCS-encoded args
+func entryFunctionPayload(
+	moduleAddress *aptos.AccountAddress,
+	moduleName string,
+	functionName string,
+	args []interface{},
+) (aptos.TransactionPayload, error) {
 	// Serialize all arguments to BCS bytes
 	serializedArgs := make([][]byte, 0, len(args))
 	for _, arg := range args {
 		argBytes, err := serializeArg(arg)
 		if err != nil {
-			return "", fmt.Errorf("failed to serialize argument: %w", err)
+			return aptos.TransactionPayload{}, fmt.Errorf("failed to serialize argument: %w", err)
 		}
 		serializedArgs = append(serializedArgs, argBytes)
 	}
@@ -202,24 +236,24 @@ func (s *AptosServiceImpl) submitTransaction(
 		Args:     serializedArgs,
 	}
 
-	// Create transaction payload
-	payload := aptos.TransactionPayload{
+	return aptos.TransactionPayload{
 		Payload: entryFunction,
-	}
+	}, nil
+}
 
-	// Build, sign and submit transaction
-	response, err := s.client.BuildSignAndSubmitTransaction(account, payload)
+// waitForSuccess waits for a submitted transaction and returns its hash once it committed
+// successfully
+func (s *AptosServiceImpl) waitForSuccess(hash string) (string, error) {
+	committed, err := s.client.WaitForTransaction(hash)
 	if err != nil {
-		return "", fmt.Errorf("failed to build, sign and submit transaction: %w", err)
+		return "", fmt.Errorf("transaction failed: %w: %w", ErrTransactionUnconfirmed, err)
 	}
-
-	// Wait for transaction
-	_, err = s.client.WaitForTransaction(response.Hash)
-	if err != nil {
-		return "", fmt.Errorf("transaction failed: %w", err)
+	// A committed transaction can still have failed, e.g. by aborting in the module
+	if !committed.Success {
+		return "", newTransactionError(hash, committed.VmStatus)
 	}
 
-	return response.Hash, nil
+	return hash, nil
 }
 
 // Initialize user's data store and vault
@@ -229,7 +263,7 @@ func (s *AptosServiceImpl) InitializeUser(privateKeyHex string) (string, error)
 		return "", err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
 	if err != nil {
 		return "", err
 	}
@@ -250,7 +284,7 @@ func (s *AptosServiceImpl) SubmitData(privateKeyHex string, dataHash string, met
 		return "", err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
 	if err != nil {
 		return "", err
 	}
@@ -274,7 +308,7 @@ func (s *AptosServiceImpl) DeleteDataset(privateKeyHex string, datasetID uint64)
 		return "", err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
 	if err != nil {
 		return "", err
 	}
@@ -288,6 +322,28 @@ func (s *AptosServiceImpl) DeleteDataset(privateKeyHex string, datasetID uint64)
 	)
 }
 
+// ReactivateDataset undoes DeleteDataset, making the dataset active and putting it back in the vault
+func (s *AptosServiceImpl) ReactivateDataset(privateKeyHex string, datasetID uint64) (string, error) {
+	account, err := getAccountFromPrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
+	if err != nil {
+		return "", err
+	}
+
+	txHash, err := s.submitTransaction(
+		account,
+		moduleAddr,
+		"data_registry",
+		"reactivate_dataset",
+		[]interface{}{datasetID},
+	)
+	return txHash, reactivationError(err)
+}
+
 // Grant access
 func (s *AptosServiceImpl) GrantAccess(privateKeyHex string, datasetID uint64, requester string, expiresAt uint64) (string, error) {
 	account, err := getAccountFromPrivateKey(privateKeyHex)
@@ -295,7 +351,7 @@ func (s *AptosServiceImpl) GrantAccess(privateKeyHex string, datasetID uint64, r
 		return "", err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.NetworkModuleAddr)
+	moduleAddr, err := parseAddress(s.cfg.NetworkModuleAddr)
 	if err != nil {
 		return "", err
 	}
@@ -321,7 +377,7 @@ func (s *AptosServiceImpl) RevokeAccess(privateKeyHex string, datasetID uint64,
 		return "", err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.NetworkModuleAddr)
+	moduleAddr, err := parseAddress(s.cfg.NetworkModuleAddr)
 	if err != nil {
 		return "", err
 	}
@@ -347,7 +403,7 @@ func (s *AptosServiceImpl) RegisterToken(privateKeyHex string) (string, error) {
 		return "", err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
 	if err != nil {
 		return "", err
 	}
@@ -368,7 +424,7 @@ func (s *AptosServiceImpl) MintToken(privateKeyHex string, recipient string, amo
 		return "", err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
 	if err != nil {
 		return "", err
 	}
@@ -394,7 +450,7 @@ func (s *AptosServiceImpl) GetDataset(userAddress string, datasetID uint64) (int
 		return nil, err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -402,7 +458,7 @@ func (s *AptosServiceImpl) GetDataset(userAddress string, datasetID uint64) (int
 	// Query the DataStore resource directly since get_dataset is not a view function
 	resourceType := fmt.Sprintf("%s::data_registry::DataStore", moduleAddr.String())
 
-	nodeURL := strings.TrimSuffix(config.AppConfig.AptosNodeURL, "/")
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
 	resourceURL := fmt.Sprintf("%s/v1/accounts/%s/resource/%s",
 		nodeURL,
 		userAddr.String(),
@@ -548,30 +604,7 @@ func (s *AptosServiceImpl) GetDataset(userAddress string, datasetID uint64) (int
 		}
 
 		if id == datasetID {
-			// Convert data_hash from byte arrays to hex string
-			// Aptos can return byte vectors as arrays of numbers or as hex strings
-			dataHashHex := "0x"
-			switch v := dataset.DataHash.(type) {
-			case []interface{}:
-				// Array of numbers (most common format)
-				for _, b := range v {
-					if byteVal, ok := b.(float64); ok {
-						dataHashHex += fmt.Sprintf("%02x", uint8(byteVal))
-					} else if byteVal, ok := b.(uint8); ok {
-						dataHashHex += fmt.Sprintf("%02x", byteVal)
-					}
-				}
-			case string:
-				// Already a hex string
-				if strings.HasPrefix(v, "0x") {
-					dataHashHex = v
-				} else {
-					dataHashHex = "0x" + v
-				}
-			default:
-				// Try to handle other formats
-				fmt.Printf("Warning: unexpected data_hash type: %T, value: %v\n", v, v)
-			}
+			dataHashHex := dataHashToHex(dataset.DataHash)
 
 			// Convert metadata from byte arrays to string
 			metadataStr := ""
@@ -639,67 +672,66 @@ func (s *AptosServiceImpl) GetDataset(userAddress string, datasetID uint64) (int
 	return nil, fmt.Errorf("dataset %d not found", datasetID)
 }
 
-func (s *AptosServiceImpl) CheckAccess(owner string, datasetID uint64, requester string) (bool, error) {
-	ownerAddr, err := parseAddress(owner)
-	if err != nil {
-		return false, err
-	}
-
-	requesterAddr, err := parseAddress(requester)
-	if err != nil {
-		return false, err
+// dataHashToHex converts an on-chain data_hash to a "0x" hex string
+// Aptos can return byte vectors as arrays of numbers or as hex strings
+func dataHashToHex(dataHash interface{}) string {
+	dataHashHex := "0x"
+	switch v := dataHash.(type) {
+	case []interface{}:
+		// Array of numbers (most common format)
+		for _, b := range v {
+			if byteVal, ok := b.(float64); ok {
+				dataHashHex += fmt.Sprintf("%02x", uint8(byteVal))
+			} else if byteVal, ok := b.(uint8); ok {
+				dataHashHex += fmt.Sprintf("%02x", byteVal)
+			}
+		}
+	case string:
+		// Already a hex string
+		if strings.HasPrefix(v, "0x") {
+			dataHashHex = v
+		} else {
+			dataHashHex = "0x" + v
+		}
+	default:
+		// Try to handle other formats
+		fmt.Printf("Warning: unexpected data_hash type: %T, value: %v\n", v, v)
 	}
+	return dataHashHex
+}
 
-	moduleAddr, err := parseAddress(config.AppConfig.NetworkModuleAddr)
+// CheckAccess reports whether requester holds a grant on the dataset that hasn't expired.
+// The grant is read from the AccessList and its expiry judged against the ledger clock,
+// rather than trusting a view call to have checked it
+func (s *AptosServiceImpl) CheckAccess(owner string, datasetID uint64, requester string) (bool, error) {
+	grant, err := s.GetAccessGrant(owner, datasetID, requester)
 	if err != nil {
 		return false, err
 	}
+	return grant != nil && !grant.Expired, nil
+}
 
-	// Encode arguments to BCS - need to serialize each argument separately
-	ownerBytes, err := serializeArg(ownerAddr)
-	if err != nil {
-		return false, fmt.Errorf("failed to serialize owner address: %w", err)
-	}
-	datasetIDBytes, err := serializeArg(datasetID)
-	if err != nil {
-		return false, fmt.Errorf("failed to serialize dataset ID: %w", err)
-	}
-	requesterBytes, err := serializeArg(requesterAddr)
-	if err != nil {
-		return false, fmt.Errorf("failed to serialize requester address: %w", err)
-	}
-
-	viewPayload := &aptos.ViewPayload{
-		Module: aptos.ModuleId{
-			Address: *moduleAddr,
-			Name:    "AccessControl",
-		},
-		Function: "has_access",
-		ArgTypes: []aptos.TypeTag{},
-		Args:     [][]byte{ownerBytes, datasetIDBytes, requesterBytes},
-	}
+// Note: All user discovery is now done directly from the blockchain
+// No in-memory registry is used - we query DataStore resources directly
 
-	result, err := s.client.View(viewPayload)
+// DiscoverUsersFromChain discovers users who have DataStore resources on-chain
+// Freshly discovered users are merged into the persisted known-user set, and the whole
+// set is returned so users survive restarts and temporary discovery failures
+func (s *AptosServiceImpl) DiscoverUsersFromChain() ([]string, error) {
+	discovered, err := s.discoverUsers()
 	if err != nil {
-		return false, fmt.Errorf("failed to call view function: %w", err)
-	}
-
-	if len(result) > 0 {
-		if hasAccess, ok := result[0].(bool); ok {
-			return hasAccess, nil
-		}
+		return nil, err
 	}
 
-	return false, nil
+	users := s.rememberUsers(discovered)
+	fmt.Printf("DEBUG: %d users discovered this run, %d known in total\n", len(discovered), len(users))
+	return users, nil
 }
 
-// Note: All user discovery is now done directly from the blockchain
-// No in-memory registry is used - we query DataStore resources directly
-
-// DiscoverUsersFromChain discovers users who have DataStore resources on-chain
+// discoverUsers finds users who submitted data
 // Uses Aptos Indexer GraphQL API to query events by type across all accounts
-func (s *AptosServiceImpl) DiscoverUsersFromChain() ([]string, error) {
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
+func (s *AptosServiceImpl) discoverUsers() ([]string, error) {
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -708,8 +740,8 @@ func (s *AptosServiceImpl) DiscoverUsersFromChain() ([]string, error) {
 
 	// Try using the GraphQL Indexer API (if configured)
 	// Even if USE_INDEXER is false, we'll try it as a fallback since without it we can't discover users
-	if config.AppConfig.AptosIndexerURL != "" {
-		if config.AppConfig.UseIndexer {
+	if s.cfg.AptosIndexerURL != "" {
+		if s.cfg.UseIndexer {
 			fmt.Printf("DEBUG: Indexer is enabled, attempting to query GraphQL indexer...\n")
 		} else {
 			fmt.Printf("DEBUG: Indexer is disabled but will try as fallback (required for user discovery)...\n")
@@ -721,7 +753,7 @@ func (s *AptosServiceImpl) DiscoverUsersFromChain() ([]string, error) {
 			return users, nil
 		}
 		// Log the error but continue with fallback
-		if config.AppConfig.UseIndexer {
+		if s.cfg.UseIndexer {
 			fmt.Printf("DEBUG: GraphQL indexer query failed, trying fallback: %v\n", err)
 		} else {
 			fmt.Printf("DEBUG: GraphQL indexer query failed (indexer disabled): %v\n", err)
@@ -740,7 +772,7 @@ func (s *AptosServiceImpl) DiscoverUsersFromChain() ([]string, error) {
 
 	// Try querying events from the module address
 	eventsURL := fmt.Sprintf("%s/v1/accounts/%s/events/%s?limit=1000",
-		config.AppConfig.AptosNodeURL,
+		s.cfg.AptosNodeURL,
 		moduleAddr.String(),
 		url.PathEscape(eventType))
 
@@ -805,33 +837,97 @@ func (s *AptosServiceImpl) DiscoverUsersFromChain() ([]string, error) {
 }
 
 // queryUsersFromGraphQLIndexer queries the Aptos Indexer GraphQL API to find all users who emitted DataSubmitted events
-// Queries events directly with event type filter
+// Reads the datax_marketplace table page by page (INDEXER_PAGE_SIZE rows per page) until a short
+// page comes back, so discovery isn't capped at a single page of rows. INDEXER_MAX_PAGES bounds
+// the loop in case the indexer keeps returning full pages
 // Reference: https://aptos.dev/build/indexer/indexer-api/indexer-reference
 func (s *AptosServiceImpl) queryUsersFromGraphQLIndexer(eventType string) ([]string, error) {
-	// Try 'events' field first (without _v2 suffix)
-	// The Aptos GraphQL indexer uses 'events' as the table name
-	// graphQLQuery := fmt.Sprintf(`query GetDataSubmittedEvents {
-	// 	events(
-	// 		where: {
-	// 			type: { _eq: "%s" }
-	// 		},
-	// 		limit: 1000,
-	// 		order_by: { transaction_version: desc }
-	// 	) {
-	// 		account_address
-	// 		data
-	// 	}
-	// }`, eventType)
-	graphQLQuery := `query MyQuery {
-		datax_marketplace {
+	pageSize, maxPages := s.indexerPaging()
+	userSet := make(map[string]bool)
+
+	for page := 0; page < maxPages; page++ {
+		// Order by the table's key so offsets stay stable between pages
+		graphQLQuery := fmt.Sprintf(`query MyQuery {
+		datax_marketplace(limit: %d, offset: %d, order_by: {user: asc, dataset_id: asc}) {
 			user
 			data_hash
 			dataset_id
 			metadata
 		}
 		}
-		`
+		`, pageSize, page*pageSize)
+
+		data, err := s.executeIndexerQuery(graphQLQuery)
+		if err != nil {
+			if page == 0 {
+				return nil, err
+			}
+			// Keep the users from earlier pages rather than failing discovery outright
+			fmt.Printf("WARNING: GraphQL indexer page %d failed, returning users from %d earlier pages: %v\n", page+1, page, err)
+			break
+		}
+
+		rows := 0
+
+		// Try to extract users from datax_marketplace (if that's what was queried)
+		if marketplaceData, ok := data["datax_marketplace"].([]interface{}); ok {
+			rows += len(marketplaceData)
+			for _, entry := range marketplaceData {
+				if entryMap, ok := entry.(map[string]interface{}); ok {
+					if user, ok := entryMap["user"].(string); ok && user != "" {
+						userSet[user] = true
+					}
+				}
+			}
+		}
 
+		// Also try to extract from events (for backward compatibility)
+		if eventsData, ok := data["events"].([]interface{}); ok {
+			rows += len(eventsData)
+			for _, event := range eventsData {
+				if eventMap, ok := event.(map[string]interface{}); ok {
+					if addr, ok := eventMap["account_address"].(string); ok && addr != "" {
+						userSet[addr] = true
+					}
+				}
+			}
+		}
+
+		fmt.Printf("DEBUG: GraphQL indexer page %d returned %d rows (%d unique users so far)\n", page+1, rows, len(userSet))
+
+		if rows < pageSize {
+			break
+		}
+		if page == maxPages-1 {
+			fmt.Printf("WARNING: Stopped GraphQL user discovery after %d pages (INDEXER_MAX_PAGES); some users may be missing\n", maxPages)
+		}
+	}
+
+	users := make([]string, 0, len(userSet))
+	for user := range userSet {
+		users = append(users, user)
+	}
+
+	fmt.Printf("DEBUG: Successfully queried GraphQL indexer, found %d unique users\n", len(users))
+	return users, nil
+}
+
+// indexerPaging returns the configured indexer page size and page limit, with safe minimums
+func (s *AptosServiceImpl) indexerPaging() (int, int) {
+	pageSize := s.cfg.IndexerPageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+	maxPages := s.cfg.IndexerMaxPages
+	if maxPages <= 0 {
+		maxPages = 1
+	}
+	return pageSize, maxPages
+}
+
+// executeIndexerQuery posts a GraphQL query to the indexer and returns its "data" object
+// Retries up to 3 times with exponential backoff, waiting longer when rate limited
+func (s *AptosServiceImpl) executeIndexerQuery(graphQLQuery string) (map[string]interface{}, error) {
 	// Prepare GraphQL request
 	requestBody := map[string]interface{}{
 		"query": graphQLQuery,
@@ -843,7 +939,7 @@ func (s *AptosServiceImpl) queryUsersFromGraphQLIndexer(eventType string) ([]str
 	}
 
 	fmt.Printf("DEBUG: GraphQL query: %s\n", graphQLQuery)
-	fmt.Printf("DEBUG: Querying indexer at: %s\n", config.AppConfig.AptosIndexerURL)
+	fmt.Printf("DEBUG: Querying indexer at: %s\n", s.cfg.AptosIndexerURL)
 
 	// Retry logic: try up to 3 times with exponential backoff
 	// Add initial delay to avoid rate limiting
@@ -859,7 +955,7 @@ func (s *AptosServiceImpl) queryUsersFromGraphQLIndexer(eventType string) ([]str
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-		req, err := http.NewRequestWithContext(ctx, "POST", config.AppConfig.AptosIndexerURL, strings.NewReader(string(jsonBody)))
+		req, err := http.NewRequestWithContext(ctx, "POST", s.cfg.AptosIndexerURL, strings.NewReader(string(jsonBody)))
 		if err != nil {
 			cancel()
 			lastErr = err
@@ -870,13 +966,9 @@ func (s *AptosServiceImpl) queryUsersFromGraphQLIndexer(eventType string) ([]str
 		req.Header.Set("Accept", "application/json")
 		req.Header.Set("User-Agent", "DataX-Backend/1.0")
 
-		// Add API key if configured
-		apiKey := strings.TrimSpace(config.AppConfig.AptosIndexerAPIKey)
-		if apiKey != "" {
+		// Add API key if configured. Nothing about the key is logged
+		if apiKey := strings.TrimSpace(s.cfg.AptosIndexerAPIKey); apiKey != "" {
 			req.Header.Set("Authorization", "Bearer "+apiKey)
-			fmt.Printf("DEBUG: Added Authorization header to manual HTTP request (key length: %d)\n", len(apiKey))
-		} else {
-			fmt.Printf("WARNING: No API key set for GraphQL request\n")
 		}
 
 		resp, err := s.httpClient.Do(req)
@@ -944,52 +1036,87 @@ func (s *AptosServiceImpl) queryUsersFromGraphQLIndexer(eventType string) ([]str
 			continue
 		}
 
-		// Try to extract users from datax_marketplace (if that's what was queried)
-		userSet := make(map[string]bool)
-		if marketplaceData, ok := data["datax_marketplace"].([]interface{}); ok {
-			fmt.Printf("DEBUG: Found datax_marketplace data, extracting users\n")
-			for _, entry := range marketplaceData {
-				if entryMap, ok := entry.(map[string]interface{}); ok {
-					if user, ok := entryMap["user"].(string); ok && user != "" {
-						userSet[user] = true
-					}
-				}
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("GraphQL indexer query failed after 3 attempts: %w", lastErr)
+}
+
+// queryUsersFromGraphQLIndexerAlternative queries users by querying account_transactions and filtering events
+// This is a fallback when direct events query doesn't work
+// Pages through transactions newest first, with the same page size and page limit as the main query
+func (s *AptosServiceImpl) queryUsersFromGraphQLIndexerAlternative(eventType string) ([]string, error) {
+	fmt.Printf("DEBUG: Trying alternative approach: query account_transactions with events\n")
+
+	pageSize, maxPages := s.indexerPaging()
+	userSet := make(map[string]bool)
+
+	for page := 0; page < maxPages; page++ {
+		transactions, err := s.queryAccountTransactionsPage(pageSize, page*pageSize)
+		if err != nil {
+			if page == 0 {
+				return nil, err
 			}
+			fmt.Printf("WARNING: account_transactions page %d failed, returning users from %d earlier pages: %v\n", page+1, page, err)
+			break
 		}
 
-		// Also try to extract from events (for backward compatibility)
-		if eventsData, ok := data["events"].([]interface{}); ok {
-			fmt.Printf("DEBUG: Found events data, extracting users\n")
-			for _, event := range eventsData {
-				if eventMap, ok := event.(map[string]interface{}); ok {
-					if addr, ok := eventMap["account_address"].(string); ok && addr != "" {
-						userSet[addr] = true
+		// Filter events by type and extract users
+		for _, tx := range transactions {
+			for _, event := range tx.Events {
+				if event.Type == eventType {
+					// Add the account address that emitted the event
+					if tx.AccountAddress != "" {
+						userSet[tx.AccountAddress] = true
+					}
+
+					// Also extract user from event data
+					var eventData struct {
+						User string `json:"user"`
+					}
+					if err := json.Unmarshal(event.Data, &eventData); err == nil {
+						if eventData.User != "" {
+							userSet[eventData.User] = true
+						}
 					}
 				}
 			}
 		}
 
-		users := make([]string, 0, len(userSet))
-		for user := range userSet {
-			users = append(users, user)
+		if len(transactions) < pageSize {
+			break
 		}
+		if page == maxPages-1 {
+			fmt.Printf("WARNING: Stopped account_transactions scan after %d pages (INDEXER_MAX_PAGES); some users may be missing\n", maxPages)
+		}
+	}
 
-		fmt.Printf("DEBUG: Successfully queried GraphQL indexer, found %d unique users\n", len(users))
-		return users, nil
+	users := make([]string, 0, len(userSet))
+	for user := range userSet {
+		users = append(users, user)
 	}
 
-	return nil, fmt.Errorf("GraphQL indexer query failed after 3 attempts: %w", lastErr)
+	fmt.Printf("DEBUG: Alternative query found %d unique users\n", len(users))
+	return users, nil
 }
 
-// queryUsersFromGraphQLIndexerAlternative queries users by querying account_transactions and filtering events
-// This is a fallback when direct events query doesn't work
-func (s *AptosServiceImpl) queryUsersFromGraphQLIndexerAlternative(eventType string) ([]string, error) {
-	fmt.Printf("DEBUG: Trying alternative approach: query account_transactions with events\n")
+// indexerAccountTransaction is a row of the indexer's account_transactions table with its events
+type indexerAccountTransaction struct {
+	AccountAddress     string `json:"account_address"`
+	TransactionVersion int64  `json:"transaction_version"`
+	Events             []struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	} `json:"events"`
+}
 
+// queryAccountTransactionsPage fetches one page of account_transactions ordered by transaction_version
+func (s *AptosServiceImpl) queryAccountTransactionsPage(limit int, offset int) ([]indexerAccountTransaction, error) {
 	// Query account_transactions and access events within them
-	graphQLQuery := `query GetDataSubmittedEvents {
+	graphQLQuery := fmt.Sprintf(`query GetDataSubmittedEvents {
 		account_transactions(
-			limit: 1000,
+			limit: %d,
+			offset: %d,
 			order_by: { transaction_version: desc }
 		) {
 			account_address
@@ -999,7 +1126,7 @@ func (s *AptosServiceImpl) queryUsersFromGraphQLIndexerAlternative(eventType str
 				data
 			}
 		}
-	}`
+	}`, limit, offset)
 
 	requestBody := map[string]interface{}{
 		"query": graphQLQuery,
@@ -1013,7 +1140,7 @@ func (s *AptosServiceImpl) queryUsersFromGraphQLIndexerAlternative(eventType str
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", config.AppConfig.AptosIndexerURL, strings.NewReader(string(jsonBody)))
+	req, err := http.NewRequestWithContext(ctx, "POST", s.cfg.AptosIndexerURL, strings.NewReader(string(jsonBody)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -1039,14 +1166,7 @@ func (s *AptosServiceImpl) queryUsersFromGraphQLIndexerAlternative(eventType str
 
 	var graphQLResponse struct {
 		Data struct {
-			AccountTransactions []struct {
-				AccountAddress     string `json:"account_address"`
-				TransactionVersion int64  `json:"transaction_version"`
-				Events             []struct {
-					Type string          `json:"type"`
-					Data json.RawMessage `json:"data"`
-				} `json:"events"`
-			} `json:"account_transactions"`
+			AccountTransactions []indexerAccountTransaction `json:"account_transactions"`
 		} `json:"data"`
 		Errors []struct {
 			Message string `json:"message"`
@@ -1065,175 +1185,64 @@ func (s *AptosServiceImpl) queryUsersFromGraphQLIndexerAlternative(eventType str
 		return nil, fmt.Errorf("GraphQL errors: %s", strings.Join(errorMessages, "; "))
 	}
 
-	// Filter events by type and extract users
-	userSet := make(map[string]bool)
-	for _, tx := range graphQLResponse.Data.AccountTransactions {
-		for _, event := range tx.Events {
-			if event.Type == eventType {
-				// Add the account address that emitted the event
-				if tx.AccountAddress != "" {
-					userSet[tx.AccountAddress] = true
-				}
-
-				// Also extract user from event data
-				var eventData struct {
-					User string `json:"user"`
-				}
-				if err := json.Unmarshal(event.Data, &eventData); err == nil {
-					if eventData.User != "" {
-						userSet[eventData.User] = true
-					}
-				}
-			}
-		}
-	}
-
-	users := make([]string, 0, len(userSet))
-	for user := range userSet {
-		users = append(users, user)
-	}
-
-	fmt.Printf("DEBUG: Alternative query found %d unique users\n", len(users))
-	return users, nil
+	return graphQLResponse.Data.AccountTransactions, nil
 }
 
-// discoverUsersFromEventsTable queries recent transactions to find users who called submit_data
-// This is a pure blockchain approach - no in-memory storage
-func (s *AptosServiceImpl) discoverUsersFromEventsTable() ([]string, error) {
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
-	if err != nil {
-		return nil, err
-	}
-
-	// Query recent transactions and filter for ones that called our submit_data function
-	// We'll query transactions and check their payload to see if they call our module
-	moduleAddrStr := moduleAddr.String()
-	submitDataFunction := fmt.Sprintf("%s::data_registry::submit_data", moduleAddrStr)
-
-	// Query recent transactions from the REST API
-	// Query the most recent transactions and filter for ones that called submit_data
-	transactionsURL := fmt.Sprintf("%s/v1/transactions?limit=1000", config.AppConfig.AptosNodeURL)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", transactionsURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query transactions: %w", err)
-	}
-
-	bodyBytes, readErr := io.ReadAll(resp.Body)
-	resp.Body.Close()
-
-	if readErr != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", readErr)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("transactions query returned status %d: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	// The transactions endpoint returns an array directly
-	var transactions []map[string]interface{}
-
-	if err := json.Unmarshal(bodyBytes, &transactions); err != nil {
-		previewLen := 500
-		if len(bodyBytes) < previewLen {
-			previewLen = len(bodyBytes)
-		}
-		fmt.Printf("DEBUG: Failed to decode transactions. Response preview: %s\n", string(bodyBytes[:previewLen]))
-		return nil, fmt.Errorf("failed to decode transactions: %w", err)
-	}
-
-	fmt.Printf("DEBUG: Retrieved %d transactions from API\n", len(transactions))
-
-	// Extract users from transactions that called our submit_data function
-	userSet := make(map[string]bool)
-	for i, tx := range transactions {
-		// Check transaction type - should be "user_transaction"
-		txType, ok := tx["type"].(string)
-		if !ok || txType != "user_transaction" {
-			continue
-		}
-
-		// Get sender
-		sender, ok := tx["sender"].(string)
-		if !ok || sender == "" {
-			continue
-		}
-
-		// Get payload - it's nested under "payload" for user_transactions
-		payload, ok := tx["payload"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// Check if it's an entry function payload
-		payloadType, ok := payload["type"].(string)
-		if !ok || payloadType != "entry_function_payload" {
-			continue
-		}
-
-		// Get function name
-		function, ok := payload["function"].(string)
-		if !ok {
-			continue
-		}
-
-		if function == submitDataFunction {
-			userSet[sender] = true
-			fmt.Printf("DEBUG: Found user %s from transaction %d calling submit_data\n", sender, i)
-		}
-	}
-
-	users := make([]string, 0, len(userSet))
-	for user := range userSet {
-		users = append(users, user)
-	}
-
-	fmt.Printf("DEBUG: Discovered %d users from recent transactions\n", len(users))
-	return users, nil
+// marketplaceIndexerEntry is a row of the Geomi indexer's datax_marketplace table
+// Use interface{} for dataset_id since it might be string or number
+type marketplaceIndexerEntry struct {
+	User      string      `graphql:"user"`
+	DataHash  string      `graphql:"data_hash"`
+	DatasetID interface{} `graphql:"dataset_id"`
+	Metadata  string      `graphql:"metadata"`
 }
 
 // queryMarketplaceFromGeomiIndexer queries the Geomi indexer's datax_marketplace table
-func (s *AptosServiceImpl) queryMarketplaceFromGeomiIndexer() ([]interface{}, error) {
+// The owner filter is pushed into the GraphQL where clause. The table only tracks
+// DataSubmitted events, so rows come back unverified: is_active and created_at are
+// filled in later from the owner's DataStore (see verifyMarketplaceEntries)
+func (s *AptosServiceImpl) queryMarketplaceFromGeomiIndexer(owner string) ([]map[string]interface{}, error) {
 	if s.graphqlClient == nil {
 		return nil, fmt.Errorf("GraphQL client not initialized")
 	}
 
-	apiKey := strings.TrimSpace(config.AppConfig.AptosIndexerAPIKey)
+	apiKey := strings.TrimSpace(s.cfg.AptosIndexerAPIKey)
 	if apiKey == "" {
 		return nil, fmt.Errorf("APTOS_INDEXER_API_KEY is required but not set")
 	}
 
-	// Use interface{} for dataset_id since it might be string or number
-	var query struct {
-		DataxMarketplace []struct {
-			User      string      `graphql:"user"`
-			DataHash  string      `graphql:"data_hash"`
-			DatasetID interface{} `graphql:"dataset_id"`
-			Metadata  string      `graphql:"metadata"`
-		} `graphql:"datax_marketplace"`
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := s.graphqlClient.Query(ctx, &query, nil); err != nil {
-		fmt.Printf("DEBUG: GraphQL client query error: %v\n", err)
-		return nil, fmt.Errorf("GraphQL query failed: %w", err)
+	var entries []marketplaceIndexerEntry
+	if owner != "" {
+		var query struct {
+			DataxMarketplace []marketplaceIndexerEntry `graphql:"datax_marketplace(where: {user: {_eq: $user}})"`
+		}
+		variables := map[string]interface{}{
+			"user": owner,
+		}
+		if err := s.graphqlClient.Query(ctx, &query, variables); err != nil {
+			fmt.Printf("DEBUG: GraphQL client query error: %v\n", err)
+			return nil, fmt.Errorf("GraphQL query failed: %w", err)
+		}
+		entries = query.DataxMarketplace
+	} else {
+		var query struct {
+			DataxMarketplace []marketplaceIndexerEntry `graphql:"datax_marketplace"`
+		}
+		if err := s.graphqlClient.Query(ctx, &query, nil); err != nil {
+			fmt.Printf("DEBUG: GraphQL client query error: %v\n", err)
+			return nil, fmt.Errorf("GraphQL query failed: %w", err)
+		}
+		entries = query.DataxMarketplace
 	}
 
-	fmt.Printf("DEBUG: GraphQL query succeeded, found %d entries in datax_marketplace\n", len(query.DataxMarketplace))
+	fmt.Printf("DEBUG: GraphQL query succeeded, found %d entries in datax_marketplace\n", len(entries))
 
 	// Build initial dataset list from indexer
-	indexerDatasets := make([]map[string]interface{}, 0, len(query.DataxMarketplace))
-	for _, entry := range query.DataxMarketplace {
+	indexerDatasets := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
 		// Parse dataset_id which might be string or number
 		var datasetID uint64
 		switch v := entry.DatasetID.(type) {
@@ -1260,134 +1269,31 @@ func (s *AptosServiceImpl) queryMarketplaceFromGeomiIndexer() ([]interface{}, er
 			"owner":      entry.User,
 			"data_hash":  entry.DataHash,
 			"metadata":   entry.Metadata,
-			"created_at": 0,
+			"created_at": uint64(0),
 		})
 	}
 
 	fmt.Printf("DEBUG: Converted %d marketplace entries from indexer\n", len(indexerDatasets))
-
-	// CRITICAL: Verify is_active status from blockchain for each dataset
-	// The indexer only tracks DataSubmit events, not deletions
-	// So we must check the blockchain to see if datasets are still active
-	fmt.Printf("DEBUG: Verifying is_active status from blockchain for %d datasets...\n", len(indexerDatasets))
-
-	// Use concurrent worker pool to avoid timeouts (max 3 concurrent)
-	const maxConcurrent = 3
-	semaphore := make(chan struct{}, maxConcurrent)
-	var wg sync.WaitGroup
-
-	type verifiedDataset struct {
-		data     map[string]interface{}
-		isActive bool
-	}
-
-	resultsChan := make(chan verifiedDataset, len(indexerDatasets))
-
-	for _, ds := range indexerDatasets {
-		wg.Add(1)
-		go func(dataset map[string]interface{}) {
-			defer wg.Done()
-
-			// Acquire semaphore
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			owner := dataset["owner"].(string)
-			datasetID := dataset["id"].(uint64)
-
-			// Query blockchain to get actual is_active status
-			datasetInfo, err := s.GetDataset(owner, datasetID)
-			if err != nil {
-				fmt.Printf("DEBUG: Failed to verify dataset %d for owner %s: %v, skipping\n", datasetID, owner, err)
-				return
-			}
-
-			// Extract is_active from the returned data
-			var isActive bool
-			if datasetMap, ok := datasetInfo.(map[string]interface{}); ok {
-				if active, ok := datasetMap["is_active"].(bool); ok {
-					isActive = active
-				}
-			}
-
-			// Send result
-			resultsChan <- verifiedDataset{data: dataset, isActive: isActive}
-		}(ds)
-	}
-
-	// Close results channel when all workers are done
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-
-	// Collect results
-	datasets := make([]interface{}, 0, len(indexerDatasets))
-	for result := range resultsChan {
-		if !result.isActive {
-			datasetID := result.data["id"].(uint64)
-			owner := result.data["owner"].(string)
-			fmt.Printf("DEBUG: Dataset %d from owner %s is inactive (deleted), excluding from marketplace\n", datasetID, owner)
-			continue
-		}
-
-		// Add is_active to the dataset
-		result.data["is_active"] = true
-		datasets = append(datasets, result.data)
-	}
-
-	fmt.Printf("DEBUG: After filtering deleted datasets: %d active datasets (from %d indexed)\n", len(datasets), len(indexerDatasets))
-	return datasets, nil
-}
-
-// GetMarketplaceDatasets returns all datasets from the marketplace
-// Uses Geomi indexer to fetch data from datax_marketplace table, with blockchain fallback
-// It discovers users from chain events and queries their DataStore resources to get all datasets
-// This approach fetches data directly from on-chain state, not from memory
-func (s *AptosServiceImpl) GetMarketplaceDatasets() ([]interface{}, error) {
-	fmt.Printf("DEBUG: GetMarketplaceDatasets endpoint called\n")
-
-	// Check if indexer is configured
-	if config.AppConfig.AptosIndexerURL == "" {
-		fmt.Printf("DEBUG: Indexer URL not configured, falling back to blockchain query\n")
-		return s.getMarketplaceDatasetsFromBlockchain()
-	}
-
-	// Try to query from Geomi indexer first
-	fmt.Printf("DEBUG: Attempting to query Geomi indexer for marketplace data...\n")
-	datasets, err := s.queryMarketplaceFromGeomiIndexer()
-	if err != nil {
-		fmt.Printf("DEBUG: Failed to query Geomi indexer: %v\n", err)
-		fmt.Printf("DEBUG: Falling back to blockchain query method...\n")
-		return s.getMarketplaceDatasetsFromBlockchain()
-	}
-
-	fmt.Printf("DEBUG: Successfully queried Geomi indexer, found %d datasets\n", len(datasets))
-
-	// If indexer returns 0 datasets, it might be empty OR it might be out of sync/broken
-	// So we should fall back to blockchain query just in case
-	if len(datasets) == 0 {
-		fmt.Printf("DEBUG: No datasets found in indexer, falling back to blockchain query to be sure\n")
-		return s.getMarketplaceDatasetsFromBlockchain()
-	}
-
-	fmt.Printf("DEBUG: GetMarketplaceDatasets completed, returning %d datasets\n", len(datasets))
-	return datasets, nil
+	return indexerDatasets, nil
 }
 
 // getMarketplaceDatasetsFromBlockchain is the fallback method that queries blockchain directly
-func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain() ([]interface{}, error) {
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
-	if err != nil {
-		return nil, err
-	}
-
+// When an owner is given, user discovery is skipped and only that owner's DataStore is read
+// Inactive datasets are included (with is_active=false) so callers can filter them consistently
+// DataStore reads stop when ctx ends, leaving out the owners not read yet
+func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain(ctx context.Context, owner string) ([]interface{}, error) {
 	// Step 1: Discover users from chain (query events from module address)
-	fmt.Printf("DEBUG: Discovering users from blockchain...\n")
-	users, err := s.DiscoverUsersFromChain()
-	if err != nil {
-		fmt.Printf("DEBUG: Error discovering users: %v\n", err)
-		users = []string{}
+	var users []string
+	var err error
+	if owner != "" {
+		users = []string{owner}
+	} else {
+		fmt.Printf("DEBUG: Discovering users from blockchain...\n")
+		users, err = s.DiscoverUsersFromChain()
+		if err != nil {
+			fmt.Printf("DEBUG: Error discovering users: %v\n", err)
+			users = []string{}
+		}
 	}
 
 	// Fallback: If no users found via events, try to discover by querying events table directly
@@ -1414,6 +1320,19 @@ func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain() ([]interface{}
 		return []interface{}{}, nil
 	}
 
+	return s.queryDatasetsFromDataStores(ctx, users)
+}
+
+// queryDatasetsFromDataStores reads the DataStore resource of each user and returns all their datasets
+// is_active and created_at come straight from chain state, so the results need no further verification
+// When ctx ends first, the remaining reads are abandoned and the datasets read so far are returned;
+// callers tell a partial result by ctx.Err()
+func (s *AptosServiceImpl) queryDatasetsFromDataStores(ctx context.Context, users []string) ([]interface{}, error) {
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
+	if err != nil {
+		return nil, err
+	}
+
 	// Step 3: Query DataStore resources directly from each discovered user account
 	// This is more reliable than querying events, as it gets data directly from on-chain state
 	// Use concurrent requests with proper error handling
@@ -1423,25 +1342,22 @@ func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain() ([]interface{}
 
 	resourceType := fmt.Sprintf("%s::data_registry::DataStore", moduleAddr.String())
 
-	// Use a worker pool to query users concurrently (max 3 concurrent requests to avoid overwhelming the API)
-	const maxConcurrent = 3
-	semaphore := make(chan struct{}, maxConcurrent)
-	var wg sync.WaitGroup
-
-	for _, userAddr := range users {
-		wg.Add(1)
-		go func(addr string) {
-			defer wg.Done()
+	// Query users concurrently, MARKETPLACE_CONCURRENCY at a time to avoid overwhelming the API
+	// An owner that fails is logged and skipped; only running out of time stops the whole group
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(max(config.Tunable().MarketplaceConcurrency, 1))
 
-			// Acquire semaphore
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+	for _, addr := range users {
+		group.Go(func() error {
+			if err := groupCtx.Err(); err != nil {
+				return err
+			}
 
 			fmt.Printf("DEBUG: Querying DataStore resource from user: %s\n", addr)
 
 			// Query DataStore resource directly from chain with retry
 			resourceURL := fmt.Sprintf("%s/v1/accounts/%s/resource/%s",
-				config.AppConfig.AptosNodeURL,
+				s.cfg.AptosNodeURL,
 				addr,
 				url.PathEscape(resourceType))
 
@@ -1452,10 +1368,14 @@ func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain() ([]interface{}
 			// Retry up to 2 times
 			for attempt := 0; attempt < 2; attempt++ {
 				if attempt > 0 {
-					time.Sleep(500 * time.Millisecond)
+					select {
+					case <-time.After(500 * time.Millisecond):
+					case <-groupCtx.Done():
+						return groupCtx.Err()
+					}
 				}
 
-				ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+				ctx, cancel := context.WithTimeout(groupCtx, 15*time.Second)
 				req, reqErr := http.NewRequestWithContext(ctx, "GET", resourceURL, nil)
 				if reqErr != nil {
 					cancel()
@@ -1478,14 +1398,14 @@ func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain() ([]interface{}
 					cancel()
 					resp.Body.Close()
 					fmt.Printf("DEBUG: No DataStore found for user %s\n", addr)
-					return
+					return nil
 				}
 
 				if resp.StatusCode != http.StatusOK {
 					cancel()
 					resp.Body.Close()
 					fmt.Printf("DEBUG: DataStore query returned status %d for user %s\n", resp.StatusCode, addr)
-					return
+					return nil
 				}
 
 				// Read the entire response body before canceling context
@@ -1503,8 +1423,11 @@ func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain() ([]interface{}
 			}
 
 			if err != nil || bodyBytes == nil {
+				if groupCtx.Err() != nil {
+					return groupCtx.Err()
+				}
 				fmt.Printf("DEBUG: Failed to query DataStore from %s after retries: %v\n", addr, err)
-				return
+				return nil
 			}
 
 			// Parse the DataStore resource from the already-read body bytes
@@ -1527,7 +1450,7 @@ func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain() ([]interface{}
 				if len(bodyBytes) > 0 && len(bodyBytes) < 500 {
 					fmt.Printf("DEBUG: Response body preview: %s\n", string(bodyBytes))
 				}
-				return
+				return nil
 			}
 
 			fmt.Printf("DEBUG: Found %d datasets in DataStore for user %s\n", len(resourceData.Data.Datasets), addr)
@@ -1624,11 +1547,6 @@ func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain() ([]interface{}
 					isActive = (v != 0)
 				}
 
-				// Only include active datasets
-				if !isActive {
-					continue
-				}
-
 				// Create dataset info map
 				datasetInfo := map[string]interface{}{
 					"id":         datasetID,
@@ -1646,42 +1564,160 @@ func (s *AptosServiceImpl) getMarketplaceDatasetsFromBlockchain() ([]interface{}
 			datasetsMutex.Lock()
 			datasets = append(datasets, userDatasets...)
 			datasetsMutex.Unlock()
-		}(userAddr)
+			return nil
+		})
 	}
 
-	// Wait for all goroutines to complete
-	wg.Wait()
+	if err := group.Wait(); err != nil {
+		fmt.Printf("WARNING: Stopped reading DataStores before every user was read: %v\n", err)
+	}
 
 	fmt.Printf("DEBUG: Marketplace returning %d datasets from blockchain (DataStore resources)\n", len(datasets))
 	return datasets, nil
 }
 
-// RequestAccess stores an access request
-// Note: In a production system, access requests should be stored on-chain
-// For now, this is a no-op as we're removing in-memory storage
-func RequestAccess(ownerAddress string, datasetID uint64, requesterAddress string, message string) {
-	// Access requests should be stored on-chain via a smart contract
-	// This function is kept for API compatibility but does nothing
-	fmt.Printf("DEBUG: Access request received (not stored - should be on-chain): owner=%s, dataset=%d, requester=%s\n",
-		ownerAddress, datasetID, requesterAddress)
-}
-
 // GetAccessRequests returns access requests for a dataset owner
-// Note: In a production system, this should query on-chain access requests
-func (s *AptosServiceImpl) GetAccessRequests(ownerAddress string) ([]interface{}, error) {
-	// Access requests should be queried from the blockchain
-	// For now, return empty list as we're removing in-memory storage
-	fmt.Printf("DEBUG: GetAccessRequests called for %s (returning empty - should query blockchain)\n", ownerAddress)
-	return []interface{}{}, nil
+// Reads AccessRequested events from the owner's AccessControl request event handle,
+// drops requests for datasets the owner has since deleted, and marks each request
+// as approved or pending by cross-referencing the on-chain grants
+func (s *AptosServiceImpl) GetAccessRequests(ownerAddress string, start uint64, limit uint64) ([]models.AccessRequest, error) {
+	ownerAddr, err := parseAddress(ownerAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	moduleAddr, err := parseAddress(s.cfg.NetworkModuleAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit == 0 {
+		limit = 100
+	}
+
+	// Events are read through the handle stored in the owner's AccessRequests resource
+	eventHandle := fmt.Sprintf("%s::AccessControl::AccessRequests", moduleAddr.String())
+	eventsURL := fmt.Sprintf("%s/v1/accounts/%s/events/%s/request_events?start=%d&limit=%d",
+		strings.TrimSuffix(s.cfg.AptosNodeURL, "/"),
+		ownerAddr.String(),
+		url.PathEscape(eventHandle),
+		start,
+		limit)
+
+	bodyBytes, statusCode, err := s.getWithRetry(eventsURL, "GetAccessRequests")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query access request events: %w", err)
+	}
+	if statusCode == http.StatusNotFound {
+		// Owner never initialized AccessControl, so nobody could have requested access
+		return []models.AccessRequest{}, nil
+	}
+
+	var events []struct {
+		SequenceNumber string `json:"sequence_number"`
+		Data           struct {
+			Requester   string      `json:"requester"`
+			DatasetID   interface{} `json:"dataset_id"`
+			Message     string      `json:"message"`
+			RequestedAt interface{} `json:"requested_at"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(bodyBytes, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode access request events: %w", err)
+	}
+
+	fmt.Printf("DEBUG: Found %d AccessRequested events for owner %s\n", len(events), ownerAddr.String())
+
+	// Look up which datasets are still active so requests for deleted ones can be dropped
+	activeDatasets := make(map[uint64]bool)
+	datasets, err := s.GetUserDatasetsMetadata(ownerAddr.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load owner datasets: %w", err)
+	}
+	for _, d := range datasets {
+		if datasetMap, ok := d.(map[string]interface{}); ok {
+			id, _ := datasetMap["id"].(uint64)
+			isActive, _ := datasetMap["is_active"].(bool)
+			activeDatasets[id] = isActive
+		}
+	}
+
+	requests := make([]models.AccessRequest, 0, len(events))
+	for _, event := range events {
+		var datasetID uint64
+		switch v := event.Data.DatasetID.(type) {
+		case float64:
+			datasetID = uint64(v)
+		case string:
+			parsed, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				continue
+			}
+			datasetID = parsed
+		default:
+			continue
+		}
+
+		if !activeDatasets[datasetID] {
+			fmt.Printf("DEBUG: Skipping access request for deleted dataset %d\n", datasetID)
+			continue
+		}
+
+		// vector<u8> fields come back as 0x-prefixed hex strings
+		message := event.Data.Message
+		if decoded, err := hex.DecodeString(strings.TrimPrefix(message, "0x")); err == nil {
+			message = string(decoded)
+		}
+
+		var requestedAt uint64
+		switch v := event.Data.RequestedAt.(type) {
+		case float64:
+			requestedAt = uint64(v)
+		case string:
+			parsed, _ := strconv.ParseUint(v, 10, 64)
+			requestedAt = parsed
+		}
+
+		// A request is approved once the owner has granted access on-chain
+		status := "pending"
+		hasAccess, err := s.CheckAccess(ownerAddr.String(), datasetID, event.Data.Requester)
+		if err != nil {
+			fmt.Printf("DEBUG: Failed to check grant for requester %s on dataset %d: %v\n", event.Data.Requester, datasetID, err)
+		} else if hasAccess {
+			status = "approved"
+		}
+
+		requests = append(requests, models.AccessRequest{
+			ID:               fmt.Sprintf("%s-%s", ownerAddr.String(), event.SequenceNumber),
+			OwnerAddress:     ownerAddr.String(),
+			RequesterAddress: event.Data.Requester,
+			DatasetID:        datasetID,
+			Status:           status,
+			Message:          message,
+			CreatedAt:        time.Unix(int64(requestedAt), 0).UTC().Format(time.RFC3339),
+		})
+	}
+
+	return requests, nil
 }
 
-func (s *AptosServiceImpl) GetUserVault(userAddress string) ([]uint64, error) {
+// GetUserVault returns the dataset IDs in a user's Vault resource, none when it doesn't exist
+// The fullnode is read with the getWithRetry policy, abandoned when ctx ends
+func (s *AptosServiceImpl) GetUserVault(ctx context.Context, userAddress string) ([]uint64, error) {
 	userAddr, err := parseAddress(userAddress)
 	if err != nil {
 		return nil, err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.NetworkModuleAddr)
+	if index := s.localIndex(); index != nil {
+		datasetIDs, err := index.VaultDatasetIDs(userAddr.String())
+		if err == nil {
+			return datasetIDs, nil
+		}
+		fmt.Printf("WARNING: Local index vault read failed, querying the chain: %v\n", err)
+	}
+
+	moduleAddr, err := parseAddress(s.cfg.NetworkModuleAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -1691,25 +1727,20 @@ func (s *AptosServiceImpl) GetUserVault(userAddress string) ([]uint64, error) {
 
 	// Query the resource directly via REST API
 	resourceURL := fmt.Sprintf("%s/v1/accounts/%s/resource/%s",
-		config.AppConfig.AptosNodeURL,
+		s.cfg.AptosNodeURL,
 		userAddr.String(),
 		url.PathEscape(resourceType))
 
-	resp, err := http.Get(resourceURL)
+	bodyBytes, statusCode, err := s.getWithRetryContext(ctx, resourceURL, "UserVault")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query resource: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
+	if statusCode == http.StatusNotFound {
 		// Resource doesn't exist, return empty array
 		return []uint64{}, nil
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
 	// Parse the response
 	var resourceData struct {
 		Data struct {
@@ -1717,7 +1748,7 @@ func (s *AptosServiceImpl) GetUserVault(userAddress string) ([]uint64, error) {
 		} `json:"data"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&resourceData); err != nil {
+	if err := json.Unmarshal(bodyBytes, &resourceData); err != nil {
 		return nil, fmt.Errorf("failed to decode resource data: %w", err)
 	}
 
@@ -1749,15 +1780,38 @@ func (s *AptosServiceImpl) GetUserVault(userAddress string) ([]uint64, error) {
 	return datasetIDs, nil
 }
 
-// GetUserDatasetsMetadata returns minimal metadata (id, metadata, is_active) for all datasets
+// GetUserDatasetsMetadata returns minimal metadata (id, metadata, is_active, created_at) for all datasets
 // This is optimized for batch operations like populating dropdowns
 func (s *AptosServiceImpl) GetUserDatasetsMetadata(userAddress string) ([]interface{}, error) {
+	return s.userDatasetsMetadata(context.Background(), userAddress)
+}
+
+// userDatasetsMetadata is GetUserDatasetsMetadata giving up, retries included, when ctx ends
+func (s *AptosServiceImpl) userDatasetsMetadata(ctx context.Context, userAddress string) ([]interface{}, error) {
 	userAddr, err := parseAddress(userAddress)
 	if err != nil {
 		return nil, err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
+	if index := s.localIndex(); index != nil {
+		datasets, err := index.Datasets(userAddr.String())
+		if err == nil {
+			result := make([]interface{}, 0, len(datasets))
+			for _, dataset := range datasets {
+				result = append(result, map[string]interface{}{
+					"id":         dataset.ID,
+					"data_hash":  dataset.DataHash,
+					"metadata":   dataset.Metadata,
+					"created_at": dataset.CreatedAt,
+					"is_active":  dataset.IsActive,
+				})
+			}
+			return result, nil
+		}
+		fmt.Printf("WARNING: Local index dataset read failed, querying the chain: %v\n", err)
+	}
+
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -1765,7 +1819,7 @@ func (s *AptosServiceImpl) GetUserDatasetsMetadata(userAddress string) ([]interf
 	// Query the DataStore resource directly
 	resourceType := fmt.Sprintf("%s::data_registry::DataStore", moduleAddr.String())
 	resourceURL := fmt.Sprintf("%s/v1/accounts/%s/resource/%s",
-		config.AppConfig.AptosNodeURL,
+		s.cfg.AptosNodeURL,
 		userAddr.String(),
 		url.PathEscape(resourceType))
 
@@ -1779,11 +1833,15 @@ func (s *AptosServiceImpl) GetUserDatasetsMetadata(userAddress string) ([]interf
 		if attempt > 0 {
 			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
 			fmt.Printf("DEBUG: Retrying GetUserDatasetsMetadata query (attempt %d/3) after %v\n", attempt+1, backoff)
-			time.Sleep(backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		req, err := http.NewRequestWithContext(ctx, "GET", resourceURL, nil)
+		reqCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		req, err := http.NewRequestWithContext(reqCtx, "GET", resourceURL, nil)
 		if err != nil {
 			cancel()
 			lastErr = err
@@ -1791,9 +1849,8 @@ func (s *AptosServiceImpl) GetUserDatasetsMetadata(userAddress string) ([]interf
 		}
 
 		resp, err = s.httpClient.Do(req)
-		cancel()
-
 		if err != nil {
+			cancel()
 			lastErr = fmt.Errorf("failed to query DataStore resource: %w", err)
 			if resp != nil {
 				resp.Body.Close()
@@ -1803,6 +1860,7 @@ func (s *AptosServiceImpl) GetUserDatasetsMetadata(userAddress string) ([]interf
 
 		bodyBytes, err = io.ReadAll(resp.Body)
 		resp.Body.Close()
+		cancel()
 		lastStatusCode = resp.StatusCode
 
 		if err != nil {
@@ -1820,7 +1878,11 @@ func (s *AptosServiceImpl) GetUserDatasetsMetadata(userAddress string) ([]interf
 			lastErr = fmt.Errorf("rate limited (429)")
 			bodyBytes = nil
 			if attempt < 2 {
-				time.Sleep(5 * time.Second)
+				select {
+				case <-time.After(5 * time.Second):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
 			}
 			continue
 		}
@@ -1854,9 +1916,11 @@ func (s *AptosServiceImpl) GetUserDatasetsMetadata(userAddress string) ([]interf
 	var resourceData struct {
 		Data struct {
 			Datasets []struct {
-				ID       interface{} `json:"id"`
-				Metadata interface{} `json:"metadata"`
-				IsActive interface{} `json:"is_active"`
+				ID        interface{} `json:"id"`
+				DataHash  interface{} `json:"data_hash"`
+				Metadata  interface{} `json:"metadata"`
+				CreatedAt interface{} `json:"created_at"`
+				IsActive  interface{} `json:"is_active"`
 			} `json:"datasets"`
 		} `json:"data"`
 	}
@@ -1915,10 +1979,21 @@ func (s *AptosServiceImpl) GetUserDatasetsMetadata(userAddress string) ([]interf
 			isActive = (v != 0)
 		}
 
+		// Parse created_at
+		var createdAt uint64
+		switch v := dataset.CreatedAt.(type) {
+		case float64:
+			createdAt = uint64(v)
+		case string:
+			createdAt, _ = strconv.ParseUint(v, 10, 64)
+		}
+
 		result = append(result, map[string]interface{}{
-			"id":        id,
-			"metadata":  metadataStr,
-			"is_active": isActive,
+			"id":         id,
+			"data_hash":  dataHashToHex(dataset.DataHash),
+			"metadata":   metadataStr,
+			"created_at": createdAt,
+			"is_active":  isActive,
 		})
 	}
 
@@ -1933,7 +2008,7 @@ func (s *AptosServiceImpl) IsAccountInitialized(userAddress string) (bool, error
 		return false, err
 	}
 
-	moduleAddr, err := parseAddress(config.AppConfig.NetworkModuleAddr)
+	moduleAddr, err := parseAddress(s.cfg.NetworkModuleAddr)
 	if err != nil {
 		return false, err
 	}
@@ -1944,92 +2019,126 @@ func (s *AptosServiceImpl) IsAccountInitialized(userAddress string) (bool, error
 	// Check if the Vault resource exists by querying it directly via REST API
 	// Build the resource URL - use PathEscape for path segments
 	resourceURL := fmt.Sprintf("%s/v1/accounts/%s/resource/%s",
-		config.AppConfig.AptosNodeURL,
+		s.cfg.AptosNodeURL,
 		userAddr.String(),
 		url.PathEscape(resourceType))
 
-	// Make HTTP request to check if resource exists
-	// This is a simpler approach than using view functions
-	resp, err := http.Get(resourceURL)
+	// Only a 404 means "not initialized": a node that can't be reached or answers anything
+	// else is an error, so callers never tell a user to initialize (and pay gas) twice
+	_, statusCode, err := s.getWithRetry(resourceURL, "Vault")
 	if err != nil {
-		return false, nil
-	}
-	defer resp.Body.Close()
-
-	// If we get 200, the resource exists (account is initialized)
-	// If we get 404, the resource doesn't exist (account not initialized)
-	if resp.StatusCode == http.StatusOK {
-		return true, nil
-	} else if resp.StatusCode == http.StatusNotFound {
-		return false, nil
+		return false, fmt.Errorf("failed to check the Vault resource: %w", err)
 	}
-
-	// Other status codes indicate an error
-	return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	return statusCode == http.StatusOK, nil
 }
 
-// CheckDataHashExists checks if a data hash already exists in the marketplace
-func (s *AptosServiceImpl) CheckDataHashExists(dataHash string) (bool, error) {
-	// Ensure hash format (0x prefix)
-	if !strings.HasPrefix(dataHash, "0x") {
-		dataHash = "0x" + dataHash
+// FindDatasetsByDataHash returns the datasets registered with a data hash, only the owner's
+// when owner is given. Hashes are compared lowercase with a 0x prefix on both sides
+func (s *AptosServiceImpl) FindDatasetsByDataHash(ctx context.Context, dataHash string, owner string) ([]models.DatasetRef, error) {
+	hash := NormalizeDataHash(dataHash)
+	if hash == "" {
+		return nil, fmt.Errorf("invalid data hash %q", dataHash)
 	}
 
 	// 1. Try Indexer first (most efficient)
-	if config.AppConfig.AptosIndexerURL != "" {
-		exists, err := s.checkDataHashFromIndexer(dataHash)
-		if err == nil && exists {
-			// If indexer says it exists, it definitely exists
-			return true, nil
+	if s.cfg.AptosIndexerURL != "" {
+		refs, err := s.findDataHashInIndexer(hash, owner)
+		if err == nil && len(refs) > 0 {
+			// If indexer has it, it definitely exists
+			return refs, nil
 		}
-		// If indexer says false, it might be lagging, so we fall back to blockchain
+		// If indexer has nothing, it might be lagging, so we fall back to blockchain
 		if err != nil {
 			fmt.Printf("DEBUG: Indexer check failed: %v. Falling back to blockchain.\n", err)
 		} else {
-			fmt.Printf("DEBUG: Indexer returned false, double-checking with blockchain (in case of lag).\n")
+			fmt.Printf("DEBUG: Indexer returned no match, double-checking with blockchain (in case of lag).\n")
 		}
 	}
 
-	// 2. Fallback: Get all datasets and check (less efficient but reliable)
-	datasets, err := s.GetMarketplaceDatasets()
+	// 2. Fallback: Get the datasets (only the owner's when scoped) and check (less efficient but reliable)
+	page, err := s.GetMarketplaceDatasets(ctx, models.MarketplaceFilter{Owner: owner})
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	for _, d := range datasets {
-		if datasetMap, ok := d.(map[string]interface{}); ok {
-			if hash, ok := datasetMap["data_hash"].(string); ok {
-				if hash == dataHash {
-					return true, nil
-				}
-			}
+	refs := []models.DatasetRef{}
+	for _, d := range page.Datasets {
+		datasetMap, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		datasetHash, _ := datasetMap["data_hash"].(string)
+		if NormalizeDataHash(datasetHash) != hash {
+			continue
 		}
+		datasetOwner, _ := datasetMap["owner"].(string)
+		id, _ := datasetMap["id"].(uint64)
+		refs = append(refs, models.DatasetRef{Owner: datasetOwner, DatasetID: id})
 	}
-
-	return false, nil
+	return refs, nil
 }
 
-func (s *AptosServiceImpl) checkDataHashFromIndexer(dataHash string) (bool, error) {
+// findDataHashInIndexer looks a normalized data hash up in the datax_marketplace table. The
+// column holds hashes as they were submitted, so the lowercase and uppercase forms are
+// matched with and without the 0x prefix
+func (s *AptosServiceImpl) findDataHashInIndexer(hash string, owner string) ([]models.DatasetRef, error) {
 	if s.graphqlClient == nil {
-		return false, fmt.Errorf("GraphQL client not initialized")
-	}
-
-	var query struct {
-		DataxMarketplace []struct {
-			DataHash string `graphql:"data_hash"`
-		} `graphql:"datax_marketplace(where: {data_hash: {_eq: $data_hash}})"`
+		return nil, fmt.Errorf("GraphQL client not initialized")
 	}
 
-	variables := map[string]interface{}{
-		"data_hash": dataHash,
-	}
+	digest := strings.TrimPrefix(hash, "0x")
+	variants := []string{hash, digest, "0x" + strings.ToUpper(digest), strings.ToUpper(digest)}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := s.graphqlClient.Query(ctx, &query, variables); err != nil {
-		return false, err
+	var entries []marketplaceIndexerEntry
+	if owner != "" {
+		var query struct {
+			DataxMarketplace []marketplaceIndexerEntry `graphql:"datax_marketplace(where: {data_hash: {_in: $data_hashes}, user: {_eq: $user}})"`
+		}
+		variables := map[string]interface{}{
+			"data_hashes": variants,
+			"user":        owner,
+		}
+		if err := s.graphqlClient.Query(ctx, &query, variables); err != nil {
+			return nil, err
+		}
+		entries = query.DataxMarketplace
+	} else {
+		var query struct {
+			DataxMarketplace []marketplaceIndexerEntry `graphql:"datax_marketplace(where: {data_hash: {_in: $data_hashes}})"`
+		}
+		variables := map[string]interface{}{
+			"data_hashes": variants,
+		}
+		if err := s.graphqlClient.Query(ctx, &query, variables); err != nil {
+			return nil, err
+		}
+		entries = query.DataxMarketplace
 	}
 
-	return len(query.DataxMarketplace) > 0, nil
+	refs := make([]models.DatasetRef, 0, len(entries))
+	for _, entry := range entries {
+		if NormalizeDataHash(entry.DataHash) != hash {
+			continue
+		}
+		var id uint64
+		switch v := entry.DatasetID.(type) {
+		case float64:
+			id = uint64(v)
+		case string:
+			parsed, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				fmt.Printf("DEBUG: Failed to parse dataset_id '%v', skipping entry\n", v)
+				continue
+			}
+			id = parsed
+		default:
+			fmt.Printf("DEBUG: Unknown dataset_id type %T: %v, skipping entry\n", v, v)
+			continue
+		}
+		refs = append(refs, models.DatasetRef{Owner: entry.User, DatasetID: id})
+	}
+	return refs, nil
 }
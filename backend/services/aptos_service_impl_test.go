@@ -0,0 +1,517 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/datax/backend/models"
+	"github.com/hasura/go-graphql-client"
+)
+
+var (
+	graphQLLimit  = regexp.MustCompile(`limit:\s*(\d+)`)
+	graphQLOffset = regexp.MustCompile(`offset:\s*(\d+)`)
+)
+
+// newPagedIndexer serves rows of one GraphQL table, cut into pages by the limit and offset in
+// each query. It counts the queries it answers
+func newPagedIndexer(t *testing.T, table string, rows []map[string]interface{}) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var queries atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		var request struct {
+			Query string `json:"query"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		limit, offset := len(rows), 0
+		if m := graphQLLimit.FindStringSubmatch(request.Query); m != nil {
+			limit, _ = strconv.Atoi(m[1])
+		}
+		if m := graphQLOffset.FindStringSubmatch(request.Query); m != nil {
+			offset, _ = strconv.Atoi(m[1])
+		}
+		page := make([]map[string]interface{}, 0)
+		for i := offset; i < len(rows) && i < offset+limit; i++ {
+			page = append(page, rows[i])
+		}
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{table: page}})
+	}))
+	t.Cleanup(server.Close)
+	return server, &queries
+}
+
+// indexerUsers are the owners of five datax_marketplace rows; with a page size of two they
+// take three pages, the last one short
+var indexerUsers = []string{testOwnerA, testOwnerA, testOwnerB, testOwnerB, testOwnerC}
+
+func TestQueryUsersFromGraphQLIndexerPagesUntilAShortPage(t *testing.T) {
+	rows := make([]map[string]interface{}, 0, len(indexerUsers))
+	for i, user := range indexerUsers {
+		rows = append(rows, marketplaceRow(user, uint64(i), fmt.Sprintf("d%d", i)))
+	}
+	indexer, queries := newPagedIndexer(t, "datax_marketplace", rows)
+
+	service := newTestService(t, newFakeNode(t), func(cfg *ServiceConfig) {
+		cfg.AptosIndexerURL = indexer.URL
+		cfg.IndexerPageSize = 2
+		cfg.IndexerMaxPages = 10
+	})
+
+	users, err := service.queryUsersFromGraphQLIndexer("")
+	if err != nil {
+		t.Fatalf("queryUsersFromGraphQLIndexer: %v", err)
+	}
+
+	sort.Strings(users)
+	want := []string{mustAddress(testOwnerA), mustAddress(testOwnerB), mustAddress(testOwnerC)}
+	if fmt.Sprint(users) != fmt.Sprint(want) {
+		t.Errorf("users = %v, want %v", users, want)
+	}
+	if got := queries.Load(); got != 3 {
+		t.Errorf("indexer got %d queries, want 3", got)
+	}
+}
+
+func TestQueryUsersFromGraphQLIndexerStopsAtMaxPages(t *testing.T) {
+	// Ten full pages of rows, but only three may be read
+	rows := make([]map[string]interface{}, 0, 20)
+	for i := 0; i < 20; i++ {
+		rows = append(rows, marketplaceRow(fmt.Sprintf("0x%x", 0xd000+i), uint64(i), fmt.Sprintf("d%d", i)))
+	}
+	indexer, queries := newPagedIndexer(t, "datax_marketplace", rows)
+
+	service := newTestService(t, newFakeNode(t), func(cfg *ServiceConfig) {
+		cfg.AptosIndexerURL = indexer.URL
+		cfg.IndexerPageSize = 2
+		cfg.IndexerMaxPages = 3
+	})
+
+	users, err := service.queryUsersFromGraphQLIndexer("")
+	if err != nil {
+		t.Fatalf("queryUsersFromGraphQLIndexer: %v", err)
+	}
+	if len(users) != 6 {
+		t.Errorf("found %d users, want the 6 on the first three pages", len(users))
+	}
+	if got := queries.Load(); got != 3 {
+		t.Errorf("indexer got %d queries, want 3", got)
+	}
+}
+
+func TestQueryUsersFromGraphQLIndexerAlternativePages(t *testing.T) {
+	eventType := mustAddress(testModuleAddr) + "::data_registry::DataSubmitted"
+	rows := make([]map[string]interface{}, 0, len(indexerUsers))
+	for i, user := range indexerUsers {
+		rows = append(rows, map[string]interface{}{
+			"account_address":     mustAddress(user),
+			"transaction_version": 100 - i,
+			"events": []map[string]interface{}{
+				{"type": eventType, "data": map[string]interface{}{"user": mustAddress(user)}},
+				{"type": "0x1::coin::WithdrawEvent", "data": map[string]interface{}{"amount": "1"}},
+			},
+		})
+	}
+	indexer, queries := newPagedIndexer(t, "account_transactions", rows)
+
+	service := newTestService(t, newFakeNode(t), func(cfg *ServiceConfig) {
+		cfg.AptosIndexerURL = indexer.URL
+		cfg.IndexerPageSize = 2
+		cfg.IndexerMaxPages = 10
+	})
+
+	users, err := service.queryUsersFromGraphQLIndexerAlternative(eventType)
+	if err != nil {
+		t.Fatalf("queryUsersFromGraphQLIndexerAlternative: %v", err)
+	}
+	if len(users) != 3 {
+		t.Errorf("users = %v, want the three distinct submitters", users)
+	}
+	if got := queries.Load(); got != 3 {
+		t.Errorf("indexer got %d queries, want 3", got)
+	}
+}
+
+func TestNormalizeAddressAcceptsAIP40Forms(t *testing.T) {
+	long := "0x" + strings.Repeat("0", 56) + "0a550c18"
+	cases := map[string]string{
+		"0x1":                          "0x1",
+		"0X1":                          "0x1",
+		"1":                            "0x1",
+		"0xA550C18":                    long,
+		"  0xa550c18\n":                long,
+		strings.ToUpper(long[2:]):      long,
+		testOwnerA:                     testOwnerA,
+		"0x" + strings.Repeat("F", 64): "0x" + strings.Repeat("f", 64),
+	}
+	for input, want := range cases {
+		if got, err := NormalizeAddress(input); err != nil || got != want {
+			t.Errorf("NormalizeAddress(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", "0x", "  ", "0x" + strings.Repeat("1", 65), "0xg1", "0x 1", "0x-1"} {
+		if got, err := NormalizeAddress(input); err == nil {
+			t.Errorf("NormalizeAddress(%q) = %q, want an error", input, got)
+		}
+	}
+}
+
+func TestSubmitTransactionSubmitsTheEntryFunction(t *testing.T) {
+	client := &fakeAptosClient{}
+	service := newFakeClientService(t, client)
+	account, err := getAccountFromPrivateKey(testSignerKey)
+	if err != nil {
+		t.Fatalf("getAccountFromPrivateKey: %v", err)
+	}
+
+	args := []interface{}{[]byte("0xabc"), []byte(`{"name":"test"}`)}
+	hash, err := service.submitTransaction(account, mustParseAddress(t, testModuleAddr), "data_registry", "submit_data", args)
+	if err != nil {
+		t.Fatalf("submitTransaction: %v", err)
+	}
+	if hash != fmt.Sprintf("0x%064x", 1) {
+		t.Errorf("hash %s, want the submitted transaction's", hash)
+	}
+	call := client.lastSubmitted(t)
+	if call.Module.Address.String() != mustAddress(testModuleAddr) || call.Module.Name != "data_registry" || call.Function != "submit_data" {
+		t.Errorf("called %s::%s::%s, want data_registry::submit_data", call.Module.Address.String(), call.Module.Name, call.Function)
+	}
+	if want := encodedArgs(t, args...); len(call.ArgTypes) != 0 || !reflect.DeepEqual(call.Args, want) {
+		t.Errorf("arguments %x with type arguments %v, want %x", call.Args, call.ArgTypes, want)
+	}
+
+	// An argument Move can't hold is refused before anything is sent
+	if _, err := service.submitTransaction(account, mustParseAddress(t, testModuleAddr), "data_registry", "submit_data", []interface{}{1.5}); err == nil {
+		t.Error("a float argument was submitted")
+	}
+	if len(client.submitted) != 1 {
+		t.Errorf("%d transactions submitted, want 1", len(client.submitted))
+	}
+}
+
+func TestSubmitTransactionReportsHowItFailed(t *testing.T) {
+	account, err := getAccountFromPrivateKey(testSignerKey)
+	if err != nil {
+		t.Fatalf("getAccountFromPrivateKey: %v", err)
+	}
+	submit := func(client *fakeAptosClient) error {
+		service := newFakeClientService(t, client)
+		_, err := service.submitTransaction(account, mustParseAddress(t, testModuleAddr), "data_registry", "delete_dataset", []interface{}{uint64(3)})
+		return err
+	}
+
+	// Refused by the node: nothing was sent, so it is safe to try again
+	err = submit(&fakeAptosClient{submitErr: errors.New("mempool is full")})
+	if err == nil || errors.Is(err, ErrTransactionUnconfirmed) || !strings.Contains(err.Error(), "mempool is full") {
+		t.Errorf("refused submission = %v, want the node's error", err)
+	}
+
+	// Sent but never confirmed: it may still commit
+	err = submit(&fakeAptosClient{waitErr: errors.New("context deadline exceeded")})
+	if !errors.Is(err, ErrTransactionUnconfirmed) {
+		t.Errorf("unconfirmed transaction = %v, want ErrTransactionUnconfirmed", err)
+	}
+
+	// Committed but aborted in the module
+	err = submit(&fakeAptosClient{vmStatus: "Move abort in 0xcafe1::data_registry: E_DATASET_NOT_FOUND(0x2): gone"})
+	var txErr *TransactionError
+	if !errors.As(err, &txErr) || txErr.Module != "data_registry" || txErr.AbortCode != abortDatasetNotFound || txErr.Hash == "" {
+		t.Errorf("aborted transaction = %#v, want a TransactionError for data_registry abort 2", err)
+	}
+}
+
+// accessListPath is the REST path of an owner's AccessList resource
+func accessListPath(owner string) string {
+	return fmt.Sprintf("/v1/accounts/%s/resource/%s::AccessControl::AccessList", mustAddress(owner), mustAddress(testModuleAddr))
+}
+
+// accessListEntryJSON is an AccessList entry as the node returns it
+func accessListEntryJSON(datasetID uint64, requester string, expiresAt uint64) map[string]string {
+	return map[string]string{
+		"dataset_id": strconv.FormatUint(datasetID, 10),
+		"requester":  mustAddress(requester),
+		"expires_at": strconv.FormatUint(expiresAt, 10),
+	}
+}
+
+func TestCheckAccessJudgesGrantsByTheLedgerClock(t *testing.T) {
+	node := newFakeNode(t)
+	service := newTestService(t, node, func(cfg *ServiceConfig) { cfg.AccessExpirySkew = 0 })
+	const now = 1_800_000_000
+	node.handleJSON("/v1", map[string]string{"ledger_timestamp": strconv.FormatUint(now*1_000_000, 10)})
+	node.handleJSON(accessListPath(testOwnerA), map[string]interface{}{
+		"data": map[string]interface{}{"entries": []map[string]string{
+			accessListEntryJSON(1, testOwnerB, now+60),
+			accessListEntryJSON(2, testOwnerB, now-60),
+			accessListEntryJSON(3, testOwnerB, math.MaxUint64),
+			accessListEntryJSON(4, testOwnerB, now),
+		}},
+	})
+
+	cases := []struct {
+		owner     string
+		datasetID uint64
+		requester string
+		want      bool
+	}{
+		{testOwnerA, 1, testOwnerB, true},
+		{testOwnerA, 2, testOwnerB, false}, // Expired a minute ago
+		{testOwnerA, 3, testOwnerB, true},  // Never expires
+		{testOwnerA, 4, testOwnerB, true},  // Lasts through its expires_at second
+		{testOwnerA, 1, testOwnerC, false}, // Granted to someone else
+		{testOwnerA, 5, testOwnerB, false}, // No grant on this dataset
+		{testOwnerC, 1, testOwnerB, false}, // The owner never granted anything: no AccessList
+	}
+	for _, tc := range cases {
+		ok, err := service.CheckAccess(tc.owner, tc.datasetID, tc.requester)
+		if err != nil || ok != tc.want {
+			t.Errorf("CheckAccess(%s, %d, %s) = %v, %v, want %v", tc.owner, tc.datasetID, tc.requester, ok, err, tc.want)
+		}
+	}
+
+	if _, err := service.CheckAccess("not-an-address", 1, testOwnerB); err == nil {
+		t.Error("a malformed owner was accepted")
+	}
+}
+
+func TestCheckAccessFailsWithoutTheLedgerClock(t *testing.T) {
+	node := newFakeNode(t)
+	service := newTestService(t, node, nil)
+	node.handleJSON(accessListPath(testOwnerA), map[string]interface{}{
+		"data": map[string]interface{}{"entries": []map[string]string{accessListEntryJSON(1, testOwnerB, 1)}},
+	})
+	node.handleJSON("/v1", map[string]string{"ledger_timestamp": "soon"})
+
+	// An unreadable clock is an error, never a grant
+	if ok, err := service.CheckAccess(testOwnerA, 1, testOwnerB); err == nil || ok {
+		t.Errorf("CheckAccess = %v, %v, want an error", ok, err)
+	}
+}
+
+func TestGetDatasetReadsTheDataStore(t *testing.T) {
+	node := newFakeNode(t)
+	service := newTestService(t, node, nil)
+	node.handleJSON(dataStorePath(testOwnerA), dataStoreResource(
+		testDataset{id: 0, dataHash: strings.Repeat("ab", 32), metadata: `{"name":"first"}`, createdAt: 1_700_000_000, active: true},
+		testDataset{id: 1, dataHash: strings.Repeat("cd", 32), metadata: `{"name":"deleted"}`, createdAt: 1_700_000_100, active: false},
+	))
+
+	dataset, err := service.GetDataset(testOwnerA, 1)
+	if err != nil {
+		t.Fatalf("GetDataset: %v", err)
+	}
+	// Metadata the node sends as hex is passed on as is, for decodeMetadataString to read
+	want := map[string]interface{}{
+		"data_hash":  "0x" + strings.Repeat("cd", 32),
+		"metadata":   fmt.Sprintf("0x%x", `{"name":"deleted"}`),
+		"created_at": uint64(1_700_000_100),
+		"is_active":  false,
+	}
+	if !reflect.DeepEqual(dataset, want) {
+		t.Errorf("GetDataset = %v, want %v", dataset, want)
+	}
+
+	if _, err := service.GetDataset(testOwnerA, 2); err == nil || !strings.Contains(err.Error(), "dataset 2 not found") {
+		t.Errorf("missing dataset = %v, want not found", err)
+	}
+	// An account that never submitted has no DataStore
+	if _, err := service.GetDataset(testOwnerB, 0); err == nil {
+		t.Error("GetDataset without a DataStore succeeded")
+	}
+}
+
+func TestGetDatasetReadsByteVectorsInEitherForm(t *testing.T) {
+	node := newFakeNode(t)
+	service := newTestService(t, node, nil)
+	// Older nodes return vector<u8> as arrays of numbers
+	node.handleJSON(dataStorePath(testOwnerA), map[string]interface{}{
+		"data": map[string]interface{}{"datasets": []map[string]interface{}{{
+			"id":         0,
+			"data_hash":  []int{0xde, 0xad},
+			"metadata":   []int{'h', 'i'},
+			"created_at": "5",
+		}}},
+	})
+
+	dataset, err := service.GetDataset(testOwnerA, 0)
+	if err != nil {
+		t.Fatalf("GetDataset: %v", err)
+	}
+	got := dataset.(map[string]interface{})
+	if got["data_hash"] != "0xdead" || got["metadata"] != "hi" || got["created_at"] != uint64(5) || got["is_active"] != true {
+		t.Errorf("GetDataset = %v, want 0xdead, hi, 5 and active by default", got)
+	}
+}
+
+func TestGetDatasetDoesNotRetryClientErrors(t *testing.T) {
+	node := newFakeNode(t)
+	service := newTestService(t, node, nil)
+	path := dataStorePath(testOwnerA)
+	node.handle(path, func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"message": "bad resource type"})
+	})
+
+	if _, err := service.GetDataset(testOwnerA, 0); err == nil {
+		t.Fatal("GetDataset succeeded on a 400")
+	}
+	if hits := node.count(path); hits != 1 {
+		t.Errorf("node asked %d times, want once", hits)
+	}
+}
+
+var (
+	indexedHash = fmt.Sprintf("0x%064x", 0xabc)
+	laggingHash = fmt.Sprintf("0x%064x", 0xdef)
+)
+
+// newDataHashIndexer serves datax_marketplace rows filtered by the data_hashes and user
+// variables of each query, as Hasura would apply the where clause. It records the user of
+// every query, "" when it was unscoped
+func newDataHashIndexer(t *testing.T, rows []map[string]interface{}) (*httptest.Server, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	users := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Variables struct {
+				DataHashes []string `json:"data_hashes"`
+				User       string   `json:"user"`
+			} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		mu.Lock()
+		users = append(users, request.Variables.User)
+		mu.Unlock()
+
+		matched := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			if request.Variables.User != "" && row["user"] != request.Variables.User {
+				continue
+			}
+			if request.Variables.DataHashes != nil && !containsString(request.Variables.DataHashes, row["data_hash"].(string)) {
+				continue
+			}
+			matched = append(matched, row)
+		}
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"datax_marketplace": matched}})
+	}))
+	t.Cleanup(server.Close)
+	return server, &users
+}
+
+// newDataHashService registers indexedHash as A's dataset 0 and B's dataset 0, each indexed
+// under a different spelling of the hash, and laggingHash as A's dataset 2, submitted on chain
+// but not yet indexed
+func newDataHashService(t *testing.T) (*fakeNode, *AptosServiceImpl, *[]string) {
+	t.Helper()
+	digest := strings.TrimPrefix(indexedHash, "0x")
+	indexer, users := newDataHashIndexer(t, []map[string]interface{}{
+		{"user": mustAddress(testOwnerA), "dataset_id": "0", "data_hash": strings.ToUpper(digest), "metadata": `{"name":"a0"}`},
+		{"user": mustAddress(testOwnerA), "dataset_id": "1", "data_hash": fmt.Sprintf("0x%064x", 1), "metadata": `{"name":"a1"}`},
+		{"user": mustAddress(testOwnerB), "dataset_id": 0, "data_hash": indexedHash, "metadata": `{"name":"b0"}`},
+	})
+
+	node := newFakeNode(t)
+	node.handleJSON(dataStorePath(testOwnerA), dataStoreResource(
+		testDataset{id: 0, dataHash: digest, metadata: `{"name":"a0"}`, createdAt: 100, active: true},
+		testDataset{id: 1, dataHash: fmt.Sprintf("%064x", 1), metadata: `{"name":"a1"}`, createdAt: 200, active: true},
+		testDataset{id: 2, dataHash: strings.TrimPrefix(laggingHash, "0x"), metadata: `{"name":"a2"}`, createdAt: 400, active: true},
+	))
+	node.handleJSON(dataStorePath(testOwnerB), dataStoreResource(
+		testDataset{id: 0, dataHash: digest, metadata: `{"name":"b0"}`, createdAt: 300, active: true},
+	))
+	node.handleTransactions(10, []map[string]interface{}{submitDataTransaction(9, testOwnerA)})
+
+	service := newTestService(t, node, func(cfg *ServiceConfig) {
+		cfg.AptosIndexerURL = indexer.URL
+		cfg.AptosIndexerAPIKey = "test-key"
+	})
+	service.graphqlClient = graphql.NewClient(indexer.URL, indexer.Client())
+	return node, service, users
+}
+
+func TestFindDatasetsByDataHashAnswersFromTheIndexer(t *testing.T) {
+	node, service, _ := newDataHashService(t)
+
+	// Asked in uppercase without 0x, matched against both spellings in the indexer
+	refs, err := service.FindDatasetsByDataHash(context.Background(), strings.ToUpper(strings.TrimPrefix(indexedHash, "0x")), "")
+	if err != nil {
+		t.Fatalf("FindDatasetsByDataHash: %v", err)
+	}
+	want := []models.DatasetRef{{Owner: mustAddress(testOwnerA), DatasetID: 0}, {Owner: mustAddress(testOwnerB), DatasetID: 0}}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("refs = %+v, want %+v", refs, want)
+	}
+	// An indexer hit is trusted without reading the chain
+	if hits := node.count(dataStorePath(testOwnerA)) + node.count("/v1/transactions"); hits != 0 {
+		t.Errorf("node asked %d times after an indexer hit, want none", hits)
+	}
+}
+
+func TestFindDatasetsByDataHashFallsBackToTheChain(t *testing.T) {
+	_, service, _ := newDataHashService(t)
+
+	// The indexer hasn't synced A's dataset 2 yet
+	refs, err := service.FindDatasetsByDataHash(context.Background(), laggingHash, "")
+	if err != nil {
+		t.Fatalf("FindDatasetsByDataHash: %v", err)
+	}
+	want := []models.DatasetRef{{Owner: mustAddress(testOwnerA), DatasetID: 2}}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("refs = %+v, want %+v", refs, want)
+	}
+
+	// A hash registered nowhere is a miss on both, not an error
+	refs, err = service.FindDatasetsByDataHash(context.Background(), fmt.Sprintf("0x%064x", 0x123), "")
+	if err != nil || len(refs) != 0 {
+		t.Errorf("FindDatasetsByDataHash of an unknown hash = %+v, %v, want none", refs, err)
+	}
+	if _, err := service.FindDatasetsByDataHash(context.Background(), "not-a-hash", ""); err == nil {
+		t.Error("FindDatasetsByDataHash of a non-hex hash succeeded")
+	}
+}
+
+func TestFindDatasetsByDataHashScopedToAnOwner(t *testing.T) {
+	cases := []struct {
+		name     string
+		dataHash string
+		owner    string
+		want     []models.DatasetRef
+	}{
+		{"indexed, global", indexedHash, "", []models.DatasetRef{{Owner: mustAddress(testOwnerA), DatasetID: 0}, {Owner: mustAddress(testOwnerB), DatasetID: 0}}},
+		{"indexed, scoped", indexedHash, mustAddress(testOwnerB), []models.DatasetRef{{Owner: mustAddress(testOwnerB), DatasetID: 0}}},
+		{"on chain, scoped to its owner", laggingHash, mustAddress(testOwnerA), []models.DatasetRef{{Owner: mustAddress(testOwnerA), DatasetID: 2}}},
+		{"on chain, scoped to another owner", laggingHash, mustAddress(testOwnerB), []models.DatasetRef{}},
+	}
+	for _, tc := range cases {
+		_, service, users := newDataHashService(t)
+		refs, err := service.FindDatasetsByDataHash(context.Background(), tc.dataHash, tc.owner)
+		if err != nil {
+			t.Fatalf("%s: FindDatasetsByDataHash: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(refs, tc.want) {
+			t.Errorf("%s: refs = %+v, want %+v", tc.name, refs, tc.want)
+		}
+		// The owner is pushed into every indexer query rather than filtered afterwards
+		for _, user := range *users {
+			if user != tc.owner {
+				t.Errorf("%s: indexer queried for user %q, want %q", tc.name, user, tc.owner)
+			}
+		}
+	}
+}
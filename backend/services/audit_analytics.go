@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+const (
+	// defaultAnalyticsWindow is how far back analytics look when the request gives no start
+	defaultAnalyticsWindow = 7 * 24 * time.Hour
+	// previewEndpointSuffix marks the audit entries of previews, counted apart from downloads
+	previewEndpointSuffix = "/data/preview"
+)
+
+// analyticsKey identifies a cached analytics answer by owner and the window as requested
+type analyticsKey struct {
+	owner    string
+	from, to int64
+}
+
+// analyticsSnapshot is an owner's computed analytics for one requested window
+type analyticsSnapshot struct {
+	analytics   models.DatasetAnalytics
+	refreshedAt time.Time
+}
+
+// Analytics returns read counters for each of owner's datasets between from and to (Unix
+// seconds, inclusive), computed in one pass over the audit log. to defaults to now and from
+// to 7 days before to. Every dataset on chain gets a row, zeros for those nobody read, and
+// the owner's own reads aren't counted. The answer is reused for ANALYTICS_CACHE_TTL seconds
+func (a *AuditLog) Analytics(aptosService AptosService, owner string, from int64, to int64) (models.DatasetAnalytics, error) {
+	key := analyticsKey{owner: owner, from: from, to: to}
+	ttl := time.Duration(config.Tunable().AnalyticsCacheTTL) * time.Second
+	a.analyticsMu.Lock()
+	cached, ok := a.analyticsCache[key]
+	a.analyticsMu.Unlock()
+	if ok && time.Since(cached.refreshedAt) < ttl {
+		fmt.Printf("DEBUG: Using cached analytics for %s (age %v)\n", owner, time.Since(cached.refreshedAt).Round(time.Second))
+		return cached.analytics, nil
+	}
+
+	now := time.Now()
+	if to == 0 {
+		to = now.Unix()
+	}
+	if from == 0 {
+		from = max(to-int64(defaultAnalyticsWindow/time.Second), 1)
+	}
+
+	datasets, err := aptosService.GetUserDatasetsMetadata(owner)
+	if err != nil {
+		return models.DatasetAnalytics{}, err
+	}
+	activity := make(map[uint64]*models.DatasetActivity)
+	for _, d := range datasets {
+		if datasetMap, ok := d.(map[string]interface{}); ok {
+			if id, ok := datasetMap["id"].(uint64); ok {
+				activity[id] = &models.DatasetActivity{DatasetID: id}
+			}
+		}
+	}
+	for id, name := range datasetNames(datasets) {
+		activity[id].Name = name
+	}
+
+	requesters := make(map[uint64]map[string]bool)
+	err = a.repo.Each(owner, models.AuditFilter{From: from, To: to}, func(entry models.AuditEntry) {
+		if entry.Requester == owner {
+			return
+		}
+		row := activity[entry.DatasetID]
+		if row == nil {
+			// Read before it was deleted from chain, or the dataset list is lagging
+			row = &models.DatasetActivity{DatasetID: entry.DatasetID}
+			activity[entry.DatasetID] = row
+		}
+		if strings.HasSuffix(entry.Endpoint, previewEndpointSuffix) {
+			row.Previews++
+		} else {
+			row.Downloads++
+		}
+		row.RowsReturned += entry.Rows
+		row.LastAccessAt = max(row.LastAccessAt, entry.Timestamp)
+		if requesters[entry.DatasetID] == nil {
+			requesters[entry.DatasetID] = make(map[string]bool)
+		}
+		requesters[entry.DatasetID][entry.Requester] = true
+	})
+	if err != nil {
+		return models.DatasetAnalytics{}, err
+	}
+
+	analytics := models.DatasetAnalytics{
+		From:        from,
+		To:          to,
+		Datasets:    make([]models.DatasetActivity, 0, len(activity)),
+		GeneratedAt: now.Unix(),
+	}
+	for id, row := range activity {
+		row.UniqueRequesters = len(requesters[id])
+		analytics.Datasets = append(analytics.Datasets, *row)
+	}
+	sort.Slice(analytics.Datasets, func(i, j int) bool { return analytics.Datasets[i].DatasetID < analytics.Datasets[j].DatasetID })
+
+	a.analyticsMu.Lock()
+	if a.analyticsCache == nil {
+		a.analyticsCache = make(map[analyticsKey]analyticsSnapshot)
+	}
+	// Each distinct window is cached apart, so drop the ones that have gone stale
+	for k, snapshot := range a.analyticsCache {
+		if time.Since(snapshot.refreshedAt) >= ttl {
+			delete(a.analyticsCache, k)
+		}
+	}
+	a.analyticsCache[key] = analyticsSnapshot{analytics: analytics, refreshedAt: now}
+	a.analyticsMu.Unlock()
+	return analytics, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/datax/backend/models"
+)
+
+// analyticsChain lists the owner's datasets on chain and counts how often it is asked
+type analyticsChain struct {
+	AptosService
+	datasets []interface{}
+	calls    atomic.Int32
+}
+
+func (c *analyticsChain) GetUserDatasetsMetadata(userAddress string) ([]interface{}, error) {
+	c.calls.Add(1)
+	return c.datasets, nil
+}
+
+func chainDataset(id uint64, metadata string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "metadata": metadata}
+}
+
+// readEntry is an audit entry of requester reading testOwnerA's dataset at timestamp
+func readEntry(datasetID uint64, requester string, endpoint string, rows int, timestamp int64) models.AuditEntry {
+	return models.AuditEntry{
+		Owner: testOwnerA, DatasetID: datasetID, Requester: requester,
+		Endpoint: endpoint, Rows: rows, Timestamp: timestamp,
+	}
+}
+
+// newAnalyticsLog returns an audit log holding entries, and a chain listing datasets 0 to 2
+// of testOwnerA, of which 1 has no name
+func newAnalyticsLog(t *testing.T, entries ...models.AuditEntry) (*AuditLog, *analyticsChain) {
+	t.Helper()
+	repo := NewStateAuditLogRepository(nil)
+	if err := repo.Append(entries); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	chain := &analyticsChain{datasets: []interface{}{
+		chainDataset(0, `{"name":"weather","description":"test"}`),
+		chainDataset(1, `{"description":"unnamed"}`),
+		chainDataset(2, `{"name":"traffic","description":"test"}`),
+	}}
+	return NewAuditLog(repo), chain
+}
+
+func TestAnalyticsCountsReadsWithinTheWindow(t *testing.T) {
+	const from, to = 1_000_000, 2_000_000
+	audit, chain := newAnalyticsLog(t,
+		readEntry(0, testOwnerB, "/api/v1/data/get-csv", 10, from-1), // Just before the window
+		readEntry(0, testOwnerB, "/api/v1/data/get-csv", 10, from),   // On both edges: inside
+		readEntry(0, testOwnerC, "/api/v1/data/preview", 5, from+500),
+		readEntry(0, testOwnerB, "/api/v1/data/get-encrypted-csv", 0, to),
+		readEntry(0, testOwnerC, "/api/v1/data/get-csv", 10, to+1),     // Just after the window
+		readEntry(0, testOwnerA, "/api/v1/data/get-csv", 10, from+700), // The owner's own read
+		readEntry(1, testOwnerC, "/api/v1/data/preview", 5, from+900),
+		readEntry(2, testOwnerB, "/api/v1/data/get-csv", 10, from-1),  // Only read outside the window
+		readEntry(7, testOwnerB, "/api/v1/data/get-csv", 3, from+800), // No longer listed on chain
+	)
+
+	analytics, err := audit.Analytics(chain, testOwnerA, from, to)
+	if err != nil {
+		t.Fatalf("Analytics: %v", err)
+	}
+	if analytics.From != from || analytics.To != to {
+		t.Errorf("window = %d to %d, want %d to %d", analytics.From, analytics.To, from, to)
+	}
+	want := []models.DatasetActivity{
+		{DatasetID: 0, Name: "weather", UniqueRequesters: 2, Downloads: 2, Previews: 1, RowsReturned: 15, LastAccessAt: to},
+		{DatasetID: 1, UniqueRequesters: 1, Previews: 1, RowsReturned: 5, LastAccessAt: from + 900},
+		{DatasetID: 2, Name: "traffic"}, // A zero row, so the table is complete
+		{DatasetID: 7, UniqueRequesters: 1, Downloads: 1, RowsReturned: 3, LastAccessAt: from + 800},
+	}
+	if !reflect.DeepEqual(analytics.Datasets, want) {
+		t.Errorf("datasets =\n%+v\nwant\n%+v", analytics.Datasets, want)
+	}
+}
+
+func TestAnalyticsDefaultsToTheLastWeek(t *testing.T) {
+	now := time.Now().Unix()
+	week := int64(defaultAnalyticsWindow / time.Second)
+	audit, chain := newAnalyticsLog(t,
+		readEntry(0, testOwnerB, "/api/v1/data/get-csv", 1, now-week-60),
+		readEntry(0, testOwnerB, "/api/v1/data/get-csv", 1, now-week+60),
+		readEntry(0, testOwnerC, "/api/v1/data/get-csv", 1, now-60),
+	)
+
+	analytics, err := audit.Analytics(chain, testOwnerA, 0, 0)
+	if err != nil {
+		t.Fatalf("Analytics: %v", err)
+	}
+	if analytics.To < now || analytics.To > now+5 || analytics.From != analytics.To-week {
+		t.Errorf("window = %d to %d, want the week up to %d", analytics.From, analytics.To, now)
+	}
+	if got := analytics.Datasets[0]; got.Downloads != 2 || got.UniqueRequesters != 2 || got.LastAccessAt != now-60 {
+		t.Errorf("dataset 0 = %+v, want the 2 reads of the last week", got)
+	}
+	if len(analytics.Datasets) != 3 {
+		t.Errorf("%d rows, want one per dataset on chain", len(analytics.Datasets))
+	}
+}
+
+func TestAnalyticsAreCachedPerWindow(t *testing.T) {
+	const from, to = 1_000_000, 2_000_000
+	repo := NewStateAuditLogRepository(nil)
+	repo.Append([]models.AuditEntry{readEntry(0, testOwnerB, "/api/v1/data/get-csv", 1, from)})
+	audit := NewAuditLog(repo)
+	chain := &analyticsChain{datasets: []interface{}{chainDataset(0, `{"name":"weather"}`)}}
+
+	first, err := audit.Analytics(chain, testOwnerA, from, to)
+	if err != nil {
+		t.Fatalf("Analytics: %v", err)
+	}
+	// A read logged since is only counted once the cached answer expires
+	repo.Append([]models.AuditEntry{readEntry(0, testOwnerC, "/api/v1/data/get-csv", 1, from+1)})
+	second, err := audit.Analytics(chain, testOwnerA, from, to)
+	if err != nil || !reflect.DeepEqual(second, first) {
+		t.Errorf("second Analytics = %+v, %v, want the cached %+v", second, err, first)
+	}
+	if calls := chain.calls.Load(); calls != 1 {
+		t.Errorf("datasets listed %d times, want once", calls)
+	}
+
+	// Another window is computed on its own
+	other, err := audit.Analytics(chain, testOwnerA, from, to+1)
+	if err != nil || other.Datasets[0].Downloads != 2 {
+		t.Errorf("Analytics of another window = %+v, %v, want both reads", other, err)
+	}
+}
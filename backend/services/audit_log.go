@@ -0,0 +1,314 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/internal/db"
+	"github.com/datax/backend/models"
+)
+
+// Audit log limits
+const (
+	auditQueueSize         = 10000 // Entries waiting to be written before new ones are dropped
+	auditBatchSize         = 100
+	auditFlushInterval     = time.Second
+	auditStateConflicts    = 3     // Reload-and-retry rounds when another instance wrote the same owner's log
+	maxAuditEntriesByOwner = 50000 // Entries kept per owner in the state store; the oldest go first
+)
+
+// AuditLogRepository stores the audit trail of dataset reads, one append-only log per
+// owner. Addresses are expected in normalized form
+type AuditLogRepository interface {
+	// Append adds entries to their owners' logs
+	Append(entries []models.AuditEntry) error
+	// List returns a page of owner's entries matching filter, newest first, and how many
+	// match in all
+	List(owner string, filter models.AuditFilter, offset int, limit int) ([]models.AuditEntry, int, error)
+	// Each calls fn with every one of owner's entries matching filter, oldest first
+	Each(owner string, filter models.AuditFilter, fn func(models.AuditEntry)) error
+}
+
+// sqlAuditLog keeps the audit log in the DATABASE_URL database
+type sqlAuditLog struct {
+	db *db.DB
+}
+
+// NewSQLAuditLogRepository returns a repository backed by the database
+func NewSQLAuditLogRepository(database *db.DB) AuditLogRepository {
+	return &sqlAuditLog{db: database}
+}
+
+func (r *sqlAuditLog) Append(entries []models.AuditEntry) error {
+	return r.db.AppendAuditEntries(entries)
+}
+
+func (r *sqlAuditLog) List(owner string, filter models.AuditFilter, offset int, limit int) ([]models.AuditEntry, int, error) {
+	return r.db.ListAuditEntries(owner, filter, offset, limit)
+}
+
+func (r *sqlAuditLog) Each(owner string, filter models.AuditFilter, fn func(models.AuditEntry)) error {
+	return r.db.EachAuditEntry(owner, filter, fn)
+}
+
+// stateAuditLog keeps each owner's audit log as one system/audit/{owner}.json document in
+// the state store, or in memory when the storage backend has none. A document holds the
+// newest maxAuditEntriesByOwner entries; set DATABASE_URL to keep them all
+type stateAuditLog struct {
+	store  StateStore // nil keeps entries in memory, lost on restart
+	mu     sync.Mutex
+	memory map[string][]models.AuditEntry
+}
+
+// NewStateAuditLogRepository returns a repository backed by store, which may be nil
+func NewStateAuditLogRepository(store StateStore) AuditLogRepository {
+	return &stateAuditLog{store: store, memory: make(map[string][]models.AuditEntry)}
+}
+
+func (r *stateAuditLog) Append(entries []models.AuditEntry) error {
+	byOwner := make(map[string][]models.AuditEntry)
+	for _, entry := range entries {
+		byOwner[entry.Owner] = append(byOwner[entry.Owner], entry)
+	}
+
+	var errs []error
+	for owner, added := range byOwner {
+		if err := r.append(owner, added); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", owner, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *stateAuditLog) List(owner string, filter models.AuditFilter, offset int, limit int) ([]models.AuditEntry, int, error) {
+	entries, err := r.load(owner)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matched := make([]models.AuditEntry, 0)
+	for _, entry := range entries {
+		if auditEntryMatches(entry, filter) {
+			matched = append(matched, entry)
+		}
+	}
+	// Entries are appended roughly in order; reversing first keeps the newest first among
+	// entries from the same second
+	slices.Reverse(matched)
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Timestamp > matched[j].Timestamp })
+
+	total := len(matched)
+	if offset < len(matched) {
+		matched = matched[offset:]
+	} else {
+		matched = matched[:0]
+	}
+	if limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, total, nil
+}
+
+func (r *stateAuditLog) Each(owner string, filter models.AuditFilter, fn func(models.AuditEntry)) error {
+	entries, err := r.load(owner)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if auditEntryMatches(entry, filter) {
+			fn(entry)
+		}
+	}
+	return nil
+}
+
+func (r *stateAuditLog) load(owner string) ([]models.AuditEntry, error) {
+	if r.store == nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return append([]models.AuditEntry(nil), r.memory[owner]...), nil
+	}
+
+	var entries []models.AuditEntry
+	_, err := r.store.LoadState(auditStateKey(owner), &entries)
+	if errors.Is(err, ErrStateNotFound) {
+		return nil, nil
+	}
+	return entries, err
+}
+
+// append adds entries to the end of owner's log, reloading and appending again when
+// another instance wrote the document in between
+func (r *stateAuditLog) append(owner string, added []models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.store == nil {
+		r.memory[owner] = trimAuditLog(appendAuditEntries(r.memory[owner], added))
+		return nil
+	}
+
+	for range auditStateConflicts {
+		var entries []models.AuditEntry
+		etag, err := r.store.LoadState(auditStateKey(owner), &entries)
+		if err != nil && !errors.Is(err, ErrStateNotFound) {
+			return err
+		}
+		_, err = r.store.SaveState(auditStateKey(owner), trimAuditLog(appendAuditEntries(entries, added)), etag)
+		if !errors.Is(err, ErrStateConflict) {
+			return err
+		}
+	}
+	return ErrStateConflict
+}
+
+// appendAuditEntries adds entries to a log, skipping those it already holds: a batch that
+// failed for some owners is written again for all of them
+func appendAuditEntries(entries []models.AuditEntry, added []models.AuditEntry) []models.AuditEntry {
+	seen := make(map[models.AuditEntry]bool, len(entries))
+	for _, entry := range entries {
+		seen[entry] = true
+	}
+	for _, entry := range added {
+		if !seen[entry] {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// trimAuditLog drops the oldest entries past maxAuditEntriesByOwner
+func trimAuditLog(entries []models.AuditEntry) []models.AuditEntry {
+	if len(entries) > maxAuditEntriesByOwner {
+		return entries[len(entries)-maxAuditEntriesByOwner:]
+	}
+	return entries
+}
+
+func auditEntryMatches(entry models.AuditEntry, filter models.AuditFilter) bool {
+	switch {
+	case filter.DatasetID != nil && entry.DatasetID != *filter.DatasetID:
+		return false
+	case filter.Requester != "" && entry.Requester != filter.Requester:
+		return false
+	case filter.From > 0 && entry.Timestamp < filter.From:
+		return false
+	case filter.To > 0 && entry.Timestamp > filter.To:
+		return false
+	}
+	return true
+}
+
+func auditStateKey(owner string) string {
+	return "system/audit/" + strings.ToLower(strings.TrimPrefix(owner, "0x")) + ".json"
+}
+
+// AuditLog records dataset reads off the request path: Record queues an entry and Run
+// writes the queue to the repository in batches. Close stops taking entries and waits for
+// the queue to be written, so entries survive a graceful shutdown
+type AuditLog struct {
+	repo  AuditLogRepository
+	queue chan models.AuditEntry
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	analyticsMu    sync.Mutex
+	analyticsCache map[analyticsKey]analyticsSnapshot
+}
+
+// NewAuditLog creates the audit log; call Run to start writing it
+func NewAuditLog(repo AuditLogRepository) *AuditLog {
+	return &AuditLog{
+		repo:  repo,
+		queue: make(chan models.AuditEntry, auditQueueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Record queues entry without blocking. When the queue is full the entry is dropped and
+// logged, since a slow database must not hold up downloads
+func (a *AuditLog) Record(entry models.AuditEntry) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		fmt.Printf("WARNING: Audit log is closed, dropping %s of dataset %d of %s by %s\n", entry.Endpoint, entry.DatasetID, entry.Owner, entry.Requester)
+		return
+	}
+	select {
+	case a.queue <- entry:
+	default:
+		fmt.Printf("WARNING: Audit log queue is full, dropping %s of dataset %d of %s by %s\n", entry.Endpoint, entry.DatasetID, entry.Owner, entry.Requester)
+	}
+}
+
+// Run writes queued entries every auditFlushInterval, or as soon as a batch fills, until
+// Close. A failed write is retried on the next flush
+func (a *AuditLog) Run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+
+	var pending []models.AuditEntry
+	for {
+		select {
+		case entry, ok := <-a.queue:
+			if !ok {
+				if len(pending) > 0 {
+					if err := a.repo.Append(pending); err != nil {
+						fmt.Printf("ERROR: Failed to write %d audit entries on shutdown: %v\n", len(pending), err)
+					}
+				}
+				return
+			}
+			pending = append(pending, entry)
+			if len(pending) >= auditBatchSize {
+				pending = a.flush(pending)
+			}
+		case <-ticker.C:
+			if len(pending) > 0 {
+				pending = a.flush(pending)
+			}
+		}
+	}
+}
+
+// Close stops accepting entries and returns once the queued ones are written
+func (a *AuditLog) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+// List returns a page of owner's audit entries matching filter, newest first, and how
+// many match in all
+func (a *AuditLog) List(owner string, filter models.AuditFilter, offset int, limit int) ([]models.AuditEntry, int, error) {
+	return a.repo.List(owner, filter, offset, limit)
+}
+
+// flush writes pending and returns what is left to retry: nothing on success, and on
+// failure the entries again, less the oldest past auditQueueSize
+func (a *AuditLog) flush(pending []models.AuditEntry) []models.AuditEntry {
+	err := a.repo.Append(pending)
+	if err == nil {
+		return pending[:0]
+	}
+	fmt.Printf("ERROR: Failed to write %d audit entries, retrying: %v\n", len(pending), err)
+	if len(pending) > auditQueueSize {
+		fmt.Printf("ERROR: Dropping %d audit entries that could not be written\n", len(pending)-auditQueueSize)
+		pending = append(pending[:0], pending[len(pending)-auditQueueSize:]...)
+	}
+	return pending
+}
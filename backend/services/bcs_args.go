@@ -0,0 +1,127 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+	"github.com/aptos-labs/aptos-go-sdk/bcs"
+)
+
+// U128 is a Move u128 argument. A *big.Int alone doesn't say how wide the Move integer is
+type U128 struct{ Value *big.Int }
+
+// U256 is a Move u256 argument
+type U256 struct{ Value *big.Int }
+
+// Option is a Move Option<T> argument; a nil Value is none. T is any type serializeArg takes
+type Option[T any] struct{ Value *T }
+
+// Some is an Option holding value
+func Some[T any](value T) Option[T] {
+	return Option[T]{Value: &value}
+}
+
+// None is an empty Option
+func None[T any]() Option[T] {
+	return Option[T]{}
+}
+
+// optionValue lets serializeArg read an Option of any T
+func (o Option[T]) optionValue() (interface{}, bool) {
+	if o.Value == nil {
+		return nil, false
+	}
+	return *o.Value, true
+}
+
+// serializeArg BCS-encodes an entry or view function argument:
+//
+//	bool                                     bool
+//	uint8, uint16, uint32, uint64            u8, u16, u32, u64
+//	U128, U256                               u128, u256
+//	string                                   0x1::string::String
+//	[]byte                                   vector<u8>
+//	[]uint64                                 vector<u64>
+//	aptos.AccountAddress (or pointer)        address
+//	[]aptos.AccountAddress                   vector<address>
+//	Option[T]                                0x1::option::Option<T>
+//
+// and anything implementing bcs.Marshaler
+func serializeArg(arg interface{}) ([]byte, error) {
+	ser := &bcs.Serializer{}
+	if err := writeArg(ser, arg); err != nil {
+		return nil, err
+	}
+	if err := ser.Error(); err != nil {
+		return nil, err
+	}
+	return ser.ToBytes(), nil
+}
+
+// writeArg appends one argument to ser, for serializeArg and the elements of an Option
+func writeArg(ser *bcs.Serializer, arg interface{}) error {
+	switch v := arg.(type) {
+	case bool:
+		ser.Bool(v)
+	case uint8:
+		ser.U8(v)
+	case uint16:
+		ser.U16(v)
+	case uint32:
+		ser.U32(v)
+	case uint64:
+		ser.U64(v)
+	case U128:
+		if err := checkUintWidth(v.Value, 128); err != nil {
+			return err
+		}
+		ser.U128(*v.Value)
+	case U256:
+		if err := checkUintWidth(v.Value, 256); err != nil {
+			return err
+		}
+		ser.U256(*v.Value)
+	case []byte:
+		ser.WriteBytes(v)
+	case string:
+		ser.WriteString(v)
+	case []uint64:
+		bcs.SerializeSequenceWithFunction(v, ser, (*bcs.Serializer).U64)
+	case *aptos.AccountAddress:
+		if v == nil {
+			return fmt.Errorf("nil address argument")
+		}
+		ser.Struct(v)
+	case aptos.AccountAddress:
+		ser.Struct(&v)
+	case []aptos.AccountAddress:
+		bcs.SerializeSequence(v, ser)
+	case interface{ optionValue() (interface{}, bool) }:
+		value, present := v.optionValue()
+		if !present {
+			ser.Uleb128(0)
+			return nil
+		}
+		ser.Uleb128(1)
+		if err := writeArg(ser, value); err != nil {
+			return fmt.Errorf("option value: %w", err)
+		}
+	case bcs.Marshaler:
+		ser.Struct(v)
+	default:
+		return fmt.Errorf("unsupported argument type %T", arg)
+	}
+	return nil
+}
+
+// checkUintWidth refuses values a Move integer of the given bit width can't hold
+func checkUintWidth(value *big.Int, bits int) error {
+	if value == nil {
+		return fmt.Errorf("nil u%d argument", bits)
+	}
+	if value.Sign() < 0 || value.BitLen() > bits {
+		return fmt.Errorf("%s does not fit in u%d", value, bits)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+)
+
+func TestSerializeArgEncodesMoveTypes(t *testing.T) {
+	one, _ := parseAddress("0x1")
+	two, _ := parseAddress("0x2")
+	addressOne, addressTwo := strings.Repeat("00", 31)+"01", strings.Repeat("00", 31)+"02"
+	u128Max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+	cases := []struct {
+		name string
+		arg  interface{}
+		want string // Hex
+	}{
+		{"bool true", true, "01"},
+		{"bool false", false, "00"},
+		{"u8", uint8(0xab), "ab"},
+		{"u16", uint16(0x0102), "0201"},
+		{"u32", uint32(0x01020304), "04030201"},
+		{"u64", uint64(0x0102030405060708), "0807060504030201"},
+		{"u128", U128{big.NewInt(1)}, "01" + strings.Repeat("00", 15)},
+		{"u128 max", U128{u128Max}, strings.Repeat("ff", 16)},
+		{"u256", U256{big.NewInt(0x0201)}, "0102" + strings.Repeat("00", 30)},
+		{"string", "hi", "026869"},
+		{"vector<u8>", []byte{1, 2, 3}, "03010203"},
+		{"empty vector<u8>", []byte{}, "00"},
+		{"vector<u64>", []uint64{1, 2}, "02" + "0100000000000000" + "0200000000000000"},
+		{"address", *one, addressOne},
+		{"address pointer", one, addressOne},
+		{"vector<address>", []aptos.AccountAddress{*one, *two}, "02" + addressOne + addressTwo},
+		{"some u64", Some(uint64(5)), "01" + "0500000000000000"},
+		{"none u64", None[uint64](), "00"},
+		{"some string", Some("hi"), "01" + "026869"},
+		{"some address", Some(*one), "01" + addressOne},
+		{"nested option", Some(Some(true)), "0101" + "01"},
+	}
+	for _, tc := range cases {
+		got, err := serializeArg(tc.arg)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		want, _ := hex.DecodeString(tc.want)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: %x, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSerializeArgRefusesWhatMoveCantHold(t *testing.T) {
+	cases := map[string]interface{}{
+		"u128 overflow":  U128{new(big.Int).Lsh(big.NewInt(1), 128)},
+		"u256 overflow":  U256{new(big.Int).Lsh(big.NewInt(1), 256)},
+		"negative u128":  U128{big.NewInt(-1)},
+		"nil u128":       U128{},
+		"nil address":    (*aptos.AccountAddress)(nil),
+		"signed int":     int(1),
+		"float":          1.5,
+		"option of int":  Some(int64(1)),
+		"vector<string>": []string{"a"},
+	}
+	for name, arg := range cases {
+		if got, err := serializeArg(arg); err == nil {
+			t.Errorf("%s: encoded as %x, want an error", name, got)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrChainIDMismatch is returned when the node serves a different chain than CHAIN_ID says,
+// which is what a node URL from one profile and a chain ID from another looks like
+var ErrChainIDMismatch = errors.New("node serves a different chain than CHAIN_ID")
+
+// CheckChainID compares the chain ID the node reports in its ledger info with the configured
+// one. Transactions signed for the wrong chain are rejected by the node, so a mismatch is
+// better caught at startup
+func (s *AptosServiceImpl) CheckChainID(ctx context.Context) error {
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
+
+	body, status, err := s.getWithRetryContext(ctx, nodeURL+"/v1", "ledger info")
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		return fmt.Errorf("ledger info not found at %s", nodeURL)
+	}
+
+	var ledgerInfo struct {
+		ChainID uint8 `json:"chain_id"`
+	}
+	if err := json.Unmarshal(body, &ledgerInfo); err != nil {
+		return fmt.Errorf("failed to decode ledger info: %w", err)
+	}
+	if ledgerInfo.ChainID != s.chainID {
+		return fmt.Errorf("%w: %s reports chain ID %d, CHAIN_ID is %d", ErrChainIDMismatch, nodeURL, ledgerInfo.ChainID, s.chainID)
+	}
+	return nil
+}
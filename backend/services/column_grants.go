@@ -0,0 +1,33 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/datax/backend/models"
+)
+
+// ErrColumnGrantNotFound is returned when a grant has no column restriction stored, meaning it
+// covers every column
+var ErrColumnGrantNotFound = errors.New("no column restriction for this grant")
+
+// ColumnGrantStore is implemented by backends that can keep the columns a grant is limited to,
+// one {owner}/grants/{dataset_id}_{requester}.columns.json object per grant, next to its
+// wrapped key. The on-chain grant decides whether the requester has access at all
+type ColumnGrantStore interface {
+	StoreColumnGrant(owner string, grant models.ColumnGrant) error
+	RetrieveColumnGrant(owner string, datasetID uint64, requester string) (*models.ColumnGrant, error) // Errors wrap ErrColumnGrantNotFound when none is stored
+	DeleteColumnGrant(owner string, datasetID uint64, requester string) error                          // Deleting a restriction that isn't stored is not an error
+}
+
+var (
+	_ ColumnGrantStore = (*SupabaseServiceImpl)(nil)
+	_ ColumnGrantStore = (*ShelbyServiceImpl)(nil)
+	_ ColumnGrantStore = (*LocalStorageService)(nil)
+	_ ColumnGrantStore = (*IPFSStorageServiceImpl)(nil)
+)
+
+// columnGrantObject is a grant's column restriction object, relative to the owner's directory
+func columnGrantObject(datasetID uint64, requester string) string {
+	return fmt.Sprintf("grants/%d_%s.columns.json", datasetID, normalizeGrantee(requester))
+}
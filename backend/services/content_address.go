@@ -0,0 +1,201 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/datax/backend/models"
+)
+
+// CSV blobs are named after the SHA-256 of their bytes, {account}/{sha256}.csv, so storing
+// the same data twice reuses one object. Blobs stored before that are named
+// {account}/{timestamp}_{hash}.csv and are still read, listed and resolved
+
+// contentBlobName is the content-addressed name of a CSV blob with the given SHA-256
+func contentBlobName(accountAddress string, sum []byte) string {
+	return fmt.Sprintf("%s/%s.csv", accountAddress, hex.EncodeToString(sum))
+}
+
+// BlobNameHash returns the lowercase hex hash a CSV blob is named after, from either naming
+// scheme; "" when the name carries no hash
+func BlobNameHash(blobName string) string {
+	name := strings.TrimSuffix(path.Base(blobName), ".enc")
+	if !strings.HasSuffix(name, ".csv") {
+		return ""
+	}
+	name = strings.TrimSuffix(name, ".csv")
+	if i := strings.Index(name, "_"); i >= 0 {
+		name = name[i+1:]
+	}
+	return dataHashKey(name)
+}
+
+// ContentHash returns the "0x"-prefixed SHA-256 of the bytes stored in a plain content-addressed
+// blob, read from its name; "" for encrypted or timestamp-named blobs, whose names don't
+// describe the stored bytes
+func ContentHash(blobName string) string {
+	if strings.HasSuffix(blobName, encryptedBlobSuffix) || !isContentAddressedBlob(blobName) {
+		return ""
+	}
+	return NormalizeDataHash(BlobNameHash(blobName))
+}
+
+// isContentAddressedBlob reports whether a blob uses the {sha256}.csv naming scheme
+func isContentAddressedBlob(blobName string) bool {
+	name := strings.TrimSuffix(strings.TrimSuffix(path.Base(blobName), ".enc"), ".csv")
+	return len(name) == 64 && dataHashKey(name) == name
+}
+
+// mergeManifestEntry combines a data hash's recorded entry with a newly stored blob for the
+// same hash. A verified entry, whose blob was hashed to the data hash, is never displaced by
+// an unverified one: the unverified blob is dropped, not kept as a legacy name. Otherwise a
+// content-addressed blob becomes the entry's BlobName over a timestamp-named one (else the
+// newer upload wins), and the other name is kept in LegacyBlobNames so lookups by either
+// name keep resolving during the transition
+func mergeManifestEntry(existing models.BlobManifestEntry, entry models.BlobManifestEntry) models.BlobManifestEntry {
+	if existing.BlobName == "" || existing.Pending {
+		return entry
+	}
+	if existing.Verified != entry.Verified {
+		if existing.Verified {
+			return existing
+		}
+		return entry
+	}
+
+	primary, other := entry, existing
+	if isContentAddressedBlob(existing.BlobName) && !isContentAddressedBlob(entry.BlobName) {
+		primary, other = existing, entry
+	}
+
+	names := append([]string{other.BlobName}, other.LegacyBlobNames...)
+	legacy := primary.LegacyBlobNames
+	for _, name := range names {
+		if name == primary.BlobName || containsString(legacy, name) {
+			continue
+		}
+		legacy = append(legacy, name)
+	}
+	primary.LegacyBlobNames = legacy
+	if primary.Metadata == nil && other.BlobName == primary.BlobName {
+		primary.Metadata = other.Metadata
+	}
+	return primary
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// blobExists reports whether an object is stored under key
+func (s *SupabaseServiceImpl) blobExists(ctx context.Context, key string) (bool, error) {
+	err := withStorageRetry(ctx, "HeadObject "+key, func(ctx context.Context) error {
+		_, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+		}, withoutSDKRetries)
+		return err
+	})
+	if err == nil {
+		return true, nil
+	}
+	if isMissingObject(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check %s in Supabase S3: %w", key, err)
+}
+
+// isMissingObject reports whether an S3 error means the object doesn't exist
+func isMissingObject(err error) bool {
+	var respErr *awshttp.ResponseError
+	var apiErr smithy.APIError
+	return (errors.As(err, &respErr) && respErr.HTTPStatusCode() == 404) ||
+		(errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotFound" || apiErr.ErrorCode() == "NoSuchKey"))
+}
+
+// storeContentAddressed uploads a CSV stream as {account}/{sha256}.csv, or with suffix after
+// that, and returns the blob name and size. When the content is already stored nothing is
+// uploaded and deduplicated is true. Streams over the multipart threshold can't be hashed
+// before they are uploaded, so they go to a staging key first and are copied into place
+func (s *SupabaseServiceImpl) storeContentAddressed(ctx context.Context, accountAddress string, r io.Reader, suffix string, contentType string) (blobName string, size int64, deduplicated bool, err error) {
+	threshold := multipartThreshold()
+	head, err := io.ReadAll(io.LimitReader(r, threshold+1))
+	if err != nil {
+		return "", 0, false, fmt.Errorf("failed to read CSV stream: %w", err)
+	}
+
+	if int64(len(head)) <= threshold {
+		sum := sha256.Sum256(head)
+		blobName = contentBlobName(accountAddress, sum[:]) + suffix
+		exists, err := s.blobExists(ctx, blobName)
+		if err != nil {
+			return "", 0, false, err
+		}
+		if exists {
+			return blobName, int64(len(head)), true, nil
+		}
+		_, err = s.putObjectBytes(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(s.bucketName),
+			Key:         aws.String(blobName),
+			ContentType: aws.String(contentType),
+		}, head)
+		if err != nil {
+			return "", 0, false, fmt.Errorf("failed to upload to Supabase S3: %w", err)
+		}
+		return blobName, int64(len(head)), false, nil
+	}
+
+	// Staged objects end in .part, so listings and manifest rebuilds never pick them up
+	staging := fmt.Sprintf("%s/.staging/%d.part", accountAddress, time.Now().UnixNano())
+	hasher := sha256.New()
+	size, parts, err := s.putObjectStream(ctx, staging, contentType, io.TeeReader(io.MultiReader(bytes.NewReader(head), r), hasher))
+	if err != nil {
+		return "", 0, false, err
+	}
+	defer func() {
+		_, delErr := s.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(staging),
+		})
+		if delErr != nil {
+			fmt.Printf("WARNING: Failed to delete staged upload %s: %v\n", staging, delErr)
+		}
+	}()
+
+	blobName = contentBlobName(accountAddress, hasher.Sum(nil)) + suffix
+	exists, err := s.blobExists(ctx, blobName)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if exists {
+		return blobName, size, true, nil
+	}
+
+	_, err = s.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucketName),
+		Key:        aws.String(blobName),
+		CopySource: aws.String(s.bucketName + "/" + staging),
+	})
+	if err != nil {
+		return "", 0, false, fmt.Errorf("failed to move staged upload into place: %w", err)
+	}
+	fmt.Printf("DEBUG: Copied staged upload %s (%d parts) to %s\n", staging, parts, blobName)
+	return blobName, size, false, nil
+}
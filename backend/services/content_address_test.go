@@ -0,0 +1,51 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/datax/backend/models"
+)
+
+func TestMergeManifestEntryKeepsVerifiedBlobs(t *testing.T) {
+	contentAddressed := testOwnerA + "/" + strings.Repeat("a", 64) + ".csv"
+	timestamped := testOwnerA + "/1700000000_" + strings.Repeat("a", 64) + ".csv"
+	verified := models.BlobManifestEntry{BlobName: contentAddressed, Verified: true}
+	unverified := models.BlobManifestEntry{BlobName: testOwnerA + "/other.csv.enc", Encrypted: true}
+
+	// An unverified upload can neither replace a verified blob nor ride along as a legacy name
+	merged := mergeManifestEntry(verified, unverified)
+	if merged.BlobName != contentAddressed || len(merged.LegacyBlobNames) != 0 {
+		t.Errorf("unverified over verified = %+v, want the verified entry unchanged", merged)
+	}
+
+	// A verified upload takes over from an unverified one, dropping it
+	merged = mergeManifestEntry(unverified, verified)
+	if merged.BlobName != contentAddressed || len(merged.LegacyBlobNames) != 0 {
+		t.Errorf("verified over unverified = %+v, want the verified entry alone", merged)
+	}
+
+	// Between verified blobs the content-addressed one stays primary, as before
+	merged = mergeManifestEntry(verified, models.BlobManifestEntry{BlobName: timestamped, Verified: true})
+	if merged.BlobName != contentAddressed || len(merged.LegacyBlobNames) != 1 || merged.LegacyBlobNames[0] != timestamped {
+		t.Errorf("verified timestamped over verified = %+v, want %s primary with %s legacy", merged, contentAddressed, timestamped)
+	}
+}
+
+func TestLocalManifestKeepsVerifiedBlobs(t *testing.T) {
+	storage := NewLocalStorageService(t.TempDir())
+	dataHash := "0x" + strings.Repeat("a", 64)
+	verified := models.BlobManifestEntry{BlobName: testOwnerA + "/" + strings.Repeat("a", 64) + ".csv", Verified: true}
+
+	if err := storage.UpdateManifest(testOwnerA, dataHash, verified); err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+	if err := storage.UpdateManifest(testOwnerA, dataHash, models.BlobManifestEntry{BlobName: testOwnerA + "/forged.csv.enc"}); err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+
+	manifest, _ := storage.RetrieveManifest(testOwnerA)
+	if entry := manifest[dataHash]; entry.BlobName != verified.BlobName || len(entry.LegacyBlobNames) != 0 {
+		t.Errorf("manifest entry = %+v, want the verified blob alone", entry)
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/datax/backend/config"
+)
+
+// previewInitialRange is the first byte range fetched for a preview; it doubles until
+// enough rows are parsed or PREVIEW_MAX_BYTES is reached
+const previewInitialRange = 64 * 1024
+
+// readCSVPrefix parses the header and up to limit+1 data rows from the start of a CSV
+// When complete is false the data was cut at an arbitrary byte, so the last record
+// (possibly partial) is discarded
+func readCSVPrefix(data []byte, limit int, complete bool) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	var records [][]string
+	truncated := false // Parsing stopped at a record cut by the range
+	for len(records) < limit+2 {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !complete && errors.As(err, &parseErr) {
+				truncated = true // A quoted field cut by the range
+				break
+			}
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	if !complete && !truncated && len(records) < limit+2 && len(records) > 0 {
+		records = records[:len(records)-1]
+	}
+	return records, nil
+}
+
+// PreviewCSV returns the header and first rows of a blob using ranged GetObject
+// requests, so only the start of a large file is transferred
+func (s *SupabaseServiceImpl) PreviewCSV(accountAddress string, blobName string, limit int) ([][]string, error) {
+	if strings.HasSuffix(blobName, encryptedBlobSuffix) {
+		return previewSealedCSV(s, accountAddress, blobName, limit)
+	}
+	ctx := context.Background()
+
+	key := blobName
+	if !strings.Contains(blobName, "/") {
+		key = fmt.Sprintf("%s/%s", accountAddress, blobName)
+	}
+
+	maxBytes := int64(config.AppConfig.PreviewMaxBytes)
+	rangeSize := minInt64(previewInitialRange, maxBytes)
+	for {
+		data, _, err := s.getObjectBytes(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+			Range:  aws.String(fmt.Sprintf("bytes=0-%d", rangeSize-1)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to download from Supabase S3: %w", err)
+		}
+
+		// Fewer bytes than requested means the range reached the end of the object
+		complete := int64(len(data)) < rangeSize
+		records, err := readCSVPrefix(data, limit, complete)
+		if err != nil {
+			return nil, err
+		}
+		if complete || len(records) >= limit+2 {
+			fmt.Printf("DEBUG: Previewed %s with %d bytes (%d records)\n", key, len(data), len(records))
+			return records, nil
+		}
+
+		if rangeSize >= maxBytes {
+			if len(records) == 0 {
+				return nil, fmt.Errorf("no complete CSV row in the first %d bytes", maxBytes)
+			}
+			return records, nil
+		}
+		rangeSize = minInt64(rangeSize*2, maxBytes)
+	}
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+)
+
+// UncategorizedCategory is reported for datasets with no category, including
+// metadata written before the DatasetMetadata schema existed
+const UncategorizedCategory = "uncategorized"
+
+// ParseDatasetMetadata parses a dataset's metadata string against the documented
+// DatasetMetadata schema. The string may still be in its on-chain hex form.
+// The second return value holds everything outside the schema: a map of the extra
+// keys for JSON metadata, or the decoded text for free-text metadata (nil if nothing)
+func ParseDatasetMetadata(raw string) (models.DatasetMetadata, interface{}) {
+	meta := models.DatasetMetadata{Category: UncategorizedCategory}
+
+	text := decodeMetadataString(raw)
+	if strings.TrimSpace(text) == "" {
+		return meta, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		// Pre-schema free-text metadata
+		return meta, text
+	}
+
+	extra := make(map[string]interface{})
+	for key, value := range fields {
+		ok := false
+		switch key {
+		case "name":
+			ok = json.Unmarshal(value, &meta.Name) == nil
+		case "description":
+			ok = json.Unmarshal(value, &meta.Description) == nil
+		case "category":
+			var category string
+			if ok = json.Unmarshal(value, &category) == nil; ok && strings.TrimSpace(category) != "" {
+				meta.Category = strings.TrimSpace(category)
+			}
+		case "tags":
+			meta.Tags, ok = parseMetadataTags(value)
+		case "price_apt":
+			meta.PriceAPT, ok = parseMetadataPrice(value)
+		case "license":
+			ok = json.Unmarshal(value, &meta.License) == nil
+		case "encryption_algorithm":
+			ok = json.Unmarshal(value, &meta.EncryptionAlgorithm) == nil
+		case "pii_flags":
+			meta.PIIFlags, ok = parseMetadataTags(value)
+		case "sample_enabled":
+			ok = json.Unmarshal(value, &meta.SampleEnabled) == nil
+		case "sample_rows":
+			ok = json.Unmarshal(value, &meta.SampleRows) == nil && meta.SampleRows >= 0
+			if !ok {
+				meta.SampleRows = 0
+			}
+		case "aggregates_enabled":
+			ok = json.Unmarshal(value, &meta.AggregatesEnabled) == nil
+		}
+
+		// Unknown keys and schema keys with the wrong type are passed through untouched
+		if !ok {
+			var v interface{}
+			if err := json.Unmarshal(value, &v); err == nil {
+				extra[key] = v
+			}
+		}
+	}
+
+	if len(extra) == 0 {
+		return meta, nil
+	}
+	return meta, extra
+}
+
+// parseMetadataTags accepts tags, or PII flags, as a JSON array of strings or a single comma-separated string
+func parseMetadataTags(value json.RawMessage) ([]string, bool) {
+	var list []string
+	if err := json.Unmarshal(value, &list); err != nil {
+		var joined string
+		if err := json.Unmarshal(value, &joined); err != nil {
+			return nil, false
+		}
+		list = strings.Split(joined, ",")
+	}
+
+	tags := make([]string, 0, len(list))
+	for _, tag := range list {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, true
+}
+
+// parseMetadataPrice accepts price_apt as a JSON number or a numeric string
+func parseMetadataPrice(value json.RawMessage) (*float64, bool) {
+	var price float64
+	if err := json.Unmarshal(value, &price); err == nil {
+		return &price, true
+	}
+	var priceStr string
+	if err := json.Unmarshal(value, &priceStr); err != nil {
+		return nil, false
+	}
+	price, err := strconv.ParseFloat(strings.TrimSpace(priceStr), 64)
+	if err != nil {
+		return nil, false
+	}
+	return &price, true
+}
+
+// liftDatasetMetadata copies the schema fields of a dataset's metadata to top-level keys
+// of the dataset map, leaving raw_metadata for anything outside the schema
+func liftDatasetMetadata(dataset map[string]interface{}) {
+	rawMetadata, _ := dataset["metadata"].(string)
+	meta, extra := ParseDatasetMetadata(rawMetadata)
+
+	if meta.Name != "" {
+		dataset["name"] = meta.Name
+	}
+	if meta.Description != "" {
+		dataset["description"] = meta.Description
+	}
+	dataset["category"] = meta.Category
+	if len(meta.Tags) > 0 {
+		dataset["tags"] = meta.Tags
+	}
+	if meta.PriceAPT != nil {
+		dataset["price_apt"] = *meta.PriceAPT
+	}
+	if meta.License != "" {
+		dataset["license"] = meta.License
+	}
+	if meta.EncryptionAlgorithm != "" {
+		dataset["encryption_algorithm"] = meta.EncryptionAlgorithm
+	}
+	if len(meta.PIIFlags) > 0 {
+		dataset["pii_flags"] = meta.PIIFlags
+	}
+	if meta.SampleEnabled {
+		dataset["sample_enabled"] = true
+	}
+	if meta.SampleRows > 0 {
+		dataset["sample_rows"] = meta.SampleRows
+	}
+	if meta.AggregatesEnabled {
+		dataset["aggregates_enabled"] = true
+	}
+	if extra != nil {
+		dataset["raw_metadata"] = extra
+	}
+}
+
+// DatasetInfoFromView converts a GetDataset result to DatasetInfo, lifting the documented
+// metadata fields to the top level
+func DatasetInfoFromView(owner string, datasetID uint64, datasetRaw interface{}) (models.DatasetInfo, error) {
+	datasetMap, ok := datasetRaw.(map[string]interface{})
+	if !ok {
+		return models.DatasetInfo{}, fmt.Errorf("unexpected dataset format")
+	}
+
+	// The service now returns data_hash as hex string and metadata as string
+	dataHashHex, _ := datasetMap["data_hash"].(string)
+	metadataStr, _ := datasetMap["metadata"].(string)
+
+	var createdAt uint64
+	switch v := datasetMap["created_at"].(type) {
+	case float64:
+		createdAt = uint64(v)
+	case uint64:
+		createdAt = v
+	case string:
+		parsed, _ := strconv.ParseUint(v, 10, 64)
+		createdAt = parsed
+	}
+
+	isActive, _ := datasetMap["is_active"].(bool)
+
+	// Lift the documented metadata fields to the top level
+	meta, extra := ParseDatasetMetadata(metadataStr)
+
+	dataset := models.DatasetInfo{
+		ID:          datasetID,
+		Owner:       owner,
+		DataHash:    dataHashHex,
+		Metadata:    metadataStr,
+		CreatedAt:   createdAt,
+		IsActive:    isActive,
+		Name:        meta.Name,
+		Description: meta.Description,
+		Category:    meta.Category,
+		Tags:        meta.Tags,
+		PriceAPT:    meta.PriceAPT,
+		License:     meta.License,
+		RawMetadata: extra,
+
+		EncryptionAlgorithm: meta.EncryptionAlgorithm,
+		PIIFlags:            meta.PIIFlags,
+		SampleEnabled:       meta.SampleEnabled,
+		SampleRows:          meta.SampleRows,
+		AggregatesEnabled:   meta.AggregatesEnabled,
+	}
+
+	return dataset, nil
+}
+
+// MarkReactivatable sets can_reactivate on a deleted dataset, so the UI can offer to undo
+// the deletion. Deleting only clears is_active, so every deleted dataset still listed qualifies
+func MarkReactivatable(dataset map[string]interface{}) {
+	if isActive, ok := dataset["is_active"].(bool); ok && !isActive {
+		dataset["can_reactivate"] = true
+	}
+}
+
+// datasetMatchesCategory reports whether a lifted dataset is in the category and carries
+// every one of the tags (both case-insensitive)
+func datasetMatchesCategory(dataset map[string]interface{}, category string, tags []string) bool {
+	if category != "" {
+		datasetCategory, _ := dataset["category"].(string)
+		if datasetCategory == "" {
+			datasetCategory = UncategorizedCategory
+		}
+		if !strings.EqualFold(datasetCategory, category) {
+			return false
+		}
+	}
+
+	datasetTags, _ := dataset["tags"].([]string)
+	for _, want := range tags {
+		found := false
+		for _, have := range datasetTags {
+			if strings.EqualFold(have, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
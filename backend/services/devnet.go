@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+	"github.com/aptos-labs/aptos-go-sdk/crypto"
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+const (
+	// localChainID is the chain ID of the node `aptos node run-local-testnet` starts. The
+	// bootstrap does nothing on any other chain, so it can't touch a public network
+	localChainID = 4
+
+	// devnetPublishMaxGas covers publishing the whole package in one transaction
+	devnetPublishMaxGas = 1_000_000
+)
+
+var devnetStatus atomic.Pointer[models.DevnetStatus]
+
+// DevnetBootstrapStatus returns what BootstrapDevnet did
+func DevnetBootstrapStatus() models.DevnetStatus {
+	if status := devnetStatus.Load(); status != nil {
+		return *status
+	}
+	return models.DevnetStatus{Status: models.DevnetDisabled}
+}
+
+// BootstrapDevnet prepares a local node for the backend when DEVNET_BOOTSTRAP is on: it funds
+// a deployer account from the node's faucet, publishes the Move package at DEVNET_PACKAGE_PATH
+// from it when one is set, and writes the module addresses and sponsor key into
+// config.AppConfig. It must run before the Aptos service is created. Unless the configured and
+// the node's chain ID are both the local testnet's, it changes nothing
+func BootstrapDevnet(ctx context.Context) error {
+	cfg := config.AppConfig
+	status := &models.DevnetStatus{Status: models.DevnetDisabled}
+	defer func() { devnetStatus.Store(status) }()
+	if !cfg.DevnetBootstrap {
+		return nil
+	}
+
+	nodeURL := strings.TrimSuffix(cfg.AptosNodeURL, "/")
+	status.NodeURL, status.FaucetURL = nodeURL, cfg.DevnetFaucetURL
+	skip := func(reason string) error {
+		status.Status, status.Reason = models.DevnetSkipped, reason
+		fmt.Printf("WARNING: DEVNET_BOOTSTRAP skipped: %s\n", reason)
+		// Validate let the module addresses be empty for the bootstrap to fill in
+		if cfg.DataXModuleAddr == "" || cfg.NetworkModuleAddr == "" || cfg.EscrowModuleAddr == "" {
+			return fmt.Errorf("%s, and DATAX_MODULE_ADDR, NETWORK_MODULE_ADDR or ESCROW_MODULE_ADDR is not set", reason)
+		}
+		return nil
+	}
+	switch {
+	case cfg.MockChain:
+		return skip("MOCK_CHAIN is enabled")
+	case cfg.IsProduction():
+		return skip("ENVIRONMENT is production")
+	case cfg.ChainID != localChainID:
+		return skip(fmt.Sprintf("CHAIN_ID is %d, not the local testnet's %d", cfg.ChainID, localChainID))
+	}
+
+	client, err := aptos.NewClient(aptos.NetworkConfig{
+		NodeUrl:   nodeURL + "/v1",
+		FaucetUrl: cfg.DevnetFaucetURL,
+		ChainId:   cfg.ChainID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Aptos client: %w", err)
+	}
+	info, err := client.Info()
+	if err != nil {
+		return fmt.Errorf("failed to reach the local node at %s: %w", nodeURL, err)
+	}
+	status.ChainID = info.ChainId
+	if info.ChainId != localChainID {
+		return skip(fmt.Sprintf("%s reports chain ID %d, not the local testnet's %d", nodeURL, info.ChainId, localChainID))
+	}
+
+	deployer, deployerKey, err := devnetDeployer(cfg.DevnetDeployerKey)
+	if err != nil {
+		return err
+	}
+	status.DeployerAddress = deployer.Address.String()
+
+	if err := client.Fund(deployer.Address, uint64(cfg.DevnetFundOctas)); err != nil {
+		return fmt.Errorf("failed to fund %s from the faucet at %s: %w", status.DeployerAddress, cfg.DevnetFaucetURL, err)
+	}
+	status.FundedOctas = uint64(cfg.DevnetFundOctas)
+	fmt.Printf("DEBUG: Funded devnet deployer %s with %d octas\n", status.DeployerAddress, cfg.DevnetFundOctas)
+
+	overrides := config.DevnetOverrides{SponsorPrivateKey: deployerKey}
+	if cfg.DevnetPackagePath != "" {
+		hash, err := publishDevnetPackage(ctx, client, deployer, cfg.DevnetPackagePath, cfg.DevnetAptosCLI)
+		if err != nil {
+			return err
+		}
+		status.Published, status.PublishTransactionHash = true, hash
+		overrides.ModuleAddr = status.DeployerAddress
+		fmt.Printf("DEBUG: Published %s to %s in %s\n", cfg.DevnetPackagePath, status.DeployerAddress, hash)
+	}
+	if cfg.SponsorPrivateKey == "" {
+		status.SponsorAddress = status.DeployerAddress
+	}
+	config.ApplyDevnetBootstrap(overrides)
+
+	status.Status = models.DevnetReady
+	status.DataXModuleAddr = config.AppConfig.DataXModuleAddr
+	status.NetworkModuleAddr = config.AppConfig.NetworkModuleAddr
+	status.EscrowModuleAddr = config.AppConfig.EscrowModuleAddr
+	status.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	return nil
+}
+
+// devnetDeployer returns the deployer account and its key in hex, generating a key when none
+// is configured
+func devnetDeployer(privateKeyHex string) (*aptos.Account, string, error) {
+	if privateKeyHex != "" {
+		account, err := getAccountFromPrivateKey(privateKeyHex)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid DEVNET_DEPLOYER_PRIVATE_KEY: %w", err)
+		}
+		return account, privateKeyHex, nil
+	}
+	key, err := crypto.GenerateEd25519PrivateKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate a deployer key: %w", err)
+	}
+	account, err := aptos.NewAccountFromSigner(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create the deployer account: %w", err)
+	}
+	return account, key.ToHex(), nil
+}
+
+// publishDevnetPackage compiles the Move package at packagePath with every named address set
+// to the deployer, publishes it from the deployer and returns the transaction hash. The SDK
+// can't compile Move, so the Aptos CLI builds the publish payload
+func publishDevnetPackage(ctx context.Context, client *aptos.Client, deployer *aptos.Account, packagePath string, cli string) (string, error) {
+	staged, err := os.MkdirTemp("", "datax-devnet-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(staged)
+
+	names, err := stageMovePackage(packagePath, staged)
+	if err != nil {
+		return "", err
+	}
+	assignments := make([]string, len(names))
+	for i, name := range names {
+		assignments[i] = name + "=" + deployer.Address.String()
+	}
+
+	payloadFile := filepath.Join(staged, "publish.json")
+	cmd := exec.CommandContext(ctx, cli, "move", "build-publish-payload",
+		"--package-dir", staged,
+		"--named-addresses", strings.Join(assignments, ","),
+		"--json-output-file", payloadFile,
+		"--assume-yes")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to compile %s with %s: %w\n%s", packagePath, cli, err, strings.TrimSpace(string(output)))
+	}
+
+	metadata, code, err := readPublishPayload(payloadFile)
+	if err != nil {
+		return "", err
+	}
+	payload, err := aptos.PublishPackagePayloadFromJsonFile(metadata, code)
+	if err != nil {
+		return "", fmt.Errorf("failed to build the publish payload: %w", err)
+	}
+	response, err := client.BuildSignAndSubmitTransaction(deployer, *payload, aptos.MaxGasAmount(devnetPublishMaxGas))
+	if err != nil {
+		return "", fmt.Errorf("failed to submit the package: %w", err)
+	}
+	txn, err := client.WaitForTransaction(response.Hash)
+	if err != nil {
+		return "", fmt.Errorf("failed to wait for publish transaction %s: %w", response.Hash, err)
+	}
+	if !txn.Success {
+		return "", fmt.Errorf("publish transaction %s failed: %s", response.Hash, txn.VmStatus)
+	}
+	return response.Hash, nil
+}
+
+// stageMovePackage copies the package's Move.toml and sources into dir with every address in
+// [addresses] turned into a placeholder, since the CLI refuses to override an assigned one.
+// It returns the address names. Local dependencies are resolved relative to dir, so only
+// packages with git or no dependencies stage correctly
+func stageMovePackage(packagePath string, dir string) ([]string, error) {
+	manifest, err := os.ReadFile(filepath.Join(packagePath, "Move.toml"))
+	if err != nil {
+		return nil, fmt.Errorf("DEVNET_PACKAGE_PATH is not a Move package: %w", err)
+	}
+	staged, names := placeholderAddresses(string(manifest))
+	if err := os.WriteFile(filepath.Join(dir, "Move.toml"), []byte(staged), 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.CopyFS(filepath.Join(dir, "sources"), os.DirFS(filepath.Join(packagePath, "sources"))); err != nil {
+		return nil, fmt.Errorf("failed to copy the package sources: %w", err)
+	}
+	return names, nil
+}
+
+// placeholderAddresses replaces the value of every entry in a Move.toml's [addresses] section
+// with "_", returning the manifest and the entries' names
+func placeholderAddresses(manifest string) (string, []string) {
+	lines := strings.Split(manifest, "\n")
+	var names []string
+	section := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			section = trimmed
+			continue
+		}
+		name, _, ok := strings.Cut(trimmed, "=")
+		if section != "[addresses]" || !ok || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		lines[i] = name + ` = "_"`
+		names = append(names, name)
+	}
+	return strings.Join(lines, "\n"), names
+}
+
+// readPublishPayload reads the package metadata and module bytecode out of the JSON file
+// `aptos move build-publish-payload` writes
+func readPublishPayload(path string) ([]byte, [][]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the publish payload: %w", err)
+	}
+	var payload struct {
+		Args []struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"args"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode the publish payload: %w", err)
+	}
+	if len(payload.Args) != 2 {
+		return nil, nil, fmt.Errorf("publish payload has %d arguments, expected metadata and code", len(payload.Args))
+	}
+
+	var metadataHex string
+	var codeHex []string
+	if err := json.Unmarshal(payload.Args[0].Value, &metadataHex); err != nil {
+		return nil, nil, fmt.Errorf("publish payload metadata is not a hex string: %w", err)
+	}
+	if err := json.Unmarshal(payload.Args[1].Value, &codeHex); err != nil {
+		return nil, nil, fmt.Errorf("publish payload code is not a list of hex strings: %w", err)
+	}
+	metadata, err := hex.DecodeString(strings.TrimPrefix(metadataHex, "0x"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("publish payload metadata is not hex: %w", err)
+	}
+	code := make([][]byte, len(codeHex))
+	for i, module := range codeHex {
+		if code[i], err = hex.DecodeString(strings.TrimPrefix(module, "0x")); err != nil {
+			return nil, nil, fmt.Errorf("publish payload module %d is not hex: %w", i, err)
+		}
+	}
+	return metadata, code, nil
+}
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/datax/backend/config"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Envelope encryption: every dataset is encrypted with its own random 256-bit data key (DEK),
+// and only the DEK wrapped by the master key is stored, in the blob's .meta companion. The
+// master key is ENCRYPTION_MASTER_KEY or lives in KMS or Vault (see KeyProvider). Rotating
+// it means re-wrapping DEKs, not re-encrypting data
+
+// Envelope versions: 1 sealed a blob in one AEAD call, 2 seals it in chunks (see SealedStream)
+const (
+	envelopeVersionSingle = 1
+	envelopeVersion       = 2
+)
+
+// Algorithms data can be sealed with, by the name recorded in .meta. Data keys are always
+// wrapped with AES-256-GCM
+const (
+	AlgorithmAES256GCM         = "AES-256-GCM"
+	AlgorithmXChaCha20Poly1305 = "XChaCha20-Poly1305"
+)
+
+// aeadAlgorithms builds the AEAD for each supported algorithm from a 256-bit key. Nonce sizes
+// differ (12 bytes for GCM, 24 for XChaCha20), so nonces are always sized by the AEAD
+var aeadAlgorithms = map[string]func(key []byte) (cipher.AEAD, error){
+	AlgorithmAES256GCM:         newAESGCM,
+	AlgorithmXChaCha20Poly1305: chacha20poly1305.NewX,
+}
+
+// Modes a blob's .meta records it was encrypted under. Server-encrypted blobs are decrypted
+// transparently; client-encrypted ones are served as ciphertext unless the caller supplies the key
+const (
+	EncryptionModeServer = "server"
+	EncryptionModeClient = "client"
+)
+
+// dekWrapAAD binds wrapped data keys to their purpose
+var dekWrapAAD = []byte("datax-dek-v1")
+
+var (
+	// ErrEncryptionDisabled is returned when sealing without ENCRYPTION_MASTER_KEY
+	ErrEncryptionDisabled = errors.New("encryption at rest is not configured")
+	// ErrNotEnvelope marks encryption metadata that carries no wrapped data key, i.e. a blob
+	// encrypted by the client, which the server can't decrypt
+	ErrNotEnvelope = errors.New("blob was not encrypted by the server")
+	// ErrUnknownMasterKey is returned when a data key was wrapped by a master key that is
+	// neither ENCRYPTION_MASTER_KEY nor one of ENCRYPTION_PREVIOUS_KEYS
+	ErrUnknownMasterKey = errors.New("data key was wrapped by an unknown master key")
+	// ErrUnknownAlgorithm is returned for a blob recorded with an algorithm this build can't decrypt
+	ErrUnknownAlgorithm = errors.New("unknown encryption algorithm")
+)
+
+// EnvelopeMetadata is the .meta JSON stored next to a server-encrypted blob
+type EnvelopeMetadata struct {
+	Version       int    `json:"version"`
+	Mode          string `json:"mode"` // Always EncryptionModeServer; missing from blobs sealed before it was recorded
+	Algorithm     string `json:"algorithm"`
+	KeyID         string `json:"key_id"`      // Master key that wrapped the data key (see KeyProvider)
+	WrappedKey    string `json:"wrapped_key"` // Opaque to all but the provider: base64 of nonce || AES-GCM(master key, DEK) for static keys
+	Nonce         string `json:"nonce"`       // base64 nonce the data was sealed with; the chunk nonce prefix in version 2
+	PlaintextSize int64  `json:"plaintext_size"`
+	ChunkSize     int    `json:"chunk_size,omitempty"` // Plaintext bytes per sealed chunk, in version 2
+}
+
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+// parseMasterKey decodes a 32-byte key given as 64 hex characters or base64
+func parseMasterKey(value string) (masterKey, error) {
+	value = strings.TrimSpace(value)
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(value)
+	}
+	if err != nil || len(key) != 32 {
+		return masterKey{}, fmt.Errorf("master key must be 32 bytes as hex or base64")
+	}
+	return masterKey{id: masterKeyID(key), key: key}, nil
+}
+
+// masterKeyID names a master key without revealing it: the first 8 bytes of its SHA-256
+func masterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// EncryptionEnabled reports whether uploads are encrypted at rest: always with KMS or Vault,
+// and with the static provider once ENCRYPTION_MASTER_KEY is set
+func EncryptionEnabled() bool {
+	switch strings.ToLower(config.AppConfig.KeyProvider) {
+	case "", "static":
+		return config.AppConfig.EncryptionMasterKey != ""
+	}
+	return true
+}
+
+// CurrentMasterKeyID is the ID new data keys are wrapped under, or "" when encryption is off
+func CurrentMasterKeyID() string {
+	if !EncryptionEnabled() {
+		return ""
+	}
+	return CurrentKeyProvider().KeyID()
+}
+
+// EncryptionAlgorithm is the algorithm new uploads are sealed with: ENCRYPTION_ALGORITHM,
+// matched case-insensitively, or "" when it names no supported algorithm
+func EncryptionAlgorithm() string {
+	for name := range aeadAlgorithms {
+		if strings.EqualFold(name, strings.TrimSpace(config.AppConfig.EncryptionAlgorithm)) {
+			return name
+		}
+	}
+	return ""
+}
+
+// ValidateEncryptionConfig checks KEY_PROVIDER and ENCRYPTION_ALGORITHM name supported
+// choices and that ENCRYPTION_MASTER_KEY and ENCRYPTION_PREVIOUS_KEYS parse
+func ValidateEncryptionConfig() error {
+	switch strings.ToLower(config.AppConfig.KeyProvider) {
+	case "", "static", "kms", "vault":
+	default:
+		return fmt.Errorf("KEY_PROVIDER: unknown provider %q (supported: static, kms, vault)", config.AppConfig.KeyProvider)
+	}
+	if EncryptionAlgorithm() == "" {
+		return fmt.Errorf("ENCRYPTION_ALGORITHM: %w %q (supported: %s, %s)", ErrUnknownAlgorithm, config.AppConfig.EncryptionAlgorithm, AlgorithmAES256GCM, AlgorithmXChaCha20Poly1305)
+	}
+	if config.AppConfig.EncryptionMasterKey != "" {
+		if _, err := parseMasterKey(config.AppConfig.EncryptionMasterKey); err != nil {
+			return fmt.Errorf("ENCRYPTION_MASTER_KEY: %w", err)
+		}
+	}
+	for i, value := range config.AppConfig.EncryptionPreviousKeys {
+		if _, err := parseMasterKey(value); err != nil {
+			return fmt.Errorf("ENCRYPTION_PREVIOUS_KEYS[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// masterKeyByID finds the current or a previous master key
+func masterKeyByID(id string) (masterKey, error) {
+	values := append([]string{config.AppConfig.EncryptionMasterKey}, config.AppConfig.EncryptionPreviousKeys...)
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		key, err := parseMasterKey(value)
+		if err == nil && key.id == id {
+			return key, nil
+		}
+	}
+	return masterKey{}, fmt.Errorf("%w: %s", ErrUnknownMasterKey, id)
+}
+
+// SealCSV encrypts plaintext under a fresh data key wrapped by the current master key and
+// returns the ciphertext and the .meta JSON to store next to it. It is SealCSVStream for
+// data already in memory
+func SealCSV(plaintext []byte) ([]byte, []byte, error) {
+	sealed, err := SealCSVStream(bytes.NewReader(plaintext))
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := io.ReadAll(sealed)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata, err := sealed.Metadata()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ciphertext, metadata, nil
+}
+
+// OpenCSV unwraps a blob's data key and decrypts it. Metadata without a wrapped key belongs
+// to a client-encrypted blob and fails with ErrNotEnvelope
+func OpenCSV(ciphertext []byte, metadata []byte) ([]byte, error) {
+	envelope, err := parseEnvelope(metadata)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := unwrapDataKey(envelope)
+	if err != nil {
+		return nil, err
+	}
+	return openSealed(envelope.Algorithm, dek, envelope.Nonce, envelope.ChunkSize, ciphertext)
+}
+
+// RewrapEnvelope re-wraps a blob's data key under the current master key. It returns the
+// metadata unchanged, and false, when the key is already current
+func RewrapEnvelope(metadata []byte) ([]byte, bool, error) {
+	envelope, err := parseEnvelope(metadata)
+	if err != nil {
+		return nil, false, err
+	}
+	if !EncryptionEnabled() {
+		return nil, false, ErrEncryptionDisabled
+	}
+	if envelope.KeyID == CurrentMasterKeyID() {
+		return metadata, false, nil
+	}
+
+	dek, err := unwrapDataKey(envelope)
+	if err != nil {
+		return nil, false, err
+	}
+	envelope.KeyID, envelope.WrappedKey, err = wrapDataKey(dek)
+	if err != nil {
+		return nil, false, err
+	}
+	rewrapped, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode encryption metadata: %w", err)
+	}
+	return rewrapped, true, nil
+}
+
+// EnvelopeKeyID returns the master key ID recorded in encryption metadata, or "" for
+// metadata that isn't a server envelope
+func EnvelopeKeyID(metadata []byte) string {
+	envelope, err := parseEnvelope(metadata)
+	if err != nil {
+		return ""
+	}
+	return envelope.KeyID
+}
+
+// EncryptionMode reports the mode a blob's .meta records: EncryptionModeServer or
+// EncryptionModeClient. Metadata without a mode is a server envelope if it carries a wrapped key
+func EncryptionMode(metadata []byte) string {
+	var recorded struct {
+		Mode       string `json:"mode"`
+		WrappedKey string `json:"wrapped_key"`
+	}
+	if err := json.Unmarshal(metadata, &recorded); err != nil {
+		return EncryptionModeClient
+	}
+	switch {
+	case recorded.Mode != "":
+		return recorded.Mode
+	case recorded.WrappedKey != "":
+		return EncryptionModeServer
+	}
+	return EncryptionModeClient
+}
+
+// EncryptionMetadataAlgorithm returns the algorithm a blob's .meta records, or "" if none
+func EncryptionMetadataAlgorithm(metadata []byte) string {
+	var recorded struct {
+		Algorithm string `json:"algorithm"`
+	}
+	if err := json.Unmarshal(metadata, &recorded); err != nil {
+		return ""
+	}
+	return recorded.Algorithm
+}
+
+// OpenCSVWithKey decrypts a blob with a data key the caller supplied: a grantee's unwrapped
+// key for a server-encrypted blob, or the client's own key. The algorithm and nonce are read
+// from .meta, which for client-encrypted blobs must record them under the envelope's names
+func OpenCSVWithKey(ciphertext []byte, metadata []byte, key []byte) ([]byte, error) {
+	var recorded struct {
+		Algorithm string `json:"algorithm"`
+		Nonce     string `json:"nonce"`
+		ChunkSize int    `json:"chunk_size"`
+	}
+	if err := json.Unmarshal(metadata, &recorded); err != nil {
+		return nil, fmt.Errorf("invalid encryption metadata: %w", err)
+	}
+	return openSealed(recorded.Algorithm, key, recorded.Nonce, recorded.ChunkSize, ciphertext)
+}
+
+// openSealed decrypts a blob sealed in one call or, with a chunk size, in chunks under the
+// nonce prefix
+func openSealed(algorithm string, key []byte, encodedNonce string, chunkSize int, ciphertext []byte) ([]byte, error) {
+	nonce, err := base64.StdEncoding.DecodeString(encodedNonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce in encryption metadata: %w", err)
+	}
+	var plaintext []byte
+	if chunkSize > 0 {
+		plaintext, err = openStream(algorithm, key, nonce, chunkSize, ciphertext)
+	} else {
+		plaintext, err = aeadOpen(algorithm, key, nonce, ciphertext, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt blob: %w", err)
+	}
+	return plaintext, nil
+}
+
+func parseEnvelope(metadata []byte) (EnvelopeMetadata, error) {
+	var envelope EnvelopeMetadata
+	if err := json.Unmarshal(metadata, &envelope); err != nil || envelope.WrappedKey == "" || EncryptionMode(metadata) != EncryptionModeServer {
+		return EnvelopeMetadata{}, ErrNotEnvelope
+	}
+	if envelope.Version != envelopeVersionSingle && envelope.Version != envelopeVersion {
+		return EnvelopeMetadata{}, fmt.Errorf("unsupported envelope version %d", envelope.Version)
+	}
+	if _, ok := aeadAlgorithms[envelope.Algorithm]; !ok {
+		return EnvelopeMetadata{}, fmt.Errorf("%w %q", ErrUnknownAlgorithm, envelope.Algorithm)
+	}
+	return envelope, nil
+}
+
+// wrapDataKey wraps a data key with the current provider and returns the key ID to record
+func wrapDataKey(dek []byte) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyProviderTimeout)
+	defer cancel()
+	return CurrentKeyProvider().WrapKey(ctx, dek)
+}
+
+// unwrapDataKey recovers a blob's data key from the provider that wrapped it. Keys from
+// remote providers are cached for KEY_CACHE_TTL
+func unwrapDataKey(envelope EnvelopeMetadata) ([]byte, error) {
+	provider, err := keyProviderFor(envelope.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	remote := provider.Name() != "static"
+	if remote {
+		if dek := cachedUnwrap(envelope.KeyID, envelope.WrappedKey); dek != nil {
+			return dek, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyProviderTimeout)
+	defer cancel()
+	dek, err := provider.UnwrapKey(ctx, envelope.KeyID, envelope.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	if remote {
+		cacheUnwrap(envelope.KeyID, envelope.WrappedKey, dek)
+	}
+	return dek, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newAEAD(algorithm string, key []byte) (cipher.AEAD, error) {
+	constructor, ok := aeadAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAlgorithm, algorithm)
+	}
+	return constructor(key)
+}
+
+// aeadSeal encrypts under a random nonce of the algorithm's size
+func aeadSeal(algorithm string, key []byte, plaintext []byte, aad []byte) ([]byte, []byte, error) {
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+func aeadOpen(algorithm string, key []byte, nonce []byte, ciphertext []byte, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d for %s", len(nonce), algorithm)
+	}
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+// retrieveSealedCSV downloads a server-encrypted blob, decrypts it and parses the CSV
+func retrieveSealedCSV(store EncryptedCSVStorage, accountAddress string, blobName string) ([][]string, error) {
+	ciphertext, metadata, err := store.RetrieveEncryptedCSV(accountAddress, blobName)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := OpenCSV(ciphertext, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", blobName, err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(plaintext)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	return records, nil
+}
+
+// previewSealedCSV is PreviewCSV for a server-encrypted blob. GCM can only be verified over
+// the whole ciphertext, so the blob is decrypted in full and the preview cut from it
+func previewSealedCSV(store EncryptedCSVStorage, accountAddress string, blobName string, limit int) ([][]string, error) {
+	records, err := retrieveSealedCSV(store, accountAddress, blobName)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > limit+2 {
+		records = records[:limit+2]
+	}
+	return records, nil
+}
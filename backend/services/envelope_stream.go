@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/datax/backend/config"
+)
+
+// Blobs are sealed as a STREAM-style chunked AEAD, so uploads are encrypted as they arrive
+// instead of being held whole. The plaintext is cut into chunks of chunk_size bytes (the
+// last one shorter, possibly empty) and each is sealed on its own, with the nonce
+//
+//	prefix || uint32 big-endian chunk counter || final flag (1 for the last chunk, else 0)
+//
+// where the random prefix is the .meta nonce, 5 bytes shorter than the algorithm's nonce.
+// The counter stops chunks being reordered and the flag stops the blob being truncated at a
+// chunk boundary. Envelope version 1 blobs were sealed in one call and still open
+
+// streamChunkSize is the plaintext size of every chunk but the last
+const streamChunkSize = 64 << 10
+
+// streamNonceSuffix is the counter and final flag appended to a stream's nonce prefix
+const streamNonceSuffix = 5
+
+// ErrStreamNotDrained is returned for the metadata of a SealedStream not yet read to EOF
+var ErrStreamNotDrained = errors.New("sealed stream was not read to the end")
+
+// ErrEnvelopeNotChunked is returned by OpenCSVStream for a blob sealed in one call, which can
+// only be decrypted whole
+var ErrEnvelopeNotChunked = errors.New("blob was encrypted as a single unit and can only be decrypted whole")
+
+// SealedStream encrypts a plaintext stream under a fresh data key as it is read: reading it
+// yields the ciphertext. Metadata returns the .meta JSON once it has been read to EOF
+type SealedStream struct {
+	src      io.Reader
+	aead     cipher.AEAD
+	prefix   []byte
+	counter  uint32
+	started  bool
+	next     []byte // Plaintext chunk read ahead, to know whether the one before it is the last
+	eof      bool   // src is exhausted
+	out      []byte // Sealed bytes not yet returned by Read
+	done     bool   // The final chunk was sealed
+	err      error
+	size     int64
+	envelope EnvelopeMetadata
+}
+
+// SealCSVStream starts sealing plaintext under a fresh data key wrapped by the current master
+// key. Nothing is read until the returned stream is
+func SealCSVStream(plaintext io.Reader) (*SealedStream, error) {
+	if !EncryptionEnabled() {
+		return nil, ErrEncryptionDisabled
+	}
+	algorithm := EncryptionAlgorithm()
+	if algorithm == "" {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAlgorithm, config.AppConfig.EncryptionAlgorithm)
+	}
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	aead, err := newAEAD(algorithm, dek)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, aead.NonceSize()-streamNonceSuffix)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := wrapDataKey(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SealedStream{
+		src:    plaintext,
+		aead:   aead,
+		prefix: prefix,
+		envelope: EnvelopeMetadata{
+			Version:    envelopeVersion,
+			Mode:       EncryptionModeServer,
+			Algorithm:  algorithm,
+			KeyID:      keyID,
+			WrappedKey: wrapped,
+			Nonce:      base64.StdEncoding.EncodeToString(prefix),
+			ChunkSize:  streamChunkSize,
+		},
+	}, nil
+}
+
+// Read returns the next ciphertext bytes, sealing a chunk whenever the last one is used up
+func (s *SealedStream) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		switch {
+		case s.err != nil:
+			return 0, s.err
+		case s.done:
+			return 0, io.EOF
+		}
+		s.sealChunk()
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// sealChunk seals the next plaintext chunk into out. A chunk is final when reading the one
+// after it finds the end of the plaintext
+func (s *SealedStream) sealChunk() {
+	if !s.started {
+		s.started = true
+		if s.next, s.err = s.readChunk(); s.err != nil {
+			return
+		}
+	}
+
+	chunk, final := s.next, s.eof
+	if !final {
+		next, err := s.readChunk()
+		if err != nil {
+			s.err = err
+			return
+		}
+		s.next = next
+		final = s.eof && len(next) == 0
+	}
+	if !final && s.counter == math.MaxUint32 {
+		s.err = fmt.Errorf("plaintext is too large to seal")
+		return
+	}
+
+	s.out = s.aead.Seal(s.out[:0], streamNonce(s.prefix, s.counter, final), chunk, nil)
+	s.size += int64(len(chunk))
+	s.counter++
+	s.done = final
+}
+
+// readChunk reads up to a chunk of plaintext; only the end of the stream gives a short one
+func (s *SealedStream) readChunk() ([]byte, error) {
+	chunk := make([]byte, streamChunkSize)
+	n, err := io.ReadFull(s.src, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		s.eof = true
+		err = nil
+	}
+	return chunk[:n], err
+}
+
+// KeyID is the master key that wrapped the stream's data key
+func (s *SealedStream) KeyID() string {
+	return s.envelope.KeyID
+}
+
+// Metadata returns the .meta JSON to store next to the ciphertext. The plaintext size is only
+// known at the end, so the stream must have been read to EOF
+func (s *SealedStream) Metadata() ([]byte, error) {
+	if !s.done {
+		return nil, ErrStreamNotDrained
+	}
+	envelope := s.envelope
+	envelope.PlaintextSize = s.size
+	metadata, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode encryption metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// streamNonce is the nonce of chunk counter of a stream sealed under prefix
+func streamNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, len(prefix)+streamNonceSuffix)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], counter)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// openStream decrypts a chunked ciphertext, failing if any chunk was altered, reordered or
+// dropped
+func openStream(algorithm string, key []byte, prefix []byte, chunkSize int, ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) != aead.NonceSize()-streamNonceSuffix {
+		return nil, fmt.Errorf("invalid nonce length %d for chunked %s", len(prefix), algorithm)
+	}
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+
+	sealedChunk := chunkSize + aead.Overhead()
+	plaintext := make([]byte, 0, max(len(ciphertext)/sealedChunk, 1)*chunkSize)
+	for counter := uint32(0); ; counter++ {
+		final := len(ciphertext) <= sealedChunk
+		n := min(len(ciphertext), sealedChunk)
+		plaintext, err = aead.Open(plaintext, streamNonce(prefix, counter, final), ciphertext[:n], nil)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", counter, err)
+		}
+		if final {
+			return plaintext, nil
+		}
+		ciphertext = ciphertext[n:]
+	}
+}
+
+// OpenCSVStream decrypts a server-encrypted blob as its ciphertext is read, a chunk at a
+// time. Each chunk is authenticated before any of its plaintext is returned, and a blob
+// altered, reordered or cut short fails with an error rather than EOF. Blobs of envelope
+// version 1 fail with ErrEnvelopeNotChunked
+func OpenCSVStream(ciphertext io.Reader, metadata []byte) (io.Reader, error) {
+	envelope, err := parseEnvelope(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.ChunkSize <= 0 {
+		return nil, ErrEnvelopeNotChunked
+	}
+	prefix, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce in encryption metadata: %w", err)
+	}
+	dek, err := unwrapDataKey(envelope)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(envelope.Algorithm, dek)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) != aead.NonceSize()-streamNonceSuffix {
+		return nil, fmt.Errorf("invalid nonce length %d for chunked %s", len(prefix), envelope.Algorithm)
+	}
+	return &openedStream{
+		src:    bufio.NewReader(ciphertext),
+		aead:   aead,
+		prefix: prefix,
+		sealed: make([]byte, envelope.ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+// openedStream is the plaintext of a chunked ciphertext, opened as it is read
+type openedStream struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	sealed  []byte // Buffer for one sealed chunk
+	opened  []byte // Buffer for its plaintext
+	out     []byte // Opened bytes not yet returned by Read
+	done    bool   // The final chunk was opened
+	err     error
+}
+
+func (s *openedStream) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		switch {
+		case s.err != nil:
+			return 0, s.err
+		case s.done:
+			return 0, io.EOF
+		}
+		s.openChunk()
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// openChunk opens the next sealed chunk into out. A chunk is final when nothing follows it,
+// as openStream decides over a whole ciphertext
+func (s *openedStream) openChunk() {
+	n, err := io.ReadFull(s.src, s.sealed)
+	final := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !final {
+		s.err = err
+		return
+	}
+	if !final {
+		if _, err := s.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			s.err = err
+			return
+		}
+	}
+
+	s.opened, err = s.aead.Open(s.opened[:0], streamNonce(s.prefix, s.counter, final), s.sealed[:n], nil)
+	if err != nil {
+		s.err = fmt.Errorf("failed to decrypt blob: chunk %d: %w", s.counter, err)
+		return
+	}
+	s.out = s.opened
+	s.counter++
+	s.done = final
+}
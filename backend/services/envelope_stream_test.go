@@ -0,0 +1,242 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/datax/backend/config"
+)
+
+// withMasterKey turns encryption at rest on with algorithm for the test
+func withMasterKey(t *testing.T, algorithm string) {
+	t.Helper()
+	masterKey, algorithmBefore := config.AppConfig.EncryptionMasterKey, config.AppConfig.EncryptionAlgorithm
+	config.AppConfig.EncryptionMasterKey = strings.Repeat("ab", 32)
+	config.AppConfig.EncryptionAlgorithm = algorithm
+	t.Cleanup(func() {
+		config.AppConfig.EncryptionMasterKey, config.AppConfig.EncryptionAlgorithm = masterKey, algorithmBefore
+	})
+}
+
+func sealForTest(t *testing.T, plaintext []byte) ([]byte, []byte) {
+	t.Helper()
+	ciphertext, metadata, err := SealCSV(plaintext)
+	if err != nil {
+		t.Fatalf("SealCSV: %v", err)
+	}
+	return ciphertext, metadata
+}
+
+func TestSealedStreamRoundTrips(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmAES256GCM, AlgorithmXChaCha20Poly1305} {
+		withMasterKey(t, algorithm)
+		for _, size := range []int{0, 1, streamChunkSize - 1, streamChunkSize, streamChunkSize + 1, 3 * streamChunkSize} {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+
+			ciphertext, metadata := sealForTest(t, plaintext)
+			opened, err := OpenCSV(ciphertext, metadata)
+			if err != nil {
+				t.Fatalf("%s, %d bytes: OpenCSV: %v", algorithm, size, err)
+			}
+			if !bytes.Equal(opened, plaintext) {
+				t.Errorf("%s, %d bytes: round trip changed the data", algorithm, size)
+			}
+
+			var envelope EnvelopeMetadata
+			json.Unmarshal(metadata, &envelope)
+			if envelope.Version != envelopeVersion || envelope.ChunkSize != streamChunkSize || envelope.PlaintextSize != int64(size) {
+				t.Errorf("%s, %d bytes: metadata %+v", algorithm, size, envelope)
+			}
+		}
+	}
+}
+
+func TestSealedStreamRejectsTamperedChunks(t *testing.T) {
+	withMasterKey(t, AlgorithmAES256GCM)
+	plaintext := bytes.Repeat([]byte("id,value\n1,2\n"), 3*streamChunkSize/13)
+	ciphertext, metadata := sealForTest(t, plaintext)
+	sealedChunk := streamChunkSize + 16
+
+	cases := map[string][]byte{
+		// Cut at a chunk boundary: the chunk left last wasn't sealed as the final one
+		"last chunk dropped": ciphertext[:2*sealedChunk],
+		"chunks swapped":     append(append(append([]byte{}, ciphertext[sealedChunk:2*sealedChunk]...), ciphertext[:sealedChunk]...), ciphertext[2*sealedChunk:]...),
+		"byte flipped":       append(append([]byte{}, ciphertext[:10]...), append([]byte{ciphertext[10] ^ 1}, ciphertext[11:]...)...),
+	}
+	for name, tampered := range cases {
+		if _, err := OpenCSV(tampered, metadata); err == nil {
+			t.Errorf("%s: opened", name)
+		}
+	}
+}
+
+// countingSource counts how much plaintext has been pulled from it
+type countingSource struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingSource) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestSealedStreamReadsPlaintextAsItGoes(t *testing.T) {
+	withMasterKey(t, AlgorithmAES256GCM)
+	source := &countingSource{r: bytes.NewReader(make([]byte, 10*streamChunkSize))}
+	sealed, err := SealCSVStream(source)
+	if err != nil {
+		t.Fatalf("SealCSVStream: %v", err)
+	}
+	if source.read != 0 {
+		t.Errorf("read %d bytes before the stream was", source.read)
+	}
+
+	// The first chunk only needs the chunk after it read ahead
+	if _, err := io.ReadFull(sealed, make([]byte, 100)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if source.read > 2*streamChunkSize {
+		t.Errorf("read %d bytes of plaintext for the first chunk, want at most 2 chunks", source.read)
+	}
+	if _, err := sealed.Metadata(); !errors.Is(err, ErrStreamNotDrained) {
+		t.Errorf("Metadata before EOF = %v, want ErrStreamNotDrained", err)
+	}
+
+	io.Copy(io.Discard, sealed)
+	if _, err := sealed.Metadata(); err != nil {
+		t.Errorf("Metadata after EOF: %v", err)
+	}
+}
+
+func TestOpenCSVStillOpensSingleShotBlobs(t *testing.T) {
+	withMasterKey(t, AlgorithmAES256GCM)
+	dek := make([]byte, 32)
+	rand.Read(dek)
+	plaintext := []byte("id,value\n1,2\n")
+	nonce, ciphertext, err := aeadSeal(AlgorithmAES256GCM, dek, plaintext, nil)
+	if err != nil {
+		t.Fatalf("aeadSeal: %v", err)
+	}
+	keyID, wrapped, err := wrapDataKey(dek)
+	if err != nil {
+		t.Fatalf("wrapDataKey: %v", err)
+	}
+	metadata, _ := json.Marshal(EnvelopeMetadata{
+		Version: envelopeVersionSingle, Mode: EncryptionModeServer, Algorithm: AlgorithmAES256GCM,
+		KeyID: keyID, WrappedKey: wrapped, Nonce: base64.StdEncoding.EncodeToString(nonce), PlaintextSize: int64(len(plaintext)),
+	})
+
+	opened, err := OpenCSV(ciphertext, metadata)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("version 1 blob = %q, %v", opened, err)
+	}
+}
+
+func TestLocalStorageStoresSealedStreams(t *testing.T) {
+	withMasterKey(t, AlgorithmXChaCha20Poly1305)
+	storage := NewLocalStorageService(t.TempDir()).(*LocalStorageService)
+	plaintext := bytes.Repeat([]byte("id,value\n1,2\n"), streamChunkSize/5)
+
+	sealed, err := SealCSVStream(bytes.NewReader(plaintext))
+	if err != nil {
+		t.Fatalf("SealCSVStream: %v", err)
+	}
+	blobName, err := storage.StoreEncryptedCSVStream(testOwnerA, sealed, sealed.Metadata)
+	if err != nil {
+		t.Fatalf("StoreEncryptedCSVStream: %v", err)
+	}
+
+	records, err := storage.RetrieveCSV(testOwnerA, blobName)
+	if err != nil {
+		t.Fatalf("RetrieveCSV: %v", err)
+	}
+	if len(records) != streamChunkSize/5*2 || records[1][1] != "2" {
+		t.Errorf("read back %d records", len(records))
+	}
+}
+
+func TestOpenCSVStreamMatchesOpenCSV(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmAES256GCM, AlgorithmXChaCha20Poly1305} {
+		withMasterKey(t, algorithm)
+		for _, size := range []int{0, 1, streamChunkSize - 1, streamChunkSize, streamChunkSize + 1, 3 * streamChunkSize} {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+			ciphertext, metadata := sealForTest(t, plaintext)
+
+			stream, err := OpenCSVStream(bytes.NewReader(ciphertext), metadata)
+			if err != nil {
+				t.Fatalf("%s, %d bytes: OpenCSVStream: %v", algorithm, size, err)
+			}
+			opened, err := io.ReadAll(stream)
+			if err != nil || !bytes.Equal(opened, plaintext) {
+				t.Errorf("%s, %d bytes: streamed %d bytes, %v", algorithm, size, len(opened), err)
+			}
+		}
+	}
+}
+
+func TestOpenCSVStreamRejectsTamperedChunks(t *testing.T) {
+	withMasterKey(t, AlgorithmAES256GCM)
+	plaintext := bytes.Repeat([]byte("id,value\n1,2\n"), 3*streamChunkSize/13)
+	ciphertext, metadata := sealForTest(t, plaintext)
+	sealedChunk := streamChunkSize + 16
+
+	cases := map[string][]byte{
+		"last chunk dropped": ciphertext[:2*sealedChunk],
+		"chunks swapped":     append(append(append([]byte{}, ciphertext[sealedChunk:2*sealedChunk]...), ciphertext[:sealedChunk]...), ciphertext[2*sealedChunk:]...),
+		"byte flipped":       append(append([]byte{}, ciphertext[:len(ciphertext)-10]...), append([]byte{ciphertext[len(ciphertext)-10] ^ 1}, ciphertext[len(ciphertext)-9:]...)...),
+		"empty":              {},
+	}
+	for name, tampered := range cases {
+		stream, err := OpenCSVStream(bytes.NewReader(tampered), metadata)
+		if err != nil {
+			t.Fatalf("%s: OpenCSVStream: %v", name, err)
+		}
+		if _, err := io.Copy(io.Discard, stream); err == nil {
+			t.Errorf("%s: read to EOF", name)
+		}
+	}
+}
+
+func TestOpenCSVStreamReadsCiphertextAsItGoes(t *testing.T) {
+	withMasterKey(t, AlgorithmAES256GCM)
+	ciphertext, metadata := sealForTest(t, make([]byte, 10*streamChunkSize))
+	source := &countingSource{r: bytes.NewReader(ciphertext)}
+
+	stream, err := OpenCSVStream(source, metadata)
+	if err != nil {
+		t.Fatalf("OpenCSVStream: %v", err)
+	}
+	if _, err := io.ReadFull(stream, make([]byte, 100)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	// One sealed chunk, plus what the buffered reader fetched to see whether another follows
+	if source.read > 2*streamChunkSize+4096 {
+		t.Errorf("read %d bytes of ciphertext for the first chunk, want about one chunk", source.read)
+	}
+}
+
+func TestOpenCSVStreamRefusesSingleShotBlobs(t *testing.T) {
+	withMasterKey(t, AlgorithmAES256GCM)
+	dek := make([]byte, 32)
+	rand.Read(dek)
+	nonce, ciphertext, _ := aeadSeal(AlgorithmAES256GCM, dek, []byte("id\n1\n"), nil)
+	keyID, wrapped, _ := wrapDataKey(dek)
+	metadata, _ := json.Marshal(EnvelopeMetadata{
+		Version: envelopeVersionSingle, Mode: EncryptionModeServer, Algorithm: AlgorithmAES256GCM,
+		KeyID: keyID, WrappedKey: wrapped, Nonce: base64.StdEncoding.EncodeToString(nonce),
+	})
+
+	if _, err := OpenCSVStream(bytes.NewReader(ciphertext), metadata); !errors.Is(err, ErrEnvelopeNotChunked) {
+		t.Errorf("version 1 blob = %v, want ErrEnvelopeNotChunked", err)
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// aeadVectors are published known-answer vectors: AES-256-GCM from the GCM specification's
+// test cases (as carried in Go's crypto/cipher tests) and XChaCha20-Poly1305 from
+// draft-irtf-cfrg-xchacha-01 appendix A.3.1. sealed ends in the 16-byte tag
+var aeadVectors = []struct {
+	algorithm                          string
+	key, nonce, plaintext, aad, sealed string
+}{
+	{
+		algorithm: AlgorithmAES256GCM,
+		key:       "feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308",
+		nonce:     "54cc7dc2c37ec006bcc6d1da",
+		plaintext: "007c5e5b3e59df24a7c355584fc1518d",
+		aad:       "",
+		sealed:    "d50b9e252b70945d4240d351677eb10f937cdaef6f2822b6a3191654ba41b197",
+	},
+	{
+		algorithm: AlgorithmAES256GCM,
+		key:       "feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308",
+		nonce:     "e1934f5db57cc983e6b180e7",
+		plaintext: "73ed042327f70fe9c572a61545eda8b2a0c6e1d6c291ef19248e973aee6c312012f490c2c6f6166f4a59431e182663fcaea05a",
+		aad:       "0a8a18a7150e940c3d87b38e73baee9a5c049ee21795663e264b694a949822b639092d0e67015e86363583fcf0ca645af9f43375f05fdb4ce84f411dcbca73c2220dea03a20115d2e51398344b16bee1ed7c499b353d6c597af8",
+		sealed:    "fc1ae2b5dcd2c4176c3f538b4c3cc21197f79e608cc3730167936382e4b1e5a7b75ae1678bcebd876705477eb0e0fdbbcda92fb9a0dc58c8d8f84fb590e0422e6077ef",
+	},
+	{
+		algorithm: AlgorithmXChaCha20Poly1305,
+		key:       "808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		nonce:     "404142434445464748494a4b4c4d4e4f5051525354555657",
+		plaintext: "4c616469657320616e642047656e746c656d656e206f662074686520636c617373206f66202739393a204966204920636f756c64206f6666657220796f75206f6e6c79206f6e652074697020666f7220746865206675747572652c2073756e73637265656e20776f756c642062652069742e",
+		aad:       "50515253c0c1c2c3c4c5c6c7",
+		sealed:    "bd6d179d3e83d43b9576579493c0e939572a1700252bfaccbed2902c21396cbb731c7f1b0b4aa6440bf3a82f4eda7e39ae64c6708c54c216cb96b72e1213b4522f8c9ba40db5d945b11b69b982c1bb9e3f3fac2bc369488f76b2383565d3fff921f9664c97637da9768812f615c68b13b52ec0875924c1c7987947deafd8780acf49",
+	},
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex in test vector: %v", err)
+	}
+	return b
+}
+
+func TestAEADKnownAnswers(t *testing.T) {
+	for i, v := range aeadVectors {
+		key, nonce, plaintext, aad, sealed := mustHex(t, v.key), mustHex(t, v.nonce), mustHex(t, v.plaintext), mustHex(t, v.aad), mustHex(t, v.sealed)
+
+		aead, err := newAEAD(v.algorithm, key)
+		if err != nil {
+			t.Fatalf("%d %s: newAEAD: %v", i, v.algorithm, err)
+		}
+		if aead.NonceSize() != len(nonce) {
+			t.Errorf("%d %s: nonce size %d, want %d", i, v.algorithm, aead.NonceSize(), len(nonce))
+		}
+		if got := aead.Seal(nil, nonce, plaintext, aad); !bytes.Equal(got, sealed) {
+			t.Errorf("%d %s: sealed = %x, want %x", i, v.algorithm, got, sealed)
+		}
+
+		opened, err := aeadOpen(v.algorithm, key, nonce, sealed, aad)
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Errorf("%d %s: aeadOpen = %x, %v, want %x", i, v.algorithm, opened, err, plaintext)
+		}
+
+		// A flipped tag bit or different associated data is refused
+		tampered := append([]byte{}, sealed...)
+		tampered[len(tampered)-1] ^= 1
+		if _, err := aeadOpen(v.algorithm, key, nonce, tampered, aad); err == nil {
+			t.Errorf("%d %s: aeadOpen of a tampered tag succeeded", i, v.algorithm)
+		}
+		if _, err := aeadOpen(v.algorithm, key, nonce, sealed, append(aad, 0)); err == nil {
+			t.Errorf("%d %s: aeadOpen with other associated data succeeded", i, v.algorithm)
+		}
+	}
+}
+
+func TestAEADNonceSizesDiffer(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	cases := map[string]int{AlgorithmAES256GCM: 12, AlgorithmXChaCha20Poly1305: 24}
+	for algorithm, size := range cases {
+		nonce, sealed, err := aeadSeal(algorithm, key, []byte("id,name\n"), nil)
+		if err != nil || len(nonce) != size {
+			t.Fatalf("%s: aeadSeal nonce of %d bytes, %v, want %d", algorithm, len(nonce), err, size)
+		}
+
+		// A nonce of the other algorithm's size is refused rather than passed to the cipher
+		other := AlgorithmXChaCha20Poly1305
+		if algorithm == other {
+			other = AlgorithmAES256GCM
+		}
+		if _, err := aeadOpen(other, key, nonce, sealed, nil); err == nil {
+			t.Errorf("%s ciphertext opened as %s", algorithm, other)
+		}
+	}
+}
+
+func TestOpenCSVWithKeyReportsAnUnknownAlgorithm(t *testing.T) {
+	metadata := []byte(`{"algorithm":"ROT13","nonce":"AAAAAAAAAAAAAAAA"}`)
+	if _, err := OpenCSVWithKey([]byte("sealed"), metadata, bytes.Repeat([]byte{1}, 32)); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("OpenCSVWithKey with an unknown algorithm = %v, want %v", err, ErrUnknownAlgorithm)
+	}
+	if _, err := newAEAD("", bytes.Repeat([]byte{1}, 32)); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("newAEAD with no algorithm = %v, want %v", err, ErrUnknownAlgorithm)
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+)
+
+// Abort codes of the Escrow module
+const (
+	abortDepositNotFound = 1 // E_DEPOSIT_NOT_FOUND
+	abortRefundTooEarly  = 3 // E_REFUND_TOO_EARLY
+)
+
+// EscrowRefundTimeout is how long the owner has to release a deposit before the requester
+// can take it back, REFUND_TIMEOUT_SECS of the Escrow module
+const EscrowRefundTimeout = 7 * 24 * time.Hour
+
+var (
+	// ErrEscrowNotFound is returned when releasing or refunding a deposit that was never made
+	// or has already been paid out
+	ErrEscrowNotFound = errors.New("no deposit in escrow for this dataset")
+	// ErrEscrowRefundTooEarly is returned when refunding a deposit the owner can still release
+	ErrEscrowRefundTooEarly = errors.New("the owner can still release this deposit; it can be refunded once the refund timeout has passed")
+)
+
+// DepositEscrow puts amount octas of APT in escrow for access to an owner's dataset,
+// signed by the requester
+func (s *AptosServiceImpl) DepositEscrow(privateKeyHex string, owner string, datasetID uint64, amount uint64) (string, error) {
+	account, err := getAccountFromPrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	moduleAddr, err := parseAddress(s.cfg.EscrowModuleAddr)
+	if err != nil {
+		return "", err
+	}
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return "", err
+	}
+
+	return s.submitTransaction(
+		account,
+		moduleAddr,
+		"Escrow",
+		"deposit",
+		[]interface{}{ownerAddr, datasetID, amount},
+	)
+}
+
+// ReleaseEscrow pays a requester's deposit for one of the owner's datasets out to the
+// owner and grants the requester access until expiresAt, in one transaction signed by the
+// owner
+func (s *AptosServiceImpl) ReleaseEscrow(privateKeyHex string, datasetID uint64, requester string, expiresAt uint64) (string, error) {
+	account, err := getAccountFromPrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	moduleAddr, err := parseAddress(s.cfg.EscrowModuleAddr)
+	if err != nil {
+		return "", err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return "", err
+	}
+
+	txHash, err := s.submitTransaction(
+		account,
+		moduleAddr,
+		"Escrow",
+		"release",
+		[]interface{}{datasetID, requesterAddr, expiresAt},
+	)
+	return txHash, escrowError(err)
+}
+
+// RefundEscrow gives a deposit the owner hasn't released within EscrowRefundTimeout back
+// to the requester, signed by the requester
+func (s *AptosServiceImpl) RefundEscrow(privateKeyHex string, owner string, datasetID uint64) (string, error) {
+	account, err := getAccountFromPrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	moduleAddr, err := parseAddress(s.cfg.EscrowModuleAddr)
+	if err != nil {
+		return "", err
+	}
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return "", err
+	}
+
+	txHash, err := s.submitTransaction(
+		account,
+		moduleAddr,
+		"Escrow",
+		"refund",
+		[]interface{}{ownerAddr, datasetID},
+	)
+	return txHash, escrowError(err)
+}
+
+// GetEscrowBalance returns the octas a requester holds in escrow for an owner's dataset,
+// through the Escrow::balance view function
+func (s *AptosServiceImpl) GetEscrowBalance(owner string, datasetID uint64, requester string) (uint64, error) {
+	moduleAddr, err := parseAddress(s.cfg.EscrowModuleAddr)
+	if err != nil {
+		return 0, err
+	}
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return 0, err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return 0, err
+	}
+
+	args := make([][]byte, 0, 3)
+	for _, arg := range []interface{}{ownerAddr, datasetID, requesterAddr} {
+		argBytes, err := serializeArg(arg)
+		if err != nil {
+			return 0, fmt.Errorf("failed to serialize argument: %w", err)
+		}
+		args = append(args, argBytes)
+	}
+
+	result, err := s.client.View(&aptos.ViewPayload{
+		Module:   aptos.ModuleId{Address: *moduleAddr, Name: "Escrow"},
+		Function: "balance",
+		ArgTypes: []aptos.TypeTag{},
+		Args:     args,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to call Escrow::balance: %w", err)
+	}
+	var balance uint64
+	if err := decodeViewResult(result, &balance); err != nil {
+		return 0, fmt.Errorf("invalid Escrow::balance result: %w", err)
+	}
+	return balance, nil
+}
+
+// escrowError maps the aborts of Escrow::release and Escrow::refund to their errors
+func escrowError(err error) error {
+	var txErr *TransactionError
+	if !errors.As(err, &txErr) || txErr.Module != "Escrow" {
+		return err
+	}
+	switch txErr.AbortCode {
+	case abortDepositNotFound:
+		return fmt.Errorf("%w (%s)", ErrEscrowNotFound, txErr.VMStatus)
+	case abortRefundTooEarly:
+		return fmt.Errorf("%w (%s)", ErrEscrowRefundTooEarly, txErr.VMStatus)
+	}
+	return err
+}
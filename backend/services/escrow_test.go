@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/datax/backend/internal/store"
+)
+
+// testSignerKey is the Ed25519 key the requester and owner sign escrow calls with here
+var testSignerKey = "0x" + strings.Repeat("11", 32)
+
+func TestReleaseEscrowGrantsInTheSameTransaction(t *testing.T) {
+	client := &fakeAptosClient{}
+	service := newFakeClientService(t, client)
+
+	if _, err := service.ReleaseEscrow(testSignerKey, 7, testOwnerB, 1_900_000_000); err != nil {
+		t.Fatalf("ReleaseEscrow: %v", err)
+	}
+	if len(client.submitted) != 1 {
+		t.Fatalf("submitted %d transactions, want a single one", len(client.submitted))
+	}
+	call := client.lastSubmitted(t)
+	if call.Module.Name != "Escrow" || call.Function != "release" || call.Module.Address.String() != mustAddress(testModuleAddr) {
+		t.Errorf("called %s::%s::%s, want Escrow::release", call.Module.Address.String(), call.Module.Name, call.Function)
+	}
+	// The arguments of AccessControl::grant_access, which the event index reads back
+	want := encodedArgs(t, uint64(7), mustParseAddress(t, testOwnerB), uint64(1_900_000_000))
+	if !reflect.DeepEqual(call.Args, want) {
+		t.Errorf("release arguments = %x, want dataset_id, requester, expires_at", call.Args)
+	}
+}
+
+func TestRefundEscrowArguments(t *testing.T) {
+	client := &fakeAptosClient{}
+	service := newFakeClientService(t, client)
+
+	if _, err := service.RefundEscrow(testSignerKey, testOwnerA, 3); err != nil {
+		t.Fatalf("RefundEscrow: %v", err)
+	}
+	call := client.lastSubmitted(t)
+	if call.Module.Name != "Escrow" || call.Function != "refund" {
+		t.Errorf("called %s::%s, want Escrow::refund", call.Module.Name, call.Function)
+	}
+	if want := encodedArgs(t, mustParseAddress(t, testOwnerA), uint64(3)); !reflect.DeepEqual(call.Args, want) {
+		t.Errorf("refund arguments = %x, want owner, dataset_id", call.Args)
+	}
+}
+
+func TestEscrowAbortsMapToTheirErrors(t *testing.T) {
+	cases := []struct {
+		vmStatus string
+		want     error
+	}{
+		{"Move abort in 0xcafe1::Escrow: E_DEPOSIT_NOT_FOUND(0x1): no deposit", ErrEscrowNotFound},
+		{"Move abort in 0xcafe1::Escrow: 0x1", ErrEscrowNotFound},
+		{"Move abort in 0xcafe1::Escrow: E_REFUND_TOO_EARLY(0x3): too early", ErrEscrowRefundTooEarly},
+	}
+	for _, tc := range cases {
+		service := newFakeClientService(t, &fakeAptosClient{vmStatus: tc.vmStatus})
+		if _, err := service.RefundEscrow(testSignerKey, testOwnerA, 0); !errors.Is(err, tc.want) {
+			t.Errorf("refund with %q = %v, want %v", tc.vmStatus, err, tc.want)
+		}
+	}
+
+	service := newFakeClientService(t, &fakeAptosClient{vmStatus: cases[0].vmStatus})
+	if _, err := service.ReleaseEscrow(testSignerKey, 0, testOwnerB, 0); !errors.Is(err, ErrEscrowNotFound) {
+		t.Errorf("release without a deposit = %v, want ErrEscrowNotFound", err)
+	}
+
+	// Aborts of other modules, such as a grant failing inside the release, are left as they are
+	service = newFakeClientService(t, &fakeAptosClient{vmStatus: "Move abort in 0xcafe1::AccessControl: 0x1"})
+	_, err := service.ReleaseEscrow(testSignerKey, 0, testOwnerB, 0)
+	var txErr *TransactionError
+	if !errors.As(err, &txErr) || errors.Is(err, ErrEscrowNotFound) || txErr.Module != "AccessControl" {
+		t.Errorf("release aborting in AccessControl = %v, want the TransactionError", err)
+	}
+}
+
+func TestGetEscrowBalance(t *testing.T) {
+	client := &fakeAptosClient{views: map[string][]any{"Escrow::balance": {"2500"}}}
+	service := newFakeClientService(t, client)
+
+	balance, err := service.GetEscrowBalance(testOwnerA, 4, testOwnerB)
+	if err != nil || balance != 2500 {
+		t.Fatalf("GetEscrowBalance = %d, %v, want 2500", balance, err)
+	}
+	want := encodedArgs(t, mustParseAddress(t, testOwnerA), uint64(4), mustParseAddress(t, testOwnerB))
+	if !reflect.DeepEqual(client.viewed[0].Args, want) {
+		t.Errorf("balance arguments = %x, want owner, dataset_id, requester", client.viewed[0].Args)
+	}
+
+	client.views["Escrow::balance"] = []any{"not a number"}
+	if _, err := service.GetEscrowBalance(testOwnerA, 4, testOwnerB); err == nil {
+		t.Error("a malformed view result was accepted")
+	}
+}
+
+func TestMockEscrowRefundWaitsForTheTimeout(t *testing.T) {
+	chain, err := NewMockAptosService("")
+	if err != nil {
+		t.Fatalf("NewMockAptosService: %v", err)
+	}
+	requester, _ := AddressFromPrivateKey(testSignerKey)
+
+	if _, err := chain.DepositEscrow(testSignerKey, testOwnerA, 0, 300); err != nil {
+		t.Fatalf("DepositEscrow: %v", err)
+	}
+	if _, err := chain.RefundEscrow(testSignerKey, testOwnerA, 0); !errors.Is(err, ErrEscrowRefundTooEarly) {
+		t.Errorf("refund right after the deposit = %v, want ErrEscrowRefundTooEarly", err)
+	}
+
+	// Once the owner has had the whole timeout, the requester gets the deposit back
+	chain.state.Accounts[requester].EscrowSince[mockEscrowKey(mustAddress(testOwnerA), 0)] -= int64(EscrowRefundTimeout.Seconds())
+	if _, err := chain.RefundEscrow(testSignerKey, testOwnerA, 0); err != nil {
+		t.Errorf("refund after the timeout: %v", err)
+	}
+	if balance, _ := chain.GetEscrowBalance(testOwnerA, 0, requester); balance != 0 {
+		t.Errorf("balance after the refund = %d, want 0", balance)
+	}
+}
+
+func TestEscrowReleaseIsReadAsAGrant(t *testing.T) {
+	modules, err := newIndexedModules(testModuleAddr, testModuleAddr)
+	if err != nil {
+		t.Fatalf("newIndexedModules: %v", err)
+	}
+	var tx scannedTransaction
+	tx.Type, tx.Sender, tx.Success = "user_transaction", testOwnerA, true
+	tx.Payload.Type = "entry_function_payload"
+	tx.Payload.Function = testModuleAddr + "::Escrow::release"
+	tx.Payload.Arguments = []interface{}{"7", testOwnerB, "1900000000"}
+
+	indexed := modules.extract(tx, 1)
+	if len(indexed) != 1 || indexed[0].Kind != store.EventAccessGranted || indexed[0].DatasetID != 7 ||
+		indexed[0].Requester != mustAddress(testOwnerB) || indexed[0].ExpiresAt != 1900000000 {
+		t.Errorf("indexed %+v, want a grant of dataset 7 to %s", indexed, testOwnerB)
+	}
+
+	receipt := modules.receiptEvents(tx)
+	if len(receipt) != 1 || receipt[0].AccessGranted == nil || receipt[0].AccessGranted.DatasetID != 7 {
+		t.Errorf("receipt events %+v, want the grant", receipt)
+	}
+}
@@ -0,0 +1,393 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/internal/store"
+	"github.com/datax/backend/models"
+)
+
+// Read sources selected by SOURCE
+const (
+	ReadSourceRemote = "remote" // Fullnode and public indexer at request time
+	ReadSourceLocal  = "local"  // Local SQLite event index, remote while it lags
+)
+
+// indexRetryDelay is how long the event indexer waits after a failed poll
+const indexRetryDelay = 30 * time.Second
+
+// EventIndexReporter is implemented by services that keep a local event index
+type EventIndexReporter interface {
+	EventIndexStatus() models.EventIndexStatus
+}
+
+// SetEventStore makes the service index DataX events into a local store, which serves
+// marketplace, vault and access reads when SOURCE=local
+func (s *AptosServiceImpl) SetEventStore(eventStore *store.Store) {
+	s.eventStore = eventStore
+}
+
+// RunEventIndexer tails the fullnode into the event store until ctx is cancelled. While
+// behind it reads batch after batch; once caught up it polls every INDEX_POLL_INTERVAL
+func (s *AptosServiceImpl) RunEventIndexer(ctx context.Context) {
+	if s.eventStore == nil {
+		return
+	}
+	pollInterval := time.Duration(s.cfg.IndexPollInterval) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = 5 * time.Second
+	}
+
+	for {
+		caughtUp, err := s.indexNextBatch()
+		var wait time.Duration
+		switch {
+		case err != nil:
+			fmt.Printf("WARNING: Event indexer poll failed, retrying in %v: %v\n", indexRetryDelay, err)
+			wait = indexRetryDelay
+		case caughtUp:
+			wait = pollInterval
+		}
+
+		if wait == 0 {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// EventIndexStatus reports how far the event index has read and whether it serves reads
+func (s *AptosServiceImpl) EventIndexStatus() models.EventIndexStatus {
+	status := models.EventIndexStatus{Source: s.cfg.ReadSource}
+
+	s.indexMu.Lock()
+	checkpoint := s.indexCheckpoint
+	s.indexMu.Unlock()
+	if checkpoint == nil {
+		return status
+	}
+
+	status.Version = checkpoint.Version
+	status.LedgerVersion = checkpoint.LedgerVersion
+	if checkpoint.LedgerVersion > checkpoint.Version {
+		status.Lag = checkpoint.LedgerVersion - checkpoint.Version
+	}
+	status.UpdatedAt = checkpoint.UpdatedAt.Format(time.RFC3339)
+
+	// An indexer that stopped polling is behind by an unknown amount
+	staleAfter := 3 * time.Duration(s.cfg.IndexPollInterval) * time.Second
+	if staleAfter < 30*time.Second {
+		staleAfter = 30 * time.Second
+	}
+	status.Ready = status.Lag <= uint64(s.cfg.IndexMaxLag) && time.Since(checkpoint.UpdatedAt) < staleAfter
+	return status
+}
+
+// localIndex returns the event store when SOURCE=local and the index is close enough to
+// the ledger to answer reads; nil means the remote paths should be used
+func (s *AptosServiceImpl) localIndex() *store.Store {
+	if s.eventStore == nil || s.cfg.ReadSource != ReadSourceLocal {
+		return nil
+	}
+	if !s.EventIndexStatus().Ready {
+		return nil
+	}
+	return s.eventStore
+}
+
+// indexNextBatch indexes the next page of transactions after the checkpoint and reports
+// whether the index has reached the ledger tip
+func (s *AptosServiceImpl) indexNextBatch() (bool, error) {
+	s.indexMu.Lock()
+	checkpoint := s.indexCheckpoint
+	s.indexMu.Unlock()
+
+	if checkpoint == nil {
+		stored, err := s.eventStore.LoadCheckpoint()
+		if err != nil {
+			return false, err
+		}
+		checkpoint = stored
+		if checkpoint != nil {
+			fmt.Printf("DEBUG: Event index resuming after version %d\n", checkpoint.Version)
+		}
+	}
+
+	ledgerVersion, err := s.getLedgerVersion()
+	if err != nil {
+		return false, err
+	}
+
+	var next uint64
+	if checkpoint != nil {
+		next = checkpoint.Version + 1
+	} else {
+		next, err = s.indexStartVersion()
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("DEBUG: Event index starting at version %d (ledger at %d)\n", next, ledgerVersion)
+	}
+
+	if next > ledgerVersion {
+		// Nothing new; record the poll so the index still counts as current
+		return true, s.commitIndexBatch(nil, next-1, ledgerVersion)
+	}
+
+	batchSize := s.cfg.IndexBatchSize
+	if batchSize <= 0 || batchSize > 100 {
+		batchSize = 100
+	}
+	transactions, err := s.getTransactionsPage(next, batchSize)
+	if err != nil {
+		return false, err
+	}
+	if len(transactions) == 0 {
+		return true, s.commitIndexBatch(nil, next-1, ledgerVersion)
+	}
+
+	modules, err := newIndexedModules(s.cfg.DataXModuleAddr, s.cfg.NetworkModuleAddr)
+	if err != nil {
+		return false, err
+	}
+
+	last := next - 1
+	events := make([]store.Event, 0)
+	for _, tx := range transactions {
+		version, err := strconv.ParseUint(tx.Version, 10, 64)
+		if err != nil {
+			continue
+		}
+		events = append(events, modules.extract(tx, version)...)
+		if version > last {
+			last = version
+		}
+	}
+
+	if len(events) > 0 {
+		fmt.Printf("DEBUG: Event index found %d events in versions %d-%d\n", len(events), next, last)
+	}
+	if err := s.commitIndexBatch(events, last, ledgerVersion); err != nil {
+		return false, err
+	}
+	return last >= ledgerVersion, nil
+}
+
+// commitIndexBatch writes a batch and its checkpoint, then logs when the index starts or
+// stops being current enough to serve reads
+func (s *AptosServiceImpl) commitIndexBatch(events []store.Event, version uint64, ledgerVersion uint64) error {
+	wasReady := s.EventIndexStatus().Ready
+	if err := s.eventStore.Apply(events, version, ledgerVersion); err != nil {
+		return err
+	}
+
+	s.indexMu.Lock()
+	s.indexCheckpoint = &store.Checkpoint{Version: version, LedgerVersion: ledgerVersion, UpdatedAt: time.Now().UTC()}
+	s.indexMu.Unlock()
+
+	status := s.EventIndexStatus()
+	if status.Ready && !wasReady {
+		fmt.Printf("DEBUG: Event index caught up at version %d\n", version)
+	} else if !status.Ready && wasReady {
+		fmt.Printf("WARNING: Event index fell %d versions behind, reads use the remote paths until it catches up\n", status.Lag)
+	}
+	return nil
+}
+
+// indexStartVersion is where indexing begins without a checkpoint: INDEX_START_VERSION, or
+// the first transaction sent by the module accounts, which can't be later than publishing
+func (s *AptosServiceImpl) indexStartVersion() (uint64, error) {
+	if s.cfg.IndexStartVersion > 0 {
+		return uint64(s.cfg.IndexStartVersion), nil
+	}
+
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
+	var start uint64
+	for _, module := range []string{s.cfg.DataXModuleAddr, s.cfg.NetworkModuleAddr} {
+		moduleAddr, err := parseAddress(module)
+		if err != nil {
+			return 0, err
+		}
+		body, status, err := s.getWithRetry(fmt.Sprintf("%s/v1/accounts/%s/transactions?start=0&limit=1", nodeURL, moduleAddr.String()), "module transactions")
+		if err != nil {
+			return 0, err
+		}
+		var transactions []struct {
+			Version string `json:"version"`
+		}
+		if status == http.StatusNotFound || json.Unmarshal(body, &transactions) != nil || len(transactions) == 0 {
+			return 0, fmt.Errorf("no transactions found for module account %s; set INDEX_START_VERSION", moduleAddr.String())
+		}
+		version, err := strconv.ParseUint(transactions[0].Version, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid version %q for module account %s", transactions[0].Version, moduleAddr.String())
+		}
+		if start == 0 || version < start {
+			start = version
+		}
+	}
+	return start, nil
+}
+
+// indexedModules holds the normalized addresses of the DataX modules being indexed
+type indexedModules struct {
+	datax   string // data_registry
+	network string // AccessControl, UserVault
+}
+
+func newIndexedModules(dataxAddress string, networkAddress string) (indexedModules, error) {
+	datax, err := parseAddress(dataxAddress)
+	if err != nil {
+		return indexedModules{}, err
+	}
+	network, err := parseAddress(networkAddress)
+	if err != nil {
+		return indexedModules{}, err
+	}
+	return indexedModules{datax: datax.String(), network: network.String()}, nil
+}
+
+// extract returns the index events of a committed transaction. Dataset submissions,
+// deletions and reactivations come from the events data_registry emits; AccessControl and UserVault emit
+// none, so grants, revocations and direct vault edits are read from the entry function
+// call itself (only when the transaction succeeded)
+func (m indexedModules) extract(tx scannedTransaction, version uint64) []store.Event {
+	if tx.Type != "user_transaction" || !tx.Success {
+		return nil
+	}
+
+	events := make([]store.Event, 0)
+	add := func(event store.Event) {
+		event.Version = version
+		event.Index = len(events)
+		events = append(events, event)
+	}
+
+	for _, ev := range tx.Events {
+		address, module, name, ok := splitMoveName(ev.Type)
+		if !ok || address != m.datax || module != "data_registry" {
+			continue
+		}
+		var data struct {
+			User      string `json:"user"`
+			DatasetID string `json:"dataset_id"`
+			DataHash  string `json:"data_hash"`
+			Metadata  string `json:"metadata"`
+		}
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			continue
+		}
+		owner, err := parseAddress(data.User)
+		if err != nil {
+			continue
+		}
+		datasetID, err := strconv.ParseUint(data.DatasetID, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch name {
+		case "DataSubmitted":
+			timestamp, _ := strconv.ParseUint(tx.Timestamp, 10, 64)
+			add(store.Event{
+				Kind:      store.EventDataSubmitted,
+				Owner:     owner.String(),
+				DatasetID: datasetID,
+				DataHash:  data.DataHash,
+				Metadata:  data.Metadata,
+				CreatedAt: timestamp / 1_000_000,
+			})
+		case "DataDeleted":
+			add(store.Event{Kind: store.EventDatasetDeleted, Owner: owner.String(), DatasetID: datasetID})
+		case "DataReactivated":
+			add(store.Event{Kind: store.EventDatasetReactivated, Owner: owner.String(), DatasetID: datasetID})
+		}
+	}
+
+	if tx.Payload.Type != "entry_function_payload" {
+		return events
+	}
+	address, module, function, ok := splitMoveName(tx.Payload.Function)
+	if !ok || address != m.network {
+		return events
+	}
+	sender, err := parseAddress(tx.Sender)
+	if err != nil {
+		return events
+	}
+	args := tx.Payload.Arguments
+	datasetID, ok := uintArgument(args, 0)
+	if !ok {
+		return events
+	}
+
+	switch module + "::" + function {
+	case "AccessControl::grant_access", "Escrow::release": // release takes grant_access's arguments and grants in the same transaction
+		requester, ok := addressArgument(args, 1)
+		expiresAt, ok2 := uintArgument(args, 2)
+		if ok && ok2 {
+			add(store.Event{Kind: store.EventAccessGranted, Owner: sender.String(), DatasetID: datasetID, Requester: requester, ExpiresAt: expiresAt})
+		}
+	case "AccessControl::revoke_access":
+		if requester, ok := addressArgument(args, 1); ok {
+			add(store.Event{Kind: store.EventAccessRevoked, Owner: sender.String(), DatasetID: datasetID, Requester: requester})
+		}
+	case "UserVault::add_dataset":
+		add(store.Event{Kind: store.EventVaultDatasetAdded, Owner: sender.String(), DatasetID: datasetID})
+	case "UserVault::remove_dataset":
+		add(store.Event{Kind: store.EventVaultDatasetRemoved, Owner: sender.String(), DatasetID: datasetID})
+	}
+	return events
+}
+
+// splitMoveName splits "0xaddr::module::name" into its parts, normalizing the address.
+// Generic type arguments are not expected on DataX names and make it fail
+func splitMoveName(name string) (string, string, string, bool) {
+	parts := strings.Split(name, "::")
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	address, err := parseAddress(parts[0])
+	if err != nil {
+		return "", "", "", false
+	}
+	return address.String(), parts[1], parts[2], true
+}
+
+// uintArgument reads a u64 entry function argument, which the REST API renders as a string
+func uintArgument(args []interface{}, i int) (uint64, bool) {
+	if i >= len(args) {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(fmt.Sprint(args[i]), 10, 64)
+	return value, err == nil
+}
+
+// addressArgument reads an address entry function argument in normalized form
+func addressArgument(args []interface{}, i int) (string, bool) {
+	if i >= len(args) {
+		return "", false
+	}
+	text, ok := args[i].(string)
+	if !ok {
+		return "", false
+	}
+	address, err := parseAddress(text)
+	if err != nil {
+		return "", false
+	}
+	return address.String(), true
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"filippo.io/edwards25519"
+	"github.com/datax/backend/models"
+)
+
+// A grantee can't be handed the master key, so when access is granted the dataset's data key
+// is wrapped for the requester's own X25519 key instead (ECIES): an ephemeral X25519 key
+// agrees a secret with the requester's key, HKDF-SHA256 turns it into an AES-256-GCM key,
+// and that key seals the data key. Only the requester's private key can unwrap it
+
+const granteeKeyAlgorithm = "X25519-HKDF-SHA256-AES-256-GCM"
+
+// granteeKeyInfo is the HKDF info string, binding derived keys to their purpose
+const granteeKeyInfo = "datax-grantee-dek-v1"
+
+// ErrGranteeKeyNotFound is returned when no wrapped data key is stored for a grant
+var ErrGranteeKeyNotFound = errors.New("no wrapped data key for this grant")
+
+// GranteeKeyStore is implemented by backends that can keep data keys wrapped for grantees,
+// one {owner}/grants/{dataset_id}_{requester}.json object per grant
+type GranteeKeyStore interface {
+	StoreGranteeKey(owner string, key models.GranteeKey) error
+	RetrieveGranteeKey(owner string, datasetID uint64, requester string) (*models.GranteeKey, error) // Errors wrap ErrGranteeKeyNotFound when none is stored
+	DeleteGranteeKey(owner string, datasetID uint64, requester string) error                         // Deleting a key that isn't stored is not an error
+}
+
+var (
+	_ GranteeKeyStore = (*SupabaseServiceImpl)(nil)
+	_ GranteeKeyStore = (*ShelbyServiceImpl)(nil)
+	_ GranteeKeyStore = (*LocalStorageService)(nil)
+	_ GranteeKeyStore = (*IPFSStorageServiceImpl)(nil)
+)
+
+// granteeKeyObject is a grant's wrapped key object, relative to the owner's directory
+func granteeKeyObject(datasetID uint64, requester string) string {
+	return fmt.Sprintf("grants/%d_%s.json", datasetID, normalizeGrantee(requester))
+}
+
+// normalizeGrantee lowercases a requester address so grants and lookups agree on the key
+func normalizeGrantee(requester string) string {
+	return strings.ToLower(strings.TrimSpace(requester))
+}
+
+// ParseRecipientKey decodes a grantee's public key given as hex. keyType is "x25519", or
+// "ed25519" (the default, an Aptos account key), which is converted to its X25519 form
+func ParseRecipientKey(keyHex string, keyType string) (*ecdh.PublicKey, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(keyHex), "0x"))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("public key must be 32 bytes of hex")
+	}
+
+	switch keyType {
+	case "", "ed25519":
+		point, err := new(edwards25519.Point).SetBytes(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ed25519 public key: %w", err)
+		}
+		raw = point.BytesMontgomery()
+	case "x25519":
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid X25519 public key: %w", err)
+	}
+	return key, nil
+}
+
+// WrapDataKeyForGrantee unwraps the data key in a server-encrypted blob's metadata and wraps
+// it for recipient. The result carries everything the grantee needs to decrypt the blob
+// except their private key
+func WrapDataKeyForGrantee(metadata []byte, recipient *ecdh.PublicKey) (models.GranteeKey, error) {
+	envelope, err := parseEnvelope(metadata)
+	if err != nil {
+		return models.GranteeKey{}, err
+	}
+	dek, err := unwrapDataKey(envelope)
+	if err != nil {
+		return models.GranteeKey{}, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return models.GranteeKey{}, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return models.GranteeKey{}, fmt.Errorf("key agreement failed: %w", err)
+	}
+	kek, err := granteeKEK(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return models.GranteeKey{}, err
+	}
+	nonce, wrapped, err := aeadSeal(AlgorithmAES256GCM, kek, dek, nil)
+	if err != nil {
+		return models.GranteeKey{}, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return models.GranteeKey{
+		Algorithm:          granteeKeyAlgorithm,
+		RecipientPublicKey: hex.EncodeToString(recipient.Bytes()),
+		EphemeralPublicKey: hex.EncodeToString(ephemeral.PublicKey().Bytes()),
+		Nonce:              base64.StdEncoding.EncodeToString(nonce),
+		WrappedKey:         base64.StdEncoding.EncodeToString(wrapped),
+		DataAlgorithm:      envelope.Algorithm,
+		DataNonce:          envelope.Nonce,
+		CreatedAt:          time.Now().Unix(),
+	}, nil
+}
+
+// OpenGranteeKey is the grantee's side of WrapDataKeyForGrantee: it recovers the data key
+// with the private key matching RecipientPublicKey
+func OpenGranteeKey(key models.GranteeKey, private *ecdh.PrivateKey) ([]byte, error) {
+	if key.Algorithm != granteeKeyAlgorithm {
+		return nil, fmt.Errorf("unsupported grantee key algorithm %q", key.Algorithm)
+	}
+	ephemeralRaw, err := hex.DecodeString(key.EphemeralPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral public key: %w", err)
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralRaw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral public key: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(key.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(key.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key: %w", err)
+	}
+
+	shared, err := private.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("key agreement failed: %w", err)
+	}
+	kek, err := granteeKEK(shared, ephemeralRaw, private.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	dek, err := aeadOpen(AlgorithmAES256GCM, kek, nonce, wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dek, nil
+}
+
+// granteeKEK derives the key-encryption key from an X25519 shared secret, salted with the
+// ephemeral public key followed by the recipient's
+func granteeKEK(shared []byte, ephemeralPublic []byte, recipientPublic []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeralPublic...), recipientPublic...)
+	return hkdf.Key(sha256.New, shared, salt, granteeKeyInfo, 32)
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/datax/backend/models"
+)
+
+const granteeTestCSV = "id,name\n1,alpha\n2,beta\n"
+
+// openAsGrantee is what a grantee does with a wrapped key: recover the data key with their
+// private key, then decrypt the blob with it
+func openAsGrantee(t *testing.T, key models.GranteeKey, private *ecdh.PrivateKey, ciphertext []byte, metadata []byte) string {
+	t.Helper()
+	dek, err := OpenGranteeKey(key, private)
+	if err != nil {
+		t.Fatalf("OpenGranteeKey: %v", err)
+	}
+	plaintext, err := OpenCSVWithKey(ciphertext, metadata, dek)
+	if err != nil {
+		t.Fatalf("OpenCSVWithKey with the unwrapped key: %v", err)
+	}
+	return string(plaintext)
+}
+
+func TestGranteeKeyUnwrapsWithTheGranteesKeyOnly(t *testing.T) {
+	withMasterKey(t, AlgorithmAES256GCM)
+	ciphertext, metadata := sealForTest(t, []byte(granteeTestCSV))
+
+	grantee, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	recipient, err := ParseRecipientKey(hex.EncodeToString(grantee.PublicKey().Bytes()), "x25519")
+	if err != nil {
+		t.Fatalf("ParseRecipientKey: %v", err)
+	}
+	key, err := WrapDataKeyForGrantee(metadata, recipient)
+	if err != nil {
+		t.Fatalf("WrapDataKeyForGrantee: %v", err)
+	}
+	if key.RecipientPublicKey != hex.EncodeToString(grantee.PublicKey().Bytes()) || key.Algorithm != granteeKeyAlgorithm {
+		t.Errorf("wrapped key = %+v, want it addressed to the grantee", key)
+	}
+
+	if plaintext := openAsGrantee(t, key, grantee, ciphertext, metadata); plaintext != granteeTestCSV {
+		t.Errorf("grantee decrypted %q, want %q", plaintext, granteeTestCSV)
+	}
+
+	// Anyone else's key, or a tampered wrapping, unwraps nothing
+	stranger, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	if _, err := OpenGranteeKey(key, stranger); err == nil {
+		t.Error("OpenGranteeKey with another private key succeeded")
+	}
+	tampered := key
+	wrapped, _ := base64.StdEncoding.DecodeString(key.WrappedKey)
+	wrapped[0] ^= 1
+	tampered.WrappedKey = base64.StdEncoding.EncodeToString(wrapped)
+	if _, err := OpenGranteeKey(tampered, grantee); err == nil {
+		t.Error("OpenGranteeKey of a tampered wrapped key succeeded")
+	}
+	substituted := key
+	substituted.EphemeralPublicKey = hex.EncodeToString(stranger.PublicKey().Bytes())
+	if _, err := OpenGranteeKey(substituted, grantee); err == nil {
+		t.Error("OpenGranteeKey with a substituted ephemeral key succeeded")
+	}
+
+	// Every wrapping uses a fresh ephemeral key
+	again, _ := WrapDataKeyForGrantee(metadata, recipient)
+	if again.EphemeralPublicKey == key.EphemeralPublicKey || again.WrappedKey == key.WrappedKey {
+		t.Error("two wrappings for the same grantee share their ephemeral key")
+	}
+}
+
+func TestGranteeKeyForAnAptosAccountKey(t *testing.T) {
+	withMasterKey(t, AlgorithmXChaCha20Poly1305)
+	ciphertext, metadata := sealForTest(t, []byte(granteeTestCSV))
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	// An Ed25519 key is used as the default key type, with 0x in front as wallets show it
+	recipient, err := ParseRecipientKey("0x"+hex.EncodeToString(public), "")
+	if err != nil {
+		t.Fatalf("ParseRecipientKey: %v", err)
+	}
+	key, err := WrapDataKeyForGrantee(metadata, recipient)
+	if err != nil {
+		t.Fatalf("WrapDataKeyForGrantee: %v", err)
+	}
+
+	// The account's X25519 private key is the clamped first half of SHA-512 of its seed
+	digest := sha512.Sum512(private.Seed())
+	grantee, err := ecdh.X25519().NewPrivateKey(digest[:32])
+	if err != nil {
+		t.Fatalf("NewPrivateKey: %v", err)
+	}
+	if plaintext := openAsGrantee(t, key, grantee, ciphertext, metadata); plaintext != granteeTestCSV {
+		t.Errorf("grantee decrypted %q, want %q", plaintext, granteeTestCSV)
+	}
+}
+
+func TestParseRecipientKeyRejectsBadKeys(t *testing.T) {
+	cases := []struct {
+		name, key, keyType string
+	}{
+		{"not hex", "zz" + strings.Repeat("00", 31), "x25519"},
+		{"too short", strings.Repeat("01", 31), "x25519"},
+		{"too long", strings.Repeat("01", 33), "ed25519"},
+		{"not an Ed25519 point", "02" + strings.Repeat("00", 31), "ed25519"},
+		{"unknown type", strings.Repeat("01", 32), "rsa"},
+	}
+	for _, tc := range cases {
+		if _, err := ParseRecipientKey(tc.key, tc.keyType); err == nil {
+			t.Errorf("%s: ParseRecipientKey succeeded", tc.name)
+		}
+	}
+}
+
+func TestWrapDataKeyForGranteeNeedsAServerEnvelope(t *testing.T) {
+	withMasterKey(t, AlgorithmAES256GCM)
+	grantee, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	if _, err := WrapDataKeyForGrantee([]byte(`{"algorithm":"AES-256-GCM","mode":"client"}`), grantee.PublicKey()); err == nil {
+		t.Error("WrapDataKeyForGrantee of client-encrypted metadata succeeded")
+	}
+}
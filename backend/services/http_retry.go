@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrChainUnavailable is returned when the fullnode can't be reached or keeps failing after
+// every retry, so the answer is unknown rather than negative
+var ErrChainUnavailable = errors.New("fullnode unavailable")
+
+// getWithRetry performs a GET against the fullnode REST API using the same retry
+// policy as the resource reads: up to 3 attempts with exponential backoff, a longer
+// wait on 429, and no retry on other 4xx responses.
+// A 404 is not treated as an error - it is returned as (nil, http.StatusNotFound, nil)
+// so callers can decide whether "not found" means empty or missing.
+func (s *AptosServiceImpl) getWithRetry(requestURL string, label string) ([]byte, int, error) {
+	return s.getWithRetryContext(context.Background(), requestURL, label)
+}
+
+// getWithRetryContext is getWithRetry for a caller's context: requests and the waits between
+// them stop as soon as ctx ends, returning its error
+func (s *AptosServiceImpl) getWithRetryContext(ctx context.Context, requestURL string, label string) ([]byte, int, error) {
+	var lastErr error
+
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
+			fmt.Printf("DEBUG: Retrying %s query (attempt %d/3) after %v\n", label, attempt+1, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, 0, ctx.Err()
+			}
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		req, err := http.NewRequestWithContext(reqCtx, "GET", requestURL, nil)
+		if err != nil {
+			cancel()
+			lastErr = err
+			continue
+		}
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			cancel()
+			lastErr = fmt.Errorf("%s request failed: %w", label, err)
+			fmt.Printf("DEBUG: %s request error (attempt %d): %v\n", label, attempt+1, err)
+			continue
+		}
+
+		// Read response body before checking status
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+
+		if err != nil {
+			lastErr = fmt.Errorf("failed to read response body: %w", err)
+			continue
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, http.StatusNotFound, nil
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			lastErr = fmt.Errorf("rate limited (429)")
+			fmt.Printf("DEBUG: %s rate limited (429) on attempt %d, will retry\n", label, attempt+1)
+			// Wait longer for rate limits
+			if attempt < 2 {
+				select {
+				case <-time.After(5 * time.Second):
+				case <-ctx.Done():
+					return nil, 0, ctx.Err()
+				}
+			}
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+			fmt.Printf("DEBUG: %s returned status %d (attempt %d). Body: %s\n", label, resp.StatusCode, attempt+1, string(bodyBytes))
+			// Don't retry on client errors (4xx) except 429
+			if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+				return nil, resp.StatusCode, lastErr
+			}
+			continue
+		}
+
+		return bodyBytes, http.StatusOK, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w: %s failed after retries: %w", ErrChainUnavailable, label, lastErr)
+}
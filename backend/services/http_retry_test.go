@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// vaultPath is the REST path of an account's UserVault resource
+func vaultPath(account string) string {
+	return "/v1/accounts/" + account + "/resource/" + testModuleAddr + "::UserVault::Vault"
+}
+
+func TestGetUserVaultRetriesFailedReads(t *testing.T) {
+	node := newFakeNode(t)
+	attempts := 0
+	node.handle(vaultPath(testOwnerA), func(w http.ResponseWriter, r *http.Request) {
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		writeTestJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"datasets": []string{"3", "7"}}})
+	})
+	service := newTestService(t, node, nil)
+
+	datasetIDs, err := service.GetUserVault(context.Background(), testOwnerA)
+	if err != nil {
+		t.Fatalf("GetUserVault: %v", err)
+	}
+	if !reflect.DeepEqual(datasetIDs, []uint64{3, 7}) {
+		t.Errorf("vault = %v, want [3 7]", datasetIDs)
+	}
+	if got := node.count(vaultPath(testOwnerA)); got != 2 {
+		t.Errorf("vault read %d times, want 2", got)
+	}
+}
+
+func TestGetUserVaultReadsAMissingVaultAsEmpty(t *testing.T) {
+	node := newFakeNode(t)
+	service := newTestService(t, node, nil)
+
+	datasetIDs, err := service.GetUserVault(context.Background(), testOwnerA)
+	if err != nil || datasetIDs == nil || len(datasetIDs) != 0 {
+		t.Errorf("missing vault = %v, %v, want an empty vault", datasetIDs, err)
+	}
+	if got := node.count(vaultPath(testOwnerA)); got != 1 {
+		t.Errorf("vault read %d times, want 1 (404 is not retried)", got)
+	}
+}
+
+func TestGetUserVaultStopsWithTheContext(t *testing.T) {
+	node := newFakeNode(t)
+	node.handle(vaultPath(testOwnerA), func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	service := newTestService(t, node, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := service.GetUserVault(ctx, testOwnerA)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hung node = %v, want the context's deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetUserVault returned after %v, want it to stop at the 100ms deadline", elapsed)
+	}
+}
+
+func TestIsAccountInitializedOnlyTrustsA404(t *testing.T) {
+	node := newFakeNode(t)
+	node.handleJSON(vaultPath(testOwnerA), map[string]any{"data": map[string]any{"datasets": []string{}}})
+	node.handle(vaultPath(testOwnerC), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	service := newTestService(t, node, nil)
+
+	if initialized, err := service.IsAccountInitialized(testOwnerA); err != nil || !initialized {
+		t.Errorf("vault found = %v, %v, want initialized", initialized, err)
+	}
+	if initialized, err := service.IsAccountInitialized(testOwnerB); err != nil || initialized {
+		t.Errorf("vault missing = %v, %v, want not initialized", initialized, err)
+	}
+	_, err := service.IsAccountInitialized(testOwnerC)
+	if err == nil || errors.Is(err, ErrChainUnavailable) {
+		t.Errorf("node refusing = %v, want an error other than ErrChainUnavailable", err)
+	}
+}
+
+func TestIsAccountInitializedFailsWhenTheNodeIsDown(t *testing.T) {
+	node := newFakeNode(t)
+	service := newTestService(t, node, nil)
+	node.Close()
+
+	initialized, err := service.IsAccountInitialized(testOwnerA)
+	if !errors.Is(err, ErrChainUnavailable) {
+		t.Errorf("node down = %v, %v, want ErrChainUnavailable", initialized, err)
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/internal/db"
+	"github.com/datax/backend/models"
+)
+
+// idempotencyStateConflicts is how many times a key write that lost to another instance is retried
+const idempotencyStateConflicts = 3
+
+// ErrIdempotencyKeyLost is returned when a request's key was taken over before it completed,
+// because it ran past its reservation
+var ErrIdempotencyKeyLost = errors.New("idempotency key is no longer held by this request")
+
+// IdempotencyStore keeps Idempotency-Key records so a retried write replays the first
+// response instead of running again. Keys are opaque strings chosen by the caller
+type IdempotencyStore interface {
+	// Reserve claims record.Key until record.ExpiresAt for a request that is starting. It
+	// returns record and true when the key was free or expired, and the live record holding
+	// the key and false otherwise
+	Reserve(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error)
+	// Complete stores the response of the request holding the key, which is then kept until
+	// record.ExpiresAt. Returns ErrIdempotencyKeyLost when another request holds the key
+	Complete(record models.IdempotencyRecord) error
+	// Release frees the key of a request that didn't complete, so a retry runs again
+	Release(record models.IdempotencyRecord) error
+}
+
+// sqlIdempotencyStore keeps idempotency keys in the DATABASE_URL database
+type sqlIdempotencyStore struct {
+	db *db.DB
+}
+
+// NewSQLIdempotencyStore returns a store backed by the database
+func NewSQLIdempotencyStore(database *db.DB) IdempotencyStore {
+	return &sqlIdempotencyStore{db: database}
+}
+
+func (s *sqlIdempotencyStore) Reserve(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	for range idempotencyStateConflicts {
+		existing, reserved, err := s.db.ReserveIdempotencyKey(record)
+		if !errors.Is(err, db.ErrConflict) {
+			return existing, reserved, err
+		}
+	}
+	return models.IdempotencyRecord{}, false, ErrStateConflict
+}
+
+func (s *sqlIdempotencyStore) Complete(record models.IdempotencyRecord) error {
+	err := s.db.CompleteIdempotencyKey(record)
+	if errors.Is(err, db.ErrNotFound) {
+		return ErrIdempotencyKeyLost
+	}
+	return err
+}
+
+func (s *sqlIdempotencyStore) Release(record models.IdempotencyRecord) error {
+	return s.db.ReleaseIdempotencyKey(record)
+}
+
+// stateIdempotencyStore keeps one system/idempotency/{key}.json document per key in the
+// state store, or keeps keys in memory when the storage backend has no state store.
+// Documents aren't deleted when they expire; an expired one is overwritten by the next
+// request reusing its key
+type stateIdempotencyStore struct {
+	store  StateStore // nil keeps keys in memory, lost on restart
+	mu     sync.Mutex
+	memory map[string]models.IdempotencyRecord
+}
+
+// NewStateIdempotencyStore returns a store backed by store, which may be nil
+func NewStateIdempotencyStore(store StateStore) IdempotencyStore {
+	return &stateIdempotencyStore{store: store, memory: make(map[string]models.IdempotencyRecord)}
+}
+
+func idempotencyStateKey(key string) string {
+	return "system/idempotency/" + key + ".json"
+}
+
+func (s *stateIdempotencyStore) Reserve(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	now := time.Now().Unix()
+	if s.store == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for key, existing := range s.memory {
+			if existing.ExpiresAt <= now {
+				delete(s.memory, key)
+			}
+		}
+		if existing, ok := s.memory[record.Key]; ok {
+			return existing, false, nil
+		}
+		s.memory[record.Key] = record
+		return record, true, nil
+	}
+
+	for range idempotencyStateConflicts {
+		var existing models.IdempotencyRecord
+		etag, err := s.store.LoadState(idempotencyStateKey(record.Key), &existing)
+		if err != nil && !errors.Is(err, ErrStateNotFound) {
+			return models.IdempotencyRecord{}, false, err
+		}
+		if err == nil && existing.ExpiresAt > now {
+			return existing, false, nil
+		}
+		_, err = s.store.SaveState(idempotencyStateKey(record.Key), record, etag)
+		if err == nil {
+			return record, true, nil
+		}
+		if !errors.Is(err, ErrStateConflict) {
+			return models.IdempotencyRecord{}, false, err
+		}
+	}
+	return models.IdempotencyRecord{}, false, ErrStateConflict
+}
+
+func (s *stateIdempotencyStore) Complete(record models.IdempotencyRecord) error {
+	return s.update(record, record)
+}
+
+func (s *stateIdempotencyStore) Release(record models.IdempotencyRecord) error {
+	released := record
+	released.ExpiresAt = 0
+	err := s.update(record, released)
+	if errors.Is(err, ErrIdempotencyKeyLost) {
+		return nil
+	}
+	return err
+}
+
+// update replaces the record of a request still holding its key with updated; an expired
+// updated record frees the key
+func (s *stateIdempotencyStore) update(record models.IdempotencyRecord, updated models.IdempotencyRecord) error {
+	holds := func(existing models.IdempotencyRecord) bool {
+		return existing.Fingerprint == record.Fingerprint && existing.StatusCode == 0 && existing.ExpiresAt > 0
+	}
+
+	if s.store == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		existing, ok := s.memory[record.Key]
+		if !ok || !holds(existing) {
+			return ErrIdempotencyKeyLost
+		}
+		if updated.ExpiresAt > 0 {
+			s.memory[record.Key] = updated
+		} else {
+			delete(s.memory, record.Key)
+		}
+		return nil
+	}
+
+	for range idempotencyStateConflicts {
+		var existing models.IdempotencyRecord
+		etag, err := s.store.LoadState(idempotencyStateKey(record.Key), &existing)
+		if errors.Is(err, ErrStateNotFound) {
+			return ErrIdempotencyKeyLost
+		}
+		if err != nil {
+			return err
+		}
+		if !holds(existing) {
+			return ErrIdempotencyKeyLost
+		}
+		_, err = s.store.SaveState(idempotencyStateKey(record.Key), updated, etag)
+		if !errors.Is(err, ErrStateConflict) {
+			return err
+		}
+	}
+	return ErrStateConflict
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/models"
+)
+
+// IndexerReporter is implemented by services that query the GraphQL indexer
+type IndexerReporter interface {
+	IndexerStatus() (models.IndexerStatus, bool) // false when no indexer is configured
+}
+
+// authTransport wraps http.Transport to add the indexer's Authorization header
+// As a RoundTripper it never modifies the caller's request; the header goes on a clone
+type authTransport struct {
+	apiKey string
+	base   http.RoundTripper
+	stats  *roundTripStats // Optional; records the latency of every round trip
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.apiKey != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	started := time.Now()
+	resp, err := base.RoundTrip(req)
+	if t.stats != nil {
+		t.stats.record(time.Since(started), resp, err)
+	}
+	return resp, err
+}
+
+// roundTripStats accumulates request counts and latency, up to the response headers
+type roundTripStats struct {
+	mu       sync.Mutex
+	requests uint64
+	failures uint64 // Transport errors and 5xx responses
+	total    time.Duration
+	last     time.Duration
+	lastAt   time.Time
+}
+
+func (s *roundTripStats) record(elapsed time.Duration, resp *http.Response, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		s.failures++
+	}
+	s.total += elapsed
+	s.last = elapsed
+	s.lastAt = time.Now()
+}
+
+func (s *roundTripStats) snapshot() models.IndexerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := models.IndexerStatus{
+		Requests:      s.requests,
+		Failures:      s.failures,
+		LastLatencyMs: s.last.Milliseconds(),
+	}
+	if s.requests > 0 {
+		status.AvgLatencyMs = (s.total / time.Duration(s.requests)).Milliseconds()
+		status.LastRequestAt = s.lastAt.UTC().Format(time.RFC3339)
+	}
+	return status
+}
+
+// IndexerStatus reports the latency of the indexer requests made since startup
+func (s *AptosServiceImpl) IndexerStatus() (models.IndexerStatus, bool) {
+	if s.indexerStats == nil {
+		return models.IndexerStatus{}, false
+	}
+	return s.indexerStats.snapshot(), true
+}
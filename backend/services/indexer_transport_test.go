@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testIndexerKey = "indexer-secret-5f1c9a"
+
+// captureStdout returns what fn prints, the debug log included
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	output := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, reader)
+		output <- buf.String()
+	}()
+
+	defer func() { os.Stdout = stdout }()
+	fn()
+	writer.Close()
+	return <-output
+}
+
+// newKeyedIndexer answers every GraphQL query with no rows, recording the Authorization
+// header of the last request
+func newKeyedIndexer(t *testing.T, authorization *string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*authorization = r.Header.Get("Authorization")
+		writeTestJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"events": []any{}}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAuthTransportAddsTheKeyToAClone(t *testing.T) {
+	var authorization string
+	indexer := newKeyedIndexer(t, &authorization)
+	transport := &authTransport{apiKey: testIndexerKey, stats: &roundTripStats{}}
+
+	request := httptest.NewRequest(http.MethodPost, indexer.URL, strings.NewReader(`{"query":"{}"}`))
+	request.RequestURI = ""
+	resp, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+
+	if authorization != "Bearer "+testIndexerKey {
+		t.Errorf("indexer got Authorization %q, want the key", authorization)
+	}
+	if got := request.Header.Get("Authorization"); got != "" {
+		t.Errorf("caller's request was given Authorization %q", got)
+	}
+	if status := transport.stats.snapshot(); status.Requests != 1 || status.Failures != 0 {
+		t.Errorf("stats = %+v, want one successful request", status)
+	}
+}
+
+func TestIndexerQueryLogsNothingAboutTheKey(t *testing.T) {
+	var authorization string
+	indexer := newKeyedIndexer(t, &authorization)
+	node := newFakeNode(t)
+	service := newTestService(t, node, func(cfg *ServiceConfig) {
+		cfg.AptosIndexerURL, cfg.AptosIndexerAPIKey = indexer.URL, testIndexerKey
+	})
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = service.executeIndexerQuery(`query { events(limit: 1) { sequence_number } }`)
+	})
+	if err != nil {
+		t.Fatalf("executeIndexerQuery: %v", err)
+	}
+	if authorization != "Bearer "+testIndexerKey {
+		t.Errorf("indexer got Authorization %q, want the key", authorization)
+	}
+	for _, leak := range []string{testIndexerKey, "key length", "Authorization"} {
+		if strings.Contains(output, leak) {
+			t.Errorf("log mentions %q:\n%s", leak, output)
+		}
+	}
+}
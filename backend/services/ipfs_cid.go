@@ -0,0 +1,103 @@
+package services
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// multihashSHA256 is the multihash code of sha2-256, the hash IPFS uses by default
+const multihashSHA256 = 0x12
+
+var errInvalidCID = errors.New("invalid CID")
+
+// CIDDataHash returns the SHA-256 digest inside a CID as a "0x" data hash, for datasets
+// that register their CID's digest on chain. Fails for strings that aren't CIDs and for
+// CIDs hashed with anything but sha2-256
+func CIDDataHash(cid string) (string, error) {
+	multihash, err := cidMultihash(cid)
+	if err != nil {
+		return "", err
+	}
+
+	code, n := binary.Uvarint(multihash)
+	if n <= 0 {
+		return "", fmt.Errorf("%w: bad multihash in %s", errInvalidCID, cid)
+	}
+	length, m := binary.Uvarint(multihash[n:])
+	if m <= 0 {
+		return "", fmt.Errorf("%w: bad multihash in %s", errInvalidCID, cid)
+	}
+	digest := multihash[n+m:]
+	if code != multihashSHA256 || length != 32 || len(digest) != 32 {
+		return "", fmt.Errorf("%w: %s is not a sha2-256 CID", errInvalidCID, cid)
+	}
+	return "0x" + hex.EncodeToString(digest), nil
+}
+
+// cidMultihash decodes a CIDv0 (base58 "Qm...") or a CIDv1 in base32, base58btc or base16
+// and returns its multihash
+func cidMultihash(cid string) ([]byte, error) {
+	cid = strings.TrimSpace(cid)
+	if len(cid) == 46 && strings.HasPrefix(cid, "Qm") {
+		return decodeBase58(cid)
+	}
+	if len(cid) < 2 {
+		return nil, fmt.Errorf("%w: %q", errInvalidCID, cid)
+	}
+
+	var raw []byte
+	var err error
+	switch cid[0] {
+	case 'b':
+		raw, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(cid[1:]))
+	case 'B':
+		raw, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(cid[1:])
+	case 'z':
+		raw, err = decodeBase58(cid[1:])
+	case 'f', 'F':
+		raw, err = hex.DecodeString(cid[1:])
+	default:
+		return nil, fmt.Errorf("%w: unsupported multibase in %q", errInvalidCID, cid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", errInvalidCID, cid, err)
+	}
+
+	version, n := binary.Uvarint(raw)
+	if n <= 0 || version != 1 {
+		return nil, fmt.Errorf("%w: %q is not a CIDv1", errInvalidCID, cid)
+	}
+	_, m := binary.Uvarint(raw[n:]) // Content codec (raw, dag-pb, ...)
+	if m <= 0 {
+		return nil, fmt.Errorf("%w: bad codec in %q", errInvalidCID, cid)
+	}
+	return raw[n+m:], nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// decodeBase58 decodes the Bitcoin base58 alphabet used by CIDv0 and base58btc
+func decodeBase58(s string) ([]byte, error) {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		digit := strings.IndexRune(base58Alphabet, r)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+
+	// Leading '1's encode leading zero bytes
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), value.Bytes()...), nil
+}
@@ -0,0 +1,696 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+// IPFSStorageServiceImpl pins blobs through a Kubo-compatible HTTP RPC API (a local node or
+// a pinning service) and names each blob by its CID, so the name itself verifies the content.
+// IPFS has no notion of owners, so each owner gets an MFS directory, {IPFS_MFS_ROOT}/{owner},
+// linking their blobs by CID next to the statistics and encryption metadata sidecars and
+// the manifest
+type IPFSStorageServiceImpl struct {
+	apiURL         string
+	authHeader     string // Authorization header value; empty sends none
+	mfsRoot        string
+	uploadTimeout  time.Duration
+	requestTimeout time.Duration
+	httpClient     *http.Client // No client timeout: every call carries its own deadline
+	manifestMu     sync.Mutex   // Serializes manifest read-modify-write
+}
+
+var _ EncryptedCSVStorage = (*IPFSStorageServiceImpl)(nil)
+
+func NewIPFSStorageService() StorageService {
+	cfg := config.AppConfig
+
+	authHeader := ""
+	if cfg.IPFSAuth != "" {
+		if strings.Contains(cfg.IPFSAuth, ":") {
+			// Pinning services such as Infura authenticate with project ID and secret
+			authHeader = "Basic " + base64.StdEncoding.EncodeToString([]byte(cfg.IPFSAuth))
+		} else {
+			authHeader = "Bearer " + cfg.IPFSAuth
+		}
+	}
+
+	return &IPFSStorageServiceImpl{
+		apiURL:         strings.TrimSuffix(cfg.IPFSAPIURL, "/"),
+		authHeader:     authHeader,
+		mfsRoot:        "/" + strings.Trim(cfg.IPFSMFSRoot, "/"),
+		uploadTimeout:  time.Duration(cfg.IPFSUploadTimeout) * time.Second,
+		requestTimeout: time.Duration(cfg.IPFSRequestTimeout) * time.Second,
+		httpClient:     &http.Client{},
+	}
+}
+
+// ipfsError is the error body the RPC API returns with non-200 responses
+type ipfsError struct {
+	Message string `json:"Message"`
+}
+
+// call invokes an RPC command and returns the response body
+// Missing files and blocks are reported as ErrBlobNotFound
+func (s *IPFSStorageServiceImpl) call(ctx context.Context, command string, args []string, params url.Values, body io.Reader, contentType string) ([]byte, error) {
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+	for _, arg := range args {
+		query.Add("arg", arg)
+	}
+
+	callURL := fmt.Sprintf("%s/api/v0/%s?%s", s.apiURL, command, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "POST", callURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IPFS %s request: %w", command, err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.authHeader != "" {
+		req.Header.Set("Authorization", s.authHeader)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("IPFS %s failed: %w", command, err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IPFS %s response: %w", command, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr ipfsError
+		if json.Unmarshal(bodyBytes, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = string(bodyBytes)
+		}
+		message := strings.ToLower(apiErr.Message)
+		if strings.Contains(message, "does not exist") || strings.Contains(message, "not found") {
+			return nil, fmt.Errorf("%w: IPFS %s: %s", ErrBlobNotFound, command, apiErr.Message)
+		}
+		return nil, fmt.Errorf("IPFS %s failed with status %d: %s", command, resp.StatusCode, apiErr.Message)
+	}
+	return bodyBytes, nil
+}
+
+// callTimeout is call bounded by IPFS_REQUEST_TIMEOUT
+func (s *IPFSStorageServiceImpl) callTimeout(command string, args []string, params url.Values, body io.Reader, contentType string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.requestTimeout)
+	defer cancel()
+	return s.call(ctx, command, args, params, body, contentType)
+}
+
+// multipartFile streams r as the single file of a multipart body, as add and files/write expect
+func multipartFile(r io.Reader) (io.Reader, string) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("file", "data")
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, writer.FormDataContentType()
+}
+
+// add pins r and links it into the owner's directory, returning the CID and its size
+func (s *IPFSStorageServiceImpl) add(accountAddress string, r io.Reader) (string, int64, error) {
+	dir, err := s.accountDir(accountAddress)
+	if err != nil {
+		return "", 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.uploadTimeout)
+	defer cancel()
+
+	counter := &countingReader{r: r}
+	body, contentType := multipartFile(counter)
+	params := url.Values{
+		"pin":         {"true"},
+		"cid-version": {"1"},
+		"raw-leaves":  {"true"},
+		"quieter":     {"true"},
+	}
+	respBody, err := s.call(ctx, "add", nil, params, body, contentType)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// add reports progress as JSON lines; the last one names the root
+	var added struct {
+		Hash string `json:"Hash"`
+	}
+	lines := strings.Split(strings.TrimSpace(string(respBody)), "\n")
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &added); err != nil || added.Hash == "" {
+		return "", 0, fmt.Errorf("unexpected IPFS add response: %s", string(respBody))
+	}
+	fmt.Printf("DEBUG: Pinned %d bytes to IPFS as %s\n", counter.n, added.Hash)
+
+	if _, err := s.callTimeout("files/mkdir", []string{dir}, url.Values{"parents": {"true"}}, nil, ""); err != nil {
+		return "", 0, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	_, err = s.callTimeout("files/cp", []string{"/ipfs/" + added.Hash, path.Join(dir, added.Hash)}, nil, nil, "")
+	if err != nil && !strings.Contains(err.Error(), "already exists") {
+		return "", 0, fmt.Errorf("failed to link %s into %s: %w", added.Hash, dir, err)
+	}
+	return added.Hash, counter.n, nil
+}
+
+// cat reads a blob by CID; length 0 reads it whole
+func (s *IPFSStorageServiceImpl) cat(cid string, length int64) ([]byte, error) {
+	if _, err := cidMultihash(cid); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.uploadTimeout)
+	defer cancel()
+
+	params := url.Values{}
+	if length > 0 {
+		params.Set("length", fmt.Sprint(length))
+	}
+	return s.call(ctx, "cat", []string{cid}, params, nil, "")
+}
+
+// accountDir is the owner's MFS directory
+func (s *IPFSStorageServiceImpl) accountDir(accountAddress string) (string, error) {
+	if accountAddress == "" || strings.ContainsAny(accountAddress, "/.") {
+		return "", fmt.Errorf("invalid account address %q", accountAddress)
+	}
+	return path.Join(s.mfsRoot, accountAddress), nil
+}
+
+// sidecarPath is the MFS path of a file kept next to a blob, named {cid}{suffix}
+func (s *IPFSStorageServiceImpl) sidecarPath(accountAddress string, cid string, suffix string) (string, error) {
+	dir, err := s.accountDir(accountAddress)
+	if err != nil {
+		return "", err
+	}
+	if _, err := cidMultihash(cid); err != nil {
+		return "", err
+	}
+	return path.Join(dir, cid+suffix), nil
+}
+
+// writeFile replaces an MFS file
+func (s *IPFSStorageServiceImpl) writeFile(filePath string, data []byte) error {
+	body, contentType := multipartFile(bytes.NewReader(data))
+	params := url.Values{
+		"create":   {"true"},
+		"parents":  {"true"},
+		"truncate": {"true"},
+	}
+	_, err := s.callTimeout("files/write", []string{filePath}, params, body, contentType)
+	return err
+}
+
+// StoreCSV stores CSV records and returns the blob's CID
+func (s *IPFSStorageServiceImpl) StoreCSV(accountAddress string, data [][]string) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(data); err != nil {
+		return "", fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return s.StoreCSVStream(accountAddress, "", &buf)
+}
+
+// StoreCSVStream pins CSV bytes as they are read and returns the blob's CID
+func (s *IPFSStorageServiceImpl) StoreCSVStream(accountAddress string, dataHash string, r io.Reader) (string, error) {
+	cid, size, err := s.add(accountAddress, r)
+	if err != nil {
+		return "", fmt.Errorf("failed to store CSV on IPFS: %w", err)
+	}
+
+	if NormalizeDataHash(dataHash) != "" {
+		err := s.UpdateManifest(accountAddress, dataHash, models.BlobManifestEntry{
+			BlobName:   cid,
+			UploadedAt: time.Now().Unix(),
+			Size:       size,
+		})
+		if err != nil {
+			fmt.Printf("ERROR: Failed to record %s in manifest for %s: %v\n", cid, accountAddress, err)
+		}
+	}
+	return cid, nil
+}
+
+// RetrieveCSV fetches a blob by CID and parses it
+func (s *IPFSStorageServiceImpl) RetrieveCSV(accountAddress string, blobName string) ([][]string, error) {
+	if s.isEncrypted(accountAddress, blobName) {
+		return retrieveSealedCSV(s, accountAddress, blobName)
+	}
+	body, err := s.cat(blobName, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve %s from IPFS: %w", blobName, err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	return records, nil
+}
+
+// PreviewCSV returns the header and first rows of a blob, reading at most PREVIEW_MAX_BYTES
+func (s *IPFSStorageServiceImpl) PreviewCSV(accountAddress string, blobName string, limit int) ([][]string, error) {
+	if s.isEncrypted(accountAddress, blobName) {
+		return previewSealedCSV(s, accountAddress, blobName, limit)
+	}
+	maxBytes := int64(config.AppConfig.PreviewMaxBytes)
+	body, err := s.cat(blobName, maxBytes+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve %s from IPFS: %w", blobName, err)
+	}
+	complete := int64(len(body)) <= maxBytes
+	if !complete {
+		body = body[:maxBytes]
+	}
+	return readCSVPrefix(body, limit, complete)
+}
+
+// StoreCSVStats writes a blob's statistics to {cid}.stats.json in the owner's directory
+func (s *IPFSStorageServiceImpl) StoreCSVStats(accountAddress string, blobName string, stats *models.CSVStats) error {
+	statsPath, err := s.sidecarPath(accountAddress, blobName, csvStatsSuffix)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal CSV stats: %w", err)
+	}
+	return s.writeFile(statsPath, body)
+}
+
+// RetrieveCSVStats reads the statistics stored for a blob
+func (s *IPFSStorageServiceImpl) RetrieveCSVStats(accountAddress string, blobName string) (*models.CSVStats, error) {
+	statsPath, err := s.sidecarPath(accountAddress, blobName, csvStatsSuffix)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.callTimeout("files/read", []string{statsPath}, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV stats: %w", err)
+	}
+
+	var stats models.CSVStats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse CSV stats: %w", err)
+	}
+	return &stats, nil
+}
+
+// StoreEncryptedCSV pins an encrypted CSV and writes its encryption metadata to
+// {cid}.meta in the owner's directory. The blob is unpinned again if the metadata
+// can't be stored, since it couldn't be decrypted
+func (s *IPFSStorageServiceImpl) StoreEncryptedCSV(accountAddress string, ciphertext []byte, metadata []byte) (string, error) {
+	cid, _, err := s.add(accountAddress, bytes.NewReader(ciphertext))
+	if err != nil {
+		return "", fmt.Errorf("failed to store encrypted CSV on IPFS: %w", err)
+	}
+
+	metaPath, err := s.sidecarPath(accountAddress, cid, encryptionMetaSuffix)
+	if err == nil {
+		err = s.writeFile(metaPath, metadata)
+	}
+	if err != nil {
+		if delErr := s.DeleteBlob(accountAddress, cid); delErr != nil {
+			fmt.Printf("WARNING: Failed to remove %s after its metadata upload failed: %v\n", cid, delErr)
+		}
+		return "", fmt.Errorf("failed to store encryption metadata: %w", err)
+	}
+	return cid, nil
+}
+
+// isEncrypted reports whether a blob has an encryption metadata sidecar; CIDs carry no suffix
+func (s *IPFSStorageServiceImpl) isEncrypted(accountAddress string, blobName string) bool {
+	metaPath, err := s.sidecarPath(accountAddress, blobName, encryptionMetaSuffix)
+	if err != nil {
+		return false
+	}
+	_, err = s.callTimeout("files/stat", []string{metaPath}, nil, nil, "")
+	return err == nil
+}
+
+// RetrieveEncryptionMetadata reads a blob's {cid}.meta sidecar
+func (s *IPFSStorageServiceImpl) RetrieveEncryptionMetadata(accountAddress string, blobName string) ([]byte, error) {
+	metaPath, err := s.sidecarPath(accountAddress, blobName, encryptionMetaSuffix)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := s.callTimeout("files/read", []string{metaPath}, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve encryption metadata for %s: %w", blobName, err)
+	}
+	return metadata, nil
+}
+
+// granteeKeyPath is the MFS path of a grant's wrapped data key in the owner's directory
+func (s *IPFSStorageServiceImpl) granteeKeyPath(owner string, datasetID uint64, requester string) (string, error) {
+	dir, err := s.accountDir(owner)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, granteeKeyObject(datasetID, requester)), nil
+}
+
+// StoreGranteeKey writes a grant's wrapped data key to MFS; it is not pinned separately
+func (s *IPFSStorageServiceImpl) StoreGranteeKey(owner string, key models.GranteeKey) error {
+	body, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wrapped key: %w", err)
+	}
+	keyPath, err := s.granteeKeyPath(owner, key.DatasetID, key.Requester)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(keyPath, body)
+}
+
+// RetrieveGranteeKey reads a grant's wrapped data key
+func (s *IPFSStorageServiceImpl) RetrieveGranteeKey(owner string, datasetID uint64, requester string) (*models.GranteeKey, error) {
+	keyPath, err := s.granteeKeyPath(owner, datasetID, requester)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.callTimeout("files/read", []string{keyPath}, nil, nil, "")
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, fmt.Errorf("%w: dataset %d, requester %s", ErrGranteeKeyNotFound, datasetID, requester)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wrapped key: %w", err)
+	}
+
+	var key models.GranteeKey
+	if err := json.Unmarshal(body, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse wrapped key: %w", err)
+	}
+	return &key, nil
+}
+
+// DeleteGranteeKey unlinks a grant's wrapped data key
+func (s *IPFSStorageServiceImpl) DeleteGranteeKey(owner string, datasetID uint64, requester string) error {
+	keyPath, err := s.granteeKeyPath(owner, datasetID, requester)
+	if err != nil {
+		return err
+	}
+	_, err = s.callTimeout("files/rm", []string{keyPath}, nil, nil, "")
+	if err != nil && !errors.Is(err, ErrBlobNotFound) {
+		return fmt.Errorf("failed to unlink %s: %w", keyPath, err)
+	}
+	return nil
+}
+
+// columnGrantPath is the MFS path of a grant's column restriction in the owner's directory
+func (s *IPFSStorageServiceImpl) columnGrantPath(owner string, datasetID uint64, requester string) (string, error) {
+	dir, err := s.accountDir(owner)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, columnGrantObject(datasetID, requester)), nil
+}
+
+// StoreColumnGrant writes a grant's column restriction to MFS; it is not pinned separately
+func (s *IPFSStorageServiceImpl) StoreColumnGrant(owner string, grant models.ColumnGrant) error {
+	body, err := json.Marshal(grant)
+	if err != nil {
+		return fmt.Errorf("failed to marshal column grant: %w", err)
+	}
+	grantPath, err := s.columnGrantPath(owner, grant.DatasetID, grant.Requester)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(grantPath, body)
+}
+
+// RetrieveColumnGrant reads a grant's column restriction
+func (s *IPFSStorageServiceImpl) RetrieveColumnGrant(owner string, datasetID uint64, requester string) (*models.ColumnGrant, error) {
+	grantPath, err := s.columnGrantPath(owner, datasetID, requester)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.callTimeout("files/read", []string{grantPath}, nil, nil, "")
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, fmt.Errorf("%w: dataset %d, requester %s", ErrColumnGrantNotFound, datasetID, requester)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read column grant: %w", err)
+	}
+
+	var grant models.ColumnGrant
+	if err := json.Unmarshal(body, &grant); err != nil {
+		return nil, fmt.Errorf("failed to parse column grant: %w", err)
+	}
+	return &grant, nil
+}
+
+// DeleteColumnGrant unlinks a grant's column restriction
+func (s *IPFSStorageServiceImpl) DeleteColumnGrant(owner string, datasetID uint64, requester string) error {
+	grantPath, err := s.columnGrantPath(owner, datasetID, requester)
+	if err != nil {
+		return err
+	}
+	_, err = s.callTimeout("files/rm", []string{grantPath}, nil, nil, "")
+	if err != nil && !errors.Is(err, ErrBlobNotFound) {
+		return fmt.Errorf("failed to unlink %s: %w", grantPath, err)
+	}
+	return nil
+}
+
+// RetrieveEncryptedCSV fetches an encrypted blob by CID and its encryption metadata
+func (s *IPFSStorageServiceImpl) RetrieveEncryptedCSV(accountAddress string, blobName string) ([]byte, []byte, error) {
+	metaPath, err := s.sidecarPath(accountAddress, blobName, encryptionMetaSuffix)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata, err := s.callTimeout("files/read", []string{metaPath}, nil, nil, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve encryption metadata for %s: %w", blobName, err)
+	}
+
+	ciphertext, err := s.cat(blobName, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve %s from IPFS: %w", blobName, err)
+	}
+	return ciphertext, metadata, nil
+}
+
+// ListBlobs lists the blobs linked in the owner's directory
+func (s *IPFSStorageServiceImpl) ListBlobs(accountAddress string) ([]models.BlobInfo, error) {
+	dir, err := s.accountDir(accountAddress)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.callTimeout("files/ls", []string{dir}, url.Values{"long": {"true"}}, nil, "")
+	if errors.Is(err, ErrBlobNotFound) {
+		return []models.BlobInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	var listing struct {
+		Entries []struct {
+			Name string `json:"Name"`
+			Size int64  `json:"Size"`
+		} `json:"Entries"`
+	}
+	if err := json.Unmarshal(body, &listing); err != nil {
+		return nil, fmt.Errorf("failed to parse IPFS listing: %w", err)
+	}
+
+	names := make(map[string]bool, len(listing.Entries))
+	for _, entry := range listing.Entries {
+		names[entry.Name] = true
+	}
+
+	// MFS keeps no modification times, so upload times (and metadata) come from the manifest
+	uploadedAt := make(map[string]int64)
+	metadata := map[string]*models.BlobMetadata{}
+	if manifest, err := s.RetrieveManifest(accountAddress); err == nil {
+		for _, entry := range manifest {
+			uploadedAt[entry.BlobName] = entry.UploadedAt
+		}
+		metadata = manifestBlobMetadata(manifest)
+	}
+
+	blobs := []models.BlobInfo{}
+	for _, entry := range listing.Entries {
+		if _, err := cidMultihash(entry.Name); err != nil {
+			continue // Sidecars and the manifest
+		}
+		blobs = append(blobs, models.BlobInfo{
+			Name:         entry.Name,
+			Size:         entry.Size,
+			LastModified: uploadedAt[entry.Name],
+			Encrypted:    names[entry.Name+encryptionMetaSuffix],
+			Metadata:     metadata[entry.Name],
+		})
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].LastModified > blobs[j].LastModified })
+	return blobs, nil
+}
+
+// FindBlobByDataHash looks a data hash up in the owner's manifest, then among the owner's
+// blobs whose CID digest is the data hash
+func (s *IPFSStorageServiceImpl) FindBlobByDataHash(accountAddress string, dataHash string) (string, error) {
+	key := NormalizeDataHash(dataHash)
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return "", err
+	}
+	if entry, ok := manifest[key]; ok && !entry.Pending {
+		return entry.BlobName, nil
+	}
+
+	blobs, err := s.ListBlobs(accountAddress)
+	if err != nil {
+		return "", err
+	}
+	for _, blob := range blobs {
+		if cidHash, err := CIDDataHash(blob.Name); err == nil && cidHash == key {
+			return blob.Name, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no blob for data hash %s under %s", ErrBlobNotFound, dataHash, accountAddress)
+}
+
+// DeleteBlob unlinks a blob and its sidecars from the owner's directory, unpins it and drops
+// it from the manifest. Copies pinned elsewhere on the network stay reachable by CID
+func (s *IPFSStorageServiceImpl) DeleteBlob(accountAddress string, blobName string) error {
+	for _, suffix := range []string{"", csvStatsSuffix, encryptionMetaSuffix} {
+		filePath, err := s.sidecarPath(accountAddress, blobName, suffix)
+		if err != nil {
+			return err
+		}
+		_, err = s.callTimeout("files/rm", []string{filePath}, nil, nil, "")
+		if errors.Is(err, ErrBlobNotFound) {
+			// A missing sidecar is fine; a missing blob is reported
+			if suffix == "" {
+				return fmt.Errorf("%w: %s", ErrBlobNotFound, blobName)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to unlink %s: %w", filePath, err)
+		}
+	}
+
+	if _, err := s.callTimeout("pin/rm", []string{blobName}, nil, nil, ""); err != nil && !strings.Contains(err.Error(), "not pinned") {
+		fmt.Printf("WARNING: Failed to unpin %s: %v\n", blobName, err)
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return fmt.Errorf("blob deleted but manifest could not be read: %w", err)
+	}
+	if removeBlobFromManifest(manifest, blobName) == 0 {
+		return nil
+	}
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// RetrieveManifest reads the owner's manifest; a missing manifest is returned empty
+func (s *IPFSStorageServiceImpl) RetrieveManifest(accountAddress string) (models.BlobManifest, error) {
+	dir, err := s.accountDir(accountAddress)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.callTimeout("files/read", []string{path.Join(dir, manifestObjectName)}, nil, nil, "")
+	if errors.Is(err, ErrBlobNotFound) {
+		return models.BlobManifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	manifest := models.BlobManifest{}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// UpdateManifest records the blob stored for a data hash in the owner's manifest
+func (s *IPFSStorageServiceImpl) UpdateManifest(accountAddress string, dataHash string, entry models.BlobManifestEntry) error {
+	key := NormalizeDataHash(dataHash)
+	if key == "" {
+		return fmt.Errorf("invalid data hash: %q", dataHash)
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return err
+	}
+	manifest[key] = entry
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// SetBlobMetadata records a blob's metadata on its manifest entries; an IPFS object is its content, so there is nowhere else to put it
+func (s *IPFSStorageServiceImpl) SetBlobMetadata(accountAddress string, blobName string, metadata models.BlobMetadata) error {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return err
+	}
+	if setManifestBlobMetadata(manifest, blobName, metadata) == 0 {
+		return nil
+	}
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// storeManifest overwrites the owner's manifest; callers hold manifestMu
+func (s *IPFSStorageServiceImpl) storeManifest(accountAddress string, manifest models.BlobManifest) error {
+	dir, err := s.accountDir(accountAddress)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	return s.writeFile(path.Join(dir, manifestObjectName), body)
+}
+
+// Ping checks the IPFS API answers with the configured credentials and the MFS root is usable
+func (s *IPFSStorageServiceImpl) Ping(ctx context.Context) error {
+	if _, err := s.call(ctx, "version", nil, nil, nil, ""); err != nil {
+		return err
+	}
+	if _, err := s.call(ctx, "files/mkdir", []string{s.mfsRoot}, url.Values{"parents": {"true"}}, nil, ""); err != nil {
+		return fmt.Errorf("IPFS_MFS_ROOT %s is not usable: %w", s.mfsRoot, err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/config"
+)
+
+// KeyProvider wraps and unwraps data keys under a master key it holds. Key IDs recorded in
+// .meta are "{provider}:{key}" for remote providers and a bare master key ID for static keys,
+// so a blob is always unwrapped by the provider that wrapped it
+type KeyProvider interface {
+	Name() string  // static, kms or vault
+	KeyID() string // ID recorded for data keys wrapped from now on
+	WrapKey(ctx context.Context, dek []byte) (keyID string, wrapped string, err error)
+	UnwrapKey(ctx context.Context, keyID string, wrapped string) ([]byte, error)
+	Ping(ctx context.Context) error // Checks the provider can be reached and the key used
+}
+
+// keyProviderTimeout bounds a single wrap or unwrap, which may be a KMS or Vault request
+const keyProviderTimeout = 15 * time.Second
+
+var (
+	keyProviderMu sync.RWMutex
+	keyProvider   KeyProvider
+)
+
+// InitKeyProvider builds the provider selected by KEY_PROVIDER. Until it is called, data
+// keys are wrapped with the static ENCRYPTION_MASTER_KEY
+func InitKeyProvider(ctx context.Context) error {
+	var provider KeyProvider
+	switch strings.ToLower(config.AppConfig.KeyProvider) {
+	case "", "static":
+		provider = staticKeyProvider{}
+	case "kms":
+		kms, err := newKMSKeyProvider(ctx)
+		if err != nil {
+			return err
+		}
+		provider = kms
+	case "vault":
+		vault, err := newVaultKeyProvider()
+		if err != nil {
+			return err
+		}
+		provider = vault
+	default:
+		return fmt.Errorf("unknown KEY_PROVIDER %q (supported: static, kms, vault)", config.AppConfig.KeyProvider)
+	}
+
+	keyProviderMu.Lock()
+	keyProvider = provider
+	keyProviderMu.Unlock()
+	return nil
+}
+
+// CurrentKeyProvider is the provider wrapping new data keys
+func CurrentKeyProvider() KeyProvider {
+	keyProviderMu.RLock()
+	defer keyProviderMu.RUnlock()
+	if keyProvider == nil {
+		return staticKeyProvider{}
+	}
+	return keyProvider
+}
+
+// keyProviderFor returns the provider that can unwrap keys recorded under keyID. Static key
+// IDs are always resolved from ENCRYPTION_MASTER_KEY and ENCRYPTION_PREVIOUS_KEYS, so blobs
+// keep decrypting after moving to KMS or Vault as long as the old key stays configured
+func keyProviderFor(keyID string) (KeyProvider, error) {
+	name, _, remote := strings.Cut(keyID, ":")
+	if !remote {
+		return staticKeyProvider{}, nil
+	}
+	provider := CurrentKeyProvider()
+	if provider.Name() != name {
+		return nil, fmt.Errorf("%w: %s needs KEY_PROVIDER=%s", ErrUnknownMasterKey, keyID, name)
+	}
+	return provider, nil
+}
+
+// staticKeyProvider wraps data keys with ENCRYPTION_MASTER_KEY using AES-256-GCM. The key is
+// parsed from config for each call rather than kept decoded
+type staticKeyProvider struct{}
+
+func (staticKeyProvider) Name() string { return "static" }
+
+func (staticKeyProvider) KeyID() string {
+	current, err := parseMasterKey(config.AppConfig.EncryptionMasterKey)
+	if err != nil {
+		return ""
+	}
+	return current.id
+}
+
+func (staticKeyProvider) WrapKey(ctx context.Context, dek []byte) (string, string, error) {
+	master, err := parseMasterKey(config.AppConfig.EncryptionMasterKey)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, wrapped, err := aeadSeal(AlgorithmAES256GCM, master.key, dek, dekWrapAAD)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return master.id, base64.StdEncoding.EncodeToString(append(nonce, wrapped...)), nil
+}
+
+func (staticKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped string) ([]byte, error) {
+	master, err := masterKeyByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(raw) < 12 {
+		return nil, fmt.Errorf("invalid wrapped data key")
+	}
+	dek, err := aeadOpen(AlgorithmAES256GCM, master.key, raw[:12], raw[12:], dekWrapAAD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dek, nil
+}
+
+func (staticKeyProvider) Ping(ctx context.Context) error {
+	_, err := parseMasterKey(config.AppConfig.EncryptionMasterKey)
+	return err
+}
+
+// unwrapCache keeps data keys unwrapped by a remote provider for KEY_CACHE_TTL, so serving
+// a dataset doesn't cost a KMS or Vault call per download
+var unwrapCache = struct {
+	sync.Mutex
+	entries map[string]cachedDataKey
+}{entries: make(map[string]cachedDataKey)}
+
+type cachedDataKey struct {
+	dek       []byte
+	expiresAt time.Time
+}
+
+func cachedUnwrap(keyID string, wrapped string) []byte {
+	unwrapCache.Lock()
+	defer unwrapCache.Unlock()
+	entry, ok := unwrapCache.entries[keyID+"|"+wrapped]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil
+	}
+	return entry.dek
+}
+
+func cacheUnwrap(keyID string, wrapped string, dek []byte) {
+	ttl := time.Duration(config.AppConfig.KeyCacheTTL) * time.Second
+	if ttl <= 0 {
+		return
+	}
+
+	unwrapCache.Lock()
+	defer unwrapCache.Unlock()
+	now := time.Now()
+	for key, entry := range unwrapCache.entries {
+		if now.After(entry.expiresAt) {
+			delete(unwrapCache.entries, key)
+		}
+	}
+	unwrapCache.entries[keyID+"|"+wrapped] = cachedDataKey{dek: dek, expiresAt: now.Add(ttl)}
+}
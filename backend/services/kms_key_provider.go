@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/datax/backend/config"
+)
+
+// kmsEncryptionContext is bound to every data key KMS wraps, so a ciphertext can't be
+// decrypted for another purpose by whoever else holds kms:Decrypt on the key
+var kmsEncryptionContext = map[string]string{"purpose": "datax-dek-v1"}
+
+// kmsKeyProvider wraps data keys with an AWS KMS key through the KMS JSON API, signed with
+// credentials from the default AWS chain (environment, shared config, instance role)
+type kmsKeyProvider struct {
+	keyID       string
+	region      string
+	endpoint    string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	httpClient  *http.Client
+}
+
+func newKMSKeyProvider(ctx context.Context) (*kmsKeyProvider, error) {
+	if config.AppConfig.KMSKeyID == "" {
+		return nil, fmt.Errorf("KEY_PROVIDER=kms requires KMS_KEY_ID")
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(config.AppConfig.KMSRegion))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS credentials for KMS: %w", err)
+	}
+
+	endpoint := config.AppConfig.KMSEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", config.AppConfig.KMSRegion)
+	}
+	return &kmsKeyProvider{
+		keyID:       config.AppConfig.KMSKeyID,
+		region:      config.AppConfig.KMSRegion,
+		endpoint:    strings.TrimSuffix(endpoint, "/") + "/",
+		credentials: cfg.Credentials,
+		signer:      v4.NewSigner(),
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *kmsKeyProvider) Name() string { return "kms" }
+
+func (p *kmsKeyProvider) KeyID() string { return "kms:" + p.keyID }
+
+func (p *kmsKeyProvider) WrapKey(ctx context.Context, dek []byte) (string, string, error) {
+	var resp struct {
+		CiphertextBlob string
+	}
+	err := p.call(ctx, "Encrypt", map[string]interface{}{
+		"KeyId":             p.keyID,
+		"Plaintext":         base64.StdEncoding.EncodeToString(dek),
+		"EncryptionContext": kmsEncryptionContext,
+	}, &resp)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to wrap data key with KMS: %w", err)
+	}
+	return p.KeyID(), resp.CiphertextBlob, nil
+}
+
+func (p *kmsKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped string) ([]byte, error) {
+	// KMS finds the key from the ciphertext; KeyId only makes it refuse another key's ciphertext
+	var resp struct {
+		Plaintext string
+	}
+	err := p.call(ctx, "Decrypt", map[string]interface{}{
+		"KeyId":             strings.TrimPrefix(keyID, "kms:"),
+		"CiphertextBlob":    wrapped,
+		"EncryptionContext": kmsEncryptionContext,
+	}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with KMS: %w", err)
+	}
+	dek, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext from KMS: %w", err)
+	}
+	return dek, nil
+}
+
+func (p *kmsKeyProvider) Ping(ctx context.Context) error {
+	var resp struct {
+		KeyMetadata struct {
+			Enabled bool
+		}
+	}
+	if err := p.call(ctx, "DescribeKey", map[string]interface{}{"KeyId": p.keyID}, &resp); err != nil {
+		return err
+	}
+	if !resp.KeyMetadata.Enabled {
+		return fmt.Errorf("KMS key %s is disabled", p.keyID)
+	}
+	return nil
+}
+
+// call sends a SigV4-signed request to a KMS action and decodes the JSON response into out
+func (p *kmsKeyProvider) call(ctx context.Context, action string, input interface{}, out interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+
+	creds, err := p.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	payloadHash := sha256.Sum256(body)
+	if err := p.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "kms", p.region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign KMS request: %w", err)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("KMS unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read KMS response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var kmsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(respBody, &kmsErr) == nil && kmsErr.Type != "" {
+			return fmt.Errorf("KMS %s failed (%d): %s: %s", action, resp.StatusCode, kmsErr.Type, kmsErr.Message)
+		}
+		return fmt.Errorf("KMS %s failed (%d): %s", action, resp.StatusCode, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse KMS response: %w", err)
+	}
+	return nil
+}
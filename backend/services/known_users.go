@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Known users bookkeeping
+const (
+	knownUserTouchInterval = time.Hour          // Don't rewrite last_seen more often than this
+	knownUserStaleAfter    = 7 * 24 * time.Hour // Unseen this long, a user is checked for pruning
+	knownUserMaxPruneCheck = 10                 // DataStore checks per discovery run
+)
+
+// knownUser tracks when a user was first and last reported by discovery
+type knownUser struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// knownUsersDocument is the persisted set of discovered users
+type knownUsersDocument struct {
+	Users map[string]knownUser `json:"users"`
+}
+
+// rememberUsers merges freshly discovered users into the persisted known-user set and
+// returns every known user. The set is loaded lazily on first use and written back only
+// when discovery succeeded and something changed, so the marketplace isn't empty while
+// the first slow discovery after a restart runs
+func (s *AptosServiceImpl) rememberUsers(discovered []string) []string {
+	now := time.Now().UTC()
+
+	s.knownUsersMu.Lock()
+	s.loadKnownUsers()
+	changed := false
+	for _, user := range discovered {
+		addr, err := parseAddress(user)
+		if err != nil {
+			continue
+		}
+		key := addr.String()
+		entry, ok := s.knownUsers.Users[key]
+		if !ok {
+			s.knownUsers.Users[key] = knownUser{FirstSeen: now, LastSeen: now}
+			changed = true
+			continue
+		}
+		if now.Sub(entry.LastSeen) > knownUserTouchInterval {
+			entry.LastSeen = now
+			s.knownUsers.Users[key] = entry
+			changed = true
+		}
+	}
+	var stale []string
+	if len(discovered) > 0 {
+		stale = s.staleKnownUsers(now)
+	}
+	s.knownUsersMu.Unlock()
+
+	// The chain is checked without the lock so readers don't wait on the network
+	gone := s.usersWithoutDataStore(stale)
+
+	s.knownUsersMu.Lock()
+	defer s.knownUsersMu.Unlock()
+
+	for _, user := range gone {
+		// Discovery may have seen the user again while the chain was being checked
+		if entry, ok := s.knownUsers.Users[user]; ok && now.Sub(entry.LastSeen) >= knownUserStaleAfter {
+			fmt.Printf("DEBUG: Pruning known user %s (no DataStore, last seen %s)\n", user, entry.LastSeen.Format(time.RFC3339))
+			delete(s.knownUsers.Users, user)
+			changed = true
+		}
+	}
+
+	if changed && len(discovered) > 0 {
+		s.saveKnownUsers()
+	}
+
+	users := make([]string, 0, len(s.knownUsers.Users))
+	for user := range s.knownUsers.Users {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// loadKnownUsers reads the known-user set from the state store on first use
+// Callers must hold knownUsersMu
+func (s *AptosServiceImpl) loadKnownUsers() {
+	if s.knownUsers != nil {
+		return
+	}
+
+	document := &knownUsersDocument{}
+	if s.stateStore != nil {
+		etag, err := s.stateStore.LoadState(stateKeyKnownUsers, document)
+		switch {
+		case err == nil:
+			s.knownUsersETag = etag
+			fmt.Printf("DEBUG: Loaded %d known users from %s\n", len(document.Users), stateKeyKnownUsers)
+		case errors.Is(err, ErrStateNotFound):
+			fmt.Printf("DEBUG: No known users stored yet\n")
+		default:
+			fmt.Printf("WARNING: Failed to load known users: %v\n", err)
+			document = &knownUsersDocument{}
+		}
+	}
+	if document.Users == nil {
+		document.Users = make(map[string]knownUser)
+	}
+	s.knownUsers = document
+}
+
+// saveKnownUsers writes the known-user set back with an ETag-conditional put
+// On a conflict the stored set is merged in (keeping the earliest first_seen and latest
+// last_seen of each user) and the write is retried once
+// Callers must hold knownUsersMu
+func (s *AptosServiceImpl) saveKnownUsers() {
+	if s.stateStore == nil {
+		return
+	}
+
+	etag, err := s.stateStore.SaveState(stateKeyKnownUsers, s.knownUsers, s.knownUsersETag)
+	if errors.Is(err, ErrStateConflict) {
+		stored := &knownUsersDocument{}
+		storedETag, loadErr := s.stateStore.LoadState(stateKeyKnownUsers, stored)
+		if loadErr != nil {
+			fmt.Printf("WARNING: Failed to reload known users after conflict: %v\n", loadErr)
+			return
+		}
+		for user, theirs := range stored.Users {
+			ours, ok := s.knownUsers.Users[user]
+			if !ok {
+				s.knownUsers.Users[user] = theirs
+				continue
+			}
+			if theirs.FirstSeen.Before(ours.FirstSeen) {
+				ours.FirstSeen = theirs.FirstSeen
+			}
+			if theirs.LastSeen.After(ours.LastSeen) {
+				ours.LastSeen = theirs.LastSeen
+			}
+			s.knownUsers.Users[user] = ours
+		}
+		etag, err = s.stateStore.SaveState(stateKeyKnownUsers, s.knownUsers, storedETag)
+	}
+	if err != nil {
+		fmt.Printf("WARNING: Failed to save known users: %v\n", err)
+		return
+	}
+	s.knownUsersETag = etag
+}
+
+// staleKnownUsers picks the users discovery hasn't reported for a while, up to
+// knownUserMaxPruneCheck of them, to be checked for pruning
+// Callers must hold knownUsersMu
+func (s *AptosServiceImpl) staleKnownUsers(now time.Time) []string {
+	stale := make([]string, 0)
+	for user, entry := range s.knownUsers.Users {
+		if len(stale) >= knownUserMaxPruneCheck {
+			break
+		}
+		if now.Sub(entry.LastSeen) >= knownUserStaleAfter {
+			stale = append(stale, user)
+		}
+	}
+	return stale
+}
+
+// usersWithoutDataStore returns the users whose DataStore no longer exists on-chain
+// Users whose DataStore can't be read are kept
+func (s *AptosServiceImpl) usersWithoutDataStore(users []string) []string {
+	if len(users) == 0 {
+		return nil
+	}
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
+	if err != nil {
+		return nil
+	}
+	resourceType := fmt.Sprintf("%s::data_registry::DataStore", moduleAddr.String())
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
+
+	gone := make([]string, 0)
+	for _, user := range users {
+		resourceURL := fmt.Sprintf("%s/v1/accounts/%s/resource/%s", nodeURL, user, url.PathEscape(resourceType))
+		_, status, err := s.getWithRetry(resourceURL, "DataStore")
+		if err == nil && status == http.StatusNotFound {
+			gone = append(gone, user)
+		}
+	}
+	return gone
+}
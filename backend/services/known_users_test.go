@@ -0,0 +1,76 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPruningDoesNotHoldTheKnownUsersLock(t *testing.T) {
+	node := newFakeNode(t)
+	checking := make(chan struct{})
+	release := make(chan struct{})
+	node.handle(dataStorePath(testOwnerB), func(w http.ResponseWriter, r *http.Request) {
+		close(checking)
+		<-release
+		http.NotFound(w, r)
+	})
+	service := newTestService(t, node, nil)
+
+	stale := time.Now().UTC().Add(-2 * knownUserStaleAfter)
+	service.knownUsers = &knownUsersDocument{Users: map[string]knownUser{
+		mustAddress(testOwnerB): {FirstSeen: stale, LastSeen: stale},
+	}}
+
+	done := make(chan []string)
+	go func() { done <- service.rememberUsers([]string{testOwnerA}) }()
+	<-checking
+
+	// B's DataStore check is in flight; reading the known users must not wait for it
+	read := make(chan []string)
+	go func() { read <- service.rememberUsers(nil) }()
+	select {
+	case users := <-read:
+		if len(users) != 2 {
+			t.Errorf("known users during the check = %v, want A and B", users)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("rememberUsers blocked behind the DataStore check")
+	}
+
+	close(release)
+	if users := <-done; len(users) != 1 || users[0] != mustAddress(testOwnerA) {
+		t.Errorf("known users after pruning = %v, want only %s", users, testOwnerA)
+	}
+}
+
+func TestPruningKeepsUsersSeenAgainDuringTheCheck(t *testing.T) {
+	node := newFakeNode(t)
+	checking := make(chan struct{})
+	release := make(chan struct{})
+	node.handle(dataStorePath(testOwnerB), func(w http.ResponseWriter, r *http.Request) {
+		close(checking)
+		<-release
+		http.NotFound(w, r)
+	})
+	service := newTestService(t, node, nil)
+
+	stale := time.Now().UTC().Add(-2 * knownUserStaleAfter)
+	service.knownUsers = &knownUsersDocument{Users: map[string]knownUser{
+		mustAddress(testOwnerB): {FirstSeen: stale, LastSeen: stale},
+	}}
+
+	done := make(chan []string)
+	go func() { done <- service.rememberUsers([]string{testOwnerA}) }()
+	<-checking
+
+	// Another discovery run reports B while the first one is checking its DataStore
+	service.knownUsersMu.Lock()
+	service.knownUsers.Users[mustAddress(testOwnerB)] = knownUser{FirstSeen: stale, LastSeen: time.Now().UTC()}
+	service.knownUsersMu.Unlock()
+
+	close(release)
+	if users := <-done; len(users) != 2 {
+		t.Errorf("known users = %v, want B kept after being seen again", users)
+	}
+}
@@ -0,0 +1,619 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+// LocalStorageService keeps blobs on the local filesystem, laid out like the Supabase bucket:
+// {root}/{account}/{sha256}.csv with sidecars and manifest.json beside them
+// Meant for development and single-node deployments
+type LocalStorageService struct {
+	root       string
+	manifestMu sync.Mutex // Serializes manifest read-modify-write
+}
+
+func NewLocalStorageService(root string) StorageService {
+	return &LocalStorageService{root: root}
+}
+
+// Ping checks the storage directory exists and accepts writes by round-tripping a marker file
+func (s *LocalStorageService) Ping(ctx context.Context) error {
+	marker, err := os.CreateTemp(s.root, ".ping-*")
+	if err != nil {
+		return fmt.Errorf("LOCAL_STORAGE_DIR %s is not writable: %w", s.root, err)
+	}
+	defer os.Remove(marker.Name())
+
+	_, err = marker.WriteString("ping")
+	if closeErr := marker.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		var body []byte
+		body, err = os.ReadFile(marker.Name())
+		if err == nil && string(body) != "ping" {
+			err = errors.New("marker file read back differently")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("LOCAL_STORAGE_DIR %s is not usable: %w", s.root, err)
+	}
+	return nil
+}
+
+// path maps a blob name to its file, refusing names that escape the account's directory
+func (s *LocalStorageService) path(accountAddress string, blobName string) (string, error) {
+	key := path.Clean(blobKey(accountAddress, blobName))
+	if accountAddress == "" || strings.Contains(accountAddress, "/") || !strings.HasPrefix(key, accountAddress+"/") {
+		return "", fmt.Errorf("blob %s does not belong to %s", blobName, accountAddress)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// StoreCSV stores CSV records and returns the blob name
+func (s *LocalStorageService) StoreCSV(accountAddress string, data [][]string) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(data); err != nil {
+		return "", fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return s.StoreCSVStream(accountAddress, "", &buf)
+}
+
+// StoreCSVStream writes CSV bytes to a content-addressed blob, {account}/{sha256}.csv, and
+// records it in the manifest under dataHash when one is given. The file is written under a
+// temporary name and renamed, so readers never see a partial blob; identical data that is
+// already stored is kept and the temporary file dropped
+func (s *LocalStorageService) StoreCSVStream(accountAddress string, dataHash string, r io.Reader) (string, error) {
+	accountDir, err := s.path(accountAddress, manifestObjectName)
+	if err != nil {
+		return "", err
+	}
+	accountDir = filepath.Dir(accountDir)
+	if err := os.MkdirAll(accountDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create account directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(accountDir, ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob file: %w", err)
+	}
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	blobName := contentBlobName(accountAddress, hasher.Sum(nil))
+	filePath := filepath.Join(accountDir, path.Base(blobName))
+	if err == nil {
+		if _, statErr := os.Stat(filePath); statErr == nil {
+			os.Remove(tmp.Name())
+			fmt.Printf("DEBUG: CSV already stored in local storage at %s, skipped write\n", filePath)
+			s.recordUpload(accountAddress, dataHash, blobName, size)
+			return blobName, nil
+		}
+		err = os.Rename(tmp.Name(), filePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write blob %s: %w", blobName, err)
+	}
+
+	fmt.Printf("DEBUG: Stored CSV in local storage at %s (%d bytes)\n", filePath, size)
+	s.recordUpload(accountAddress, dataHash, blobName, size)
+	return blobName, nil
+}
+
+// recordUpload adds a stored blob to the account's manifest; a failure is only logged
+func (s *LocalStorageService) recordUpload(accountAddress string, dataHash string, blobName string, size int64) {
+	if NormalizeDataHash(dataHash) == "" {
+		return
+	}
+	err := s.UpdateManifest(accountAddress, dataHash, models.BlobManifestEntry{
+		BlobName:   blobName,
+		UploadedAt: time.Now().Unix(),
+		Size:       size,
+	})
+	if err != nil {
+		fmt.Printf("ERROR: Failed to record %s in manifest for %s: %v\n", blobName, accountAddress, err)
+	}
+}
+
+// StoreEncryptedCSV writes ciphertext to {account}/{sha256}.csv.enc, named after the
+// ciphertext, with its encryption metadata in a .meta file next to it
+func (s *LocalStorageService) StoreEncryptedCSV(accountAddress string, ciphertext []byte, metadata []byte) (string, error) {
+	return s.StoreEncryptedCSVStream(accountAddress, bytes.NewReader(ciphertext), func() ([]byte, error) {
+		return metadata, nil
+	})
+}
+
+// StoreEncryptedCSVStream writes ciphertext as it is sealed to a temporary file, renames it
+// to {account}/{sha256}.csv.enc once it is hashed, and writes the .meta next to it
+func (s *LocalStorageService) StoreEncryptedCSVStream(accountAddress string, ciphertext io.Reader, metadata func() ([]byte, error)) (string, error) {
+	accountDir, err := s.path(accountAddress, manifestObjectName)
+	if err != nil {
+		return "", err
+	}
+	accountDir = filepath.Dir(accountDir)
+	if err := os.MkdirAll(accountDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create account directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(accountDir, ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), ciphertext)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write encrypted blob: %w", err)
+	}
+	meta, err := metadata()
+	if err != nil {
+		return "", fmt.Errorf("failed to store encryption metadata: %w", err)
+	}
+
+	blobName := contentBlobName(accountAddress, hasher.Sum(nil)) + ".enc"
+	filePath := filepath.Join(accountDir, path.Base(blobName))
+	if err := os.WriteFile(filePath+encryptionMetaSuffix, meta, 0o644); err != nil {
+		return "", fmt.Errorf("failed to store encryption metadata: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		os.Remove(filePath + encryptionMetaSuffix)
+		return "", fmt.Errorf("failed to write blob %s: %w", blobName, err)
+	}
+	fmt.Printf("DEBUG: Stored encrypted CSV in local storage at %s (%d bytes)\n", filePath, size)
+	return blobName, nil
+}
+
+// RetrieveEncryptedCSV reads an encrypted blob and its encryption metadata
+func (s *LocalStorageService) RetrieveEncryptedCSV(accountAddress string, blobName string) ([]byte, []byte, error) {
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrBlobNotFound, blobName)
+		}
+		return nil, nil, fmt.Errorf("failed to read blob %s: %w", blobName, err)
+	}
+	metadata, err := os.ReadFile(filePath + encryptionMetaSuffix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve encryption metadata for %s: %w", blobName, err)
+	}
+	return ciphertext, metadata, nil
+}
+
+// RetrieveEncryptionMetadata reads an encrypted blob's .meta file
+func (s *LocalStorageService) RetrieveEncryptionMetadata(accountAddress string, blobName string) ([]byte, error) {
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := os.ReadFile(filePath + encryptionMetaSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve encryption metadata for %s: %w", blobName, err)
+	}
+	return metadata, nil
+}
+
+// StoreGranteeKey writes a grant's wrapped data key under the owner's grants/ directory
+func (s *LocalStorageService) StoreGranteeKey(owner string, key models.GranteeKey) error {
+	filePath, err := s.path(owner, owner+"/"+granteeKeyObject(key.DatasetID, key.Requester))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wrapped key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return fmt.Errorf("failed to create grants directory: %w", err)
+	}
+	return os.WriteFile(filePath, body, 0o600)
+}
+
+// RetrieveGranteeKey reads a grant's wrapped data key
+func (s *LocalStorageService) RetrieveGranteeKey(owner string, datasetID uint64, requester string) (*models.GranteeKey, error) {
+	filePath, err := s.path(owner, owner+"/"+granteeKeyObject(datasetID, requester))
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: dataset %d, requester %s", ErrGranteeKeyNotFound, datasetID, requester)
+		}
+		return nil, fmt.Errorf("failed to read wrapped key: %w", err)
+	}
+
+	var key models.GranteeKey
+	if err := json.Unmarshal(body, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse wrapped key: %w", err)
+	}
+	return &key, nil
+}
+
+// DeleteGranteeKey removes a grant's wrapped data key
+func (s *LocalStorageService) DeleteGranteeKey(owner string, datasetID uint64, requester string) error {
+	filePath, err := s.path(owner, owner+"/"+granteeKeyObject(datasetID, requester))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete wrapped key: %w", err)
+	}
+	return nil
+}
+
+// StoreColumnGrant writes a grant's column restriction under the owner's grants/ directory
+func (s *LocalStorageService) StoreColumnGrant(owner string, grant models.ColumnGrant) error {
+	filePath, err := s.path(owner, owner+"/"+columnGrantObject(grant.DatasetID, grant.Requester))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(grant)
+	if err != nil {
+		return fmt.Errorf("failed to marshal column grant: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return fmt.Errorf("failed to create grants directory: %w", err)
+	}
+	return os.WriteFile(filePath, body, 0o600)
+}
+
+// RetrieveColumnGrant reads a grant's column restriction
+func (s *LocalStorageService) RetrieveColumnGrant(owner string, datasetID uint64, requester string) (*models.ColumnGrant, error) {
+	filePath, err := s.path(owner, owner+"/"+columnGrantObject(datasetID, requester))
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: dataset %d, requester %s", ErrColumnGrantNotFound, datasetID, requester)
+		}
+		return nil, fmt.Errorf("failed to read column grant: %w", err)
+	}
+
+	var grant models.ColumnGrant
+	if err := json.Unmarshal(body, &grant); err != nil {
+		return nil, fmt.Errorf("failed to parse column grant: %w", err)
+	}
+	return &grant, nil
+}
+
+// DeleteColumnGrant removes a grant's column restriction
+func (s *LocalStorageService) DeleteColumnGrant(owner string, datasetID uint64, requester string) error {
+	filePath, err := s.path(owner, owner+"/"+columnGrantObject(datasetID, requester))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete column grant: %w", err)
+	}
+	return nil
+}
+
+// RetrieveCSV reads and parses a blob
+func (s *LocalStorageService) RetrieveCSV(accountAddress string, blobName string) ([][]string, error) {
+	if strings.HasSuffix(blobName, encryptedBlobSuffix) {
+		return retrieveSealedCSV(s, accountAddress, blobName)
+	}
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", blobName, err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	return records, nil
+}
+
+// HeadBlob returns the size of a stored blob, or an error wrapping ErrBlobNotFound
+func (s *LocalStorageService) HeadBlob(accountAddress string, blobName string) (int64, error) {
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrBlobNotFound, blobName, err)
+	}
+	return info.Size(), nil
+}
+
+// OpenBlob streams a stored blob's raw bytes; the caller closes the reader
+func (s *LocalStorageService) OpenBlob(accountAddress string, blobName string) (io.ReadCloser, error) {
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBlobNotFound, blobName, err)
+	}
+	return file, nil
+}
+
+// OpenBlobRange streams length bytes of a stored blob starting at offset; the caller closes
+// the reader
+func (s *LocalStorageService) OpenBlobRange(accountAddress string, blobName string, offset int64, length int64) (io.ReadCloser, error) {
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", blobName, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(file, offset, length), file}, nil
+}
+
+// PreviewCSV returns the header and first rows of a blob, reading at most PREVIEW_MAX_BYTES
+func (s *LocalStorageService) PreviewCSV(accountAddress string, blobName string, limit int) ([][]string, error) {
+	if strings.HasSuffix(blobName, encryptedBlobSuffix) {
+		return previewSealedCSV(s, accountAddress, blobName, limit)
+	}
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", blobName, err)
+	}
+	defer file.Close()
+
+	maxBytes := int64(config.AppConfig.PreviewMaxBytes)
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", blobName, err)
+	}
+	complete := int64(len(data)) <= maxBytes
+	if !complete {
+		data = data[:maxBytes]
+	}
+	return readCSVPrefix(data, limit, complete)
+}
+
+// StoreCSVStats writes a blob's statistics next to it
+func (s *LocalStorageService) StoreCSVStats(accountAddress string, blobName string, stats *models.CSVStats) error {
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal CSV stats: %w", err)
+	}
+	return os.WriteFile(filePath+csvStatsSuffix, body, 0o644)
+}
+
+// RetrieveCSVStats reads the statistics stored next to a blob
+func (s *LocalStorageService) RetrieveCSVStats(accountAddress string, blobName string) (*models.CSVStats, error) {
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(filePath + csvStatsSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV stats: %w", err)
+	}
+
+	var stats models.CSVStats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse CSV stats: %w", err)
+	}
+	return &stats, nil
+}
+
+// ListBlobs lists the account's plain and encrypted CSV blobs
+func (s *LocalStorageService) ListBlobs(accountAddress string) ([]models.BlobInfo, error) {
+	dir, err := s.path(accountAddress, manifestObjectName)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Dir(dir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []models.BlobInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	metadata := map[string]*models.BlobMetadata{}
+	if manifest, err := s.RetrieveManifest(accountAddress); err == nil {
+		metadata = manifestBlobMetadata(manifest)
+	}
+
+	blobs := []models.BlobInfo{}
+	for _, entry := range entries {
+		name := entry.Name()
+		encrypted := strings.HasSuffix(name, encryptedBlobSuffix)
+		if entry.IsDir() || (!encrypted && !strings.HasSuffix(name, ".csv")) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, models.BlobInfo{
+			Name:         accountAddress + "/" + name,
+			Size:         info.Size(),
+			LastModified: info.ModTime().Unix(),
+			Encrypted:    encrypted,
+			Metadata:     metadata[accountAddress+"/"+name],
+		})
+	}
+	return blobs, nil
+}
+
+// FindBlobByDataHash returns the content-addressed blob for a data hash, else the newest
+// legacy blob named after it
+func (s *LocalStorageService) FindBlobByDataHash(accountAddress string, dataHash string) (string, error) {
+	hash := dataHashKey(dataHash)
+	if hash == "" {
+		return "", fmt.Errorf("%w: %q is not a hex data hash", ErrBlobNotFound, dataHash)
+	}
+	if len(hash) == 64 {
+		blobName := fmt.Sprintf("%s/%s.csv", accountAddress, hash)
+		if filePath, err := s.path(accountAddress, blobName); err == nil {
+			if _, err := os.Stat(filePath); err == nil {
+				return blobName, nil
+			}
+		}
+	}
+	blobs, err := s.ListBlobs(accountAddress)
+	if err != nil {
+		return "", err
+	}
+
+	match := ""
+	var matchTime int64
+	for _, blob := range blobs {
+		if strings.HasSuffix(strings.ToLower(blob.Name), "_"+hash+".csv") && (match == "" || blob.LastModified > matchTime) {
+			match, matchTime = blob.Name, blob.LastModified
+		}
+	}
+	if match == "" {
+		return "", fmt.Errorf("%w: no blob for data hash %s under %s/", ErrBlobNotFound, dataHash, accountAddress)
+	}
+	return match, nil
+}
+
+// DeleteBlob removes a blob, its statistics sidecar and its manifest entries
+func (s *LocalStorageService) DeleteBlob(accountAddress string, blobName string) error {
+	filePath, err := s.path(accountAddress, blobName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrBlobNotFound, blobName)
+		}
+		return fmt.Errorf("failed to delete blob %s: %w", blobName, err)
+	}
+	if err := os.Remove(filePath + csvStatsSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete CSV stats for %s: %w", blobName, err)
+	}
+	if err := os.Remove(filePath + encryptionMetaSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete encryption metadata for %s: %w", blobName, err)
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return fmt.Errorf("blob deleted but manifest could not be read: %w", err)
+	}
+	if removeBlobFromManifest(manifest, blobKey(accountAddress, blobName)) == 0 {
+		return nil
+	}
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// RetrieveManifest reads the account's manifest; a missing manifest is returned empty
+func (s *LocalStorageService) RetrieveManifest(accountAddress string) (models.BlobManifest, error) {
+	filePath, err := s.path(accountAddress, manifestObjectName)
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return models.BlobManifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	manifest := models.BlobManifest{}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// UpdateManifest records the blob stored for a data hash in the account's manifest
+func (s *LocalStorageService) UpdateManifest(accountAddress string, dataHash string, entry models.BlobManifestEntry) error {
+	key := NormalizeDataHash(dataHash)
+	if key == "" {
+		return fmt.Errorf("invalid data hash: %q", dataHash)
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return err
+	}
+	manifest[key] = mergeManifestEntry(manifest[key], entry)
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// SetBlobMetadata records a blob's metadata on its manifest entries; files carry no metadata of their own
+func (s *LocalStorageService) SetBlobMetadata(accountAddress string, blobName string, metadata models.BlobMetadata) error {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return err
+	}
+	if setManifestBlobMetadata(manifest, blobKey(accountAddress, blobName), metadata) == 0 {
+		return nil
+	}
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// storeManifest overwrites the account's manifest; callers hold manifestMu
+func (s *LocalStorageService) storeManifest(accountAddress string, manifest models.BlobManifest) error {
+	filePath, err := s.path(accountAddress, manifestObjectName)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return fmt.Errorf("failed to create account directory: %w", err)
+	}
+	return os.WriteFile(filePath, body, 0o644)
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+	"github.com/aptos-labs/aptos-go-sdk/api"
+	"github.com/datax/backend/config"
+)
+
+// Addresses used across the service tests
+const (
+	testModuleAddr = "0x00000000000000000000000000000000000000000000000000000000000cafe1"
+	testOwnerA     = "0x000000000000000000000000000000000000000000000000000000000000a001"
+	testOwnerB     = "0x000000000000000000000000000000000000000000000000000000000000b002"
+	testOwnerC     = "0x000000000000000000000000000000000000000000000000000000000000c003"
+)
+
+func TestMain(m *testing.M) {
+	// The tunables (marketplace concurrency, timeouts, cache TTLs) come from config
+	os.Setenv("STORAGE_BACKEND", "local")
+	if err := config.LoadConfig(); err != nil {
+		fmt.Printf("test config did not validate: %v\n", err)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeNode is a fullnode REST API answering the paths a test registers and counting the
+// requests every path gets. Unregistered paths get 404
+type fakeNode struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	routes map[string]http.HandlerFunc
+	hits   map[string]int
+}
+
+func newFakeNode(t testing.TB) *fakeNode {
+	t.Helper()
+	node := &fakeNode{routes: make(map[string]http.HandlerFunc), hits: make(map[string]int)}
+	node.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node.mu.Lock()
+		node.hits[r.URL.Path]++
+		handler := node.routes[r.URL.Path]
+		node.mu.Unlock()
+		if handler == nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(node.Close)
+	return node
+}
+
+// handle registers the handler for a request path
+func (n *fakeNode) handle(path string, handler http.HandlerFunc) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.routes[path] = handler
+}
+
+// handleJSON answers a request path with a fixed JSON body
+func (n *fakeNode) handleJSON(path string, body interface{}) {
+	n.handle(path, func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, body)
+	})
+}
+
+// count returns how many requests a path got
+func (n *fakeNode) count(path string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.hits[path]
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// newTestService creates a service whose REST calls go to node, with the default settings
+// and then the ones in edit applied. It has no indexer unless edit sets one
+func newTestService(t testing.TB, node *fakeNode, edit func(*ServiceConfig)) *AptosServiceImpl {
+	t.Helper()
+	cfg := ServiceConfigFrom(config.AppConfig)
+	cfg.AptosNodeURL = node.URL
+	cfg.AptosIndexerURL, cfg.AptosIndexerAPIKey = "", ""
+	cfg.DataXModuleAddr, cfg.NetworkModuleAddr, cfg.EscrowModuleAddr = testModuleAddr, testModuleAddr, testModuleAddr
+	cfg.ChainID = 4
+	cfg.SponsorPrivateKey = ""
+	if edit != nil {
+		edit(&cfg)
+	}
+	service, err := NewAptosServiceWithClients(nil, node.Client(), nil, cfg)
+	if err != nil {
+		t.Fatalf("NewAptosServiceWithClients: %v", err)
+	}
+	return service
+}
+
+// fakeAptosClient stands in for the SDK client, recording the entry functions submitted
+// through it. Transactions commit successfully unless vmStatus is set, and view functions
+// answer from views, keyed "Module::function"
+type fakeAptosClient struct {
+	mu        sync.Mutex
+	submitted []*aptos.EntryFunction
+	submitErr error  // Returned instead of submitting
+	waitErr   error  // Returned instead of the committed transaction, as when the node stops answering
+	vmStatus  string // Commits every transaction as failed with this status
+	views     map[string][]any
+	viewed    []*aptos.ViewPayload
+	signed    []*aptos.SignedTransaction // Submitted already signed, as sponsored transactions are
+}
+
+func (f *fakeAptosClient) BuildSignAndSubmitTransaction(sender aptos.TransactionSigner, payload aptos.TransactionPayload, options ...any) (*api.SubmitTransactionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.submitErr != nil {
+		return nil, f.submitErr
+	}
+	f.submitted = append(f.submitted, payload.Payload.(*aptos.EntryFunction))
+	return &api.SubmitTransactionResponse{Hash: fmt.Sprintf("0x%064x", len(f.submitted))}, nil
+}
+
+// BuildTransactionMultiAgent builds fee-payer transactions only, at sequence number 7 unless
+// the options give one
+func (f *fakeAptosClient) BuildTransactionMultiAgent(sender aptos.AccountAddress, payload aptos.TransactionPayload, options ...any) (*aptos.RawTransactionWithData, error) {
+	rawTxn := &aptos.RawTransaction{Sender: sender, SequenceNumber: 7, Payload: payload, MaxGasAmount: 1000, GasUnitPrice: 100, ChainId: 4}
+	var feePayer *aptos.AccountAddress
+	for _, option := range options {
+		switch value := option.(type) {
+		case aptos.FeePayer:
+			feePayer = value
+		case aptos.SequenceNumber:
+			rawTxn.SequenceNumber = uint64(value)
+		case aptos.ExpirationSeconds:
+			rawTxn.ExpirationTimestampSeconds = uint64(time.Now().Unix()) + uint64(value)
+		}
+	}
+	if feePayer == nil {
+		return nil, fmt.Errorf("fakeAptosClient: only fee payer transactions are supported")
+	}
+	return &aptos.RawTransactionWithData{
+		Variant: aptos.MultiAgentWithFeePayerRawTransactionWithDataVariant,
+		Inner: &aptos.MultiAgentWithFeePayerRawTransactionWithData{
+			RawTxn: rawTxn, SecondarySigners: []aptos.AccountAddress{}, FeePayer: feePayer,
+		},
+	}, nil
+}
+
+func (f *fakeAptosClient) SubmitTransaction(signedTransaction *aptos.SignedTransaction) (*api.SubmitTransactionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.submitErr != nil {
+		return nil, f.submitErr
+	}
+	f.signed = append(f.signed, signedTransaction)
+	return &api.SubmitTransactionResponse{Hash: fmt.Sprintf("0x%064x", 1000+len(f.signed))}, nil
+}
+
+func (f *fakeAptosClient) WaitForTransaction(txnHash string, options ...any) (*api.UserTransaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.waitErr != nil {
+		return nil, f.waitErr
+	}
+	return &api.UserTransaction{Hash: txnHash, Success: f.vmStatus == "", VmStatus: f.vmStatus}, nil
+}
+
+func (f *fakeAptosClient) View(payload *aptos.ViewPayload, ledgerVersion ...uint64) ([]any, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.viewed = append(f.viewed, payload)
+	result, ok := f.views[payload.Module.Name+"::"+payload.Function]
+	if !ok {
+		return nil, fmt.Errorf("fakeAptosClient: no view %s::%s", payload.Module.Name, payload.Function)
+	}
+	return result, nil
+}
+
+// lastSubmitted returns the entry function submitted last, failing the test without one
+func (f *fakeAptosClient) lastSubmitted(t testing.TB) *aptos.EntryFunction {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.submitted) == 0 {
+		t.Fatal("no transaction was submitted")
+	}
+	return f.submitted[len(f.submitted)-1]
+}
+
+// newFakeClientService creates a service whose SDK calls go to client, with the settings of
+// newTestService
+func newFakeClientService(t testing.TB, client *fakeAptosClient) *AptosServiceImpl {
+	t.Helper()
+	cfg := ServiceConfigFrom(config.AppConfig)
+	cfg.AptosIndexerURL, cfg.AptosIndexerAPIKey = "", ""
+	cfg.DataXModuleAddr, cfg.NetworkModuleAddr, cfg.EscrowModuleAddr = testModuleAddr, testModuleAddr, testModuleAddr
+	cfg.ChainID = 4
+	cfg.SponsorPrivateKey = ""
+	service, err := NewAptosServiceWithClients(client, nil, nil, cfg)
+	if err != nil {
+		t.Fatalf("NewAptosServiceWithClients: %v", err)
+	}
+	return service
+}
+
+// mustParseAddress parses an address for use as an entry function argument
+func mustParseAddress(t testing.TB, address string) *aptos.AccountAddress {
+	t.Helper()
+	addr, err := parseAddress(address)
+	if err != nil {
+		t.Fatalf("parseAddress(%s): %v", address, err)
+	}
+	return addr
+}
+
+// encodedArgs BCS-encodes entry function arguments the way submitTransaction does
+func encodedArgs(t testing.TB, args ...interface{}) [][]byte {
+	t.Helper()
+	encoded := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		argBytes, err := serializeArg(arg)
+		if err != nil {
+			t.Fatalf("serializeArg(%v): %v", arg, err)
+		}
+		encoded = append(encoded, argBytes)
+	}
+	return encoded
+}
+
+// dataStorePath is the REST path of an owner's DataStore resource
+func dataStorePath(owner string) string {
+	return fmt.Sprintf("/v1/accounts/%s/resource/%s::data_registry::DataStore", mustAddress(owner), mustAddress(testModuleAddr))
+}
+
+func mustAddress(address string) string {
+	addr, err := parseAddress(address)
+	if err != nil {
+		panic(err)
+	}
+	return addr.String()
+}
+
+// testDataset is an on-chain dataset as a fake DataStore reports it
+type testDataset struct {
+	id        uint64
+	dataHash  string
+	metadata  string
+	createdAt uint64
+	active    bool
+}
+
+// dataStoreResource renders datasets the way the node returns a DataStore resource
+func dataStoreResource(datasets ...testDataset) map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(datasets))
+	for _, d := range datasets {
+		rows = append(rows, map[string]interface{}{
+			"id":         strconv.FormatUint(d.id, 10),
+			"data_hash":  "0x" + d.dataHash,
+			"metadata":   "0x" + fmt.Sprintf("%x", d.metadata),
+			"created_at": strconv.FormatUint(d.createdAt, 10),
+			"is_active":  d.active,
+		})
+	}
+	return map[string]interface{}{
+		"type": mustAddress(testModuleAddr) + "::data_registry::DataStore",
+		"data": map[string]interface{}{"datasets": rows},
+	}
+}
+
+// handleTransactions serves a ledger at version tip whose transactions are txs; pages are
+// cut by the start and limit query parameters like the real API
+func (n *fakeNode) handleTransactions(tip uint64, txs []map[string]interface{}) {
+	n.handleJSON("/v1", map[string]interface{}{"chain_id": 4, "ledger_version": strconv.FormatUint(tip, 10)})
+	n.handle("/v1/transactions", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.ParseUint(r.URL.Query().Get("start"), 10, 64)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		page := make([]map[string]interface{}, 0)
+		for _, tx := range txs {
+			version, _ := strconv.ParseUint(tx["version"].(string), 10, 64)
+			if version >= start && (limit == 0 || len(page) < limit) {
+				page = append(page, tx)
+			}
+		}
+		writeTestJSON(w, http.StatusOK, page)
+	})
+}
+
+// submitDataTransaction is a successful submit_data call by sender at version
+func submitDataTransaction(version uint64, sender string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "user_transaction",
+		"version": strconv.FormatUint(version, 10),
+		"sender":  mustAddress(sender),
+		"success": true,
+		"payload": map[string]interface{}{
+			"type":     "entry_function_payload",
+			"function": mustAddress(testModuleAddr) + "::data_registry::submit_data",
+		},
+	}
+}
+
+// fakeIndexer is a GraphQL endpoint answering every query with the rows of one table
+type fakeIndexer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	queries []string
+}
+
+func newFakeIndexer(t testing.TB, table string, rows []map[string]interface{}) *fakeIndexer {
+	t.Helper()
+	indexer := &fakeIndexer{}
+	indexer.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query string `json:"query"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		indexer.mu.Lock()
+		indexer.queries = append(indexer.queries, request.Query)
+		indexer.mu.Unlock()
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{table: rows}})
+	}))
+	t.Cleanup(indexer.Close)
+	return indexer
+}
+
+// marketplaceRow is a datax_marketplace row as the indexer returns it
+func marketplaceRow(owner string, id uint64, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"user":       mustAddress(owner),
+		"dataset_id": strconv.FormatUint(id, 10),
+		"data_hash":  fmt.Sprintf("%064x", id+1),
+		"metadata":   fmt.Sprintf(`{"name":%q,"description":"test"}`, name),
+	}
+}
+
+// datasetNamesOf returns the "name" of every dataset on a marketplace page, in order
+func datasetNamesOf(datasets []interface{}) []string {
+	names := make([]string, 0, len(datasets))
+	for _, d := range datasets {
+		name, _ := d.(map[string]interface{})["name"].(string)
+		names = append(names, name)
+	}
+	return names
+}
+
+func joinNames(names []string) string {
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/datax/backend/models"
+)
+
+// manifestObjectName is the per-owner object mapping data hashes to blobs, {owner}/manifest.json
+const manifestObjectName = "manifest.json"
+
+// NormalizeDataHash returns the manifest key for a data hash ("0x" + lowercase hex),
+// or "" when it isn't a hex string
+func NormalizeDataHash(dataHash string) string {
+	key := dataHashKey(dataHash)
+	if key == "" {
+		return ""
+	}
+	return "0x" + key
+}
+
+// FrontendDataHash reproduces the data hash the upload page puts on chain: the SHA-256 of
+// JSON.stringify(rows), where rows come from its line-based parser (blank lines dropped,
+// quotes toggled rather than unescaped, cells trimmed). It is only used to backfill
+// manifests for blobs stored before they were named by data hash
+func FrontendDataHash(body []byte) string {
+	trim := func(s string) string {
+		return strings.TrimFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '\uFEFF' })
+	}
+
+	rows := [][]string{}
+	for _, line := range strings.Split(string(body), "\n") {
+		if trim(line) == "" {
+			continue
+		}
+		var row []string
+		var cell strings.Builder
+		inQuotes := false
+		for _, r := range line {
+			switch {
+			case r == '"':
+				inQuotes = !inQuotes
+			case r == ',' && !inQuotes:
+				row = append(row, trim(cell.String()))
+				cell.Reset()
+			default:
+				cell.WriteRune(r)
+			}
+		}
+		rows = append(rows, append(row, trim(cell.String())))
+	}
+
+	// JSON.stringify doesn't escape <, > or &. It also leaves U+2028/U+2029 alone, which
+	// encoding/json always escapes, so blobs containing those won't hash the same
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(rows); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+// RetrieveManifest reads an owner's manifest; a missing manifest is returned empty
+func (s *SupabaseServiceImpl) RetrieveManifest(accountAddress string) (models.BlobManifest, error) {
+	body, _, err := s.getObjectBytes(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(accountAddress + "/" + manifestObjectName),
+	})
+	if err != nil {
+		var noSuchKey *s3Types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return models.BlobManifest{}, nil
+		}
+		return nil, fmt.Errorf("failed to download manifest from Supabase S3: %w", err)
+	}
+
+	manifest := models.BlobManifest{}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// UpdateManifest records the blob stored for a data hash in the owner's manifest
+// Updates are read-modify-write, serialized within this process
+func (s *SupabaseServiceImpl) UpdateManifest(accountAddress string, dataHash string, entry models.BlobManifestEntry) error {
+	key := NormalizeDataHash(dataHash)
+	if key == "" {
+		return fmt.Errorf("invalid data hash: %q", dataHash)
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return err
+	}
+	manifest[key] = mergeManifestEntry(manifest[key], entry)
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// storeManifest overwrites an owner's manifest; callers hold manifestMu
+func (s *SupabaseServiceImpl) storeManifest(accountAddress string, manifest models.BlobManifest) error {
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	key := accountAddress + "/" + manifestObjectName
+	_, err = s.putObjectBytes(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String("application/json"),
+	}, body)
+	if err != nil {
+		return fmt.Errorf("failed to upload manifest to Supabase S3: %w", err)
+	}
+
+	fmt.Printf("DEBUG: Stored manifest with %d entries at %s\n", len(manifest), key)
+	return nil
+}
+
+// setManifestBlobMetadata attaches metadata to every entry stored under blobName and returns
+// how many entries changed
+func setManifestBlobMetadata(manifest models.BlobManifest, blobName string, metadata models.BlobMetadata) int {
+	changed := 0
+	for dataHash, entry := range manifest {
+		if entry.BlobName != blobName && !containsString(entry.LegacyBlobNames, blobName) {
+			continue
+		}
+		m := metadata
+		entry.Metadata = &m
+		manifest[dataHash] = entry
+		changed++
+	}
+	return changed
+}
+
+// manifestBlobMetadata indexes the metadata recorded in a manifest by blob name
+func manifestBlobMetadata(manifest models.BlobManifest) map[string]*models.BlobMetadata {
+	byName := make(map[string]*models.BlobMetadata)
+	for _, entry := range manifest {
+		if entry.Metadata == nil {
+			continue
+		}
+		byName[entry.BlobName] = entry.Metadata
+		for _, name := range entry.LegacyBlobNames {
+			if byName[name] == nil {
+				byName[name] = entry.Metadata
+			}
+		}
+	}
+	return byName
+}
+
+// removeBlobFromManifest drops blobName from every entry and returns how many entries changed
+// An entry whose blob is removed falls back to one of its legacy blobs, or is dropped
+func removeBlobFromManifest(manifest models.BlobManifest, blobName string) int {
+	removed := 0
+	for dataHash, entry := range manifest {
+		legacy := make([]string, 0, len(entry.LegacyBlobNames))
+		for _, name := range entry.LegacyBlobNames {
+			if name != blobName {
+				legacy = append(legacy, name)
+			}
+		}
+		if entry.BlobName != blobName && len(legacy) == len(entry.LegacyBlobNames) {
+			continue
+		}
+		removed++
+
+		if entry.BlobName == blobName {
+			if len(legacy) == 0 {
+				delete(manifest, dataHash)
+				continue
+			}
+			entry.BlobName = legacy[len(legacy)-1]
+			legacy = legacy[:len(legacy)-1]
+		}
+		if len(legacy) == 0 {
+			legacy = nil
+		}
+		entry.LegacyBlobNames = legacy
+		manifest[dataHash] = entry
+	}
+	return removed
+}
+
+// recordUpload adds a freshly stored blob to the owner's manifest. The blob is already
+// stored, so a failure is only logged; FindBlobByDataHash can still locate it by name
+func (s *SupabaseServiceImpl) recordUpload(accountAddress string, dataHash string, blobName string, size int64) {
+	if NormalizeDataHash(dataHash) == "" {
+		return
+	}
+	err := s.UpdateManifest(accountAddress, dataHash, models.BlobManifestEntry{
+		BlobName:   blobName,
+		UploadedAt: time.Now().Unix(),
+		Size:       size,
+	})
+	if err != nil {
+		fmt.Printf("ERROR: Failed to record %s in manifest for %s: %v\n", blobName, accountAddress, err)
+	}
+}
+
+// RebuildManifest backfills an owner's manifest from the CSV objects under {owner}/
+// Blobs named by data hash ({hash}.csv or {timestamp}_{hash}.csv) map directly; older blobs are
+// downloaded and hashed the way the upload page hashes them. Entries already in the manifest
+// are kept as recorded at upload, except that other blobs found for the same hash are added
+// as legacy names and a content-addressed blob takes over from a timestamp-named one.
+// It returns the manifest and the number of entries added
+func (s *SupabaseServiceImpl) RebuildManifest(accountAddress string) (models.BlobManifest, int, error) {
+	ctx := context.Background()
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(accountAddress + "/"),
+	})
+
+	found := models.BlobManifest{}
+	scanned := 0
+	for paginator.HasMorePages() {
+		page, err := nextListPage(ctx, paginator)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if obj.Key == nil || !strings.HasSuffix(*obj.Key, ".csv") {
+				continue
+			}
+			scanned++
+			entry := models.BlobManifestEntry{BlobName: *obj.Key, Size: aws.ToInt64(obj.Size)}
+			if obj.LastModified != nil {
+				entry.UploadedAt = obj.LastModified.Unix()
+			}
+
+			// The name carries the full data hash when it is 32 bytes long; only a
+			// content-addressed name, or a hash of the bytes, verifies the blob
+			dataHash := ""
+			if hash := BlobNameHash(*obj.Key); len(hash) == 64 {
+				dataHash = NormalizeDataHash(hash)
+				entry.Verified = isContentAddressedBlob(*obj.Key)
+			} else {
+				dataHash, err = s.hashBlob(ctx, *obj.Key)
+				if err != nil {
+					fmt.Printf("ERROR: Skipping %s in manifest backfill: %v\n", *obj.Key, err)
+					continue
+				}
+				entry.Verified = true
+			}
+
+			// Among timestamp-named blobs the newest is primary; a content-addressed one always is
+			if existing, ok := found[dataHash]; !ok || entry.UploadedAt > existing.UploadedAt {
+				found[dataHash] = mergeManifestEntry(existing, entry)
+			} else {
+				found[dataHash] = mergeManifestEntry(entry, existing)
+			}
+		}
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return nil, 0, err
+	}
+	added, changed := 0, 0
+	for dataHash, entry := range found {
+		existing, ok := manifest[dataHash]
+		if !ok {
+			manifest[dataHash] = entry
+			added++
+			continue
+		}
+		merged := mergeManifestEntry(entry, existing)
+		if merged.BlobName != existing.BlobName || merged.Verified != existing.Verified || len(merged.LegacyBlobNames) != len(existing.LegacyBlobNames) {
+			manifest[dataHash] = merged
+			changed++
+		}
+	}
+	if added > 0 || changed > 0 {
+		if err := s.storeManifest(accountAddress, manifest); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	fmt.Printf("DEBUG: Manifest backfill for %s: %d blobs scanned into %d hashes, %d added, %d updated\n", accountAddress, scanned, len(found), added, changed)
+	return manifest, added, nil
+}
+
+// hashBlob downloads a CSV object and returns its FrontendDataHash
+func (s *SupabaseServiceImpl) hashBlob(ctx context.Context, key string) (string, error) {
+	body, _, err := s.getObjectBytes(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to download from Supabase S3: %w", err)
+	}
+	return FrontendDataHash(body), nil
+}
@@ -0,0 +1,671 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/internal/store"
+	"github.com/datax/backend/models"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrInvalidCursor is returned when a marketplace pagination cursor can't be decoded
+// or no longer points into the current snapshot
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Marketplace data sources, reported per entry and per snapshot
+const (
+	marketplaceSourceIndexer    = "indexer"
+	marketplaceSourceBlockchain = "blockchain"
+	marketplaceSourceMerged     = "indexer+blockchain" // Indexer rows plus on-chain datasets it hadn't synced
+	marketplaceSourceLocal      = "local"              // Local event index (SOURCE=local)
+)
+
+// maxSnapshotResponses bounds the encoded pages a snapshot keeps; pages asked for beyond it
+// (more searches or cursors than that within one MARKETPLACE_CACHE_TTL) are encoded per request
+const maxSnapshotResponses = 256
+
+// marketplaceEntry is one dataset in a marketplace snapshot
+type marketplaceEntry struct {
+	data     map[string]interface{}
+	owner    string // Normalized owner address
+	id       uint64
+	sortKey  uint64 // created_at, confirmed from chain for indexer rows before the snapshot is ordered
+	verified bool   // is_active and created_at confirmed from the owner's DataStore
+}
+
+// marketplaceSnapshot is an assembled, ordered marketplace listing
+// Entries are ordered newest first by (sortKey desc, owner, id); the order never
+// changes for the lifetime of the snapshot so cursors stay valid between pages
+type marketplaceSnapshot struct {
+	mu          sync.Mutex // Protects entry data and verified flags
+	entries     []*marketplaceEntry
+	source      string // One of the marketplaceSource values
+	refreshedAt time.Time
+	partial     bool // MARKETPLACE_TIMEOUT ran out before every owner was read; never cached
+
+	responsesMu sync.Mutex
+	responses   map[string]*EncodedResponse // Pages already encoded from this snapshot, by filter and shape
+}
+
+// EncodedResponse is a JSON response body encoded once, with the ETag it is served under
+type EncodedResponse struct {
+	Body []byte
+	ETag string // Quoted hex SHA-256 of Body
+}
+
+// NewEncodedResponse encodes response as JSON and tags it with the hash of the encoding
+func NewEncodedResponse(response interface{}) (*EncodedResponse, error) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	return &EncodedResponse{Body: body, ETag: `"` + hex.EncodeToString(sum[:]) + `"`}, nil
+}
+
+// entryBefore reports whether a sorts before b in marketplace order
+func entryBefore(aKey uint64, aOwner string, aID uint64, bKey uint64, bOwner string, bID uint64) bool {
+	if aKey != bKey {
+		return aKey > bKey
+	}
+	if aOwner != bOwner {
+		return aOwner < bOwner
+	}
+	return aID < bID
+}
+
+// encodeMarketplaceCursor encodes the (created_at, owner, id) tuple of the last entry on a page
+func encodeMarketplaceCursor(e *marketplaceEntry) string {
+	raw := fmt.Sprintf("%d:%s:%d", e.sortKey, e.owner, e.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeMarketplaceCursor decodes a cursor produced by encodeMarketplaceCursor
+func decodeMarketplaceCursor(cursor string) (uint64, string, uint64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", 0, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return 0, "", 0, ErrInvalidCursor
+	}
+	sortKey, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return 0, "", 0, ErrInvalidCursor
+	}
+	return sortKey, parts[1], id, nil
+}
+
+// GetMarketplaceDatasets returns a page of marketplace datasets
+// Uses Geomi indexer to fetch data from datax_marketplace table, with blockchain fallback.
+// The unfiltered listing is cached as a snapshot for MARKETPLACE_CACHE_TTL seconds. Every
+// snapshot entry has is_active and created_at confirmed from its owner's DataStore, so pages
+// are ordered by the real created_at and the totals count only datasets that pass the filter.
+// Chain reads share a MARKETPLACE_TIMEOUT deadline; owners not read by then are left out and
+// the page is returned with Partial set, as it is when ctx ends first
+func (s *AptosServiceImpl) GetMarketplaceDatasets(ctx context.Context, filter models.MarketplaceFilter) (*models.MarketplacePage, error) {
+	fmt.Printf("DEBUG: GetMarketplaceDatasets called\n")
+
+	snapshot, filter, err := s.marketplaceSnapshotFor(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := marketplacePage(snapshot, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("DEBUG: GetMarketplaceDatasets returning %d of %d datasets (source: %s)\n", len(page.Datasets), page.TotalCount, snapshot.source)
+	return page, nil
+}
+
+// GetMarketplaceResponse returns the page GetMarketplaceDatasets would, encoded as the body
+// of a successful models.Response: the page itself when envelope is set, its datasets alone
+// otherwise. Each page is encoded and hashed once per snapshot, so pollers of an unchanged
+// listing are answered from the cached body and ETag
+func (s *AptosServiceImpl) GetMarketplaceResponse(ctx context.Context, filter models.MarketplaceFilter, envelope bool) (*EncodedResponse, error) {
+	snapshot, filter, err := s.marketplaceSnapshotFor(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.encodedPage(filter, envelope)
+}
+
+// marketplaceSnapshotFor loads the snapshot a marketplace request is paged from, under the
+// MARKETPLACE_TIMEOUT deadline, and returns the filter with its owner normalized
+func (s *AptosServiceImpl) marketplaceSnapshotFor(ctx context.Context, filter models.MarketplaceFilter) (*marketplaceSnapshot, models.MarketplaceFilter, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Tunable().MarketplaceTimeout)*time.Second)
+	defer cancel()
+
+	// Normalize the owner so it matches the address form stored on-chain and in the indexer
+	if filter.Owner != "" {
+		ownerAddr, err := parseAddress(filter.Owner)
+		if err != nil {
+			return nil, filter, fmt.Errorf("invalid owner filter: %w", err)
+		}
+		filter.Owner = ownerAddr.String()
+	}
+
+	snapshot, err := s.loadMarketplaceSnapshot(ctx, filter.Owner)
+	if err != nil {
+		return nil, filter, err
+	}
+	if snapshot.partial {
+		fmt.Printf("WARNING: Marketplace listing is partial, not every owner could be read within MARKETPLACE_TIMEOUT (%ds)\n", config.Tunable().MarketplaceTimeout)
+	}
+	return snapshot, filter, nil
+}
+
+// encodedPage returns the page for filter encoded as GetMarketplaceResponse describes,
+// encoding it only the first time this snapshot is asked for it
+func (snapshot *marketplaceSnapshot) encodedPage(filter models.MarketplaceFilter, envelope bool) (*EncodedResponse, error) {
+	key := fmt.Sprintf("%t %#v", envelope, filter)
+	snapshot.responsesMu.Lock()
+	cached, ok := snapshot.responses[key]
+	snapshot.responsesMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	page, err := marketplacePage(snapshot, filter)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{} = page.Datasets
+	if envelope {
+		data = page
+	}
+	encoded, err := NewEncodedResponse(models.Response{Success: true, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode marketplace page: %w", err)
+	}
+
+	snapshot.responsesMu.Lock()
+	if snapshot.responses == nil {
+		snapshot.responses = make(map[string]*EncodedResponse)
+	}
+	if len(snapshot.responses) < maxSnapshotResponses {
+		snapshot.responses[key] = encoded
+	}
+	snapshot.responsesMu.Unlock()
+	fmt.Printf("DEBUG: Encoded marketplace page of %d of %d datasets, %d bytes (source: %s)\n", len(page.Datasets), page.TotalCount, len(encoded.Body), snapshot.source)
+	return encoded, nil
+}
+
+// marketplacePage filters, searches and pages a snapshot whose entries are all verified
+func marketplacePage(snapshot *marketplaceSnapshot, filter models.MarketplaceFilter) (*models.MarketplacePage, error) {
+	// The summary describes the whole listing, so only the owner scope applies to it
+	summary := models.MarketplaceFilter{Owner: filter.Owner}
+
+	snapshot.mu.Lock()
+	candidates := make([]*marketplaceEntry, 0, len(snapshot.entries))
+	listed := 0
+	owners := make(map[string]bool)
+	for _, e := range snapshot.entries {
+		if entryMatchesFilter(e, filter) {
+			candidates = append(candidates, e)
+		}
+		if entryMatchesFilter(e, summary) {
+			listed++
+			owners[e.owner] = true
+		}
+	}
+	snapshot.mu.Unlock()
+
+	if filter.Query != "" {
+		candidates = searchEntries(snapshot, candidates, filter.Query)
+	}
+
+	start, err := marketplaceCursorPosition(candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+	end := len(candidates)
+	if filter.Limit > 0 && start+filter.Limit < end {
+		end = start + filter.Limit
+	}
+
+	page := &models.MarketplacePage{
+		Datasets:        make([]interface{}, 0, end-start),
+		TotalCount:      len(candidates),
+		TotalDatasets:   listed,
+		UniqueOwners:    len(owners),
+		LastRefreshedAt: snapshot.refreshedAt.UTC().Format(time.RFC3339),
+		Source:          snapshot.source,
+		Partial:         snapshot.partial,
+	}
+
+	snapshot.mu.Lock()
+	for _, e := range candidates[start:end] {
+		// Hand out copies so callers never share a cached snapshot's maps
+		dataset := make(map[string]interface{}, len(e.data))
+		for k, v := range e.data {
+			dataset[k] = v
+		}
+		MarkReactivatable(dataset)
+		page.Datasets = append(page.Datasets, dataset)
+	}
+	snapshot.mu.Unlock()
+
+	if end < len(candidates) && end > start {
+		page.NextCursor = encodeMarketplaceCursor(candidates[end-1])
+	}
+	return page, nil
+}
+
+// entryMatchesFilter applies the owner, category/tag, is_active, and created_at filters to an entry
+// Unverified entries can't be judged on activity and never match
+// Callers must hold the snapshot lock
+func entryMatchesFilter(e *marketplaceEntry, filter models.MarketplaceFilter) bool {
+	if !e.verified {
+		return false
+	}
+	if filter.Owner != "" && e.owner != filter.Owner {
+		return false
+	}
+	if !datasetMatchesCategory(e.data, filter.Category, filter.Tags) {
+		return false
+	}
+
+	if isActive, _ := e.data["is_active"].(bool); !isActive && !filter.IncludeInactive {
+		return false
+	}
+
+	createdAt, _ := e.data["created_at"].(uint64)
+	if filter.CreatedAfter > 0 && createdAt < filter.CreatedAfter {
+		return false
+	}
+	if filter.CreatedBefore > 0 && createdAt > filter.CreatedBefore {
+		return false
+	}
+	return true
+}
+
+// searchEntries keeps the entries matching the query, ordered by relevance
+// Ties keep marketplace order, so results are deterministic between pages
+func searchEntries(snapshot *marketplaceSnapshot, entries []*marketplaceEntry, query string) []*marketplaceEntry {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	type scoredEntry struct {
+		entry *marketplaceEntry
+		score int
+	}
+
+	snapshot.mu.Lock()
+	matches := make([]scoredEntry, 0)
+	for _, e := range entries {
+		if score := scoreDataset(e.data, query); score > 0 {
+			matches = append(matches, scoredEntry{entry: e, score: score})
+		}
+	}
+	snapshot.mu.Unlock()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	results := make([]*marketplaceEntry, 0, len(matches))
+	for _, m := range matches {
+		results = append(results, m.entry)
+	}
+
+	fmt.Printf("DEBUG: Search %q matched %d of %d datasets\n", query, len(results), len(entries))
+	return results
+}
+
+// marketplaceCursorPosition returns the index of the first entry after the cursor
+func marketplaceCursorPosition(entries []*marketplaceEntry, filter models.MarketplaceFilter) (int, error) {
+	if filter.Cursor == "" {
+		return 0, nil
+	}
+
+	sortKey, owner, id, err := decodeMarketplaceCursor(filter.Cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	// Search results are ordered by relevance, so the cursor must point at an exact entry
+	if filter.Query != "" {
+		for i, e := range entries {
+			if e.sortKey == sortKey && e.owner == owner && e.id == id {
+				return i + 1, nil
+			}
+		}
+		return 0, ErrInvalidCursor
+	}
+
+	// Default order: the first entry sorting after the cursor tuple (works even if that entry is gone)
+	return sort.Search(len(entries), func(i int) bool {
+		e := entries[i]
+		return entryBefore(sortKey, owner, id, e.sortKey, e.owner, e.id)
+	}), nil
+}
+
+// loadMarketplaceSnapshot returns the cached marketplace snapshot, refreshing it when stale
+// Owner-scoped listings and listings from the local event index are cheap to assemble and are not cached,
+// and neither is a partial snapshot, so the next request tries again
+func (s *AptosServiceImpl) loadMarketplaceSnapshot(ctx context.Context, owner string) (*marketplaceSnapshot, error) {
+	if index := s.localIndex(); index != nil {
+		snapshot, err := assembleLocalMarketplaceSnapshot(index, owner)
+		if err == nil {
+			return snapshot, nil
+		}
+		fmt.Printf("WARNING: Local index marketplace read failed, querying remotely: %v\n", err)
+	}
+
+	if owner != "" {
+		return s.assembleMarketplaceSnapshot(ctx, owner)
+	}
+
+	s.marketplaceMu.Lock()
+	defer s.marketplaceMu.Unlock()
+
+	ttl := time.Duration(config.Tunable().MarketplaceCacheTTL) * time.Second
+	if s.marketplaceCache != nil && time.Since(s.marketplaceCache.refreshedAt) < ttl {
+		fmt.Printf("DEBUG: Using cached marketplace snapshot (age %v)\n", time.Since(s.marketplaceCache.refreshedAt).Round(time.Second))
+		return s.marketplaceCache, nil
+	}
+
+	snapshot, err := s.assembleMarketplaceSnapshot(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	if !snapshot.partial {
+		s.marketplaceCache = snapshot
+	}
+	return snapshot, nil
+}
+
+// assembleMarketplaceSnapshot builds an ordered snapshot from the indexer, falling back to the blockchain
+// When the indexer has rows it may still be lagging behind recent submissions, so the DataStores of
+// recent submitters are read from chain and merged in. Indexer rows carry neither is_active nor
+// created_at, so they are verified against their owners' DataStores before the snapshot is
+// ordered; rows that can't be verified are left out. Every dataset carries a "source" field
+// saying where its entry came from. It is partial when some owner's DataStore couldn't be read
+func (s *AptosServiceImpl) assembleMarketplaceSnapshot(ctx context.Context, owner string) (*marketplaceSnapshot, error) {
+	snapshot := &marketplaceSnapshot{refreshedAt: time.Now()}
+
+	var indexerRows []map[string]interface{}
+	if s.cfg.AptosIndexerURL != "" {
+		// Try to query from Geomi indexer first
+		fmt.Printf("DEBUG: Attempting to query Geomi indexer for marketplace data...\n")
+		rows, err := s.queryMarketplaceFromGeomiIndexer(owner)
+		if err != nil {
+			fmt.Printf("DEBUG: Failed to query Geomi indexer: %v\n", err)
+		} else if len(rows) == 0 {
+			// If indexer returns 0 datasets, it might be empty OR it might be out of sync/broken
+			fmt.Printf("DEBUG: No datasets found in indexer, falling back to blockchain query to be sure\n")
+		} else {
+			indexerRows = rows
+		}
+	} else {
+		fmt.Printf("DEBUG: Indexer URL not configured, falling back to blockchain query\n")
+	}
+
+	var chainRows []map[string]interface{}
+	if len(indexerRows) == 0 {
+		datasets, err := s.getMarketplaceDatasetsFromBlockchain(ctx, owner)
+		if err != nil {
+			return nil, err
+		}
+		chainRows = datasetMaps(datasets)
+		snapshot.source = marketplaceSourceBlockchain
+	} else {
+		snapshot.source = marketplaceSourceIndexer
+		chainRows = s.queryLaggingOwners(ctx, owner)
+		if len(chainRows) > 0 {
+			snapshot.source = marketplaceSourceMerged
+		}
+	}
+
+	for _, row := range indexerRows {
+		row["source"] = marketplaceSourceIndexer
+	}
+	for _, row := range chainRows {
+		row["source"] = marketplaceSourceBlockchain
+	}
+
+	// Chain rows go first so they win de-duplication on (owner, id): their is_active is authoritative
+	seen := make(map[string]bool, len(chainRows)+len(indexerRows))
+	for _, row := range append(chainRows, indexerRows...) {
+		ownerStr, _ := row["owner"].(string)
+		ownerAddr, err := parseAddress(ownerStr)
+		if err != nil {
+			fmt.Printf("DEBUG: Skipping marketplace entry with invalid owner %q: %v\n", ownerStr, err)
+			continue
+		}
+		id, _ := row["id"].(uint64)
+		key := fmt.Sprintf("%s-%d", ownerAddr.String(), id)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		liftDatasetMetadata(row)
+
+		createdAt, _ := row["created_at"].(uint64)
+		snapshot.entries = append(snapshot.entries, &marketplaceEntry{
+			data:     row,
+			owner:    ownerAddr.String(),
+			id:       id,
+			sortKey:  createdAt,
+			verified: row["source"] == marketplaceSourceBlockchain,
+		})
+	}
+
+	failed, complete := s.verifyMarketplaceEntries(ctx, snapshot, snapshot.entries)
+	verified := make([]*marketplaceEntry, 0, len(snapshot.entries))
+	for _, e := range snapshot.entries {
+		if !failed[e] {
+			verified = append(verified, e)
+		}
+	}
+	snapshot.entries = verified
+
+	sort.Slice(snapshot.entries, func(i, j int) bool {
+		a, b := snapshot.entries[i], snapshot.entries[j]
+		return entryBefore(a.sortKey, a.owner, a.id, b.sortKey, b.owner, b.id)
+	})
+	snapshot.partial = !complete || ctx.Err() != nil
+
+	fmt.Printf("DEBUG: Assembled marketplace snapshot with %d entries from %s\n", len(snapshot.entries), snapshot.source)
+	return snapshot, nil
+}
+
+// assembleLocalMarketplaceSnapshot builds an ordered snapshot from the local event index
+// The index tracks deletions, so its entries are verified and need no chain round trips
+func assembleLocalMarketplaceSnapshot(index *store.Store, owner string) (*marketplaceSnapshot, error) {
+	datasets, err := index.Datasets(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &marketplaceSnapshot{refreshedAt: time.Now(), source: marketplaceSourceLocal}
+	for _, dataset := range datasets {
+		row := map[string]interface{}{
+			"id":         dataset.ID,
+			"owner":      dataset.Owner,
+			"data_hash":  dataset.DataHash,
+			"metadata":   dataset.Metadata,
+			"created_at": dataset.CreatedAt,
+			"is_active":  dataset.IsActive,
+			"source":     marketplaceSourceLocal,
+		}
+		liftDatasetMetadata(row)
+		snapshot.entries = append(snapshot.entries, &marketplaceEntry{
+			data:     row,
+			owner:    dataset.Owner,
+			id:       dataset.ID,
+			sortKey:  dataset.CreatedAt,
+			verified: true,
+		})
+	}
+
+	sort.Slice(snapshot.entries, func(i, j int) bool {
+		a, b := snapshot.entries[i], snapshot.entries[j]
+		return entryBefore(a.sortKey, a.owner, a.id, b.sortKey, b.owner, b.id)
+	})
+	return snapshot, nil
+}
+
+// queryLaggingOwners reads the on-chain datasets of owners who submitted recently, since
+// the indexer may not have synced those submissions yet (typical in the first minute)
+// Failures are logged and ignored - the indexer rows are still usable on their own
+func (s *AptosServiceImpl) queryLaggingOwners(ctx context.Context, owner string) []map[string]interface{} {
+	var recent []string
+	if owner != "" {
+		recent = []string{owner}
+	} else {
+		// Only the submitters found since the last scan can be ahead of the indexer
+		users, err := s.scanSubmitDataTransactions()
+		if err != nil {
+			fmt.Printf("DEBUG: Could not check for recent submissions missing from indexer: %v\n", err)
+			return nil
+		}
+		recent = users
+	}
+
+	if len(recent) == 0 {
+		return nil
+	}
+
+	datasets, err := s.queryDatasetsFromDataStores(ctx, recent)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to read DataStores of recent submitters: %v\n", err)
+		return nil
+	}
+
+	fmt.Printf("DEBUG: Merging %d on-chain datasets from %d recent submitters\n", len(datasets), len(recent))
+	return datasetMaps(datasets)
+}
+
+// datasetMaps keeps the map-shaped entries of a dataset list
+func datasetMaps(datasets []interface{}) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(datasets))
+	for _, d := range datasets {
+		if datasetMap, ok := d.(map[string]interface{}); ok {
+			rows = append(rows, datasetMap)
+		}
+	}
+	return rows
+}
+
+// verifyMarketplaceEntries confirms is_active and created_at from the blockchain for unverified entries
+// The indexer only tracks DataSubmit events, not deletions, so we must check the chain
+// Entries are grouped by owner so each owner's DataStore resource is fetched exactly once
+// Returns the entries that could not be verified, including those of owners not reached before
+// ctx ended, which should be left out of results; complete is false when some owner's DataStore
+// couldn't be read, as opposed to the dataset simply not being on chain
+func (s *AptosServiceImpl) verifyMarketplaceEntries(ctx context.Context, snapshot *marketplaceSnapshot, entries []*marketplaceEntry) (failed map[*marketplaceEntry]bool, complete bool) {
+	snapshot.mu.Lock()
+	byOwner := make(map[string][]*marketplaceEntry)
+	pending := 0
+	for _, e := range entries {
+		if !e.verified {
+			byOwner[e.owner] = append(byOwner[e.owner], e)
+			pending++
+		}
+	}
+	snapshot.mu.Unlock()
+
+	failed = make(map[*marketplaceEntry]bool)
+	if pending == 0 {
+		return failed, true
+	}
+
+	fmt.Printf("DEBUG: Verifying is_active status from blockchain for %d datasets across %d owners...\n", pending, len(byOwner))
+
+	// Verify owners concurrently, MARKETPLACE_CONCURRENCY at a time
+	// An owner that fails is skipped; only running out of time stops the whole group
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(max(config.Tunable().MarketplaceConcurrency, 1))
+	var failedMu sync.Mutex
+	var unread atomic.Bool
+
+	markFailed := func(batch []*marketplaceEntry) {
+		failedMu.Lock()
+		for _, e := range batch {
+			failed[e] = true
+		}
+		failedMu.Unlock()
+	}
+
+	for owner, ownerEntries := range byOwner {
+		group.Go(func() error {
+			if err := groupCtx.Err(); err != nil {
+				markFailed(ownerEntries)
+				unread.Store(true)
+				return err
+			}
+
+			// One DataStore fetch covers every dataset of this owner
+			datasets, err := s.userDatasetsMetadata(groupCtx, owner)
+			if err != nil {
+				markFailed(ownerEntries)
+				unread.Store(true)
+				if groupCtx.Err() != nil {
+					return groupCtx.Err()
+				}
+				fmt.Printf("DEBUG: Failed to verify %d datasets for owner %s: %v, skipping\n", len(ownerEntries), owner, err)
+				return nil
+			}
+
+			onChain := make(map[uint64]map[string]interface{}, len(datasets))
+			for _, d := range datasets {
+				if datasetMap, ok := d.(map[string]interface{}); ok {
+					if id, ok := datasetMap["id"].(uint64); ok {
+						onChain[id] = datasetMap
+					}
+				}
+			}
+
+			missing := make([]*marketplaceEntry, 0)
+			snapshot.mu.Lock()
+			for _, entry := range ownerEntries {
+				datasetMap, ok := onChain[entry.id]
+				if !ok {
+					missing = append(missing, entry)
+					continue
+				}
+				// The indexer doesn't carry created_at, so the chain value is authoritative
+				isActive, _ := datasetMap["is_active"].(bool)
+				createdAt, _ := datasetMap["created_at"].(uint64)
+				entry.data["is_active"] = isActive
+				entry.data["created_at"] = createdAt
+				entry.sortKey = createdAt
+				entry.verified = true
+			}
+			snapshot.mu.Unlock()
+
+			if len(missing) > 0 {
+				fmt.Printf("DEBUG: %d datasets for owner %s not found on-chain, skipping\n", len(missing), owner)
+				markFailed(missing)
+			}
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		fmt.Printf("WARNING: Stopped verifying marketplace datasets before every owner was read: %v\n", err)
+	}
+	return failed, !unread.Load()
+}
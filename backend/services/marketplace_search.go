@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/datax/backend/models"
+)
+
+// Relevance weights - a name match always ranks above a description match
+const (
+	scoreNameMatch        = 8
+	scoreTagMatch         = 4
+	scoreDescriptionMatch = 2
+	scoreOwnerMatch       = 1
+	scoreRawMatch         = 1
+)
+
+// decodeMetadataString converts metadata that is still in its on-chain byte-vector
+// form (a 0x-prefixed hex string) into UTF-8 text. Anything else is returned as-is.
+func decodeMetadataString(raw string) string {
+	if !strings.HasPrefix(raw, "0x") {
+		return raw
+	}
+	decoded, err := hex.DecodeString(strings.TrimPrefix(raw, "0x"))
+	if err != nil || !utf8.Valid(decoded) {
+		return raw
+	}
+	return string(decoded)
+}
+
+// scoreDataset returns how well a marketplace entry matches the lowercased query (0 = no match)
+func scoreDataset(dataset map[string]interface{}, query string) int {
+	score := 0
+
+	owner, _ := dataset["owner"].(string)
+	if strings.HasPrefix(strings.ToLower(owner), query) ||
+		strings.HasPrefix(strings.TrimPrefix(strings.ToLower(owner), "0x"), strings.TrimPrefix(query, "0x")) {
+		score += scoreOwnerMatch
+	}
+
+	rawMetadata, _ := dataset["metadata"].(string)
+	parsed, extra := ParseDatasetMetadata(rawMetadata)
+
+	if text, ok := extra.(string); ok {
+		// Metadata isn't JSON (older free-text entries) - fall back to a raw substring match
+		if strings.Contains(strings.ToLower(text), query) {
+			score += scoreRawMatch
+		}
+		return score
+	}
+
+	if strings.Contains(strings.ToLower(parsed.Name), query) {
+		score += scoreNameMatch
+	}
+	for _, tag := range parsed.Tags {
+		if strings.Contains(strings.ToLower(tag), query) {
+			score += scoreTagMatch
+			break
+		}
+	}
+	if strings.Contains(strings.ToLower(parsed.Description), query) {
+		score += scoreDescriptionMatch
+	}
+
+	return score
+}
+
+// SearchMarketplace returns marketplace datasets matching the query, ranked by relevance
+// Matches case-insensitively against metadata name, description, and tags, plus the owner address prefix
+func (s *AptosServiceImpl) SearchMarketplace(ctx context.Context, query string) ([]interface{}, error) {
+	page, err := s.GetMarketplaceDatasets(ctx, models.MarketplaceFilter{Query: query})
+	if err != nil {
+		return nil, err
+	}
+	return page.Datasets, nil
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/datax/backend/models"
+	"github.com/hasura/go-graphql-client"
+)
+
+// newIndexedMarketplace serves three datasets for owner A and two for owner B from the indexer
+// and their DataStores from the node. A's dataset 1 has been deleted on chain
+func newIndexedMarketplace(t testing.TB) (*fakeNode, *AptosServiceImpl) {
+	t.Helper()
+	indexer := newFakeIndexer(t, "datax_marketplace", []map[string]interface{}{
+		marketplaceRow(testOwnerA, 0, "a0"),
+		marketplaceRow(testOwnerA, 1, "a1"),
+		marketplaceRow(testOwnerA, 2, "a2"),
+		marketplaceRow(testOwnerB, 0, "b0"),
+		marketplaceRow(testOwnerB, 1, "b1"),
+	})
+
+	node := newFakeNode(t)
+	node.handleJSON(dataStorePath(testOwnerA), dataStoreResource(
+		testDataset{id: 0, metadata: `{"name":"a0","description":"test"}`, createdAt: 100, active: true},
+		testDataset{id: 1, metadata: `{"name":"a1","description":"test"}`, createdAt: 200, active: false},
+		testDataset{id: 2, metadata: `{"name":"a2","description":"test"}`, createdAt: 500, active: true},
+	))
+	node.handleJSON(dataStorePath(testOwnerB), dataStoreResource(
+		testDataset{id: 0, metadata: `{"name":"b0","description":"test"}`, createdAt: 300, active: true},
+		testDataset{id: 1, metadata: `{"name":"b1","description":"test"}`, createdAt: 400, active: true},
+	))
+	// The indexer has everything: no recent submissions to merge
+	node.handleTransactions(10, nil)
+
+	service := newTestService(t, node, func(cfg *ServiceConfig) {
+		cfg.AptosIndexerURL = indexer.URL
+		cfg.AptosIndexerAPIKey = "test-key"
+	})
+	service.graphqlClient = graphql.NewClient(indexer.URL, indexer.Client())
+	return node, service
+}
+
+func TestMarketplaceVerificationFetchesEachOwnerOnce(t *testing.T) {
+	node, service := newIndexedMarketplace(t)
+
+	page, err := service.GetMarketplaceDatasets(context.Background(), models.MarketplaceFilter{})
+	if err != nil {
+		t.Fatalf("GetMarketplaceDatasets: %v", err)
+	}
+
+	for _, owner := range []string{testOwnerA, testOwnerB} {
+		if got := node.count(dataStorePath(owner)); got != 1 {
+			t.Errorf("DataStore of %s fetched %d times, want 1", owner, got)
+		}
+	}
+
+	// Ordered by the created_at read from chain, with the deleted dataset left out
+	if got, want := joinNames(datasetNamesOf(page.Datasets)), "a2,b1,b0,a0"; got != want {
+		t.Errorf("datasets = %s, want %s", got, want)
+	}
+	if page.TotalCount != 4 {
+		t.Errorf("TotalCount = %d, want 4", page.TotalCount)
+	}
+}
+
+func TestMarketplacePagesReuseTheVerifiedSnapshot(t *testing.T) {
+	node, service := newIndexedMarketplace(t)
+
+	first, err := service.GetMarketplaceDatasets(context.Background(), models.MarketplaceFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("first page: %v", err)
+	}
+	second, err := service.GetMarketplaceDatasets(context.Background(), models.MarketplaceFilter{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("second page: %v", err)
+	}
+
+	if got, want := joinNames(datasetNamesOf(first.Datasets))+"|"+joinNames(datasetNamesOf(second.Datasets)), "a2,b1|b0,a0"; got != want {
+		t.Errorf("pages = %s, want %s", got, want)
+	}
+	if second.NextCursor != "" {
+		t.Errorf("last page has next_cursor %q", second.NextCursor)
+	}
+	for _, owner := range []string{testOwnerA, testOwnerB} {
+		if got := node.count(dataStorePath(owner)); got != 1 {
+			t.Errorf("DataStore of %s fetched %d times over two pages, want 1", owner, got)
+		}
+	}
+}
+
+func TestMarketplaceResponsesAreEncodedOncePerSnapshot(t *testing.T) {
+	node, service := newIndexedMarketplace(t)
+	ctx := context.Background()
+
+	first, err := service.GetMarketplaceResponse(ctx, models.MarketplaceFilter{}, false)
+	if err != nil {
+		t.Fatalf("GetMarketplaceResponse: %v", err)
+	}
+	page, _ := service.GetMarketplaceDatasets(ctx, models.MarketplaceFilter{})
+	want, _ := json.Marshal(models.Response{Success: true, Data: page.Datasets})
+	sum := sha256.Sum256(want)
+	if !bytes.Equal(first.Body, want) || !bytes.Contains(first.Body, []byte(`"name":"b0"`)) || first.ETag != `"`+hex.EncodeToString(sum[:])+`"` {
+		t.Errorf("response = %s under %s, want the bare page under its hash", first.Body, first.ETag)
+	}
+
+	// Asked again, the snapshot serves what it encoded rather than encoding and hashing anew
+	again, err := service.GetMarketplaceResponse(ctx, models.MarketplaceFilter{}, false)
+	if err != nil || again != first {
+		t.Errorf("second GetMarketplaceResponse = %p, %v, want the cached %p", again, err, first)
+	}
+	// The envelope is another body, so it can't share the bare array's ETag
+	envelope, err := service.GetMarketplaceResponse(ctx, models.MarketplaceFilter{}, true)
+	if err != nil || envelope.ETag == first.ETag || !bytes.HasPrefix(envelope.Body, []byte(`{"success":true,"data":{"datasets":`)) {
+		t.Errorf("envelope = %s under %s, %v, want the page object under its own ETag", envelope.Body, envelope.ETag, err)
+	}
+
+	// Once the snapshot is refreshed the response is encoded from the new listing
+	node.handleJSON(dataStorePath(testOwnerB), dataStoreResource(
+		testDataset{id: 0, metadata: `{"name":"b0","description":"test"}`, createdAt: 300, active: false},
+		testDataset{id: 1, metadata: `{"name":"b1","description":"test"}`, createdAt: 400, active: true},
+	))
+	service.marketplaceMu.Lock()
+	service.marketplaceCache.refreshedAt = time.Now().Add(-time.Hour)
+	service.marketplaceMu.Unlock()
+	refreshed, err := service.GetMarketplaceResponse(ctx, models.MarketplaceFilter{}, false)
+	if err != nil || refreshed.ETag == first.ETag || bytes.Contains(refreshed.Body, []byte(`"name":"b0"`)) {
+		t.Errorf("after the refresh = %s under %s, %v, want b0 gone and a new ETag", refreshed.Body, refreshed.ETag, err)
+	}
+}
+
+// BenchmarkAssembleMarketplaceSnapshot reports the DataStore fetches one snapshot takes; with
+// five datasets from two owners it is two
+func BenchmarkAssembleMarketplaceSnapshot(b *testing.B) {
+	node, service := newIndexedMarketplace(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := service.assembleMarketplaceSnapshot(context.Background(), ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+	fetches := node.count(dataStorePath(testOwnerA)) + node.count(dataStorePath(testOwnerB))
+	b.ReportMetric(float64(fetches)/float64(b.N), "fetches/op")
+}
+
+// newLaggingMarketplace serves an indexer that only has owner A's first dataset, while on chain
+// A has deleted it and submitted another, and B has submitted one the indexer hasn't synced
+func newLaggingMarketplace(t *testing.T) *AptosServiceImpl {
+	t.Helper()
+	indexer := newFakeIndexer(t, "datax_marketplace", []map[string]interface{}{
+		marketplaceRow(testOwnerA, 0, "a0"),
+	})
+
+	node := newFakeNode(t)
+	node.handleJSON(dataStorePath(testOwnerA), dataStoreResource(
+		testDataset{id: 0, metadata: `{"name":"a0","description":"test"}`, createdAt: 100, active: false},
+		testDataset{id: 1, metadata: `{"name":"a1","description":"test"}`, createdAt: 300, active: true},
+	))
+	node.handleJSON(dataStorePath(testOwnerB), dataStoreResource(
+		testDataset{id: 0, metadata: `{"name":"b0","description":"test"}`, createdAt: 200, active: true},
+	))
+	node.handleTransactions(10, []map[string]interface{}{
+		submitDataTransaction(8, testOwnerB),
+		submitDataTransaction(9, testOwnerA),
+	})
+
+	service := newTestService(t, node, func(cfg *ServiceConfig) {
+		cfg.AptosIndexerURL = indexer.URL
+		cfg.AptosIndexerAPIKey = "test-key"
+	})
+	service.graphqlClient = graphql.NewClient(indexer.URL, indexer.Client())
+	return service
+}
+
+func TestMarketplaceMergesSubmissionsTheIndexerHasNotSynced(t *testing.T) {
+	service := newLaggingMarketplace(t)
+
+	page, err := service.GetMarketplaceDatasets(context.Background(), models.MarketplaceFilter{})
+	if err != nil {
+		t.Fatalf("GetMarketplaceDatasets: %v", err)
+	}
+
+	if page.Source != marketplaceSourceMerged {
+		t.Errorf("Source = %q, want %q", page.Source, marketplaceSourceMerged)
+	}
+	// a0 is still in the indexer, but the chain says it was deleted
+	if got, want := joinNames(datasetNamesOf(page.Datasets)), "a1,b0"; got != want {
+		t.Errorf("datasets = %s, want %s", got, want)
+	}
+	for _, d := range page.Datasets {
+		if source := d.(map[string]interface{})["source"]; source != marketplaceSourceBlockchain {
+			t.Errorf("dataset %v has source %v, want %s", d.(map[string]interface{})["name"], source, marketplaceSourceBlockchain)
+		}
+	}
+}
+
+func TestMarketplacePrefersChainActivityOverIndexerRows(t *testing.T) {
+	service := newLaggingMarketplace(t)
+
+	page, err := service.GetMarketplaceDatasets(context.Background(), models.MarketplaceFilter{IncludeInactive: true})
+	if err != nil {
+		t.Fatalf("GetMarketplaceDatasets: %v", err)
+	}
+
+	// One entry per (owner, id): the indexer's a0 row lost to the chain's
+	if got, want := joinNames(datasetNamesOf(page.Datasets)), "a1,b0,a0"; got != want {
+		t.Fatalf("datasets = %s, want %s", got, want)
+	}
+	a0 := page.Datasets[2].(map[string]interface{})
+	if a0["is_active"] != false || a0["source"] != marketplaceSourceBlockchain {
+		t.Errorf("a0 = is_active %v from %v, want false from %s", a0["is_active"], a0["source"], marketplaceSourceBlockchain)
+	}
+}
+
+func TestMarketplaceKeepsIndexerSourceWhenNothingLags(t *testing.T) {
+	_, service := newIndexedMarketplace(t)
+
+	page, err := service.GetMarketplaceDatasets(context.Background(), models.MarketplaceFilter{})
+	if err != nil {
+		t.Fatalf("GetMarketplaceDatasets: %v", err)
+	}
+	if page.Source != marketplaceSourceIndexer {
+		t.Errorf("Source = %q, want %q", page.Source, marketplaceSourceIndexer)
+	}
+	for _, d := range page.Datasets {
+		if source := d.(map[string]interface{})["source"]; source != marketplaceSourceIndexer {
+			t.Errorf("dataset %v has source %v, want %s", d.(map[string]interface{})["name"], source, marketplaceSourceIndexer)
+		}
+	}
+}
+
+func TestMarketplaceStopsWhenTheRequestEnds(t *testing.T) {
+	node, service := newIndexedMarketplace(t)
+
+	// The client went away before the DataStores were read
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	page, err := service.GetMarketplaceDatasets(ctx, models.MarketplaceFilter{})
+	if err == nil && !page.Partial {
+		t.Errorf("listing for an ended request = %d datasets, want it partial or failed", len(page.Datasets))
+	}
+	for _, owner := range []string{testOwnerA, testOwnerB} {
+		if got := node.count(dataStorePath(owner)); got != 0 {
+			t.Errorf("DataStore of %s fetched %d times after the request ended", owner, got)
+		}
+	}
+
+	// Nothing partial was cached, so the next request gets the whole listing
+	page, err = service.GetMarketplaceDatasets(context.Background(), models.MarketplaceFilter{})
+	if err != nil || page.Partial || page.TotalCount != 4 {
+		t.Errorf("next listing = %+v, %v, want all 4 datasets", page, err)
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/datax/backend/models"
+)
+
+// DatasetMetadataSchema is the JSON Schema new dataset metadata must follow. Metadata already
+// on chain is read whether it conforms or not
+//
+//go:embed dataset_metadata.schema.json
+var DatasetMetadataSchema []byte
+
+// jsonSchema is the part of JSON Schema DatasetMetadataSchema uses
+type jsonSchema struct {
+	Type       string                 `json:"type"`
+	Required   []string               `json:"required"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	MinLength  *int                   `json:"minLength"`
+	MaxLength  *int                   `json:"maxLength"`
+	MaxItems   *int                   `json:"maxItems"`
+	Minimum    *float64               `json:"minimum"`
+}
+
+var datasetMetadataSchema = func() *jsonSchema {
+	var schema jsonSchema
+	if err := json.Unmarshal(DatasetMetadataSchema, &schema); err != nil {
+		panic(fmt.Sprintf("invalid dataset metadata schema: %v", err))
+	}
+	return &schema
+}()
+
+// ValidateDatasetMetadata checks metadata text against DatasetMetadataSchema, returning one
+// error per field that breaks it, or none when it conforms
+func ValidateDatasetMetadata(metadata string) []models.FieldError {
+	decoder := json.NewDecoder(strings.NewReader(metadata))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return []models.FieldError{{Field: "metadata", Rule: "type", Message: "metadata must be a JSON object"}}
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return []models.FieldError{{Field: "metadata", Rule: "type", Message: "metadata must be a JSON object"}}
+	}
+	return datasetMetadataSchema.validate("", value)
+}
+
+// validate checks value against the schema; path is the dotted JSON path of value, "" at the top
+func (s *jsonSchema) validate(path string, value interface{}) []models.FieldError {
+	name := path
+	if name == "" {
+		name = "metadata"
+	}
+	fail := func(rule string, format string, args ...interface{}) []models.FieldError {
+		return []models.FieldError{{Field: name, Rule: rule, Message: name + " " + fmt.Sprintf(format, args...)}}
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("type", "must be an object")
+		}
+		var errs []models.FieldError
+		for _, key := range s.Required {
+			if _, ok := object[key]; !ok {
+				field := joinPath(path, key)
+				errs = append(errs, models.FieldError{Field: field, Rule: "required", Message: field + " is required"})
+			}
+		}
+		keys := make([]string, 0, len(s.Properties))
+		for key := range s.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if v, ok := object[key]; ok {
+				errs = append(errs, s.Properties[key].validate(joinPath(path, key), v)...)
+			}
+		}
+		return errs
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fail("type", "must be an array")
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			return fail("maxItems", "must have at most %d items", *s.MaxItems)
+		}
+		var errs []models.FieldError
+		if s.Items != nil {
+			for i, item := range items {
+				errs = append(errs, s.Items.validate(fmt.Sprintf("%s.%d", path, i), item)...)
+			}
+		}
+		return errs
+
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fail("type", "must be a string")
+		}
+		length := utf8.RuneCountInString(text)
+		if s.MinLength != nil && length < *s.MinLength {
+			if *s.MinLength == 1 {
+				return fail("minLength", "must not be empty")
+			}
+			return fail("minLength", "must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fail("maxLength", "must be at most %d characters", *s.MaxLength)
+		}
+
+	case "number", "integer":
+		kind := map[string]string{"number": "a number", "integer": "an integer"}[s.Type]
+		number, ok := value.(json.Number)
+		if !ok {
+			return fail("type", "must be %s", kind)
+		}
+		n, err := number.Float64()
+		if err != nil || (s.Type == "integer" && n != math.Trunc(n)) {
+			return fail("type", "must be %s", kind)
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return fail("minimum", "must be at least %s", strconv.FormatFloat(*s.Minimum, 'f', -1, 64))
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("type", "must be true or false")
+		}
+	}
+	return nil
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,1007 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+// Ensure MockAptosService implements AptosService interface
+var _ AptosService = (*MockAptosService)(nil)
+
+// marketplaceSourceMock marks marketplace entries served by the mock chain
+const marketplaceSourceMock = "mock"
+
+// MockAptosService is an in-memory stand-in for the DataX modules, enabled with MOCK_CHAIN=true
+// so the API runs without a funded account or a reachable node/indexer. Transactions take
+// effect immediately and return deterministic fake hashes. State is optionally persisted
+// as JSON so submitted datasets and grants survive restarts
+type MockAptosService struct {
+	mu        sync.Mutex
+	statePath string // JSON file the state is saved to after every transaction; empty keeps it in memory
+	state     mockChainState
+	receipts  map[string]models.TransactionReceipt // By hash; kept in memory only, so lost on restart
+	sponsored sponsoredTransactions                // Sponsored registrations awaiting their recipient's signature
+}
+
+// mockChainState is everything the mock chain remembers
+type mockChainState struct {
+	Transactions uint64                  `json:"transactions"` // Transactions submitted so far, used to derive hashes
+	Accounts     map[string]*mockAccount `json:"accounts"`     // Keyed by normalized address
+}
+
+// mockAccount mirrors the resources an account holds on chain
+type mockAccount struct {
+	Initialized     bool              `json:"initialized"` // DataStore/Vault created by initialize_user
+	TokenRegistered bool              `json:"token_registered"`
+	Balance         uint64            `json:"balance"`
+	NextDatasetID   uint64            `json:"next_dataset_id"`
+	Datasets        []mockDataset     `json:"datasets"`
+	Grants          map[string]uint64 `json:"grants"`                 // "{datasetID}:{requester}" -> expires_at (0 = never)
+	Escrow          map[string]uint64 `json:"escrow,omitempty"`       // Deposits made by the account: "{owner}:{datasetID}" -> octas
+	EscrowSince     map[string]int64  `json:"escrow_since,omitempty"` // Same keys -> Unix seconds of the last deposit, which starts the refund timeout
+}
+
+type mockDataset struct {
+	ID        uint64 `json:"id"`
+	DataHash  string `json:"data_hash"`
+	Metadata  string `json:"metadata"`
+	CreatedAt uint64 `json:"created_at"`
+	IsActive  bool   `json:"is_active"`
+}
+
+// NewMockAptosService creates the mock chain, loading earlier state from statePath when it exists
+func NewMockAptosService(statePath string) (*MockAptosService, error) {
+	s := &MockAptosService{
+		statePath: statePath,
+		state:     mockChainState{Accounts: make(map[string]*mockAccount)},
+		receipts:  make(map[string]models.TransactionReceipt),
+	}
+	if statePath == "" {
+		return s, nil
+	}
+
+	body, err := os.ReadFile(statePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock chain state: %w", err)
+	}
+	if err := json.Unmarshal(body, &s.state); err != nil {
+		return nil, fmt.Errorf("failed to parse mock chain state %s: %w", statePath, err)
+	}
+	if s.state.Accounts == nil {
+		s.state.Accounts = make(map[string]*mockAccount)
+	}
+	fmt.Printf("DEBUG: Loaded mock chain state from %s (%d accounts)\n", statePath, len(s.state.Accounts))
+	return s, nil
+}
+
+// account returns the account's state, creating it on first use; callers hold mu
+func (s *MockAptosService) account(address string) *mockAccount {
+	acc, ok := s.state.Accounts[address]
+	if !ok {
+		acc = &mockAccount{Grants: make(map[string]uint64)}
+		s.state.Accounts[address] = acc
+	}
+	if acc.Grants == nil {
+		acc.Grants = make(map[string]uint64)
+	}
+	return acc
+}
+
+// lookupAccount returns an existing account's state without creating it; callers hold mu
+func (s *MockAptosService) lookupAccount(address string) (*mockAccount, error) {
+	addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	acc, ok := s.state.Accounts[addr.String()]
+	if !ok || !acc.Initialized {
+		return nil, fmt.Errorf("DataStore resource not found for user")
+	}
+	return acc, nil
+}
+
+// signer resolves the address a private key signs for
+func (s *MockAptosService) signer(privateKeyHex string) (string, error) {
+	account, err := getAccountFromPrivateKey(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return account.Address.String(), nil
+}
+
+// commit records a transaction with the events it emitted, saves the state and returns the
+// transaction's fake hash. Callers hold mu
+func (s *MockAptosService) commit(function string, sender string, events ...models.ReceiptEvent) (string, error) {
+	s.state.Transactions++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("mock:%d:%s:%s", s.state.Transactions, sender, function)))
+	txHash := "0x" + hex.EncodeToString(sum[:])
+
+	if err := s.save(); err != nil {
+		return "", err
+	}
+	if events == nil {
+		events = []models.ReceiptEvent{}
+	}
+	// Mock transactions cost no gas
+	s.receipts[txHash] = models.TransactionReceipt{
+		Hash:      txHash,
+		Version:   s.state.Transactions,
+		Sender:    sender,
+		Function:  mockMoveName(function),
+		Success:   true,
+		VMStatus:  "Executed successfully",
+		Timestamp: uint64(time.Now().Unix()),
+		Events:    events,
+	}
+	fmt.Printf("DEBUG: Mock chain executed %s for %s: %s\n", function, sender, txHash)
+	return txHash, nil
+}
+
+// save writes the state to statePath through a temporary file; callers hold mu
+func (s *MockAptosService) save() error {
+	if s.statePath == "" {
+		return nil
+	}
+	body, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mock chain state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.statePath), 0o755); err != nil {
+		return fmt.Errorf("failed to create mock chain state directory: %w", err)
+	}
+	tmp := s.statePath + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("failed to write mock chain state: %w", err)
+	}
+	return os.Rename(tmp, s.statePath)
+}
+
+func (s *MockAptosService) InitializeUser(privateKeyHex string) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.account(sender).Initialized = true
+	return s.commit("data_registry::init", sender)
+}
+
+// SubmitData appends a dataset with the next ID of the sender's DataStore
+func (s *MockAptosService) SubmitData(privateKeyHex string, dataHash string, metadata string) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.account(sender)
+	if !acc.Initialized {
+		return "", fmt.Errorf("transaction failed: account %s has no DataStore, initialize it first", sender)
+	}
+
+	// The chain stores data_hash as bytes and returns it as hex
+	hash := NormalizeDataHash(dataHash)
+	if hash == "" {
+		hash = "0x" + hex.EncodeToString([]byte(dataHash))
+	}
+	acc.Datasets = append(acc.Datasets, mockDataset{
+		ID:        acc.NextDatasetID,
+		DataHash:  hash,
+		Metadata:  metadata,
+		CreatedAt: uint64(time.Now().Unix()),
+		IsActive:  true,
+	})
+	acc.NextDatasetID++
+	submitted := &models.DataSubmittedEvent{Owner: sender, DatasetID: acc.NextDatasetID - 1, DataHash: hash, Metadata: metadata}
+	return s.commit("data_registry::submit_data", sender, models.ReceiptEvent{
+		Type:          mockMoveName("data_registry::DataSubmitted"),
+		Name:          models.EventNameDataSubmitted,
+		DataSubmitted: submitted,
+	})
+}
+
+// DeleteDataset deactivates a dataset, as the contract does
+func (s *MockAptosService) DeleteDataset(privateKeyHex string, datasetID uint64) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dataset := s.account(sender).dataset(datasetID)
+	if dataset == nil {
+		return "", fmt.Errorf("transaction failed: dataset %d not found", datasetID)
+	}
+	dataset.IsActive = false
+	deleted := &models.DataDeletedEvent{Owner: sender, DatasetID: datasetID}
+	return s.commit("data_registry::delete_dataset", sender, models.ReceiptEvent{
+		Type:        mockMoveName("data_registry::DataDeleted"),
+		Name:        models.EventNameDataDeleted,
+		DataDeleted: deleted,
+	})
+}
+
+// ReactivateDataset reactivates a deleted dataset, refusing like the contract does
+func (s *MockAptosService) ReactivateDataset(privateKeyHex string, datasetID uint64) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dataset := s.account(sender).dataset(datasetID)
+	if dataset == nil {
+		return "", ErrDatasetNotReactivatable
+	}
+	if dataset.IsActive {
+		return "", ErrDatasetAlreadyActive
+	}
+	dataset.IsActive = true
+	reactivated := &models.DataReactivatedEvent{Owner: sender, DatasetID: datasetID}
+	return s.commit("data_registry::reactivate_dataset", sender, models.ReceiptEvent{
+		Type:            mockMoveName("data_registry::DataReactivated"),
+		Name:            models.EventNameDataReactivated,
+		DataReactivated: reactivated,
+	})
+}
+
+func (s *MockAptosService) GrantAccess(privateKeyHex string, datasetID uint64, requester string, expiresAt uint64) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.account(sender)
+	if acc.dataset(datasetID) == nil {
+		return "", fmt.Errorf("transaction failed: dataset %d not found", datasetID)
+	}
+	acc.Grants[mockGrantKey(datasetID, requesterAddr.String())] = expiresAt
+	granted := &models.AccessGrantedEvent{Owner: sender, Requester: requesterAddr.String(), DatasetID: datasetID, ExpiresAt: expiresAt}
+	return s.commit("AccessControl::grant_access", sender, models.ReceiptEvent{
+		Type:          mockMoveName("AccessControl::grant_access"),
+		Name:          models.EventNameAccessGranted,
+		Derived:       true,
+		AccessGranted: granted,
+	})
+}
+
+func (s *MockAptosService) RevokeAccess(privateKeyHex string, datasetID uint64, requester string) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.account(sender).Grants, mockGrantKey(datasetID, requesterAddr.String()))
+	revoked := &models.AccessRevokedEvent{Owner: sender, Requester: requesterAddr.String(), DatasetID: datasetID}
+	return s.commit("AccessControl::revoke_access", sender, models.ReceiptEvent{
+		Type:          mockMoveName("AccessControl::revoke_access"),
+		Name:          models.EventNameAccessRevoked,
+		Derived:       true,
+		AccessRevoked: revoked,
+	})
+}
+
+func (s *MockAptosService) RegisterToken(privateKeyHex string) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.account(sender).TokenRegistered = true
+	return s.commit("data_token::register", sender)
+}
+
+// IsMintAuthority reports whether the key's account is the module address, which GetTokenInfo
+// names as the minter
+func (s *MockAptosService) IsMintAuthority(privateKeyHex string) (bool, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return false, err
+	}
+	minter, err := parseAddress(config.AppConfig.DataXModuleAddr)
+	if err != nil {
+		return false, err
+	}
+	return sender == minter.String(), nil
+}
+
+// BuildSponsoredRegistration builds the fee-payer registration the real chain service would,
+// without a node: sequence number 0 and the default gas settings. It refuses as the real chain
+// service does when SPONSOR_PRIVATE_KEY is empty
+func (s *MockAptosService) BuildSponsoredRegistration(recipient string) (*models.SponsoredTransaction, error) {
+	sponsor, err := loadSponsor(config.AppConfig.SponsorPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if sponsor == nil {
+		return nil, ErrSponsorNotConfigured
+	}
+	recipientAddr, err := parseAddress(recipient)
+	if err != nil {
+		return nil, err
+	}
+	moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := entryFunctionPayload(moduleAddr, "data_token", "register", []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sponsored.issue(&aptos.RawTransactionWithData{
+		Variant: aptos.MultiAgentWithFeePayerRawTransactionWithDataVariant,
+		Inner: &aptos.MultiAgentWithFeePayerRawTransactionWithData{
+			RawTxn: &aptos.RawTransaction{
+				Sender:                     *recipientAddr,
+				Payload:                    payload,
+				MaxGasAmount:               aptos.DefaultMaxGasAmount,
+				GasUnitPrice:               aptos.DefaultGasUnitPrice,
+				ExpirationTimestampSeconds: uint64(time.Now().Unix()) + sponsoredTransactionTTL,
+				ChainId:                    4,
+			},
+			SecondarySigners: []aptos.AccountAddress{},
+			FeePayer:         &sponsor.Address,
+		},
+	})
+}
+
+// SubmitSponsoredRegistration registers the recipient once its wallet co-signed a transaction
+// from BuildSponsoredRegistration. The mock charges no gas
+func (s *MockAptosService) SubmitSponsoredRegistration(recipient string, rawTransaction string, recipientAuthenticator string) (string, error) {
+	if config.AppConfig.SponsorPrivateKey == "" {
+		return "", ErrSponsorNotConfigured
+	}
+	recipientAddr, err := parseAddress(recipient)
+	if err != nil {
+		return "", err
+	}
+	_, senderAuth, err := s.sponsored.take(recipientAddr.String(), rawTransaction, recipientAuthenticator)
+	if err != nil {
+		return "", err
+	}
+	// Mock accounts never rotate their key, so it's always the one the address derives from
+	if err := checkSignerKey(senderAuth, "0x"+hex.EncodeToString(recipientAddr[:])); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.account(recipientAddr.String()).TokenRegistered = true
+	return s.commit("data_token::register", recipientAddr.String())
+}
+
+func (s *MockAptosService) MintToken(privateKeyHex string, recipient string, amount uint64) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	recipientAddr, err := parseAddress(recipient)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.account(recipientAddr.String())
+	if !acc.TokenRegistered {
+		return "", fmt.Errorf("transaction failed: %w: %s", ErrRecipientNotRegistered, recipientAddr.String())
+	}
+	acc.Balance += amount
+	return s.commit("data_token::mint", sender)
+}
+
+// IsTokenRegistered reports whether the account has called RegisterToken
+func (s *MockAptosService) IsTokenRegistered(address string) (bool, error) {
+	accountAddr, err := parseAddress(address)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.account(accountAddr.String()).TokenRegistered, nil
+}
+
+// GetTokenInfo describes the token as data_token::init creates it: without supply tracking,
+// and minted by the module address
+func (s *MockAptosService) GetTokenInfo() (*models.TokenInfo, error) {
+	coinType, err := dataTokenType(config.AppConfig.DataXModuleAddr)
+	if err != nil {
+		return nil, err
+	}
+	minter, _, _ := strings.Cut(coinType, "::")
+	return &models.TokenInfo{
+		CoinType: coinType,
+		Name:     "Data Token",
+		Symbol:   "DTN",
+		Decimals: 6,
+		Minter:   minter,
+	}, nil
+}
+
+func (s *MockAptosService) GetDataset(userAddress string, datasetID uint64) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, err := s.lookupAccount(userAddress)
+	if err != nil {
+		return nil, err
+	}
+	dataset := acc.dataset(datasetID)
+	if dataset == nil {
+		return nil, fmt.Errorf("dataset %d not found", datasetID)
+	}
+	return map[string]interface{}{
+		"data_hash":  dataset.DataHash,
+		"metadata":   dataset.Metadata,
+		"created_at": dataset.CreatedAt,
+		"is_active":  dataset.IsActive,
+	}, nil
+}
+
+// CheckAccess honors grants that haven't expired; owners always have access
+func (s *MockAptosService) CheckAccess(owner string, datasetID uint64, requester string) (bool, error) {
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return false, err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return false, err
+	}
+	if ownerAddr.String() == requesterAddr.String() {
+		return true, nil
+	}
+
+	grant, err := s.GetAccessGrant(owner, datasetID, requester)
+	if err != nil {
+		return false, err
+	}
+	return grant != nil && !grant.Expired, nil
+}
+
+// GetAccessGrant returns requester's grant on the dataset, or nil when there is none. The
+// mock chain's clock is the local one
+func (s *MockAptosService) GetAccessGrant(owner string, datasetID uint64, requester string) (*models.AccessGrant, error) {
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return nil, err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.state.Accounts[ownerAddr.String()]
+	if !ok {
+		return nil, nil
+	}
+	expiresAt, ok := acc.Grants[mockGrantKey(datasetID, requesterAddr.String())]
+	if !ok {
+		return nil, nil
+	}
+	grant := accessGrant(mockAccessEntry(datasetID, requesterAddr.String(), expiresAt), uint64(time.Now().Unix()), config.AppConfig.AccessExpirySkew)
+	return &grant, nil
+}
+
+func (s *MockAptosService) GetUserVault(ctx context.Context, userAddress string) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, err := s.lookupAccount(userAddress)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, 0, len(acc.Datasets))
+	for _, dataset := range acc.Datasets {
+		ids = append(ids, dataset.ID)
+	}
+	return ids, nil
+}
+
+func (s *MockAptosService) GetUserDatasetsMetadata(userAddress string) ([]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, err := s.lookupAccount(userAddress)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, 0, len(acc.Datasets))
+	for _, dataset := range acc.Datasets {
+		result = append(result, map[string]interface{}{
+			"id":         dataset.ID,
+			"data_hash":  dataset.DataHash,
+			"metadata":   dataset.Metadata,
+			"created_at": dataset.CreatedAt,
+			"is_active":  dataset.IsActive,
+		})
+	}
+	return result, nil
+}
+
+func (s *MockAptosService) IsAccountInitialized(userAddress string) (bool, error) {
+	addr, err := parseAddress(userAddress)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.state.Accounts[addr.String()]
+	return ok && acc.Initialized, nil
+}
+
+// GetMarketplaceDatasets lists the submitted datasets with the same filtering, search
+// and cursor paging as the real marketplace
+func (s *MockAptosService) GetMarketplaceDatasets(ctx context.Context, filter models.MarketplaceFilter) (*models.MarketplacePage, error) {
+	snapshot, filter, err := s.marketplaceSnapshot(filter)
+	if err != nil {
+		return nil, err
+	}
+	return marketplacePage(snapshot, filter)
+}
+
+// GetMarketplaceResponse encodes the page GetMarketplaceDatasets returns. Every call reads
+// the mock state afresh, so nothing is cached between calls
+func (s *MockAptosService) GetMarketplaceResponse(ctx context.Context, filter models.MarketplaceFilter, envelope bool) (*EncodedResponse, error) {
+	snapshot, filter, err := s.marketplaceSnapshot(filter)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.encodedPage(filter, envelope)
+}
+
+// marketplaceSnapshot orders every submitted dataset as the real marketplace does, and
+// returns the filter with its owner normalized
+func (s *MockAptosService) marketplaceSnapshot(filter models.MarketplaceFilter) (*marketplaceSnapshot, models.MarketplaceFilter, error) {
+	if filter.Owner != "" {
+		ownerAddr, err := parseAddress(filter.Owner)
+		if err != nil {
+			return nil, filter, fmt.Errorf("invalid owner filter: %w", err)
+		}
+		filter.Owner = ownerAddr.String()
+	}
+
+	snapshot := &marketplaceSnapshot{source: marketplaceSourceMock, refreshedAt: time.Now()}
+	s.mu.Lock()
+	for owner, acc := range s.state.Accounts {
+		for _, dataset := range acc.Datasets {
+			snapshot.entries = append(snapshot.entries, &marketplaceEntry{
+				data: map[string]interface{}{
+					"id":         dataset.ID,
+					"owner":      owner,
+					"data_hash":  dataset.DataHash,
+					"metadata":   dataset.Metadata,
+					"created_at": dataset.CreatedAt,
+					"is_active":  dataset.IsActive,
+					"source":     marketplaceSourceMock,
+				},
+				owner:    owner,
+				id:       dataset.ID,
+				sortKey:  dataset.CreatedAt,
+				verified: true,
+			})
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(snapshot.entries, func(i, j int) bool {
+		a, b := snapshot.entries[i], snapshot.entries[j]
+		return entryBefore(a.sortKey, a.owner, a.id, b.sortKey, b.owner, b.id)
+	})
+	return snapshot, filter, nil
+}
+
+func (s *MockAptosService) SearchMarketplace(ctx context.Context, query string) ([]interface{}, error) {
+	page, err := s.GetMarketplaceDatasets(ctx, models.MarketplaceFilter{Query: query})
+	if err != nil {
+		return nil, err
+	}
+	return page.Datasets, nil
+}
+
+// GetAccessRequests returns no requests: access requests are chain events the mock doesn't emit
+func (s *MockAptosService) GetAccessRequests(ownerAddress string, start uint64, limit uint64) ([]models.AccessRequest, error) {
+	if _, err := parseAddress(ownerAddress); err != nil {
+		return nil, err
+	}
+	return []models.AccessRequest{}, nil
+}
+
+// FindDatasetsByDataHash returns the active datasets registered with dataHash, only owner's when given
+func (s *MockAptosService) FindDatasetsByDataHash(ctx context.Context, dataHash string, owner string) ([]models.DatasetRef, error) {
+	hash := NormalizeDataHash(dataHash)
+	if hash == "" {
+		return nil, fmt.Errorf("invalid data hash %q", dataHash)
+	}
+	var ownerAddr string
+	if owner != "" {
+		addr, err := parseAddress(owner)
+		if err != nil {
+			return nil, err
+		}
+		ownerAddr = addr.String()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refs := []models.DatasetRef{}
+	for addr, acc := range s.state.Accounts {
+		if ownerAddr != "" && addr != ownerAddr {
+			continue
+		}
+		for _, dataset := range acc.Datasets {
+			if dataset.IsActive && NormalizeDataHash(dataset.DataHash) == hash {
+				refs = append(refs, models.DatasetRef{Owner: addr, DatasetID: dataset.ID})
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Owner != refs[j].Owner {
+			return refs[i].Owner < refs[j].Owner
+		}
+		return refs[i].DatasetID < refs[j].DatasetID
+	})
+	return refs, nil
+}
+
+// GetDiscoveryCheckpoint reports every account that has submitted data; there is nothing to scan
+func (s *MockAptosService) GetDiscoveryCheckpoint() models.DiscoveryCheckpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint := models.DiscoveryCheckpoint{
+		LastScannedVersion: s.state.Transactions,
+		Users:              []string{},
+		UpdatedAt:          time.Now().UTC().Format(time.RFC3339),
+	}
+	for address, acc := range s.state.Accounts {
+		if len(acc.Datasets) > 0 {
+			checkpoint.Users = append(checkpoint.Users, address)
+		}
+	}
+	sort.Strings(checkpoint.Users)
+	return checkpoint
+}
+
+// GetAuthenticationKey returns the address itself, which is the authentication key of any
+// single-key account that never rotated its key, so wallet signatures still verify
+func (s *MockAptosService) GetAuthenticationKey(userAddress string) (string, error) {
+	addr, err := parseAddress(userAddress)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// GetTransactionReceipt returns the receipt of a transaction submitted since the mock chain started
+func (s *MockAptosService) GetTransactionReceipt(hash string) (*models.TransactionReceipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt, ok := s.receipts[NormalizeTxHash(hash)]
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+	return &receipt, nil
+}
+
+// DepositEscrow records a deposit; the mock chain has no coins, so nothing is withdrawn
+func (s *MockAptosService) DepositEscrow(privateKeyHex string, owner string, datasetID uint64, amount uint64) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return "", err
+	}
+	if amount == 0 {
+		return "", fmt.Errorf("transaction failed: deposit must hold some APT")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.account(sender)
+	if acc.Escrow == nil {
+		acc.Escrow = make(map[string]uint64)
+	}
+	if acc.EscrowSince == nil {
+		acc.EscrowSince = make(map[string]int64)
+	}
+	key := mockEscrowKey(ownerAddr.String(), datasetID)
+	acc.Escrow[key] += amount
+	acc.EscrowSince[key] = time.Now().Unix()
+	return s.commit("Escrow::deposit", sender)
+}
+
+// ReleaseEscrow drops the requester's deposit for one of the signer's datasets and grants
+// the requester access, or does neither
+func (s *MockAptosService) ReleaseEscrow(privateKeyHex string, datasetID uint64, requester string, expiresAt uint64) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.account(sender)
+	if acc.dataset(datasetID) == nil {
+		return "", fmt.Errorf("transaction failed: dataset %d not found", datasetID)
+	}
+	if !s.takeEscrow(requesterAddr.String(), sender, datasetID) {
+		return "", ErrEscrowNotFound
+	}
+	acc.Grants[mockGrantKey(datasetID, requesterAddr.String())] = expiresAt
+	granted := &models.AccessGrantedEvent{Owner: sender, Requester: requesterAddr.String(), DatasetID: datasetID, ExpiresAt: expiresAt}
+	return s.commit("Escrow::release", sender, models.ReceiptEvent{
+		Type:          mockMoveName("AccessControl::grant_access"),
+		Name:          models.EventNameAccessGranted,
+		Derived:       true,
+		AccessGranted: granted,
+	})
+}
+
+// RefundEscrow drops the signer's deposit for an owner's dataset once the refund timeout
+// has passed
+func (s *MockAptosService) RefundEscrow(privateKeyHex string, owner string, datasetID uint64) (string, error) {
+	sender, err := s.signer(privateKeyHex)
+	if err != nil {
+		return "", err
+	}
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.state.Accounts[sender]
+	key := mockEscrowKey(ownerAddr.String(), datasetID)
+	if !ok || acc.Escrow[key] == 0 {
+		return "", ErrEscrowNotFound
+	}
+	if time.Since(time.Unix(acc.EscrowSince[key], 0)) < EscrowRefundTimeout {
+		return "", ErrEscrowRefundTooEarly
+	}
+	s.takeEscrow(sender, ownerAddr.String(), datasetID)
+	return s.commit("Escrow::refund", sender)
+}
+
+// GetEscrowBalance returns the deposit a requester made for an owner's dataset
+func (s *MockAptosService) GetEscrowBalance(owner string, datasetID uint64, requester string) (uint64, error) {
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return 0, err
+	}
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.state.Accounts[requesterAddr.String()]
+	if !ok {
+		return 0, nil
+	}
+	return acc.Escrow[mockEscrowKey(ownerAddr.String(), datasetID)], nil
+}
+
+// takeEscrow removes a deposit, reporting whether there was one; callers hold mu
+func (s *MockAptosService) takeEscrow(requester string, owner string, datasetID uint64) bool {
+	acc, ok := s.state.Accounts[requester]
+	if !ok {
+		return false
+	}
+	key := mockEscrowKey(owner, datasetID)
+	if acc.Escrow[key] == 0 {
+		return false
+	}
+	delete(acc.Escrow, key)
+	delete(acc.EscrowSince, key)
+	return true
+}
+
+// VerifyPayment accepts any other hash as a payment of exactly the expected amount to the
+// first recipient, since the mock chain has no coins. Hashes of transactions the mock
+// chain executed are DataX calls, not transfers, and are rejected
+func (s *MockAptosService) VerifyPayment(txHash string, expected models.ExpectedPayment) (*models.VerifiedPayment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	txHash = NormalizeTxHash(txHash)
+	if receipt, ok := s.receipts[txHash]; ok {
+		return nil, fmt.Errorf("%w: %s is not an APT transfer", ErrPaymentInvalid, receipt.Function)
+	}
+	if len(expected.Recipients) == 0 {
+		return nil, fmt.Errorf("%w: no recipient expected", ErrPaymentInvalid)
+	}
+	fmt.Printf("DEBUG: Mock chain accepting %s as a payment of %d octas from %s\n", txHash, expected.MinOctas, expected.Sender)
+	return &models.VerifiedPayment{
+		TxHash:      txHash,
+		Sender:      expected.Sender,
+		Recipient:   expected.Recipients[0],
+		AmountOctas: expected.MinOctas,
+		Version:     s.state.Transactions,
+		Timestamp:   uint64(time.Now().Unix()),
+	}, nil
+}
+
+// mockMoveName prefixes "module::name" with the address the module is published at
+func mockMoveName(name string) string {
+	module, _, _ := strings.Cut(name, "::")
+	address := config.AppConfig.DataXModuleAddr
+	switch module {
+	case "AccessControl", "UserVault":
+		address = config.AppConfig.NetworkModuleAddr
+	case "Escrow":
+		address = config.AppConfig.EscrowModuleAddr
+	}
+	if addr, err := parseAddress(address); err == nil {
+		address = addr.String()
+	}
+	return address + "::" + name
+}
+
+// dataset returns the dataset with the given ID, or nil
+func (a *mockAccount) dataset(datasetID uint64) *mockDataset {
+	for i := range a.Datasets {
+		if a.Datasets[i].ID == datasetID {
+			return &a.Datasets[i]
+		}
+	}
+	return nil
+}
+
+// GetAllGrantsByOwner returns every grant the owner has issued, sorted by dataset then requester
+func (s *MockAptosService) GetAllGrantsByOwner(owner string) ([]models.AccessGrant, error) {
+	ownerAddr, err := parseAddress(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.state.Accounts[ownerAddr.String()]
+	if !ok {
+		return []models.AccessGrant{}, nil
+	}
+	entries := make([]accessListEntry, 0, len(acc.Grants))
+	for key, expiresAt := range acc.Grants {
+		idText, requester, _ := strings.Cut(key, ":")
+		datasetID, err := strconv.ParseUint(idText, 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, mockAccessEntry(datasetID, requester, expiresAt))
+	}
+	names := make(map[uint64]string, len(acc.Datasets))
+	for _, dataset := range acc.Datasets {
+		if meta, _ := ParseDatasetMetadata(dataset.Metadata); meta.Name != "" {
+			names[dataset.ID] = meta.Name
+		}
+	}
+	return flattenGrants(entries, names, uint64(time.Now().Unix()), config.AppConfig.AccessExpirySkew), nil
+}
+
+// GetAccessibleDatasets finds requester's grants that CheckAccess would honor. The mock
+// holds every grant, so known adds nothing and there is nothing to cache
+func (s *MockAptosService) GetAccessibleDatasets(requester string, known []models.DatasetRef) ([]models.AccessibleDataset, error) {
+	requesterAddr, err := parseAddress(requester)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := uint64(time.Now().Unix())
+	datasets := make([]models.AccessibleDataset, 0)
+	for owner, acc := range s.state.Accounts {
+		for _, dataset := range acc.Datasets {
+			expiresAt, ok := acc.Grants[mockGrantKey(dataset.ID, requesterAddr.String())]
+			if !ok {
+				continue
+			}
+			grant := accessGrant(mockAccessEntry(dataset.ID, requesterAddr.String(), expiresAt), now, config.AppConfig.AccessExpirySkew)
+			if grant.Expired {
+				continue
+			}
+			info, err := DatasetInfoFromView(owner, dataset.ID, map[string]interface{}{
+				"data_hash":  dataset.DataHash,
+				"metadata":   dataset.Metadata,
+				"created_at": dataset.CreatedAt,
+				"is_active":  dataset.IsActive,
+			})
+			if err != nil {
+				return nil, err
+			}
+			datasets = append(datasets, models.AccessibleDataset{DatasetInfo: info, ExpiresAt: grant.ExpiresAt})
+		}
+	}
+	sortAccessible(datasets)
+	return datasets, nil
+}
+
+// mockAccessEntry turns a mock grant into its AccessList entry, where grants that never
+// expire hold the latest deadline as GrantAccess sends it
+func mockAccessEntry(datasetID uint64, requester string, expiresAt uint64) accessListEntry {
+	if expiresAt == 0 {
+		expiresAt = math.MaxUint64
+	}
+	return accessListEntry{DatasetID: datasetID, Requester: requester, ExpiresAt: expiresAt}
+}
+
+func mockGrantKey(datasetID uint64, requester string) string {
+	return fmt.Sprintf("%d:%s", datasetID, requester)
+}
+
+func mockEscrowKey(owner string, datasetID uint64) string {
+	return fmt.Sprintf("%s:%d", owner, datasetID)
+}
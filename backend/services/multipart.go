@@ -0,0 +1,190 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/datax/backend/config"
+)
+
+// minMultipartPartSize is S3's smallest allowed part (except the last)
+const minMultipartPartSize = 5 * 1024 * 1024
+
+// MultipartCleaner is implemented by storage backends that can leave incomplete multipart
+// uploads behind; CleanupMultipartUploads runs until ctx is cancelled
+type MultipartCleaner interface {
+	CleanupMultipartUploads(ctx context.Context)
+}
+
+// multipartPartSize is the configured part size, raised to S3's minimum
+func multipartPartSize() int64 {
+	size := config.AppConfig.StoragePartSize
+	if size < minMultipartPartSize {
+		size = minMultipartPartSize
+	}
+	return size
+}
+
+// multipartThreshold is the largest payload stored with a single put, never below one part
+func multipartThreshold() int64 {
+	threshold := config.AppConfig.StorageMultipartThreshold
+	if partSize := multipartPartSize(); threshold < partSize {
+		threshold = partSize
+	}
+	return threshold
+}
+
+// putObjectStream uploads everything read from r to key. Up to STORAGE_MULTIPART_THRESHOLD
+// bytes go up in a single PutObject; anything larger uses a multipart upload of
+// STORAGE_PART_SIZE parts so only one part is held in memory at a time, and is aborted if
+// any step fails. It returns the number of bytes stored and the number of parts (1 for a
+// single put)
+func (s *SupabaseServiceImpl) putObjectStream(ctx context.Context, key string, contentType string, r io.Reader) (int64, int, error) {
+	threshold := multipartThreshold()
+	partSize := multipartPartSize()
+
+	// Read up to the threshold (plus one byte) to decide between a single put and multipart
+	head, err := io.ReadAll(io.LimitReader(r, threshold+1))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read upload stream: %w", err)
+	}
+	if int64(len(head)) <= threshold {
+		_, err := s.putObjectBytes(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(s.bucketName),
+			Key:         aws.String(key),
+			ContentType: aws.String(contentType),
+		}, head)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to upload to Supabase S3: %w", err)
+		}
+		return int64(len(head)), 1, nil
+	}
+
+	upload, err := s.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+
+	abort := func(cause error) (int64, int, error) {
+		_, abortErr := s.s3Client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucketName),
+			Key:      aws.String(key),
+			UploadId: upload.UploadId,
+		})
+		if abortErr != nil {
+			fmt.Printf("ERROR: Failed to abort multipart upload %s: %v\n", key, abortErr)
+		}
+		return 0, 0, cause
+	}
+
+	// The bytes already read are replayed ahead of the rest of the stream
+	src := io.MultiReader(bytes.NewReader(head), r)
+	var parts []s3Types.CompletedPart
+	var total int64
+	buf := make([]byte, partSize)
+	for partNumber := int32(1); ; partNumber++ {
+		n, err := io.ReadFull(src, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(fmt.Errorf("failed to read upload stream: %w", err))
+		}
+		if n == 0 {
+			break
+		}
+
+		var result *s3.UploadPartOutput
+		err = withStorageRetry(ctx, fmt.Sprintf("UploadPart %s #%d", key, partNumber), func(ctx context.Context) error {
+			var err error
+			result, err = s.s3Client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:     aws.String(s.bucketName),
+				Key:        aws.String(key),
+				UploadId:   upload.UploadId,
+				PartNumber: aws.Int32(partNumber),
+				Body:       bytes.NewReader(buf[:n]),
+			}, withoutSDKRetries)
+			return err
+		})
+		if err != nil {
+			return abort(fmt.Errorf("failed to upload part %d: %w", partNumber, err))
+		}
+		parts = append(parts, s3Types.CompletedPart{ETag: result.ETag, PartNumber: aws.Int32(partNumber)})
+		total += int64(n)
+	}
+
+	_, err = s.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucketName),
+		Key:             aws.String(key),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3Types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return abort(fmt.Errorf("failed to complete multipart upload: %w", err))
+	}
+	return total, len(parts), nil
+}
+
+// AbortStaleMultipartUploads aborts multipart uploads started more than olderThan ago, which
+// a crash or dropped connection left incomplete. Their parts are otherwise stored (and
+// billed) indefinitely. It returns how many were aborted
+func (s *SupabaseServiceImpl) AbortStaleMultipartUploads(ctx context.Context, olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+	aborted := 0
+	input := &s3.ListMultipartUploadsInput{Bucket: aws.String(s.bucketName)}
+	for {
+		result, err := s.s3Client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return aborted, fmt.Errorf("failed to list multipart uploads: %w", err)
+		}
+		for _, upload := range result.Uploads {
+			if upload.Initiated == nil || upload.Initiated.After(cutoff) {
+				continue
+			}
+			_, err := s.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(s.bucketName),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+			if err != nil {
+				fmt.Printf("ERROR: Failed to abort stale multipart upload %s: %v\n", aws.ToString(upload.Key), err)
+				continue
+			}
+			aborted++
+		}
+		if !aws.ToBool(result.IsTruncated) {
+			break
+		}
+		input.KeyMarker = result.NextKeyMarker
+		input.UploadIdMarker = result.NextUploadIdMarker
+	}
+	return aborted, nil
+}
+
+// CleanupMultipartUploads aborts stale multipart uploads now and then hourly until ctx is done
+func (s *SupabaseServiceImpl) CleanupMultipartUploads(ctx context.Context) {
+	maxAge := time.Duration(config.AppConfig.StorageMultipartMaxAge) * time.Second
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		aborted, err := s.AbortStaleMultipartUploads(ctx, maxAge)
+		if err != nil {
+			fmt.Printf("ERROR: Multipart upload cleanup failed: %v\n", err)
+		} else if aborted > 0 {
+			fmt.Printf("DEBUG: Aborted %d stale multipart uploads\n", aborted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
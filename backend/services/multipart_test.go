@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/datax/backend/config"
+)
+
+// fakeMultipartS3 is a path-style bucket taking single puts and multipart uploads. The
+// part numbered failPart (0 for none) is refused with 403, and completing is refused with
+// 400 when failComplete is set
+type fakeMultipartS3 struct {
+	mu           sync.Mutex
+	objects      map[string][]byte
+	uploads      map[string]*fakeUpload // By upload ID
+	calls        []string               // S3 operations in the order they came in
+	failPart     int
+	failComplete bool
+}
+
+type fakeUpload struct {
+	key       string
+	initiated time.Time
+	parts     map[int][]byte
+}
+
+func newFakeMultipartS3() *fakeMultipartS3 {
+	return &fakeMultipartS3{objects: make(map[string][]byte), uploads: make(map[string]*fakeUpload)}
+}
+
+func (f *fakeMultipartS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/"+testBucket+"/")
+	query := r.URL.Query()
+	fail := func(status int, code string) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `<Error><Code>%s</Code><Message>refused</Message></Error>`, code)
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.calls = append(f.calls, "CreateMultipartUpload")
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = &fakeUpload{key: key, initiated: time.Now(), parts: make(map[int][]byte)}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, testBucket, key, id)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		f.calls = append(f.calls, fmt.Sprintf("UploadPart %d", number))
+		upload := f.uploads[query.Get("uploadId")]
+		if upload == nil {
+			fail(http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		if number == f.failPart {
+			fail(http.StatusForbidden, "AccessDenied")
+			return
+		}
+		upload.parts[number] = readFakeBody(r)
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.calls = append(f.calls, "CompleteMultipartUpload")
+		upload := f.uploads[query.Get("uploadId")]
+		if upload == nil {
+			fail(http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		if f.failComplete {
+			fail(http.StatusBadRequest, "EntityTooSmall")
+			return
+		}
+		var completed struct {
+			Parts []struct {
+				ETag       string
+				PartNumber int
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(readFakeBody(r), &completed); err != nil {
+			fail(http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var object []byte
+		for i, part := range completed.Parts {
+			if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"etag-%d"`, part.PartNumber) || upload.parts[part.PartNumber] == nil {
+				fail(http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			object = append(object, upload.parts[part.PartNumber]...)
+		}
+		f.objects[upload.key] = object
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`, testBucket, upload.key)
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		f.calls = append(f.calls, "AbortMultipartUpload")
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet && query.Has("uploads"):
+		f.calls = append(f.calls, "ListMultipartUploads")
+		ids := make([]string, 0, len(f.uploads))
+		for id := range f.uploads {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		var body strings.Builder
+		fmt.Fprintf(&body, `<ListMultipartUploadsResult><Bucket>%s</Bucket><IsTruncated>false</IsTruncated>`, testBucket)
+		for _, id := range ids {
+			fmt.Fprintf(&body, `<Upload><Key>%s</Key><UploadId>%s</UploadId><Initiated>%s</Initiated></Upload>`,
+				f.uploads[id].key, id, f.uploads[id].initiated.UTC().Format(time.RFC3339))
+		}
+		body.WriteString(`</ListMultipartUploadsResult>`)
+		fmt.Fprint(w, body.String())
+
+	case r.Method == http.MethodPut:
+		f.calls = append(f.calls, "PutObject")
+		f.objects[key] = readFakeBody(r)
+
+	default:
+		fail(http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// readFakeBody reads a request body, undoing the aws-chunked encoding the SDK may send
+// payloads in to append a trailing checksum
+func readFakeBody(r *http.Request) []byte {
+	body, _ := io.ReadAll(r.Body)
+	if !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return body
+	}
+	var decoded []byte
+	for {
+		line, rest, _ := bytes.Cut(body, []byte("\r\n"))
+		sizeHex, _, _ := strings.Cut(string(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || size == 0 || int64(len(rest)) < size {
+			return decoded
+		}
+		decoded = append(decoded, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+}
+
+// newMultipartTestService returns a Supabase storage service on f, with the smallest parts
+// S3 allows and uploads of more than one part going multipart
+func newMultipartTestService(t *testing.T, f *fakeMultipartS3) *SupabaseServiceImpl {
+	t.Helper()
+	partSize, threshold, attempts := config.AppConfig.StoragePartSize, config.AppConfig.StorageMultipartThreshold, config.AppConfig.StorageRetryAttempts
+	config.AppConfig.StoragePartSize, config.AppConfig.StorageMultipartThreshold = minMultipartPartSize, 0
+	config.AppConfig.StorageRetryAttempts = 1
+	t.Cleanup(func() {
+		config.AppConfig.StoragePartSize, config.AppConfig.StorageMultipartThreshold = partSize, threshold
+		config.AppConfig.StorageRetryAttempts = attempts
+	})
+
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("access", "secret", ""),
+		HTTPClient:   server.Client(),
+	})
+	return &SupabaseServiceImpl{s3Client: client, bucketName: testBucket}
+}
+
+// multipartPayload is size bytes that differ from part to part, so parts out of order show
+func multipartPayload(size int) []byte {
+	payload := make([]byte, size)
+	for i := range payload {
+		payload[i] = byte(i / 4096)
+	}
+	return payload
+}
+
+func TestPutObjectStreamUploadsLargePayloadsInParts(t *testing.T) {
+	f := newFakeMultipartS3()
+	s := newMultipartTestService(t, f)
+	payload := multipartPayload(2*minMultipartPartSize + 1234)
+
+	size, parts, err := s.putObjectStream(context.Background(), "owner/big.csv", "text/csv", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("putObjectStream: %v", err)
+	}
+	if size != int64(len(payload)) || parts != 3 {
+		t.Errorf("stored %d bytes in %d parts, want %d in 3", size, parts, len(payload))
+	}
+	if !bytes.Equal(f.objects["owner/big.csv"], payload) {
+		t.Errorf("assembled object of %d bytes doesn't match the %d uploaded", len(f.objects["owner/big.csv"]), len(payload))
+	}
+	want := "CreateMultipartUpload,UploadPart 1,UploadPart 2,UploadPart 3,CompleteMultipartUpload"
+	if got := strings.Join(f.calls, ","); got != want {
+		t.Errorf("calls %s, want %s", got, want)
+	}
+}
+
+func TestPutObjectStreamPutsSmallPayloadsWhole(t *testing.T) {
+	f := newFakeMultipartS3()
+	s := newMultipartTestService(t, f)
+
+	for _, payload := range [][]byte{[]byte("id,name\n1,alpha\n"), multipartPayload(minMultipartPartSize)} {
+		f.calls = nil
+		size, parts, err := s.putObjectStream(context.Background(), "owner/small.csv", "text/csv", bytes.NewReader(payload))
+		if err != nil || size != int64(len(payload)) || parts != 1 {
+			t.Errorf("putObjectStream of %d bytes = %d bytes, %d parts, %v, want one put", len(payload), size, parts, err)
+		}
+		if strings.Join(f.calls, ",") != "PutObject" || !bytes.Equal(f.objects["owner/small.csv"], payload) {
+			t.Errorf("%d bytes stored with %v", len(payload), f.calls)
+		}
+	}
+}
+
+func TestPutObjectStreamAbortsFailedUploads(t *testing.T) {
+	cases := []struct {
+		name  string
+		setup func(f *fakeMultipartS3)
+		calls string
+	}{
+		{"part refused", func(f *fakeMultipartS3) { f.failPart = 2 },
+			"CreateMultipartUpload,UploadPart 1,UploadPart 2,AbortMultipartUpload"},
+		{"completion failed", func(f *fakeMultipartS3) { f.failComplete = true },
+			"CreateMultipartUpload,UploadPart 1,UploadPart 2,UploadPart 3,CompleteMultipartUpload,AbortMultipartUpload"},
+	}
+	for _, tc := range cases {
+		f := newFakeMultipartS3()
+		tc.setup(f)
+		s := newMultipartTestService(t, f)
+
+		_, _, err := s.putObjectStream(context.Background(), "owner/big.csv", "text/csv", bytes.NewReader(multipartPayload(2*minMultipartPartSize+1)))
+		if err == nil {
+			t.Errorf("%s: putObjectStream succeeded", tc.name)
+		}
+		if got := strings.Join(f.calls, ","); got != tc.calls {
+			t.Errorf("%s: calls %s, want %s", tc.name, got, tc.calls)
+		}
+		if len(f.uploads) != 0 || len(f.objects) != 0 {
+			t.Errorf("%s: left %d uploads and %d objects behind", tc.name, len(f.uploads), len(f.objects))
+		}
+	}
+}
+
+func TestPutObjectStreamAbortsWhenTheStreamFails(t *testing.T) {
+	f := newFakeMultipartS3()
+	s := newMultipartTestService(t, f)
+
+	// The stream breaks after the first part has gone up
+	broken := io.MultiReader(bytes.NewReader(multipartPayload(minMultipartPartSize+10)), iotestErrReader{})
+	if _, _, err := s.putObjectStream(context.Background(), "owner/big.csv", "text/csv", broken); err == nil {
+		t.Fatal("putObjectStream of a broken stream succeeded")
+	}
+	if calls := strings.Join(f.calls, ","); !strings.HasSuffix(calls, "AbortMultipartUpload") || strings.Contains(calls, "Complete") {
+		t.Errorf("calls %s, want the upload aborted", calls)
+	}
+	if len(f.uploads) != 0 {
+		t.Errorf("%d uploads left behind", len(f.uploads))
+	}
+}
+
+// iotestErrReader fails every read, as a dropped client connection does
+type iotestErrReader struct{}
+
+func (iotestErrReader) Read([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestAbortStaleMultipartUploads(t *testing.T) {
+	f := newFakeMultipartS3()
+	s := newMultipartTestService(t, f)
+	f.uploads["stale"] = &fakeUpload{key: "owner/.staging/1.part", initiated: time.Now().Add(-48 * time.Hour)}
+	f.uploads["fresh"] = &fakeUpload{key: "owner/.staging/2.part", initiated: time.Now()}
+
+	aborted, err := s.AbortStaleMultipartUploads(context.Background(), 24*time.Hour)
+	if err != nil || aborted != 1 {
+		t.Fatalf("AbortStaleMultipartUploads = %d, %v, want 1", aborted, err)
+	}
+	if _, left := f.uploads["fresh"]; !left || len(f.uploads) != 1 {
+		t.Errorf("uploads left %v, want only the fresh one", f.uploads)
+	}
+}
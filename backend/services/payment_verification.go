@@ -0,0 +1,119 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+)
+
+// aptosCoinType is the coin an access request is paid in
+const aptosCoinType = "0x1::aptos_coin::AptosCoin"
+
+// ErrPaymentInvalid is returned for a committed transaction that doesn't pay what was expected
+var ErrPaymentInvalid = errors.New("transaction is not a valid payment")
+
+// paymentTransaction is the subset of a REST API transaction a payment is checked against
+type paymentTransaction struct {
+	Type      string `json:"type"`
+	Hash      string `json:"hash"`
+	Version   string `json:"version"`
+	Sender    string `json:"sender"`
+	Success   bool   `json:"success"`
+	VMStatus  string `json:"vm_status"`
+	Timestamp string `json:"timestamp"` // Microseconds
+	Payload   struct {
+		Type          string        `json:"type"`
+		Function      string        `json:"function"`
+		TypeArguments []string      `json:"type_arguments"`
+		Arguments     []interface{} `json:"arguments"`
+	} `json:"payload"`
+}
+
+// NormalizeTxHash lowercases a transaction hash and gives it the 0x prefix, the form hashes
+// are stored and compared in
+func NormalizeTxHash(hash string) string {
+	return "0x" + strings.TrimPrefix(strings.ToLower(hash), "0x")
+}
+
+// VerifyPayment reads a committed transaction and checks it is a successful APT transfer
+// from expected.Sender to one of expected.Recipients of at least expected.MinOctas,
+// committed no earlier than expected.NotBefore. Transfers through aptos_account::transfer,
+// aptos_account::transfer_coins and coin::transfer are recognized. Returns
+// ErrTransactionNotFound / ErrTransactionPending when it isn't committed, and wraps
+// ErrPaymentInvalid with the reason when it doesn't pay what was expected
+func (s *AptosServiceImpl) VerifyPayment(txHash string, expected models.ExpectedPayment) (*models.VerifiedPayment, error) {
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
+	txHash = NormalizeTxHash(txHash)
+
+	body, status, err := s.getWithRetry(fmt.Sprintf("%s/v1/transactions/by_hash/%s", nodeURL, txHash), "transaction")
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, ErrTransactionNotFound
+	}
+
+	var tx paymentTransaction
+	if err := json.Unmarshal(body, &tx); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	if tx.Type == "pending_transaction" {
+		return nil, ErrTransactionPending
+	}
+	if tx.Type != "user_transaction" {
+		return nil, fmt.Errorf("%w: %s is not a user transaction", ErrPaymentInvalid, tx.Type)
+	}
+	if !tx.Success {
+		return nil, fmt.Errorf("%w: transaction failed (%s)", ErrPaymentInvalid, tx.VMStatus)
+	}
+
+	sender, err := NormalizeAddress(tx.Sender)
+	if err != nil || sender != expected.Sender {
+		return nil, fmt.Errorf("%w: sent by %s, not the requester", ErrPaymentInvalid, tx.Sender)
+	}
+
+	if tx.Payload.Type != "entry_function_payload" {
+		return nil, fmt.Errorf("%w: not an APT transfer", ErrPaymentInvalid)
+	}
+	switch tx.Payload.Function {
+	case "0x1::aptos_account::transfer":
+	case "0x1::aptos_account::transfer_coins", "0x1::coin::transfer":
+		if len(tx.Payload.TypeArguments) != 1 || tx.Payload.TypeArguments[0] != aptosCoinType {
+			return nil, fmt.Errorf("%w: transfers %v, not APT", ErrPaymentInvalid, tx.Payload.TypeArguments)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s is not an APT transfer", ErrPaymentInvalid, tx.Payload.Function)
+	}
+
+	recipient, ok := addressArgument(tx.Payload.Arguments, 0)
+	if !ok || !slices.Contains(expected.Recipients, recipient) {
+		return nil, fmt.Errorf("%w: paid to %v, not the dataset owner", ErrPaymentInvalid, tx.Payload.Arguments)
+	}
+	amount, ok := uintArgument(tx.Payload.Arguments, 1)
+	if !ok || amount < expected.MinOctas {
+		return nil, fmt.Errorf("%w: transfers %d octas, %d required", ErrPaymentInvalid, amount, expected.MinOctas)
+	}
+
+	// The node renders u64 fields as strings
+	version, _ := strconv.ParseUint(tx.Version, 10, 64)
+	timestamp, _ := strconv.ParseUint(tx.Timestamp, 10, 64)
+	timestamp /= 1_000_000
+	if timestamp < expected.NotBefore {
+		return nil, fmt.Errorf("%w: committed at %d, before the request was made", ErrPaymentInvalid, timestamp)
+	}
+
+	return &models.VerifiedPayment{
+		TxHash:      txHash,
+		Sender:      sender,
+		Recipient:   recipient,
+		AmountOctas: amount,
+		Version:     version,
+		Timestamp:   timestamp,
+	}, nil
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/datax/backend/models"
+)
+
+// GeneratePresignedDownloadURL returns a URL that downloads a blob directly from Supabase
+// Storage until ttl elapses, so large datasets don't pass through the backend
+func (s *SupabaseServiceImpl) GeneratePresignedDownloadURL(accountAddress string, blobName string, ttl time.Duration) (string, error) {
+	key := blobKey(accountAddress, blobName)
+	if !strings.HasPrefix(key, accountAddress+"/") {
+		return "", fmt.Errorf("blob %s does not belong to %s", blobName, accountAddress)
+	}
+
+	presigner := s3.NewPresignClient(s.s3Client)
+	request, err := presigner.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download of %s: %w", key, err)
+	}
+
+	fmt.Printf("DEBUG: Presigned download of %s for %v\n", key, ttl)
+	return request.URL, nil
+}
+
+// pendingUploadPrefix keys manifest entries for presigned uploads that aren't finalized
+const pendingUploadPrefix = "pending:"
+
+// pendingUploadGrace is how long after its URL expires a pending upload can still be
+// finalized before PurgeExpiredUploads may remove it
+const pendingUploadGrace = time.Hour
+
+// ErrUploadNotFound is returned for an upload ID with no pending manifest entry
+var ErrUploadNotFound = errors.New("pending upload not found")
+
+// NewPendingUpload picks an object key under {account}/ for a direct upload, presigns a
+// PutObject for exactly size bytes of contentType, and records the upload as pending in the
+// manifest. It returns the upload ID to finalize with, the blob name and the URL
+func (s *SupabaseServiceImpl) NewPendingUpload(accountAddress string, contentType string, size int64, ttl time.Duration) (string, string, string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	uploadID := hex.EncodeToString(buf)
+	blobName := fmt.Sprintf("%s/%d_%s.csv", accountAddress, time.Now().Unix(), uploadID)
+
+	// Content length and type are signed, so storage rejects a PUT that doesn't match them
+	presigner := s3.NewPresignClient(s.s3Client)
+	request, err := presigner.PresignPutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucketName),
+		Key:           aws.String(blobName),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to presign upload of %s: %w", blobName, err)
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return "", "", "", err
+	}
+	now := time.Now()
+	manifest[pendingUploadPrefix+uploadID] = models.BlobManifestEntry{
+		BlobName:   blobName,
+		UploadedAt: now.Unix(),
+		Size:       size,
+		Pending:    true,
+		ExpiresAt:  now.Add(ttl + pendingUploadGrace).Unix(),
+	}
+	if err := s.storeManifest(accountAddress, manifest); err != nil {
+		return "", "", "", err
+	}
+
+	fmt.Printf("DEBUG: Presigned upload %s of %d bytes to %s for %v\n", uploadID, size, blobName, ttl)
+	return uploadID, blobName, request.URL, nil
+}
+
+// PendingUpload returns the manifest entry recorded for an upload ID
+func (s *SupabaseServiceImpl) PendingUpload(accountAddress string, uploadID string) (models.BlobManifestEntry, error) {
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return models.BlobManifestEntry{}, err
+	}
+	entry, ok := manifest[pendingUploadPrefix+uploadID]
+	if !ok {
+		return models.BlobManifestEntry{}, fmt.Errorf("%w: %s", ErrUploadNotFound, uploadID)
+	}
+	return entry, nil
+}
+
+// HeadBlob returns the size of a stored blob, or an error wrapping ErrBlobNotFound
+func (s *SupabaseServiceImpl) HeadBlob(accountAddress string, blobName string) (int64, error) {
+	key := blobKey(accountAddress, blobName)
+	result, err := s.s3Client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrBlobNotFound, key, err)
+	}
+	return aws.ToInt64(result.ContentLength), nil
+}
+
+// OpenBlob streams a stored blob's raw bytes; the caller closes the reader
+func (s *SupabaseServiceImpl) OpenBlob(accountAddress string, blobName string) (io.ReadCloser, error) {
+	key := blobKey(accountAddress, blobName)
+	// Only opening the stream is retried; the body is handed to the caller as it arrives
+	var result *s3.GetObjectOutput
+	err := withStorageRetry(context.Background(), "GetObject "+key, func(ctx context.Context) error {
+		var err error
+		result, err = s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+		}, withoutSDKRetries)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from Supabase S3: %w", err)
+	}
+	return result.Body, nil
+}
+
+// OpenBlobRange streams length bytes of a stored blob starting at offset, with a ranged
+// GetObject; the caller closes the reader
+func (s *SupabaseServiceImpl) OpenBlobRange(accountAddress string, blobName string, offset int64, length int64) (io.ReadCloser, error) {
+	key := blobKey(accountAddress, blobName)
+	if !strings.HasPrefix(key, accountAddress+"/") {
+		return nil, fmt.Errorf("blob %s does not belong to %s", blobName, accountAddress)
+	}
+	var result *s3.GetObjectOutput
+	err := withStorageRetry(context.Background(), "GetObject "+key, func(ctx context.Context) error {
+		var err error
+		result, err = s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+		}, withoutSDKRetries)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download range of %s from Supabase S3: %w", key, err)
+	}
+	return result.Body, nil
+}
+
+// CompletePendingUpload replaces an upload's pending manifest entry with the final entry
+// under the data hash computed from its contents
+func (s *SupabaseServiceImpl) CompletePendingUpload(accountAddress string, uploadID string, dataHash string, entry models.BlobManifestEntry) error {
+	key := NormalizeDataHash(dataHash)
+	if key == "" {
+		return fmt.Errorf("invalid data hash: %q", dataHash)
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return err
+	}
+	if _, ok := manifest[pendingUploadPrefix+uploadID]; !ok {
+		return fmt.Errorf("%w: %s", ErrUploadNotFound, uploadID)
+	}
+	delete(manifest, pendingUploadPrefix+uploadID)
+	manifest[key] = mergeManifestEntry(manifest[key], entry)
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// PurgeExpiredUploads deletes the objects of pending uploads whose URL expired without the
+// upload being finalized, and drops their manifest entries. It returns how many were purged
+func (s *SupabaseServiceImpl) PurgeExpiredUploads(accountAddress string) (int, error) {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	purged := 0
+	for key, entry := range manifest {
+		if !entry.Pending || entry.ExpiresAt > now {
+			continue
+		}
+		// Deleting a key that was never uploaded succeeds, so abandoned URLs need no special case
+		_, err := s.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(entry.BlobName),
+		})
+		if err != nil {
+			fmt.Printf("ERROR: Failed to purge expired upload %s: %v\n", entry.BlobName, err)
+			continue
+		}
+		delete(manifest, key)
+		purged++
+	}
+
+	if purged == 0 {
+		return 0, nil
+	}
+	fmt.Printf("DEBUG: Purged %d expired uploads for %s\n", purged, accountAddress)
+	return purged, s.storeManifest(accountAddress, manifest)
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/internal/store"
+	"github.com/datax/backend/models"
+)
+
+// Reward worker limits
+const (
+	maxRewardEntries     = 1000 // Ledger entries kept, oldest dropped first
+	rewardBatchSize      = 50   // DataSubmitted events read per poll
+	rewardStateConflicts = 3    // Reload-and-retry rounds when another instance wrote the ledger
+	rewardMintAttempts   = 5    // Mints submitted for one reward before it is marked failed
+)
+
+// Waits before retrying a failed mint: doubled after each attempt, up to the maximum
+var (
+	rewardRetryBackoff    = 30 * time.Second
+	rewardMaxRetryBackoff = time.Hour
+)
+
+const stateKeyRewards = "system/rewards.json"
+
+var (
+	// ErrRewardsDisabled is returned by the reward endpoints when REWARDS_ENABLED is off
+	ErrRewardsDisabled = errors.New("contribution rewards are not enabled; set REWARDS_ENABLED")
+	// errRewardClaimed means another instance handled the event first
+	errRewardClaimed = errors.New("reward event already handled")
+)
+
+// rewardState is the ledger document. The cursor moves past an event, and its entry is
+// written as pending, before the mint is submitted, so a restart never mints twice for it
+type rewardState struct {
+	Version     uint64               `json:"version"`
+	EventIndex  int                  `json:"event_index"`
+	Paused      bool                 `json:"paused"`
+	Day         string               `json:"day"`
+	DailyTotals map[string]uint64    `json:"daily_totals"`
+	Entries     []models.RewardEntry `json:"entries"`
+}
+
+// RewardService mints REWARD_AMOUNT to the submitter of every DataSubmitted event the local
+// event index records, with the DataX module account as minter. Submissions made before
+// the worker first ran are not rewarded
+type RewardService struct {
+	chain     *AptosServiceImpl
+	state     StateStore
+	allowlist map[string]bool // Empty allows everyone
+	denylist  map[string]bool
+}
+
+// NewRewardService creates the worker. It needs the chain service's event store and a state
+// store for the ledger
+func NewRewardService(chain *AptosServiceImpl, state StateStore) (*RewardService, error) {
+	if chain.eventStore == nil {
+		return nil, fmt.Errorf("rewards need the local event index (SOURCE=local)")
+	}
+	if state == nil {
+		return nil, fmt.Errorf("rewards need a state store (DATABASE_URL or a storage backend with one) to remember what was paid")
+	}
+	minter, err := getAccountFromPrivateKey(config.AppConfig.RewardMinterKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REWARD_MINTER_PRIVATE_KEY: %w", err)
+	}
+	if moduleAddr, err := parseAddress(config.AppConfig.DataXModuleAddr); err == nil && minter.Address != *moduleAddr {
+		fmt.Printf("WARNING: REWARD_MINTER_PRIVATE_KEY signs for %s, not the DataX module account %s; mints will abort\n", minter.Address.String(), moduleAddr.String())
+	}
+	if config.AppConfig.RewardDailyCap == 0 {
+		fmt.Printf("WARNING: REWARD_DAILY_CAP is 0, so an address can earn any amount by submitting datasets\n")
+	}
+
+	r := &RewardService{
+		chain:     chain,
+		state:     state,
+		allowlist: make(map[string]bool),
+		denylist:  make(map[string]bool),
+	}
+	for _, address := range config.AppConfig.RewardAllowlist {
+		normalized, err := NormalizeAddress(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REWARD_ALLOWLIST entry %q: %w", address, err)
+		}
+		r.allowlist[normalized] = true
+	}
+	for _, address := range config.AppConfig.RewardDenylist {
+		normalized, err := NormalizeAddress(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REWARD_DENYLIST entry %q: %w", address, err)
+		}
+		r.denylist[normalized] = true
+	}
+	return r, nil
+}
+
+// Run pays rewards every REWARD_POLL_INTERVAL until ctx is cancelled. Entries a previous run
+// left pending are marked interrupted first; whether their mint went through is unknown
+func (r *RewardService) Run(ctx context.Context) {
+	if err := r.update(func(state *rewardState) error {
+		for i := range state.Entries {
+			if state.Entries[i].Status == models.RewardPending {
+				state.Entries[i].Status = models.RewardInterrupted
+				fmt.Printf("WARNING: Reward for dataset %d of %s was being minted when the server stopped; check before paying it by hand\n", state.Entries[i].DatasetID, state.Entries[i].Owner)
+			}
+		}
+		return nil
+	}); err != nil {
+		fmt.Printf("WARNING: Failed to check the reward ledger for interrupted mints: %v\n", err)
+	}
+
+	interval := time.Duration(config.AppConfig.RewardPollInterval) * time.Second
+	for {
+		if err := r.payBatch(ctx); err != nil {
+			fmt.Printf("WARNING: Reward worker poll failed, retrying in %v: %v\n", interval, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Ledger returns the worker's state and its entries, newest first, only those of address when
+// it isn't empty
+func (r *RewardService) Ledger(address string) (models.RewardLedger, error) {
+	if r == nil {
+		return models.RewardLedger{}, ErrRewardsDisabled
+	}
+	state, _, err := r.load()
+	if err != nil {
+		return models.RewardLedger{}, err
+	}
+
+	ledger := models.RewardLedger{
+		Paused:      state.Paused,
+		Version:     state.Version,
+		EventIndex:  state.EventIndex,
+		Day:         state.Day,
+		DailyTotals: state.DailyTotals,
+		Entries:     make([]models.RewardEntry, 0),
+	}
+	for i := len(state.Entries) - 1; i >= 0; i-- {
+		if address == "" || state.Entries[i].Owner == address {
+			ledger.Entries = append(ledger.Entries, state.Entries[i])
+		}
+	}
+	return ledger, nil
+}
+
+// SetPaused stops or resumes paying rewards. Submissions made while paused are paid on resume
+func (r *RewardService) SetPaused(paused bool) error {
+	if r == nil {
+		return ErrRewardsDisabled
+	}
+	return r.update(func(state *rewardState) error {
+		state.Paused = paused
+		return nil
+	})
+}
+
+// payBatch retries the failed mints that are due, then rewards the DataSubmitted events after
+// the cursor, one at a time
+func (r *RewardService) payBatch(ctx context.Context) error {
+	state, _, err := r.load()
+	if err != nil {
+		return err
+	}
+	if state.Paused {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	for _, entry := range state.Entries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if entry.Status != models.RewardRetrying || entry.RetryAt > now {
+			continue
+		}
+		paused, err := r.retry(entry)
+		if err != nil || paused {
+			return err
+		}
+	}
+
+	events, err := r.chain.eventStore.EventsAfter(store.EventDataSubmitted, state.Version, state.EventIndex, rewardBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return nil
+		}
+		paused, err := r.pay(event)
+		if err != nil || paused {
+			return err
+		}
+	}
+	return nil
+}
+
+// pay handles one event: it claims it in the ledger, then mints. It reports whether the
+// worker was paused in the meantime, in which case nothing was done
+func (r *RewardService) pay(event store.Event) (bool, error) {
+	entry := models.RewardEntry{
+		Version:    event.Version,
+		EventIndex: event.Index,
+		Owner:      event.Owner,
+		DatasetID:  event.DatasetID,
+		Amount:     uint64(config.AppConfig.RewardAmount),
+		Status:     models.RewardPending,
+	}
+	switch {
+	case r.denylist[event.Owner]:
+		entry.Status, entry.Reason = models.RewardSkipped, "address is on REWARD_DENYLIST"
+	case len(r.allowlist) > 0 && !r.allowlist[event.Owner]:
+		entry.Status, entry.Reason = models.RewardSkipped, "address is not on REWARD_ALLOWLIST"
+	default:
+		// A node error leaves the event for the next poll rather than skipping it
+		registered, err := r.chain.IsTokenRegistered(event.Owner)
+		if err != nil {
+			return false, err
+		}
+		if !registered {
+			entry.Status, entry.Reason = models.RewardSkipped, "address has not registered to receive the token"
+		}
+	}
+
+	paused := false
+	err := r.update(func(state *rewardState) error {
+		if state.Paused {
+			paused = true
+			return nil
+		}
+		if state.Version > event.Version || (state.Version == event.Version && state.EventIndex >= event.Index) {
+			return errRewardClaimed
+		}
+
+		claimed := entry
+		claimed.CreatedAt = time.Now().Unix()
+		if claimed.Status == models.RewardPending {
+			r.rollDay(state)
+			if limit := uint64(config.AppConfig.RewardDailyCap); limit > 0 {
+				earned := state.DailyTotals[claimed.Owner]
+				if earned >= limit {
+					claimed.Status, claimed.Reason = models.RewardSkipped, "REWARD_DAILY_CAP reached"
+				} else if claimed.Amount > limit-earned {
+					claimed.Amount = limit - earned
+				}
+			}
+			if claimed.Status == models.RewardPending {
+				state.DailyTotals[claimed.Owner] += claimed.Amount
+			}
+		}
+		state.Version, state.EventIndex = event.Version, event.Index
+		state.Entries = append(state.Entries, claimed)
+		if len(state.Entries) > maxRewardEntries {
+			state.Entries = state.Entries[len(state.Entries)-maxRewardEntries:]
+		}
+		entry = claimed
+		return nil
+	})
+	if errors.Is(err, errRewardClaimed) {
+		return false, nil
+	}
+	if err != nil || paused || entry.Status != models.RewardPending {
+		return paused, err
+	}
+
+	return false, r.mint(entry)
+}
+
+// retry claims a retrying entry back to pending, then mints it again. It reports whether the
+// worker was paused in the meantime, in which case nothing was done
+func (r *RewardService) retry(entry models.RewardEntry) (bool, error) {
+	paused, claimed := false, false
+	err := r.update(func(state *rewardState) error {
+		paused, claimed = state.Paused, false
+		if paused {
+			return nil
+		}
+		if e := findRewardEntry(state, entry); e != nil && e.Status == models.RewardRetrying {
+			e.Status, claimed = models.RewardPending, true
+		}
+		return nil
+	})
+	if err != nil || paused || !claimed {
+		return paused, err
+	}
+	return false, r.mint(entry)
+}
+
+// mint submits the mint of a pending entry and records how it went. A mint that certainly
+// didn't go through is retried with backoff; one whose outcome is unknown is never minted
+// again, like a mint the server stopped during
+func (r *RewardService) mint(entry models.RewardEntry) error {
+	txHash, mintErr := r.chain.MintToken(config.AppConfig.RewardMinterKey, entry.Owner, entry.Amount)
+	switch {
+	case mintErr == nil:
+		fmt.Printf("DEBUG: Rewarded %s with %d for dataset %d in %s\n", entry.Owner, entry.Amount, entry.DatasetID, txHash)
+	case errors.Is(mintErr, ErrTransactionUnconfirmed):
+		fmt.Printf("WARNING: Reward mint for dataset %d of %s was not confirmed; check before paying it by hand: %v\n", entry.DatasetID, entry.Owner, mintErr)
+	default:
+		fmt.Printf("ERROR: Failed to mint the reward for dataset %d of %s (attempt %d/%d): %v\n", entry.DatasetID, entry.Owner, entry.Attempts+1, rewardMintAttempts, mintErr)
+	}
+
+	return r.update(func(state *rewardState) error {
+		e := findRewardEntry(state, entry)
+		if e == nil {
+			return nil
+		}
+		e.Attempts = entry.Attempts + 1
+		e.RetryAt = 0
+		switch {
+		case mintErr == nil:
+			e.Status, e.Reason, e.TransactionHash = models.RewardMinted, "", txHash
+		case errors.Is(mintErr, ErrTransactionUnconfirmed):
+			e.Status, e.Reason = models.RewardInterrupted, mintErr.Error()
+		case e.Attempts < rewardMintAttempts:
+			e.Status, e.Reason = models.RewardRetrying, mintErr.Error()
+			e.RetryAt = time.Now().Add(rewardRetryDelay(e.Attempts)).Unix()
+		default:
+			e.Status, e.Reason = models.RewardFailed, mintErr.Error()
+			// Nothing was paid, so it doesn't count against today's cap
+			if state.Day == time.Unix(e.CreatedAt, 0).UTC().Format(time.DateOnly) && state.DailyTotals[e.Owner] >= e.Amount {
+				state.DailyTotals[e.Owner] -= e.Amount
+			}
+		}
+		return nil
+	})
+}
+
+// rewardRetryDelay is the wait before the next mint after attempts failed ones
+func rewardRetryDelay(attempts int) time.Duration {
+	delay := rewardRetryBackoff
+	for i := 1; i < attempts; i++ {
+		if delay *= 2; delay >= rewardMaxRetryBackoff {
+			return rewardMaxRetryBackoff
+		}
+	}
+	return delay
+}
+
+// findRewardEntry returns the ledger's entry for the same event as entry, nil when it has been
+// dropped from the ledger
+func findRewardEntry(state *rewardState, entry models.RewardEntry) *models.RewardEntry {
+	for i := range state.Entries {
+		if state.Entries[i].Version == entry.Version && state.Entries[i].EventIndex == entry.EventIndex {
+			return &state.Entries[i]
+		}
+	}
+	return nil
+}
+
+// rollDay starts a new day's totals when the UTC date has changed
+func (r *RewardService) rollDay(state *rewardState) {
+	today := time.Now().UTC().Format(time.DateOnly)
+	if state.Day != today || state.DailyTotals == nil {
+		state.Day = today
+		state.DailyTotals = make(map[string]uint64)
+	}
+}
+
+// load returns the ledger and its ETag. The first load starts the cursor at the ledger tip
+// and saves it, so submissions from before rewards were turned on aren't paid
+func (r *RewardService) load() (*rewardState, string, error) {
+	var state rewardState
+	etag, err := r.state.LoadState(stateKeyRewards, &state)
+	if err == nil {
+		return &state, etag, nil
+	}
+	if !errors.Is(err, ErrStateNotFound) {
+		return nil, "", err
+	}
+
+	ledgerVersion, err := r.chain.getLedgerVersion()
+	if err != nil {
+		return nil, "", err
+	}
+	// Every event of the tip transaction counts as handled too
+	state = rewardState{Version: ledgerVersion, EventIndex: math.MaxInt32, Entries: []models.RewardEntry{}}
+	r.rollDay(&state)
+	etag, err = r.state.SaveState(stateKeyRewards, &state, "")
+	if errors.Is(err, ErrStateConflict) {
+		// Another instance started the ledger first
+		etag, err = r.state.LoadState(stateKeyRewards, &state)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	fmt.Printf("DEBUG: Reward worker starting after version %d\n", state.Version)
+	return &state, etag, nil
+}
+
+// update applies fn to the ledger and saves it. Writes are conditional, so a concurrent write
+// by another instance is reloaded and fn applied again
+func (r *RewardService) update(fn func(*rewardState) error) error {
+	for range rewardStateConflicts {
+		state, etag, err := r.load()
+		if err != nil {
+			return err
+		}
+		if err := fn(state); err != nil {
+			return err
+		}
+		_, err = r.state.SaveState(stateKeyRewards, state, etag)
+		if !errors.Is(err, ErrStateConflict) {
+			return err
+		}
+	}
+	return ErrStateConflict
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/internal/store"
+	"github.com/datax/backend/models"
+)
+
+// memStateStore is a StateStore in memory, with a counter for ETags
+type memStateStore struct {
+	mu   sync.Mutex
+	docs map[string][]byte
+	tags map[string]string
+	next int
+}
+
+func newMemStateStore() *memStateStore {
+	return &memStateStore{docs: make(map[string][]byte), tags: make(map[string]string)}
+}
+
+func (m *memStateStore) LoadState(key string, v interface{}) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.docs[key]
+	if !ok {
+		return "", ErrStateNotFound
+	}
+	return m.tags[key], json.Unmarshal(doc, v)
+}
+
+func (m *memStateStore) SaveState(key string, v interface{}, etag string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tags[key] != etag {
+		return "", ErrStateConflict
+	}
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	m.next++
+	m.docs[key], m.tags[key] = doc, strconv.Itoa(m.next)
+	return m.tags[key], nil
+}
+
+// newTestRewards creates a reward worker minting through client, with the DataSubmitted
+// events of owner's datasets 1 to submissions at versions 11 onwards, and a ledger that
+// hasn't handled any of them
+func newTestRewards(t *testing.T, client *fakeAptosClient, owner string, submissions int) *RewardService {
+	t.Helper()
+	saved := *config.AppConfig
+	config.AppConfig.RewardMinterKey = testSponsorKey
+	config.AppConfig.RewardAmount = 100
+	config.AppConfig.RewardDailyCap = 0
+	config.AppConfig.RewardAllowlist, config.AppConfig.RewardDenylist = nil, nil
+	backoff := rewardRetryBackoff
+	rewardRetryBackoff = 0
+	t.Cleanup(func() {
+		*config.AppConfig = saved
+		rewardRetryBackoff = backoff
+	})
+
+	events, err := store.Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatalf("store.Open: %v", err)
+	}
+	t.Cleanup(func() { events.Close() })
+	for id := 1; id <= submissions; id++ {
+		event := store.Event{Kind: store.EventDataSubmitted, Version: uint64(10 + id), Owner: owner, DatasetID: uint64(id), DataHash: "ab"}
+		if err := events.Apply([]store.Event{event}, event.Version, event.Version); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+	}
+
+	client.views = map[string][]any{"coin::is_account_registered": {true}}
+	chain := newFakeClientService(t, client)
+	chain.eventStore = events
+	state := newMemStateStore()
+	if _, err := state.SaveState(stateKeyRewards, &rewardState{Version: 10, Entries: []models.RewardEntry{}}, ""); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+
+	rewards, err := NewRewardService(chain, state)
+	if err != nil {
+		t.Fatalf("NewRewardService: %v", err)
+	}
+	return rewards
+}
+
+func rewardLedger(t *testing.T, rewards *RewardService) models.RewardLedger {
+	t.Helper()
+	ledger, err := rewards.Ledger("")
+	if err != nil {
+		t.Fatalf("Ledger: %v", err)
+	}
+	return ledger
+}
+
+func TestRewardMintsAreRetriedUntilTheyGoThrough(t *testing.T) {
+	client := &fakeAptosClient{submitErr: errors.New("mempool is full")}
+	rewards := newTestRewards(t, client, testOwnerA, 1)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := rewards.payBatch(context.Background()); err != nil {
+			t.Fatalf("payBatch: %v", err)
+		}
+		ledger := rewardLedger(t, rewards)
+		if entry := ledger.Entries[0]; len(ledger.Entries) != 1 || entry.Status != models.RewardRetrying || entry.Attempts != attempt {
+			t.Fatalf("after failed attempt %d: %+v, want one retrying entry", attempt, ledger.Entries)
+		}
+		// A retrying mint holds its place under the cap
+		if total := ledger.DailyTotals[testOwnerA]; total != 100 {
+			t.Errorf("daily total %d while retrying, want 100", total)
+		}
+	}
+
+	client.submitErr = nil
+	if err := rewards.payBatch(context.Background()); err != nil {
+		t.Fatalf("payBatch: %v", err)
+	}
+	entry := rewardLedger(t, rewards).Entries[0]
+	if entry.Status != models.RewardMinted || entry.TransactionHash == "" || entry.Attempts != 3 || entry.Reason != "" {
+		t.Errorf("after the mint went through: %+v, want minted on attempt 3", entry)
+	}
+	if len(client.submitted) != 1 {
+		t.Errorf("%d mints submitted, want 1", len(client.submitted))
+	}
+
+	// Nothing is left to retry
+	if err := rewards.payBatch(context.Background()); err != nil {
+		t.Fatalf("payBatch: %v", err)
+	}
+	if len(client.submitted) != 1 {
+		t.Errorf("%d mints submitted after another poll, want 1", len(client.submitted))
+	}
+}
+
+func TestRewardMintsGiveUpAfterTheLastAttempt(t *testing.T) {
+	client := &fakeAptosClient{vmStatus: "Move abort in 0x1::coin: ECOIN_STORE_NOT_PUBLISHED(0x60005): "}
+	rewards := newTestRewards(t, client, testOwnerA, 1)
+
+	for range rewardMintAttempts + 2 {
+		if err := rewards.payBatch(context.Background()); err != nil {
+			t.Fatalf("payBatch: %v", err)
+		}
+	}
+	ledger := rewardLedger(t, rewards)
+	if entry := ledger.Entries[0]; entry.Status != models.RewardFailed || entry.Attempts != rewardMintAttempts {
+		t.Errorf("entry %+v, want failed after %d attempts", entry, rewardMintAttempts)
+	}
+	if len(client.submitted) != rewardMintAttempts {
+		t.Errorf("%d mints submitted, want %d", len(client.submitted), rewardMintAttempts)
+	}
+	// Nothing was paid, so the cap is free again
+	if total := ledger.DailyTotals[testOwnerA]; total != 0 {
+		t.Errorf("daily total %d after giving up, want 0", total)
+	}
+}
+
+func TestRewardMintsOfUnknownOutcomeAreNotRetried(t *testing.T) {
+	client := &fakeAptosClient{waitErr: errors.New("context deadline exceeded")}
+	rewards := newTestRewards(t, client, testOwnerA, 1)
+
+	for range 3 {
+		if err := rewards.payBatch(context.Background()); err != nil {
+			t.Fatalf("payBatch: %v", err)
+		}
+	}
+	// The mint may still commit, so it is left for someone to check rather than sent again
+	entry := rewardLedger(t, rewards).Entries[0]
+	if entry.Status != models.RewardInterrupted || len(client.submitted) != 1 {
+		t.Errorf("entry %+v after %d mints, want interrupted after 1", entry, len(client.submitted))
+	}
+}
+
+func TestRewardRetriesWaitWhilePaused(t *testing.T) {
+	client := &fakeAptosClient{submitErr: errors.New("mempool is full")}
+	rewards := newTestRewards(t, client, testOwnerA, 1)
+
+	rewards.payBatch(context.Background())
+	client.submitErr = nil
+	if err := rewards.SetPaused(true); err != nil {
+		t.Fatalf("SetPaused: %v", err)
+	}
+	rewards.payBatch(context.Background())
+	if len(client.submitted) != 0 {
+		t.Fatal("a mint was retried while paused")
+	}
+
+	rewards.SetPaused(false)
+	rewards.payBatch(context.Background())
+	if entry := rewardLedger(t, rewards).Entries[0]; entry.Status != models.RewardMinted {
+		t.Errorf("after resuming: %+v, want minted", entry)
+	}
+}
+
+func TestRewardDailyCapLimitsEachAddress(t *testing.T) {
+	client := &fakeAptosClient{}
+	rewards := newTestRewards(t, client, testOwnerA, 3)
+	config.AppConfig.RewardDailyCap = 150
+
+	if err := rewards.payBatch(context.Background()); err != nil {
+		t.Fatalf("payBatch: %v", err)
+	}
+	ledger := rewardLedger(t, rewards)
+	var statuses []string
+	var amounts []uint64
+	for i := len(ledger.Entries) - 1; i >= 0; i-- {
+		statuses = append(statuses, ledger.Entries[i].Status)
+		amounts = append(amounts, ledger.Entries[i].Amount)
+	}
+	want := []string{models.RewardMinted, models.RewardMinted, models.RewardSkipped}
+	if len(statuses) != 3 || statuses[0] != want[0] || statuses[1] != want[1] || statuses[2] != want[2] {
+		t.Fatalf("statuses %v, want %v", statuses, want)
+	}
+	if amounts[0] != 100 || amounts[1] != 50 || ledger.DailyTotals[testOwnerA] != 150 {
+		t.Errorf("amounts %v, total %d, want 100 then 50 up to the cap of 150", amounts, ledger.DailyTotals[testOwnerA])
+	}
+}
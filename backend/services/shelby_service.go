@@ -2,26 +2,30 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
 )
 
-type StorageService interface {
-	StoreCSV(accountAddress string, data [][]string) (string, error)
-	RetrieveCSV(accountAddress string, blobName string) ([][]string, error)
-}
-
 type ShelbyServiceImpl struct {
 	rpcURL     string
 	accountKey string
 	httpClient *http.Client
+	manifestMu sync.Mutex // Serializes manifest read-modify-write
+
+	sessionMu sync.Mutex
+	sessions  map[string]bool // Accounts with an open micropayment channel
 }
 
 func NewShelbyService() StorageService {
@@ -40,9 +44,71 @@ func NewShelbyService() StorageService {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		sessions: make(map[string]bool),
+	}
+}
+
+// shelbyPingBlob is read by Ping; it never exists, so a 404 proves the API and key work
+const shelbyPingBlob = "0x1/.datax-ping"
+
+// Ping checks the Shelby RPC answers and accepts the account key
+// The blob API has no bucket to inspect, so a marker blob is requested instead
+func (s *ShelbyServiceImpl) Ping(ctx context.Context) error {
+	pingURL := fmt.Sprintf("%s/v1/blobs/%s", s.rpcURL, shelbyPingBlob)
+	req, err := http.NewRequestWithContext(ctx, "GET", pingURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create ping request: %w", err)
+	}
+
+	if s.accountKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accountKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("shelby RPC %s is unreachable: %w", s.rpcURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("shelby rejected SHELBY_ACCOUNT_KEY (status %d)", resp.StatusCode)
+	default:
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("shelby ping failed with status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 }
 
+// ensureSession opens the account's micropayment channel once and reuses it for later uploads
+func (s *ShelbyServiceImpl) ensureSession(accountAddress string) error {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+
+	if s.sessions[accountAddress] {
+		return nil
+	}
+	if err := s.createMicropaymentChannel(accountAddress); err != nil {
+		return err
+	}
+	s.sessions[accountAddress] = true
+	return nil
+}
+
+// dropSession forgets an account's channel after Shelby refuses an upload, so the next
+// upload opens a new one
+func (s *ShelbyServiceImpl) dropSession(accountAddress string) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	delete(s.sessions, accountAddress)
+}
+
+// sessionRejected reports whether an upload status means the micropayment channel is gone
+func sessionRejected(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusPaymentRequired
+}
+
 // createMicropaymentChannel creates a micropayment channel session for the account
 // According to Shelby API: POST /v1/sessions/micropaymentchannels
 func (s *ShelbyServiceImpl) createMicropaymentChannel(accountAddress string) error {
@@ -91,11 +157,50 @@ func (s *ShelbyServiceImpl) createMicropaymentChannel(accountAddress string) err
 	return nil
 }
 
+// StoreCSVStream stores CSV bytes on Shelby
+// The Shelby blob API takes the whole body in one request, so the stream is read fully first.
+// Blob names are returned to the caller rather than derived from dataHash
+func (s *ShelbyServiceImpl) StoreCSVStream(accountAddress string, dataHash string, r io.Reader) (string, error) {
+	counter := &countingReader{r: r}
+	data, err := csv.NewReader(counter).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to read CSV stream: %w", err)
+	}
+	blobName, err := s.StoreCSV(accountAddress, data)
+	if err != nil {
+		return "", err
+	}
+
+	if NormalizeDataHash(dataHash) != "" {
+		err := s.UpdateManifest(accountAddress, dataHash, models.BlobManifestEntry{
+			BlobName:   blobName,
+			UploadedAt: time.Now().Unix(),
+			Size:       counter.n,
+		})
+		if err != nil {
+			fmt.Printf("ERROR: Failed to record %s in manifest for %s: %v\n", blobName, accountAddress, err)
+		}
+	}
+	return blobName, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
 // StoreCSV stores CSV data on Shelby and returns the blob name
 // According to Shelby API: POST /v1/blobs/{account}/{blobName}
 func (s *ShelbyServiceImpl) StoreCSV(accountAddress string, data [][]string) (string, error) {
-	// First, create a micropayment channel session
-	if err := s.createMicropaymentChannel(accountAddress); err != nil {
+	// Uploads need a micropayment channel session, opened on the first upload
+	if err := s.ensureSession(accountAddress); err != nil {
 		return "", fmt.Errorf("failed to create session before upload: %w", err)
 	}
 
@@ -147,6 +252,9 @@ func (s *ShelbyServiceImpl) StoreCSV(accountAddress string, data [][]string) (st
 	fmt.Printf("DEBUG: Shelby upload response: Status=%d, Body=%s\n", resp.StatusCode, string(bodyBytes))
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		if sessionRejected(resp.StatusCode) {
+			s.dropSession(accountAddress)
+		}
 		return "", fmt.Errorf("shelby upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
@@ -176,6 +284,10 @@ func (s *ShelbyServiceImpl) StoreCSV(accountAddress string, data [][]string) (st
 // RetrieveCSV retrieves CSV data from Shelby using blob name
 // According to Shelby API: GET /v1/blobs/{account}/{blobName}
 func (s *ShelbyServiceImpl) RetrieveCSV(accountAddress string, blobName string) ([][]string, error) {
+	if strings.HasSuffix(blobName, encryptedBlobSuffix) {
+		return retrieveSealedCSV(s, accountAddress, blobName)
+	}
+
 	// Download from Shelby API
 	// Shelby API: GET /v1/blobs/{account}/{blobName}
 	// Account address should be in the path
@@ -218,6 +330,503 @@ func (s *ShelbyServiceImpl) RetrieveCSV(accountAddress string, blobName string)
 	return records, nil
 }
 
+// StoreEncryptedCSV uploads an encrypted CSV as a {name}.csv.enc blob and its encryption
+// metadata as a {name}.csv.enc.meta companion blob, the same layout as the Supabase bucket.
+// The ciphertext is removed again if the metadata can't be stored, since it couldn't be decrypted
+func (s *ShelbyServiceImpl) StoreEncryptedCSV(accountAddress string, ciphertext []byte, metadata []byte) (string, error) {
+	if err := s.ensureSession(accountAddress); err != nil {
+		return "", fmt.Errorf("failed to create session before upload: %w", err)
+	}
+
+	blobName := fmt.Sprintf("csv_%d_%x%s", time.Now().Unix(), ciphertext[:min(16, len(ciphertext))], encryptedBlobSuffix)
+	fmt.Printf("DEBUG: Uploading encrypted CSV to Shelby: Blob=%s, Size=%d bytes\n", blobName, len(ciphertext))
+	if err := s.putBlob(accountAddress, blobName, "application/octet-stream", ciphertext); err != nil {
+		return "", err
+	}
+
+	if err := s.putBlob(accountAddress, blobName+encryptionMetaSuffix, "application/json", metadata); err != nil {
+		if delErr := s.deleteBlobObject(accountAddress, blobName); delErr != nil {
+			fmt.Printf("WARNING: Failed to remove %s after its metadata upload failed: %v\n", blobName, delErr)
+		}
+		return "", fmt.Errorf("failed to store encryption metadata: %w", err)
+	}
+	return blobName, nil
+}
+
+// RetrieveEncryptedCSV downloads an encrypted blob and its encryption metadata
+// Names recorded without the .enc suffix are retried with it, as on Supabase
+func (s *ShelbyServiceImpl) RetrieveEncryptedCSV(accountAddress string, blobName string) ([]byte, []byte, error) {
+	candidates := []string{blobName}
+	switch {
+	case strings.HasSuffix(blobName, encryptedBlobSuffix):
+	case strings.HasSuffix(blobName, ".csv"):
+		candidates = append(candidates, blobName+".enc")
+	default:
+		candidates = append(candidates, blobName+encryptedBlobSuffix)
+	}
+
+	for _, name := range candidates {
+		ciphertext, err := s.getBlob(accountAddress, name)
+		if errors.Is(err, ErrBlobNotFound) {
+			fmt.Printf("DEBUG: Encrypted blob %s not found on Shelby, trying next name\n", name)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		metadata, err := s.getBlob(accountAddress, name+encryptionMetaSuffix)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve encryption metadata for %s: %w", name, err)
+		}
+		return ciphertext, metadata, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrBlobNotFound, blobName)
+}
+
+// RetrieveEncryptionMetadata downloads an encrypted blob's .meta companion
+func (s *ShelbyServiceImpl) RetrieveEncryptionMetadata(accountAddress string, blobName string) ([]byte, error) {
+	metadata, err := s.getBlob(accountAddress, blobName+encryptionMetaSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve encryption metadata for %s: %w", blobName, err)
+	}
+	return metadata, nil
+}
+
+// StoreGranteeKey uploads a grant's wrapped data key as grants/{dataset_id}_{requester}.json
+func (s *ShelbyServiceImpl) StoreGranteeKey(owner string, key models.GranteeKey) error {
+	body, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wrapped key: %w", err)
+	}
+	if err := s.ensureSession(owner); err != nil {
+		return fmt.Errorf("failed to create session before upload: %w", err)
+	}
+	return s.putBlob(owner, granteeKeyObject(key.DatasetID, key.Requester), "application/json", body)
+}
+
+// RetrieveGranteeKey downloads a grant's wrapped data key
+func (s *ShelbyServiceImpl) RetrieveGranteeKey(owner string, datasetID uint64, requester string) (*models.GranteeKey, error) {
+	body, err := s.getBlob(owner, granteeKeyObject(datasetID, requester))
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, fmt.Errorf("%w: dataset %d, requester %s", ErrGranteeKeyNotFound, datasetID, requester)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var key models.GranteeKey
+	if err := json.Unmarshal(body, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse wrapped key: %w", err)
+	}
+	return &key, nil
+}
+
+// DeleteGranteeKey removes a grant's wrapped data key
+func (s *ShelbyServiceImpl) DeleteGranteeKey(owner string, datasetID uint64, requester string) error {
+	err := s.deleteBlobObject(owner, granteeKeyObject(datasetID, requester))
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil
+	}
+	return err
+}
+
+// StoreColumnGrant uploads a grant's column restriction as grants/{dataset_id}_{requester}.columns.json
+func (s *ShelbyServiceImpl) StoreColumnGrant(owner string, grant models.ColumnGrant) error {
+	body, err := json.Marshal(grant)
+	if err != nil {
+		return fmt.Errorf("failed to marshal column grant: %w", err)
+	}
+	if err := s.ensureSession(owner); err != nil {
+		return fmt.Errorf("failed to create session before upload: %w", err)
+	}
+	return s.putBlob(owner, columnGrantObject(grant.DatasetID, grant.Requester), "application/json", body)
+}
+
+// RetrieveColumnGrant downloads a grant's column restriction
+func (s *ShelbyServiceImpl) RetrieveColumnGrant(owner string, datasetID uint64, requester string) (*models.ColumnGrant, error) {
+	body, err := s.getBlob(owner, columnGrantObject(datasetID, requester))
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, fmt.Errorf("%w: dataset %d, requester %s", ErrColumnGrantNotFound, datasetID, requester)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var grant models.ColumnGrant
+	if err := json.Unmarshal(body, &grant); err != nil {
+		return nil, fmt.Errorf("failed to parse column grant: %w", err)
+	}
+	return &grant, nil
+}
+
+// DeleteColumnGrant removes a grant's column restriction
+func (s *ShelbyServiceImpl) DeleteColumnGrant(owner string, datasetID uint64, requester string) error {
+	err := s.deleteBlobObject(owner, columnGrantObject(datasetID, requester))
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil
+	}
+	return err
+}
+
+// putBlob uploads a blob body, dropping the session if Shelby no longer accepts it
+func (s *ShelbyServiceImpl) putBlob(accountAddress string, name string, contentType string, body []byte) error {
+	uploadURL := fmt.Sprintf("%s/v1/blobs/%s/%s", s.rpcURL, accountAddress, name)
+	req, err := http.NewRequest("POST", uploadURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if s.accountKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accountKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to Shelby: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		if sessionRejected(resp.StatusCode) {
+			s.dropSession(accountAddress)
+		}
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("shelby upload of %s failed with status %d: %s", name, resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// getBlob downloads a blob body; a missing blob is reported as ErrBlobNotFound
+func (s *ShelbyServiceImpl) getBlob(accountAddress string, name string) ([]byte, error) {
+	downloadURL := fmt.Sprintf("%s/v1/blobs/%s/%s", s.rpcURL, accountAddress, name)
+	req, err := http.NewRequest("GET", downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	if s.accountKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accountKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s from Shelby: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Shelby blob %s: %w", name, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("shelby download of %s failed with status %d: %s", name, resp.StatusCode, string(bodyBytes))
+	}
+	return bodyBytes, nil
+}
+
+// StoreCSVStats uploads the statistics for a blob as a sibling Shelby blob
+func (s *ShelbyServiceImpl) StoreCSVStats(accountAddress string, blobName string, stats *models.CSVStats) error {
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal CSV stats: %w", err)
+	}
+
+	uploadURL := fmt.Sprintf("%s/v1/blobs/%s/%s%s", s.rpcURL, accountAddress, blobName, csvStatsSuffix)
+	req, err := http.NewRequest("POST", uploadURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.accountKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accountKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload CSV stats to Shelby: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("shelby stats upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// RetrieveCSVStats downloads the statistics stored next to a blob
+func (s *ShelbyServiceImpl) RetrieveCSVStats(accountAddress string, blobName string) (*models.CSVStats, error) {
+	downloadURL := fmt.Sprintf("%s/v1/blobs/%s/%s%s", s.rpcURL, accountAddress, blobName, csvStatsSuffix)
+	req, err := http.NewRequest("GET", downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	if s.accountKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accountKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download CSV stats from Shelby: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("shelby stats download failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var stats models.CSVStats
+	if err := json.Unmarshal(bodyBytes, &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse CSV stats: %w", err)
+	}
+	return &stats, nil
+}
+
+// RetrieveManifest downloads the owner's manifest blob; a missing manifest is returned empty
+func (s *ShelbyServiceImpl) RetrieveManifest(accountAddress string) (models.BlobManifest, error) {
+	downloadURL := fmt.Sprintf("%s/v1/blobs/%s/%s", s.rpcURL, accountAddress, manifestObjectName)
+	req, err := http.NewRequest("GET", downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	if s.accountKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accountKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download manifest from Shelby: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotFound {
+		return models.BlobManifest{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("shelby manifest download failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	manifest := models.BlobManifest{}
+	if err := json.Unmarshal(bodyBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// UpdateManifest records the blob stored for a data hash in the owner's manifest blob
+// Updates are read-modify-write, serialized within this process
+func (s *ShelbyServiceImpl) UpdateManifest(accountAddress string, dataHash string, entry models.BlobManifestEntry) error {
+	key := NormalizeDataHash(dataHash)
+	if key == "" {
+		return fmt.Errorf("invalid data hash: %q", dataHash)
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return err
+	}
+	manifest[key] = entry
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// SetBlobMetadata records a blob's metadata on its manifest entries; Shelby blobs carry no user metadata
+func (s *ShelbyServiceImpl) SetBlobMetadata(accountAddress string, blobName string, metadata models.BlobMetadata) error {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return err
+	}
+	if setManifestBlobMetadata(manifest, blobName, metadata) == 0 {
+		return nil
+	}
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// storeManifest overwrites the owner's manifest blob; callers hold manifestMu
+func (s *ShelbyServiceImpl) storeManifest(accountAddress string, manifest models.BlobManifest) error {
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	uploadURL := fmt.Sprintf("%s/v1/blobs/%s/%s", s.rpcURL, accountAddress, manifestObjectName)
+	req, err := http.NewRequest("POST", uploadURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.accountKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accountKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload manifest to Shelby: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("shelby manifest upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// ListBlobs lists the account's blobs recorded in its manifest. The Shelby blob API has no
+// listing call, so blobs uploaded before the manifest existed are not returned
+func (s *ShelbyServiceImpl) ListBlobs(accountAddress string) ([]models.BlobInfo, error) {
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := manifestBlobMetadata(manifest)
+	seen := make(map[string]bool)
+	blobs := []models.BlobInfo{}
+	for _, entry := range manifest {
+		if seen[entry.BlobName] {
+			continue
+		}
+		seen[entry.BlobName] = true
+		blobs = append(blobs, models.BlobInfo{
+			Name:         entry.BlobName,
+			Size:         entry.Size,
+			LastModified: entry.UploadedAt,
+			Encrypted:    entry.Encrypted || strings.HasSuffix(entry.BlobName, encryptedBlobSuffix),
+			Metadata:     metadata[entry.BlobName],
+		})
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].LastModified > blobs[j].LastModified })
+	return blobs, nil
+}
+
+// FindBlobByDataHash looks a data hash up in the owner's manifest; Shelby blobs can't be
+// listed, so datasets uploaded before the manifest existed are not found
+func (s *ShelbyServiceImpl) FindBlobByDataHash(accountAddress string, dataHash string) (string, error) {
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return "", err
+	}
+	entry, ok := manifest[NormalizeDataHash(dataHash)]
+	if !ok || entry.Pending {
+		return "", fmt.Errorf("%w: no blob for data hash %s in the manifest of %s", ErrBlobNotFound, dataHash, accountAddress)
+	}
+	return entry.BlobName, nil
+}
+
+// DeleteBlob deletes a blob and its statistics and encryption metadata sidecars from Shelby and drops it from the manifest
+func (s *ShelbyServiceImpl) DeleteBlob(accountAddress string, blobName string) error {
+	for _, name := range []string{blobName, blobName + csvStatsSuffix, blobName + encryptionMetaSuffix} {
+		err := s.deleteBlobObject(accountAddress, name)
+		// A missing sidecar is fine; a missing blob is reported
+		if errors.Is(err, ErrBlobNotFound) && name != blobName {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return fmt.Errorf("blob deleted but manifest could not be read: %w", err)
+	}
+	if removeBlobFromManifest(manifest, blobName) == 0 {
+		return nil
+	}
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// deleteBlobObject deletes a single Shelby blob; a missing blob is reported as ErrBlobNotFound
+func (s *ShelbyServiceImpl) deleteBlobObject(accountAddress string, name string) error {
+	deleteURL := fmt.Sprintf("%s/v1/blobs/%s/%s", s.rpcURL, accountAddress, name)
+	req, err := http.NewRequest("DELETE", deleteURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+
+	if s.accountKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accountKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from Shelby: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrBlobNotFound, name)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("shelby delete of %s failed with status %d: %s", name, resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// PreviewCSV returns the header and first rows of a blob
+// The Shelby blob API has no ranged reads, so the blob is fetched whole; blobs over
+// PREVIEW_MAX_BYTES are refused rather than downloaded
+func (s *ShelbyServiceImpl) PreviewCSV(accountAddress string, blobName string, limit int) ([][]string, error) {
+	if strings.HasSuffix(blobName, encryptedBlobSuffix) {
+		return previewSealedCSV(s, accountAddress, blobName, limit)
+	}
+	downloadURL := fmt.Sprintf("%s/v1/blobs/%s/%s", s.rpcURL, accountAddress, blobName)
+	req, err := http.NewRequest("GET", downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	if s.accountKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.accountKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from Shelby: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("shelby download failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	maxBytes := int64(config.AppConfig.PreviewMaxBytes)
+	if resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("blob is %d bytes, over the %d byte preview limit", resp.ContentLength, maxBytes)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Shelby blob: %w", err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("blob is over the %d byte preview limit", maxBytes)
+	}
+
+	return readCSVPrefix(body, limit, true)
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
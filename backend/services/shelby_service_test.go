@@ -0,0 +1,213 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testShelbyKey = "shelby-key"
+
+// fakeShelby serves the Shelby blob API from memory: sessions, and uploads, reads and
+// deletes under /v1/blobs/{account}/{name}. Uploads whose name ends in refuse are answered
+// with refuseStatus
+type fakeShelby struct {
+	mu           sync.Mutex
+	blobs        map[string][]byte
+	sessions     int
+	refuse       string
+	refuseStatus int
+}
+
+func (f *fakeShelby) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+testShelbyKey {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path == "/v1/sessions/micropaymentchannels" && r.Method == http.MethodPost {
+		f.sessions++
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/v1/blobs/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		if f.refuse != "" && strings.HasSuffix(key, f.refuse) {
+			w.WriteHeader(f.refuseStatus)
+			io.WriteString(w, "refused")
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.blobs[key] = body
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		body, ok := f.blobs[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		if _, ok := f.blobs[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.blobs, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newFakeShelbyService returns a Shelby storage service whose RPC is served by f
+func newFakeShelbyService(t *testing.T, f *fakeShelby) *ShelbyServiceImpl {
+	t.Helper()
+	f.blobs = make(map[string][]byte)
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return &ShelbyServiceImpl{
+		rpcURL:     server.URL,
+		accountKey: testShelbyKey,
+		httpClient: server.Client(),
+		sessions:   make(map[string]bool),
+	}
+}
+
+func TestShelbyEncryptedCSVRoundTrip(t *testing.T) {
+	fake := &fakeShelby{}
+	s := newFakeShelbyService(t, fake)
+	ciphertext, metadata := []byte("\x00sealed bytes\xff"), []byte(`{"alg":"AES-256-GCM"}`)
+
+	blobName, err := s.StoreEncryptedCSV(testOwnerA, ciphertext, metadata)
+	if err != nil {
+		t.Fatalf("StoreEncryptedCSV: %v", err)
+	}
+	if !strings.HasSuffix(blobName, encryptedBlobSuffix) {
+		t.Errorf("blob name %q doesn't end in %s", blobName, encryptedBlobSuffix)
+	}
+	// The ciphertext and its metadata are stored side by side, as on Supabase
+	if stored := fake.blobs[testOwnerA+"/"+blobName]; !reflect.DeepEqual(stored, ciphertext) {
+		t.Errorf("stored blob = %q, want the ciphertext", stored)
+	}
+	if stored := fake.blobs[testOwnerA+"/"+blobName+encryptionMetaSuffix]; !reflect.DeepEqual(stored, metadata) {
+		t.Errorf("stored metadata = %q, want %q", stored, metadata)
+	}
+
+	gotCiphertext, gotMetadata, err := s.RetrieveEncryptedCSV(testOwnerA, blobName)
+	if err != nil || !reflect.DeepEqual(gotCiphertext, ciphertext) || !reflect.DeepEqual(gotMetadata, metadata) {
+		t.Errorf("RetrieveEncryptedCSV = %q, %q, %v, want what was stored", gotCiphertext, gotMetadata, err)
+	}
+	if gotMetadata, err := s.RetrieveEncryptionMetadata(testOwnerA, blobName); err != nil || !reflect.DeepEqual(gotMetadata, metadata) {
+		t.Errorf("RetrieveEncryptionMetadata = %q, %v, want %q", gotMetadata, err, metadata)
+	}
+
+	// The micropayment session opened by the first upload is reused by the next
+	if _, err := s.StoreEncryptedCSV(testOwnerA, []byte("more"), metadata); err != nil {
+		t.Fatalf("second StoreEncryptedCSV: %v", err)
+	}
+	if fake.sessions != 1 {
+		t.Errorf("%d sessions opened for two uploads, want 1", fake.sessions)
+	}
+}
+
+func TestShelbyRetrieveEncryptedCSVFallsBackToTheEncName(t *testing.T) {
+	fake := &fakeShelby{}
+	s := newFakeShelbyService(t, fake)
+	fake.blobs[testOwnerA+"/data.csv.enc"] = []byte("csv ciphertext")
+	fake.blobs[testOwnerA+"/data.csv.enc"+encryptionMetaSuffix] = []byte("csv meta")
+	fake.blobs[testOwnerA+"/plain"+encryptedBlobSuffix] = []byte("plain ciphertext")
+	fake.blobs[testOwnerA+"/plain"+encryptedBlobSuffix+encryptionMetaSuffix] = []byte("plain meta")
+
+	cases := []struct {
+		name               string
+		ciphertext, header string
+	}{
+		{"data.csv", "csv ciphertext", "csv meta"},
+		{"data.csv.enc", "csv ciphertext", "csv meta"},
+		{"plain", "plain ciphertext", "plain meta"},
+	}
+	for _, tc := range cases {
+		ciphertext, metadata, err := s.RetrieveEncryptedCSV(testOwnerA, tc.name)
+		if err != nil || string(ciphertext) != tc.ciphertext || string(metadata) != tc.header {
+			t.Errorf("RetrieveEncryptedCSV(%q) = %q, %q, %v, want %q, %q", tc.name, ciphertext, metadata, err, tc.ciphertext, tc.header)
+		}
+	}
+
+	if _, _, err := s.RetrieveEncryptedCSV(testOwnerA, "missing.csv"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("RetrieveEncryptedCSV of a missing blob = %v, want %v", err, ErrBlobNotFound)
+	}
+	// A blob whose metadata is gone can't be decrypted, so it isn't returned without it
+	delete(fake.blobs, testOwnerA+"/plain"+encryptedBlobSuffix+encryptionMetaSuffix)
+	if _, _, err := s.RetrieveEncryptedCSV(testOwnerA, "plain"); err == nil {
+		t.Error("RetrieveEncryptedCSV without the metadata blob succeeded")
+	}
+}
+
+func TestShelbyStoreEncryptedCSVRemovesTheBlobWhenTheMetadataFails(t *testing.T) {
+	fake := &fakeShelby{refuse: encryptionMetaSuffix, refuseStatus: http.StatusInternalServerError}
+	s := newFakeShelbyService(t, fake)
+
+	if _, err := s.StoreEncryptedCSV(testOwnerA, []byte("ciphertext"), []byte("{}")); err == nil {
+		t.Fatal("StoreEncryptedCSV succeeded without its metadata")
+	}
+	if len(fake.blobs) != 0 {
+		t.Errorf("blobs left behind: %d, want none", len(fake.blobs))
+	}
+}
+
+func TestShelbySessionIsReopenedAfterARefusedUpload(t *testing.T) {
+	fake := &fakeShelby{refuse: encryptedBlobSuffix, refuseStatus: http.StatusPaymentRequired}
+	s := newFakeShelbyService(t, fake)
+
+	if _, err := s.StoreEncryptedCSV(testOwnerA, []byte("ciphertext"), []byte("{}")); err == nil {
+		t.Fatal("StoreEncryptedCSV succeeded though Shelby asked for payment")
+	}
+	fake.refuse = ""
+	if _, err := s.StoreEncryptedCSV(testOwnerA, []byte("ciphertext"), []byte("{}")); err != nil {
+		t.Fatalf("StoreEncryptedCSV after the channel was reopened: %v", err)
+	}
+	if fake.sessions != 2 {
+		t.Errorf("%d sessions opened, want the refused one dropped and a new one opened", fake.sessions)
+	}
+
+	// Other accounts get their own session
+	if _, err := s.StoreEncryptedCSV(testOwnerB, []byte("ciphertext"), []byte("{}")); err != nil {
+		t.Fatalf("StoreEncryptedCSV for another account: %v", err)
+	}
+	if fake.sessions != 3 {
+		t.Errorf("%d sessions opened after another account's upload, want 3", fake.sessions)
+	}
+}
+
+func TestShelbyPlainCSVRoundTrip(t *testing.T) {
+	fake := &fakeShelby{}
+	s := newFakeShelbyService(t, fake)
+	data := [][]string{{"id", "name"}, {"1", "alpha, beta"}}
+
+	blobName, err := s.StoreCSV(testOwnerA, data)
+	if err != nil {
+		t.Fatalf("StoreCSV: %v", err)
+	}
+	if records, err := s.RetrieveCSV(testOwnerA, blobName); err != nil || !reflect.DeepEqual(records, data) {
+		t.Errorf("RetrieveCSV = %v, %v, want %v", records, err, data)
+	}
+
+	// A wrong account key is refused rather than read as an empty blob
+	s.accountKey = "wrong"
+	if _, err := s.RetrieveCSV(testOwnerA, blobName); err == nil {
+		t.Error("RetrieveCSV with a wrong account key succeeded")
+	}
+}
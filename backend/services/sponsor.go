@@ -0,0 +1,264 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+	"github.com/aptos-labs/aptos-go-sdk/bcs"
+	"github.com/aptos-labs/aptos-go-sdk/crypto"
+	"github.com/datax/backend/models"
+)
+
+// ErrSponsorNotConfigured is returned for sponsored transactions when SPONSOR_PRIVATE_KEY is
+// empty
+var ErrSponsorNotConfigured = errors.New("no sponsor account is configured (SPONSOR_PRIVATE_KEY)")
+
+// ErrSponsoredTransactionUnknown is returned for a co-signed transaction the backend didn't hand
+// out to that sender, or that was already submitted or has expired
+var ErrSponsoredTransactionUnknown = errors.New("sponsored transaction is unknown, already used or expired")
+
+// sponsoredTransactionTTL is how long, in seconds, a sender has to co-sign a sponsored
+// transaction; it is also the transaction's own expiration
+const sponsoredTransactionTTL = 300
+
+// loadSponsor reads the account paying gas for sponsored transactions; nil when no key is set
+func loadSponsor(privateKeyHex string) (*aptos.Account, error) {
+	if privateKeyHex == "" {
+		return nil, nil
+	}
+	sponsor, err := getAccountFromPrivateKey(privateKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SPONSOR_PRIVATE_KEY: %w", err)
+	}
+	return sponsor, nil
+}
+
+// sponsoredTransactions remembers the fee-payer transactions handed out for co-signing, so the
+// sponsor only ever signs bytes the backend built itself. The zero value is ready to use
+type sponsoredTransactions struct {
+	mu      sync.Mutex
+	pending map[string]sponsoredPending // By the transaction's hex encoding
+}
+
+type sponsoredPending struct {
+	sender    string
+	expiresAt time.Time
+}
+
+// issue records a fee-payer transaction and describes it for its sender to sign. It is encoded
+// as the TypeScript SDK's SimpleTransaction, which wallets sign as is
+func (p *sponsoredTransactions) issue(rawTxn *aptos.RawTransactionWithData) (*models.SponsoredTransaction, error) {
+	inner, ok := rawTxn.Inner.(*aptos.MultiAgentWithFeePayerRawTransactionWithData)
+	if !ok {
+		return nil, fmt.Errorf("not a fee payer transaction")
+	}
+	ser := &bcs.Serializer{}
+	rawTxn.MarshalTypeScriptBCS(ser)
+	if err := ser.Error(); err != nil {
+		return nil, fmt.Errorf("failed to encode sponsored transaction: %w", err)
+	}
+	encoded := "0x" + hex.EncodeToString(ser.ToBytes())
+	sender := inner.RawTxn.Sender.String()
+	expiresAt := time.Unix(int64(inner.RawTxn.ExpirationTimestampSeconds), 0)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = make(map[string]sponsoredPending)
+	}
+	now := time.Now()
+	for key, pending := range p.pending {
+		if now.After(pending.expiresAt) {
+			delete(p.pending, key)
+		}
+	}
+	p.pending[encoded] = sponsoredPending{sender: sender, expiresAt: expiresAt}
+
+	return &models.SponsoredTransaction{
+		RawTransaction: encoded,
+		Sender:         sender,
+		FeePayer:       inner.FeePayer.String(),
+		ExpiresAt:      expiresAt.Unix(),
+	}, nil
+}
+
+// take removes a transaction issued to sender and returns it with the sender's authenticator,
+// once the authenticator's signature checks out. A transaction can only be taken once
+func (p *sponsoredTransactions) take(sender string, rawTransaction string, authenticatorHex string) (*aptos.RawTransactionWithData, *crypto.AccountAuthenticator, error) {
+	key := strings.ToLower(strings.TrimSpace(rawTransaction))
+	if !strings.HasPrefix(key, "0x") {
+		key = "0x" + key
+	}
+
+	p.mu.Lock()
+	pending, ok := p.pending[key]
+	if ok && pending.sender == sender {
+		delete(p.pending, key)
+	}
+	p.mu.Unlock()
+	if !ok || pending.sender != sender || time.Now().After(pending.expiresAt) {
+		return nil, nil, ErrSponsoredTransactionUnknown
+	}
+
+	rawBytes, _ := hex.DecodeString(strings.TrimPrefix(key, "0x"))
+	rawTxn := &aptos.RawTransactionWithData{}
+	des := bcs.NewDeserializer(rawBytes)
+	rawTxn.UnmarshalTypeScriptBCS(des)
+	if err := des.Error(); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode sponsored transaction: %w", err)
+	}
+
+	authBytes, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(authenticatorHex), "0x"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: authenticator is not hex", ErrInvalidSignature)
+	}
+	authenticator := &crypto.AccountAuthenticator{}
+	des = bcs.NewDeserializer(authBytes)
+	authenticator.UnmarshalBCS(des)
+	if des.Error() != nil || des.Remaining() != 0 {
+		return nil, nil, fmt.Errorf("%w: malformed authenticator", ErrInvalidSignature)
+	}
+	message, err := rawTxn.SigningMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !authenticator.Verify(message) {
+		return nil, nil, fmt.Errorf("%w: authenticator does not sign the sponsored transaction", ErrInvalidSignature)
+	}
+	return rawTxn, authenticator, nil
+}
+
+// checkSignerKey refuses an authenticator whose public key isn't the one the sender's account
+// is authenticated by, authKey as 0x-prefixed hex
+func checkSignerKey(authenticator *crypto.AccountAuthenticator, authKey string) error {
+	if !strings.EqualFold(authenticator.PubKey().AuthKey().ToHex(), authKey) {
+		return fmt.Errorf("%w: authenticator key is not the sender's", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// IsMintAuthority reports whether the key's account may mint the DataX token. managed_coin keeps
+// the mint capability with the account that initialized the coin, the module address
+func (s *AptosServiceImpl) IsMintAuthority(privateKeyHex string) (bool, error) {
+	account, err := getAccountFromPrivateKey(privateKeyHex)
+	if err != nil {
+		return false, err
+	}
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
+	if err != nil {
+		return false, err
+	}
+	return account.Address == *moduleAddr, nil
+}
+
+// BuildSponsoredRegistration builds data_token::register for recipient with the sponsor as fee
+// payer, so accounts holding no APT can register. data_token::register takes the recipient's
+// &signer, so the recipient's wallet must sign the returned transaction; the sponsor signs when
+// SubmitSponsoredRegistration gets it back
+func (s *AptosServiceImpl) BuildSponsoredRegistration(recipient string) (*models.SponsoredTransaction, error) {
+	if s.sponsor == nil {
+		return nil, ErrSponsorNotConfigured
+	}
+	recipientAddr, err := parseAddress(recipient)
+	if err != nil {
+		return nil, err
+	}
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := entryFunctionPayload(moduleAddr, "data_token", "register", []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	options := []any{aptos.FeePayer(&s.sponsor.Address), aptos.ExpirationSeconds(sponsoredTransactionTTL)}
+	// An account the chain hasn't seen has no sequence number to look up; a sponsored
+	// transaction creates it starting from 0
+	_, exists, err := s.accountAuthKey(*recipientAddr)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		options = append(options, aptos.SequenceNumber(0))
+	}
+
+	rawTxn, err := s.client.BuildTransactionMultiAgent(*recipientAddr, payload, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build sponsored transaction: %w", err)
+	}
+	return s.sponsored.issue(rawTxn)
+}
+
+// SubmitSponsoredRegistration signs a registration from BuildSponsoredRegistration as fee
+// payer, submits it with the recipient's authenticator (BCS hex) and waits for confirmation
+func (s *AptosServiceImpl) SubmitSponsoredRegistration(recipient string, rawTransaction string, recipientAuthenticator string) (string, error) {
+	if s.sponsor == nil {
+		return "", ErrSponsorNotConfigured
+	}
+	recipientAddr, err := parseAddress(recipient)
+	if err != nil {
+		return "", err
+	}
+	rawTxn, senderAuth, err := s.sponsored.take(recipientAddr.String(), rawTransaction, recipientAuthenticator)
+	if err != nil {
+		return "", err
+	}
+	authKey, exists, err := s.accountAuthKey(*recipientAddr)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		// A new account's authentication key is its address
+		authKey = "0x" + hex.EncodeToString(recipientAddr[:])
+	}
+	if err := checkSignerKey(senderAuth, authKey); err != nil {
+		return "", err
+	}
+
+	sponsorAuth, err := rawTxn.Sign(s.sponsor)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign transaction as sponsor: %w", err)
+	}
+	signedTxn, ok := rawTxn.ToFeePayerSignedTransaction(senderAuth, sponsorAuth, []crypto.AccountAuthenticator{})
+	if !ok {
+		return "", fmt.Errorf("failed to build sponsored transaction: not a fee payer transaction")
+	}
+
+	response, err := s.client.SubmitTransaction(signedTxn)
+	if err != nil {
+		return "", fmt.Errorf("failed to submit sponsored transaction: %w", err)
+	}
+
+	return s.waitForSuccess(response.Hash)
+}
+
+// accountAuthKey returns the authentication key of the account at address, as 0x-prefixed hex,
+// and false when the chain has no account there
+func (s *AptosServiceImpl) accountAuthKey(address aptos.AccountAddress) (string, bool, error) {
+	accountURL := fmt.Sprintf("%s/v1/accounts/%s",
+		strings.TrimSuffix(s.cfg.AptosNodeURL, "/"),
+		address.String())
+
+	body, status, err := s.getWithRetry(accountURL, "account")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to query account %s: %w", address.String(), err)
+	}
+	if status == http.StatusNotFound {
+		return "", false, nil
+	}
+	var account struct {
+		AuthenticationKey string `json:"authentication_key"`
+	}
+	if err := json.Unmarshal(body, &account); err != nil {
+		return "", false, fmt.Errorf("failed to decode account %s: %w", address.String(), err)
+	}
+	return account.AuthenticationKey, true, nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+	"github.com/aptos-labs/aptos-go-sdk/bcs"
+)
+
+// Keys used by the sponsored transaction tests
+const (
+	testSponsorKey   = "ed25519-priv-0x3333333333333333333333333333333333333333333333333333333333333333"
+	testRecipientKey = "ed25519-priv-0x4444444444444444444444444444444444444444444444444444444444444444"
+	testOtherKey     = "ed25519-priv-0x5555555555555555555555555555555555555555555555555555555555555555"
+)
+
+// newSponsoringService creates a service sponsoring with testSponsorKey, submitting through
+// client and reading accounts from node
+func newSponsoringService(t *testing.T, node *fakeNode, client *fakeAptosClient) *AptosServiceImpl {
+	t.Helper()
+	service := newTestService(t, node, func(cfg *ServiceConfig) {
+		cfg.SponsorPrivateKey = testSponsorKey
+	})
+	service.client = client
+	return service
+}
+
+func testAccount(t *testing.T, privateKey string) *aptos.Account {
+	t.Helper()
+	account, err := getAccountFromPrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("getAccountFromPrivateKey: %v", err)
+	}
+	return account
+}
+
+// cosign signs a sponsored transaction as the sender's wallet would, returning the BCS hex of
+// the authenticator
+func cosign(t *testing.T, signer *aptos.Account, rawTransaction string) string {
+	t.Helper()
+	rawBytes, err := hex.DecodeString(strings.TrimPrefix(rawTransaction, "0x"))
+	if err != nil {
+		t.Fatalf("raw transaction is not hex: %v", err)
+	}
+	rawTxn := &aptos.RawTransactionWithData{}
+	rawTxn.UnmarshalTypeScriptBCS(bcs.NewDeserializer(rawBytes))
+	authenticator, err := rawTxn.Sign(signer)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	encoded, err := bcs.Serialize(authenticator)
+	if err != nil {
+		t.Fatalf("encode authenticator: %v", err)
+	}
+	return "0x" + hex.EncodeToString(encoded)
+}
+
+func TestIsMintAuthorityIsTheModuleAccount(t *testing.T) {
+	minter := testAccount(t, testRecipientKey)
+	service := newTestService(t, newFakeNode(t), func(cfg *ServiceConfig) {
+		cfg.DataXModuleAddr = minter.Address.String()
+	})
+
+	if ok, err := service.IsMintAuthority(testRecipientKey); err != nil || !ok {
+		t.Errorf("module account = %v, %v, want true", ok, err)
+	}
+	if ok, err := service.IsMintAuthority(testOtherKey); err != nil || ok {
+		t.Errorf("other account = %v, %v, want false", ok, err)
+	}
+	if _, err := service.IsMintAuthority("not-a-key"); err == nil {
+		t.Error("malformed key was accepted")
+	}
+}
+
+func TestSponsoredRegistrationIsSignedByTheSponsorLast(t *testing.T) {
+	node := newFakeNode(t)
+	client := &fakeAptosClient{}
+	service := newSponsoringService(t, node, client)
+	recipient := testAccount(t, testRecipientKey)
+	sponsor := testAccount(t, testSponsorKey)
+
+	// The recipient has no account yet: the chain answers 404 and the transaction starts it at 0
+	registration, err := service.BuildSponsoredRegistration(recipient.Address.String())
+	if err != nil {
+		t.Fatalf("BuildSponsoredRegistration: %v", err)
+	}
+	if registration.Sender != recipient.Address.String() || registration.FeePayer != sponsor.Address.String() {
+		t.Fatalf("registration sent by %s paid by %s, want %s and %s",
+			registration.Sender, registration.FeePayer, recipient.Address.String(), sponsor.Address.String())
+	}
+	if len(client.signed) != 0 {
+		t.Fatal("a transaction was submitted before the recipient signed")
+	}
+
+	hash, err := service.SubmitSponsoredRegistration(recipient.Address.String(), registration.RawTransaction,
+		cosign(t, recipient, registration.RawTransaction))
+	if err != nil {
+		t.Fatalf("SubmitSponsoredRegistration: %v", err)
+	}
+	if hash == "" || len(client.signed) != 1 {
+		t.Fatalf("hash %q after %d submissions, want one", hash, len(client.signed))
+	}
+	signed := client.signed[0]
+	if signed.Transaction.SequenceNumber != 0 || signed.Transaction.Sender != recipient.Address {
+		t.Errorf("submitted sequence number %d from %s, want 0 from the recipient",
+			signed.Transaction.SequenceNumber, signed.Transaction.Sender.String())
+	}
+	// SignedTransaction.Verify only knows single-signer messages; a fee payer transaction signs
+	// the transaction together with its fee payer
+	auth, ok := signed.Authenticator.Auth.(*aptos.FeePayerTransactionAuthenticator)
+	if !ok {
+		t.Fatalf("submitted with a %T, want a fee payer authenticator", signed.Authenticator.Auth)
+	}
+	message, err := (&aptos.RawTransactionWithData{
+		Variant: aptos.MultiAgentWithFeePayerRawTransactionWithDataVariant,
+		Inner: &aptos.MultiAgentWithFeePayerRawTransactionWithData{
+			RawTxn: signed.Transaction, SecondarySigners: []aptos.AccountAddress{}, FeePayer: auth.FeePayer,
+		},
+	}).SigningMessage()
+	if err != nil {
+		t.Fatalf("SigningMessage: %v", err)
+	}
+	if *auth.FeePayer != sponsor.Address || !auth.FeePayerAuthenticator.Verify(message) || !auth.Sender.Verify(message) {
+		t.Error("submitted transaction isn't signed by both the recipient and the sponsor")
+	}
+	if auth.FeePayerAuthenticator.PubKey().ToHex() != sponsor.PubKey().ToHex() {
+		t.Error("fee payer signature isn't the sponsor's")
+	}
+
+	// Each transaction is only sponsored once
+	_, err = service.SubmitSponsoredRegistration(recipient.Address.String(), registration.RawTransaction,
+		cosign(t, recipient, registration.RawTransaction))
+	if !errors.Is(err, ErrSponsoredTransactionUnknown) {
+		t.Errorf("resubmission = %v, want ErrSponsoredTransactionUnknown", err)
+	}
+}
+
+func TestSponsoredRegistrationRefusesOtherSigners(t *testing.T) {
+	recipient := testAccount(t, testRecipientKey)
+	rotated := testAccount(t, testOtherKey)
+	node := newFakeNode(t)
+	client := &fakeAptosClient{}
+	service := newSponsoringService(t, node, client)
+
+	// An account whose key was rotated is authenticated by the new key, not its address
+	node.handleJSON("/v1/accounts/"+recipient.Address.String(), map[string]string{
+		"sequence_number":    "3",
+		"authentication_key": "0x" + hex.EncodeToString(rotated.AuthKey()[:]),
+	})
+
+	cases := []struct {
+		name   string
+		signer *aptos.Account
+		want   error
+	}{
+		{"address's original key", recipient, ErrInvalidSignature},
+		{"sponsor", testAccount(t, testSponsorKey), ErrInvalidSignature},
+		{"rotated key", rotated, nil},
+	}
+	for _, tc := range cases {
+		registration, err := service.BuildSponsoredRegistration(recipient.Address.String())
+		if err != nil {
+			t.Fatalf("BuildSponsoredRegistration: %v", err)
+		}
+		_, err = service.SubmitSponsoredRegistration(recipient.Address.String(), registration.RawTransaction,
+			cosign(t, tc.signer, registration.RawTransaction))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if len(client.signed) != 1 {
+		t.Errorf("%d transactions submitted, want only the rotated key's", len(client.signed))
+	}
+}
+
+func TestSponsoredRegistrationOnlyTakesIssuedTransactions(t *testing.T) {
+	node := newFakeNode(t)
+	service := newSponsoringService(t, node, &fakeAptosClient{})
+	recipient := testAccount(t, testRecipientKey)
+	other := testAccount(t, testOtherKey)
+
+	registration, err := service.BuildSponsoredRegistration(other.Address.String())
+	if err != nil {
+		t.Fatalf("BuildSponsoredRegistration: %v", err)
+	}
+	// Issued to another sender
+	_, err = service.SubmitSponsoredRegistration(recipient.Address.String(), registration.RawTransaction,
+		cosign(t, recipient, registration.RawTransaction))
+	if !errors.Is(err, ErrSponsoredTransactionUnknown) {
+		t.Errorf("transaction of another sender = %v, want ErrSponsoredTransactionUnknown", err)
+	}
+	// Never issued
+	_, err = service.SubmitSponsoredRegistration(recipient.Address.String(), "0x00", "0x00")
+	if !errors.Is(err, ErrSponsoredTransactionUnknown) {
+		t.Errorf("unissued transaction = %v, want ErrSponsoredTransactionUnknown", err)
+	}
+
+	unsponsored := newTestService(t, node, nil)
+	if _, err := unsponsored.BuildSponsoredRegistration(recipient.Address.String()); !errors.Is(err, ErrSponsorNotConfigured) {
+		t.Errorf("without a sponsor = %v, want ErrSponsorNotConfigured", err)
+	}
+}
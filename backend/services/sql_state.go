@@ -0,0 +1,47 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/datax/backend/internal/db"
+)
+
+// sqlStateStore keeps state documents in the DATABASE_URL database instead of the storage
+// bucket, so discovery progress, known users and webhooks survive without a state-capable
+// storage backend
+type sqlStateStore struct {
+	db *db.DB
+}
+
+// NewSQLStateStore returns a StateStore backed by the database
+func NewSQLStateStore(database *db.DB) StateStore {
+	return &sqlStateStore{db: database}
+}
+
+func (s *sqlStateStore) LoadState(key string, v interface{}) (string, error) {
+	value, etag, err := s.db.LoadDocument(key)
+	if errors.Is(err, db.ErrNotFound) {
+		return "", ErrStateNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(value, v); err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return etag, nil
+}
+
+func (s *sqlStateStore) SaveState(key string, v interface{}, etag string) (string, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	newETag, err := s.db.SaveDocument(key, value, etag)
+	if errors.Is(err, db.ErrConflict) {
+		return "", ErrStateConflict
+	}
+	return newETag, err
+}
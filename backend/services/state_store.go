@@ -0,0 +1,29 @@
+package services
+
+import "errors"
+
+// StateStore persists small JSON documents the backend needs across restarts,
+// such as user discovery checkpoints
+type StateStore interface {
+	// LoadState decodes the document stored at key into v and returns its ETag
+	// Returns ErrStateNotFound when nothing has been stored at key yet
+	LoadState(key string, v interface{}) (string, error)
+	// SaveState stores v as JSON at key and returns the new ETag
+	// The write is conditional: with an etag it only succeeds if the stored document
+	// still has that ETag, and with an empty etag only if no document exists yet.
+	// Otherwise ErrStateConflict is returned
+	SaveState(key string, v interface{}, etag string) (string, error)
+}
+
+var (
+	// ErrStateNotFound is returned by LoadState when the key has no document
+	ErrStateNotFound = errors.New("state not found")
+	// ErrStateConflict is returned by SaveState when the document changed since it was loaded
+	ErrStateConflict = errors.New("state was modified concurrently")
+)
+
+// Keys of the documents kept in the state store
+const (
+	stateKeyDiscoveryCheckpoint = "system/discovery-checkpoint.json"
+	stateKeyKnownUsers          = "system/known-users.json"
+)
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+// StorageService stores dataset CSV blobs and the objects kept alongside them: statistics
+// sidecars and the per-owner manifest mapping data hashes to blobs
+type StorageService interface {
+	// CSV blobs
+	StoreCSV(accountAddress string, data [][]string) (string, error)
+	StoreCSVStream(accountAddress string, dataHash string, r io.Reader) (string, error) // Stores CSV bytes read from r without buffering the whole file where the backend allows
+	RetrieveCSV(accountAddress string, blobName string) ([][]string, error)
+	PreviewCSV(accountAddress string, blobName string, limit int) ([][]string, error)   // Header plus up to limit+1 rows, reading as little of the blob as the backend allows
+	StoreCSVStats(accountAddress string, blobName string, stats *models.CSVStats) error // Stored next to the blob as {blob}.stats.json
+	RetrieveCSVStats(accountAddress string, blobName string) (*models.CSVStats, error)
+	SetBlobMetadata(accountAddress string, blobName string, metadata models.BlobMetadata) error // Recorded on the blob's manifest entries, and on the object itself where the backend allows
+
+	// Listing, lookup and removal
+	ListBlobs(accountAddress string) ([]models.BlobInfo, error)
+	FindBlobByDataHash(accountAddress string, dataHash string) (string, error) // Errors wrap ErrBlobNotFound when nothing matches
+	DeleteBlob(accountAddress string, blobName string) error                   // Removes the blob, its sidecars and any manifest entries pointing at it
+
+	// Manifest
+	RetrieveManifest(accountAddress string) (models.BlobManifest, error) // The owner's data hash -> blob mapping; empty when none has been written
+	UpdateManifest(accountAddress string, dataHash string, entry models.BlobManifestEntry) error
+
+	// Ping checks the backend is reachable and the configured bucket or directory is usable
+	Ping(ctx context.Context) error
+}
+
+var (
+	_ StorageService = (*SupabaseServiceImpl)(nil)
+	_ StorageService = (*ShelbyServiceImpl)(nil)
+	_ StorageService = (*LocalStorageService)(nil)
+	_ StorageService = (*IPFSStorageServiceImpl)(nil)
+)
+
+// ErrBlobNotFound is returned when a data hash can't be resolved to exactly one stored blob
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobBelongsTo reports whether a blob name resolved for an owner stays in the owner's
+// storage. A name with a path must sit under {owner}/ without climbing out of it; bare
+// names (Shelby blobs, IPFS CIDs, file names the backend prefixes itself) are the owner's
+func BlobBelongsTo(owner string, blobName string) bool {
+	if owner == "" || blobName == "" {
+		return false
+	}
+	if !strings.Contains(blobName, "/") {
+		return true
+	}
+	return path.Clean(blobName) == blobName && strings.HasPrefix(strings.ToLower(blobName), strings.ToLower(owner)+"/")
+}
+
+// EncryptedCSVStorage is implemented by backends that can hold encrypted CSVs: the
+// ciphertext as a .csv.enc blob with its encryption metadata in a .meta companion
+type EncryptedCSVStorage interface {
+	StoreEncryptedCSV(accountAddress string, ciphertext []byte, metadata []byte) (string, error)
+	RetrieveEncryptedCSV(accountAddress string, blobName string) (ciphertext []byte, metadata []byte, err error)
+	RetrieveEncryptionMetadata(accountAddress string, blobName string) ([]byte, error) // The .meta companion alone
+}
+
+// EncryptedStreamStorage is implemented by backends that can store ciphertext as it is
+// sealed, without holding it in memory. metadata is called once ciphertext is drained, since
+// the .meta records the plaintext size
+type EncryptedStreamStorage interface {
+	StoreEncryptedCSVStream(accountAddress string, ciphertext io.Reader, metadata func() ([]byte, error)) (string, error)
+}
+
+var (
+	_ EncryptedCSVStorage    = (*ShelbyServiceImpl)(nil)
+	_ EncryptedCSVStorage    = (*SupabaseServiceImpl)(nil)
+	_ EncryptedCSVStorage    = (*LocalStorageService)(nil)
+	_ EncryptedStreamStorage = (*SupabaseServiceImpl)(nil)
+	_ EncryptedStreamStorage = (*LocalStorageService)(nil)
+)
+
+// csvStatsSuffix is appended to a blob name to locate its statistics object
+const csvStatsSuffix = ".stats.json"
+
+// encryptedBlobSuffix marks blobs holding encrypted CSV data
+const encryptedBlobSuffix = ".csv.enc"
+
+// encryptionMetaSuffix is appended to an encrypted blob's name to locate its encryption metadata
+const encryptionMetaSuffix = ".meta"
+
+// isDatasetBlobKey reports whether an object key names a dataset blob, plain (.csv) or
+// encrypted (.csv.enc), rather than a sidecar or the manifest
+func isDatasetBlobKey(key string) bool {
+	return strings.HasSuffix(key, ".csv") || strings.HasSuffix(key, encryptedBlobSuffix)
+}
+
+// Storage backends selectable with STORAGE_BACKEND
+const (
+	StorageBackendSupabase = "supabase"
+	StorageBackendShelby   = "shelby"
+	StorageBackendLocal    = "local"
+	StorageBackendIPFS     = "ipfs"
+)
+
+// NewStorageService creates the storage backend selected by STORAGE_BACKEND
+func NewStorageService() (StorageService, error) {
+	cfg := config.AppConfig
+	backend := strings.ToLower(strings.TrimSpace(cfg.StorageBackend))
+
+	// config.Validate has checked the selected backend's settings are complete
+	switch backend {
+	case StorageBackendSupabase:
+		return NewSupabaseService(), nil
+
+	case StorageBackendShelby:
+		return NewShelbyService(), nil
+
+	case StorageBackendLocal:
+		if err := os.MkdirAll(cfg.LocalStorageDir, 0o755); err != nil {
+			return nil, fmt.Errorf("LOCAL_STORAGE_DIR %s is not usable: %w", cfg.LocalStorageDir, err)
+		}
+		return NewLocalStorageService(cfg.LocalStorageDir), nil
+
+	case StorageBackendIPFS:
+		return NewIPFSStorageService(), nil
+	}
+
+	return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (expected %s, %s, %s or %s)", cfg.StorageBackend, StorageBackendSupabase, StorageBackendShelby, StorageBackendLocal, StorageBackendIPFS)
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/datax/backend/config"
+)
+
+// storageRetryBaseDelay is the wait before the first retry; it doubles on every attempt
+const storageRetryBaseDelay = 250 * time.Millisecond
+
+// withoutSDKRetries turns off the SDK's own retries for calls wrapped in withStorageRetry, so
+// the two don't multiply and STORAGE_RETRY_ATTEMPTS is the real number of tries
+func withoutSDKRetries(o *s3.Options) {
+	o.Retryer = aws.NopRetryer{}
+}
+
+// withStorageRetry runs op until it succeeds, fails with an error that retrying can't fix,
+// or STORAGE_RETRY_ATTEMPTS / STORAGE_RETRY_BUDGET run out. op must be safe to repeat:
+// request bodies have to be recreated on every call
+func withStorageRetry(ctx context.Context, label string, op func(ctx context.Context) error) error {
+	attempts := config.AppConfig.StorageRetryAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	deadline := time.Now().Add(time.Duration(config.AppConfig.StorageRetryBudget) * time.Second)
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			backoff := storageRetryBaseDelay << uint(attempt-1)
+			if time.Now().Add(backoff).After(deadline) {
+				fmt.Printf("DEBUG: %s retry budget exhausted after %d attempts\n", label, attempt)
+				break
+			}
+			fmt.Printf("DEBUG: Retrying %s (attempt %d/%d) after %v: %v\n", label, attempt+1, attempts, backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+		}
+
+		err = op(ctx)
+		if err == nil || !isRetryableStorageError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// isRetryableStorageError reports whether a storage call may succeed if repeated: 5xx and
+// throttling responses and network errors are retried; other 4xx responses (403, 404,
+// failed preconditions) and cancellations are not
+func isRetryableStorageError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		status := respErr.HTTPStatusCode()
+		return status >= 500 || status == 429
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestTimeout", "InternalError", "ServiceUnavailable":
+			return true
+		}
+		return false
+	}
+
+	// No response at all: connection reset, DNS failure, truncated body
+	return true
+}
+
+// getObjectBytes downloads an object whole, retrying the request and the body read together
+// The returned output's Body has already been consumed and closed
+func (s *SupabaseServiceImpl) getObjectBytes(ctx context.Context, input *s3.GetObjectInput) ([]byte, *s3.GetObjectOutput, error) {
+	var body []byte
+	var output *s3.GetObjectOutput
+	err := withStorageRetry(ctx, "GetObject "+aws.ToString(input.Key), func(ctx context.Context) error {
+		result, err := s.s3Client.GetObject(ctx, input, withoutSDKRetries)
+		if err != nil {
+			return err
+		}
+		defer result.Body.Close()
+
+		body, err = io.ReadAll(result.Body)
+		output = result
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, output, nil
+}
+
+// putObjectBytes uploads body with the given input, sending a fresh body reader on every attempt
+func (s *SupabaseServiceImpl) putObjectBytes(ctx context.Context, input *s3.PutObjectInput, body []byte) (*s3.PutObjectOutput, error) {
+	var output *s3.PutObjectOutput
+	err := withStorageRetry(ctx, "PutObject "+aws.ToString(input.Key), func(ctx context.Context) error {
+		attempt := *input
+		attempt.Body = bytes.NewReader(body)
+		var err error
+		output, err = s.s3Client.PutObject(ctx, &attempt, withoutSDKRetries)
+		return err
+	})
+	return output, err
+}
+
+// nextListPage fetches the paginator's next page; a failed request leaves the paginator
+// where it was, so the same page is requested again
+func nextListPage(ctx context.Context, paginator *s3.ListObjectsV2Paginator) (*s3.ListObjectsV2Output, error) {
+	var page *s3.ListObjectsV2Output
+	err := withStorageRetry(ctx, "ListObjectsV2", func(ctx context.Context) error {
+		var err error
+		page, err = paginator.NextPage(ctx, withoutSDKRetries)
+		return err
+	})
+	return page, err
+}
+
+// listAllObjects follows continuation tokens through a listing, page by page with retries,
+// and returns every object in it. It stops, with a warning, once STORAGE_LIST_MAX_KEYS objects
+// have been read
+func (s *SupabaseServiceImpl) listAllObjects(ctx context.Context, input *s3.ListObjectsV2Input) ([]s3Types.Object, error) {
+	maxKeys := max(config.AppConfig.StorageListMaxKeys, 1)
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, input)
+	var objects []s3Types.Object
+	for paginator.HasMorePages() {
+		if len(objects) >= maxKeys {
+			fmt.Printf("WARNING: Listing of %s stopped at STORAGE_LIST_MAX_KEYS (%d) keys\n", aws.ToString(input.Prefix), maxKeys)
+			break
+		}
+		page, err := nextListPage(ctx, paginator)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, page.Contents...)
+	}
+	return objects, nil
+}
@@ -3,23 +3,30 @@ package services
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
 )
 
 type SupabaseServiceImpl struct {
 	s3Client   *s3.Client
 	bucketName string
+	manifestMu sync.Mutex // Serializes manifest read-modify-write
 }
 
 func NewSupabaseService() StorageService {
@@ -83,6 +90,26 @@ func NewSupabaseService() StorageService {
 	}
 }
 
+// Ping checks the bucket exists and the credentials can reach it
+func (s *SupabaseServiceImpl) Ping(ctx context.Context) error {
+	_, err := s.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucketName),
+	})
+	if err == nil {
+		return nil
+	}
+
+	var notFound *s3Types.NotFound
+	if errors.As(err, &notFound) {
+		return fmt.Errorf("bucket %q does not exist (check SUPABASE_BUCKET)", s.bucketName)
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "Forbidden" || apiErr.ErrorCode() == "AccessDenied") {
+		return fmt.Errorf("access to bucket %q was denied (check the Supabase S3 credentials): %w", s.bucketName, err)
+	}
+	return fmt.Errorf("bucket %q is unreachable at %s: %w", s.bucketName, config.AppConfig.SupabaseS3URL, err)
+}
+
 // extractProjectRef extracts the project reference from Supabase S3 URL
 // URL format: https://project_ref.storage.supabase.co/storage/v1/s3
 func extractProjectRef(url string) string {
@@ -135,46 +162,18 @@ func (s *SupabaseServiceImpl) StoreCSV(accountAddress string, data [][]string) (
 		return "", fmt.Errorf("failed to flush CSV: %w", err)
 	}
 
-	csvBytes := buf.Bytes()
-
-	// Generate a unique blob name based on account and timestamp
-	// Format: {account}/{timestamp}_{hash}.csv
-	timestamp := time.Now().Unix()
-	hashLen := 16
-	if len(csvBytes) < hashLen {
-		hashLen = len(csvBytes)
-	}
-	hash := fmt.Sprintf("%x", csvBytes[:hashLen])
-	blobName := fmt.Sprintf("%s/%d_%s.csv", accountAddress, timestamp, hash)
-
-	// Upload to S3 using PutObject
-	ctx := context.Background()
-	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucketName),
-		Key:         aws.String(blobName),
-		Body:        bytes.NewReader(csvBytes),
-		ContentType: aws.String("text/csv"),
-	})
-
-	if err != nil {
-		fmt.Printf("ERROR: Supabase S3 upload failed: %v\n", err)
-		return "", fmt.Errorf("failed to upload to Supabase S3: %w", err)
-	}
-
-	fmt.Printf("DEBUG: Successfully stored CSV in Supabase Storage with path: %s\n", blobName)
-	return blobName, nil
+	return s.StoreCSVStream(accountAddress, "", &buf)
 }
 
-// ListCSVFiles lists all CSV files for an account (used for finding files when mapping is lost)
-func (s *SupabaseServiceImpl) ListCSVFiles(accountAddress string) ([]string, error) {
+// ListBlobs lists the dataset objects stored for an account: plain (.csv) and encrypted
+// (.csv.enc) blobs, without sidecars or the manifest
+func (s *SupabaseServiceImpl) ListBlobs(accountAddress string) ([]models.BlobInfo, error) {
 	ctx := context.Background()
-
-	// List objects with prefix: {accountAddress}/
 	prefix := accountAddress + "/"
 
-	fmt.Printf("DEBUG: Listing CSV files for account %s with prefix: %s\n", accountAddress, prefix)
+	fmt.Printf("DEBUG: Listing blobs for account %s with prefix: %s\n", accountAddress, prefix)
 
-	result, err := s.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+	objects, err := s.listAllObjects(ctx, &s3.ListObjectsV2Input{
 		Bucket: aws.String(s.bucketName),
 		Prefix: aws.String(prefix),
 	})
@@ -183,70 +182,55 @@ func (s *SupabaseServiceImpl) ListCSVFiles(accountAddress string) ([]string, err
 		return nil, fmt.Errorf("failed to list objects: %w", err)
 	}
 
-	var keys []string
-	for _, obj := range result.Contents {
-		if strings.HasSuffix(*obj.Key, ".csv") {
-			keys = append(keys, *obj.Key)
+	// Listings don't carry S3 user metadata, so it comes from the manifest instead
+	metadata := map[string]*models.BlobMetadata{}
+	if manifest, err := s.RetrieveManifest(accountAddress); err == nil {
+		metadata = manifestBlobMetadata(manifest)
+	} else {
+		fmt.Printf("WARNING: Listing %s without blob metadata: %v\n", accountAddress, err)
+	}
+
+	blobs := []models.BlobInfo{}
+	for _, obj := range objects {
+		if obj.Key == nil || !isDatasetBlobKey(*obj.Key) {
+			continue
+		}
+		blob := models.BlobInfo{
+			Name:      *obj.Key,
+			Size:      aws.ToInt64(obj.Size),
+			Encrypted: strings.HasSuffix(*obj.Key, encryptedBlobSuffix),
+			Metadata:  metadata[*obj.Key],
 		}
+		if obj.LastModified != nil {
+			blob.LastModified = obj.LastModified.Unix()
+		}
+		blobs = append(blobs, blob)
 	}
 
-	fmt.Printf("DEBUG: Found %d CSV files for account %s\n", len(keys), accountAddress)
-	return keys, nil
+	fmt.Printf("DEBUG: Found %d blobs for account %s\n", len(blobs), accountAddress)
+	return blobs, nil
 }
 
 // RetrieveCSV retrieves CSV data from Supabase Storage (S3-compatible) using blob name/path
 func (s *SupabaseServiceImpl) RetrieveCSV(accountAddress string, blobName string) ([][]string, error) {
+	if strings.HasSuffix(blobName, encryptedBlobSuffix) {
+		return retrieveSealedCSV(s, accountAddress, blobName)
+	}
 	ctx := context.Background()
 
-	// The blobName might be in different formats:
-	// 1. Full path: {account}/{timestamp}_{hash}.csv
-	// 2. Just filename: {timestamp}_{hash}.csv (missing account prefix)
-	// 3. Just filename without account: {timestamp}_{hash}.csv
-	key := blobName
-
-	// If blobName doesn't contain "/", it might be missing the account prefix
-	if !strings.Contains(blobName, "/") {
-		// Try with account prefix first
-		key = fmt.Sprintf("%s/%s", accountAddress, blobName)
-		fmt.Printf("DEBUG: Blob name missing account prefix, trying with prefix: %s\n", key)
-	} else {
-		// Check if the prefix matches the account address
-		parts := strings.Split(blobName, "/")
-		if len(parts) > 0 && parts[0] != accountAddress {
-			// The prefix doesn't match, but try it anyway (might be correct)
-			fmt.Printf("DEBUG: Blob name prefix (%s) doesn't match account (%s), using as-is\n", parts[0], accountAddress)
-		}
-	}
+	// Blob names come as {account}/{hash}.csv or as a bare file name missing the prefix
+	key := blobKey(accountAddress, blobName)
 
 	fmt.Printf("DEBUG: Retrieving CSV from Supabase S3: bucket=%s, key=%s\n", s.bucketName, key)
 
 	// Download from S3 using GetObject
-	// Try with the constructed key first
-	result, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+	bodyBytes, _, err := s.getObjectBytes(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		// If failed and we added the account prefix, try without it
-		if !strings.Contains(blobName, "/") && strings.Contains(key, "/") {
-			// Try the original blobName without prefix
-			fmt.Printf("DEBUG: Failed with account prefix, trying without prefix: %s\n", blobName)
-			result, err = s.s3Client.GetObject(ctx, &s3.GetObjectInput{
-				Bucket: aws.String(s.bucketName),
-				Key:    aws.String(blobName),
-			})
-		}
-		if err != nil {
-			fmt.Printf("ERROR: Supabase S3 download failed: %v\n", err)
-			return nil, fmt.Errorf("failed to download from Supabase S3: %w", err)
-		}
-	}
-	defer result.Body.Close()
-
-	// Read CSV data
-	bodyBytes, err := io.ReadAll(result.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read S3 data: %w", err)
+		fmt.Printf("ERROR: Supabase S3 download failed: %v\n", err)
+		return nil, fmt.Errorf("failed to download from Supabase S3: %w", err)
 	}
 
 	fmt.Printf("DEBUG: Supabase download response: Body length=%d\n", len(bodyBytes))
@@ -263,84 +247,68 @@ func (s *SupabaseServiceImpl) RetrieveCSV(accountAddress string, blobName string
 }
 
 // FindBlobByPattern tries to find a blob by listing objects with a prefix pattern
-// This is a fallback when the mapping is missing
+// This is a fallback when the mapping is missing. A pattern that is a data hash recorded in
+// the owner's manifest resolves to that exact blob before any listing. Plain (.csv) and
+// encrypted (.csv.enc) blobs are considered; sidecars never are
 func (s *SupabaseServiceImpl) FindBlobByPattern(accountAddress string, pattern string) (string, error) {
 	ctx := context.Background()
 
+	if dataHashKey(pattern) != "" {
+		if manifest, err := s.RetrieveManifest(accountAddress); err != nil {
+			fmt.Printf("DEBUG: Could not read manifest for %s, falling back to listing: %v\n", accountAddress, err)
+		} else if entry, ok := manifest[NormalizeDataHash(pattern)]; ok && !entry.Pending {
+			fmt.Printf("DEBUG: Found blob in manifest: %s\n", entry.BlobName)
+			return entry.BlobName, nil
+		}
+	}
+
 	// List objects with prefix: {account}/
 	prefix := accountAddress + "/"
 
 	fmt.Printf("DEBUG: Searching for blob with prefix: %s, pattern: %s\n", prefix, pattern)
 
-	listInput := &s3.ListObjectsV2Input{
-		Bucket:  aws.String(s.bucketName),
-		Prefix:  aws.String(prefix),
-		MaxKeys: aws.Int32(100),
-	}
-
-	result, err := s.s3Client.ListObjectsV2(ctx, listInput)
+	// Every page is read so the newest object is picked from the whole listing
+	objects, err := s.listAllObjects(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to list objects: %w", err)
 	}
 
-	fmt.Printf("DEBUG: Found %d objects with prefix %s\n", len(result.Contents), prefix)
+	fmt.Printf("DEBUG: Found %d objects with prefix %s\n", len(objects), prefix)
 
-	// If no objects found with account prefix, try listing all CSV files in bucket
+	// If no objects found with account prefix, try listing all dataset blobs in bucket
 	// (in case files are stored without account prefix, e.g., just {timestamp}_{hash}.csv)
-	if len(result.Contents) == 0 {
+	if len(objects) == 0 {
 		fmt.Printf("DEBUG: No objects found with prefix %s, trying to list all CSV files in bucket\n", prefix)
-		allObjectsInput := &s3.ListObjectsV2Input{
-			Bucket:  aws.String(s.bucketName),
-			MaxKeys: aws.Int32(100),
-		}
-		allResult, err := s.s3Client.ListObjectsV2(ctx, allObjectsInput)
-		if err == nil && len(allResult.Contents) > 0 {
-			// Filter for CSV files
-			var csvFiles []s3Types.Object
-			for _, obj := range allResult.Contents {
-				if obj.Key != nil && strings.HasSuffix(*obj.Key, ".csv") {
-					csvFiles = append(csvFiles, obj)
-				}
-			}
-			if len(csvFiles) > 0 {
-				// Return the most recent CSV file
-				var latestObj *s3Types.Object
-				for i := range csvFiles {
-					obj := &csvFiles[i]
-					if latestObj == nil || (obj.LastModified != nil && latestObj.LastModified != nil && obj.LastModified.After(*latestObj.LastModified)) {
-						latestObj = obj
-					}
-				}
-				if latestObj != nil && latestObj.Key != nil {
-					fmt.Printf("DEBUG: Found CSV file without account prefix: %s\n", *latestObj.Key)
-					return *latestObj.Key, nil
-				}
+		allObjects, err := s.listAllObjects(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(s.bucketName),
+		})
+		if err == nil {
+			// Return the most recent dataset blob
+			if latestObj := newestDatasetObject(allObjects); latestObj != nil {
+				fmt.Printf("DEBUG: Found CSV file without account prefix: %s\n", *latestObj.Key)
+				return *latestObj.Key, nil
 			}
 		}
 		return "", fmt.Errorf("no objects found with prefix: %s", prefix)
 	}
 
-	// If pattern is empty, return the most recent CSV object (by LastModified)
+	// If pattern is empty, return the most recent dataset blob (by LastModified)
 	if pattern == "" {
-		var latestObj *s3Types.Object
-		for _, obj := range result.Contents {
-			if obj.Key != nil && strings.HasSuffix(*obj.Key, ".csv") {
-				if latestObj == nil || (obj.LastModified != nil && latestObj.LastModified != nil && obj.LastModified.After(*latestObj.LastModified)) {
-					latestObj = &obj
-				}
-			}
-		}
-		if latestObj != nil && latestObj.Key != nil {
+		if latestObj := newestDatasetObject(objects); latestObj != nil {
 			fmt.Printf("DEBUG: Returning most recent CSV object: %s\n", *latestObj.Key)
 			return *latestObj.Key, nil
 		}
 	}
 
 	// Try to find matching object by pattern
-	// The blob name format is: {account}/{timestamp}_{hash}.csv
+	// The blob name format is: {account}/{timestamp}_{hash}.csv, {account}/{hash}.csv or {account}/{hash}.csv.enc
 	// We'll match by the hash pattern in the filename
-	for _, obj := range result.Contents {
-		if obj.Key != nil {
+	for _, obj := range objects {
+		// Skip sidecar objects such as {blob}.stats.json and {blob}.meta
+		if obj.Key != nil && isDatasetBlobKey(*obj.Key) {
 			key := *obj.Key
 			fmt.Printf("DEBUG: Checking object: %s\n", key)
 			// Check if key contains the pattern (hash part of filename)
@@ -361,22 +329,31 @@ func (s *SupabaseServiceImpl) FindBlobByPattern(accountAddress string, pattern s
 	}
 
 	// If no pattern match but we have objects, return the most recent one
-	if len(result.Contents) > 0 {
-		var latestObj *s3Types.Object
-		for _, obj := range result.Contents {
-			if latestObj == nil || (obj.LastModified != nil && latestObj.LastModified != nil && obj.LastModified.After(*latestObj.LastModified)) {
-				latestObj = &obj
-			}
-		}
-		if latestObj != nil && latestObj.Key != nil {
-			fmt.Printf("DEBUG: No pattern match, returning most recent object: %s\n", *latestObj.Key)
-			return *latestObj.Key, nil
-		}
+	if latestObj := newestDatasetObject(objects); latestObj != nil {
+		fmt.Printf("DEBUG: No pattern match, returning most recent object: %s\n", *latestObj.Key)
+		return *latestObj.Key, nil
 	}
 
 	return "", fmt.Errorf("no matching blob found with pattern: %s", pattern)
 }
 
+// newestDatasetObject returns the most recently modified dataset blob (.csv or .csv.enc) of a
+// listing, or nil when there is none. Objects without LastModified lose to any that have it.
+// The result points into objects, never at a loop variable
+func newestDatasetObject(objects []s3Types.Object) *s3Types.Object {
+	var newest *s3Types.Object
+	for i := range objects {
+		obj := &objects[i]
+		if obj.Key == nil || !isDatasetBlobKey(*obj.Key) {
+			continue
+		}
+		if newest == nil || (obj.LastModified != nil && (newest.LastModified == nil || obj.LastModified.After(*newest.LastModified))) {
+			newest = obj
+		}
+	}
+	return newest
+}
+
 func minInt(a, b int) int {
 	if a < b {
 		return a
@@ -421,3 +398,470 @@ func (s *SupabaseServiceImpl) GetUserRequests(requesterAddress string) ([]interf
 	fmt.Printf("DEBUG: GetUserRequests called for requester %s\n", requesterAddress)
 	return nil, fmt.Errorf("database operations not yet implemented - use Supabase REST API directly")
 }
+
+// dataHashKey normalises a data hash ("0xABCD...") to the lowercase hex used in blob names,
+// or returns "" when it isn't a hex string
+func dataHashKey(dataHash string) string {
+	key := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(dataHash, "0x"), "0X"))
+	if key == "" || len(key) > 128 {
+		return ""
+	}
+	for _, r := range key {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return ""
+		}
+	}
+	return key
+}
+
+// FindBlobByDataHash returns the CSV blob uploaded for a data hash: the content-addressed
+// {hash}.csv when it exists, else a legacy {timestamp}_{hash}.csv matched exactly. Unlike
+// FindBlobByPattern it never falls back to an unrelated object: when nothing matches it
+// returns ErrBlobNotFound. Legacy re-uploads of the same data share a hash, so among several
+// matches the newest is returned
+func (s *SupabaseServiceImpl) FindBlobByDataHash(accountAddress string, dataHash string) (string, error) {
+	hash := dataHashKey(dataHash)
+	if hash == "" {
+		return "", fmt.Errorf("%w: %q is not a hex data hash", ErrBlobNotFound, dataHash)
+	}
+
+	ctx := context.Background()
+	if len(hash) == 64 {
+		key := fmt.Sprintf("%s/%s.csv", accountAddress, hash)
+		exists, err := s.blobExists(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return key, nil
+		}
+	}
+
+	suffix := "_" + hash + ".csv"
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(accountAddress + "/"),
+	})
+
+	var match *s3Types.Object
+	for paginator.HasMorePages() {
+		page, err := nextListPage(ctx, paginator)
+		if err != nil {
+			return "", fmt.Errorf("failed to list objects: %w", err)
+		}
+		for i := range page.Contents {
+			obj := &page.Contents[i]
+			if obj.Key == nil || !strings.HasSuffix(strings.ToLower(*obj.Key), suffix) {
+				continue
+			}
+			if match == nil || (obj.LastModified != nil && match.LastModified != nil && obj.LastModified.After(*match.LastModified)) {
+				match = obj
+			}
+		}
+	}
+
+	if match == nil {
+		return "", fmt.Errorf("%w: no blob for data hash %s under %s/", ErrBlobNotFound, dataHash, accountAddress)
+	}
+	fmt.Printf("DEBUG: Resolved data hash %s to blob %s\n", dataHash, *match.Key)
+	return *match.Key, nil
+}
+
+// DeleteBlob deletes a CSV object and its statistics sidecar from Supabase Storage and drops
+// it from the owner's manifest. Only keys under {account}/ can be deleted
+func (s *SupabaseServiceImpl) DeleteBlob(accountAddress string, blobName string) error {
+	key := blobKey(accountAddress, blobName)
+	if !strings.HasPrefix(key, accountAddress+"/") || strings.Contains(key, "..") {
+		return fmt.Errorf("blob %s does not belong to %s", blobName, accountAddress)
+	}
+
+	ctx := context.Background()
+	_, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrBlobNotFound, key, err)
+	}
+
+	// S3 deletes succeed for missing keys, so an absent sidecar needs no special case
+	for _, objectKey := range []string{key, key + csvStatsSuffix, key + encryptionMetaSuffix} {
+		_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(objectKey),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete %s from Supabase S3: %w", objectKey, err)
+		}
+	}
+	fmt.Printf("DEBUG: Deleted %s and its sidecars from Supabase Storage\n", key)
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return fmt.Errorf("blob deleted but manifest could not be read: %w", err)
+	}
+	if removeBlobFromManifest(manifest, key) == 0 {
+		return nil
+	}
+	return s.storeManifest(accountAddress, manifest)
+}
+
+// StoreCSVStream streams CSV bytes to Supabase Storage and returns the blob name/path
+// Blobs are content addressed (see storeContentAddressed): re-uploading identical data returns
+// the existing blob instead of storing another copy. dataHash, when given, is recorded in the
+// owner's manifest
+func (s *SupabaseServiceImpl) StoreCSVStream(accountAddress string, dataHash string, r io.Reader) (string, error) {
+	blobName, total, deduplicated, err := s.storeContentAddressed(context.Background(), accountAddress, r, "", "text/csv")
+	if err != nil {
+		fmt.Printf("ERROR: Supabase S3 upload failed: %v\n", err)
+		return "", err
+	}
+
+	if deduplicated {
+		fmt.Printf("DEBUG: CSV already stored in Supabase Storage at %s (%d bytes), skipped upload\n", blobName, total)
+	} else {
+		fmt.Printf("DEBUG: Successfully stored CSV in Supabase Storage with path: %s (%d bytes)\n", blobName, total)
+	}
+	s.recordUpload(accountAddress, dataHash, blobName, total)
+	return blobName, nil
+}
+
+// StoreEncryptedCSV uploads ciphertext as {account}/{sha256}.csv.enc, named after the
+// ciphertext, with its encryption metadata in a .meta object next to it
+func (s *SupabaseServiceImpl) StoreEncryptedCSV(accountAddress string, ciphertext []byte, metadata []byte) (string, error) {
+	ctx := context.Background()
+	sum := sha256.Sum256(ciphertext)
+	key := contentBlobName(accountAddress, sum[:]) + ".enc"
+
+	fmt.Printf("DEBUG: Uploading encrypted CSV to Supabase S3: Key=%s, Size=%d bytes\n", key, len(ciphertext))
+	_, err := s.putObjectBytes(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String("application/octet-stream"),
+	}, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload encrypted CSV to Supabase S3: %w", err)
+	}
+
+	_, err = s.putObjectBytes(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key + encryptionMetaSuffix),
+		ContentType: aws.String("application/json"),
+	}, metadata)
+	if err != nil {
+		_, delErr := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+		})
+		if delErr != nil {
+			fmt.Printf("WARNING: Failed to remove %s after its metadata upload failed: %v\n", key, delErr)
+		}
+		return "", fmt.Errorf("failed to store encryption metadata: %w", err)
+	}
+	return key, nil
+}
+
+// StoreEncryptedCSVStream uploads ciphertext as it is sealed to {account}/{sha256}.csv.enc,
+// staging it like a large CSV upload, then stores the .meta once the stream is drained
+func (s *SupabaseServiceImpl) StoreEncryptedCSVStream(accountAddress string, ciphertext io.Reader, metadata func() ([]byte, error)) (string, error) {
+	ctx := context.Background()
+	key, size, _, err := s.storeContentAddressed(ctx, accountAddress, ciphertext, ".enc", "application/octet-stream")
+	if err != nil {
+		return "", fmt.Errorf("failed to upload encrypted CSV to Supabase S3: %w", err)
+	}
+
+	meta, err := metadata()
+	if err == nil {
+		_, err = s.putObjectBytes(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(s.bucketName),
+			Key:         aws.String(key + encryptionMetaSuffix),
+			ContentType: aws.String("application/json"),
+		}, meta)
+	}
+	if err != nil {
+		_, delErr := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+		})
+		if delErr != nil {
+			fmt.Printf("WARNING: Failed to remove %s after its metadata upload failed: %v\n", key, delErr)
+		}
+		return "", fmt.Errorf("failed to store encryption metadata: %w", err)
+	}
+	fmt.Printf("DEBUG: Streamed encrypted CSV to Supabase S3: Key=%s, Size=%d bytes\n", key, size)
+	return key, nil
+}
+
+// RetrieveEncryptedCSV downloads an encrypted blob and its encryption metadata
+// Names recorded without the .enc suffix are retried with it
+func (s *SupabaseServiceImpl) RetrieveEncryptedCSV(accountAddress string, blobName string) ([]byte, []byte, error) {
+	key := blobKey(accountAddress, blobName)
+	candidates := []string{key}
+	switch {
+	case strings.HasSuffix(key, encryptedBlobSuffix):
+	case strings.HasSuffix(key, ".csv"):
+		candidates = append(candidates, key+".enc")
+	default:
+		candidates = append(candidates, key+encryptedBlobSuffix)
+	}
+
+	ctx := context.Background()
+	for _, candidate := range candidates {
+		exists, err := s.blobExists(ctx, candidate)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !exists {
+			fmt.Printf("DEBUG: Encrypted blob %s not found in Supabase S3, trying next name\n", candidate)
+			continue
+		}
+
+		ciphertext, _, err := s.getObjectBytes(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(candidate),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to download %s from Supabase S3: %w", candidate, err)
+		}
+		metadata, _, err := s.getObjectBytes(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(candidate + encryptionMetaSuffix),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve encryption metadata for %s: %w", candidate, err)
+		}
+		return ciphertext, metadata, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrBlobNotFound, blobName)
+}
+
+// RetrieveEncryptionMetadata downloads an encrypted blob's .meta object
+func (s *SupabaseServiceImpl) RetrieveEncryptionMetadata(accountAddress string, blobName string) ([]byte, error) {
+	key := blobKey(accountAddress, blobName) + encryptionMetaSuffix
+	metadata, _, err := s.getObjectBytes(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve encryption metadata for %s: %w", blobName, err)
+	}
+	return metadata, nil
+}
+
+// StoreGranteeKey writes a grant's wrapped data key to {owner}/grants/
+func (s *SupabaseServiceImpl) StoreGranteeKey(owner string, key models.GranteeKey) error {
+	body, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wrapped key: %w", err)
+	}
+	objectKey := owner + "/" + granteeKeyObject(key.DatasetID, key.Requester)
+	_, err = s.putObjectBytes(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(objectKey),
+		ContentType: aws.String("application/json"),
+	}, body)
+	if err != nil {
+		return fmt.Errorf("failed to upload wrapped key to Supabase S3: %w", err)
+	}
+	return nil
+}
+
+// RetrieveGranteeKey reads a grant's wrapped data key
+func (s *SupabaseServiceImpl) RetrieveGranteeKey(owner string, datasetID uint64, requester string) (*models.GranteeKey, error) {
+	objectKey := owner + "/" + granteeKeyObject(datasetID, requester)
+	body, _, err := s.getObjectBytes(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		if isMissingObject(err) {
+			return nil, fmt.Errorf("%w: %s", ErrGranteeKeyNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to download wrapped key: %w", err)
+	}
+
+	var key models.GranteeKey
+	if err := json.Unmarshal(body, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse wrapped key: %w", err)
+	}
+	return &key, nil
+}
+
+// DeleteGranteeKey removes a grant's wrapped data key
+func (s *SupabaseServiceImpl) DeleteGranteeKey(owner string, datasetID uint64, requester string) error {
+	objectKey := owner + "/" + granteeKeyObject(datasetID, requester)
+	_, err := s.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from Supabase S3: %w", objectKey, err)
+	}
+	return nil
+}
+
+// StoreColumnGrant writes a grant's column restriction to {owner}/grants/
+func (s *SupabaseServiceImpl) StoreColumnGrant(owner string, grant models.ColumnGrant) error {
+	body, err := json.Marshal(grant)
+	if err != nil {
+		return fmt.Errorf("failed to marshal column grant: %w", err)
+	}
+	objectKey := owner + "/" + columnGrantObject(grant.DatasetID, grant.Requester)
+	_, err = s.putObjectBytes(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(objectKey),
+		ContentType: aws.String("application/json"),
+	}, body)
+	if err != nil {
+		return fmt.Errorf("failed to upload column grant to Supabase S3: %w", err)
+	}
+	return nil
+}
+
+// RetrieveColumnGrant reads a grant's column restriction
+func (s *SupabaseServiceImpl) RetrieveColumnGrant(owner string, datasetID uint64, requester string) (*models.ColumnGrant, error) {
+	objectKey := owner + "/" + columnGrantObject(datasetID, requester)
+	body, _, err := s.getObjectBytes(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		if isMissingObject(err) {
+			return nil, fmt.Errorf("%w: %s", ErrColumnGrantNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to download column grant: %w", err)
+	}
+
+	var grant models.ColumnGrant
+	if err := json.Unmarshal(body, &grant); err != nil {
+		return nil, fmt.Errorf("failed to parse column grant: %w", err)
+	}
+	return &grant, nil
+}
+
+// DeleteColumnGrant removes a grant's column restriction
+func (s *SupabaseServiceImpl) DeleteColumnGrant(owner string, datasetID uint64, requester string) error {
+	objectKey := owner + "/" + columnGrantObject(datasetID, requester)
+	_, err := s.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from Supabase S3: %w", objectKey, err)
+	}
+	return nil
+}
+
+// blobKey is the object key of a blob in the account's folder. A name already under
+// {account}/ is the key; anything else, including a name under another account's folder,
+// gets the prefix added so it can only ever address the account's own objects
+func blobKey(accountAddress string, blobName string) string {
+	if strings.HasPrefix(strings.ToLower(blobName), strings.ToLower(accountAddress)+"/") {
+		return blobName
+	}
+	return fmt.Sprintf("%s/%s", accountAddress, blobName)
+}
+
+// csvStatsKey is the object key of a blob's statistics, {blob}.stats.json
+func csvStatsKey(accountAddress string, blobName string) string {
+	return blobKey(accountAddress, blobName) + csvStatsSuffix
+}
+
+// StoreCSVStats stores the statistics for a blob next to it in Supabase Storage
+func (s *SupabaseServiceImpl) StoreCSVStats(accountAddress string, blobName string, stats *models.CSVStats) error {
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal CSV stats: %w", err)
+	}
+
+	key := csvStatsKey(accountAddress, blobName)
+	_, err = s.putObjectBytes(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String("application/json"),
+	}, body)
+	if err != nil {
+		return fmt.Errorf("failed to upload CSV stats to Supabase S3: %w", err)
+	}
+
+	fmt.Printf("DEBUG: Stored CSV stats in Supabase Storage with path: %s\n", key)
+	return nil
+}
+
+// SetBlobMetadata records a blob's metadata in the owner's manifest and as S3 user metadata
+// (x-amz-meta-*) on the object. S3 metadata can't be edited in place, so the object is copied
+// onto itself; the manifest is updated even when that copy fails
+func (s *SupabaseServiceImpl) SetBlobMetadata(accountAddress string, blobName string, metadata models.BlobMetadata) error {
+	key := blobKey(accountAddress, blobName)
+	ctx := context.Background()
+
+	contentType := "text/csv"
+	if strings.HasSuffix(key, encryptedBlobSuffix) {
+		contentType = "application/octet-stream"
+	}
+	_, copyErr := s.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucketName),
+		Key:               aws.String(key),
+		CopySource:        aws.String(s.bucketName + "/" + key),
+		MetadataDirective: s3Types.MetadataDirectiveReplace,
+		ContentType:       aws.String(contentType),
+		Metadata:          blobObjectMetadata(metadata),
+	})
+	if copyErr != nil {
+		fmt.Printf("WARNING: Failed to set object metadata on %s: %v\n", key, copyErr)
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	manifest, err := s.RetrieveManifest(accountAddress)
+	if err != nil {
+		return err
+	}
+	if setManifestBlobMetadata(manifest, key, metadata) > 0 {
+		if err := s.storeManifest(accountAddress, manifest); err != nil {
+			return err
+		}
+	}
+	if copyErr != nil {
+		return fmt.Errorf("failed to set object metadata on %s: %w", key, copyErr)
+	}
+	return nil
+}
+
+// blobObjectMetadata is the S3 user metadata stored for a blob's BlobMetadata
+func blobObjectMetadata(metadata models.BlobMetadata) map[string]string {
+	m := map[string]string{
+		"row-count":      strconv.Itoa(metadata.RowCount),
+		"column-count":   strconv.Itoa(metadata.ColumnCount),
+		"plaintext-size": strconv.FormatInt(metadata.PlaintextSize, 10),
+	}
+	if metadata.SchemaFingerprint != "" {
+		m["schema-fingerprint"] = metadata.SchemaFingerprint
+	}
+	if metadata.DataHash != "" {
+		m["data-hash"] = metadata.DataHash
+	}
+	return m
+}
+
+// RetrieveCSVStats retrieves the statistics stored next to a blob
+func (s *SupabaseServiceImpl) RetrieveCSVStats(accountAddress string, blobName string) (*models.CSVStats, error) {
+	key := csvStatsKey(accountAddress, blobName)
+	body, _, err := s.getObjectBytes(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download CSV stats from Supabase S3: %w", err)
+	}
+
+	var stats models.CSVStats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse CSV stats: %w", err)
+	}
+	return &stats, nil
+}
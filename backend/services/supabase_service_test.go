@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/datax/backend/models"
+)
+
+const testBucket = "datasets"
+
+// fakeS3 serves ListObjectsV2 for a path-style bucket, pageSize keys a page, and reads of
+// the objects in files with their user metadata in meta; any other object is missing.
+// Puts and copies write to files, and to meta from their x-amz-meta-* headers
+type fakeS3 struct {
+	objects  map[string]time.Time
+	files    map[string]string
+	meta     map[string]map[string]string
+	pageSize int
+	lists    int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/"+testBucket+"/")
+	if r.Method == http.MethodPut {
+		f.put(w, r, key)
+		return
+	}
+	if body, ok := f.files[key]; ok && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		for name, value := range f.meta[key] {
+			w.Header().Set("X-Amz-Meta-"+name, value)
+		}
+		fmt.Fprint(w, body)
+		return
+	}
+	if r.URL.Path != "/"+testBucket || r.URL.Query().Get("list-type") != "2" {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+		return
+	}
+	f.lists++
+
+	prefix := r.URL.Query().Get("prefix")
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	end := min(start+f.pageSize, len(keys))
+
+	var body strings.Builder
+	fmt.Fprintf(&body, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>%s</Name><Prefix>%s</Prefix><KeyCount>%d</KeyCount>`, testBucket, prefix, end-start)
+	if end < len(keys) {
+		fmt.Fprintf(&body, `<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>`, end)
+	} else {
+		body.WriteString(`<IsTruncated>false</IsTruncated>`)
+	}
+	for _, key := range keys[start:end] {
+		fmt.Fprintf(&body, `<Contents><Key>%s</Key><LastModified>%s</LastModified><Size>1</Size></Contents>`, key, f.objects[key].UTC().Format(time.RFC3339))
+	}
+	body.WriteString(`</ListBucketResult>`)
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprint(w, body.String())
+}
+
+// put stores a PutObject body, or a CopyObject's source, under key with the request's user metadata
+func (f *fakeS3) put(w http.ResponseWriter, r *http.Request, key string) {
+	body := string(readFakeBody(r))
+	if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+		source, _ = url.PathUnescape(source)
+		copied, ok := f.files[strings.TrimPrefix(strings.TrimPrefix(source, "/"), testBucket+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		body = copied
+	}
+
+	meta := make(map[string]string)
+	for name, values := range r.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-meta-") {
+			meta[strings.TrimPrefix(lower, "x-amz-meta-")] = values[0]
+		}
+	}
+	if f.files == nil {
+		f.files, f.meta, f.objects = make(map[string]string), make(map[string]map[string]string), make(map[string]time.Time)
+	}
+	f.files[key], f.meta[key], f.objects[key] = body, meta, time.Now()
+
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		fmt.Fprintf(w, `<CopyObjectResult><ETag>"copied"</ETag><LastModified>%s</LastModified></CopyObjectResult>`, time.Now().UTC().Format(time.RFC3339))
+	}
+}
+
+// newFakeS3Service returns a Supabase storage service whose bucket is served by f
+func newFakeS3Service(t *testing.T, f *fakeS3) *SupabaseServiceImpl {
+	t.Helper()
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("access", "secret", ""),
+		HTTPClient:   server.Client(),
+	})
+	return &SupabaseServiceImpl{s3Client: client, bucketName: testBucket}
+}
+
+func TestBlobKeyStaysInTheAccountFolder(t *testing.T) {
+	account := testOwnerA
+	cases := map[string]string{
+		"1700000000_abc.csv":    account + "/1700000000_abc.csv",
+		account + "/abc.csv":    account + "/abc.csv",
+		testOwnerB + "/abc.csv": account + "/" + testOwnerB + "/abc.csv",
+	}
+	for blobName, want := range cases {
+		if got := blobKey(account, blobName); got != want {
+			t.Errorf("blobKey(%q) = %q, want %q", blobName, got, want)
+		}
+	}
+}
+
+func TestNewestDatasetObject(t *testing.T) {
+	at := func(hour int) *time.Time {
+		when := time.Date(2024, 1, 1, hour, 0, 0, 0, time.UTC)
+		return &when
+	}
+	objects := []s3Types.Object{
+		{Key: aws.String("a/old.csv"), LastModified: at(1)},
+		{Key: aws.String("a/undated.csv")},
+		{Key: aws.String("a/new.csv"), LastModified: at(3)},
+		{Key: aws.String("a/new.csv.stats.json"), LastModified: at(5)},
+		{Key: aws.String("a/manifest.json"), LastModified: at(6)},
+		{Key: aws.String("a/middle.csv"), LastModified: at(2)},
+	}
+
+	newest := newestDatasetObject(objects)
+	if newest == nil || aws.ToString(newest.Key) != "a/new.csv" {
+		t.Fatalf("newest = %v, want a/new.csv", newest)
+	}
+	if newest != &objects[2] {
+		t.Error("newest does not point into the listing")
+	}
+
+	// An undated blob is only picked when nothing else is dated
+	if newest := newestDatasetObject(objects[1:2]); newest == nil || aws.ToString(newest.Key) != "a/undated.csv" {
+		t.Errorf("only undated = %v, want a/undated.csv", newest)
+	}
+	if newest := newestDatasetObject(objects[:2]); aws.ToString(newest.Key) != "a/old.csv" {
+		t.Errorf("dated and undated = %s, want a/old.csv", aws.ToString(newest.Key))
+	}
+	if newest := newestDatasetObject(objects[3:5]); newest != nil {
+		t.Errorf("sidecars only = %s, want nil", aws.ToString(newest.Key))
+	}
+}
+
+func TestFindBlobByPatternReadsEveryPage(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &fakeS3{pageSize: 2, objects: map[string]time.Time{
+		testOwnerA + "/1_aaa.csv":            base.Add(1 * time.Hour),
+		testOwnerA + "/2_bbb.csv":            base.Add(2 * time.Hour),
+		testOwnerA + "/3_ccc.csv":            base.Add(3 * time.Hour),
+		testOwnerA + "/3_ccc.csv.stats.json": base.Add(4 * time.Hour),
+		testOwnerA + "/4_ddd.csv":            base.Add(5 * time.Hour), // Last page
+		testOwnerB + "/9_zzz.csv":            base.Add(9 * time.Hour),
+	}}
+	storage := newFakeS3Service(t, f)
+
+	key, err := storage.FindBlobByPattern(testOwnerA, "")
+	if err != nil {
+		t.Fatalf("FindBlobByPattern: %v", err)
+	}
+	if key != testOwnerA+"/4_ddd.csv" {
+		t.Errorf("newest blob = %s, want the one on the last page", key)
+	}
+	if f.lists != 3 {
+		t.Errorf("listed %d pages, want 3", f.lists)
+	}
+
+	key, err = storage.FindBlobByPattern(testOwnerA, "bbb")
+	if err != nil || key != testOwnerA+"/2_bbb.csv" {
+		t.Errorf("pattern bbb = %s, %v, want %s/2_bbb.csv", key, err, testOwnerA)
+	}
+}
+
+func TestIsDatasetBlobKey(t *testing.T) {
+	cases := map[string]bool{
+		"a/1_abc.csv":           true,
+		"a/abc.csv.enc":         true,
+		"a/abc.csv.enc.meta":    false,
+		"a/abc.csv.stats.json":  false,
+		"a/manifest.json":       false,
+		"a/abc.enc":             false,
+		"a/abc.csv.enc.partial": false,
+	}
+	for key, want := range cases {
+		if got := isDatasetBlobKey(key); got != want {
+			t.Errorf("isDatasetBlobKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestFindBlobByPatternFindsEncryptedBlobs(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &fakeS3{pageSize: 10, objects: map[string]time.Time{
+		testOwnerA + "/1_aaa.csv":            base.Add(1 * time.Hour),
+		testOwnerA + "/bbb.csv.enc":          base.Add(2 * time.Hour),
+		testOwnerA + "/bbb.csv.enc.meta":     base.Add(3 * time.Hour),
+		testOwnerA + "/ccc.csv.enc":          base.Add(4 * time.Hour),
+		testOwnerA + "/ccc.csv.enc.meta":     base.Add(5 * time.Hour),
+		testOwnerA + "/1_aaa.csv.stats.json": base.Add(6 * time.Hour),
+	}}
+	storage := newFakeS3Service(t, f)
+
+	cases := map[string]string{
+		"":         testOwnerA + "/ccc.csv.enc", // Newest blob, not its newer .meta
+		"bbb":      testOwnerA + "/bbb.csv.enc",
+		"aaa":      testOwnerA + "/1_aaa.csv",
+		"no-match": testOwnerA + "/ccc.csv.enc",
+	}
+	for pattern, want := range cases {
+		if got, err := storage.FindBlobByPattern(testOwnerA, pattern); err != nil || got != want {
+			t.Errorf("pattern %q = %s, %v, want %s", pattern, got, err, want)
+		}
+	}
+
+	// A data hash recorded in the manifest resolves to its blob without matching by name
+	dataHash := "0x" + strings.Repeat("d", 64)
+	f.files = map[string]string{
+		testOwnerA + "/" + manifestObjectName: fmt.Sprintf(`{%q: {"blob_name": %q, "encrypted": true}}`, dataHash, testOwnerA+"/bbb.csv.enc"),
+	}
+	f.lists = 0
+	if got, err := storage.FindBlobByPattern(testOwnerA, dataHash); err != nil || got != testOwnerA+"/bbb.csv.enc" {
+		t.Errorf("manifest hash = %s, %v, want %s/bbb.csv.enc", got, err, testOwnerA)
+	}
+	if f.lists != 0 {
+		t.Errorf("listed the bucket %d times for a hash in the manifest", f.lists)
+	}
+}
+
+func TestBlobMetadataRoundTrips(t *testing.T) {
+	f := &fakeS3{pageSize: 10}
+	storage := newFakeS3Service(t, f)
+	dataHash := "0x" + strings.Repeat("e", 64)
+	blobName := testOwnerA + "/1700000000_data.csv"
+	metadata := models.BlobMetadata{
+		RowCount:          2,
+		ColumnCount:       3,
+		PlaintextSize:     29,
+		SchemaFingerprint: "0x" + strings.Repeat("f", 64),
+		DataHash:          dataHash,
+	}
+
+	_, err := storage.putObjectBytes(context.Background(), &s3.PutObjectInput{Bucket: aws.String(testBucket), Key: aws.String(blobName)}, []byte("id,name,email\n1,a,b\n2,c,d\n"))
+	if err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if err := storage.UpdateManifest(testOwnerA, dataHash, models.BlobManifestEntry{BlobName: blobName, Size: 29}); err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+	if err := storage.SetBlobMetadata(testOwnerA, blobName, metadata); err != nil {
+		t.Fatalf("SetBlobMetadata: %v", err)
+	}
+
+	// The object keeps its bytes and carries the metadata as x-amz-meta-* headers
+	if body := f.files[blobName]; body != "id,name,email\n1,a,b\n2,c,d\n" {
+		t.Errorf("object after the metadata copy = %q, want it unchanged", body)
+	}
+	head, err := storage.s3Client.HeadObject(context.Background(), &s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String(blobName)})
+	if err != nil {
+		t.Fatalf("HeadObject: %v", err)
+	}
+	want := map[string]string{
+		"row-count":          "2",
+		"column-count":       "3",
+		"plaintext-size":     "29",
+		"schema-fingerprint": metadata.SchemaFingerprint,
+		"data-hash":          dataHash,
+	}
+	if !reflect.DeepEqual(head.Metadata, want) {
+		t.Errorf("object metadata = %v, want %v", head.Metadata, want)
+	}
+
+	// The listing and the manifest give back the same document that was stored
+	blobs, err := storage.ListBlobs(testOwnerA)
+	if err != nil || len(blobs) != 1 || blobs[0].Metadata == nil || *blobs[0].Metadata != metadata {
+		t.Fatalf("ListBlobs = %+v, %v, want one blob with %+v", blobs, err, metadata)
+	}
+	manifest, err := storage.RetrieveManifest(testOwnerA)
+	if entry := manifest[NormalizeDataHash(dataHash)]; err != nil || entry.Metadata == nil || *entry.Metadata != metadata {
+		t.Errorf("manifest entry = %+v, %v, want metadata %+v", entry, err, metadata)
+	}
+}
+
+func TestBlobMetadataIsKeptInTheManifestWhenTheCopyFails(t *testing.T) {
+	f := &fakeS3{pageSize: 10}
+	storage := newFakeS3Service(t, f)
+	dataHash := "0x" + strings.Repeat("e", 64)
+	blobName := testOwnerA + "/gone.csv"
+	metadata := models.BlobMetadata{RowCount: 1, ColumnCount: 1, PlaintextSize: 4}
+
+	if err := storage.UpdateManifest(testOwnerA, dataHash, models.BlobManifestEntry{BlobName: blobName}); err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+	if err := storage.SetBlobMetadata(testOwnerA, blobName, metadata); err == nil {
+		t.Error("SetBlobMetadata of a missing object succeeded")
+	}
+	manifest, _ := storage.RetrieveManifest(testOwnerA)
+	if entry := manifest[NormalizeDataHash(dataHash)]; entry.Metadata == nil || *entry.Metadata != metadata {
+		t.Errorf("manifest entry = %+v, want metadata %+v", entry, metadata)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Ensure SupabaseServiceImpl can persist backend state
+var _ StateStore = (*SupabaseServiceImpl)(nil)
+
+// LoadState reads a JSON document from the bucket and returns its ETag
+func (s *SupabaseServiceImpl) LoadState(key string, v interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	body, result, err := s.getObjectBytes(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *s3Types.NoSuchKey
+		var apiErr smithy.APIError
+		if errors.As(err, &noSuchKey) || (errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound") {
+			return "", ErrStateNotFound
+		}
+		return "", fmt.Errorf("failed to read state %s: %w", key, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return "", fmt.Errorf("failed to decode state %s: %w", key, err)
+	}
+
+	return aws.ToString(result.ETag), nil
+}
+
+// SaveState writes a JSON document to the bucket, conditional on etag (or on the key being absent)
+func (s *SupabaseServiceImpl) SaveState(key string, v interface{}, etag string) (string, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode state %s: %w", key, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String("application/json"),
+	}
+	if etag != "" {
+		input.IfMatch = aws.String(etag)
+	} else {
+		input.IfNoneMatch = aws.String("*")
+	}
+
+	// A retried write whose first attempt landed fails its precondition and reports a
+	// conflict, which callers already resolve by reloading
+	result, err := s.putObjectBytes(ctx, input, body)
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "PreconditionFailed" || apiErr.ErrorCode() == "ConditionalRequestConflict") {
+			return "", ErrStateConflict
+		}
+		return "", fmt.Errorf("failed to write state %s: %w", key, err)
+	}
+
+	fmt.Printf("DEBUG: Saved state %s (%d bytes)\n", key, len(body))
+	return aws.ToString(result.ETag), nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+	"github.com/datax/backend/models"
+)
+
+// ErrRecipientNotRegistered is returned when minting to an account that hasn't registered to
+// receive the token, which coin::deposit would abort on
+var ErrRecipientNotRegistered = errors.New("recipient has not registered to receive the token")
+
+// dataTokenType is the coin type data_token::init creates, with the DataX module at moduleAddress
+func dataTokenType(moduleAddress string) (string, error) {
+	moduleAddr, err := parseAddress(moduleAddress)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s::data_token::DataToken", moduleAddr.String()), nil
+}
+
+// GetTokenInfo describes the DataX token. Name, symbol, decimals and the minter don't change
+// once the coin is initialized, so they are read once; the supply is read on every call.
+// data_token initializes the coin without supply tracking, which leaves Supply nil
+func (s *AptosServiceImpl) GetTokenInfo() (*models.TokenInfo, error) {
+	static, err := s.tokenStaticInfo()
+	if err != nil {
+		return nil, err
+	}
+	info := *static
+
+	var supply Option[big.Int]
+	if err := s.viewCoin("supply", info.CoinType, &supply); err != nil {
+		return nil, err
+	}
+	if supply.Value != nil {
+		total := supply.Value.String()
+		info.Supply = &total
+	}
+	return &info, nil
+}
+
+// IsTokenRegistered reports whether the account can receive the DataX token, through the
+// coin::is_account_registered view
+func (s *AptosServiceImpl) IsTokenRegistered(address string) (bool, error) {
+	accountAddr, err := parseAddress(address)
+	if err != nil {
+		return false, err
+	}
+	coinType, err := dataTokenType(s.cfg.DataXModuleAddr)
+	if err != nil {
+		return false, err
+	}
+
+	var registered bool
+	if err := s.viewCoin("is_account_registered", coinType, &registered, accountAddr); err != nil {
+		return false, err
+	}
+	return registered, nil
+}
+
+// tokenStaticInfo returns the fields of TokenInfo that don't change, reading them on first use
+func (s *AptosServiceImpl) tokenStaticInfo() (*models.TokenInfo, error) {
+	s.tokenInfoMu.Lock()
+	defer s.tokenInfoMu.Unlock()
+	if s.tokenInfo != nil {
+		return s.tokenInfo, nil
+	}
+
+	coinType, err := dataTokenType(s.cfg.DataXModuleAddr)
+	if err != nil {
+		return nil, err
+	}
+	info := &models.TokenInfo{CoinType: coinType}
+	if err := s.viewCoin("name", coinType, &info.Name); err != nil {
+		return nil, err
+	}
+	if err := s.viewCoin("symbol", coinType, &info.Symbol); err != nil {
+		return nil, err
+	}
+	if err := s.viewCoin("decimals", coinType, &info.Decimals); err != nil {
+		return nil, err
+	}
+	if info.Minter, err = s.tokenMinter(coinType); err != nil {
+		return nil, err
+	}
+
+	s.tokenInfo = info
+	return info, nil
+}
+
+// tokenMinter returns the account holding the coin's mint capability. managed_coin keeps it in
+// a Capabilities resource of the account that initialized the coin, which is the module
+// address, and has no way to move it
+func (s *AptosServiceImpl) tokenMinter(coinType string) (string, error) {
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
+	if err != nil {
+		return "", err
+	}
+
+	resourceType := fmt.Sprintf("0x1::managed_coin::Capabilities<%s>", coinType)
+	resourceURL := fmt.Sprintf("%s/v1/accounts/%s/resource/%s",
+		strings.TrimSuffix(s.cfg.AptosNodeURL, "/"),
+		moduleAddr.String(),
+		url.PathEscape(resourceType))
+
+	_, status, err := s.getWithRetry(resourceURL, "managed_coin Capabilities")
+	if err != nil {
+		return "", fmt.Errorf("failed to query mint capability: %w", err)
+	}
+	if status == http.StatusNotFound {
+		return "", nil
+	}
+	return moduleAddr.String(), nil
+}
+
+// viewCoin calls the 0x1::coin view function of the given name for coinType with args, which
+// returns one value, and decodes it into out
+func (s *AptosServiceImpl) viewCoin(function string, coinType string, out any, args ...interface{}) error {
+	typeTag, err := aptos.ParseTypeTag(coinType)
+	if err != nil {
+		return fmt.Errorf("invalid coin type %s: %w", coinType, err)
+	}
+	serializedArgs := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		argBytes, err := serializeArg(arg)
+		if err != nil {
+			return fmt.Errorf("failed to serialize argument: %w", err)
+		}
+		serializedArgs = append(serializedArgs, argBytes)
+	}
+
+	result, err := s.client.View(&aptos.ViewPayload{
+		Module:   aptos.ModuleId{Address: aptos.AccountOne, Name: "coin"},
+		Function: function,
+		ArgTypes: []aptos.TypeTag{*typeTag},
+		Args:     serializedArgs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to call coin::%s: %w", function, err)
+	}
+	if err := decodeViewResult(result, out); err != nil {
+		return fmt.Errorf("invalid coin::%s result: %w", function, err)
+	}
+	return nil
+}
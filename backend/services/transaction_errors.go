@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Abort codes of data_registry::reactivate_dataset
+const (
+	abortDatasetNotFound = 2 // E_DATASET_NOT_FOUND
+	abortDatasetActive   = 4 // E_DATASET_ACTIVE
+)
+
+var (
+	// ErrDatasetNotReactivatable is returned when the dataset to reactivate is no longer in
+	// the owner's DataStore, so there is nothing left on chain to restore
+	ErrDatasetNotReactivatable = errors.New("dataset no longer exists on chain, so it can't be reactivated; submit the data again instead")
+	// ErrDatasetAlreadyActive is returned when reactivating a dataset that was never deleted
+	ErrDatasetAlreadyActive = errors.New("dataset is already active")
+	// ErrTransactionUnconfirmed is returned when a transaction was submitted but its outcome
+	// couldn't be read, so it may still commit
+	ErrTransactionUnconfirmed = errors.New("transaction was submitted but not confirmed")
+)
+
+// moveAbortStatus matches the vm_status of a transaction that aborted in a module, with or
+// without the error name and description newer nodes add:
+// "Move abort in 0x1::module: E_NAME(0x2): description" or "Move abort in 0x1::module: 0x2"
+var moveAbortStatus = regexp.MustCompile(`^Move abort in (0x[0-9a-fA-F]+)::(\w+): (?:\w+\()?0x([0-9a-fA-F]+)`)
+
+// TransactionError is a transaction that was committed but failed
+type TransactionError struct {
+	Hash      string
+	VMStatus  string
+	Module    string // Module the transaction aborted in; empty for other failures
+	AbortCode uint64
+}
+
+func (e *TransactionError) Error() string {
+	return fmt.Sprintf("transaction %s failed: %s", e.Hash, e.VMStatus)
+}
+
+// newTransactionError reads the abort location and code out of a failed transaction's vm_status
+func newTransactionError(hash string, vmStatus string) *TransactionError {
+	txErr := &TransactionError{Hash: hash, VMStatus: vmStatus}
+	if match := moveAbortStatus.FindStringSubmatch(vmStatus); match != nil {
+		if code, err := strconv.ParseUint(match[3], 16, 64); err == nil {
+			txErr.Module = match[2]
+			txErr.AbortCode = code
+		}
+	}
+	return txErr
+}
+
+// reactivationError maps the aborts of data_registry::reactivate_dataset to their errors
+func reactivationError(err error) error {
+	var txErr *TransactionError
+	if !errors.As(err, &txErr) || txErr.Module != "data_registry" {
+		return err
+	}
+	switch txErr.AbortCode {
+	case abortDatasetNotFound:
+		return fmt.Errorf("%w (%s)", ErrDatasetNotReactivatable, txErr.VMStatus)
+	case abortDatasetActive:
+		return fmt.Errorf("%w (%s)", ErrDatasetAlreadyActive, txErr.VMStatus)
+	}
+	return err
+}
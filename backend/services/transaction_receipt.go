@@ -0,0 +1,216 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/datax/backend/models"
+)
+
+var (
+	// ErrTransactionNotFound is returned for a hash the node knows no transaction by
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrTransactionPending is returned for a transaction still waiting to be committed
+	ErrTransactionPending = errors.New("transaction is still pending")
+)
+
+// receiptTransaction is the subset of a REST API transaction a receipt is built from
+type receiptTransaction struct {
+	scannedTransaction
+	Hash         string `json:"hash"`
+	VMStatus     string `json:"vm_status"`
+	GasUsed      string `json:"gas_used"`
+	GasUnitPrice string `json:"gas_unit_price"`
+}
+
+// GetTransactionReceipt returns what a committed transaction did and cost, with the events
+// of the DataX modules decoded
+func (s *AptosServiceImpl) GetTransactionReceipt(hash string) (*models.TransactionReceipt, error) {
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
+	hash = NormalizeTxHash(hash)
+
+	body, status, err := s.getWithRetry(fmt.Sprintf("%s/v1/transactions/by_hash/%s", nodeURL, hash), "transaction")
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, ErrTransactionNotFound
+	}
+
+	var tx receiptTransaction
+	if err := json.Unmarshal(body, &tx); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	if tx.Type == "pending_transaction" {
+		return nil, ErrTransactionPending
+	}
+
+	modules, err := newIndexedModules(s.cfg.DataXModuleAddr, s.cfg.NetworkModuleAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The node renders u64 fields as strings; missing ones are left at 0
+	version, _ := strconv.ParseUint(tx.Version, 10, 64)
+	gasUsed, _ := strconv.ParseUint(tx.GasUsed, 10, 64)
+	gasUnitPrice, _ := strconv.ParseUint(tx.GasUnitPrice, 10, 64)
+	timestamp, _ := strconv.ParseUint(tx.Timestamp, 10, 64)
+
+	receipt := &models.TransactionReceipt{
+		Hash:         tx.Hash,
+		Version:      version,
+		Sender:       tx.Sender,
+		Success:      tx.Success,
+		VMStatus:     tx.VMStatus,
+		GasUsed:      gasUsed,
+		GasUnitPrice: gasUnitPrice,
+		GasFee:       gasUsed * gasUnitPrice,
+		Timestamp:    timestamp / 1_000_000,
+		Events:       modules.receiptEvents(tx.scannedTransaction),
+	}
+	if tx.Payload.Type == "entry_function_payload" {
+		receipt.Function = tx.Payload.Function
+	}
+	return receipt, nil
+}
+
+// receiptEvents decodes a transaction's events for its receipt. Like the event index,
+// grants and revocations are read from the entry function call, since AccessControl emits
+// no event for them; Escrow::release takes grant_access's arguments and grants the same way
+func (m indexedModules) receiptEvents(tx scannedTransaction) []models.ReceiptEvent {
+	events := make([]models.ReceiptEvent, 0, len(tx.Events)+1)
+	for _, ev := range tx.Events {
+		event := models.ReceiptEvent{Type: ev.Type}
+		if len(ev.Data) > 0 {
+			event.Data = ev.Data
+		}
+		m.decodeReceiptEvent(ev, &event)
+		events = append(events, event)
+	}
+
+	if !tx.Success || tx.Payload.Type != "entry_function_payload" {
+		return events
+	}
+	address, module, function, ok := splitMoveName(tx.Payload.Function)
+	if !ok || address != m.network || (module != "AccessControl" && module+"::"+function != "Escrow::release") {
+		return events
+	}
+	owner, err := parseAddress(tx.Sender)
+	if err != nil {
+		return events
+	}
+	args := tx.Payload.Arguments
+	datasetID, ok := uintArgument(args, 0)
+	if !ok {
+		return events
+	}
+	requester, ok := addressArgument(args, 1)
+	if !ok {
+		return events
+	}
+
+	switch function {
+	case "grant_access", "release":
+		if expiresAt, ok := uintArgument(args, 2); ok {
+			// Grants that never expire are sent as the latest deadline; report them as 0 like the API takes them
+			if expiresAt == math.MaxUint64 {
+				expiresAt = 0
+			}
+			events = append(events, models.ReceiptEvent{
+				Type:          tx.Payload.Function,
+				Name:          models.EventNameAccessGranted,
+				Derived:       true,
+				AccessGranted: &models.AccessGrantedEvent{Owner: owner.String(), Requester: requester, DatasetID: datasetID, ExpiresAt: expiresAt},
+				Data:          args,
+			})
+		}
+	case "revoke_access":
+		events = append(events, models.ReceiptEvent{
+			Type:          tx.Payload.Function,
+			Name:          models.EventNameAccessRevoked,
+			Derived:       true,
+			AccessRevoked: &models.AccessRevokedEvent{Owner: owner.String(), Requester: requester, DatasetID: datasetID},
+			Data:          args,
+		})
+	}
+	return events
+}
+
+// decodeReceiptEvent fills in the typed form of a DataX event. Events of other modules,
+// unknown DataX events and events that fail to decode are left with their raw data only
+func (m indexedModules) decodeReceiptEvent(ev scannedEvent, event *models.ReceiptEvent) {
+	address, module, name, ok := splitMoveName(ev.Type)
+	if !ok {
+		return
+	}
+
+	var data struct {
+		User        string `json:"user"`
+		Owner       string `json:"owner"`
+		Requester   string `json:"requester"`
+		DatasetID   string `json:"dataset_id"`
+		DataHash    string `json:"data_hash"`
+		Metadata    string `json:"metadata"`
+		Message     string `json:"message"`
+		RequestedAt string `json:"requested_at"`
+	}
+	if err := json.Unmarshal(ev.Data, &data); err != nil {
+		return
+	}
+	datasetID, err := strconv.ParseUint(data.DatasetID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case address == m.datax && module == "data_registry" && name == models.EventNameDataSubmitted:
+		owner, err := parseAddress(data.User)
+		if err != nil {
+			return
+		}
+		event.Name = name
+		event.DataSubmitted = &models.DataSubmittedEvent{
+			Owner:     owner.String(),
+			DatasetID: datasetID,
+			DataHash:  data.DataHash,
+			Metadata:  decodeMetadataString(data.Metadata),
+		}
+	case address == m.datax && module == "data_registry" && name == models.EventNameDataDeleted:
+		owner, err := parseAddress(data.User)
+		if err != nil {
+			return
+		}
+		event.Name = name
+		event.DataDeleted = &models.DataDeletedEvent{Owner: owner.String(), DatasetID: datasetID}
+	case address == m.datax && module == "data_registry" && name == models.EventNameDataReactivated:
+		owner, err := parseAddress(data.User)
+		if err != nil {
+			return
+		}
+		event.Name = name
+		event.DataReactivated = &models.DataReactivatedEvent{Owner: owner.String(), DatasetID: datasetID}
+	case address == m.network && module == "AccessControl" && name == models.EventNameAccessRequested:
+		owner, err := parseAddress(data.Owner)
+		if err != nil {
+			return
+		}
+		requester, err := parseAddress(data.Requester)
+		if err != nil {
+			return
+		}
+		requestedAt, _ := strconv.ParseUint(data.RequestedAt, 10, 64)
+		event.Name = name
+		event.AccessRequested = &models.AccessRequestedEvent{
+			Owner:       owner.String(),
+			Requester:   requester.String(),
+			DatasetID:   datasetID,
+			Message:     decodeMetadataString(data.Message),
+			RequestedAt: requestedAt,
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/models"
+)
+
+// SetStateStore lets the service persist discovery progress across restarts
+func (s *AptosServiceImpl) SetStateStore(store StateStore) {
+	s.stateStore = store
+}
+
+// GetDiscoveryCheckpoint returns a copy of the transaction scanner's current checkpoint
+func (s *AptosServiceImpl) GetDiscoveryCheckpoint() models.DiscoveryCheckpoint {
+	s.scanMu.Lock()
+	defer s.scanMu.Unlock()
+
+	s.loadDiscoveryCheckpoint()
+	checkpoint := *s.scanCheckpoint
+	checkpoint.Users = append([]string{}, s.scanCheckpoint.Users...)
+	return checkpoint
+}
+
+// discoverUsersFromEventsTable finds users who called submit_data by scanning transactions
+// The scan resumes from the stored checkpoint, so every call only reads new transactions,
+// and returns every submitter found so far (not just the ones from this call)
+func (s *AptosServiceImpl) discoverUsersFromEventsTable() ([]string, error) {
+	if _, err := s.scanSubmitDataTransactions(); err != nil {
+		// Still return what earlier scans found
+		fmt.Printf("DEBUG: Transaction scan failed, using checkpointed users: %v\n", err)
+	}
+
+	checkpoint := s.GetDiscoveryCheckpoint()
+	fmt.Printf("DEBUG: Discovered %d users from scanned transactions (up to version %d)\n", len(checkpoint.Users), checkpoint.LastScannedVersion)
+	return checkpoint.Users, nil
+}
+
+// loadDiscoveryCheckpoint loads the stored checkpoint on first use
+// Callers must hold scanMu
+func (s *AptosServiceImpl) loadDiscoveryCheckpoint() {
+	if s.scanCheckpoint != nil {
+		return
+	}
+
+	checkpoint := &models.DiscoveryCheckpoint{Users: []string{}}
+	if s.stateStore != nil {
+		etag, err := s.stateStore.LoadState(stateKeyDiscoveryCheckpoint, checkpoint)
+		switch {
+		case err == nil:
+			s.scanETag = etag
+			fmt.Printf("DEBUG: Loaded discovery checkpoint at version %d with %d users\n", checkpoint.LastScannedVersion, len(checkpoint.Users))
+		case errors.Is(err, ErrStateNotFound):
+			fmt.Printf("DEBUG: No discovery checkpoint stored yet, starting fresh\n")
+		default:
+			fmt.Printf("WARNING: Failed to load discovery checkpoint, starting fresh: %v\n", err)
+			checkpoint = &models.DiscoveryCheckpoint{Users: []string{}}
+		}
+	}
+	s.scanCheckpoint = checkpoint
+}
+
+// scanSubmitDataTransactions walks transaction versions from the checkpoint to the ledger tip
+// looking for submit_data calls, and returns the submitters found by this scan
+// A checkpoint more than TX_SCAN_MAX_LAG versions behind the tip would never catch up with a
+// busy chain, so the scan skips ahead to that many versions below the tip; submitters in the
+// skipped versions are still found by the indexer and kept in the known-user set. Each call is
+// bounded by TX_SCAN_TIME_BUDGET so it can't hold up a request; the next call picks up where
+// this one stopped
+func (s *AptosServiceImpl) scanSubmitDataTransactions() ([]string, error) {
+	moduleAddr, err := parseAddress(s.cfg.DataXModuleAddr)
+	if err != nil {
+		return nil, err
+	}
+	submitDataFunction := fmt.Sprintf("%s::data_registry::submit_data", moduleAddr.String())
+
+	s.scanMu.Lock()
+	defer s.scanMu.Unlock()
+
+	s.loadDiscoveryCheckpoint()
+	checkpoint := s.scanCheckpoint
+
+	ledgerVersion, err := s.getLedgerVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize := s.cfg.TxScanBatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	skipped := false
+	next := checkpoint.LastScannedVersion + 1
+	if checkpoint.LastScannedVersion == 0 {
+		// No checkpoint yet: start at the configured version, or at the lag window below
+		next = uint64(s.cfg.TxScanStartVersion)
+	}
+	if maxLag := uint64(max(s.cfg.TxScanMaxLag, 0)); maxLag > 0 && next+maxLag <= ledgerVersion {
+		skipTo := ledgerVersion - maxLag + 1
+		fmt.Printf("DEBUG: Transaction scan is %d versions behind the tip, skipping versions %d-%d\n", ledgerVersion-next+1, next, skipTo-1)
+		checkpoint.SkippedVersions += skipTo - next
+		checkpoint.LastScannedVersion = skipTo - 1
+		next = skipTo
+		skipped = true
+	}
+
+	deadline := time.Now().Add(time.Duration(s.cfg.TxScanTimeBudget) * time.Second)
+	found := make(map[string]bool)
+	scanned := 0
+
+	for next <= ledgerVersion && time.Now().Before(deadline) {
+		transactions, err := s.getTransactionsPage(next, batchSize)
+		if err != nil {
+			fmt.Printf("DEBUG: Transaction scan stopped at version %d: %v\n", next, err)
+			break
+		}
+		if len(transactions) == 0 {
+			break
+		}
+
+		for _, tx := range transactions {
+			version, err := strconv.ParseUint(tx.Version, 10, 64)
+			if err != nil {
+				continue
+			}
+			if tx.Type == "user_transaction" && tx.Sender != "" &&
+				tx.Payload.Type == "entry_function_payload" && tx.Payload.Function == submitDataFunction {
+				found[tx.Sender] = true
+				fmt.Printf("DEBUG: Found user %s from transaction %d calling submit_data\n", tx.Sender, version)
+			}
+			if version > checkpoint.LastScannedVersion {
+				checkpoint.LastScannedVersion = version
+			}
+		}
+
+		scanned += len(transactions)
+		next = checkpoint.LastScannedVersion + 1
+	}
+
+	users := make([]string, 0, len(found))
+	for user := range found {
+		users = append(users, user)
+	}
+
+	fmt.Printf("DEBUG: Scanned %d transactions up to version %d (ledger at %d), found %d submitters\n",
+		scanned, checkpoint.LastScannedVersion, ledgerVersion, len(users))
+
+	if scanned > 0 || skipped {
+		checkpoint.Users = mergeUsers(checkpoint.Users, users)
+		checkpoint.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		s.saveDiscoveryCheckpoint()
+	}
+
+	return users, nil
+}
+
+// saveDiscoveryCheckpoint writes the checkpoint back to the state store
+// If another instance saved in the meantime, the two are merged and the save retried once
+// Callers must hold scanMu
+func (s *AptosServiceImpl) saveDiscoveryCheckpoint() {
+	if s.stateStore == nil {
+		return
+	}
+
+	etag, err := s.stateStore.SaveState(stateKeyDiscoveryCheckpoint, s.scanCheckpoint, s.scanETag)
+	if errors.Is(err, ErrStateConflict) {
+		stored := &models.DiscoveryCheckpoint{}
+		storedETag, loadErr := s.stateStore.LoadState(stateKeyDiscoveryCheckpoint, stored)
+		if loadErr != nil {
+			fmt.Printf("WARNING: Failed to reload discovery checkpoint after conflict: %v\n", loadErr)
+			return
+		}
+		if stored.LastScannedVersion > s.scanCheckpoint.LastScannedVersion {
+			s.scanCheckpoint.LastScannedVersion = stored.LastScannedVersion
+		}
+		s.scanCheckpoint.Users = mergeUsers(s.scanCheckpoint.Users, stored.Users)
+		etag, err = s.stateStore.SaveState(stateKeyDiscoveryCheckpoint, s.scanCheckpoint, storedETag)
+	}
+	if err != nil {
+		fmt.Printf("WARNING: Failed to save discovery checkpoint: %v\n", err)
+		return
+	}
+	s.scanETag = etag
+}
+
+// mergeUsers returns the sorted union of two user lists
+func mergeUsers(a []string, b []string) []string {
+	set := make(map[string]bool, len(a)+len(b))
+	for _, user := range a {
+		set[user] = true
+	}
+	for _, user := range b {
+		set[user] = true
+	}
+
+	merged := make([]string, 0, len(set))
+	for user := range set {
+		merged = append(merged, user)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// scannedTransaction is the subset of a REST API transaction the scanner and event indexer need
+type scannedTransaction struct {
+	Type      string `json:"type"`
+	Version   string `json:"version"`
+	Sender    string `json:"sender"`
+	Success   bool   `json:"success"`
+	Timestamp string `json:"timestamp"` // Microseconds
+	Payload   struct {
+		Type      string        `json:"type"`
+		Function  string        `json:"function"`
+		Arguments []interface{} `json:"arguments"`
+	} `json:"payload"`
+	Events []scannedEvent `json:"events"`
+}
+
+// scannedEvent is an event emitted by a scanned transaction
+type scannedEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// getTransactionsPage reads committed transactions starting at a version
+func (s *AptosServiceImpl) getTransactionsPage(start uint64, limit int) ([]scannedTransaction, error) {
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
+	transactionsURL := fmt.Sprintf("%s/v1/transactions?start=%d&limit=%d", nodeURL, start, limit)
+
+	body, status, err := s.getWithRetry(transactionsURL, "transactions")
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+
+	var transactions []scannedTransaction
+	if err := json.Unmarshal(body, &transactions); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+	return transactions, nil
+}
+
+// getLedgerVersion returns the latest committed transaction version
+func (s *AptosServiceImpl) getLedgerVersion() (uint64, error) {
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
+
+	body, status, err := s.getWithRetry(nodeURL+"/v1", "ledger info")
+	if err != nil {
+		return 0, err
+	}
+	if status == http.StatusNotFound {
+		return 0, fmt.Errorf("ledger info not found")
+	}
+
+	var ledgerInfo struct {
+		LedgerVersion string `json:"ledger_version"`
+	}
+	if err := json.Unmarshal(body, &ledgerInfo); err != nil {
+		return 0, fmt.Errorf("failed to decode ledger info: %w", err)
+	}
+
+	version, err := strconv.ParseUint(ledgerInfo.LedgerVersion, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ledger version %q: %w", ledgerInfo.LedgerVersion, err)
+	}
+	return version, nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/datax/backend/models"
+)
+
+func TestScanSkipsAheadWhenFarBehindTheTip(t *testing.T) {
+	node := newFakeNode(t)
+	node.handleTransactions(10_000, []map[string]interface{}{
+		submitDataTransaction(500, testOwnerA),   // In the skipped versions
+		submitDataTransaction(9_990, testOwnerB), // Near the tip
+	})
+	service := newTestService(t, node, func(cfg *ServiceConfig) {
+		cfg.TxScanBatchSize = 100
+		cfg.TxScanMaxLag = 1_000
+	})
+	service.scanCheckpoint = &models.DiscoveryCheckpoint{LastScannedVersion: 100, Users: []string{}}
+
+	users, err := service.scanSubmitDataTransactions()
+	if err != nil {
+		t.Fatalf("scanSubmitDataTransactions: %v", err)
+	}
+
+	if len(users) != 1 || users[0] != mustAddress(testOwnerB) {
+		t.Errorf("users = %v, want only %s", users, testOwnerB)
+	}
+	checkpoint := service.GetDiscoveryCheckpoint()
+	if checkpoint.LastScannedVersion != 9_990 {
+		t.Errorf("LastScannedVersion = %d, want the last transaction at 9990", checkpoint.LastScannedVersion)
+	}
+	if checkpoint.SkippedVersions != 8_900 {
+		t.Errorf("SkippedVersions = %d, want 8900 (101-9000)", checkpoint.SkippedVersions)
+	}
+}
+
+func TestScanCatchesUpToTheTipInOneCall(t *testing.T) {
+	// 2500 transactions behind with 100 per page: more than the old 20 batch limit
+	txs := make([]map[string]interface{}, 0, 2500)
+	for version := uint64(1); version <= 2500; version++ {
+		tx := map[string]interface{}{"type": "user_transaction", "version": strconv.FormatUint(version, 10)}
+		if version == 2500 {
+			tx = submitDataTransaction(version, testOwnerC)
+		}
+		txs = append(txs, tx)
+	}
+	node := newFakeNode(t)
+	node.handleTransactions(2500, txs)
+	service := newTestService(t, node, func(cfg *ServiceConfig) {
+		cfg.TxScanBatchSize = 100
+		cfg.TxScanMaxLag = 0
+	})
+
+	users, err := service.scanSubmitDataTransactions()
+	if err != nil {
+		t.Fatalf("scanSubmitDataTransactions: %v", err)
+	}
+	if len(users) != 1 || users[0] != mustAddress(testOwnerC) {
+		t.Errorf("users = %v, want %s from the tip", users, testOwnerC)
+	}
+	if got := service.GetDiscoveryCheckpoint().LastScannedVersion; got != 2500 {
+		t.Errorf("LastScannedVersion = %d, want 2500", got)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/datax/backend/config"
+)
+
+// vaultKeyProvider wraps data keys with a HashiCorp Vault transit key. Vault keeps every
+// version of the key, so rotating it in Vault needs no ENCRYPTION_PREVIOUS_KEYS equivalent
+type vaultKeyProvider struct {
+	addr       string
+	token      string
+	mount      string
+	key        string
+	httpClient *http.Client
+}
+
+func newVaultKeyProvider() (*vaultKeyProvider, error) {
+	if config.AppConfig.VaultAddr == "" || config.AppConfig.VaultToken == "" || config.AppConfig.VaultTransitKey == "" {
+		return nil, fmt.Errorf("KEY_PROVIDER=vault requires VAULT_ADDR, VAULT_TOKEN and VAULT_TRANSIT_KEY")
+	}
+	return &vaultKeyProvider{
+		addr:       strings.TrimSuffix(config.AppConfig.VaultAddr, "/"),
+		token:      config.AppConfig.VaultToken,
+		mount:      strings.Trim(config.AppConfig.VaultTransitMount, "/"),
+		key:        config.AppConfig.VaultTransitKey,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *vaultKeyProvider) Name() string { return "vault" }
+
+func (p *vaultKeyProvider) KeyID() string { return "vault:" + p.key }
+
+func (p *vaultKeyProvider) WrapKey(ctx context.Context, dek []byte) (string, string, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	err := p.call(ctx, http.MethodPost, "encrypt/"+url.PathEscape(p.key), map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(dek),
+	}, &resp)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to wrap data key with Vault: %w", err)
+	}
+	return p.KeyID(), resp.Data.Ciphertext, nil
+}
+
+func (p *vaultKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped string) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	err := p.call(ctx, http.MethodPost, "decrypt/"+url.PathEscape(strings.TrimPrefix(keyID, "vault:")), map[string]string{
+		"ciphertext": wrapped,
+	}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with Vault: %w", err)
+	}
+	dek, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext from Vault: %w", err)
+	}
+	return dek, nil
+}
+
+func (p *vaultKeyProvider) Ping(ctx context.Context) error {
+	var resp struct {
+		Data struct {
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	return p.call(ctx, http.MethodGet, "keys/"+url.PathEscape(p.key), nil, &resp)
+}
+
+// call sends a request to a path under the transit mount and decodes the JSON response into out
+func (p *vaultKeyProvider) call(ctx context.Context, method string, path string, input interface{}, out interface{}) error {
+	var body io.Reader
+	if input != nil {
+		payload, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/v1/%s/%s", p.addr, p.mount, path), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Vault unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Vault response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(respBody, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("Vault %s failed (%d): %s", path, resp.StatusCode, strings.Join(vaultErr.Errors, "; "))
+		}
+		return fmt.Errorf("Vault %s failed (%d): %s", path, resp.StatusCode, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse Vault response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+)
+
+// decodeViewResult stores the values a view function returned in out, one pointer per
+// return value. The node renders Move values as JSON:
+//
+//	bool                        true                  *bool
+//	u8, u16, u32                7                     *uint8, *uint16, *uint32
+//	u64                         "7"                   *uint64
+//	u128, u256                  "7"                   *big.Int
+//	address                     "0x1"                 *aptos.AccountAddress, *string
+//	0x1::string::String         "text"                *string
+//	vector<u8>                  "0x0a0b"              *[]byte
+//	vector<T>                   [...]                 pointer to a slice of T's target
+//	0x1::option::Option<T>      {"vec": [...]}        *Option[T]
+//	structs                     {"field": ...}        pointer to a struct, decoded with encoding/json
+func decodeViewResult(result []any, out ...any) error {
+	if len(result) != len(out) {
+		return fmt.Errorf("view returned %d values, expected %d", len(result), len(out))
+	}
+	for i, value := range result {
+		target := reflect.ValueOf(out[i])
+		if target.Kind() != reflect.Pointer || target.IsNil() {
+			return fmt.Errorf("view value %d: target must be a non-nil pointer, got %T", i, out[i])
+		}
+		if err := decodeViewValue(value, target.Elem()); err != nil {
+			return fmt.Errorf("view value %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+var (
+	bigIntType  = reflect.TypeOf(big.Int{})
+	addressType = reflect.TypeOf(aptos.AccountAddress{})
+	byteSlice   = reflect.TypeOf([]byte(nil))
+)
+
+// viewOption is implemented by *Option[T], which can't be named without its T
+type viewOption interface {
+	decodeViewOption(vec []any) error
+}
+
+// decodeViewOption fills the option from the vec of a Move Option, which holds zero or one value
+func (o *Option[T]) decodeViewOption(vec []any) error {
+	switch len(vec) {
+	case 0:
+		o.Value = nil
+		return nil
+	case 1:
+		var value T
+		if err := decodeViewValue(vec[0], reflect.ValueOf(&value).Elem()); err != nil {
+			return err
+		}
+		o.Value = &value
+		return nil
+	}
+	return fmt.Errorf("option holds %d values", len(vec))
+}
+
+// decodeViewValue stores one JSON-rendered Move value in target
+func decodeViewValue(value any, target reflect.Value) error {
+	if option, ok := target.Addr().Interface().(viewOption); ok {
+		object, ok := value.(map[string]any)
+		vec, isList := object["vec"].([]any)
+		if !ok || !isList {
+			return fmt.Errorf("expected an option as {\"vec\": [...]}, got %s", describeJSON(value))
+		}
+		return option.decodeViewOption(vec)
+	}
+
+	switch target.Type() {
+	case bigIntType:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected u128/u256 as a decimal string, got %s", describeJSON(value))
+		}
+		number, ok := new(big.Int).SetString(text, 10)
+		if !ok || number.Sign() < 0 {
+			return fmt.Errorf("invalid u128/u256 %q", text)
+		}
+		target.Set(reflect.ValueOf(*number))
+		return nil
+	case addressType:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected an address as a hex string, got %s", describeJSON(value))
+		}
+		address, err := parseAddress(text)
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(*address))
+		return nil
+	case byteSlice:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected vector<u8> as a hex string, got %s", describeJSON(value))
+		}
+		decoded, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+		if err != nil {
+			return fmt.Errorf("invalid vector<u8> %q: %w", text, err)
+		}
+		target.SetBytes(decoded)
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Bool:
+		flag, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected a bool, got %s", describeJSON(value))
+		}
+		target.SetBool(flag)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		// The node renders integers up to u32 as JSON numbers
+		number, ok := value.(float64)
+		if !ok || number < 0 || number != math.Trunc(number) || target.OverflowUint(uint64(number)) {
+			return fmt.Errorf("expected a u%d number, got %s", target.Type().Bits(), describeJSON(value))
+		}
+		target.SetUint(uint64(number))
+	case reflect.Uint64:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected u64 as a decimal string, got %s", describeJSON(value))
+		}
+		number, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid u64 %q", text)
+		}
+		target.SetUint(number)
+	case reflect.String:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %s", describeJSON(value))
+		}
+		target.SetString(text)
+	case reflect.Slice:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("expected a vector, got %s", describeJSON(value))
+		}
+		slice := reflect.MakeSlice(target.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decodeViewValue(item, slice.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		target.Set(slice)
+	case reflect.Struct:
+		if _, ok := value.(map[string]any); !ok {
+			return fmt.Errorf("expected a struct, got %s", describeJSON(value))
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(encoded, target.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid struct: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported target type %s", target.Type())
+	}
+	return nil
+}
+
+// describeJSON names a decoded JSON value for error messages
+func describeJSON(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case float64:
+		return fmt.Sprintf("number %v", v)
+	case bool:
+		return fmt.Sprintf("bool %v", v)
+	case []any:
+		return fmt.Sprintf("array of %d", len(v))
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
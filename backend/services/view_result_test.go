@@ -0,0 +1,125 @@
+package services
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aptos-labs/aptos-go-sdk"
+)
+
+// viewJSON decodes a view response body the way the SDK hands it over
+func viewJSON(t *testing.T, body string) []any {
+	t.Helper()
+	var result []any
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return result
+}
+
+func TestDecodeViewResultFillsTypedTargets(t *testing.T) {
+	type listing struct {
+		Price  string `json:"price"`
+		Active bool   `json:"active"`
+	}
+	var (
+		flag     bool
+		small    uint8
+		count    uint32
+		id       uint64
+		balance  big.Int
+		owner    aptos.AccountAddress
+		ownerHex string
+		name     string
+		hash     []byte
+		ids      []uint64
+		owners   []aptos.AccountAddress
+		expiry   Option[uint64]
+		missing  Option[uint64]
+		item     listing
+	)
+	result := viewJSON(t, `[true, 200, 70000, "18446744073709551615", "340282366920938463463374607431768211455",
+		"0x1", "0xA550C18", "Weather", "0x0a0b", ["1", "2"], ["0x1", "0x2"], {"vec": ["99"]}, {"vec": []},
+		{"price": "10", "active": true}]`)
+
+	err := decodeViewResult(result, &flag, &small, &count, &id, &balance, &owner, &ownerHex, &name, &hash,
+		&ids, &owners, &expiry, &missing, &item)
+	if err != nil {
+		t.Fatalf("decodeViewResult: %v", err)
+	}
+
+	u128Max, _ := new(big.Int).SetString("340282366920938463463374607431768211455", 10)
+	one, _ := parseAddress("0x1")
+	two, _ := parseAddress("0x2")
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"bool", flag, true},
+		{"u8", small, uint8(200)},
+		{"u32", count, uint32(70000)},
+		{"u64", id, uint64(18446744073709551615)},
+		{"u128", balance.String(), u128Max.String()},
+		{"address", owner, *one},
+		{"address as string", ownerHex, "0xA550C18"},
+		{"string", name, "Weather"},
+		{"vector<u8>", hash, []byte{0x0a, 0x0b}},
+		{"vector<u64>", ids, []uint64{1, 2}},
+		{"vector<address>", owners, []aptos.AccountAddress{*one, *two}},
+		{"some", expiry.Value != nil && *expiry.Value == 99, true},
+		{"none", missing.Value == nil, true},
+		{"struct", item, listing{Price: "10", Active: true}},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestDecodeViewResultRejectsMismatches(t *testing.T) {
+	var (
+		small   uint8
+		id      uint64
+		balance big.Int
+		owner   aptos.AccountAddress
+		hash    []byte
+		expiry  Option[uint64]
+		ids     []uint64
+		signed  int
+	)
+	cases := []struct {
+		name   string
+		body   string
+		target any
+		want   string // In the error
+	}{
+		{"u8 overflow", `[256]`, &small, "u8"},
+		{"u8 fraction", `[1.5]`, &small, "u8"},
+		{"u64 as a number", `[7]`, &id, "decimal string"},
+		{"u64 overflow", `["18446744073709551616"]`, &id, "invalid u64"},
+		{"negative u128", `["-1"]`, &balance, "invalid u128"},
+		{"bad address", `["0xzz"]`, &owner, "value 0"},
+		{"bad bytes", `["0xabc"]`, &hash, "vector<u8>"},
+		{"option with two values", `[{"vec": ["1", "2"]}]`, &expiry, "holds 2"},
+		{"option not an object", `[["1"]]`, &expiry, "option"},
+		{"bad element", `[["1", true]]`, &ids, "element 1"},
+		{"unsupported target", `[1]`, &signed, "unsupported"},
+	}
+	for _, tc := range cases {
+		err := decodeViewResult(viewJSON(t, tc.body), tc.target)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want an error mentioning %q", tc.name, err, tc.want)
+		}
+	}
+
+	if err := decodeViewResult(viewJSON(t, `["1", "2"]`), &id); err == nil {
+		t.Error("two values into one target: want an error")
+	}
+	if err := decodeViewResult(viewJSON(t, `["1"]`), id); err == nil {
+		t.Error("non-pointer target: want an error")
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha3"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+var (
+	// ErrInvalidNonce is returned when a nonce is unknown, already used, expired, or issued to another address
+	ErrInvalidNonce = errors.New("invalid or expired nonce")
+	// ErrInvalidSignature is returned when a wallet signature doesn't prove control of the address
+	ErrInvalidSignature = errors.New("invalid wallet signature")
+)
+
+// ed25519Scheme is the authentication key scheme byte for single Ed25519 keys
+const ed25519Scheme = 0x00
+
+// walletChallenge is an outstanding nonce issued to an address
+type walletChallenge struct {
+	address   string
+	expiresAt time.Time
+}
+
+// WalletAuthService issues single-use nonces and verifies that a wallet signed them,
+// proving the caller controls the address it claims
+type WalletAuthService struct {
+	mu     sync.Mutex
+	nonces map[string]walletChallenge
+	ttl    time.Duration
+}
+
+func NewWalletAuthService() *WalletAuthService {
+	return &WalletAuthService{
+		nonces: make(map[string]walletChallenge),
+		ttl:    time.Duration(config.AppConfig.AuthChallengeTTL) * time.Second,
+	}
+}
+
+// IssueChallenge returns a new nonce for the address to sign
+func (w *WalletAuthService) IssueChallenge(address string) (*models.AuthChallenge, error) {
+	addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(buf)
+	expiresAt := time.Now().Add(w.ttl)
+
+	w.mu.Lock()
+	// Drop expired nonces so abandoned challenges don't accumulate
+	for n, challenge := range w.nonces {
+		if time.Now().After(challenge.expiresAt) {
+			delete(w.nonces, n)
+		}
+	}
+	w.nonces[nonce] = walletChallenge{address: addr.String(), expiresAt: expiresAt}
+	w.mu.Unlock()
+
+	return &models.AuthChallenge{
+		Address:   addr.String(),
+		Nonce:     nonce,
+		Message:   fmt.Sprintf("DataX wants you to prove you control %s", addr.String()),
+		ExpiresAt: expiresAt.Unix(),
+	}, nil
+}
+
+// consumeNonce removes the nonce and reports whether it was valid for the address
+// Nonces are consumed on every verification attempt, so a failed guess burns them too
+func (w *WalletAuthService) consumeNonce(address string, nonce string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	challenge, ok := w.nonces[nonce]
+	delete(w.nonces, nonce)
+	return ok && challenge.address == address && time.Now().Before(challenge.expiresAt)
+}
+
+// VerifySignature checks that signedMessage contains a nonce issued to address and was
+// signed by the Ed25519 key behind the address's on-chain authentication key
+// signedMessage is the exact text the wallet signed (for Aptos wallets, the fullMessage
+// including the APTOS prefix, message, and nonce)
+func (w *WalletAuthService) VerifySignature(aptosService AptosService, address string, nonce string, signedMessage string, publicKeyHex string, signatureHex string) error {
+	addr, err := parseAddress(address)
+	if err != nil {
+		return err
+	}
+
+	if nonce == "" || !strings.Contains(signedMessage, nonce) || !w.consumeNonce(addr.String(), nonce) {
+		return ErrInvalidNonce
+	}
+
+	publicKey, err := hex.DecodeString(strings.TrimPrefix(publicKeyHex, "0x"))
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return ErrInvalidSignature
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(signatureHex, "0x"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return ErrInvalidSignature
+	}
+
+	// The public key must be the one the account authenticates with on-chain
+	authKey, err := aptosService.GetAuthenticationKey(addr.String())
+	if err != nil {
+		return fmt.Errorf("failed to look up authentication key: %w", err)
+	}
+	derived := sha3.Sum256(append(append([]byte{}, publicKey...), ed25519Scheme))
+	if !strings.EqualFold(strings.TrimPrefix(authKey, "0x"), hex.EncodeToString(derived[:])) {
+		return ErrInvalidSignature
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), []byte(signedMessage), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// GetAuthenticationKey returns the account's current authentication key (0x-prefixed hex)
+func (s *AptosServiceImpl) GetAuthenticationKey(userAddress string) (string, error) {
+	userAddr, err := parseAddress(userAddress)
+	if err != nil {
+		return "", err
+	}
+
+	nodeURL := strings.TrimSuffix(s.cfg.AptosNodeURL, "/")
+	body, status, err := s.getWithRetry(fmt.Sprintf("%s/v1/accounts/%s", nodeURL, userAddr.String()), "account")
+	if err != nil {
+		return "", err
+	}
+	if status == http.StatusNotFound {
+		return "", fmt.Errorf("account %s not found", userAddr.String())
+	}
+
+	var account struct {
+		AuthenticationKey string `json:"authentication_key"`
+	}
+	if err := json.Unmarshal(body, &account); err != nil {
+		return "", fmt.Errorf("failed to decode account: %w", err)
+	}
+	return account.AuthenticationKey, nil
+}
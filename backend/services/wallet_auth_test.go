@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha3"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testWallet is an Ed25519 account whose address is derived from its key, as on a fresh account
+type testWallet struct {
+	key     ed25519.PrivateKey
+	address string
+}
+
+func newTestWallet(seed byte) testWallet {
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	authKey := sha3.Sum256(append(append([]byte{}, key.Public().(ed25519.PublicKey)...), ed25519Scheme))
+	return testWallet{key: key, address: mustAddress("0x" + hex.EncodeToString(authKey[:]))}
+}
+
+// sign returns the hex public key and signature of message
+func (w testWallet) sign(message string) (string, string) {
+	return hex.EncodeToString(w.key.Public().(ed25519.PublicKey)), hex.EncodeToString(ed25519.Sign(w.key, []byte(message)))
+}
+
+func newTestWalletAuth(t *testing.T) (*WalletAuthService, AptosService) {
+	t.Helper()
+	chain, err := NewMockAptosService("")
+	if err != nil {
+		t.Fatalf("NewMockAptosService: %v", err)
+	}
+	return NewWalletAuthService(), chain
+}
+
+func TestVerifySignatureAcceptsTheAddressOwner(t *testing.T) {
+	auth, chain := newTestWalletAuth(t)
+	owner := newTestWallet(1)
+
+	challenge, err := auth.IssueChallenge(owner.address)
+	if err != nil {
+		t.Fatalf("IssueChallenge: %v", err)
+	}
+	message := challenge.Message + "\nnonce: " + challenge.Nonce
+	publicKey, signature := owner.sign(message)
+
+	if err := auth.VerifySignature(chain, owner.address, challenge.Nonce, message, publicKey, signature); err != nil {
+		t.Fatalf("VerifySignature: %v", err)
+	}
+}
+
+func TestVerifySignatureRejectsReplayedNonces(t *testing.T) {
+	auth, chain := newTestWalletAuth(t)
+	owner := newTestWallet(1)
+
+	challenge, _ := auth.IssueChallenge(owner.address)
+	message := challenge.Message + "\nnonce: " + challenge.Nonce
+	publicKey, signature := owner.sign(message)
+
+	if err := auth.VerifySignature(chain, owner.address, challenge.Nonce, message, publicKey, signature); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := auth.VerifySignature(chain, owner.address, challenge.Nonce, message, publicKey, signature); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("replay = %v, want ErrInvalidNonce", err)
+	}
+}
+
+func TestVerifySignatureBurnsNoncesOnFailedAttempts(t *testing.T) {
+	auth, chain := newTestWalletAuth(t)
+	owner := newTestWallet(1)
+	attacker := newTestWallet(2)
+
+	challenge, _ := auth.IssueChallenge(owner.address)
+	message := challenge.Message + "\nnonce: " + challenge.Nonce
+
+	forgedKey, forgedSignature := attacker.sign(message)
+	if err := auth.VerifySignature(chain, owner.address, challenge.Nonce, message, forgedKey, forgedSignature); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("forged attempt = %v, want ErrInvalidSignature", err)
+	}
+
+	// The owner's own signature can't reuse the nonce the failed attempt spent
+	publicKey, signature := owner.sign(message)
+	if err := auth.VerifySignature(chain, owner.address, challenge.Nonce, message, publicKey, signature); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("after a failed attempt = %v, want ErrInvalidNonce", err)
+	}
+}
+
+func TestVerifySignatureRejectsForgeries(t *testing.T) {
+	owner := newTestWallet(1)
+	attacker := newTestWallet(2)
+
+	cases := []struct {
+		name string
+		// forge returns the public key and signature sent for message
+		forge func(message string) (string, string)
+	}{
+		{"attacker's key claiming the owner's address", func(m string) (string, string) { return attacker.sign(m) }},
+		{"owner's public key with the attacker's signature", func(m string) (string, string) {
+			publicKey, _ := owner.sign(m)
+			_, signature := attacker.sign(m)
+			return publicKey, signature
+		}},
+		{"owner's signature of another message", func(m string) (string, string) { return owner.sign("something else") }},
+		{"signature altered", func(m string) (string, string) {
+			publicKey, signature := owner.sign(m)
+			return publicKey, "00" + signature[2:]
+		}},
+		{"malformed signature", func(m string) (string, string) {
+			publicKey, _ := owner.sign(m)
+			return publicKey, "not-hex"
+		}},
+		{"short public key", func(m string) (string, string) {
+			publicKey, signature := owner.sign(m)
+			return publicKey[:32], signature
+		}},
+	}
+	for _, tc := range cases {
+		auth, chain := newTestWalletAuth(t)
+		challenge, _ := auth.IssueChallenge(owner.address)
+		message := challenge.Message + "\nnonce: " + challenge.Nonce
+		publicKey, signature := tc.forge(message)
+
+		if err := auth.VerifySignature(chain, owner.address, challenge.Nonce, message, publicKey, signature); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: %v, want ErrInvalidSignature", tc.name, err)
+		}
+	}
+}
+
+func TestVerifySignatureRejectsNoncesOfOtherAddresses(t *testing.T) {
+	auth, chain := newTestWalletAuth(t)
+	owner := newTestWallet(1)
+	attacker := newTestWallet(2)
+
+	// A nonce the attacker was issued for their own address can't prove the owner's
+	challenge, _ := auth.IssueChallenge(attacker.address)
+	message := challenge.Message + "\nnonce: " + challenge.Nonce
+	publicKey, signature := attacker.sign(message)
+
+	if err := auth.VerifySignature(chain, owner.address, challenge.Nonce, message, publicKey, signature); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("nonce of another address = %v, want ErrInvalidNonce", err)
+	}
+}
+
+func TestVerifySignatureRejectsMissingAndExpiredNonces(t *testing.T) {
+	auth, chain := newTestWalletAuth(t)
+	owner := newTestWallet(1)
+
+	// A signed message that doesn't carry the nonce
+	challenge, _ := auth.IssueChallenge(owner.address)
+	publicKey, signature := owner.sign(challenge.Message)
+	if err := auth.VerifySignature(chain, owner.address, challenge.Nonce, challenge.Message, publicKey, signature); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("message without the nonce = %v, want ErrInvalidNonce", err)
+	}
+
+	// A nonce that was never issued
+	message := "nonce: 00112233445566778899aabbccddeeff"
+	publicKey, signature = owner.sign(message)
+	if err := auth.VerifySignature(chain, owner.address, "00112233445566778899aabbccddeeff", message, publicKey, signature); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("unissued nonce = %v, want ErrInvalidNonce", err)
+	}
+
+	// A nonce past its TTL
+	auth.ttl = time.Millisecond
+	challenge, _ = auth.IssueChallenge(owner.address)
+	time.Sleep(5 * time.Millisecond)
+	message = challenge.Message + "\nnonce: " + challenge.Nonce
+	publicKey, signature = owner.sign(message)
+	if err := auth.VerifySignature(chain, owner.address, challenge.Nonce, message, publicKey, signature); !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("expired nonce = %v, want ErrInvalidNonce", err)
+	}
+}
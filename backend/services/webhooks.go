@@ -0,0 +1,449 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+// Webhook limits
+const (
+	maxWebhooksPerOwner   = 10
+	maxWebhookDeliveries  = 50 // Attempts kept per webhook for the status endpoint
+	webhookQueueSize      = 1000
+	webhookMaxBackoff     = 5 * time.Minute
+	webhookStateConflicts = 3 // Reload-and-retry rounds when another instance wrote the same owner's webhooks
+)
+
+var (
+	// ErrWebhookNotFound is returned for a webhook ID the owner hasn't registered
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrInvalidWebhook is returned for a registration that can't be accepted
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	// ErrWebhookTargetBlocked is returned for an endpoint on a loopback, link-local or private address
+	ErrWebhookTargetBlocked = errors.New("webhook endpoint is not a public address")
+)
+
+// blockedWebhookPrefixes are ranges that aren't reachable on the internet, besides those netip
+// classifies (loopback, private, link-local, multicast, unspecified)
+var blockedWebhookPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64, which can reach IPv4 private ranges
+}
+
+// WebhookService keeps owners' webhooks and delivers events to them. Webhooks live in the
+// state store (one system/webhooks/{owner}.json document per owner) when the storage
+// backend has one, and in memory otherwise. Deliveries are queued and sent by Run's workers
+type WebhookService struct {
+	store      StateStore // nil keeps webhooks in memory, lost on restart
+	mu         sync.Mutex
+	memory     map[string][]models.Webhook
+	queue      chan webhookJob
+	httpClient *http.Client
+}
+
+type webhookJob struct {
+	hook  models.Webhook
+	event models.WebhookEvent
+}
+
+// NewWebhookService creates the service; store may be nil
+func NewWebhookService(store StateStore) *WebhookService {
+	return &WebhookService{
+		store:      store,
+		memory:     make(map[string][]models.Webhook),
+		queue:      make(chan webhookJob, webhookQueueSize),
+		httpClient: newWebhookClient(time.Duration(config.AppConfig.WebhookTimeout) * time.Second),
+	}
+}
+
+// newWebhookClient returns a client that refuses to connect to non-public addresses. The check
+// runs on the address actually dialled, so a host that resolved to a public address at
+// registration and is later pointed elsewhere, or a redirect, can't reach internal services.
+// Proxies are not used, since they would dial on the client's behalf
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			return checkWebhookAddr(ip)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// checkWebhookAddr refuses addresses a webhook may not be delivered to, unless
+// WEBHOOK_ALLOW_PRIVATE_TARGETS is set
+func checkWebhookAddr(ip netip.Addr) error {
+	if config.AppConfig.WebhookAllowPrivate {
+		return nil
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrWebhookTargetBlocked, ip)
+	}
+	for _, prefix := range blockedWebhookPrefixes {
+		if prefix.Contains(ip) {
+			return fmt.Errorf("%w: %s", ErrWebhookTargetBlocked, ip)
+		}
+	}
+	return nil
+}
+
+// checkWebhookHost resolves a webhook's host and refuses it if any of its addresses is blocked
+func checkWebhookHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: url host %s does not resolve", ErrInvalidWebhook, host)
+	}
+	for _, addr := range addrs {
+		if err := checkWebhookAddr(addr); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidWebhook, err)
+		}
+	}
+	return nil
+}
+
+// Run delivers queued events with WEBHOOK_WORKERS workers until ctx is cancelled
+func (s *WebhookService) Run(ctx context.Context) {
+	workers := max(config.AppConfig.WebhookWorkers, 1)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.queue:
+					s.deliver(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Register adds a webhook for owner and returns it, secret included this once
+func (s *WebhookService) Register(owner string, targetURL string, secret string, events []string) (models.Webhook, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return models.Webhook{}, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	if parsed.Scheme != "https" && config.AppConfig.IsProduction() {
+		return models.Webhook{}, fmt.Errorf("%w: url must use https", ErrInvalidWebhook)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.httpClient.Timeout)
+	defer cancel()
+	if err := checkWebhookHost(ctx, parsed.Hostname()); err != nil {
+		return models.Webhook{}, err
+	}
+	id, err := randomWebhookID()
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	hook := models.Webhook{
+		ID:        id,
+		Owner:     owner,
+		URL:       targetURL,
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: time.Now().Unix(),
+	}
+	err = s.update(owner, func(hooks []models.Webhook) ([]models.Webhook, error) {
+		if len(hooks) >= maxWebhooksPerOwner {
+			return nil, fmt.Errorf("%w: at most %d webhooks per owner", ErrInvalidWebhook, maxWebhooksPerOwner)
+		}
+		return append(hooks, hook), nil
+	})
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	fmt.Printf("DEBUG: Registered webhook %s for %s: %s %v\n", id, owner, targetURL, events)
+	return hook, nil
+}
+
+// List returns owner's webhooks without their secrets or delivery history
+func (s *WebhookService) List(owner string) ([]models.Webhook, error) {
+	hooks, _, err := s.load(owner)
+	if err != nil {
+		return nil, err
+	}
+	listed := make([]models.Webhook, 0, len(hooks))
+	for _, hook := range hooks {
+		hook.Secret = ""
+		hook.Deliveries = nil
+		listed = append(listed, hook)
+	}
+	return listed, nil
+}
+
+// Delete removes one of owner's webhooks. Deliveries already queued for it are still attempted
+func (s *WebhookService) Delete(owner string, id string) error {
+	return s.update(owner, func(hooks []models.Webhook) ([]models.Webhook, error) {
+		for i, hook := range hooks {
+			if hook.ID == id {
+				return append(hooks[:i], hooks[i+1:]...), nil
+			}
+		}
+		return nil, ErrWebhookNotFound
+	})
+}
+
+// Deliveries returns the recorded delivery attempts of one of owner's webhooks, newest first
+func (s *WebhookService) Deliveries(owner string, id string) ([]models.WebhookDelivery, error) {
+	hooks, _, err := s.load(owner)
+	if err != nil {
+		return nil, err
+	}
+	for _, hook := range hooks {
+		if hook.ID == id {
+			if hook.Deliveries == nil {
+				return []models.WebhookDelivery{}, nil
+			}
+			return hook.Deliveries, nil
+		}
+	}
+	return nil, ErrWebhookNotFound
+}
+
+// Notify queues event for every webhook of owner subscribed to it. It returns at once:
+// the webhooks are looked up and the deliveries made in the background
+func (s *WebhookService) Notify(owner string, event string, data interface{}) {
+	go func() {
+		hooks, _, err := s.load(owner)
+		if err != nil {
+			fmt.Printf("ERROR: Failed to load webhooks of %s for %s: %v\n", owner, event, err)
+			return
+		}
+		for _, hook := range hooks {
+			if !subscribed(hook, event) {
+				continue
+			}
+			deliveryID, err := randomWebhookID()
+			if err != nil {
+				fmt.Printf("ERROR: Failed to create delivery ID: %v\n", err)
+				return
+			}
+			job := webhookJob{hook: hook, event: models.WebhookEvent{
+				DeliveryID: deliveryID,
+				Event:      event,
+				Owner:      owner,
+				CreatedAt:  time.Now().Unix(),
+				Data:       data,
+			}}
+			select {
+			case s.queue <- job:
+			default:
+				fmt.Printf("WARNING: Webhook queue full, dropping %s for webhook %s\n", event, hook.ID)
+			}
+		}
+	}()
+}
+
+// deliver POSTs an event until the endpoint answers 2xx or WEBHOOK_MAX_ATTEMPTS is reached,
+// doubling the wait after each failure. Every attempt is recorded
+func (s *WebhookService) deliver(ctx context.Context, job webhookJob) {
+	body, err := json.Marshal(job.event)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to encode webhook event %s: %v\n", job.event.Event, err)
+		return
+	}
+
+	attempts := max(config.AppConfig.WebhookMaxAttempts, 1)
+	backoff := time.Second
+	for attempt := 1; attempt <= attempts; attempt++ {
+		status, err := s.post(ctx, job, body)
+		delivery := models.WebhookDelivery{
+			DeliveryID:  job.event.DeliveryID,
+			Event:       job.event.Event,
+			Attempt:     attempt,
+			StatusCode:  status,
+			Success:     err == nil,
+			AttemptedAt: time.Now().Unix(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		s.recordDelivery(job.hook.Owner, job.hook.ID, delivery)
+
+		if err == nil {
+			return
+		}
+		fmt.Printf("WARNING: Webhook %s delivery %s attempt %d/%d failed: %v\n", job.hook.ID, job.event.DeliveryID, attempt, attempts, err)
+		if attempt == attempts {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+}
+
+// post sends one delivery signed with the webhook's secret
+func (s *WebhookService) post(ctx context.Context, job webhookJob, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DataX-Webhooks/1")
+	req.Header.Set("X-DataX-Event", job.event.Event)
+	req.Header.Set("X-DataX-Delivery", job.event.DeliveryID)
+	req.Header.Set("X-DataX-Signature", "sha256="+SignWebhookPayload(job.hook.Secret, body))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload is the hex HMAC-SHA256 of a payload under a webhook's secret, sent as
+// X-DataX-Signature: sha256={signature}
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordDelivery keeps a delivery attempt in the webhook's history. The webhook may have
+// been deleted meanwhile, in which case there's nothing to record it in
+func (s *WebhookService) recordDelivery(owner string, id string, delivery models.WebhookDelivery) {
+	err := s.update(owner, func(hooks []models.Webhook) ([]models.Webhook, error) {
+		for i := range hooks {
+			if hooks[i].ID == id {
+				deliveries := append([]models.WebhookDelivery{delivery}, hooks[i].Deliveries...)
+				hooks[i].Deliveries = deliveries[:min(len(deliveries), maxWebhookDeliveries)]
+				return hooks, nil
+			}
+		}
+		return nil, ErrWebhookNotFound
+	})
+	if err != nil && !errors.Is(err, ErrWebhookNotFound) {
+		fmt.Printf("ERROR: Failed to record delivery %s of webhook %s: %v\n", delivery.DeliveryID, id, err)
+	}
+}
+
+// load returns owner's webhooks and, from the state store, the document's ETag
+func (s *WebhookService) load(owner string) ([]models.Webhook, string, error) {
+	if s.store == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return append([]models.Webhook(nil), s.memory[webhookOwnerKey(owner)]...), "", nil
+	}
+
+	var hooks []models.Webhook
+	etag, err := s.store.LoadState(webhookStateKey(owner), &hooks)
+	if errors.Is(err, ErrStateNotFound) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return hooks, etag, nil
+}
+
+// update applies fn to owner's webhooks and saves the result. State store writes are
+// conditional, so a concurrent write by another instance is reloaded and fn applied again
+func (s *WebhookService) update(owner string, fn func([]models.Webhook) ([]models.Webhook, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := webhookOwnerKey(owner)
+	if s.store == nil {
+		hooks, err := fn(append([]models.Webhook(nil), s.memory[key]...))
+		if err != nil {
+			return err
+		}
+		s.memory[key] = hooks
+		return nil
+	}
+
+	for range webhookStateConflicts {
+		var hooks []models.Webhook
+		etag, err := s.store.LoadState(webhookStateKey(owner), &hooks)
+		if err != nil && !errors.Is(err, ErrStateNotFound) {
+			return err
+		}
+		hooks, err = fn(hooks)
+		if err != nil {
+			return err
+		}
+		_, err = s.store.SaveState(webhookStateKey(owner), hooks, etag)
+		if !errors.Is(err, ErrStateConflict) {
+			return err
+		}
+	}
+	return ErrStateConflict
+}
+
+func subscribed(hook models.Webhook, event string) bool {
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func webhookOwnerKey(owner string) string {
+	return strings.ToLower(strings.TrimSpace(owner))
+}
+
+func webhookStateKey(owner string) string {
+	return "system/webhooks/" + webhookOwnerKey(owner) + ".json"
+}
+
+func randomWebhookID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
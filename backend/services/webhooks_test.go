@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/datax/backend/config"
+	"github.com/datax/backend/models"
+)
+
+const testWebhookSecret = "0123456789abcdef"
+
+func TestRegisterWebhookRejectsNonPublicHosts(t *testing.T) {
+	s := NewWebhookService(nil)
+
+	for _, target := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data", // Cloud metadata
+		"http://10.0.0.5/hook",
+		"http://172.16.3.4/hook",
+		"http://192.168.1.1/hook",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[fd00::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if _, err := s.Register(testOwnerA, target, testWebhookSecret, []string{"access.requested"}); !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("%s: %v, want ErrInvalidWebhook", target, err)
+		}
+	}
+	if hooks, _ := s.List(testOwnerA); len(hooks) != 0 {
+		t.Errorf("registered %d webhooks, want none", len(hooks))
+	}
+
+	if _, err := s.Register(testOwnerA, "https://93.184.216.34/hook", testWebhookSecret, []string{"access.requested"}); err != nil {
+		t.Errorf("public address: %v", err)
+	}
+}
+
+func TestWebhookDeliveryRefusesNonPublicAddresses(t *testing.T) {
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer server.Close()
+
+	// Registered while the host was public, since repointed to a loopback address
+	s := NewWebhookService(nil)
+	job := webhookJob{
+		hook:  models.Webhook{ID: "hook", Owner: testOwnerA, URL: server.URL, Secret: testWebhookSecret},
+		event: models.WebhookEvent{DeliveryID: "delivery", Event: "access.requested"},
+	}
+	if _, err := s.post(context.Background(), job, []byte("{}")); !errors.Is(err, ErrWebhookTargetBlocked) {
+		t.Errorf("delivery to %s = %v, want ErrWebhookTargetBlocked", server.URL, err)
+	}
+	if received != 0 {
+		t.Errorf("endpoint received %d deliveries, want none", received)
+	}
+
+	allowPrivate := config.AppConfig.WebhookAllowPrivate
+	config.AppConfig.WebhookAllowPrivate = true
+	t.Cleanup(func() { config.AppConfig.WebhookAllowPrivate = allowPrivate })
+	if _, err := s.post(context.Background(), job, []byte("{}")); err != nil || received != 1 {
+		t.Errorf("with WEBHOOK_ALLOW_PRIVATE_TARGETS: %v, %d deliveries", err, received)
+	}
+}
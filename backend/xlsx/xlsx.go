@@ -0,0 +1,399 @@
+// Package xlsx reads the cells of one worksheet from an Office Open XML workbook
+//
+// It covers what dataset uploads need: shared, inline, and formula strings (formulas
+// yield their cached values), booleans, numbers, and dates stored as serial numbers
+// under a date number format. Workbooks are read with the standard library's zip and
+// XML decoders.
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrEncrypted is returned for password-protected workbooks, which Excel saves as
+	// encrypted OLE compound files rather than zip archives. Legacy .xls files share the
+	// OLE container and are rejected the same way
+	ErrEncrypted = errors.New("workbook is password-protected or in the legacy .xls format; save it as an unprotected .xlsx and upload it again")
+	// ErrNotWorkbook is returned when the data isn't an xlsx zip archive
+	ErrNotWorkbook = errors.New("file is not an xlsx workbook")
+)
+
+var (
+	zipMagic = []byte("PK\x03\x04")
+	oleMagic = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+)
+
+// LooksLikeWorkbook reports whether the first bytes of a file are an xlsx (zip) or an
+// encrypted/legacy Excel (OLE) file
+func LooksLikeWorkbook(head []byte) bool {
+	return bytes.HasPrefix(head, zipMagic) || bytes.HasPrefix(head, oleMagic)
+}
+
+// ReadSheet returns the named worksheet (or the first one when sheetName is empty) as
+// rows of cell text. Rows are padded to the same width; missing rows and cells are empty
+func ReadSheet(data []byte, sheetName string) ([][]string, error) {
+	if bytes.HasPrefix(data, oleMagic) {
+		return nil, ErrEncrypted
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrNotWorkbook
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	if files["EncryptionInfo"] != nil {
+		return nil, ErrEncrypted
+	}
+
+	var wb workbook
+	if err := decodeXML(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, ErrNotWorkbook
+	}
+	sheetPath, err := resolveSheet(files, wb, sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	var sst sharedStrings
+	if err := decodeXML(files, "xl/sharedStrings.xml", &sst); err != nil && !errors.Is(err, errMissingPart) {
+		return nil, err
+	}
+	strs := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		strs[i] = item.text()
+	}
+
+	var st styleSheet
+	if err := decodeXML(files, "xl/styles.xml", &st); err != nil && !errors.Is(err, errMissingPart) {
+		return nil, err
+	}
+
+	return readCells(files, sheetPath, strs, st.dateStyles(), wb.Properties.Date1904)
+}
+
+type workbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type richText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (r richText) text() string {
+	if len(r.R) == 0 {
+		return r.T
+	}
+	var sb strings.Builder
+	sb.WriteString(r.T)
+	for _, run := range r.R {
+		sb.WriteString(run.T)
+	}
+	return sb.String()
+}
+
+type sharedStrings struct {
+	Items []richText `xml:"si"`
+}
+
+type styleSheet struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// dateStyles reports, per cell style index, whether numbers in that style are dates
+func (st styleSheet) dateStyles() []bool {
+	custom := make(map[int]string, len(st.NumFmts))
+	for _, f := range st.NumFmts {
+		custom[f.ID] = f.Code
+	}
+	dates := make([]bool, len(st.CellXfs))
+	for i, xf := range st.CellXfs {
+		if code, ok := custom[xf.NumFmtID]; ok {
+			dates[i] = isDateFormat(code)
+		} else {
+			dates[i] = isBuiltinDateFormat(xf.NumFmtID)
+		}
+	}
+	return dates
+}
+
+// isBuiltinDateFormat covers the built-in date and time number formats
+func isBuiltinDateFormat(id int) bool {
+	return (id >= 14 && id <= 22) || (id >= 45 && id <= 47)
+}
+
+// isDateFormat reports whether a custom format code displays a date or time
+func isDateFormat(code string) bool {
+	var sb strings.Builder
+	inQuote, inBracket := false, false
+	for _, r := range code {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case inBracket:
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	stripped := strings.ToLower(sb.String())
+	return strings.ContainsAny(stripped, "dyh")
+}
+
+var errMissingPart = errors.New("workbook part missing")
+
+func decodeXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return errMissingPart
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// resolveSheet finds the zip path of the requested worksheet
+func resolveSheet(files map[string]*zip.File, wb workbook, sheetName string) (string, error) {
+	if len(wb.Sheets) == 0 {
+		return "", fmt.Errorf("workbook has no worksheets")
+	}
+
+	index := 0
+	if sheetName != "" {
+		index = -1
+		for i, sheet := range wb.Sheets {
+			if strings.EqualFold(sheet.Name, sheetName) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			names := make([]string, len(wb.Sheets))
+			for i, sheet := range wb.Sheets {
+				names[i] = sheet.Name
+			}
+			return "", fmt.Errorf("worksheet %q not found; the workbook has: %s", sheetName, strings.Join(names, ", "))
+		}
+	}
+
+	var rels relationships
+	if err := decodeXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Items {
+		if rel.ID != wb.Sheets[index].RID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", fmt.Errorf("worksheet %q has no relationship target", wb.Sheets[index].Name)
+}
+
+type cell struct {
+	Ref    string   `xml:"r,attr"`
+	Type   string   `xml:"t,attr"`
+	Style  int      `xml:"s,attr"`
+	Value  string   `xml:"v"`
+	Inline richText `xml:"is"`
+}
+
+// readCells streams the worksheet XML row by row
+func readCells(files map[string]*zip.File, sheetPath string, strs []string, dateStyles []bool, date1904 bool) ([][]string, error) {
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("worksheet part %s missing", sheetPath)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var rows [][]string
+	width := 0
+	rowIndex := -1
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", sheetPath, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "row":
+			rowIndex++
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "r" {
+					if n, err := strconv.Atoi(attr.Value); err == nil && n-1 >= rowIndex {
+						rowIndex = n - 1
+					}
+				}
+			}
+			for len(rows) <= rowIndex {
+				rows = append(rows, nil)
+			}
+		case "c":
+			var c cell
+			if err := decoder.DecodeElement(&c, &start); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", sheetPath, err)
+			}
+			if rowIndex < 0 {
+				continue
+			}
+			col := len(rows[rowIndex])
+			if c.Ref != "" {
+				if parsed, ok := columnIndex(c.Ref); ok {
+					col = parsed
+				}
+			}
+			for len(rows[rowIndex]) <= col {
+				rows[rowIndex] = append(rows[rowIndex], "")
+			}
+			rows[rowIndex][col] = cellText(c, strs, dateStyles, date1904)
+			if col+1 > width {
+				width = col + 1
+			}
+		}
+	}
+
+	// Drop trailing empty rows, then pad every row to the same width
+	for len(rows) > 0 && isEmptyRow(rows[len(rows)-1]) {
+		rows = rows[:len(rows)-1]
+	}
+	for i := range rows {
+		for len(rows[i]) < width {
+			rows[i] = append(rows[i], "")
+		}
+	}
+	return rows, nil
+}
+
+func isEmptyRow(row []string) bool {
+	for _, v := range row {
+		if v != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// columnIndex converts the letters of a cell reference ("AB12") to a 0-based column
+func columnIndex(ref string) (int, bool) {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+	}
+	return col - 1, n > 0
+}
+
+// cellText renders a cell's value; formula cells carry their cached value in <v>
+func cellText(c cell, strs []string, dateStyles []bool, date1904 bool) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(strs) {
+			return ""
+		}
+		return strs[i]
+	case "inlineStr":
+		return c.Inline.text()
+	case "b":
+		if c.Value == "1" {
+			return "true"
+		}
+		return "false"
+	case "str", "e":
+		return c.Value
+	}
+
+	// Numbers, possibly dates
+	if c.Value == "" || c.Style < 0 || c.Style >= len(dateStyles) || !dateStyles[c.Style] {
+		return c.Value
+	}
+	serial, err := strconv.ParseFloat(c.Value, 64)
+	if err != nil {
+		return c.Value
+	}
+	return SerialToTime(serial, date1904).Format(dateLayout(serial))
+}
+
+func dateLayout(serial float64) string {
+	if serial == math.Trunc(serial) {
+		return "2006-01-02"
+	}
+	if serial < 1 {
+		return "15:04:05" // A bare time of day
+	}
+	return "2006-01-02 15:04:05"
+}
+
+// SerialToTime converts an Excel serial date to a time. The 1900 system counts from
+// 1899-12-30, which absorbs Excel's fictitious 1900-02-29 for every date after it
+func SerialToTime(serial float64, date1904 bool) time.Time {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+	return epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+}
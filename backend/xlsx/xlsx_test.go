@@ -0,0 +1,173 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	workbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<workbookPr%s/><sheets><sheet name="Summary" sheetId="1" r:id="rId1"/><sheet name="Data" sheetId="2" r:id="rId2"/></sheets></workbook>`
+	workbookRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`
+	sharedStringsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="3" uniqueCount="3">
+<si><t>name</t></si><si><t>alpha</t></si><si><r><t>be</t></r><r><rPr><b/></rPr><t>ta</t></r></si></sst>`
+	// Styles: 0 general, 1 built-in date (14), 2 custom date-time, 3 custom number whose
+	// quoted literal holds a d, 4 custom time behind a locale tag
+	stylesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="3"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd\ hh:mm"/><numFmt numFmtId="165" formatCode="0.00&quot; days&quot;"/><numFmt numFmtId="166" formatCode="[$-409]h:mm:ss;@"/></numFmts>
+<cellXfs count="5"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="165"/><xf numFmtId="166"/></cellXfs></styleSheet>`
+	summaryXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1"><v>1</v></c></row></sheetData></worksheet>`
+	dataXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>note</t></is></c><c r="C1" t="inlineStr"><is><r><t>when</t></r><r><t>_at</t></r></is></c><c r="D1" t="inlineStr"><is><t>score</t></is></c></row>
+<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2" t="str"><f>UPPER(A2)</f><v>ALPHA</v></c><c r="C2" s="1"><v>45000</v></c><c r="D2"><f>1+1.5</f><v>2.5</v></c></row>
+<row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3" t="b"><v>1</v></c><c r="C3" s="2"><v>45000.5</v></c><c r="D3" s="3"><v>3</v></c></row>
+<row r="5"><c r="B5" t="e"><v>#DIV/0!</v></c><c r="C5" s="4"><v>0.75</v></c></row>
+<row r="6"><c r="A6" t="s"><v>99</v></c><c r="D6"><v>7</v></c></row>
+<row r="7"></row>
+</sheetData></worksheet>`
+)
+
+// buildWorkbook zips parts into a workbook, by their paths within the archive
+func buildWorkbook(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close workbook: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testWorkbook is the Summary and Data fixture workbook; workbookPr gets properties when
+// they aren't empty
+func testWorkbook(t *testing.T, properties string) []byte {
+	t.Helper()
+	if properties != "" {
+		properties = " " + properties
+	}
+	return buildWorkbook(t, map[string]string{
+		"[Content_Types].xml":        `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+		"xl/workbook.xml":            strings.Replace(workbookXML, "%s", properties, 1),
+		"xl/_rels/workbook.xml.rels": workbookRelsXML,
+		"xl/sharedStrings.xml":       sharedStringsXML,
+		"xl/styles.xml":              stylesXML,
+		"xl/worksheets/sheet1.xml":   summaryXML,
+		"xl/worksheets/sheet2.xml":   dataXML,
+	})
+}
+
+func TestReadSheetRendersEveryCellType(t *testing.T) {
+	rows, err := ReadSheet(testWorkbook(t, ""), "data")
+	if err != nil {
+		t.Fatalf("ReadSheet: %v", err)
+	}
+	want := [][]string{
+		{"name", "note", "when_at", "score"},
+		{"alpha", "ALPHA", "2023-03-15", "2.5"},      // Formulas give their cached values
+		{"beta", "true", "2023-03-15 12:00:00", "3"}, // A quoted d isn't a date format
+		{"", "", "", ""},                             // Skipped row 4
+		{"", "#DIV/0!", "18:00:00", ""},
+		{"", "", "", "7"}, // A shared string index out of range is empty; trailing empty rows go
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows\n%q\nwant\n%q", rows, want)
+	}
+}
+
+func TestReadSheetPicksTheSheet(t *testing.T) {
+	rows, err := ReadSheet(testWorkbook(t, ""), "")
+	if err != nil || !reflect.DeepEqual(rows, [][]string{{"1"}}) {
+		t.Errorf("first sheet = %q, %v, want the Summary sheet", rows, err)
+	}
+
+	_, err = ReadSheet(testWorkbook(t, ""), "Missing")
+	if err == nil || !strings.Contains(err.Error(), "Summary, Data") {
+		t.Errorf("missing sheet error %v, want it to list the sheets", err)
+	}
+}
+
+func TestReadSheetUses1904Dates(t *testing.T) {
+	rows, err := ReadSheet(testWorkbook(t, `date1904="1"`), "Data")
+	if err != nil {
+		t.Fatalf("ReadSheet: %v", err)
+	}
+	// The 1904 system counts 1462 days later
+	if rows[1][2] != "2027-03-16" {
+		t.Errorf("1904 date = %q, want 2027-03-16", rows[1][2])
+	}
+}
+
+func TestReadSheetRejectsFilesThatArentWorkbooks(t *testing.T) {
+	ole := append([]byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}, make([]byte, 504)...)
+	cases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"encrypted or legacy .xls (OLE)", ole, ErrEncrypted},
+		{"zip holding EncryptionInfo", buildWorkbook(t, map[string]string{"EncryptionInfo": "x", "EncryptedPackage": "x"}), ErrEncrypted},
+		{"plain text", []byte("id,name\n1,alpha\n"), ErrNotWorkbook},
+		{"zip without a workbook", buildWorkbook(t, map[string]string{"word/document.xml": "<document/>"}), ErrNotWorkbook},
+		{"truncated workbook", testWorkbook(t, "")[:200], ErrNotWorkbook},
+	}
+	for _, tc := range cases {
+		if _, err := ReadSheet(tc.data, ""); !errors.Is(err, tc.err) {
+			t.Errorf("%s: %v, want %v", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestLooksLikeWorkbook(t *testing.T) {
+	if !LooksLikeWorkbook(testWorkbook(t, "")) {
+		t.Error("an xlsx zip wasn't recognized")
+	}
+	if !LooksLikeWorkbook([]byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1, 0}) {
+		t.Error("an OLE file wasn't recognized")
+	}
+	if LooksLikeWorkbook([]byte("id,name\n")) {
+		t.Error("CSV text was taken for a workbook")
+	}
+}
+
+func TestSerialToTime(t *testing.T) {
+	cases := []struct {
+		serial   float64
+		date1904 bool
+		want     time.Time
+	}{
+		{61, false, time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC)}, // Past Excel's fictitious 1900-02-29
+		{45000.25, false, time.Date(2023, 3, 15, 6, 0, 0, 0, time.UTC)},
+		{0.5, false, time.Date(1899, 12, 30, 12, 0, 0, 0, time.UTC)},
+		{0, true, time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{43538, true, time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		if got := SerialToTime(tc.serial, tc.date1904); !got.Equal(tc.want) {
+			t.Errorf("SerialToTime(%g, %t) = %s, want %s", tc.serial, tc.date1904, got, tc.want)
+		}
+	}
+}
@@ -30,7 +30,7 @@ export function CSVUpload({ account }: CSVUploadProps) {
     const [uploading, setUploading] = useState(false);
     const fileInputRef = useRef<HTMLInputElement>(null);
 
-    const { signAndSubmitTransaction } = useWallet();
+    const { signAndSubmitTransaction, signMessage, account: wallet } = useWallet();
 
     const handleFileSelect = async (e: React.ChangeEvent<HTMLInputElement>) => {
         const selectedFile = e.target.files?.[0];
@@ -81,7 +81,7 @@ export function CSVUpload({ account }: CSVUploadProps) {
     };
 
     const handleSubmit = async () => {
-        if (!csvData || !schema || !account) {
+        if (!csvData || !schema || !account || !file) {
             toast.error("Please upload a CSV file first");
             return;
         }
@@ -94,9 +94,27 @@ export function CSVUpload({ account }: CSVUploadProps) {
         setUploading(true);
 
         try {
-            // Use the pre-generated hash (or generate if not set)
-            const hash = dataHash || (await generateDataHash(csvData));
-            if (!dataHash) {
+            // The backend only stores uploads the account signed for
+            const challenge = await apiClient.getAuthChallenge(account);
+            const signed = await signMessage({ message: challenge.message, nonce: challenge.nonce });
+            const publicKey = wallet?.publicKey;
+
+            // Upload first: the backend hashes the bytes it stores, and that hash is the one
+            // registered on chain so downloads can be verified against it. The hash shown
+            // while parsing is computed differently, so it isn't sent for comparison
+            const upload = await apiClient.submitCSV(
+                account,
+                {
+                    nonce: challenge.nonce,
+                    signed_message: signed.fullMessage,
+                    public_key: String(Array.isArray(publicKey) ? publicKey[0] : publicKey),
+                    signature: String(signed.signature),
+                },
+                file,
+                schema
+            );
+            const hash = upload.data_hash;
+            if (hash !== dataHash) {
                 setDataHash(hash);
             }
 
@@ -131,16 +149,6 @@ export function CSVUpload({ account }: CSVUploadProps) {
             // Sign and submit transaction
             const response = await signAndSubmitTransaction(transaction);
 
-            // Also send to backend for processing (send the actual file)
-            try {
-                if (file) {
-                    await apiClient.submitCSV(account, file, schema, hash);
-                }
-            } catch (backendError) {
-                console.warn("Backend submission failed:", backendError);
-                // Transaction is already on-chain, so this is not critical
-            }
-
             toast.success(`Data submitted! Transaction: ${response.hash}`);
 
             // Reset
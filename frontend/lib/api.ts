@@ -22,6 +22,48 @@ export interface DatasetInfo {
     is_active: boolean;
 }
 
+export interface SubmitCSVResult {
+    account_address: string;
+    data_hash: string; // Server-computed hash of the stored CSV; use it in submit_data
+    client_data_hash: string;
+    content_hash: string;
+    row_count: number;
+    column_count: number;
+    schema: any;
+    schema_inferred: boolean;
+    cid?: string; // Set when data_hash is the digest of the blob's IPFS CID
+}
+
+// A wallet's signature of a message carrying a nonce from /auth/challenge
+export interface WalletSignature {
+    nonce: string;
+    signed_message: string; // Exact text the wallet signed
+    public_key: string;
+    signature: string;
+}
+
+export interface AuthChallenge {
+    address: string;
+    nonce: string;
+    message: string;
+    expires_at: number;
+}
+
+export interface CSVViolation {
+    row: number;
+    column?: string;
+    message: string;
+}
+
+export interface CSVValidationReport {
+    valid: boolean;
+    row_count: number;
+    column_count: number;
+    columns: string[] | null;
+    violations: CSVViolation[];
+    truncated?: boolean;
+}
+
 export interface VaultInfo {
     datasets: number[];
     count: number;
@@ -65,10 +107,29 @@ class ApiClient {
         return response.data!;
     }
 
-    async submitCSV(accountAddress: string, csvFile: File, schema: any, dataHash: string): Promise<TransactionResponse> {
+    async getAuthChallenge(address: string): Promise<AuthChallenge> {
+        const response = await this.request<AuthChallenge>("/api/v1/auth/challenge", {
+            method: "POST",
+            body: JSON.stringify({ address }),
+        });
+        return response.data!;
+    }
+
+    // signature is the account's signature of a challenge; useCidHash asks an IPFS-backed server
+    // to return the CID digest as data_hash
+    async submitCSV(accountAddress: string, signature: WalletSignature, csvFile: File, schema: any, dataHash?: string, useCidHash?: boolean): Promise<SubmitCSVResult> {
         const formData = new FormData();
         formData.append("account_address", accountAddress);
-        formData.append("data_hash", dataHash);
+        formData.append("nonce", signature.nonce);
+        formData.append("signed_message", signature.signed_message);
+        formData.append("public_key", signature.public_key);
+        formData.append("signature", signature.signature);
+        if (dataHash) {
+            formData.append("data_hash", dataHash);
+        }
+        if (useCidHash) {
+            formData.append("use_cid_hash", "true");
+        }
         formData.append("schema", JSON.stringify(schema));
         formData.append("csv_file", csvFile); // Send the actual file
 
@@ -86,6 +147,25 @@ class ApiClient {
         return result.data!;
     }
 
+    // Pre-flight a CSV: runs the upload validation without storing anything
+    async validateCSV(csvFile: File): Promise<CSVValidationReport> {
+        const formData = new FormData();
+        formData.append("validate_only", "true");
+        formData.append("csv_file", csvFile);
+
+        const response = await fetch(`${this.baseUrl}/api/v1/data/submit-csv`, {
+            method: "POST",
+            body: formData,
+        });
+
+        const result = await response.json().catch(() => ({ error: "Request failed" }));
+        // 422 still carries the report; only other failures are errors
+        if (!response.ok && response.status !== 422) {
+            throw new Error(result.error || `HTTP error! status: ${response.status}`);
+        }
+        return result.data!;
+    }
+
     async getDataset(user: string, datasetId: number): Promise<DatasetInfo> {
         // Ensure datasetId is a valid number
         const numericId = typeof datasetId === "string" ? parseInt(datasetId, 10) : Number(datasetId);
@@ -166,16 +246,16 @@ class ApiClient {
         });
     }
 
-    async checkDataHash(dataHash: string): Promise<boolean> {
+    async checkDataHash(dataHash: string, owner?: string): Promise<boolean> {
         try {
             const response = await fetch(`${API_BASE_URL}/api/v1/data/check-hash`, {
                 method: "POST",
                 headers: { "Content-Type": "application/json" },
-                body: JSON.stringify({ data_hash: dataHash }),
+                body: JSON.stringify({ data_hash: dataHash, owner }),
             });
             const result = await response.json();
             if (!result.success) throw new Error(result.error);
-            return result.data;
+            return Boolean(result.data?.exists);
         } catch (error) {
             console.error("Failed to check data hash:", error);
             return false; // Assume not exists on error to allow submission attempt (or handle differently)
@@ -1,6 +1,8 @@
 module aptos_data_network::AccessControl {
     use std::vector;
     use std::signer;
+    use aptos_framework::account;
+    use aptos_framework::event;
 
     struct Access has store, drop {
         dataset_id: u64,
@@ -12,12 +14,62 @@ module aptos_data_network::AccessControl {
         entries: vector<Access>
     }
 
+    /// Event emitted on the owner's account when someone asks for access
+    struct AccessRequested has copy, drop, store {
+        owner: address,
+        requester: address,
+        dataset_id: u64,
+        message: vector<u8>,
+        requested_at: u64
+    }
+
+    /// Holds the owner's access request event handle
+    struct AccessRequests has key {
+        request_events: event::EventHandle<AccessRequested>
+    }
+
     /// Initialize access control for a user
     public entry fun init(owner: &signer) {
         let owner_addr = signer::address_of(owner);
         if (!exists<AccessList>(owner_addr)) {
             move_to(owner, AccessList { entries: vector::empty() });
         };
+        if (!exists<AccessRequests>(owner_addr)) {
+            move_to(
+                owner,
+                AccessRequests {
+                    request_events: account::new_event_handle<AccessRequested>(owner)
+                }
+            );
+        };
+    }
+
+    #[test_only]
+    /// Gives owner only an AccessList, the state of owners initialized before AccessRequests
+    public fun init_access_list_for_test(owner: &signer) {
+        move_to(owner, AccessList { entries: vector::empty() });
+    }
+
+    /// Request access to an owner's dataset (owner must have called init)
+    public entry fun request_access(
+        requester: &signer,
+        owner: address,
+        dataset_id: u64,
+        message: vector<u8>
+    ) acquires AccessRequests {
+        assert!(exists<AccessRequests>(owner), 1); // Owner not initialized
+
+        let requests = borrow_global_mut<AccessRequests>(owner);
+        event::emit_event(
+            &mut requests.request_events,
+            AccessRequested {
+                owner,
+                requester: signer::address_of(requester),
+                dataset_id,
+                message,
+                requested_at: aptos_framework::timestamp::now_seconds()
+            }
+        );
     }
 
     /// Grant access to a requester for a specific dataset with expiration
@@ -29,10 +81,9 @@ module aptos_data_network::AccessControl {
     ) acquires AccessList {
         let owner_addr = signer::address_of(owner);
 
-        // Ensure initialized
-        if (!exists<AccessList>(owner_addr)) {
-            init(owner);
-        };
+        // Ensure initialized; init creates each resource that is missing, so owners from
+        // before AccessRequests existed get it on their next grant
+        init(owner);
 
         let list = borrow_global_mut<AccessList>(owner_addr);
 
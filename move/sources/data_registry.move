@@ -18,6 +18,19 @@ module datax::data_registry {
         dataset_id: u64
     }
 
+    /// Module event emitted when a deleted dataset is reactivated. DataStore's event handles
+    /// can't grow without breaking upgrade compatibility, so this one isn't handle-based
+    #[event]
+    struct DataReactivated has drop, store {
+        user: address,
+        dataset_id: u64
+    }
+
+    /// The dataset isn't in the owner's DataStore
+    const E_DATASET_NOT_FOUND: u64 = 2;
+    /// The dataset to reactivate was never deleted
+    const E_DATASET_ACTIVE: u64 = 4;
+
     /// Dataset information stored on-chain
     struct Dataset has store {
         id: u64,
@@ -164,6 +177,34 @@ module datax::data_registry {
         abort 3 // Dataset not found or not owned by user
     }
 
+    /// Reactivate a deleted dataset, undoing delete_dataset
+    public entry fun reactivate_dataset(user: &signer, dataset_id: u64) acquires DataStore {
+        let user_addr = signer::address_of(user);
+        assert!(exists<DataStore>(user_addr), E_DATASET_NOT_FOUND);
+        let store = borrow_global_mut<DataStore>(user_addr);
+        let datasets = &mut store.datasets;
+        let len = vector::length(datasets);
+
+        let i = 0;
+        while (i < len) {
+            let dataset = vector::borrow_mut(datasets, i);
+            if (dataset.id == dataset_id && dataset.owner == user_addr) {
+                assert!(!dataset.is_active, E_DATASET_ACTIVE);
+                dataset.is_active = true;
+
+                event::emit(DataReactivated { user: user_addr, dataset_id });
+
+                // Put it back in the vault delete_dataset took it out of
+                UserVault::init(user);
+                UserVault::add_dataset(user, dataset_id);
+                return
+            };
+            i = i + 1;
+        };
+
+        abort E_DATASET_NOT_FOUND
+    }
+
     /// Get number of datasets for a user
     public fun get_dataset_count(user: address): u64 acquires DataStore {
         if (!exists<DataStore>(user)) {
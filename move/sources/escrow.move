@@ -0,0 +1,188 @@
+module aptos_data_network::Escrow {
+    use std::signer;
+    use std::vector;
+    use aptos_framework::aptos_account;
+    use aptos_framework::aptos_coin::AptosCoin;
+    use aptos_framework::coin::{Self, Coin};
+    use aptos_framework::event;
+    use aptos_framework::timestamp;
+    use aptos_data_network::AccessControl;
+
+    /// The requester has no deposit for the owner's dataset
+    const E_DEPOSIT_NOT_FOUND: u64 = 1;
+    /// A deposit must hold some APT
+    const E_ZERO_AMOUNT: u64 = 2;
+    /// The owner still has time to release the deposit
+    const E_REFUND_TOO_EARLY: u64 = 3;
+
+    /// Seconds the owner has to release a deposit before the requester can take it back
+    const REFUND_TIMEOUT_SECS: u64 = 604800;
+
+    /// APT a requester put up for access to one of an owner's datasets
+    struct Deposit has store {
+        owner: address,
+        dataset_id: u64,
+        funds: Coin<AptosCoin>,
+        deposited_at: u64
+    }
+
+    /// The deposits a requester has made, held on the requester's account until the owner
+    /// releases them or, once REFUND_TIMEOUT_SECS have passed, the requester takes them back
+    struct Deposits has key {
+        entries: vector<Deposit>
+    }
+
+    #[event]
+    struct EscrowDeposited has drop, store {
+        owner: address,
+        requester: address,
+        dataset_id: u64,
+        amount: u64
+    }
+
+    #[event]
+    struct EscrowReleased has drop, store {
+        owner: address,
+        requester: address,
+        dataset_id: u64,
+        amount: u64,
+        expires_at: u64
+    }
+
+    #[event]
+    struct EscrowRefunded has drop, store {
+        owner: address,
+        requester: address,
+        dataset_id: u64,
+        amount: u64
+    }
+
+    /// Put amount octas of APT in escrow for access to an owner's dataset. Depositing again
+    /// for the same dataset adds to the deposit and restarts the refund timeout
+    public entry fun deposit(
+        requester: &signer,
+        owner: address,
+        dataset_id: u64,
+        amount: u64
+    ) acquires Deposits {
+        assert!(amount > 0, E_ZERO_AMOUNT);
+        let requester_addr = signer::address_of(requester);
+        if (!exists<Deposits>(requester_addr)) {
+            move_to(requester, Deposits { entries: vector::empty() });
+        };
+
+        let funds = coin::withdraw<AptosCoin>(requester, amount);
+        let deposits = borrow_global_mut<Deposits>(requester_addr);
+        let (found, i) = find(&deposits.entries, owner, dataset_id);
+        if (found) {
+            let entry = vector::borrow_mut(&mut deposits.entries, i);
+            coin::merge(&mut entry.funds, funds);
+            entry.deposited_at = timestamp::now_seconds();
+        } else {
+            vector::push_back(
+                &mut deposits.entries,
+                Deposit {
+                    owner,
+                    dataset_id,
+                    funds,
+                    deposited_at: timestamp::now_seconds()
+                }
+            );
+        };
+
+        event::emit(
+            EscrowDeposited { owner, requester: requester_addr, dataset_id, amount }
+        );
+    }
+
+    /// The owner collects a requester's deposit for one of their datasets and grants them access
+    /// until expires_at, in one transaction: the funds never move without the grant
+    public entry fun release(
+        owner: &signer,
+        dataset_id: u64,
+        requester: address,
+        expires_at: u64
+    ) acquires Deposits {
+        let owner_addr = signer::address_of(owner);
+        let funds = take(requester, owner_addr, dataset_id);
+        let amount = coin::value(&funds);
+        aptos_account::deposit_coins(owner_addr, funds);
+        AccessControl::grant_access(owner, dataset_id, requester, expires_at);
+
+        event::emit(
+            EscrowReleased { owner: owner_addr, requester, dataset_id, amount, expires_at }
+        );
+    }
+
+    /// The requester takes back a deposit the owner hasn't released within REFUND_TIMEOUT_SECS
+    public entry fun refund(
+        requester: &signer, owner: address, dataset_id: u64
+    ) acquires Deposits {
+        let requester_addr = signer::address_of(requester);
+        assert!(
+            timestamp::now_seconds() >= refundable_at(owner, dataset_id, requester_addr),
+            E_REFUND_TOO_EARLY
+        );
+        let funds = take(requester_addr, owner, dataset_id);
+        let amount = coin::value(&funds);
+        aptos_account::deposit_coins(requester_addr, funds);
+
+        event::emit(
+            EscrowRefunded { owner, requester: requester_addr, dataset_id, amount }
+        );
+    }
+
+    #[view]
+    /// Octas a requester holds in escrow for an owner's dataset (0 without a deposit)
+    public fun balance(
+        owner: address, dataset_id: u64, requester: address
+    ): u64 acquires Deposits {
+        if (!exists<Deposits>(requester)) {
+            return 0
+        };
+        let deposits = borrow_global<Deposits>(requester);
+        let (found, i) = find(&deposits.entries, owner, dataset_id);
+        if (!found) {
+            return 0
+        };
+        coin::value(&vector::borrow(&deposits.entries, i).funds)
+    }
+
+    #[view]
+    /// Unix seconds from which the requester can take their deposit back
+    public fun refundable_at(
+        owner: address, dataset_id: u64, requester: address
+    ): u64 acquires Deposits {
+        assert!(exists<Deposits>(requester), E_DEPOSIT_NOT_FOUND);
+        let deposits = borrow_global<Deposits>(requester);
+        let (found, i) = find(&deposits.entries, owner, dataset_id);
+        assert!(found, E_DEPOSIT_NOT_FOUND);
+        vector::borrow(&deposits.entries, i).deposited_at + REFUND_TIMEOUT_SECS
+    }
+
+    /// Remove a deposit and return its funds
+    fun take(requester: address, owner: address, dataset_id: u64): Coin<AptosCoin> acquires Deposits {
+        assert!(exists<Deposits>(requester), E_DEPOSIT_NOT_FOUND);
+        let deposits = borrow_global_mut<Deposits>(requester);
+        let (found, i) = find(&deposits.entries, owner, dataset_id);
+        assert!(found, E_DEPOSIT_NOT_FOUND);
+
+        let Deposit { owner: _, dataset_id: _, funds, deposited_at: _ } =
+            vector::remove(&mut deposits.entries, i);
+        funds
+    }
+
+    /// Index of the deposit for an owner's dataset
+    fun find(entries: &vector<Deposit>, owner: address, dataset_id: u64): (bool, u64) {
+        let i = 0;
+        let len = vector::length(entries);
+        while (i < len) {
+            let entry = vector::borrow(entries, i);
+            if (entry.owner == owner && entry.dataset_id == dataset_id) {
+                return (true, i)
+            };
+            i = i + 1;
+        };
+        (false, 0)
+    }
+}
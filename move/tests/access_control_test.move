@@ -176,5 +176,93 @@ module aptos_data_network::access_control_test {
         let access_list = AccessControl::get_access_list(OWNER, 0);
         assert!(vector::length(&access_list) == 0, 15);
     }
-}
 
+    #[test]
+    fun test_access_expiry_boundary() {
+        let aptos_framework = account::create_account_for_test(@aptos_framework);
+        setup_timestamp(&aptos_framework);
+        let owner = setup_owner();
+        AccessControl::init(&owner);
+
+        timestamp::update_global_time_for_test_secs(1000);
+        AccessControl::grant_access(&owner, 0, REQUESTER1, 2000);
+
+        // A grant lasts through its expires_at second
+        timestamp::update_global_time_for_test_secs(2000);
+        assert!(
+            AccessControl::has_access(OWNER, 0, REQUESTER1) == true,
+            17
+        );
+        assert!(vector::length(&AccessControl::get_access_list(OWNER, 0)) == 1, 18);
+
+        // And ends the second after
+        timestamp::update_global_time_for_test_secs(2001);
+        assert!(
+            AccessControl::has_access(OWNER, 0, REQUESTER1) == false,
+            19
+        );
+        assert!(vector::length(&AccessControl::get_access_list(OWNER, 0)) == 0, 20);
+    }
+
+    #[test]
+    fun test_access_without_expiry() {
+        let aptos_framework = account::create_account_for_test(@aptos_framework);
+        setup_timestamp(&aptos_framework);
+        let owner = setup_owner();
+        AccessControl::init(&owner);
+
+        // The backend sends the largest deadline for grants that never expire
+        AccessControl::grant_access(&owner, 0, REQUESTER1, 18446744073709551615);
+
+        timestamp::update_global_time_for_test_secs(4102444800); // 2100-01-01
+        assert!(
+            AccessControl::has_access(OWNER, 0, REQUESTER1) == true,
+            21
+        );
+    }
+
+    #[test]
+    fun test_request_access() {
+        let aptos_framework = account::create_account_for_test(@aptos_framework);
+        setup_timestamp(&aptos_framework);
+        let owner = setup_owner();
+        AccessControl::init(&owner);
+
+        let requester = account::create_account_for_test(REQUESTER1);
+        AccessControl::request_access(&requester, OWNER, 0, b"please");
+
+        // Requesting access does not grant it
+        assert!(
+            AccessControl::has_access(OWNER, 0, REQUESTER1) == false,
+            16
+        );
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 1, location = aptos_data_network::AccessControl)]
+    fun test_request_access_uninitialized_owner() {
+        let aptos_framework = account::create_account_for_test(@aptos_framework);
+        setup_timestamp(&aptos_framework);
+
+        let requester = account::create_account_for_test(REQUESTER1);
+        AccessControl::request_access(&requester, OWNER, 0, b"please");
+    }
+
+    #[test]
+    fun test_grant_access_initializes_requests_for_existing_owner() {
+        let aptos_framework = account::create_account_for_test(@aptos_framework);
+        setup_timestamp(&aptos_framework);
+        let owner = setup_owner();
+        AccessControl::init_access_list_for_test(&owner);
+
+        AccessControl::grant_access(&owner, 0, REQUESTER2, timestamp::now_seconds() + 3600);
+
+        // The grant gave the owner the request event handle, so requests no longer abort
+        let requester = account::create_account_for_test(REQUESTER1);
+        AccessControl::request_access(&requester, OWNER, 0, b"please");
+        assert!(
+            AccessControl::has_access(OWNER, 0, REQUESTER2) == true,
+            17
+        );
+    }
+}
@@ -3,6 +3,7 @@ module datax::data_registry_test {
     use aptos_framework::account;
     use aptos_framework::timestamp;
     use datax::data_registry;
+    use aptos_data_network::UserVault;
 
     const ADMIN: address = @0x1;
     const USER1: address = @0x2;
@@ -101,6 +102,52 @@ module datax::data_registry_test {
         assert!(data_registry::get_dataset_count(USER1) == 2, 12);
     }
 
+    #[test]
+    fun test_reactivate_dataset() {
+        let aptos_framework = account::create_account_for_test(@aptos_framework);
+        setup_timestamp(&aptos_framework);
+        let user = setup_user1();
+        data_registry::init(&user);
+
+        data_registry::submit_data(&user, b"hash1", b"meta1");
+        data_registry::delete_dataset(&user, 0);
+        data_registry::reactivate_dataset(&user, 0);
+
+        // Verify it's active and back in the vault
+        let (hash, _, _, is_active) = data_registry::get_dataset(USER1, 0);
+        assert!(is_active == true, 14);
+        assert!(hash == b"hash1", 15);
+        assert!(UserVault::has_dataset(USER1, 0), 16);
+
+        // It can be deleted again
+        data_registry::delete_dataset(&user, 0);
+        let (_, _, _, is_active) = data_registry::get_dataset(USER1, 0);
+        assert!(is_active == false, 17);
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 4, location = data_registry)]
+    fun test_reactivate_active_dataset() {
+        let aptos_framework = account::create_account_for_test(@aptos_framework);
+        setup_timestamp(&aptos_framework);
+        let user = setup_user1();
+        data_registry::init(&user);
+
+        data_registry::submit_data(&user, b"hash1", b"meta1");
+
+        // Never deleted - should fail
+        data_registry::reactivate_dataset(&user, 0);
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 2, location = data_registry)]
+    fun test_reactivate_nonexistent_dataset() {
+        let user = setup_user1();
+        data_registry::init(&user);
+
+        data_registry::reactivate_dataset(&user, 999);
+    }
+
     #[test]
     #[expected_failure(abort_code = 3, location = data_registry)]
     fun test_delete_dataset_not_owner() {
@@ -0,0 +1,157 @@
+#[test_only]
+module aptos_data_network::escrow_test {
+    use aptos_framework::account;
+    use aptos_framework::aptos_coin::{Self, AptosCoin};
+    use aptos_framework::coin;
+    use aptos_framework::timestamp;
+    use aptos_data_network::AccessControl;
+    use aptos_data_network::Escrow;
+
+    const OWNER: address = @0x100;
+    const REQUESTER: address = @0x200;
+    const REFUND_TIMEOUT_SECS: u64 = 604800;
+
+    /// Start the clock and fund the requester with 1000 octas
+    fun setup(): (signer, signer) {
+        let aptos_framework = account::create_account_for_test(@aptos_framework);
+        timestamp::set_time_has_started_for_testing(&aptos_framework);
+        let (burn_cap, mint_cap) = aptos_coin::initialize_for_test(&aptos_framework);
+
+        let owner = account::create_account_for_test(OWNER);
+        let requester = account::create_account_for_test(REQUESTER);
+        coin::register<AptosCoin>(&owner);
+        coin::register<AptosCoin>(&requester);
+        coin::deposit(REQUESTER, coin::mint(1000, &mint_cap));
+
+        coin::destroy_burn_cap(burn_cap);
+        coin::destroy_mint_cap(mint_cap);
+        (owner, requester)
+    }
+
+    #[test]
+    fun test_deposit() {
+        let (_owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 300);
+
+        assert!(Escrow::balance(OWNER, 0, REQUESTER) == 300, 1);
+        assert!(Escrow::balance(OWNER, 1, REQUESTER) == 0, 2);
+        assert!(coin::balance<AptosCoin>(REQUESTER) == 700, 3);
+    }
+
+    #[test]
+    fun test_deposit_twice_adds_up() {
+        let (_owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 300);
+        Escrow::deposit(&requester, OWNER, 0, 200);
+        Escrow::deposit(&requester, OWNER, 1, 100);
+
+        assert!(Escrow::balance(OWNER, 0, REQUESTER) == 500, 1);
+        assert!(Escrow::balance(OWNER, 1, REQUESTER) == 100, 2);
+    }
+
+    #[test]
+    fun test_release() {
+        let (owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 300);
+        Escrow::release(&owner, 0, REQUESTER, timestamp::now_seconds() + 3600);
+
+        assert!(Escrow::balance(OWNER, 0, REQUESTER) == 0, 1);
+        assert!(coin::balance<AptosCoin>(OWNER) == 300, 2);
+        assert!(coin::balance<AptosCoin>(REQUESTER) == 700, 3);
+    }
+
+    #[test]
+    fun test_release_grants_access() {
+        let (owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 300);
+        assert!(!AccessControl::has_access(OWNER, 0, REQUESTER), 1);
+
+        Escrow::release(&owner, 0, REQUESTER, timestamp::now_seconds() + 3600);
+        assert!(AccessControl::has_access(OWNER, 0, REQUESTER), 2);
+        assert!(!AccessControl::has_access(OWNER, 1, REQUESTER), 3);
+
+        timestamp::fast_forward_seconds(3601);
+        assert!(!AccessControl::has_access(OWNER, 0, REQUESTER), 4);
+    }
+
+    #[test]
+    fun test_refund_after_timeout() {
+        let (_owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 300);
+        assert!(Escrow::refundable_at(OWNER, 0, REQUESTER) == timestamp::now_seconds() + REFUND_TIMEOUT_SECS, 1);
+
+        timestamp::fast_forward_seconds(REFUND_TIMEOUT_SECS);
+        Escrow::refund(&requester, OWNER, 0);
+
+        assert!(Escrow::balance(OWNER, 0, REQUESTER) == 0, 2);
+        assert!(coin::balance<AptosCoin>(REQUESTER) == 1000, 3);
+        assert!(coin::balance<AptosCoin>(OWNER) == 0, 4);
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 3, location = aptos_data_network::Escrow)]
+    fun test_refund_before_timeout() {
+        let (_owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 300);
+        timestamp::fast_forward_seconds(REFUND_TIMEOUT_SECS - 1);
+        Escrow::refund(&requester, OWNER, 0);
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 3, location = aptos_data_network::Escrow)]
+    fun test_deposit_again_restarts_timeout() {
+        let (_owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 300);
+        timestamp::fast_forward_seconds(REFUND_TIMEOUT_SECS - 10);
+        Escrow::deposit(&requester, OWNER, 0, 100);
+        timestamp::fast_forward_seconds(20);
+        Escrow::refund(&requester, OWNER, 0);
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 1, location = aptos_data_network::Escrow)]
+    fun test_refundable_at_without_deposit() {
+        let (_owner, _requester) = setup();
+        Escrow::refundable_at(OWNER, 0, REQUESTER);
+    }
+
+    #[test]
+    fun test_balance_without_deposits() {
+        let (_owner, _requester) = setup();
+        assert!(Escrow::balance(OWNER, 0, REQUESTER) == 0, 1);
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 1, location = aptos_data_network::Escrow)]
+    fun test_release_without_deposit() {
+        let (owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 1, 300);
+        Escrow::release(&owner, 0, REQUESTER, 3600);
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 1, location = aptos_data_network::Escrow)]
+    fun test_release_twice() {
+        let (owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 300);
+        Escrow::release(&owner, 0, REQUESTER, 3600);
+        Escrow::release(&owner, 0, REQUESTER, 3600);
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 1, location = aptos_data_network::Escrow)]
+    fun test_refund_after_release() {
+        let (owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 300);
+        Escrow::release(&owner, 0, REQUESTER, 3600);
+        timestamp::fast_forward_seconds(REFUND_TIMEOUT_SECS);
+        Escrow::refund(&requester, OWNER, 0);
+    }
+
+    #[test]
+    #[expected_failure(abort_code = 2, location = aptos_data_network::Escrow)]
+    fun test_deposit_zero() {
+        let (_owner, requester) = setup();
+        Escrow::deposit(&requester, OWNER, 0, 0);
+    }
+}